@@ -1,6 +1,7 @@
 package agreement
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,7 +19,6 @@ import (
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/producer"
 	"github.com/open-horizon/anax/worker"
-	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
@@ -45,6 +45,8 @@ const (
 	EL_AG_UNABLE_WRITE_NODE_EXCH_PATTERN_TO_DB   = "Unable to save the new node exchange pattern %v to the local database. Error: %v"
 	EL_AG_TERM_UNABLE_SYNC_CONTAINERS            = "anax terminating, unable to sync up containers."
 	EL_AG_TERM_UNABLE_SYNC_AGS                   = "anax terminating, unable to complete agreement sync up. %v"
+	EL_AG_MSG_KEY_ROTATED                        = "Node %v/%v rotated its message key and published the new public key to the Exchange."
+	EL_AG_UNABLE_ROTATE_MSG_KEY                  = "Unable to rotate the message key of node %v/%v, error: %v"
 )
 
 // This is does nothing useful at run time.
@@ -73,8 +75,15 @@ func MarkI18nMessages() {
 	msgPrinter.Sprintf(EL_AG_UNABLE_WRITE_NODE_EXCH_PATTERN_TO_DB)
 	msgPrinter.Sprintf(EL_AG_TERM_UNABLE_SYNC_CONTAINERS)
 	msgPrinter.Sprintf(EL_AG_TERM_UNABLE_SYNC_AGS)
+	msgPrinter.Sprintf(EL_AG_MSG_KEY_ROTATED)
+	msgPrinter.Sprintf(EL_AG_UNABLE_ROTATE_MSG_KEY)
 }
 
+// The subworker that checks if the message key is due for a scheduled rotation or must be published again, and how
+// often it checks.
+const MESSAGE_KEY_ROTATION = "MessageKeyRotation"
+const MESSAGE_KEY_ROTATION_CHECK_S = 600
+
 // must be safely-constructed!!
 type AgreementWorker struct {
 	worker.BaseWorker        // embedded field
@@ -223,6 +232,8 @@ func (w *AgreementWorker) NewEvent(incoming events.Message) {
 			w.Commands <- NewNodeChangeCommand()
 		case events.CHANGE_NODE_POLICY_TYPE:
 			w.Commands <- NewNodePolicyChangeCommand()
+		case events.CHANGE_NODE_AGREEMENT_TYPE:
+			w.Commands <- NewNodeAgreementChangeCommand()
 		}
 
 	case *events.NodeHeartbeatStateChangeMessage:
@@ -238,6 +249,13 @@ func (w *AgreementWorker) NewEvent(incoming events.Message) {
 
 		}
 
+	case *events.MessageKeyRotateMessage:
+		msg, _ := incoming.(*events.MessageKeyRotateMessage)
+		switch msg.Event().Id {
+		case events.MESSAGE_KEY_ROTATE:
+			w.Commands <- NewMessageKeyRotateCommand()
+		}
+
 	default: //nothing
 	}
 
@@ -313,6 +331,8 @@ func (w *AgreementWorker) Initialize() bool {
 		glog.Warningf(logString(fmt.Sprintf("unable to advertise policies with exchange, error: %v", err)))
 	}
 
+	w.DispatchSubworker(MESSAGE_KEY_ROTATION, w.messageKeyRotationCheck, MESSAGE_KEY_ROTATION_CHECK_S, false)
+
 	glog.Info(logString(fmt.Sprintf("waiting for commands.")))
 
 	return true
@@ -495,9 +515,22 @@ func (w *AgreementWorker) CommandHandler(command worker.Command) bool {
 	case *NodeChangeCommand:
 		w.checkNodeChanges()
 
+	case *MessageKeyRotateCommand:
+		w.rotateMessageKey()
+
+	case *MessageKeyPublishCommand:
+		if err := w.patchNodeKey(); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("unable to publish the message key, error: %v", err)))
+		} else {
+			glog.V(3).Infof(logString(fmt.Sprintf("published the message key")))
+		}
+
 	case *NodePolicyChangeCommand:
 		w.checkNodePolicyChanges()
 
+	case *NodeAgreementChangeCommand:
+		w.checkNodeAgreementChanges()
+
 	default:
 		// Unexpected commands are not handled.
 		return false
@@ -572,22 +605,9 @@ func (w *AgreementWorker) syncOnInit() error {
 		return errors.New(logString(fmt.Sprintf("encountered error getting device agreement list from exchange, error %v", err)))
 	} else {
 
-		// Loop through each agreement in the exchange and search for that agreement in our DB. If it should not
-		// be in the exchange, then we have to delete it from the exchange because its presence in the exchange
-		// prevents an agbot from making an agreement with our device. It is posible to have a DB record for
-		// an agreement that is not yet recorded in the exchange (this case is handled later in this function),
-		// but the reverse should not occur normally. Agreements in the exchange must have a record on our local DB.
-		for exchangeAg, _ := range exchangeDeviceAgreements {
-			if agreements, err := persistence.FindEstablishedAgreementsAllProtocols(w.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.IdEAFilter(exchangeAg), persistence.UnarchivedEAFilter()}); err != nil {
-				glog.Errorf(logString(fmt.Sprintf("error searching for agreement %v from exchange agreements. %v", exchangeAg, err)))
-			} else if len(agreements) == 0 {
-				glog.V(3).Infof(logString(fmt.Sprintf("found agreement %v in the exchange that is not in our DB.", exchangeAg)))
-				// Delete the agreement from the exchange.
-				if err := deleteProducerAgreement(w.GetHTTPFactory().NewHTTPClient(nil), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), exchangeAg); err != nil {
-					glog.Errorf(logString(fmt.Sprintf("error deleting agreement %v in exchange: %v", exchangeAg, err)))
-				}
-			}
-		}
+		// It is posible to have a DB record for an agreement that is not yet recorded in the exchange (this case is
+		// handled later in this function), but the reverse should not occur normally.
+		w.deleteUnknownExchangeAgreements(exchangeDeviceAgreements)
 
 	}
 
@@ -665,22 +685,7 @@ func (w *AgreementWorker) syncOnInit() error {
 			} else if ag.AgreementAcceptedTime != 0 && ag.AgreementTerminatedTime == 0 {
 
 				if _, there := exchangeDeviceAgreements[ag.CurrentAgreementId]; !there {
-					glog.Warningf(logString(fmt.Sprintf("agreement %v missing from exchange, adding it back in.", ag.CurrentAgreementId)))
-					if cpol, err := policy.DemarshalPolicy(proposal.TsAndCs()); err != nil {
-						glog.Errorf(logString(fmt.Sprintf("unable to demarshal consumer policy for agreement %v, error %v", ag.CurrentAgreementId, err)))
-					} else {
-						state := ""
-						if ag.AgreementFinalizedTime != 0 {
-							state = "Finalized Agreement"
-						} else if ag.AgreementAcceptedTime != 0 {
-							state = "Agree to proposal"
-						} else {
-							state = "unknown"
-						}
-						if err := w.recordAgreementState(ag.CurrentAgreementId, cpol, state); err != nil {
-							glog.Errorf(logString(fmt.Sprintf("cannot record agreement %v state %v, error: %v", ag.CurrentAgreementId, state, err)))
-						}
-					}
+					w.recordMissingExchangeAgreement(&ag, proposal)
 				}
 				glog.V(3).Infof(logString(fmt.Sprintf("added agreement %v to policy agreement counter.", ag.CurrentAgreementId)))
 			}
@@ -706,6 +711,80 @@ func (w *AgreementWorker) syncOnInit() error {
 
 }
 
+// Loop through each agreement in the exchange and search for that agreement in our DB. If it should not be in the
+// exchange, then we have to delete it from the exchange because its presence in the exchange prevents an agbot from
+// making an agreement with our device. Agreements in the exchange must have a record on our local DB.
+func (w *AgreementWorker) deleteUnknownExchangeAgreements(exchangeDeviceAgreements map[string]exchange.DeviceAgreement) {
+	for exchangeAg, _ := range exchangeDeviceAgreements {
+		if agreements, err := persistence.FindEstablishedAgreementsAllProtocols(w.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.IdEAFilter(exchangeAg), persistence.UnarchivedEAFilter()}); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("error searching for agreement %v from exchange agreements. %v", exchangeAg, err)))
+		} else if len(agreements) == 0 {
+			glog.V(3).Infof(logString(fmt.Sprintf("found agreement %v in the exchange that is not in our DB.", exchangeAg)))
+			// Delete the agreement from the exchange.
+			if err := deleteProducerAgreement(w.GetHTTPFactory(), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), exchangeAg); err != nil {
+				glog.Errorf(logString(fmt.Sprintf("error deleting agreement %v in exchange: %v", exchangeAg, err)))
+			}
+		}
+	}
+}
+
+// Record the state of an accepted agreement that is missing from the exchange.
+func (w *AgreementWorker) recordMissingExchangeAgreement(ag *persistence.EstablishedAgreement, proposal abstractprotocol.Proposal) {
+	glog.Warningf(logString(fmt.Sprintf("agreement %v missing from exchange, adding it back in.", ag.CurrentAgreementId)))
+	if cpol, err := policy.DemarshalPolicy(proposal.TsAndCs()); err != nil {
+		glog.Errorf(logString(fmt.Sprintf("unable to demarshal consumer policy for agreement %v, error %v", ag.CurrentAgreementId, err)))
+	} else {
+		state := ""
+		if ag.AgreementFinalizedTime != 0 {
+			state = "Finalized Agreement"
+		} else if ag.AgreementAcceptedTime != 0 {
+			state = "Agree to proposal"
+		} else {
+			state = "unknown"
+		}
+		if err := w.recordAgreementState(ag.CurrentAgreementId, cpol, state); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("cannot record agreement %v state %v, error: %v", ag.CurrentAgreementId, state, err)))
+		}
+	}
+}
+
+// The exchange changes worker might have missed changes to the agreements of this node. Reconcile the agreements in
+// the exchange with the agreements in the local DB, in both directions. Unlike syncOnInit, the agreements themselves
+// are not checked again, only whether the exchange has a record of them.
+func (w *AgreementWorker) checkNodeAgreementChanges() {
+	glog.V(3).Infof(logString(fmt.Sprintf("checking the exchange node agreements.")))
+
+	exchangeDeviceAgreements, err := w.getAllAgreements()
+	if err != nil {
+		glog.Errorf(logString(fmt.Sprintf("encountered error getting device agreement list from exchange, error %v", err)))
+		return
+	}
+
+	w.deleteUnknownExchangeAgreements(exchangeDeviceAgreements)
+
+	agreements, err := persistence.FindEstablishedAgreementsAllProtocols(w.db, policy.AllAgreementProtocols(), []persistence.EAFilter{persistence.UnarchivedEAFilter()})
+	if err != nil {
+		glog.Errorf(logString(fmt.Sprintf("error searching database: %v", err)))
+		return
+	}
+
+	for _, ag := range agreements {
+		if ag.AgreementAcceptedTime == 0 || ag.AgreementTerminatedTime != 0 {
+			continue
+		} else if _, there := exchangeDeviceAgreements[ag.CurrentAgreementId]; there {
+			continue
+		} else if pph, ok := w.producerPH[ag.AgreementProtocol]; !ok {
+			glog.Errorf(logString(fmt.Sprintf("no protocol handler for agreement %v with protocol %v", ag.CurrentAgreementId, ag.AgreementProtocol)))
+		} else if proposal, err := pph.AgreementProtocolHandler("", "", "").DemarshalProposal(ag.Proposal); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("unable to demarshal proposal for agreement %v, error %v", ag.CurrentAgreementId, err)))
+		} else {
+			w.recordMissingExchangeAgreement(&ag, proposal)
+		}
+	}
+
+	glog.V(3).Infof(logString(fmt.Sprintf("Done checking exchange node agreements.")))
+}
+
 // This function verifies that an agreement is present in the blockchain. An agreement might not be present for a variety of reasons,
 // some of which are legitimate. The purpose of this routine is to figure out whether or not an agreement cancellation
 // has occurred. It returns false if the agreement needs to be cancelled, or if there was an error.
@@ -745,13 +824,17 @@ func (w *AgreementWorker) getAllAgreements() (map[string]exchange.DeviceAgreemen
 	resp = new(exchange.AllDeviceAgreementsResponse)
 
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/nodes/" + exchange.GetId(w.GetExchangeId()) + "/agreements"
+	retry := exchange.NewRetry(w.GetHTTPFactory())
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return exchangeDeviceAgreements, err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return exchangeDeviceAgreements, errors.New(fmt.Sprintf("exceeded %v retries retrieving the agreements of the node for %v", w.GetHTTPFactory().RetryCount, tpErr))
+			}
 			continue
 		} else {
 			exchangeDeviceAgreements = resp.(*exchange.AllDeviceAgreementsResponse).Agreements
@@ -823,20 +906,92 @@ func (w *AgreementWorker) patchNodeKey() error {
 
 	glog.V(3).Infof(logString(fmt.Sprintf("patching messaging key to node entry: %v at %v", pdr.ShortString(), targetURL)))
 
+	retry := exchange.NewRetry(w.GetHTTPFactory())
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.GetHTTPFactory().NewHTTPClient(nil), "PATCH", targetURL, w.GetExchangeId(), w.GetExchangeToken(), pdr, &resp); err != nil {
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries patching the node key for %v", w.GetHTTPFactory().RetryCount, tpErr))
+			}
 			continue
 		} else {
 			glog.V(3).Infof(logString(fmt.Sprintf("patched node key for device %v in exchange: %v", w.GetExchangeId(), resp)))
+			exchange.DeleteCacheNodeWriteThru(exchange.GetOrg(w.GetExchangeId()), exchange.GetId(w.GetExchangeId()))
 			return nil
 		}
 	}
 }
 
+// The subworker that starts a scheduled rotation of the message key, and publishes the key again when the exchange still
+// holds the key that the last rotation replaced, because the exchange could not be reached when the key was rotated.
+// The rotation and the publishing are done by the command handler, so that they do not happen while a proposal is
+// being decrypted or answered.
+func (w *AgreementWorker) messageKeyRotationCheck() int {
+	if w.GetExchangeToken() == "" {
+		return 0
+	} else if exchange.KeysRotationDue("") {
+		glog.V(3).Infof(logString(fmt.Sprintf("message key is due for rotation")))
+		w.Commands <- NewMessageKeyRotateCommand()
+	} else if w.exchangeHasReplacedKey() {
+		glog.Warningf(logString(fmt.Sprintf("the exchange still has the replaced message key, publishing the message key again")))
+		w.Commands <- NewMessageKeyPublishCommand()
+	}
+	return 0
+}
+
+// Returns true if the node's exchange object holds the message key that was replaced by the last rotation. Agbots
+// encrypt their proposals to that key, which the node stops accepting at the end of the grace period.
+func (w *AgreementWorker) exchangeHasReplacedKey() bool {
+	if dev, err := exchange.GetHTTPDeviceHandler(w)(w.GetExchangeId(), ""); err != nil {
+		glog.Warningf(logString(fmt.Sprintf("unable to read node %v from the exchange to check the message key, error: %v", w.GetExchangeId(), err)))
+		return false
+	} else if key, err := base64.StdEncoding.DecodeString(dev.PublicKey); err != nil {
+		glog.Warningf(logString(fmt.Sprintf("unable to decode the message key of node %v in the exchange, error: %v", w.GetExchangeId(), err)))
+		return false
+	} else {
+		return exchange.IsReplacedPublicKey(key)
+	}
+}
+
+// Replace the message key and publish the new public key in the node's exchange object, where agbots read it before
+// they send a proposal. Messages encrypted to the old key are still accepted during the grace period of the rotation.
+// If the new key cannot be published, the rotation check publishes it again until the exchange has it.
+func (w *AgreementWorker) rotateMessageKey() {
+
+	if pDevice, err := persistence.FindExchangeDevice(w.db); err != nil {
+		glog.Errorf(logString(fmt.Sprintf("unable to read node object from the local database, not rotating the message key, error: %v", err)))
+		return
+	} else if pDevice == nil || pDevice.Config.State != persistence.CONFIGSTATE_CONFIGURED {
+		glog.V(3).Infof(logString(fmt.Sprintf("node is not configured, not rotating the message key")))
+		return
+	}
+
+	nodeOrg := exchange.GetOrg(w.GetExchangeId())
+	nodeId := exchange.GetId(w.GetExchangeId())
+
+	err := error(nil)
+	if _, err = exchange.RotateKeys(""); err == nil {
+		err = w.patchNodeKey()
+	}
+
+	if err != nil {
+		glog.Errorf(logString(fmt.Sprintf("unable to rotate the message key, error: %v", err)))
+		eventlog.LogNodeEvent(w.db, persistence.SEVERITY_ERROR,
+			persistence.NewMessageMeta(EL_AG_UNABLE_ROTATE_MSG_KEY, nodeOrg, nodeId, err.Error()),
+			persistence.EC_ERROR_NODE_MESSAGE_KEY_ROTATION,
+			nodeId, nodeOrg, w.devicePattern, "")
+	} else {
+		glog.V(3).Infof(logString(fmt.Sprintf("rotated the message key")))
+		eventlog.LogNodeEvent(w.db, persistence.SEVERITY_INFO,
+			persistence.NewMessageMeta(EL_AG_MSG_KEY_ROTATED, nodeOrg, nodeId),
+			persistence.EC_NODE_MESSAGE_KEY_ROTATED,
+			nodeId, nodeOrg, w.devicePattern, "")
+	}
+}
+
 func (w *AgreementWorker) advertiseAllPolicies() error {
 
 	var pType, pValue, pCompare string
@@ -957,44 +1112,33 @@ func (w *AgreementWorker) recordAgreementState(agreementId string, pol *policy.P
 	as.Services = services
 	as.AgreementService = workload
 
-	var resp interface{}
-	resp = new(exchange.PostDeviceResponse)
-	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/nodes/" + exchange.GetId(w.GetExchangeId()) + "/agreements/" + agreementId
-	for {
-		if err, tpErr := exchange.InvokeExchange(w.GetHTTPFactory().NewHTTPClient(nil), "PUT", targetURL, w.GetExchangeId(), w.GetExchangeToken(), as, &resp); err != nil {
-			glog.Errorf(err.Error())
-			return err
-		} else if tpErr != nil {
-			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
-			continue
-		} else {
-			glog.V(5).Infof(logString(fmt.Sprintf("set agreement %v to state %v", agreementId, state)))
-			return nil
-		}
+	// The state goes through the outbox so that it is sent after any update of the agreement that is queued there.
+	if err := exchange.SendToExchange(w.GetHTTPFactory(), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), exchange.OUTBOX_AGREEMENT+agreementId, "PUT", exchange.NodePath(w.GetExchangeId(), "/agreements/"+agreementId), as, nil); exchange.IsOutboxQueued(err) {
+		glog.Warningf(logString(err.Error()))
+		return nil
+	} else if err != nil {
+		glog.Errorf(err.Error())
+		return err
+	} else {
+		glog.V(5).Infof(logString(fmt.Sprintf("set agreement %v to state %v", agreementId, state)))
+		return nil
 	}
 
 }
 
-func deleteProducerAgreement(httpClient *http.Client, url string, deviceId string, token string, agreementId string) error {
+func deleteProducerAgreement(httpClientFactory *config.HTTPClientFactory, url string, deviceId string, token string, agreementId string) error {
 
 	glog.V(5).Infof(logString(fmt.Sprintf("deleting agreement %v in exchange", agreementId)))
 
-	var resp interface{}
-	resp = new(exchange.PostDeviceResponse)
-	targetURL := url + "orgs/" + exchange.GetOrg(deviceId) + "/nodes/" + exchange.GetId(deviceId) + "/agreements/" + agreementId
-	for {
-		if err, tpErr := exchange.InvokeExchange(httpClient, "DELETE", targetURL, deviceId, token, nil, &resp); err != nil {
-			glog.Errorf(logString(fmt.Sprintf(err.Error())))
-			return err
-		} else if tpErr != nil {
-			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
-			continue
-		} else {
-			glog.V(5).Infof(logString(fmt.Sprintf("deleted agreement %v from exchange", agreementId)))
-			return nil
-		}
+	if err := exchange.SendToExchange(httpClientFactory, url, deviceId, token, exchange.OUTBOX_AGREEMENT+agreementId, "DELETE", exchange.NodePath(deviceId, "/agreements/"+agreementId), nil, nil); exchange.IsOutboxQueued(err) {
+		glog.Warningf(logString(err.Error()))
+		return nil
+	} else if err != nil {
+		glog.Errorf(logString(fmt.Sprintf(err.Error())))
+		return err
+	} else {
+		glog.V(5).Infof(logString(fmt.Sprintf("deleted agreement %v from exchange", agreementId)))
+		return nil
 	}
 
 }
@@ -1003,13 +1147,17 @@ func (w *AgreementWorker) deleteMessage(msg *exchange.DeviceMessage) error {
 	var resp interface{}
 	resp = new(exchange.PostDeviceResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/nodes/" + exchange.GetId(w.GetExchangeId()) + "/msgs/" + strconv.Itoa(msg.MsgId)
+	retry := exchange.NewRetry(w.GetHTTPFactory())
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.GetHTTPFactory().NewHTTPClient(nil), "DELETE", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries deleting message %v for %v", w.GetHTTPFactory().RetryCount, msg.MsgId, tpErr))
+			}
 			continue
 		} else {
 			glog.V(3).Infof(logString(fmt.Sprintf("deleted message %v", msg.MsgId)))
@@ -1022,13 +1170,17 @@ func (w *AgreementWorker) messageInExchange(msgId int) (bool, error) {
 	var resp interface{}
 	resp = new(exchange.GetDeviceMessageResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/nodes/" + exchange.GetId(w.GetExchangeId()) + "/msgs/" + strconv.Itoa(msgId)
+	retry := exchange.NewRetry(w.GetHTTPFactory())
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return false, err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return false, errors.New(fmt.Sprintf("exceeded %v retries retrieving message %v for %v", w.GetHTTPFactory().RetryCount, msgId, tpErr))
+			}
 			continue
 		} else {
 			msgs := resp.(*exchange.GetDeviceMessageResponse).Messages
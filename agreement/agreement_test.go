@@ -0,0 +1,93 @@
+// +build unit
+
+package agreement
+
+import (
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/exchange/mockexchange"
+	"github.com/open-horizon/anax/worker"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// When the new message key cannot be published because the exchange is down, the rotation check publishes it again
+// once the exchange is back, and stops once the exchange has it.
+func Test_rotateMessageKey_patch_fails(t *testing.T) {
+	keyDir, err := ioutil.TempDir("", "agreement-keys-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(keyDir)
+	defer setKeyBase(keyDir)()
+
+	exchange.ClearAllResourceCache()
+	defer exchange.ClearAllResourceCache()
+
+	s := mockexchange.NewServer()
+	defer s.Close()
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+
+	nodeId := "myorg/node1"
+	n, err := s.NewNode(nodeId, "nodetoken", exchange.Device{Name: "node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	ec := worker.NewExchangeContext(nodeId, "nodetoken", n.Config.Edge.ExchangeURL, "", n.Config.Collaborators.HTTPClientFactory)
+	w := &AgreementWorker{BaseWorker: worker.NewBaseWorker("AgreementWorker", n.Config, ec), db: n.DB}
+
+	if err := w.patchNodeKey(); err != nil {
+		t.Fatal(err)
+	}
+	dev, _ := s.Node(nodeId)
+	oldKey := dev.PublicKey
+
+	// The key is rotated while the exchange is down, so the exchange keeps the replaced key.
+	s.SetUnavailable(true)
+	w.rotateMessageKey()
+	s.SetUnavailable(false)
+
+	if dev, _ := s.Node(nodeId); dev.PublicKey != oldKey {
+		t.Fatalf("the exchange should still have the replaced key")
+	}
+
+	w.messageKeyRotationCheck()
+	select {
+	case cmd := <-w.Commands:
+		if _, ok := cmd.(*MessageKeyPublishCommand); !ok {
+			t.Fatalf("expected a publish command, got %v", cmd)
+		}
+		w.CommandHandler(cmd)
+	default:
+		t.Fatalf("the rotation check did not publish the key again")
+	}
+
+	if dev, _ := s.Node(nodeId); dev.PublicKey == oldKey || dev.PublicKey == "" {
+		t.Errorf("the exchange should have the new key")
+	}
+
+	// Once the exchange has the new key, it is not published again.
+	w.messageKeyRotationCheck()
+	select {
+	case cmd := <-w.Commands:
+		t.Errorf("unexpected command %v", cmd)
+	default:
+	}
+}
+
+// Keep the message keys in the directory, and return a function that restores the key location.
+func setKeyBase(dir string) func() {
+	prev, set := os.LookupEnv("HZN_VAR_BASE")
+	_ = os.Setenv("HZN_VAR_BASE", dir)
+
+	return func() {
+		_ = exchange.DeleteKeys("")
+		if set {
+			_ = os.Setenv("HZN_VAR_BASE", prev)
+		} else {
+			_ = os.Unsetenv("HZN_VAR_BASE")
+		}
+	}
+}
@@ -90,3 +90,39 @@ func (c NodePolicyChangeCommand) ShortString() string {
 func NewNodePolicyChangeCommand() *NodePolicyChangeCommand {
 	return &NodePolicyChangeCommand{}
 }
+
+// ==============================================================================================================
+type NodeAgreementChangeCommand struct {
+}
+
+func (c NodeAgreementChangeCommand) ShortString() string {
+	return fmt.Sprintf("NodeAgreementChangeCommand")
+}
+
+func NewNodeAgreementChangeCommand() *NodeAgreementChangeCommand {
+	return &NodeAgreementChangeCommand{}
+}
+
+// ==============================================================================================================
+type MessageKeyRotateCommand struct {
+}
+
+func (c MessageKeyRotateCommand) ShortString() string {
+	return fmt.Sprintf("MessageKeyRotateCommand")
+}
+
+func NewMessageKeyRotateCommand() *MessageKeyRotateCommand {
+	return &MessageKeyRotateCommand{}
+}
+
+// ==============================================================================================================
+type MessageKeyPublishCommand struct {
+}
+
+func (c MessageKeyPublishCommand) ShortString() string {
+	return fmt.Sprintf("MessageKeyPublishCommand")
+}
+
+func NewMessageKeyPublishCommand() *MessageKeyPublishCommand {
+	return &MessageKeyPublishCommand{}
+}
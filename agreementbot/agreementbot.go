@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
+	"github.com/open-horizon/anax/agreementbot/export"
 	"github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
@@ -30,6 +31,7 @@ const GOVERN_ARCHIVED_AGREEMENTS = "AgBotGovernArchivedAgreements"
 const POLICY_WATCHER = "AgBotPolicyWatcher"
 const STALE_PARTITIONS = "AgbotStaleDatabasePartition"
 const MESSAGE_KEY_CHECK = "AgbotMessageKeyCheck"
+const MESSAGE_KEY_ROTATION = "AgbotMessageKeyRotation"
 
 // Agreement governance timing state. Used in the GovernAgreements subworker.
 type DVState struct {
@@ -53,8 +55,9 @@ type AgreementBotWorker struct {
 	GovTiming         DVState
 	shutdownStarted   bool
 	MMSObjectPM       *MMSObjectPolicyManager
-	noworkDispatch    int64       // The last time the NoWorkHandler was dispatched.
-	nodeSearch        *NodeSearch // The object that controls node searches and the state of search sessions.
+	noworkDispatch    int64            // The last time the NoWorkHandler was dispatched.
+	nodeSearch        *NodeSearch      // The object that controls node searches and the state of search sessions.
+	exporter          *export.Exporter // Exports archived agreements before they are purged, nil when export is not configured.
 }
 
 func NewAgreementBotWorker(name string, cfg *config.HorizonConfig, db persistence.AgbotDatabase) *AgreementBotWorker {
@@ -161,6 +164,15 @@ func (w *AgreementBotWorker) NewEvent(incoming events.Message) {
 			}
 		}
 
+	case *events.MessageKeyRotateMessage:
+		if w.ready {
+			msg, _ := incoming.(*events.MessageKeyRotateMessage)
+			switch msg.Event().Id {
+			case events.MESSAGE_KEY_ROTATE:
+				w.Commands <- NewMessageKeyRotateCommand()
+			}
+		}
+
 	case *events.ABApiWorkloadUpgradeMessage:
 		if w.ready {
 			msg, _ := incoming.(*events.ABApiWorkloadUpgradeMessage)
@@ -247,6 +259,12 @@ func (w *AgreementBotWorker) NewEvent(incoming events.Message) {
 			w.nodeSearch.SetRescanNeeded()
 		}
 
+	case *events.ConfigReloadedMessage:
+		msg, _ := incoming.(*events.ConfigReloadedMessage)
+		if msg.HasField("AgreementBot.AgreementBatchSize") || msg.HasField("AgreementBot.FullRescanS") {
+			w.Commands <- NewConfigReloadedCommand(msg)
+		}
+
 	default: //nothing
 
 	}
@@ -374,6 +392,7 @@ func (w *AgreementBotWorker) Initialize() bool {
 	w.DispatchSubworker(GOVERN_ARCHIVED_AGREEMENTS, w.GovernArchivedAgreements, 1800, false)
 	//w.DispatchSubworker(GOVERN_BC_NEEDS, w.GovernBlockchainNeeds, 60, false)
 	w.DispatchSubworker(MESSAGE_KEY_CHECK, w.messageKeyCheck, w.BaseWorker.Manager.Config.AgreementBot.MessageKeyCheck, false)
+	w.DispatchSubworker(MESSAGE_KEY_ROTATION, w.messageKeyRotationCheck, 600, false)
 
 	if w.Config.AgreementBot.CheckUpdatedPolicyS != 0 {
 		// Use custom subworker APIs for the policy watcher because it is stateful and already does its own time management.
@@ -567,6 +586,12 @@ func (w *AgreementBotWorker) CommandHandler(command worker.Command) bool {
 		w.shutdownStarted = true
 		glog.V(4).Infof("AgreementBotWorker received start shutdown command")
 
+	case *ConfigReloadedCommand:
+		w.nodeSearch.Reconfigure(w.Config)
+
+	case *MessageKeyRotateCommand:
+		w.rotateMessageKey()
+
 	default:
 		return false
 	}
@@ -610,7 +635,7 @@ func (w *AgreementBotWorker) processProtocolMessage() {
 			} else if !w.consumerPH.Has(msgProtocol) {
 				glog.Infof(fmt.Sprintf("AgreementBotWorker unable to direct exchange message %v to a protocol handler, deleting it.", protocolMessage))
 				deleteMessage = false
-				DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.httpClient)
+				DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.Config.Collaborators.HTTPClientFactory)
 			} else {
 				// The message seems to be good, so don't delete it yet, the protocol worker that handles the message will delete it.
 				deleteMessage = false
@@ -619,9 +644,9 @@ func (w *AgreementBotWorker) processProtocolMessage() {
 				cmd := NewNewProtocolMessageCommand(protocolMessage, msg.MsgId, msg.DeviceId, msg.DevicePubKey)
 				if !w.consumerPH.Get(msgProtocol).AcceptCommand(cmd) {
 					glog.Infof(fmt.Sprintf("AgreementBotWorker protocol handler for %v not accepting exchange messages, deleting msg.", msgProtocol))
-					DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.httpClient)
+					DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.Config.Collaborators.HTTPClientFactory)
 				} else if err := w.consumerPH.Get(msgProtocol).DispatchProtocolMessage(cmd, w.consumerPH.Get(msgProtocol)); err != nil {
-					DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.httpClient)
+					DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.Config.Collaborators.HTTPClientFactory)
 				}
 
 			}
@@ -629,7 +654,7 @@ func (w *AgreementBotWorker) processProtocolMessage() {
 			// If anything went wrong trying to decrypt the message or verify its origin, etc, just delete it. These errors aren't
 			// expected to be retryable.
 			if deleteMessage {
-				DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.httpClient)
+				DeleteMessage(msg.MsgId, w.GetExchangeId(), w.GetExchangeToken(), w.GetExchangeURL(), w.Config.Collaborators.HTTPClientFactory)
 			}
 
 		}
@@ -780,13 +805,17 @@ func (w *AgreementBotWorker) getMessages() ([]exchange.AgbotMessage, error) {
 	var resp interface{}
 	resp = new(exchange.GetAgbotMessageResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/agbots/" + exchange.GetId(w.GetExchangeId()) + "/msgs"
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.httpClient, "GET", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return nil, errors.New(fmt.Sprintf("exceeded %v retries getting messages for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, tpErr))
+			}
 			continue
 		} else {
 			glog.V(3).Infof(fmt.Sprintf("AgreementBotWorker retrieved %v messages", len(resp.(*exchange.GetAgbotMessageResponse).Messages)))
@@ -796,20 +825,24 @@ func (w *AgreementBotWorker) getMessages() ([]exchange.AgbotMessage, error) {
 	}
 }
 
-func DeleteConsumerAgreement(httpClient *http.Client, url string, agbotId string, token string, agreementId string) error {
+func DeleteConsumerAgreement(httpClientFactory *config.HTTPClientFactory, url string, agbotId string, token string, agreementId string) error {
 
 	glog.V(5).Infof(AWlogString(fmt.Sprintf("deleting agreement %v in exchange", agreementId)))
 
 	var resp interface{}
 	resp = new(exchange.PostDeviceResponse)
 	targetURL := url + "orgs/" + exchange.GetOrg(agbotId) + "/agbots/" + exchange.GetId(agbotId) + "/agreements/" + agreementId
+	retry := exchange.NewRetry(httpClientFactory)
+
 	for {
-		if err, tpErr := exchange.InvokeExchange(httpClient, "DELETE", targetURL, agbotId, token, nil, &resp); err != nil && !strings.Contains(err.Error(), "not found") {
+		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "DELETE", targetURL, agbotId, token, nil, &resp); err != nil && !strings.Contains(err.Error(), "not found") {
 			glog.Errorf(AWlogString(fmt.Sprintf(err.Error())))
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries deleting agreement %v for %v", httpClientFactory.RetryCount, agreementId, tpErr))
+			}
 			continue
 		} else {
 			glog.V(5).Infof(AWlogString(fmt.Sprintf("deleted agreement %v from exchange", agreementId)))
@@ -819,17 +852,21 @@ func DeleteConsumerAgreement(httpClient *http.Client, url string, agbotId string
 
 }
 
-func DeleteMessage(msgId int, agbotId, agbotToken, exchangeURL string, httpClient *http.Client) error {
+func DeleteMessage(msgId int, agbotId, agbotToken, exchangeURL string, httpClientFactory *config.HTTPClientFactory) error {
 	var resp interface{}
 	resp = new(exchange.PostDeviceResponse)
 	targetURL := exchangeURL + "orgs/" + exchange.GetOrg(agbotId) + "/agbots/" + exchange.GetId(agbotId) + "/msgs/" + strconv.Itoa(msgId)
+	retry := exchange.NewRetry(httpClientFactory)
+
 	for {
-		if err, tpErr := exchange.InvokeExchange(httpClient, "DELETE", targetURL, agbotId, agbotToken, nil, &resp); err != nil {
+		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "DELETE", targetURL, agbotId, agbotToken, nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries deleting message %v for %v", httpClientFactory.RetryCount, msgId, tpErr))
+			}
 			continue
 		} else {
 			glog.V(3).Infof("Deleted exchange message %v", msgId)
@@ -872,7 +909,7 @@ func (w *AgreementBotWorker) syncOnInit() error {
 					} else if existingPol := w.pm.GetPolicy(ag.Org, pol.Header.Name); existingPol == nil {
 						glog.Errorf(AWlogString(fmt.Sprintf("agreement %v has a policy %v that doesn't exist anymore", ag.CurrentAgreementId, pol.Header.Name)))
 						// Update state in exchange
-						if err := DeleteConsumerAgreement(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), ag.CurrentAgreementId); err != nil {
+						if err := DeleteConsumerAgreement(w.Config.Collaborators.HTTPClientFactory, w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), ag.CurrentAgreementId); err != nil {
 							glog.Errorf(AWlogString(fmt.Sprintf("error deleting agreement %v in exchange: %v", ag.CurrentAgreementId, err)))
 						}
 						// Remove any workload usage records so that a new agreement will be made starting from the highest priority workload
@@ -953,7 +990,7 @@ func (w *AgreementBotWorker) syncOnInit() error {
 
 func (w *AgreementBotWorker) cleanupAgreement(ag *persistence.Agreement) {
 	// Update state in exchange
-	if err := DeleteConsumerAgreement(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), ag.CurrentAgreementId); err != nil {
+	if err := DeleteConsumerAgreement(w.Config.Collaborators.HTTPClientFactory, w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), ag.CurrentAgreementId); err != nil {
 		glog.Errorf(AWlogString(fmt.Sprintf("error deleting agreement %v in exchange: %v", ag.CurrentAgreementId, err)))
 	}
 
@@ -987,13 +1024,17 @@ func (w *AgreementBotWorker) recordConsumerAgreementState(agreementId string, po
 	var resp interface{}
 	resp = new(exchange.AllAgbotAgreementsResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/agbots/" + exchange.GetId(w.GetExchangeId()) + "/agreements/" + agreementId
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.httpClient, "PUT", targetURL, w.GetExchangeId(), w.GetExchangeToken(), &as, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries setting agreement %v state to %v for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, agreementId, state, tpErr))
+			}
 			continue
 		} else {
 			glog.V(5).Infof(AWlogString(fmt.Sprintf("set agreement %v to state %v", agreementId, state)))
@@ -1010,13 +1051,17 @@ func (w *AgreementBotWorker) getConsumerAgreementState(agreementId string) (map[
 	var resp interface{}
 	resp = new(exchange.AllAgbotAgreementsResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/agbots/" + exchange.GetId(w.GetExchangeId()) + "/agreements/" + agreementId
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.httpClient, "GET", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return nil, errors.New(fmt.Sprintf("exceeded %v retries getting agreement %v for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, agreementId, tpErr))
+			}
 			continue
 		} else {
 			exchangeAgreement := resp.(*exchange.AllAgbotAgreementsResponse).Agreements
@@ -1043,13 +1088,17 @@ func (w *AgreementBotWorker) registerPublicKey() error {
 	var resp interface{}
 	resp = new(exchange.PostDeviceResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/agbots/" + exchange.GetId(w.GetExchangeId())
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.httpClient, "PATCH", targetURL, w.GetExchangeId(), w.GetExchangeToken(), &as, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries registering the agbot public key for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, tpErr))
+			}
 			continue
 		} else {
 			glog.V(5).Infof(AWlogString(fmt.Sprintf("patched agbot public key %x", as)))
@@ -1058,6 +1107,39 @@ func (w *AgreementBotWorker) registerPublicKey() error {
 	}
 }
 
+// Start a scheduled rotation of the message key. The command handler does the rotation, so that the key does not change
+// while a batch of messages is being processed.
+func (w *AgreementBotWorker) messageKeyRotationCheck() int {
+	if exchange.KeysRotationDue(w.Config.AgreementBot.MessageKeyPath) {
+		glog.V(3).Infof(AWlogString(fmt.Sprintf("agbot message key is due for rotation")))
+		w.Commands <- NewMessageKeyRotateCommand()
+	}
+	return 0
+}
+
+// Replace the message key and register the new public key in the exchange. Replies to proposals that were encrypted
+// to the old key are still accepted during the grace period of the rotation. The key is replaced in memory before it
+// is registered, so that the message key check finds the new key in the exchange.
+func (w *AgreementBotWorker) rotateMessageKey() {
+	if w.shutdownStarted {
+		return
+	}
+
+	if _, err := exchange.RotateKeys(w.Config.AgreementBot.MessageKeyPath); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to rotate the message key, error: %v", err)))
+	} else if err := w.registerPublicKey(); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("rotated the message key but unable to register the new public key, error: %v", err)))
+	} else {
+		glog.Infof(AWlogString(fmt.Sprintf("rotated the message key and registered the new public key")))
+	}
+}
+
+// Returns true if the key is the message key that was replaced by the last rotation. The grace period does not apply,
+// the new key is registered for as long as the exchange holds the old one.
+func (w *AgreementBotWorker) isPreviousMessageKey(key []byte) bool {
+	return exchange.IsReplacedPublicKey(key)
+}
+
 func (w *AgreementBotWorker) serviceResolver(wURL string, wOrg string, wVersion string, wArch string) (*policy.APISpecList, error) {
 
 	asl, _, _, err := exchange.GetHTTPServiceResolverHandler(w)(wURL, wOrg, wVersion, wArch)
@@ -1311,13 +1393,18 @@ func (w *AgreementBotWorker) messageKeyCheck() int {
 	var resp interface{}
 	resp = new(exchange.GetAgbotsResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/agbots/" + exchange.GetId(w.GetExchangeId())
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.httpClient, "GET", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return 0
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				glog.Errorf(AWlogString(fmt.Sprintf("exceeded %v retries checking the agbot message key for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, tpErr)))
+				return 0
+			}
 			continue
 		} else {
 
@@ -1338,6 +1425,14 @@ func (w *AgreementBotWorker) messageKeyCheck() int {
 					panic(msg)
 				}
 
+			} else if !bytes.Equal(key, agbot.PublicKey) && w.isPreviousMessageKey(agbot.PublicKey) {
+
+				// The message key was rotated but the new key has not been registered yet, or registering it failed.
+				glog.Warningf(AWlogString(fmt.Sprintf("agbot message key in the exchange is the key replaced by the last rotation, registering the new key %v", key)))
+				if err := w.registerPublicKey(); err != nil {
+					glog.Errorf(AWlogString(fmt.Sprintf("unable to register public key, error: %v", err)))
+				}
+
 			} else if !bytes.Equal(key, agbot.PublicKey) {
 
 				// Make sure the message key in the exchange is our key. If not, exit quickly.
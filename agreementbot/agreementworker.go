@@ -354,7 +354,7 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 	// workload in the current consumer policy. If that's the case, query the exchange to get all the device
 	// policies so we can merge them.
 	var exchangeDev *exchange.Device
-	if theDev, err := GetDevice(b.config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), wi.Device.Id, b.config.AgreementBot.ExchangeURL, cph.GetExchangeId(), cph.GetExchangeToken()); err != nil {
+	if theDev, err := GetDevice(b.config.Collaborators.HTTPClientFactory, wi.Device.Id, b.config.AgreementBot.ExchangeURL, cph.GetExchangeId(), cph.GetExchangeToken()); err != nil {
 		glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error getting device %v policies, error: %v", wi.Device.Id, err)))
 		return
 	} else {
@@ -1073,7 +1073,7 @@ func (b *BaseAgreementWorker) CancelAgreement(cph ConsumerProtocolHandler, agree
 	}
 
 	// Update state in exchange
-	if err := DeleteConsumerAgreement(b.config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), b.config.AgreementBot.ExchangeURL, cph.GetExchangeId(), cph.GetExchangeToken(), agreementId); err != nil {
+	if err := DeleteConsumerAgreement(b.config.Collaborators.HTTPClientFactory, b.config.AgreementBot.ExchangeURL, cph.GetExchangeId(), cph.GetExchangeToken(), agreementId); err != nil {
 		glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error deleting agreement %v in exchange: %v", agreementId, err)))
 	}
 
@@ -1178,7 +1178,7 @@ func (b *BaseAgreementWorker) incompleteHAGroup(cph ConsumerProtocolHandler, pro
 		// Make sure all partners are in the exchange
 		for _, partnerId := range producerPolicy.HAGroup.Partners {
 
-			if _, err := GetDevice(b.config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), partnerId, b.config.AgreementBot.ExchangeURL, cph.GetExchangeId(), cph.GetExchangeToken()); err != nil {
+			if _, err := GetDevice(b.config.Collaborators.HTTPClientFactory, partnerId, b.config.AgreementBot.ExchangeURL, cph.GetExchangeId(), cph.GetExchangeToken()); err != nil {
 				return errors.New(fmt.Sprintf("could not obtain device %v from the exchange: %v", partnerId, err))
 			}
 		}
@@ -5,20 +5,27 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/gorilla/mux"
+	"github.com/open-horizon/anax/agreementbot/export"
 	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/agreementbot/stats"
 	"github.com/open-horizon/anax/apicommon"
+	"github.com/open-horizon/anax/auditlog"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/metrics"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"io/ioutil"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
 
+var agbotAgreements = metrics.NewGaugeVec("anax_agbot_agreements", "The number of agreements in the agbot database, by protocol and state.", "protocol", "state")
+
 type API struct {
 	worker.Manager // embedded field
 	name           string
@@ -324,17 +331,24 @@ func (a *API) listen(apiListen string) {
 
 		router.HandleFunc("/agreement", a.agreement).Methods("GET", "OPTIONS")
 		router.HandleFunc("/agreement/{id}", a.agreement).Methods("GET", "DELETE", "OPTIONS")
+		router.HandleFunc("/export/agreement", a.exportagreement).Methods("POST", "OPTIONS")
 		router.HandleFunc("/partition", a.partition).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy", a.policy).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy/{org}", a.policy).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy/{org}/{name}", a.policy).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy/{name}/upgrade", a.policy).Methods("POST", "OPTIONS")
 		router.HandleFunc("/workloadusage", a.workloadusage).Methods("GET", "OPTIONS")
+		router.HandleFunc("/stats/agreement", a.agreementstats).Methods("GET", "OPTIONS")
 		router.HandleFunc("/status", a.status).Methods("GET", "OPTIONS")
 		router.HandleFunc("/health", a.health).Methods("GET", "OPTIONS")
 		router.HandleFunc("/status/workers", a.workerstatus).Methods("GET", "OPTIONS")
+		router.HandleFunc("/status/database", a.databasestatus).Methods("GET", "OPTIONS")
+		router.HandleFunc("/metrics", a.metrics).Methods("GET", "OPTIONS")
 		router.HandleFunc("/node", a.node).Methods("GET", "DELETE", "OPTIONS")
+		router.HandleFunc("/node/messagekey", a.messagekey).Methods("POST", "OPTIONS")
+		router.HandleFunc("/audit", a.audit).Methods("GET", "OPTIONS")
 		router.HandleFunc("/config", a.config).Methods("GET", "OPTIONS")
+		router.HandleFunc("/config/reload", a.configreload).Methods("GET", "POST", "OPTIONS")
 		router.HandleFunc("/cache/servedorg", a.ListServedOrgs).Methods("GET", "OPTIONS")
 		router.HandleFunc("/cache/pattern", a.ListPatterns).Methods("GET", "OPTIONS")
 		router.HandleFunc("/cache/pattern/{org}", a.ListPatterns).Methods("GET", "OPTIONS")
@@ -611,6 +625,58 @@ func (a *API) workloadusage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Aggregate the agreements and workload usages into statistics for a time window.
+func (a *API) agreementstats(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		// The times and interval are in seconds, the defaults are set by the stats package.
+		var query stats.Query
+		for name, value := range map[string]*uint64{"start": &query.Start, "end": &query.End, "interval": &query.IntervalS} {
+			if param := r.URL.Query().Get(name); param != "" {
+				if v, err := strconv.ParseUint(param, 10, 64); err != nil {
+					writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: name, Error: fmt.Sprintf("%v must be a number of seconds, error: %v", param, err)})
+					return
+				} else {
+					*value = v
+				}
+			}
+		}
+		query.GroupBy = r.URL.Query().Get("groupby")
+
+		query.SetDefaults(uint64(time.Now().Unix()))
+		if err := query.Validate(); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "query", Error: err.Error()})
+			return
+		}
+
+		// Active and archived agreements are both included.
+		agreements := make([]persistence.Agreement, 0)
+		for _, agp := range policy.AllAgreementProtocols() {
+			if ags, err := a.db.FindAgreements([]persistence.AFilter{}, agp); err != nil {
+				glog.Error(APIlogString(fmt.Sprintf("error finding agreements for protocol %v, error: %v", agp, err)))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			} else {
+				agreements = append(agreements, ags...)
+			}
+		}
+
+		if wlusages, err := a.db.FindWorkloadUsages([]persistence.WUFilter{}); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding all workload usages, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, stats.ComputeAgreementStats(query, agreements, wlusages), http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) status(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
@@ -669,6 +735,72 @@ func (a *API) workerstatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Return the agbot metrics in the Prometheus text format. The agreement counts are read from the database on each scrape.
+func (a *API) metrics(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		counts := make(map[string]map[string]int)
+		for _, agp := range policy.AllAgreementProtocols() {
+			if ags, err := a.db.FindAgreements([]persistence.AFilter{}, agp); err != nil {
+				glog.Error(APIlogString(fmt.Sprintf("error finding agreements for protocol %v, error: %v", agp, err)))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			} else {
+				counts[agp] = make(map[string]int)
+				for _, ag := range ags {
+					counts[agp][agreementState(&ag)] += 1
+				}
+			}
+		}
+
+		agbotAgreements.Reset()
+		for agp, states := range counts {
+			for state, count := range states {
+				agbotAgreements.Set(float64(count), agp, state)
+			}
+		}
+
+		metrics.Handler(w, r)
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// The state of an agreement as it is reported in the metrics.
+func agreementState(ag *persistence.Agreement) string {
+	if ag.Archived {
+		return "archived"
+	} else if ag.AgreementTimedout != 0 {
+		return "terminating"
+	} else if ag.AgreementFinalizedTime != 0 {
+		return "finalized"
+	} else if ag.AgreementCreationTime != 0 {
+		return "accepted"
+	}
+	return "proposed"
+}
+
+// Return the applied schema version of the agbot database, and the migrations that have not been applied.
+func (a *API) databasestatus(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if status, err := persistence.GetSchemaStatus(a.db); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error getting database schema status, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, status, http.StatusOK)
+		}
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) node(w http.ResponseWriter, r *http.Request) {
 
 	resource := "node"
@@ -756,6 +888,93 @@ func (a *API) config(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Rotate the agbot's message key now, instead of waiting for the next scheduled rotation. The agbot worker rotates the
+// key and registers the new public key in the exchange.
+func (a *API) messagekey(w http.ResponseWriter, r *http.Request) {
+
+	resource := "node/messagekey"
+
+	switch r.Method {
+	case "POST":
+		glog.V(5).Infof(APIlogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		if !exchange.HasKeys() {
+			http.Error(w, "The agbot does not have a message key yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		a.Messages() <- events.NewMessageKeyRotateMessage(events.MESSAGE_KEY_ROTATE)
+		w.WriteHeader(http.StatusNoContent)
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Get the changes that the agbot made in the exchange, selected by the query parameters.
+func (a *API) audit(w http.ResponseWriter, r *http.Request) {
+
+	resource := "audit"
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(APIlogString(fmt.Sprintf("Handling %v on resource %v with selection %v", r.Method, resource, r.URL.Query())))
+
+		auditLog := exchange.GetAuditLog()
+		if auditLog == nil {
+			http.Error(w, "The audit log is not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		if filter, err := auditlog.ParseFilter(r.URL.Query()); err != nil {
+			http.Error(w, fmt.Sprintf("Error parsing the selections, error: %v", err), http.StatusBadRequest)
+		} else if records, err := auditLog.Query(filter); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error reading the audit log, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, records, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Reload the parts of the configuration that can be changed without a restart. Changes to other fields are reported
+// in the result, they are not an error.
+func (a *API) configreload(w http.ResponseWriter, r *http.Request) {
+	reloader := worker.GetConfigReloader()
+
+	switch r.Method {
+	case "GET":
+		if reloader == nil {
+			http.Error(w, "Configuration reload is not available", http.StatusServiceUnavailable)
+		} else {
+			writeResponse(w, reloader.Status(), http.StatusOK)
+		}
+	case "POST":
+		if reloader == nil {
+			http.Error(w, "Configuration reload is not available", http.StatusServiceUnavailable)
+		} else if result := reloader.Reload(worker.RELOAD_SOURCE_API); result.Error != "" {
+			glog.Error(APIlogString(fmt.Sprintf("error reloading the configuration, error: %v", result.Error)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, result, http.StatusOK)
+		}
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) partition(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
@@ -823,6 +1042,60 @@ func (a *API) partition(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Export the archived agreements that were in effect during a time range to a file in the archive export directory.
+func (a *API) exportagreement(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "POST":
+		var exportReq ExportRequest
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &exportReq); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: fmt.Sprintf("user submitted data couldn't be deserialized to struct: %v. Error: %v", string(body), err)})
+			return
+		} else if ok, msg := exportReq.IsValid(); !ok {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: msg})
+			return
+		} else if !a.Config.AgreementBot.ArchiveExport.IsEnabled() {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: "archive export is not configured on this agbot"})
+			return
+		}
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("handling archived agreement export request %v", exportReq)))
+
+		exporter, err := export.NewExporter(&a.Config.AgreementBot.ArchiveExport)
+		if err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error initializing archived agreement export, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Collect the archived agreements from all the agreement protocols.
+		agreements := make([]persistence.Agreement, 0)
+		filters := []persistence.AFilter{persistence.ArchivedAFilter(), export.TimeRangeAFilter(exportReq.Start, exportReq.End)}
+		for _, agp := range policy.AllAgreementProtocols() {
+			if ags, err := a.db.FindAgreements(filters, agp); err != nil {
+				glog.Error(APIlogString(fmt.Sprintf("error finding archived agreements for protocol %v, error: %v", agp, err)))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			} else {
+				agreements = append(agreements, ags...)
+			}
+		}
+
+		if fileName, err := exporter.ExportRange(agreements, exportReq.Start, exportReq.End, exportReq.Format); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error exporting archived agreements, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, ExportResponse{File: fileName, Agreements: len(agreements)}, http.StatusCreated)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 // ==========================================================================================
 // Utility functions used by many of the API endpoints.
 //
@@ -938,6 +1211,29 @@ func (b *UpgradeDevice) IsValid() (bool, string) {
 	return true, ""
 }
 
+// A request to export the archived agreements that were in effect during a time range. The times are in seconds since
+// the epoch, an end of 0 means up to now.
+type ExportRequest struct {
+	Start  uint64 `json:"start"`
+	End    uint64 `json:"end"`
+	Format string `json:"format"` // The format of the export file, json or csv. The default is the configured format.
+}
+
+func (e *ExportRequest) IsValid() (bool, string) {
+	if e.End != 0 && e.End < e.Start {
+		return false, "end must not be before start"
+	} else if e.Format != "" && e.Format != config.ArchiveExportFormat_JSON && e.Format != config.ArchiveExportFormat_CSV {
+		return false, fmt.Sprintf("format must be %v or %v", config.ArchiveExportFormat_JSON, config.ArchiveExportFormat_CSV)
+	}
+	return true, ""
+}
+
+// The result of an export request.
+type ExportResponse struct {
+	File       string `json:"file"`
+	Agreements int    `json:"agreements"`
+}
+
 // Utility functions used by all the http handlers for each API path.
 func serializeResponse(w http.ResponseWriter, payload interface{}) ([]byte, bool) {
 	glog.V(6).Infof(APIlogString(fmt.Sprintf("response payload before serialization (%T): %v", payload, payload)))
@@ -0,0 +1,78 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	_ "github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/policy"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_metrics_scrape(t *testing.T) {
+	db, err := persistence.InitDatabase(&config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}})
+	if err != nil {
+		t.Fatalf("unable to initialize database, error: %v", err)
+	}
+	defer db.Close()
+
+	// ag1 is proposed, ag2 is finalized, ag3 is being terminated and ag4 is archived.
+	for _, agid := range []string{"ag1", "ag2", "ag3", "ag4"} {
+		if err := db.AgreementAttempt(agid, "myorg", "myorg/"+agid, "device", "myorg/pol", "", "", "", "Basic", "", []string{"myorg/svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unable to create agreement %v, error: %v", agid, err)
+		}
+	}
+	for _, agid := range []string{"ag2", "ag3", "ag4"} {
+		if _, err := db.AgreementMade(agid, "myorg/"+agid, "sig", "Basic", []string{}, "", "", ""); err != nil {
+			t.Fatalf("unable to update agreement %v, error: %v", agid, err)
+		} else if _, err := db.AgreementFinalized(agid, "Basic"); err != nil {
+			t.Fatalf("unable to finalize agreement %v, error: %v", agid, err)
+		}
+	}
+	if _, err := db.AgreementTimedout("ag3", "Basic"); err != nil {
+		t.Fatalf("unable to terminate agreement, error: %v", err)
+	} else if _, err := db.ArchiveAgreement("ag4", "Basic", 1, "test"); err != nil {
+		t.Fatalf("unable to archive agreement, error: %v", err)
+	}
+
+	// Buffered work is reported by priority.
+	wq := NewPrioritizedWorkQueue(10)
+	defer wq.Close()
+	work := NewCancelAgreement("ag3", "Basic", 100, 0)
+	wq.AddToLowPriorityBuffer(&work)
+
+	a := &API{db: db}
+	server := httptest.NewServer(http.HandlerFunc(a.metrics))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("unable to scrape metrics, error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unable to read metrics, error: %v", err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %v: %v", resp.StatusCode, string(body))
+	}
+
+	for _, expected := range []string{
+		"anax_agbot_agreements{protocol=\"Basic\",state=\"proposed\"} 1\n",
+		"anax_agbot_agreements{protocol=\"Basic\",state=\"finalized\"} 1\n",
+		"anax_agbot_agreements{protocol=\"Basic\",state=\"terminating\"} 1\n",
+		"anax_agbot_agreements{protocol=\"Basic\",state=\"archived\"} 1\n",
+		"anax_agbot_work_queue_buffer_length{priority=\"high\"} 0\n",
+		"anax_agbot_work_queue_buffer_length{priority=\"low\"} 1\n",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected %v in the metrics, got:\n%v", expected, string(body))
+		}
+	}
+}
@@ -18,6 +18,9 @@ type ChangesWorker struct {
 	orgList           []string // The list of orgs for which this worker should see changes.
 	noworkDispatch    int64    // The last time the NoWorkHandler was dispatched.
 	mmsObjectPollTime int64    // The last time the MMS was polled for changes
+
+	exchangeVersion string // The version of the exchange that returned the last changes.
+	changesRead     int64  // When the changes were last read, in seconds since 1970.
 }
 
 func NewChangesWorker(name string, cfg *config.HorizonConfig) *ChangesWorker {
@@ -133,6 +136,17 @@ func (w *ChangesWorker) findAndProcessChanges() {
 	// the agbot worker.
 	batchedEvents := make(map[events.EventId]bool)
 
+	// If changes might have been missed, rescan all the resources that the agbot gets changes for. The change ID is
+	// not saved, the agbot starts from the latest change ID with a full scan when it restarts.
+	gap := changes.GetChangesGap(w.changeID, w.exchangeVersion)
+	if gap == "" {
+		gap = exchange.GetChangesRetentionGap(w.changesRead, w.Config.GetAgbotExchangeChangesRetentionS())
+	}
+	w.changesRead = time.Now().Unix()
+	if gap != "" {
+		w.startResync(gap, batchedEvents)
+	}
+
 	// Loop through each change to identify resources that we are interested in, and then send out event messages
 	// to notify the other workers that they have some work to do.
 	for _, change := range changes.Changes {
@@ -215,6 +229,7 @@ func (w *ChangesWorker) getChangeId() error {
 
 	} else {
 		w.changeID = maxChangeID.MaxChangeID
+		w.changesRead = time.Now().Unix()
 	}
 
 	// Ensure the agbot does initial scans across resources.
@@ -224,6 +239,22 @@ func (w *ChangesWorker) getChangeId() error {
 	return nil
 }
 
+// Some changes might have been missed. The served orgs are gathered again and their cached exchange resources are
+// dropped, then the agbot worker is told that every resource it tracks has changed.
+func (w *ChangesWorker) startResync(gap string, batchedEvents map[events.EventId]bool) {
+	glog.Warningf(chglog(fmt.Sprintf("changes might have been missed because %v, rescanning all resources", gap)))
+
+	w.orgList = w.gatherServedOrgs(nil)
+	for _, org := range w.orgList {
+		exchange.DeleteOrgCachedResources(org)
+	}
+
+	for _, ev := range []events.EventId{events.CHANGE_AGBOT_MESSAGE_TYPE, events.CHANGE_AGBOT_SERVED_POLICY, events.CHANGE_AGBOT_SERVED_PATTERN,
+		events.CHANGE_AGBOT_AGREEMENT_TYPE, events.CHANGE_NODE_TYPE, events.CHANGE_NODE_POLICY_TYPE, events.CHANGE_NODE_AGREEMENT_TYPE} {
+		batchedEvents[ev] = true
+	}
+}
+
 // Send change message for each change type in the map that is set to true.
 func (w *ChangesWorker) emitChangeMessages(resChanges map[events.EventId]bool) {
 	for changeType, _ := range resChanges {
@@ -233,6 +264,10 @@ func (w *ChangesWorker) emitChangeMessages(resChanges map[events.EventId]bool) {
 
 // Record the most recent change id based on the changes that were found.
 func (w *ChangesWorker) postProcessChanges(changes *exchange.ExchangeChanges) {
+	if changes.GetExchangeVersion() != "" {
+		w.exchangeVersion = changes.GetExchangeVersion()
+	}
+
 	// If there were changes found, even uninteresting changes, we need to keep the most recent change id current.
 	if changes.GetMostRecentChangeID() != 0 {
 		w.changeID = changes.GetMostRecentChangeID() + 1
@@ -360,3 +360,30 @@ func (e ServedPolicyCommand) ShortString() string {
 func NewServedPolicyCommand() *ServedPolicyCommand {
 	return &ServedPolicyCommand{}
 }
+
+// ==============================================================================================================
+type ConfigReloadedCommand struct {
+	Msg events.ConfigReloadedMessage
+}
+
+func (e ConfigReloadedCommand) ShortString() string {
+	return e.Msg.ShortString()
+}
+
+func NewConfigReloadedCommand(msg *events.ConfigReloadedMessage) *ConfigReloadedCommand {
+	return &ConfigReloadedCommand{
+		Msg: *msg,
+	}
+}
+
+// ==============================================================================================================
+type MessageKeyRotateCommand struct {
+}
+
+func (e MessageKeyRotateCommand) ShortString() string {
+	return "MessageKeyRotateCommand"
+}
+
+func NewMessageKeyRotateCommand() *MessageKeyRotateCommand {
+	return &MessageKeyRotateCommand{}
+}
@@ -16,7 +16,6 @@ import (
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"net/http"
-	"time"
 )
 
 func CreateConsumerPH(name string, cfg *config.HorizonConfig, db persistence.AgbotDatabase, pm *policy.PolicyManager, msgq chan events.Message, mmsObjMgr *MMSObjectPolicyManager) ConsumerProtocolHandler {
@@ -141,7 +140,7 @@ func (w *BaseConsumerProtocolHandler) sendMessage(mt interface{}, pay []byte) er
 	glog.V(5).Infof(BCPHlogstring(w.Name(), fmt.Sprintf("sending exchange message to: %v, message %v", messageTarget.ReceiverExchangeId, string(pay))))
 
 	// Get my own keys
-	myPubKey, myPrivKey, keyErr := exchange.GetKeys(w.config.AgreementBot.MessageKeyPath)
+	_, myPrivKey, keyErr := exchange.GetKeys(w.config.AgreementBot.MessageKeyPath)
 	if keyErr != nil {
 		return errors.New(fmt.Sprintf("error getting keys: %v", keyErr))
 	}
@@ -155,24 +154,25 @@ func (w *BaseConsumerProtocolHandler) sendMessage(mt interface{}, pay []byte) er
 		}
 	}
 
-	// Create an encrypted message
-	if encryptedMsg, err := exchange.ConstructExchangeMessage(pay, myPubKey, myPrivKey, messageTarget.ReceiverPublicKeyObj); err != nil {
+	// Create an encrypted message, in the envelope that both keys support
+	if msgBody, err := exchange.ConstructVersionedExchangeMessage(pay, myPrivKey, messageTarget.ReceiverPublicKeyObj); err != nil {
 		return errors.New(fmt.Sprintf("Unable to construct encrypted message, error %v for message %s", err, pay))
-		// Marshal it into a byte array
-	} else if msgBody, err := json.Marshal(encryptedMsg); err != nil {
-		return errors.New(fmt.Sprintf("Unable to marshal exchange message, error %v for message %v", err, encryptedMsg))
 		// Send it to the device's message queue
 	} else {
 		pm := exchange.CreatePostMessage(msgBody, w.config.AgreementBot.ExchangeMessageTTL)
 		var resp interface{}
 		resp = new(exchange.PostDeviceResponse)
 		targetURL := w.config.AgreementBot.ExchangeURL + "orgs/" + exchange.GetOrg(messageTarget.ReceiverExchangeId) + "/nodes/" + exchange.GetId(messageTarget.ReceiverExchangeId) + "/msgs"
+		retry := exchange.NewRetry(w.config.Collaborators.HTTPClientFactory)
+
 		for {
 			if err, tpErr := exchange.InvokeExchange(w.httpClient, "POST", targetURL, w.agbotId, w.token, pm, &resp); err != nil {
 				return err
 			} else if tpErr != nil {
 				glog.Warningf(tpErr.Error())
-				time.Sleep(10 * time.Second)
+				if !retry.Backoff(tpErr) {
+					return errors.New(fmt.Sprintf("exceeded %v retries sending message to %v for %v", w.config.Collaborators.HTTPClientFactory.RetryCount, messageTarget.ReceiverExchangeId, tpErr))
+				}
 				continue
 			} else {
 				glog.V(5).Infof(BCPHlogstring(w.Name(), fmt.Sprintf("sent message for %v to exchange.", messageTarget.ReceiverExchangeId)))
@@ -455,13 +455,17 @@ func (b *BaseConsumerProtocolHandler) RecordConsumerAgreementState(agreementId s
 	var resp interface{}
 	resp = new(exchange.PostDeviceResponse)
 	targetURL := b.config.AgreementBot.ExchangeURL + "orgs/" + exchange.GetOrg(b.agbotId) + "/agbots/" + exchange.GetId(b.agbotId) + "/agreements/" + agreementId
+	retry := exchange.NewRetry(b.config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(b.httpClient, "PUT", targetURL, b.agbotId, b.token, &as, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries setting agreement %v state to %v for %v", b.config.Collaborators.HTTPClientFactory.RetryCount, agreementId, state, tpErr))
+			}
 			continue
 		} else {
 			glog.V(5).Infof(BCPHlogstring2(workerID, fmt.Sprintf("set agreement %v to state %v", agreementId, state)))
@@ -473,7 +477,7 @@ func (b *BaseConsumerProtocolHandler) RecordConsumerAgreementState(agreementId s
 
 func (b *BaseConsumerProtocolHandler) DeleteMessage(msgId int) error {
 
-	return DeleteMessage(msgId, b.agbotId, b.token, b.config.AgreementBot.ExchangeURL, b.httpClient)
+	return DeleteMessage(msgId, b.agbotId, b.token, b.config.AgreementBot.ExchangeURL, b.config.Collaborators.HTTPClientFactory)
 
 }
 
@@ -526,13 +530,17 @@ func (b *BaseConsumerProtocolHandler) getDevice(deviceId string, workerId string
 	var resp interface{}
 	resp = new(exchange.GetDevicesResponse)
 	targetURL := b.config.AgreementBot.ExchangeURL + "orgs/" + exchange.GetOrg(deviceId) + "/nodes/" + exchange.GetId(deviceId)
+	retry := exchange.NewRetry(b.config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(b.config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), "GET", targetURL, b.agbotId, b.token, nil, &resp); err != nil {
 			glog.Errorf(BCPHlogstring2(workerId, fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(BCPHlogstring2(workerId, tpErr.Error()))
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return nil, errors.New(fmt.Sprintf("exceeded %v retries retrieving device %v for %v", b.config.Collaborators.HTTPClientFactory.RetryCount, deviceId, tpErr))
+			}
 			continue
 		} else {
 			devs := resp.(*exchange.GetDevicesResponse).Devices
@@ -0,0 +1,390 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Archived agreements are purged from the agbot database after a while. Before they are purged, they can be exported to
+// files so that there is a long term record of which nodes ran which services, and when. Purged agreements are appended to
+// the current export file, which is rotated when it gets too big. An export of the archived agreements that were active
+// during a time range can also be written to a file of its own.
+
+// The name of the file that purged agreements are appended to. Rotated files have a timestamp added to the name.
+const EXPORT_FILE_PREFIX = "archived_agreements"
+
+// The name of a file holding the export of a time range.
+const RANGE_FILE_PREFIX = "agreements_range"
+
+// The time format added to rotated and time range file names. It sorts in time order.
+const FILE_TIME_FORMAT = "20060102T150405.000000000Z"
+
+// The name of the file that records the agreements that were exported but not yet purged from the database.
+const EXPORTED_FILE = ".exported_agreements.json"
+
+// The information about an archived agreement that is exported. The proposal, policy and other large or sensitive
+// fields of the agreement are not exported.
+type ArchivedAgreement struct {
+	AgreementId           string   `json:"agreement_id"`
+	Protocol              string   `json:"agreement_protocol"`
+	Org                   string   `json:"org"`
+	DeviceId              string   `json:"device_id"`
+	DeviceType            string   `json:"device_type"`
+	PolicyName            string   `json:"policy_name"`
+	Pattern               string   `json:"pattern"`
+	ServiceId             []string `json:"service_id"`
+	InceptionTime         uint64   `json:"agreement_inception_time"`
+	CreationTime          uint64   `json:"agreement_creation_time"`
+	FinalizedTime         uint64   `json:"agreement_finalized_time"`
+	TerminatedTime        uint64   `json:"agreement_terminated_time"`
+	TerminatedReason      uint     `json:"terminated_reason"`
+	TerminatedDescription string   `json:"terminated_description"`
+}
+
+func (a ArchivedAgreement) String() string {
+	return fmt.Sprintf("AgreementId: %v, Protocol: %v, Org: %v, DeviceId: %v, DeviceType: %v, PolicyName: %v, Pattern: %v, ServiceId: %v, "+
+		"InceptionTime: %v, CreationTime: %v, FinalizedTime: %v, TerminatedTime: %v, TerminatedReason: %v, TerminatedDescription: %v",
+		a.AgreementId, a.Protocol, a.Org, a.DeviceId, a.DeviceType, a.PolicyName, a.Pattern, a.ServiceId,
+		a.InceptionTime, a.CreationTime, a.FinalizedTime, a.TerminatedTime, a.TerminatedReason, a.TerminatedDescription)
+}
+
+// The column names of the CSV format, in the same order as the values returned by csvRecord.
+var csvHeader = []string{"agreement_id", "agreement_protocol", "org", "device_id", "device_type", "policy_name", "pattern", "service_id",
+	"agreement_inception_time", "agreement_creation_time", "agreement_finalized_time", "agreement_terminated_time",
+	"terminated_reason", "terminated_description"}
+
+func (a ArchivedAgreement) csvRecord() []string {
+	return []string{a.AgreementId, a.Protocol, a.Org, a.DeviceId, a.DeviceType, a.PolicyName, a.Pattern, strings.Join(a.ServiceId, ";"),
+		strconv.FormatUint(a.InceptionTime, 10), strconv.FormatUint(a.CreationTime, 10), strconv.FormatUint(a.FinalizedTime, 10),
+		strconv.FormatUint(a.TerminatedTime, 10), strconv.FormatUint(uint64(a.TerminatedReason), 10), a.TerminatedDescription}
+}
+
+func NewArchivedAgreement(ag *persistence.Agreement) *ArchivedAgreement {
+	serviceId := ag.ServiceId
+	if serviceId == nil {
+		serviceId = []string{}
+	}
+	return &ArchivedAgreement{
+		AgreementId:           ag.CurrentAgreementId,
+		Protocol:              ag.AgreementProtocol,
+		Org:                   ag.Org,
+		DeviceId:              ag.DeviceId,
+		DeviceType:            ag.DeviceType,
+		PolicyName:            ag.PolicyName,
+		Pattern:               ag.Pattern,
+		ServiceId:             serviceId,
+		InceptionTime:         ag.AgreementInceptionTime,
+		CreationTime:          ag.AgreementCreationTime,
+		FinalizedTime:         ag.AgreementFinalizedTime,
+		TerminatedTime:        ag.AgreementTimedout,
+		TerminatedReason:      ag.TerminatedReason,
+		TerminatedDescription: ag.TerminatedDescription,
+	}
+}
+
+// A filter that selects archived agreements that were in effect at some time during the time range, inclusive. An end
+// time of 0 means there is no end to the range.
+func TimeRangeAFilter(start uint64, end uint64) persistence.AFilter {
+	return func(a persistence.Agreement) bool {
+		return (end == 0 || a.AgreementInceptionTime <= end) && a.AgreementTimedout >= start
+	}
+}
+
+// Returns the file name extension used for the export format.
+func fileExtension(format string) string {
+	if format == config.ArchiveExportFormat_CSV {
+		return "csv"
+	}
+	return "jsonl"
+}
+
+func validateFormat(format string) error {
+	if format != config.ArchiveExportFormat_JSON && format != config.ArchiveExportFormat_CSV {
+		return errors.New(fmt.Sprintf("archive export format %v is not supported, must be %v or %v", format, config.ArchiveExportFormat_JSON, config.ArchiveExportFormat_CSV))
+	}
+	return nil
+}
+
+// Write archived agreements to a writer in the export format. The CSV header is written first when header is true.
+func WriteAgreements(w io.Writer, format string, header bool, ags []persistence.Agreement) error {
+	if err := validateFormat(format); err != nil {
+		return err
+	}
+
+	if format == config.ArchiveExportFormat_CSV {
+		cw := csv.NewWriter(w)
+		if header {
+			if err := cw.Write(csvHeader); err != nil {
+				return errors.New(fmt.Sprintf("unable to write CSV header, error: %v", err))
+			}
+		}
+		for _, ag := range ags {
+			if err := cw.Write(NewArchivedAgreement(&ag).csvRecord()); err != nil {
+				return errors.New(fmt.Sprintf("unable to write agreement %v, error: %v", ag.CurrentAgreementId, err))
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	enc := json.NewEncoder(w)
+	for _, ag := range ags {
+		if err := enc.Encode(NewArchivedAgreement(&ag)); err != nil {
+			return errors.New(fmt.Sprintf("unable to write agreement %v, error: %v", ag.CurrentAgreementId, err))
+		}
+	}
+	return nil
+}
+
+// The Exporter appends archived agreements to the current export file, rotating it when it exceeds the configured size
+// and deleting the oldest rotated files when there are too many. The agreements that are exported are remembered, in
+// memory and in the export directory, until they are purged. An agreement that could not be purged after it was exported
+// is not exported again. It is safe for concurrent use.
+type Exporter struct {
+	lock     sync.Mutex
+	dir      string
+	format   string
+	maxSize  int64
+	maxFiles int
+	exported map[string]bool
+}
+
+func NewExporter(cfg *config.ArchiveExportConfig) (*Exporter, error) {
+	if !cfg.IsEnabled() {
+		return nil, errors.New("archive export path is not configured")
+	} else if err := validateFormat(cfg.Format); err != nil {
+		return nil, err
+	} else if err := os.MkdirAll(cfg.Path, 0700); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to create archive export directory %v, error: %v", cfg.Path, err))
+	}
+
+	e := &Exporter{
+		dir:      cfg.Path,
+		format:   cfg.Format,
+		maxSize:  cfg.MaxFileSizeKB * 1024,
+		maxFiles: cfg.MaxFiles,
+		exported: make(map[string]bool),
+	}
+
+	if content, err := ioutil.ReadFile(e.exportedFile()); err != nil && !os.IsNotExist(err) {
+		return nil, errors.New(fmt.Sprintf("unable to read exported agreements from %v, error: %v", e.exportedFile(), err))
+	} else if err == nil {
+		ids := make([]string, 0)
+		if err := json.Unmarshal(content, &ids); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to read exported agreements from %v, error: %v", e.exportedFile(), err))
+		}
+		for _, id := range ids {
+			e.exported[id] = true
+		}
+	}
+
+	return e, nil
+}
+
+func (e *Exporter) String() string {
+	return fmt.Sprintf("Dir: %v, Format: %v, MaxSize: %v, MaxFiles: %v", e.dir, e.format, e.maxSize, e.maxFiles)
+}
+
+// The path of the file that agreements are currently appended to.
+func (e *Exporter) CurrentFile() string {
+	return path.Join(e.dir, EXPORT_FILE_PREFIX+"."+fileExtension(e.format))
+}
+
+// The path of the file that records the agreements that were exported but not yet purged.
+func (e *Exporter) exportedFile() string {
+	return path.Join(e.dir, EXPORTED_FILE)
+}
+
+// Append agreements to the current export file. The file is synced to disk before returning, so the agreements can be
+// safely purged from the database when there is no error. Agreements that were already exported are skipped, so call
+// Purged once the agreements are deleted from the database.
+func (e *Exporter) Export(ags []persistence.Agreement) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	newAgs := make([]persistence.Agreement, 0, len(ags))
+	for _, ag := range ags {
+		if !e.exported[ag.CurrentAgreementId] {
+			newAgs = append(newAgs, ag)
+		}
+	}
+	if len(newAgs) == 0 {
+		return nil
+	}
+	ags = newAgs
+
+	fileName := e.CurrentFile()
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to open archive export file %v, error: %v", fileName, err))
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.New(fmt.Sprintf("unable to stat archive export file %v, error: %v", fileName, err))
+	}
+
+	if err := WriteAgreements(f, e.format, info.Size() == 0, ags); err != nil {
+		f.Close()
+		return errors.New(fmt.Sprintf("unable to write to archive export file %v, error: %v", fileName, err))
+	} else if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.New(fmt.Sprintf("unable to sync archive export file %v, error: %v", fileName, err))
+	}
+
+	info, err = f.Stat()
+	f.Close()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to stat archive export file %v, error: %v", fileName, err))
+	}
+
+	glog.V(5).Infof("Exported %v archived agreements to %v", len(ags), fileName)
+
+	// The agreements are safely exported, so a failure to record them is only logged. They are still remembered until
+	// the agbot restarts.
+	for _, ag := range ags {
+		e.exported[ag.CurrentAgreementId] = true
+	}
+	if err := e.saveExported(); err != nil {
+		glog.Errorf("Unable to record the exported agreements in %v, error: %v", e.exportedFile(), err)
+	}
+
+	// The agreements are safely exported, so a failure to rotate is only logged. Rotation is attempted again on the next export.
+	if e.maxSize > 0 && info.Size() >= e.maxSize {
+		if err := e.rotate(); err != nil {
+			glog.Errorf("Unable to rotate archive export file %v, error: %v", fileName, err)
+		}
+	}
+	return nil
+}
+
+// Forget the agreements that were exported, once they are deleted from the database.
+func (e *Exporter) Purged(agreementIds []string) error {
+	if len(agreementIds) == 0 {
+		return nil
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, id := range agreementIds {
+		delete(e.exported, id)
+	}
+	return e.saveExported()
+}
+
+// Write the agreements that were exported but not purged to the export directory. The file is replaced in one step so
+// that it is never partially written. The caller must hold the lock.
+func (e *Exporter) saveExported() error {
+	ids := make([]string, 0, len(e.exported))
+	for id := range e.exported {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	content, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	tmpName := e.exportedFile() + ".tmp"
+	if err := ioutil.WriteFile(tmpName, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, e.exportedFile())
+}
+
+// Rename the current export file and delete the oldest rotated files beyond the configured limit. The caller must hold the lock.
+func (e *Exporter) rotate() error {
+	ext := fileExtension(e.format)
+	rotated := path.Join(e.dir, fmt.Sprintf("%v-%v.%v", EXPORT_FILE_PREFIX, time.Now().UTC().Format(FILE_TIME_FORMAT), ext))
+	if err := os.Rename(e.CurrentFile(), rotated); err != nil {
+		return err
+	}
+	glog.V(3).Infof("Rotated archive export file to %v", rotated)
+
+	if e.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := e.RotatedFiles()
+	if err != nil {
+		return err
+	}
+	for len(files) > e.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		glog.V(3).Infof("Deleted archive export file %v", files[0])
+		files = files[1:]
+	}
+	return nil
+}
+
+// Return the rotated export files, oldest first.
+func (e *Exporter) RotatedFiles() ([]string, error) {
+	entries, err := ioutil.ReadDir(e.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := EXPORT_FILE_PREFIX + "-"
+	suffix := "." + fileExtension(e.format)
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) && strings.HasSuffix(entry.Name(), suffix) {
+			files = append(files, path.Join(e.dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Write the agreements that were exported for a time range to a new file in the export directory, in the requested format.
+// An empty format means the configured format. The path of the new file is returned.
+func (e *Exporter) ExportRange(ags []persistence.Agreement, start uint64, end uint64, format string) (string, error) {
+	if format == "" {
+		format = e.format
+	} else if err := validateFormat(format); err != nil {
+		return "", err
+	}
+
+	fileName := path.Join(e.dir, fmt.Sprintf("%v-%v-%v-%v.%v", RANGE_FILE_PREFIX, start, end, time.Now().UTC().Format(FILE_TIME_FORMAT), fileExtension(format)))
+
+	// Write to a temporary file first so that a partial export is never mistaken for a complete one.
+	tmpName := fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("unable to create archive export file %v, error: %v", tmpName, err))
+	}
+
+	if err := WriteAgreements(f, format, true, ags); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return "", errors.New(fmt.Sprintf("unable to write to archive export file %v, error: %v", tmpName, err))
+	} else if err := f.Close(); err != nil {
+		os.Remove(tmpName)
+		return "", errors.New(fmt.Sprintf("unable to close archive export file %v, error: %v", tmpName, err))
+	} else if err := os.Rename(tmpName, fileName); err != nil {
+		os.Remove(tmpName)
+		return "", errors.New(fmt.Sprintf("unable to rename archive export file %v, error: %v", tmpName, err))
+	}
+
+	glog.V(3).Infof("Exported %v archived agreements between %v and %v to %v", len(ags), start, end, fileName)
+	return fileName, nil
+}
@@ -0,0 +1,291 @@
+// +build unit
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_WriteAgreements_json(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAgreements(&buf, config.ArchiveExportFormat_JSON, true, testAgreements(2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %v", lines)
+	}
+
+	var ag ArchivedAgreement
+	if err := json.Unmarshal([]byte(lines[1]), &ag); err != nil {
+		t.Errorf("unable to unmarshal %v, error: %v", lines[1], err)
+	} else if ag.AgreementId != "ag1" || ag.DeviceId != "myorg/dev1" || ag.TerminatedTime != 1100 || ag.TerminatedDescription != "node policy changed" {
+		t.Errorf("unexpected exported agreement %v", ag)
+	}
+
+	if strings.Contains(buf.String(), "secret proposal") {
+		t.Errorf("the proposal should not be exported: %v", buf.String())
+	}
+}
+
+func Test_WriteAgreements_csv(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAgreements(&buf, config.ArchiveExportFormat_CSV, true, testAgreements(2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to read CSV, error: %v", err)
+	} else if len(records) != 3 {
+		t.Fatalf("expected a header and 2 records, got %v", records)
+	} else if records[0][0] != "agreement_id" || len(records[0]) != len(records[1]) {
+		t.Errorf("unexpected header %v", records[0])
+	} else if records[2][0] != "ag1" || records[2][7] != "myorg/svc1;myorg/svc2" || records[2][13] != "node policy changed" {
+		t.Errorf("unexpected record %v", records[2])
+	}
+
+	buf.Reset()
+	WriteAgreements(&buf, config.ArchiveExportFormat_CSV, false, testAgreements(1))
+	if strings.HasPrefix(buf.String(), "agreement_id") {
+		t.Errorf("header should not be written: %v", buf.String())
+	}
+}
+
+func Test_WriteAgreements_bad_format(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAgreements(&buf, "xml", true, testAgreements(1)); err == nil {
+		t.Errorf("expected error for an unsupported format")
+	}
+}
+
+func Test_TimeRangeAFilter(t *testing.T) {
+	ag := persistence.Agreement{AgreementInceptionTime: 100, AgreementTimedout: 200}
+
+	tests := []struct {
+		start  uint64
+		end    uint64
+		result bool
+	}{
+		{0, 0, true},
+		{150, 0, true},
+		{201, 0, false},
+		{0, 99, false},
+		{0, 100, true},
+		{50, 150, true},
+		{120, 180, true},
+		{200, 300, true},
+	}
+
+	for _, test := range tests {
+		if TimeRangeAFilter(test.start, test.end)(ag) != test.result {
+			t.Errorf("expected %v for range %v to %v", test.result, test.start, test.end)
+		}
+	}
+}
+
+func Test_Exporter_export_and_rotate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	cfg := &config.ArchiveExportConfig{Path: dir, Format: config.ArchiveExportFormat_CSV, MaxFileSizeKB: 1, MaxFiles: 2}
+	e, err := NewExporter(cfg)
+	if err != nil {
+		t.Fatalf("unable to create exporter, error: %v", err)
+	}
+
+	// Each export is small enough to stay under the rotation size.
+	for i := 0; i < 2; i++ {
+		exportAndPurge(t, e, testAgreements(2))
+	}
+
+	if lines := readLines(t, e.CurrentFile()); len(lines) != 5 {
+		t.Errorf("expected a header and 4 records, got %v", lines)
+	} else if lines[0] != strings.Join(csvHeader, ",") || lines[3] != lines[1] {
+		t.Errorf("expected a single header followed by records, got %v", lines)
+	}
+
+	if files, err := e.RotatedFiles(); err != nil || len(files) != 0 {
+		t.Errorf("expected no rotated files, got %v, error: %v", files, err)
+	}
+
+	// Each of these exports is bigger than the rotation size, so every one is rotated and only the newest 2 are kept.
+	for i := 0; i < 4; i++ {
+		exportAndPurge(t, e, testAgreements(20))
+	}
+
+	if _, err := os.Stat(e.CurrentFile()); !os.IsNotExist(err) {
+		t.Errorf("expected the current file to be rotated, error: %v", err)
+	}
+
+	files, err := e.RotatedFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(files) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", files)
+	}
+
+	// The rotated files start with a header.
+	for _, f := range files {
+		if lines := readLines(t, f); len(lines) != 21 || lines[0] != strings.Join(csvHeader, ",") {
+			t.Errorf("unexpected content in rotated file %v: %v", f, lines)
+		}
+	}
+
+	// A new current file is started by the next export.
+	if err := e.Export(testAgreements(1)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if lines := readLines(t, e.CurrentFile()); len(lines) != 2 {
+		t.Errorf("expected a header and 1 record, got %v", lines)
+	}
+}
+
+// Agreements that were exported but not purged are not exported again, even by a new exporter.
+func Test_Exporter_export_once(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	cfg := &config.ArchiveExportConfig{Path: dir, Format: config.ArchiveExportFormat_JSON, MaxFileSizeKB: 10}
+	e, err := NewExporter(cfg)
+	if err != nil {
+		t.Fatalf("unable to create exporter, error: %v", err)
+	}
+
+	if err := e.Export(testAgreements(2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := e.Export(testAgreements(3)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if lines := readLines(t, e.CurrentFile()); len(lines) != 3 {
+		t.Errorf("expected 3 records, got %v", lines)
+	}
+
+	// Only ag0 was purged, so it is the only one that can be exported again.
+	if err := e.Purged([]string{"ag0"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restarted, err := NewExporter(cfg)
+	if err != nil {
+		t.Fatalf("unable to create exporter, error: %v", err)
+	} else if err := restarted.Export(testAgreements(3)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if lines := readLines(t, e.CurrentFile()); len(lines) != 4 || !strings.Contains(lines[3], `"ag0"`) {
+		t.Errorf("expected ag0 to be exported again, got %v", lines)
+	}
+}
+
+func Test_Exporter_ExportRange(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	e, err := NewExporter(&config.ArchiveExportConfig{Path: path.Join(dir, "export"), Format: config.ArchiveExportFormat_JSON, MaxFileSizeKB: 10})
+	if err != nil {
+		t.Fatalf("unable to create exporter, error: %v", err)
+	}
+
+	if fileName, err := e.ExportRange(testAgreements(3), 100, 200, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !strings.HasSuffix(fileName, ".jsonl") || !strings.Contains(fileName, RANGE_FILE_PREFIX+"-100-200-") {
+		t.Errorf("unexpected file name %v", fileName)
+	} else if lines := readLines(t, fileName); len(lines) != 3 {
+		t.Errorf("expected 3 records, got %v", lines)
+	}
+
+	if fileName, err := e.ExportRange(testAgreements(3), 100, 0, config.ArchiveExportFormat_CSV); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !strings.HasSuffix(fileName, ".csv") {
+		t.Errorf("unexpected file name %v", fileName)
+	} else if lines := readLines(t, fileName); len(lines) != 4 {
+		t.Errorf("expected a header and 3 records, got %v", lines)
+	}
+
+	if _, err := e.ExportRange(testAgreements(1), 100, 0, "xml"); err == nil {
+		t.Errorf("expected error for an unsupported format")
+	}
+
+	// Range exports are not rotated files.
+	if files, err := e.RotatedFiles(); err != nil || len(files) != 0 {
+		t.Errorf("expected no rotated files, got %v, error: %v", files, err)
+	}
+}
+
+func Test_NewExporter_errors(t *testing.T) {
+	if _, err := NewExporter(&config.ArchiveExportConfig{}); err == nil {
+		t.Errorf("expected error when the path is not configured")
+	} else if _, err := NewExporter(&config.ArchiveExportConfig{Path: "/tmp/notused", Format: "xml"}); err == nil {
+		t.Errorf("expected error for an unsupported format")
+	}
+}
+
+// Export the agreements and purge them, so that the same agreements can be exported again.
+func exportAndPurge(t *testing.T, e *Exporter, ags []persistence.Agreement) {
+	if err := e.Export(ags); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids := make([]string, 0, len(ags))
+	for _, ag := range ags {
+		ids = append(ids, ag.CurrentAgreementId)
+	}
+	if err := e.Purged(ids); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func testAgreements(num int) []persistence.Agreement {
+	ags := make([]persistence.Agreement, 0, num)
+	for i := 0; i < num; i++ {
+		ags = append(ags, persistence.Agreement{
+			CurrentAgreementId:     fmt.Sprintf("ag%v", i),
+			Org:                    "myorg",
+			DeviceId:               fmt.Sprintf("myorg/dev%v", i),
+			DeviceType:             "device",
+			AgreementProtocol:      "Basic",
+			AgreementInceptionTime: uint64(1000 + i),
+			AgreementCreationTime:  uint64(1010 + i),
+			AgreementFinalizedTime: uint64(1020 + i),
+			AgreementTimedout:      uint64(1100 + i - 1),
+			Proposal:               "secret proposal",
+			PolicyName:             "myorg/pol",
+			ServiceId:              []string{"myorg/svc1", "myorg/svc2"},
+			Archived:               true,
+			TerminatedReason:       200,
+			TerminatedDescription:  "node policy changed",
+		})
+	}
+	return ags
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "archive-export-")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	return dir
+}
+
+func readLines(t *testing.T, fileName string) []string {
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("unable to open %v, error: %v", fileName, err)
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
@@ -4,13 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/export"
 	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/policy"
 	"math"
-	"net/http"
 	"time"
 )
 
@@ -350,7 +351,7 @@ func (w *AgreementBotWorker) checkWorkloadUsageAgreement(partnerWLU *persistence
 		// Check to make sure the partner is heart-beating to the exchange. This should tell us if we can expect this device to
 		// complete an agreement at some time, or not.
 
-		if dev, err := GetDevice(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), partnerWLU.DeviceId, w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken()); err != nil {
+		if dev, err := GetDevice(w.Config.Collaborators.HTTPClientFactory, partnerWLU.DeviceId, w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken()); err != nil {
 			glog.Errorf(logString(fmt.Sprintf("error obtaining device %v heartbeat state: %v", partnerWLU.DeviceId, err)))
 		} else if len(dev.LastHeartbeat) != 0 && (uint64(cutil.TimeInSeconds(dev.LastHeartbeat, cutil.ExchangeTimeFormat)+300) > uint64(time.Now().Unix())) {
 			// If the device is still alive (heart beat received in the last 5 mins), then assume this partner is trying to make an
@@ -428,7 +429,7 @@ func (w *AgreementBotWorker) TerminateAgreement(ag *persistence.Agreement, reaso
 	w.consumerPH.Get(ag.AgreementProtocol).HandleAgreementTimeout(NewAgreementTimeoutCommand(ag.CurrentAgreementId, ag.AgreementProtocol, reason), w.consumerPH.Get(ag.AgreementProtocol))
 }
 
-func GetDevice(httpClient *http.Client, deviceId string, url string, agbotId string, token string) (*exchange.Device, error) {
+func GetDevice(httpClientFactory *config.HTTPClientFactory, deviceId string, url string, agbotId string, token string) (*exchange.Device, error) {
 
 	glog.V(5).Infof(logString(fmt.Sprintf("retrieving device %v from exchange", deviceId)))
 
@@ -440,13 +441,17 @@ func GetDevice(httpClient *http.Client, deviceId string, url string, agbotId str
 	var resp interface{}
 	resp = new(exchange.GetDevicesResponse)
 	targetURL := url + "orgs/" + exchange.GetOrg(deviceId) + "/nodes/" + exchange.GetId(deviceId)
+	retry := exchange.NewRetry(httpClientFactory)
+
 	for {
-		if err, tpErr := exchange.InvokeExchange(httpClient, "GET", targetURL, agbotId, token, nil, &resp); err != nil {
+		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "GET", targetURL, agbotId, token, nil, &resp); err != nil {
 			glog.Errorf(logString(err.Error()))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(logString(tpErr.Error()))
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return nil, errors.New(fmt.Sprintf("exceeded %v retries retrieving device %v for %v", httpClientFactory.RetryCount, deviceId, tpErr))
+			}
 			continue
 		} else {
 			devs := resp.(*exchange.GetDevicesResponse).Devices
@@ -462,10 +467,20 @@ func GetDevice(httpClient *http.Client, deviceId string, url string, agbotId str
 }
 
 // Govern the archived agreements, periodically deleting them from the database if they are old enough. The
-// age limit is defined by the agbot configuration, PurgeArchivedAgreementHours.
+// age limit is defined by the agbot configuration, PurgeArchivedAgreementHours. When archive export is configured,
+// the agreements are exported before they are deleted, and they are not deleted if the export fails.
 //
 func (w *AgreementBotWorker) GovernArchivedAgreements() int {
 
+	if w.Config.AgreementBot.ArchiveExport.IsEnabled() && w.exporter == nil {
+		if exporter, err := export.NewExporter(&w.Config.AgreementBot.ArchiveExport); err != nil {
+			glog.Errorf(logString(fmt.Sprintf("unable to initialize archived agreement export, archived agreements will not be purged, error: %v", err)))
+			return 0
+		} else {
+			w.exporter = exporter
+		}
+	}
+
 	// Default to purging archived agreements an hour after they are terminated.
 	ageLimit := 1
 	if w.Config.AgreementBot.PurgeArchivedAgreementHours != 0 {
@@ -487,11 +502,26 @@ func (w *AgreementBotWorker) GovernArchivedAgreements() int {
 	for _, agp := range policy.AllAgreementProtocols() {
 		now := time.Now().Unix()
 		if agreements, err := w.db.FindAgreements([]persistence.AFilter{persistence.ArchivedAFilter(), agedOutFilter(now, ageLimit)}, agp); err == nil {
+			if w.exporter != nil {
+				if err := w.exporter.Export(agreements); err != nil {
+					glog.Errorf(logString(fmt.Sprintf("unable to export archived agreements for protocol %v, they will not be purged, error: %v", agp, err)))
+					continue
+				}
+			}
+			purged := make([]string, 0, len(agreements))
 			for _, ag := range agreements {
 				if err := w.db.DeleteAgreement(ag.CurrentAgreementId, agp); err != nil {
 					glog.Error(logString(fmt.Sprintf("error deleting archived agreement %v, error: %v", ag.CurrentAgreementId, err)))
 				} else {
 					glog.V(3).Infof(logString(fmt.Sprintf("archive purge deleted %v", ag.CurrentAgreementId)))
+					purged = append(purged, ag.CurrentAgreementId)
+				}
+			}
+
+			// The agreements that were not deleted are not exported again on the next purge.
+			if w.exporter != nil {
+				if err := w.exporter.Purged(purged); err != nil {
+					glog.Errorf(logString(fmt.Sprintf("unable to record the purged archived agreements, error: %v", err)))
 				}
 			}
 
@@ -33,6 +33,7 @@ type NodeSearch struct {
 	rescanLock           sync.Mutex // The lock that protects the rescanNeeded flag. The rescanNeeded flag can be checked/changed on different threads.
 	rescanNeeded         bool       // A broad indicator that something policy or pattern related changed, and therefore the agbot needs to rescan all nodes.
 	batchSize            uint64     // The max number of nodes that this object will process in a deployment policy search result.
+	nextBatchSize        uint64     // A batch size from a reloaded configuration, it is used when the next search starts.
 	activeDeviceTimeoutS int        // The amount of time a device can go without heartbeating and still be considered active for the purposes of search.
 	retryLookBack        uint64     // The amount of time to look backward for node changes when node retries are happening.
 	policyOrder          bool       // When true, order policies most recently changed to least recently changed.
@@ -108,6 +109,23 @@ func (n *NodeSearch) IsRescanNeeded() bool {
 	return n.rescanNeeded
 }
 
+// Pick up the search settings from a reloaded configuration. The full rescan interval takes effect immediately. The batch
+// size is used by the search thread, so a new batch size takes effect when the next search starts.
+func (n *NodeSearch) Reconfigure(cfg *config.HorizonConfig) {
+	n.fullRescanIntervalS = cfg.GetAgbotFullRescan()
+	n.nextBatchSize = cfg.GetAgbotAgreementBatchSize()
+	glog.V(3).Infof(AWlogString(fmt.Sprintf("node search reconfigured, full rescan interval: %v, batch size: %v", n.fullRescanIntervalS, n.nextBatchSize)))
+}
+
+// Start a search on a sub-thread, after applying a new batch size if there is one.
+func (n *NodeSearch) startSearch() {
+	if n.nextBatchSize != 0 {
+		n.batchSize = n.nextBatchSize
+		n.nextBatchSize = 0
+	}
+	go n.findAndMakeAgreements()
+}
+
 // This is the main driving function in this object. It will initiate a node scan if needed, using an exiting search session or obtain a new one if needed.
 // The actual processing of a node scan for all policies and patterns is actually performed on a sub-thread. This function also also handles updating
 // itself if a previous scan has completed since the last time this method was called.
@@ -130,7 +148,7 @@ func (n *NodeSearch) Scan() {
 		n.lastSearchTime = uint64(time.Now().Unix())
 		glog.V(3).Infof(AWlogString("Polling Exchange (full rescan)"))
 		n.lastSearchComplete = false
-		go n.findAndMakeAgreements()
+		n.startSearch()
 	}
 
 	// If changes in the system have occurred such that a rescan is needed, start a scan now.
@@ -139,7 +157,7 @@ func (n *NodeSearch) Scan() {
 		glog.V(3).Infof(AWlogString("Polling Exchange"))
 		n.lastSearchComplete = false
 		n.UnsetRescanNeeded()
-		go n.findAndMakeAgreements()
+		n.startSearch()
 	}
 
 }
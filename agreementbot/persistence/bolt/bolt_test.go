@@ -0,0 +1,30 @@
+// +build unit
+
+package bolt
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence/conformance"
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_Conformance(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "agbot-bolt-")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{DBPath: dir}}
+
+	db := new(AgbotBoltDB)
+	if err := db.Initialize(cfg); err != nil {
+		t.Fatalf("unable to initialize bolt database, error: %v", err)
+	}
+	defer db.Close()
+
+	conformance.RunConformanceTests(t, db)
+}
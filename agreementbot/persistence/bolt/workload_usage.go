@@ -125,7 +125,8 @@ func (db *AgbotBoltDB) DeleteWorkloadUsage(deviceid string, policyName string) e
 		if wlUsage, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid, policyName); err != nil {
 			return err
 		} else if wlUsage == nil {
-			return fmt.Errorf("Unable to locate workload usage for device: %v, and policy: %v", deviceid, policyName)
+			glog.Errorf("Warning: record deletion requested, but workload usage for device %v and policy %v does not exist", deviceid, policyName)
+			return nil // handle already-deleted workload usage as success, same as the other database implementations
 		} else {
 
 			pk := wlUsage.Id
@@ -0,0 +1,512 @@
+package conformance
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// This package contains a set of tests that every AgbotDatabase implementation must pass. Each implementation's
+// own tests initialize a database handle and then call RunConformanceTests with it. The tests only assert behavior that
+// the runtime depends on, so that a difference between implementations shows up as a test failure in the implementation
+// that behaves differently.
+//
+// All records created by the tests use names that are unique to the test run so that the tests can be run against a
+// database that is shared with other tests, and the tests remove the records they create.
+
+const (
+	testOrg        = "conformance"
+	testDeviceType = "device"
+)
+
+// Run all the conformance tests against an initialized database.
+func RunConformanceTests(t *testing.T, db persistence.AgbotDatabase) {
+
+	prefix := fmt.Sprintf("%v/conf%v", testOrg, time.Now().UnixNano())
+
+	t.Run("AgreementLifecycle", func(t *testing.T) { testAgreementLifecycle(t, db, prefix) })
+	t.Run("AgreementStateTransitions", func(t *testing.T) { testAgreementStateTransitions(t, db, prefix) })
+	t.Run("ArchivedAgreements", func(t *testing.T) { testArchivedAgreements(t, db, prefix) })
+	t.Run("ConcurrentAgreements", func(t *testing.T) { testConcurrentAgreements(t, db, prefix) })
+	t.Run("WorkloadUsageLifecycle", func(t *testing.T) { testWorkloadUsageLifecycle(t, db, prefix) })
+	t.Run("Partitions", func(t *testing.T) { testPartitions(t, db) })
+	t.Run("SearchSessions", func(t *testing.T) { testSearchSessions(t, db, prefix) })
+
+}
+
+func testAgreementLifecycle(t *testing.T, db persistence.AgbotDatabase, prefix string) {
+
+	agid := prefix + "-ag-lifecycle"
+	protocol := policy.BasicProtocol
+	device := prefix + "-dev1"
+	polName := prefix + "-pol1"
+
+	if err := db.AgreementAttempt("", testOrg, device, testDeviceType, polName, "", "", "", protocol, "", []string{"svc1"}, policy.NodeHealth{}); err == nil {
+		t.Errorf("expected error creating agreement without an id")
+	}
+
+	if err := db.AgreementAttempt(agid, testOrg, device, testDeviceType, polName, "", "", "", protocol, "pattern1", []string{"svc1"}, policy.NodeHealth{MissingHBInterval: 60}); err != nil {
+		t.Fatalf("error creating agreement: %v", err)
+	}
+	defer db.DeleteAgreement(agid, protocol)
+
+	if err := db.AgreementAttempt(agid, testOrg, device, testDeviceType, polName, "", "", "", protocol, "", []string{"svc1"}, policy.NodeHealth{}); err == nil {
+		t.Errorf("expected error creating a duplicate agreement %v", agid)
+	}
+
+	ag := findAgreement(t, db, agid, protocol)
+	if ag.DeviceId != device || ag.PolicyName != polName || ag.Org != testOrg || ag.Pattern != "pattern1" {
+		t.Errorf("agreement %v was not stored correctly: %v", agid, ag)
+	} else if len(ag.ServiceId) != 1 || ag.ServiceId[0] != "svc1" {
+		t.Errorf("agreement %v service id was not stored correctly: %v", agid, ag.ServiceId)
+	} else if ag.NHMissingHBInterval != 60 || !ag.NodeHealthInUse() {
+		t.Errorf("agreement %v node health was not stored correctly: %v", agid, ag)
+	} else if ag.Archived || ag.AgreementInceptionTime == 0 || ag.AgreementCreationTime != 0 {
+		t.Errorf("agreement %v has the wrong initial state: %v", agid, ag)
+	}
+
+	// Changing a returned record must not change the database.
+	ag.ServiceId[0] = "changed"
+	if again := findAgreement(t, db, agid, protocol); again.ServiceId[0] != "svc1" {
+		t.Errorf("agreement %v shares memory with the caller, service id is %v", agid, again.ServiceId)
+	}
+
+	if found, err := db.FindSingleAgreementByAgreementIdAllProtocols(agid, policy.AllAgreementProtocols(), []persistence.AFilter{persistence.UnarchivedAFilter()}); err != nil {
+		t.Errorf("error finding agreement %v across all protocols: %v", agid, err)
+	} else if found == nil || found.CurrentAgreementId != agid {
+		t.Errorf("agreement %v not found across all protocols, found %v", agid, found)
+	}
+
+	if found, err := db.FindAgreements([]persistence.AFilter{persistence.DevPolAFilter(device, polName)}, protocol); err != nil {
+		t.Errorf("error finding agreements for device %v: %v", device, err)
+	} else if len(found) != 1 || found[0].CurrentAgreementId != agid {
+		t.Errorf("expected agreement %v for device %v, found %v", agid, device, found)
+	}
+
+	if found, err := db.FindSingleAgreementByAgreementId(prefix+"-unknown", protocol, []persistence.AFilter{}); err != nil {
+		t.Errorf("finding an unknown agreement should not be an error, was: %v", err)
+	} else if found != nil {
+		t.Errorf("expected no agreement, found %v", found)
+	}
+
+	if _, err := db.AgreementUpdate(agid, "proposal", "policy", policy.DataVerification{}, 0, "hash", "consumersig", protocol, 2); err != nil {
+		t.Fatalf("error updating agreement %v: %v", agid, err)
+	} else if _, err := db.AgreementMade(agid, "counterparty", "sig", protocol, []string{prefix + "-dev2"}, "", "", ""); err != nil {
+		t.Fatalf("error marking agreement %v made: %v", agid, err)
+	} else if _, err := db.AgreementFinalized(agid, protocol); err != nil {
+		t.Fatalf("error finalizing agreement %v: %v", agid, err)
+	} else if _, err := db.AgreementBlockchainUpdateAck(agid, protocol); err != nil {
+		t.Fatalf("error acking blockchain update for agreement %v: %v", agid, err)
+	} else if _, err := db.DataVerified(agid, protocol); err != nil {
+		t.Fatalf("error marking data verified for agreement %v: %v", agid, err)
+	} else if _, err := db.DataNotVerified(agid, protocol); err != nil {
+		t.Fatalf("error marking data not verified for agreement %v: %v", agid, err)
+	} else if _, err := db.DataNotification(agid, protocol); err != nil {
+		t.Fatalf("error marking data notification for agreement %v: %v", agid, err)
+	} else if _, err := db.MeteringNotification(agid, protocol, "mn1"); err != nil {
+		t.Fatalf("error recording metering notification for agreement %v: %v", agid, err)
+	} else if _, err := db.AgreementTimedout(agid, protocol); err != nil {
+		t.Fatalf("error timing out agreement %v: %v", agid, err)
+	}
+
+	ag = findAgreement(t, db, agid, protocol)
+	if ag.Proposal != "proposal" || ag.Policy != "policy" || ag.ProposalHash != "hash" || ag.ConsumerProposalSig != "consumersig" || ag.AgreementProtocolVersion != 2 {
+		t.Errorf("agreement %v proposal was not updated: %v", agid, ag)
+	} else if ag.AgreementCreationTime == 0 || ag.AgreementFinalizedTime == 0 || ag.AgreementTimedout == 0 || ag.BCUpdateAckTime == 0 {
+		t.Errorf("agreement %v lifecycle timestamps were not updated: %v", agid, ag)
+	} else if ag.CounterPartyAddress != "counterparty" || ag.ProposalSig != "sig" || len(ag.HAPartners) != 1 {
+		t.Errorf("agreement %v was not marked made: %v", agid, ag)
+	} else if ag.DataVerificationMissedCount != 1 || ag.DataVerifiedTime == 0 || ag.DataNotificationSent == 0 {
+		t.Errorf("agreement %v data verification state was not updated: %v", agid, ag)
+	} else if ag.MeteringNotificationSent == 0 || ag.MeteringNotificationMsgs[0] != "mn1" {
+		t.Errorf("agreement %v metering state was not updated: %v", agid, ag)
+	}
+
+	if err := db.DeleteAgreement(agid, protocol); err != nil {
+		t.Errorf("error deleting agreement %v: %v", agid, err)
+	} else if found, err := db.FindSingleAgreementByAgreementId(agid, protocol, []persistence.AFilter{}); err != nil {
+		t.Errorf("error finding deleted agreement %v: %v", agid, err)
+	} else if found != nil {
+		t.Errorf("agreement %v should have been deleted, found %v", agid, found)
+	}
+
+	if _, err := db.SingleAgreementUpdate(agid, protocol, func(a persistence.Agreement) *persistence.Agreement { return &a }); err == nil {
+		t.Errorf("expected error updating deleted agreement %v", agid)
+	}
+
+}
+
+// Fields that can only be set once keep their first value, regardless of what the caller tries to write.
+func testAgreementStateTransitions(t *testing.T, db persistence.AgbotDatabase, prefix string) {
+
+	agid := prefix + "-ag-transitions"
+	protocol := policy.BasicProtocol
+
+	if err := db.AgreementAttempt(agid, testOrg, prefix+"-dev1", testDeviceType, prefix+"-pol1", "", "", "", protocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("error creating agreement: %v", err)
+	}
+	defer db.DeleteAgreement(agid, protocol)
+
+	if _, err := db.AgreementMade(agid, "first", "sig1", protocol, []string{}, "", "", ""); err != nil {
+		t.Fatalf("error marking agreement %v made: %v", agid, err)
+	} else if _, err := db.AgreementMade(agid, "second", "sig2", protocol, []string{}, "", "", ""); err != nil {
+		t.Fatalf("error marking agreement %v made again: %v", agid, err)
+	}
+
+	if ag := findAgreement(t, db, agid, protocol); ag.CounterPartyAddress != "first" || ag.ProposalSig != "sig1" {
+		t.Errorf("agreement %v allowed a second transition of a write-once field: %v", agid, ag)
+	}
+
+	// The missed count only moves forward.
+	if _, err := db.DataNotVerified(agid, protocol); err != nil {
+		t.Fatalf("error marking data not verified for agreement %v: %v", agid, err)
+	} else if _, err := db.SingleAgreementUpdate(agid, protocol, func(a persistence.Agreement) *persistence.Agreement {
+		a.DataVerificationMissedCount = 0
+		return &a
+	}); err != nil {
+		t.Fatalf("error updating agreement %v: %v", agid, err)
+	}
+
+	if ag := findAgreement(t, db, agid, protocol); ag.DataVerificationMissedCount != 1 {
+		t.Errorf("agreement %v missed count should not move backward, is %v", agid, ag.DataVerificationMissedCount)
+	}
+
+	// Archiving is a one way transition.
+	if _, err := db.ArchiveAgreement(agid, protocol, 1, "first reason"); err != nil {
+		t.Fatalf("error archiving agreement %v: %v", agid, err)
+	} else if _, err := db.SingleAgreementUpdate(agid, protocol, func(a persistence.Agreement) *persistence.Agreement {
+		a.Archived = false
+		a.TerminatedReason = 2
+		a.TerminatedDescription = "second reason"
+		return &a
+	}); err != nil {
+		t.Fatalf("error updating agreement %v: %v", agid, err)
+	}
+
+	if ag := findAgreement(t, db, agid, protocol); !ag.Archived || ag.TerminatedReason != 1 || ag.TerminatedDescription != "first reason" {
+		t.Errorf("agreement %v archive state was changed: %v", agid, ag)
+	}
+
+}
+
+func testArchivedAgreements(t *testing.T, db persistence.AgbotDatabase, prefix string) {
+
+	protocol := policy.BasicProtocol
+	active := prefix + "-ag-active"
+	archived := prefix + "-ag-archived"
+
+	activeBefore, archivedBefore := agreementCounts(t, db)
+
+	for _, agid := range []string{active, archived} {
+		if err := db.AgreementAttempt(agid, testOrg, prefix+"-dev-"+agid, testDeviceType, prefix+"-pol1", "", "", "", protocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("error creating agreement %v: %v", agid, err)
+		}
+		defer db.DeleteAgreement(agid, protocol)
+	}
+
+	if ag, err := db.ArchiveAgreement(archived, protocol, 7, "test archive"); err != nil {
+		t.Fatalf("error archiving agreement %v: %v", archived, err)
+	} else if ag == nil || !ag.Archived {
+		t.Errorf("archive of agreement %v returned %v", archived, ag)
+	}
+
+	if _, err := db.ArchiveAgreement(prefix+"-unknown", protocol, 7, "test archive"); err == nil {
+		t.Errorf("expected error archiving an unknown agreement")
+	}
+
+	if ag, err := db.FindSingleAgreementByAgreementId(archived, protocol, []persistence.AFilter{persistence.UnarchivedAFilter()}); err != nil {
+		t.Errorf("error finding agreement %v: %v", archived, err)
+	} else if ag != nil {
+		t.Errorf("archived agreement %v returned by unarchived filter: %v", archived, ag)
+	}
+
+	if ag, err := db.FindSingleAgreementByAgreementId(archived, protocol, []persistence.AFilter{persistence.ArchivedAFilter()}); err != nil {
+		t.Errorf("error finding agreement %v: %v", archived, err)
+	} else if ag == nil || ag.TerminatedReason != 7 || ag.TerminatedDescription != "test archive" {
+		t.Errorf("archived agreement %v not returned correctly by archived filter: %v", archived, ag)
+	}
+
+	if ag, err := db.FindSingleAgreementByAgreementId(active, protocol, []persistence.AFilter{persistence.ArchivedAFilter()}); err != nil {
+		t.Errorf("error finding agreement %v: %v", active, err)
+	} else if ag != nil {
+		t.Errorf("active agreement %v returned by archived filter: %v", active, ag)
+	}
+
+	if activeAfter, archivedAfter := agreementCounts(t, db); activeAfter-activeBefore != 1 || archivedAfter-archivedBefore != 1 {
+		t.Errorf("expected 1 more active and 1 more archived agreement, counts went from %v/%v to %v/%v", activeBefore, archivedBefore, activeAfter, archivedAfter)
+	}
+
+	if err := db.DeleteAgreement(archived, protocol); err != nil {
+		t.Errorf("error deleting archived agreement %v: %v", archived, err)
+	} else if _, archivedAfter := agreementCounts(t, db); archivedAfter != archivedBefore {
+		t.Errorf("expected archived count %v after deleting, was %v", archivedBefore, archivedAfter)
+	}
+
+}
+
+// Agreements created at the same time by different workers are all persisted.
+func testConcurrentAgreements(t *testing.T, db persistence.AgbotDatabase, prefix string) {
+
+	protocol := policy.BasicProtocol
+	num := 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, num)
+	for i := 0; i < num; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			agid := fmt.Sprintf("%v-ag-concurrent-%v", prefix, i)
+			if err := db.AgreementAttempt(agid, testOrg, fmt.Sprintf("%v-dev-%v", prefix, i), testDeviceType, prefix+"-pol1", "", "", "", protocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+				errs <- err
+			} else if _, err := db.AgreementFinalized(agid, protocol); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("error creating agreement concurrently: %v", err)
+	}
+
+	for i := 0; i < num; i++ {
+		agid := fmt.Sprintf("%v-ag-concurrent-%v", prefix, i)
+		if ag := findAgreement(t, db, agid, protocol); ag.AgreementFinalizedTime == 0 {
+			t.Errorf("agreement %v was not finalized: %v", agid, ag)
+		}
+		if err := db.DeleteAgreement(agid, protocol); err != nil {
+			t.Errorf("error deleting agreement %v: %v", agid, err)
+		}
+	}
+
+}
+
+func testWorkloadUsageLifecycle(t *testing.T, db persistence.AgbotDatabase, prefix string) {
+
+	protocol := policy.BasicProtocol
+	agid := prefix + "-ag-wu"
+	device := prefix + "-wu-dev1"
+	polName := prefix + "-wu-pol1"
+
+	if err := db.AgreementAttempt(agid, testOrg, device, testDeviceType, polName, "", "", "", protocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("error creating agreement: %v", err)
+	}
+	defer db.DeleteAgreement(agid, protocol)
+
+	before := workloadUsageCount(t, db)
+
+	if err := db.NewWorkloadUsage(device, []string{}, "", polName, 0, 300, 60, false, agid); err == nil {
+		t.Errorf("expected error creating a workload usage without a priority")
+	}
+
+	if err := db.NewWorkloadUsage(device, []string{prefix + "-wu-dev2"}, "policy body", polName, 1, 300, 60, false, agid); err != nil {
+		t.Fatalf("error creating workload usage: %v", err)
+	}
+	defer db.DeleteWorkloadUsage(device, polName)
+
+	if err := db.NewWorkloadUsage(device, []string{}, "policy body", polName, 1, 300, 60, false, agid); err == nil {
+		t.Errorf("expected error creating a duplicate workload usage")
+	}
+
+	wu := findWorkloadUsage(t, db, device, polName)
+	if wu.Priority != 1 || wu.RetryDurationS != 300 || wu.VerifiedDurationS != 60 || wu.CurrentAgreementId != agid || wu.Policy != "policy body" {
+		t.Errorf("workload usage was not stored correctly: %v", wu)
+	} else if len(wu.HAPartners) != 1 || wu.FirstTryTime == 0 || wu.DisableRetry || wu.PendingUpgradeTime != 0 {
+		t.Errorf("workload usage has the wrong initial state: %v", wu)
+	}
+
+	if after := workloadUsageCount(t, db); after-before != 1 {
+		t.Errorf("expected 1 more workload usage, count went from %v to %v", before, after)
+	}
+
+	if wus, err := db.FindWorkloadUsages([]persistence.WUFilter{persistence.DWUFilter(device)}); err != nil {
+		t.Errorf("error finding workload usages for device %v: %v", device, err)
+	} else if len(wus) != 1 {
+		t.Errorf("expected 1 workload usage for device %v, found %v", device, wus)
+	}
+
+	if wus, err := db.FindWorkloadUsages([]persistence.WUFilter{persistence.PWUFilter(polName)}); err != nil {
+		t.Errorf("error finding workload usages for policy %v: %v", polName, err)
+	} else if len(wus) != 1 {
+		t.Errorf("expected 1 workload usage for policy %v, found %v", polName, wus)
+	}
+
+	if _, err := db.UpdatePriority(device, polName, 2, 600, 120, agid); err != nil {
+		t.Fatalf("error updating priority: %v", err)
+	} else if wu := findWorkloadUsage(t, db, device, polName); wu.Priority != 2 || wu.RetryDurationS != 600 || wu.VerifiedDurationS != 120 || wu.RetryCount != 0 {
+		t.Errorf("workload usage priority was not updated: %v", wu)
+	}
+
+	if _, err := db.UpdateRetryCount(device, polName, 3, agid); err != nil {
+		t.Fatalf("error updating retry count: %v", err)
+	} else if wu := findWorkloadUsage(t, db, device, polName); wu.RetryCount != 3 || wu.LatestRetryTime == 0 {
+		t.Errorf("workload usage retry count was not updated: %v", wu)
+	}
+
+	if _, err := db.UpdatePendingUpgrade(device, polName); err != nil {
+		t.Fatalf("error updating pending upgrade: %v", err)
+	} else if wu := findWorkloadUsage(t, db, device, polName); wu.PendingUpgradeTime == 0 {
+		t.Errorf("workload usage pending upgrade was not updated: %v", wu)
+	}
+
+	// The policy can only be set once.
+	if _, err := db.UpdatePolicy(device, polName, "new policy body"); err != nil {
+		t.Fatalf("error updating policy: %v", err)
+	} else if wu := findWorkloadUsage(t, db, device, polName); wu.Policy != "policy body" {
+		t.Errorf("workload usage policy should not change once set: %v", wu)
+	}
+
+	if _, err := db.UpdateWUAgreementId(device, polName, agid, protocol); err != nil {
+		t.Fatalf("error updating agreement id: %v", err)
+	} else if wu := findWorkloadUsage(t, db, device, polName); wu.CurrentAgreementId != agid {
+		t.Errorf("workload usage agreement id was not kept: %v", wu)
+	}
+
+	if _, err := db.DisableRollbackChecking(device, polName); err != nil {
+		t.Fatalf("error disabling rollback checking: %v", err)
+	} else if wu := findWorkloadUsage(t, db, device, polName); !wu.DisableRetry || wu.RetryCount != 0 {
+		t.Errorf("workload usage rollback checking was not disabled: %v", wu)
+	}
+
+	if err := db.DeleteWorkloadUsage(device, polName); err != nil {
+		t.Errorf("error deleting workload usage: %v", err)
+	} else if wu, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(device, polName); err != nil {
+		t.Errorf("error finding deleted workload usage: %v", err)
+	} else if wu != nil {
+		t.Errorf("workload usage should have been deleted, found %v", wu)
+	}
+
+	if err := db.DeleteWorkloadUsage(device, polName); err != nil {
+		t.Errorf("deleting an already deleted workload usage should not be an error, was: %v", err)
+	}
+
+	if _, err := db.UpdatePriority(device, polName, 3, 600, 120, agid); err == nil {
+		t.Errorf("expected error updating a deleted workload usage")
+	}
+
+	if after := workloadUsageCount(t, db); after != before {
+		t.Errorf("expected workload usage count %v after deleting, was %v", before, after)
+	}
+
+}
+
+// The partition functions used by the agbot runtime all work on an initialized database.
+func testPartitions(t *testing.T, db persistence.AgbotDatabase) {
+
+	if partitions, err := db.FindPartitions(); err != nil {
+		t.Errorf("error finding partitions: %v", err)
+	} else if len(partitions) == 0 {
+		t.Errorf("an initialized database should have at least 1 partition")
+	}
+
+	if err := db.HeartbeatPartition(); err != nil {
+		t.Errorf("error heartbeating partition: %v", err)
+	}
+
+	if _, err := db.GetHeartbeat(); err != nil {
+		t.Errorf("error getting heartbeat: %v", err)
+	}
+
+	// Nothing should be stale within a day of being heartbeated.
+	if _, err := db.MovePartition(24 * 60 * 60); err != nil {
+		t.Errorf("error moving partitions: %v", err)
+	}
+
+}
+
+func testSearchSessions(t *testing.T, db persistence.AgbotDatabase, prefix string) {
+
+	polName := prefix + "-ss-pol1"
+
+	token1, changedSince, err := db.ObtainSearchSession(polName)
+	if err != nil {
+		t.Fatalf("error obtaining search session: %v", err)
+	} else if _, err := strconv.ParseUint(token1, 10, 64); err != nil {
+		t.Errorf("search session token %v should be a number: %v", token1, err)
+	}
+
+	if _, err := db.UpdateSearchSessionChangedSince(changedSince, uint64(time.Now().Unix()), polName); err != nil {
+		t.Errorf("error ending search session: %v", err)
+	}
+
+	// The session was ended, so the next search gets a new session.
+	if token2, _, err := db.ObtainSearchSession(polName); err != nil {
+		t.Errorf("error obtaining search session: %v", err)
+	} else if token2 == token1 {
+		t.Errorf("expected a new search session token after ending session %v", token1)
+	}
+
+	if err := db.ResetPolicyChangedSince(polName, uint64(time.Now().Unix())); err != nil {
+		t.Errorf("error resetting policy changed since: %v", err)
+	}
+
+	if err := db.DumpSearchSessions(); err != nil {
+		t.Errorf("error dumping search sessions: %v", err)
+	}
+
+}
+
+// Utility functions used by the tests.
+
+func findAgreement(t *testing.T, db persistence.AgbotDatabase, agid string, protocol string) *persistence.Agreement {
+	if ag, err := db.FindSingleAgreementByAgreementId(agid, protocol, []persistence.AFilter{}); err != nil {
+		t.Fatalf("error finding agreement %v: %v", agid, err)
+	} else if ag == nil {
+		t.Fatalf("agreement %v not found", agid)
+	} else {
+		return ag
+	}
+	return nil
+}
+
+func findWorkloadUsage(t *testing.T, db persistence.AgbotDatabase, device string, polName string) *persistence.WorkloadUsage {
+	if wu, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(device, polName); err != nil {
+		t.Fatalf("error finding workload usage for %v and %v: %v", device, polName, err)
+	} else if wu == nil {
+		t.Fatalf("workload usage for %v and %v not found", device, polName)
+	} else {
+		return wu
+	}
+	return nil
+}
+
+// Return the number of active and archived agreements across all partitions.
+func agreementCounts(t *testing.T, db persistence.AgbotDatabase) (int64, int64) {
+	var activeNum, archivedNum int64
+	partitions, err := db.FindPartitions()
+	if err != nil {
+		t.Fatalf("error finding partitions: %v", err)
+	}
+	for _, partition := range partitions {
+		if active, archived, err := db.GetAgreementCount(partition); err != nil {
+			t.Fatalf("error counting agreements in partition %v: %v", partition, err)
+		} else {
+			activeNum += active
+			archivedNum += archived
+		}
+	}
+	return activeNum, archivedNum
+}
+
+// Return the number of workload usages across all partitions.
+func workloadUsageCount(t *testing.T, db persistence.AgbotDatabase) int64 {
+	var num int64
+	partitions, err := db.FindPartitions()
+	if err != nil {
+		t.Fatalf("error finding partitions: %v", err)
+	}
+	for _, partition := range partitions {
+		if count, err := db.GetWorkloadUsagesCount(partition); err != nil {
+			t.Fatalf("error counting workload usages in partition %v: %v", partition, err)
+		} else {
+			num += count
+		}
+	}
+	return num
+}
@@ -0,0 +1,295 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"sort"
+	"sync"
+)
+
+func init() {
+	persistence.Register("memory", new(AgbotMemoryDB))
+}
+
+// Functions that implement the database replacement abstraction for an agbot whose database lives only in memory. This
+// implementation is intended for tests and for ephemeral agbots, nothing it holds survives an agbot restart. Records are
+// serialized when they are stored and deserialized when they are returned, so that callers never share memory with the
+// database, which is the same behavior callers get from the bolt and postgresql implementations.
+
+// This is the object that represents the handle to the in-memory database. All access to the maps is serialized
+// by the lock.
+type AgbotMemoryDB struct {
+	lock             sync.Mutex
+	identity         string                    // The identity of this agbot in the partitions map.
+	primaryPartition string                    // The partition to use when creating new records.
+	nextPartitionId  uint64                    // The id of the next partition to be created.
+	nextWUId         uint64                    // The sequence number used for workload usage primary keys.
+	partitions       map[string]*partition     // All partitions, keyed by partition id.
+	searchSessions   map[string]*searchSession // Search sessions, keyed by policy name.
+}
+
+// The records held in a partition. Agreements are keyed by protocol and then by agreement id. Workload usages are
+// keyed by device id and policy name.
+type partition struct {
+	owner          string
+	heartbeat      uint64
+	agreements     map[string]map[string][]byte
+	workloadUsages map[wuKey][]byte
+}
+
+func newPartition(owner string, heartbeat uint64) *partition {
+	return &partition{
+		owner:          owner,
+		heartbeat:      heartbeat,
+		agreements:     make(map[string]map[string][]byte),
+		workloadUsages: make(map[wuKey][]byte),
+	}
+}
+
+func (db *AgbotMemoryDB) String() string {
+	return fmt.Sprintf("Instance: %v, PrimaryPartition: %v, Partitions: %v", db.identity, db.primaryPartition, len(db.partitions))
+}
+
+func (db *AgbotMemoryDB) GetAgreementCount(partition string) (int64, int64, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var activeNum, archivedNum int64
+
+	p, ok := db.partitions[partition]
+	if !ok {
+		return 0, 0, nil
+	}
+
+	for _, protocolAgs := range p.agreements {
+		for _, serial := range protocolAgs {
+			var a persistence.Agreement
+			if err := json.Unmarshal(serial, &a); err != nil {
+				return 0, 0, fmt.Errorf("Unable to deserialize agreement record: %v, error: %v", string(serial), err)
+			} else if a.Archived {
+				archivedNum += 1
+			} else {
+				activeNum += 1
+			}
+		}
+	}
+	return activeNum, archivedNum, nil
+}
+
+// Retrieve all agreements in the partitions owned by this agbot and filter them out based on the input filters. The
+// returned agreements are sorted by agreement id.
+func (db *AgbotMemoryDB) FindAgreements(filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	agreements := make([]persistence.Agreement, 0)
+
+	for _, p := range db.ownedPartitions() {
+		for _, serial := range p.agreements[protocol] {
+			var a persistence.Agreement
+			if err := json.Unmarshal(serial, &a); err != nil {
+				glog.Errorf("Unable to deserialize db record: %v", string(serial))
+			} else if persistence.RunFilters(&a, filters) != nil {
+				agreements = append(agreements, a)
+			}
+		}
+	}
+
+	sort.Slice(agreements, func(i, j int) bool { return agreements[i].CurrentAgreementId < agreements[j].CurrentAgreementId })
+	return agreements, nil
+}
+
+func (db *AgbotMemoryDB) AgreementAttempt(agreementid string, org string, deviceid string, deviceType string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, serviceId []string, nhPolicy policy.NodeHealth) error {
+	if agreement, err := persistence.NewAgreement(agreementid, org, deviceid, deviceType, policyName, bcType, bcName, bcOrg, agreementProto, pattern, serviceId, nhPolicy); err != nil {
+		return err
+	} else {
+		return db.insertAgreement(agreement, agreementProto)
+	}
+}
+
+func (db *AgbotMemoryDB) AgreementUpdate(agreementid string, proposal string, policy string, dvPolicy policy.DataVerification, defaultCheckRate uint64, hash string, sig string, protocol string, agreementProtoVersion int) (*persistence.Agreement, error) {
+	return persistence.AgreementUpdate(db, agreementid, proposal, policy, dvPolicy, defaultCheckRate, hash, sig, protocol, agreementProtoVersion)
+}
+
+func (db *AgbotMemoryDB) AgreementMade(agreementId string, counterParty string, signature string, protocol string, hapartners []string, bcType string, bcName string, bcOrg string) (*persistence.Agreement, error) {
+	return persistence.AgreementMade(db, agreementId, counterParty, signature, protocol, hapartners, bcType, bcName, bcOrg)
+}
+
+func (db *AgbotMemoryDB) AgreementBlockchainUpdate(agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdate(db, agreementId, consumerSig, hash, counterParty, signature, protocol)
+}
+
+func (db *AgbotMemoryDB) AgreementBlockchainUpdateAck(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdateAck(db, agreementId, protocol)
+}
+
+func (db *AgbotMemoryDB) AgreementFinalized(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementFinalized(db, agreementId, protocol)
+}
+
+func (db *AgbotMemoryDB) AgreementTimedout(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementTimedout(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) DataVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) DataNotVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) DataNotification(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotification(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) MeteringNotification(agreementid string, protocol string, mn string) (*persistence.Agreement, error) {
+	return persistence.MeteringNotification(db, agreementid, protocol, mn)
+}
+
+func (db *AgbotMemoryDB) ArchiveAgreement(agreementid string, protocol string, reason uint, desc string) (*persistence.Agreement, error) {
+	return persistence.ArchiveAgreement(db, agreementid, protocol, reason, desc)
+}
+
+// no error on not found, only nil
+func (db *AgbotMemoryDB) FindSingleAgreementByAgreementId(agreementid string, protocol string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	filters = append(filters, persistence.IdAFilter(agreementid))
+
+	if agreements, err := db.FindAgreements(filters, protocol); err != nil {
+		return nil, err
+	} else if len(agreements) > 1 {
+		return nil, fmt.Errorf("Expected only one record for agreementid: %v, but retrieved: %v", agreementid, agreements)
+	} else if len(agreements) == 0 {
+		return nil, nil
+	} else {
+		return &agreements[0], nil
+	}
+}
+
+// no error on not found, only nil
+func (db *AgbotMemoryDB) FindSingleAgreementByAgreementIdAllProtocols(agreementid string, protocols []string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	for _, protocol := range protocols {
+		if agreement, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, filters); err != nil {
+			return nil, err
+		} else if agreement != nil {
+			return agreement, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *AgbotMemoryDB) SingleAgreementUpdate(agreementid string, protocol string, fn func(persistence.Agreement) *persistence.Agreement) (*persistence.Agreement, error) {
+	if agreement, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, []persistence.AFilter{}); err != nil {
+		return nil, err
+	} else if agreement == nil {
+		return nil, fmt.Errorf("Unable to locate agreement id: %v", agreementid)
+	} else {
+		updated := fn(*agreement)
+		return updated, db.persistUpdatedAgreement(agreementid, protocol, updated)
+	}
+}
+
+// does whole-member replacements of values that are legal to change during the course of an agreement's life
+func (db *AgbotMemoryDB) persistUpdatedAgreement(agreementid string, protocol string, update *persistence.Agreement) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	p, current := db.findAgreementRecord(agreementid, protocol)
+	if current == nil {
+		return fmt.Errorf("No agreement with given id available to update: %v", agreementid)
+	}
+
+	var mod persistence.Agreement
+	if err := json.Unmarshal(current, &mod); err != nil {
+		return fmt.Errorf("Failed to unmarshal agreement DB data: %v", string(current))
+	}
+
+	// The lock is held, so the current record (mod) is read and then updated according to the updates within
+	// the input update record without interference from other callers. It is critical to check for correct data
+	// transitions while the lock is held.
+	persistence.ValidateStateTransition(&mod, update)
+
+	if serialized, err := json.Marshal(mod); err != nil {
+		return fmt.Errorf("Failed to serialize agreement record: %v", mod)
+	} else {
+		p.agreements[protocol][agreementid] = serialized
+		glog.V(2).Infof("Succeeded updating agreement record to %v", mod)
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) DeleteAgreement(pk string, protocol string) error {
+	if pk == "" {
+		return fmt.Errorf("Missing required arg pk")
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	p, existing := db.findAgreementRecord(pk, protocol)
+	if existing == nil {
+		glog.Errorf("Warning: record deletion requested, but record does not exist: %v", pk)
+		return nil // handle already-deleted agreement as success
+	}
+
+	var record persistence.Agreement
+	if err := json.Unmarshal(existing, &record); err != nil {
+		glog.Errorf("Error deserializing agreement: %v. This is a pre-deletion warning message function so deletion will still proceed", record)
+	} else if record.CurrentAgreementId != "" && !record.Archived {
+		glog.Warningf("Warning! Deleting an agreement record with an agreement id, this operation should only be done after cancelling on the blockchain.")
+	}
+
+	delete(p.agreements[protocol], pk)
+	return nil
+}
+
+func (db *AgbotMemoryDB) Close() {
+	glog.V(2).Infof("Closing in-memory database")
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.partitions = make(map[string]*partition)
+	db.searchSessions = make(map[string]*searchSession)
+	glog.V(2).Infof("Closed in-memory database")
+}
+
+// Utility functions specific to the in-memory database implementation.
+
+// New agreements are always written to the primary partition.
+func (db *AgbotMemoryDB) insertAgreement(ag *persistence.Agreement, protocol string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, existing := db.findAgreementRecord(ag.CurrentAgreementId, protocol); existing != nil {
+		return fmt.Errorf("Agreement %v with protocol %v already exists", ag.CurrentAgreementId, protocol)
+	}
+
+	p, ok := db.partitions[db.primaryPartition]
+	if !ok {
+		return fmt.Errorf("Primary partition %v does not exist, the database is not initialized", db.primaryPartition)
+	}
+
+	if serialized, err := json.Marshal(ag); err != nil {
+		return fmt.Errorf("Unable to serialize record %v. Error: %v", ag, err)
+	} else {
+		if p.agreements[protocol] == nil {
+			p.agreements[protocol] = make(map[string][]byte)
+		}
+		p.agreements[protocol][ag.CurrentAgreementId] = serialized
+		glog.V(2).Infof("Succeeded writing agreement record %v", *ag)
+	}
+	return nil
+}
+
+// Locate the partition and serialized record for an agreement, searching only the partitions owned by this agbot.
+// The caller must hold the lock.
+func (db *AgbotMemoryDB) findAgreementRecord(agreementid string, protocol string) (*partition, []byte) {
+	for _, p := range db.ownedPartitions() {
+		if serial, ok := p.agreements[protocol][agreementid]; ok {
+			return p, serial
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/satori/go.uuid"
+)
+
+// Setup everything the in-memory DB needs to be able to run an agbot. All state from any previous use of this
+// handle is discarded, so calling this function is equivalent to starting with an empty database.
+func (db *AgbotMemoryDB) Initialize(cfg *config.HorizonConfig) error {
+
+	db.lock.Lock()
+
+	db.partitions = make(map[string]*partition)
+	db.searchSessions = make(map[string]*searchSession)
+	db.nextPartitionId = 1
+	db.nextWUId = 1
+
+	// Every agbot instance gets a new identity when it starts, just like the postgresql implementation.
+	if id, err := uuid.NewV4(); err != nil {
+		db.lock.Unlock()
+		return errors.New(fmt.Sprintf("unable to get UUID identity for this agbot, error: %v", err))
+	} else {
+		db.identity = id.String()
+	}
+	db.lock.Unlock()
+
+	glog.V(1).Infof("Agreementbot %v initializing in-memory database partitions", db.identity)
+
+	// Claim a partition for ourselves.
+	if partition, err := db.ClaimPartition(cfg.GetPartitionStale()); err != nil {
+		return errors.New(fmt.Sprintf("unable to claim a partition, error: %v", err))
+	} else {
+		db.lock.Lock()
+		db.primaryPartition = partition
+		db.lock.Unlock()
+	}
+
+	glog.V(3).Infof("In-memory database initialized.")
+	return nil
+
+}
@@ -0,0 +1,210 @@
+// +build unit
+
+package memory
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/agreementbot/persistence/conformance"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+	"time"
+)
+
+func Test_Conformance(t *testing.T) {
+	db := initTestDB(t)
+	defer db.Close()
+
+	conformance.RunConformanceTests(t, db)
+}
+
+func Test_InitDatabase_selects_memory(t *testing.T) {
+	cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true, DBPath: "/should/not/be/used"}}
+
+	if db, err := persistence.InitDatabase(cfg); err != nil {
+		t.Fatalf("unable to initialize database, error: %v", err)
+	} else if _, ok := db.(*AgbotMemoryDB); !ok {
+		t.Errorf("expected the in-memory database, got %T", db)
+	} else {
+		db.Close()
+	}
+}
+
+// Records in an unowned or stale partition are moved into the primary partition, records in a partition that is
+// still being heartbeated are not.
+func Test_MovePartition(t *testing.T) {
+	db := initTestDB(t)
+	defer db.Close()
+
+	now := uint64(time.Now().Unix())
+	db.partitions["90"] = newPartition("", 0)
+	db.partitions["91"] = newPartition("other-agbot", now-600)
+	db.partitions["92"] = newPartition("other-agbot", now)
+
+	// Put an agreement and a workload usage into each partition by creating them in the primary and moving them.
+	primary := db.primaryPartition
+	for _, id := range []string{"90", "91", "92"} {
+		agid := "ag" + id
+		if err := db.AgreementAttempt(agid, "myorg", "myorg/dev"+id, "device", "myorg/pol", "", "", "", policy.BasicProtocol, "", []string{}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("error creating agreement: %v", err)
+		} else if err := db.NewWorkloadUsage("myorg/dev"+id, []string{}, "", "myorg/pol", 1, 300, 60, false, agid); err != nil {
+			t.Fatalf("error creating workload usage: %v", err)
+		}
+		p := db.partitions[primary]
+		db.partitions[id].agreements[policy.BasicProtocol] = map[string][]byte{agid: p.agreements[policy.BasicProtocol][agid]}
+		delete(p.agreements[policy.BasicProtocol], agid)
+		key := wuKey{deviceId: "myorg/dev" + id, policyName: "myorg/pol"}
+		db.partitions[id].workloadUsages[key] = p.workloadUsages[key]
+		delete(p.workloadUsages, key)
+	}
+
+	if ags, err := db.FindAgreements([]persistence.AFilter{}, policy.BasicProtocol); err != nil {
+		t.Fatalf("error finding agreements: %v", err)
+	} else if len(ags) != 0 {
+		t.Errorf("agreements in partitions owned by someone else should not be visible, found %v", ags)
+	}
+
+	if owner, err := db.GetPartitionOwner("90"); err != nil {
+		t.Errorf("error getting partition owner: %v", err)
+	} else if owner != "NO OWNER" {
+		t.Errorf("expected partition 90 to have no owner, has %v", owner)
+	}
+
+	for i := 0; i < 2; i++ {
+		if moved, err := db.MovePartition(60); err != nil {
+			t.Fatalf("error moving partition: %v", err)
+		} else if !moved {
+			t.Errorf("expected a partition to be moved on iteration %v", i)
+		}
+	}
+
+	if moved, err := db.MovePartition(60); err != nil {
+		t.Fatalf("error moving partition: %v", err)
+	} else if moved {
+		t.Errorf("partition 92 is being heartbeated and should not be moved")
+	}
+
+	if partitions, err := db.FindPartitions(); err != nil {
+		t.Fatalf("error finding partitions: %v", err)
+	} else if len(partitions) != 2 || partitions[0] != primary || partitions[1] != "92" {
+		t.Errorf("expected partitions %v and 92, found %v", primary, partitions)
+	}
+
+	if ags, err := db.FindAgreements([]persistence.AFilter{}, policy.BasicProtocol); err != nil {
+		t.Fatalf("error finding agreements: %v", err)
+	} else if len(ags) != 2 || ags[0].CurrentAgreementId != "ag90" || ags[1].CurrentAgreementId != "ag91" {
+		t.Errorf("expected moved agreements ag90 and ag91, found %v", ags)
+	}
+
+	if num, err := db.GetWorkloadUsagesCount(primary); err != nil {
+		t.Fatalf("error counting workload usages: %v", err)
+	} else if num != 2 {
+		t.Errorf("expected 2 workload usages in the primary partition, found %v", num)
+	}
+}
+
+func Test_QuiescePartition(t *testing.T) {
+	db := initTestDB(t)
+	defer db.Close()
+
+	if err := db.QuiescePartition(); err != nil {
+		t.Fatalf("error quiescing partition: %v", err)
+	} else if owner, err := db.GetPartitionOwner(db.primaryPartition); err != nil {
+		t.Errorf("error getting partition owner: %v", err)
+	} else if owner != "NO OWNER" {
+		t.Errorf("expected quiesced partition to have no owner, has %v", owner)
+	} else if err := db.HeartbeatPartition(); err == nil {
+		t.Errorf("expected heartbeat of a quiesced partition to fail")
+	}
+
+	// A new owner claims the quiesced partition instead of creating a new one.
+	db.identity = "new-agbot"
+	if id, err := db.ClaimPartition(60); err != nil {
+		t.Fatalf("error claiming partition: %v", err)
+	} else if id != db.primaryPartition {
+		t.Errorf("expected to claim partition %v, claimed %v", db.primaryPartition, id)
+	} else if owner, _ := db.GetPartitionOwner(id); owner != "new-agbot" {
+		t.Errorf("expected partition %v to be owned by new-agbot, owned by %v", id, owner)
+	}
+}
+
+// Search sessions are kept per policy. A session stays in use until it is ended, and changedSince resets only
+// take effect when the next session starts.
+func Test_SearchSessions(t *testing.T) {
+	db := initTestDB(t)
+	defer db.Close()
+
+	token, cs, _ := db.ObtainSearchSession("myorg/pol1")
+	if token != "1" || cs != 0 {
+		t.Errorf("expected the first session for a policy to be 1 with changedSince 0, was %v %v", token, cs)
+	}
+
+	if token, _, _ := db.ObtainSearchSession("myorg/pol1"); token != "1" {
+		t.Errorf("expected the session to stay the same until it is ended, was %v", token)
+	}
+
+	if token, _, _ := db.ObtainSearchSession("myorg/pol2"); token != "1" {
+		t.Errorf("expected each policy to have its own session, was %v", token)
+	}
+
+	if ended, err := db.UpdateSearchSessionChangedSince(0, 100, "myorg/pol1"); err != nil {
+		t.Fatalf("error ending session: %v", err)
+	} else if ended {
+		t.Errorf("session should not have been ended already")
+	}
+
+	if ended, err := db.UpdateSearchSessionChangedSince(0, 200, "myorg/pol1"); err != nil {
+		t.Fatalf("error ending session: %v", err)
+	} else if !ended {
+		t.Errorf("session should have been ended already")
+	}
+
+	if _, err := db.UpdateSearchSessionChangedSince(0, 200, "myorg/unknown"); err == nil {
+		t.Errorf("expected error ending a session that does not exist")
+	}
+
+	// The policy 1 session is ended, so the reset applies immediately. The policy 2 session is in progress so the reset
+	// is deferred until the next session starts.
+	if err := db.ResetAllChangedSince(50); err != nil {
+		t.Fatalf("error resetting changed since: %v", err)
+	}
+
+	if token, cs, _ := db.ObtainSearchSession("myorg/pol1"); token != "2" || cs != 50 {
+		t.Errorf("expected session 2 with changedSince 50, was %v %v", token, cs)
+	}
+
+	if token, cs, _ := db.ObtainSearchSession("myorg/pol2"); token != "1" || cs != 0 {
+		t.Errorf("expected session 1 with changedSince 0, was %v %v", token, cs)
+	}
+
+	if _, err := db.UpdateSearchSessionChangedSince(0, 300, "myorg/pol2"); err != nil {
+		t.Fatalf("error ending session: %v", err)
+	}
+
+	if token, cs, _ := db.ObtainSearchSession("myorg/pol2"); token != "2" || cs != 50 {
+		t.Errorf("expected session 2 with the deferred changedSince 50, was %v %v", token, cs)
+	}
+
+	// Policy resets keep the earliest value.
+	db.ResetPolicyChangedSince("myorg/pol2", 40)
+	db.ResetPolicyChangedSince("myorg/pol2", 45)
+	db.UpdateSearchSessionChangedSince(50, 400, "myorg/pol2")
+	if token, cs, _ := db.ObtainSearchSession("myorg/pol2"); token != "3" || cs != 40 {
+		t.Errorf("expected session 3 with changedSince 40, was %v %v", token, cs)
+	}
+
+	// Session tokens roll over.
+	db.searchSessions["myorg/pol1"].sessionToken = 2000000000
+	db.searchSessions["myorg/pol1"].sessionEnded = true
+	if token, _, _ := db.ObtainSearchSession("myorg/pol1"); token != "1" {
+		t.Errorf("expected session token to roll over to 1, was %v", token)
+	}
+}
+
+func initTestDB(t *testing.T) *AgbotMemoryDB {
+	db := new(AgbotMemoryDB)
+	if err := db.Initialize(&config.HorizonConfig{}); err != nil {
+		t.Fatalf("unable to initialize in-memory database, error: %v", err)
+	}
+	return db
+}
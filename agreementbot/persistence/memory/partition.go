@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Functions related to partitions in the in-memory database. The partition model is the same one used by the postgresql
+// implementation. Each agbot owns a single primary partition and periodically heartbeats it. A partition whose owner has
+// quiesced, or whose heartbeat is older than the stale timeout, can be claimed by another owner, which moves the records in
+// that partition into its own primary partition. Since the database is private to the process, the only owner is this agbot,
+// but the lifecycle of partitions is fully supported so that code which exercises partitions behaves the same way.
+
+// Look for an ownerless or stale partition. If none exist, create a new partition.
+func (db *AgbotMemoryDB) ClaimPartition(timeout uint64) (string, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if id := db.findUnownedPartition(timeout, ""); id != "" {
+		p := db.partitions[id]
+		p.owner = db.identity
+		p.heartbeat = uint64(time.Now().Unix())
+		glog.Infof("AgreementBot %v claimed partition %v", db.identity, id)
+		return id, nil
+	}
+
+	id := strconv.FormatUint(db.nextPartitionId, 10)
+	db.nextPartitionId += 1
+	db.partitions[id] = newPartition(db.identity, uint64(time.Now().Unix()))
+	glog.V(5).Infof("AgreementBot %v creating new partition %v", db.identity, id)
+	return id, nil
+}
+
+// Locate all the partitions currently found in the database.
+func (db *AgbotMemoryDB) FindPartitions() ([]string, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	ids := make([]string, 0, len(db.partitions))
+	for id, _ := range db.partitions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Retrieve the partition owner for a given partition.
+func (db *AgbotMemoryDB) GetPartitionOwner(id string) (string, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if p, ok := db.partitions[id]; !ok {
+		return "", errors.New(fmt.Sprintf("partition %v does not exist", id))
+	} else if p.owner == "" {
+		return "NO OWNER", nil
+	} else {
+		return p.owner, nil
+	}
+}
+
+// Update the hearbeat for our partition.
+func (db *AgbotMemoryDB) HeartbeatPartition() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if p, ok := db.partitions[db.primaryPartition]; !ok || p.owner != db.identity {
+		return errors.New(fmt.Sprintf("AgreementBot %v heartbeat to partition %v failed, the partition is no longer owned by this agbot", db.identity, db.primaryPartition))
+	} else {
+		p.heartbeat = uint64(time.Now().Unix())
+		glog.V(3).Infof("AgreementBot %v heartbeat", db.identity)
+	}
+	return nil
+}
+
+// Retrieve the heartbeat timestamp for our partition.
+func (db *AgbotMemoryDB) GetHeartbeat() (uint64, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if p, ok := db.partitions[db.primaryPartition]; !ok {
+		return 0, errors.New(fmt.Sprintf("partition %v does not exist", db.primaryPartition))
+	} else {
+		return p.heartbeat, nil
+	}
+}
+
+// Quiesce our partitions.
+func (db *AgbotMemoryDB) QuiescePartition() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, p := range db.partitions {
+		if p.owner == db.identity {
+			p.owner = ""
+			p.heartbeat = 0
+		}
+	}
+	glog.V(3).Infof("AgreementBot %v quiesced partition", db.identity)
+	return nil
+}
+
+// Move all records from one partition to our primary partition if there is a stale or unowned partition in the database.
+func (db *AgbotMemoryDB) MovePartition(timeout uint64) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	fromPartition := db.findUnownedPartition(timeout, db.primaryPartition)
+	if fromPartition == "" {
+		glog.V(3).Infof("AgreementBot %v did not find an unowned database partition.", db.identity)
+		return false, nil
+	}
+
+	to, ok := db.partitions[db.primaryPartition]
+	if !ok {
+		return false, errors.New(fmt.Sprintf("primary partition %v does not exist", db.primaryPartition))
+	}
+	from := db.partitions[fromPartition]
+
+	for protocol, ags := range from.agreements {
+		if to.agreements[protocol] == nil {
+			to.agreements[protocol] = make(map[string][]byte)
+		}
+		for id, serial := range ags {
+			to.agreements[protocol][id] = serial
+		}
+	}
+	for key, serial := range from.workloadUsages {
+		to.workloadUsages[key] = serial
+	}
+	delete(db.partitions, fromPartition)
+
+	glog.V(3).Infof("AgreementBot %v moved agreements from partition %v to %v", db.identity, fromPartition, db.primaryPartition)
+	return true, nil
+}
+
+// Find a partition that has no owner, or whose owner has not heartbeated within the timeout. The excluded partition
+// is never returned. The caller must hold the lock.
+func (db *AgbotMemoryDB) findUnownedPartition(timeout uint64, exclude string) string {
+	now := uint64(time.Now().Unix())
+
+	ids := make([]string, 0, len(db.partitions))
+	for id, _ := range db.partitions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		p := db.partitions[id]
+		if id == exclude {
+			continue
+		} else if p.owner == "" || (p.owner != db.identity && p.heartbeat+timeout < now) {
+			return id
+		}
+	}
+	return ""
+}
+
+// Return the partitions owned by this agbot, primary partition first. The caller must hold the lock.
+func (db *AgbotMemoryDB) ownedPartitions() []*partition {
+	res := make([]*partition, 0, 1)
+	if p, ok := db.partitions[db.primaryPartition]; ok {
+		res = append(res, p)
+	}
+	for id, p := range db.partitions {
+		if id != db.primaryPartition && p.owner == db.identity {
+			res = append(res, p)
+		}
+	}
+	return res
+}
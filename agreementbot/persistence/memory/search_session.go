@@ -0,0 +1,133 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Search sessions are kept per policy, with the same semantics as the postgresql implementation. A session token is
+// handed out to each search of a given policy until the search has exhausted all the nodes, at which point the
+// session is ended and the next search gets a new session token.
+type searchSession struct {
+	changedSince        uint64
+	sessionToken        uint64
+	sessionEnded        bool
+	restartChangedSince uint64
+	updatingAgbot       string
+	updated             uint64
+}
+
+func (r searchSession) String() string {
+	return fmt.Sprintf("ChangedSince: %v, SessionToken: %v, SessionEnded: %v, RestartCS: %v, Agbot: %v, Updated: %v", r.changedSince, r.sessionToken, r.sessionEnded, r.restartChangedSince, r.updatingAgbot, r.updated)
+}
+
+// Get a session token and changedSince values so that the caller can use it to perform a node search. If the current
+// session for the policy has ended, a new session token is allocated.
+func (db *AgbotMemoryDB) ObtainSearchSession(policyName string) (string, uint64, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	ss, ok := db.searchSessions[policyName]
+	if !ok {
+		ss = &searchSession{
+			changedSince: 0,
+			sessionToken: 1,
+			sessionEnded: false,
+		}
+		db.searchSessions[policyName] = ss
+	} else if ss.sessionEnded {
+
+		// Update changedSince based on an agbot restart.
+		if ss.restartChangedSince != 0 {
+			ss.changedSince = ss.restartChangedSince
+			ss.restartChangedSince = 0
+		}
+
+		// The session token is a number so be careful of the number rolling over.
+		if ss.sessionToken >= 2000000000 {
+			ss.sessionToken = 1
+		} else {
+			ss.sessionToken += 1
+		}
+		ss.sessionEnded = false
+	} else {
+		return strconv.FormatUint(ss.sessionToken, 10), ss.changedSince, nil
+	}
+
+	ss.updatingAgbot = db.identity
+	ss.updated = uint64(time.Now().Unix())
+	return strconv.FormatUint(ss.sessionToken, 10), ss.changedSince, nil
+}
+
+// Update the changed since time and mark the current session as ended. The returned boolean indicates whether or not the
+// session was already ended (or was moved on by someone else), in which case nothing is updated.
+func (db *AgbotMemoryDB) UpdateSearchSessionChangedSince(currentChangedSince uint64, newChangedSince uint64, policyName string) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	ss, ok := db.searchSessions[policyName]
+	if !ok {
+		return false, fmt.Errorf("error updating %v search session changedSince, no search session exists", policyName)
+	}
+
+	if ss.changedSince != currentChangedSince || ss.sessionEnded {
+		return true, nil
+	}
+
+	ss.changedSince = newChangedSince
+	ss.sessionEnded = true
+	ss.updatingAgbot = db.identity
+	ss.updated = uint64(time.Now().Unix())
+	return false, nil
+}
+
+// Update all search sessions with a new changed Since to account for possible lost search results when an agbot restarts.
+// Sessions in progress pick up the new value when their next session starts.
+func (db *AgbotMemoryDB) ResetAllChangedSince(newChangedSince uint64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, ss := range db.searchSessions {
+		if ss.sessionEnded {
+			ss.changedSince = newChangedSince
+		} else {
+			ss.restartChangedSince = newChangedSince
+		}
+		ss.updatingAgbot = db.identity
+		ss.updated = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Update the search session for a specific policy with a new changed Since to account for possible lost search results.
+// The earliest requested value is kept and is used when the next session starts.
+func (db *AgbotMemoryDB) ResetPolicyChangedSince(policy string, newChangedSince uint64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if ss, ok := db.searchSessions[policy]; ok && (ss.restartChangedSince == 0 || ss.restartChangedSince > newChangedSince) {
+		ss.restartChangedSince = newChangedSince
+		ss.updatingAgbot = db.identity
+		ss.updated = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) DumpSearchSessions() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	policies := make([]string, 0, len(db.searchSessions))
+	for policy, _ := range db.searchSessions {
+		policies = append(policies, policy)
+	}
+	sort.Strings(policies)
+
+	for _, policy := range policies {
+		glog.V(4).Infof("Search Session: Policy: %v, %v", policy, db.searchSessions[policy])
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"sort"
+)
+
+func (db *AgbotMemoryDB) NewWorkloadUsage(deviceId string, hapartners []string, policy string, policyName string, priority int, retryDurationS int, verifiedDurationS int, reqsNotMet bool, agid string) error {
+	if wlUsage, err := persistence.NewWorkloadUsage(deviceId, hapartners, policy, policyName, priority, retryDurationS, verifiedDurationS, reqsNotMet, agid); err != nil {
+		return err
+	} else {
+		return db.insertWorkloadUsage(wlUsage)
+	}
+}
+
+func (db *AgbotMemoryDB) GetWorkloadUsagesCount(partition string) (int64, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if p, ok := db.partitions[partition]; !ok {
+		return 0, nil
+	} else {
+		return int64(len(p.workloadUsages)), nil
+	}
+}
+
+func (db *AgbotMemoryDB) FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	filters := make([]persistence.WUFilter, 0)
+	filters = append(filters, persistence.DaPWUFilter(deviceid, policyName))
+
+	if wlUsages, err := db.FindWorkloadUsages(filters); err != nil {
+		return nil, err
+	} else if len(wlUsages) > 1 {
+		return nil, fmt.Errorf("Expected only one record for device: %v and policy: %v, but retrieved: %v", deviceid, policyName, wlUsages)
+	} else if len(wlUsages) == 0 {
+		return nil, nil
+	} else {
+		return &wlUsages[0], nil
+	}
+}
+
+func (db *AgbotMemoryDB) UpdatePendingUpgrade(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePendingUpgrade(db, deviceid, policyName)
+}
+
+func (db *AgbotMemoryDB) UpdateRetryCount(deviceid string, policyName string, retryCount int, agid string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdateRetryCount(db, deviceid, policyName, retryCount, agid)
+}
+
+func (db *AgbotMemoryDB) UpdatePriority(deviceid string, policyName string, priority int, retryDurationS int, verifiedDurationS int, agid string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePriority(db, deviceid, policyName, priority, retryDurationS, verifiedDurationS, agid)
+}
+
+func (db *AgbotMemoryDB) UpdatePolicy(deviceid string, policyName string, pol string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePolicy(db, deviceid, policyName, pol)
+}
+
+// All records owned by this agbot are searched regardless of partition, so there is no need to move the workload
+// usage record into the agreement's partition the way the postgresql implementation does.
+func (db *AgbotMemoryDB) UpdateWUAgreementId(deviceid string, policyName string, agid string, protocol string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdateWUAgreementId(db, deviceid, policyName, agid)
+}
+
+func (db *AgbotMemoryDB) DisableRollbackChecking(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	return persistence.DisableRollbackChecking(db, deviceid, policyName)
+}
+
+func (db *AgbotMemoryDB) SingleWorkloadUsageUpdate(deviceid string, policyName string, fn func(persistence.WorkloadUsage) *persistence.WorkloadUsage) (*persistence.WorkloadUsage, error) {
+	if wlUsage, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid, policyName); err != nil {
+		return nil, err
+	} else if wlUsage == nil {
+		return nil, fmt.Errorf("Unable to locate workload usage for device: %v, and policy: %v", deviceid, policyName)
+	} else {
+		updated := fn(*wlUsage)
+		return updated, db.persistUpdatedWorkloadUsage(deviceid, policyName, updated)
+	}
+}
+
+// does whole-member replacements of values that are legal to change during the course of a workload usage
+func (db *AgbotMemoryDB) persistUpdatedWorkloadUsage(deviceid string, policyName string, update *persistence.WorkloadUsage) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	key := wuKey{deviceId: deviceid, policyName: policyName}
+	p, current := db.findWorkloadUsageRecord(key)
+	if current == nil {
+		return fmt.Errorf("No workload usage for device %v and policy %v available to update", deviceid, policyName)
+	}
+
+	var mod persistence.WorkloadUsage
+	if err := json.Unmarshal(current, &mod); err != nil {
+		return fmt.Errorf("Failed to unmarshal workload usage DB data: %v", string(current))
+	}
+
+	// The lock is held, so the current record (mod) is read and then updated according to the updates within
+	// the input update record without interference from other callers. It is critical to check for correct data
+	// transitions while the lock is held.
+	persistence.ValidateWUStateTransition(&mod, update)
+
+	if serialized, err := json.Marshal(mod); err != nil {
+		return fmt.Errorf("Failed to serialize workload usage record: %v", mod)
+	} else {
+		p.workloadUsages[key] = serialized
+		glog.V(2).Infof("Succeeded updating workload usage record to %v", mod.ShortString())
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) DeleteWorkloadUsage(deviceid string, policyName string) error {
+	if deviceid == "" || policyName == "" {
+		return fmt.Errorf("Missing required arg deviceid or policyName")
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	key := wuKey{deviceId: deviceid, policyName: policyName}
+	if p, existing := db.findWorkloadUsageRecord(key); existing == nil {
+		glog.Errorf("Warning: record deletion requested, but workload usage for device %v and policy %v does not exist", deviceid, policyName)
+		return nil // handle already-deleted workload usage as success
+	} else {
+		glog.V(3).Infof("Deleting workload usage record for %v with policy %v", deviceid, policyName)
+		delete(p.workloadUsages, key)
+	}
+	return nil
+}
+
+// Retrieve all workload usages in the partitions owned by this agbot and filter them out based on the input filters. The
+// returned workload usages are sorted by primary key.
+func (db *AgbotMemoryDB) FindWorkloadUsages(filters []persistence.WUFilter) ([]persistence.WorkloadUsage, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	wlUsages := make([]persistence.WorkloadUsage, 0)
+
+	for _, p := range db.ownedPartitions() {
+		for _, serial := range p.workloadUsages {
+			var a persistence.WorkloadUsage
+			if err := json.Unmarshal(serial, &a); err != nil {
+				glog.Errorf("Unable to deserialize db record: %v", string(serial))
+				continue
+			}
+
+			exclude := false
+			for _, filterFn := range filters {
+				if !filterFn(a) {
+					exclude = true
+				}
+			}
+			if !exclude {
+				wlUsages = append(wlUsages, a)
+			}
+		}
+	}
+
+	sort.Slice(wlUsages, func(i, j int) bool { return wlUsages[i].Id < wlUsages[j].Id })
+	return wlUsages, nil
+}
+
+// New workload usages are always written to the primary partition. The record's primary key is allocated from
+// the DB's internal sequence counter right before it is written.
+func (db *AgbotMemoryDB) insertWorkloadUsage(wu *persistence.WorkloadUsage) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	key := wuKey{deviceId: wu.DeviceId, policyName: wu.PolicyName}
+	if _, existing := db.findWorkloadUsageRecord(key); existing != nil {
+		return fmt.Errorf("Workload usage record for device %v and policy name %v already exists.", wu.DeviceId, wu.PolicyName)
+	}
+
+	p, ok := db.partitions[db.primaryPartition]
+	if !ok {
+		return fmt.Errorf("Primary partition %v does not exist, the database is not initialized", db.primaryPartition)
+	}
+
+	wu.Id = db.nextWUId
+	if serialized, err := json.Marshal(wu); err != nil {
+		return fmt.Errorf("Unable to serialize record %v. Error: %v", wu, err)
+	} else {
+		db.nextWUId += 1
+		p.workloadUsages[key] = serialized
+		glog.V(2).Infof("Succeeded writing workload usage record %v", wu.ShortString())
+	}
+	return nil
+}
+
+// Locate the partition and serialized record for a workload usage, searching only the partitions owned by this agbot.
+// The caller must hold the lock.
+func (db *AgbotMemoryDB) findWorkloadUsageRecord(key wuKey) (*partition, []byte) {
+	for _, p := range db.ownedPartitions() {
+		if serial, ok := p.workloadUsages[key]; ok {
+			return p, serial
+		}
+	}
+	return nil, nil
+}
+
+// Workload usages are unique by device and policy name.
+type wuKey struct {
+	deviceId   string
+	policyName string
+}
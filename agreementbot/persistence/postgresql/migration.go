@@ -0,0 +1,326 @@
+package postgresql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"sort"
+	"time"
+)
+
+// The database schema is versioned by an ordered set of migrations. Each migration has up steps that move the schema
+// from the previous version to the migration's version, and down steps that reverse them. The migrations that have been
+// applied are recorded in the schema_migrations table. Several agbots can start against the same database at the same
+// time, so migrations are only applied while holding a transaction scoped advisory lock. Each migration is applied in its
+// own transaction along with the row that records it, so a failed migration leaves the database at the previous version.
+//
+// schema_migrations schema:
+// version:     The version of the applied migration.
+// description: A description of the schema change.
+// applied:     A timestamp to record when the migration was applied.
+//
+
+const MIGRATIONS_CREATE_TABLE = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version int PRIMARY KEY,
+	description text NOT NULL,
+	applied timestamp with time zone DEFAULT current_timestamp
+);`
+
+const MIGRATIONS_TABLE_EXISTS = `SELECT to_regclass('schema_migrations');`
+
+const MIGRATIONS_QUERY = `SELECT version, description, applied FROM schema_migrations ORDER BY version;`
+
+const MIGRATIONS_INSERT = `INSERT INTO schema_migrations (version, description) VALUES ($1, $2);`
+
+const MIGRATIONS_DELETE = `DELETE FROM schema_migrations WHERE version = $1;`
+
+// The advisory lock is released automatically when the transaction that obtained it ends. The key is an arbitrary
+// number that all agbots agree on.
+const MIGRATIONS_LOCK = `SELECT pg_advisory_xact_lock($1);`
+const MIGRATIONS_LOCK_KEY = 7236853127606416
+
+// A schema migration. The SQL statements in up and down are run in order.
+type migration struct {
+	version     int
+	description string
+	up          []string
+	down        []string
+}
+
+func (m migration) String() string {
+	return fmt.Sprintf("Version: %v, Description: %v", m.version, m.description)
+}
+
+// One step of a migration plan, applying a migration either up or down.
+type migrationStep struct {
+	m  migration
+	up bool
+}
+
+// The ordered list of migrations. A migration must never be removed or changed once it is released, new migrations
+// are added to the end of the list with the next version number.
+var migrations []migration
+
+// Add a migration to the end of the registry. The version of the migration must immediately follow the version of
+// the last registered migration.
+func registerMigration(m migration) {
+	if m.version != len(migrations)+1 {
+		panic(fmt.Sprintf("schema migration %v is out of order, expected version %v", m, len(migrations)+1))
+	}
+	migrations = append(migrations, m)
+}
+
+func init() {
+	// The tables and functions that are not specific to a partition. The statements tolerate existing objects so that
+	// databases created before schema migrations were introduced are adopted at this version. The version table is no
+	// longer used by this agbot but is kept for agbots from earlier releases that might be running against the same database.
+	registerMigration(migration{
+		version:     1,
+		description: "initial tables",
+		up: []string{
+			VERSION_CREATE_TABLE,
+			VERSION_INSERT,
+			SEARCH_SESSIONS_CREATE_MAIN_TABLE,
+			SEARCH_SESSIONS_UPDATE_SESSION,
+			SEARCH_SESSIONS_RESET_CHANGED_SINCE,
+			PARTITION_CREATE_MAIN_TABLE,
+			PARTITION_CLAIM_UNOWNED_FUNCTION,
+			WORKLOAD_USAGE_CREATE_MAIN_TABLE,
+			AGREEMENT_CREATE_MAIN_TABLE,
+		},
+		down: []string{
+			`DROP TABLE IF EXISTS agreements CASCADE;`,
+			`DROP TABLE IF EXISTS workload_usages CASCADE;`,
+			`DROP FUNCTION IF EXISTS claim_ownerless(CHARACTER VARYING, int);`,
+			`DROP TABLE IF EXISTS partitions;`,
+			`DROP FUNCTION IF EXISTS reset_changedSince(INTEGER, CHARACTER VARYING);`,
+			`DROP FUNCTION IF EXISTS get_session(CHARACTER VARYING, CHARACTER VARYING);`,
+			`DROP TABLE IF EXISTS search_sessions;`,
+			`DROP TABLE IF EXISTS version;`,
+		},
+	})
+}
+
+// Returns the most recent schema version known to this agbot.
+func latestSchemaVersion() int {
+	return len(migrations)
+}
+
+// Compute the ordered steps that move the schema from the applied migrations to the target version. A target of -1 means
+// the latest version in the registry. Pending migrations up to the target are applied in ascending order, applied migrations
+// above the target are reversed in descending order. Migrations applied by a newer agbot are left alone when migrating to
+// the latest version, but they cannot be reversed because their down steps are unknown.
+func planMigrations(registry []migration, applied map[int]bool, target int) ([]migrationStep, error) {
+
+	latest := len(registry)
+	if target == -1 {
+		target = latest
+	} else if target < 0 || target > latest {
+		return nil, errors.New(fmt.Sprintf("schema version %v is not valid, it must be between 0 and %v", target, latest))
+	}
+
+	steps := make([]migrationStep, 0)
+
+	// Reverse the applied migrations above the target, newest first.
+	down := make([]int, 0)
+	for v, _ := range applied {
+		if v > target && (v <= latest || target != latest) {
+			down = append(down, v)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(down)))
+	for _, v := range down {
+		if v > latest {
+			return nil, errors.New(fmt.Sprintf("schema version %v was applied by a newer agbot, it cannot be reversed by this agbot", v))
+		}
+		steps = append(steps, migrationStep{m: registry[v-1], up: false})
+	}
+
+	// Apply the pending migrations up to the target, oldest first.
+	for v := 1; v <= target; v++ {
+		if !applied[v] {
+			steps = append(steps, migrationStep{m: registry[v-1], up: true})
+		}
+	}
+
+	return steps, nil
+}
+
+// Apply migrations until the schema is at the target version. Each step is planned after obtaining the lock, so that
+// work done by another agbot in the meantime is taken into account.
+func (db *AgbotPostgresqlDB) runMigrations(target int) error {
+
+	for {
+		if done, err := db.runNextMigration(target); err != nil {
+			return err
+		} else if done {
+			return nil
+		}
+	}
+
+}
+
+// Run the next step needed to get to the target version. Returns true when there is nothing left to do.
+func (db *AgbotPostgresqlDB) runNextMigration(target int) (bool, error) {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("unable to start schema migration transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(MIGRATIONS_LOCK, MIGRATIONS_LOCK_KEY); err != nil {
+		return false, errors.New(fmt.Sprintf("unable to obtain schema migration lock, error: %v", err))
+	} else if _, err := tx.Exec(MIGRATIONS_CREATE_TABLE); err != nil {
+		return false, errors.New(fmt.Sprintf("unable to create schema migrations table, error: %v", err))
+	}
+
+	applied, err := db.findAppliedMigrations(tx)
+	if err != nil {
+		return false, err
+	}
+
+	appliedVersions := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		appliedVersions[a.Version] = true
+		if a.Version > latestSchemaVersion() {
+			glog.Warningf("Postgresql database schema version %v was applied by a newer agbot, this agbot supports version %v", a.Version, latestSchemaVersion())
+		}
+	}
+
+	steps, err := planMigrations(migrations, appliedVersions, target)
+	if err != nil {
+		return false, err
+	} else if len(steps) == 0 {
+		return true, tx.Commit()
+	}
+
+	step := steps[0]
+	statements := step.m.down
+	if step.up {
+		statements = step.m.up
+	}
+
+	for si, s := range statements {
+		if _, err := tx.Exec(s); err != nil {
+			return false, errors.New(fmt.Sprintf("unable to run SQL migration statement version %v (up: %v), index %v, statement %v, error: %v", step.m.version, step.up, si, s, err))
+		}
+	}
+
+	if step.up {
+		if _, err := tx.Exec(MIGRATIONS_INSERT, step.m.version, step.m.description); err != nil {
+			return false, errors.New(fmt.Sprintf("unable to record schema migration version %v, error: %v", step.m.version, err))
+		}
+	} else if _, err := tx.Exec(MIGRATIONS_DELETE, step.m.version); err != nil {
+		return false, errors.New(fmt.Sprintf("unable to remove schema migration version %v, error: %v", step.m.version, err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, errors.New(fmt.Sprintf("unable to commit schema migration version %v, error: %v", step.m.version, err))
+	}
+
+	if step.up {
+		glog.V(3).Infof("Postgresql database schema upgraded to version %v, %v", step.m.version, step.m.description)
+	} else {
+		glog.V(3).Infof("Postgresql database schema version %v, %v, reversed", step.m.version, step.m.description)
+	}
+	return false, nil
+
+}
+
+// Return the applied migrations, oldest first. A nil transaction means the query is not part of a transaction.
+func (db *AgbotPostgresqlDB) findAppliedMigrations(tx *sql.Tx) ([]persistence.SchemaMigration, error) {
+
+	var rows *sql.Rows
+	var err error
+	if tx == nil {
+		rows, err = db.db.Query(MIGRATIONS_QUERY)
+	} else {
+		rows, err = tx.Query(MIGRATIONS_QUERY)
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying applied schema migrations, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+
+	applied := make([]persistence.SchemaMigration, 0)
+	for rows.Next() {
+		var m persistence.SchemaMigration
+		var ts time.Time
+		if err := rows.Scan(&m.Version, &m.Description, &ts); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row for applied schema migrations, error: %v", err))
+		}
+		m.Applied = ts.Format(time.RFC3339)
+		applied = append(applied, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating rows for applied schema migrations, error: %v", err))
+	}
+	return applied, nil
+
+}
+
+// Functions that are part of the persistence.SchemaMigrator interface.
+
+// Migrate the schema up or down to the target version. The database connection is opened if the agbot has not initialized
+// the database, which is the case when the agbot is started only to migrate the database.
+func (db *AgbotPostgresqlDB) MigrateSchema(cfg *config.HorizonConfig, target int) (*persistence.SchemaStatus, error) {
+
+	if db.db == nil {
+		if err := db.open(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.runMigrations(target); err != nil {
+		return nil, err
+	}
+	return db.GetSchemaStatus()
+
+}
+
+// Return the applied and pending schema migrations.
+func (db *AgbotPostgresqlDB) GetSchemaStatus() (*persistence.SchemaStatus, error) {
+
+	status := &persistence.SchemaStatus{
+		Versioned:     true,
+		LatestVersion: latestSchemaVersion(),
+		Applied:       []persistence.SchemaMigration{},
+		Pending:       []persistence.SchemaMigration{},
+	}
+
+	// The schema migrations table does not exist until the first migration is run.
+	var tableName []byte
+	if err := db.db.QueryRow(MIGRATIONS_TABLE_EXISTS).Scan(&tableName); err != nil {
+		return nil, errors.New(fmt.Sprintf("error checking for the schema migrations table, error: %v", err))
+	} else if string(tableName) != "" {
+		if applied, err := db.findAppliedMigrations(nil); err != nil {
+			return nil, err
+		} else {
+			status.Applied = applied
+		}
+	}
+
+	appliedVersions := make(map[int]bool, len(status.Applied))
+	for _, a := range status.Applied {
+		appliedVersions[a.Version] = true
+		if a.Version > status.CurrentVersion {
+			status.CurrentVersion = a.Version
+		}
+	}
+
+	for _, m := range migrations {
+		if !appliedVersions[m.version] {
+			status.Pending = append(status.Pending, persistence.SchemaMigration{Version: m.version, Description: m.description})
+		}
+	}
+
+	return status, nil
+
+}
@@ -0,0 +1,105 @@
+// +build unit
+
+package postgresql
+
+import (
+	"testing"
+)
+
+// The registered migrations must have contiguous versions starting at 1, and each one must be reversible.
+func Test_registered_migrations(t *testing.T) {
+	if len(migrations) == 0 {
+		t.Fatalf("expected at least one registered migration")
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %v is at index %v", m, i)
+		} else if len(m.up) == 0 || len(m.down) == 0 {
+			t.Errorf("migration %v must have up and down steps", m)
+		} else if m.description == "" {
+			t.Errorf("migration %v must have a description", m)
+		}
+	}
+}
+
+func Test_registerMigration_out_of_order(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic registering a migration out of order")
+		}
+	}()
+	registerMigration(migration{version: len(migrations) + 2, description: "out of order"})
+}
+
+func Test_planMigrations(t *testing.T) {
+	registry := testRegistry(3)
+
+	tests := []struct {
+		name    string
+		applied []int
+		target  int
+		steps   []int // Positive versions are applied up, negative versions are applied down.
+	}{
+		{"new database", []int{}, -1, []int{1, 2, 3}},
+		{"up to date", []int{1, 2, 3}, -1, []int{}},
+		{"upgrade", []int{1}, -1, []int{2, 3}},
+		{"upgrade to target", []int{1}, 2, []int{2}},
+		{"downgrade", []int{1, 2, 3}, 1, []int{-3, -2}},
+		{"downgrade to empty", []int{1, 2, 3}, 0, []int{-3, -2, -1}},
+		{"fill gap", []int{1, 3}, -1, []int{2}},
+		{"newer agbot", []int{1, 2, 3, 4}, -1, []int{}},
+	}
+
+	for _, test := range tests {
+		applied := make(map[int]bool)
+		for _, v := range test.applied {
+			applied[v] = true
+		}
+
+		steps, err := planMigrations(registry, applied, test.target)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+			continue
+		}
+
+		actual := make([]int, 0)
+		for _, s := range steps {
+			if s.up {
+				actual = append(actual, s.m.version)
+			} else {
+				actual = append(actual, -s.m.version)
+			}
+		}
+
+		if len(actual) != len(test.steps) {
+			t.Errorf("%v: expected steps %v, got %v", test.name, test.steps, actual)
+			continue
+		}
+		for i := range actual {
+			if actual[i] != test.steps[i] {
+				t.Errorf("%v: expected steps %v, got %v", test.name, test.steps, actual)
+				break
+			}
+		}
+	}
+}
+
+func Test_planMigrations_errors(t *testing.T) {
+	registry := testRegistry(3)
+
+	if _, err := planMigrations(registry, map[int]bool{}, 4); err == nil {
+		t.Errorf("expected error for a target newer than the latest migration")
+	} else if _, err := planMigrations(registry, map[int]bool{}, -2); err == nil {
+		t.Errorf("expected error for a negative target")
+	} else if _, err := planMigrations(registry, map[int]bool{1: true, 2: true, 3: true, 4: true}, 2); err == nil {
+		t.Errorf("expected error reversing a migration applied by a newer agbot")
+	}
+}
+
+func testRegistry(num int) []migration {
+	registry := make([]migration, 0, num)
+	for v := 1; v <= num; v++ {
+		registry = append(registry, migration{version: v, description: "test", up: []string{"up"}, down: []string{"down"}})
+	}
+	return registry
+}
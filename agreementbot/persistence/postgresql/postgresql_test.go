@@ -0,0 +1,51 @@
+// +build integration
+
+package postgresql
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence/conformance"
+	"github.com/open-horizon/anax/config"
+	"os"
+	"testing"
+)
+
+// The conformance tests are run against a real Postgresql database, which is identified by these environment
+// variables. The test is skipped when the database host is not set.
+func Test_Conformance(t *testing.T) {
+
+	host := os.Getenv("HORIZON_TEST_POSTGRESQL_HOST")
+	if host == "" {
+		t.Skip("HORIZON_TEST_POSTGRESQL_HOST is not set, skipping Postgresql conformance tests")
+	}
+
+	cfg := &config.HorizonConfig{
+		AgreementBot: config.AGConfig{
+			Postgresql: config.PostgresqlConfig{
+				Host:               host,
+				Port:               os.Getenv("HORIZON_TEST_POSTGRESQL_PORT"),
+				User:               os.Getenv("HORIZON_TEST_POSTGRESQL_USER"),
+				Password:           os.Getenv("HORIZON_TEST_POSTGRESQL_PASSWORD"),
+				DBName:             os.Getenv("HORIZON_TEST_POSTGRESQL_DBNAME"),
+				SSLMode:            os.Getenv("HORIZON_TEST_POSTGRESQL_SSLMODE"),
+				MaxOpenConnections: 8,
+			},
+		},
+	}
+
+	db := new(AgbotPostgresqlDB)
+	if err := db.Initialize(cfg); err != nil {
+		t.Fatalf("unable to initialize Postgresql database, error: %v", err)
+	}
+	defer func() {
+		db.QuiescePartition()
+		db.Close()
+	}()
+
+	conformance.RunConformanceTests(t, db)
+
+	if status, err := db.GetSchemaStatus(); err != nil {
+		t.Errorf("error getting schema status: %v", err)
+	} else if status.CurrentVersion != latestSchemaVersion() || len(status.Pending) != 0 {
+		t.Errorf("expected the schema to be at version %v after initialization, status is %v", latestSchemaVersion(), status)
+	}
+}
@@ -1,10 +1,8 @@
 package postgresql
 
-import ()
-
-// Constants for the SQL statements that are used to work with the database version. The entire database schema has a single
-// version that is kept in the version table. Agbots automatically upgrade the database during initialization based on their version
-// and the version in the database.
+// Constants for the SQL statements that are used to work with the legacy database version table. Agbots from earlier releases
+// kept a single schema version in this table. The schema is now versioned by the migrations in migration.go, the table is
+// still created so that those agbots continue to work against a database that has been migrated.
 
 // version schema:
 // ver:     The current version of the database schema.
@@ -26,15 +24,3 @@ BEGIN
 		INSERT INTO version (id, ver, description) VALUES (1, 0, 'initial tables');
 	END IF;
 END $$`
-
-const VERSION_UPDATE = `UPDATE version SET ver = $1, description = $2, updated = current_timestamp WHERE id = 1;`
-
-const HIGHEST_DATABASE_VERSION = v1
-const v1 = 0
-
-type SchemaUpdate struct {
-	sql         []string // The SQL statements to run for an update to the schema.
-	description string   // A description of the schema change.
-}
-
-var migrationSQL = map[int]SchemaUpdate{}
@@ -20,17 +20,33 @@ func Register(name string, db AgbotDatabase) {
 	DatabaseProviders[name] = db
 }
 
-// Initialize the underlying Agbot database depending on what is configured. If the bolt DB is configured, it is used. Next,
-// the postgresql config is checked and used if configured. If nothing is configured, an error is returned.
+// Initialize the underlying Agbot database depending on what is configured. An explicit request for the in-memory DB takes
+// precedence. Otherwise, if the bolt DB is configured, it is used. Next, the postgresql config is checked and used if configured.
+// If nothing is configured, an error is returned.
 func InitDatabase(cfg *config.HorizonConfig) (AgbotDatabase, error) {
 
-	if cfg.IsBoltDBConfigured() {
-		dbObj := DatabaseProviders["bolt"]
+	if dbObj, err := configuredDatabase(cfg); err != nil {
+		return nil, err
+	} else {
 		return dbObj, dbObj.Initialize(cfg)
+	}
+
+}
+
+// Return the database implementation selected by the config, without initializing it.
+func configuredDatabase(cfg *config.HorizonConfig) (AgbotDatabase, error) {
+
+	if cfg.IsInMemoryDBConfigured() {
+		if dbObj, ok := DatabaseProviders["memory"]; ok {
+			return dbObj, nil
+		}
+		return nil, errors.New("the in-memory DB is configured but it is not registered.")
+
+	} else if cfg.IsBoltDBConfigured() {
+		return DatabaseProviders["bolt"], nil
 
 	} else if cfg.IsPostgresqlConfigured() {
-		dbObj := DatabaseProviders["postgresql"]
-		return dbObj, dbObj.Initialize(cfg)
+		return DatabaseProviders["postgresql"], nil
 
 	}
 	return nil, errors.New(fmt.Sprintf("neither bolt DB nor Postgresql DB is configured correctly."))
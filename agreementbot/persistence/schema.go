@@ -0,0 +1,63 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/config"
+)
+
+// Some agbot databases have a versioned schema that is upgraded by an ordered set of migrations. Those database
+// implementations also implement this interface so that the runtime can apply migrations without starting the agbot,
+// and so that the applied schema version can be shown to an operator.
+type SchemaMigrator interface {
+	// Migrate the schema up or down to the target version. A target of -1 means the latest version known to this agbot.
+	MigrateSchema(cfg *config.HorizonConfig, target int) (*SchemaStatus, error)
+	GetSchemaStatus() (*SchemaStatus, error)
+}
+
+// A single schema migration, either applied to the database or pending.
+type SchemaMigration struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Applied     string `json:"applied,omitempty"` // The time the migration was applied, empty when pending.
+}
+
+func (s SchemaMigration) String() string {
+	return fmt.Sprintf("Version: %v, Description: %v, Applied: %v", s.Version, s.Description, s.Applied)
+}
+
+// The state of the database schema.
+type SchemaStatus struct {
+	Versioned      bool              `json:"versioned"` // False if the database does not have a versioned schema.
+	CurrentVersion int               `json:"current_version"`
+	LatestVersion  int               `json:"latest_version"`
+	Applied        []SchemaMigration `json:"applied_migrations"`
+	Pending        []SchemaMigration `json:"pending_migrations"`
+}
+
+func (s SchemaStatus) String() string {
+	return fmt.Sprintf("Versioned: %v, CurrentVersion: %v, LatestVersion: %v, Applied: %v, Pending: %v", s.Versioned, s.CurrentVersion, s.LatestVersion, s.Applied, s.Pending)
+}
+
+// Return the schema status of an agbot database, or an unversioned status if the database does not have a versioned schema.
+func GetSchemaStatus(db AgbotDatabase) (*SchemaStatus, error) {
+	if migrator, ok := db.(SchemaMigrator); ok {
+		return migrator.GetSchemaStatus()
+	}
+	return &SchemaStatus{Versioned: false, Applied: []SchemaMigration{}, Pending: []SchemaMigration{}}, nil
+}
+
+// Apply the schema migrations of the configured database without initializing the agbot's use of the database. This is
+// used to upgrade (or downgrade) the database ahead of starting the agbots that use it. Migrating to version 0 drops
+// every agbot table, so it is refused unless dropAll is set.
+func MigrateDatabase(cfg *config.HorizonConfig, target int, dropAll bool) (*SchemaStatus, error) {
+	if target == 0 && !dropAll {
+		return nil, errors.New("migrating to schema version 0 drops every table in the agbot database, it must be explicitly confirmed.")
+	} else if dbObj, err := configuredDatabase(cfg); err != nil {
+		return nil, err
+	} else if migrator, ok := dbObj.(SchemaMigrator); !ok {
+		return nil, errors.New("the configured database does not support schema migrations.")
+	} else {
+		return migrator.MigrateSchema(cfg, target)
+	}
+}
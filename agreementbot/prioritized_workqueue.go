@@ -3,10 +3,41 @@ package agreementbot
 import (
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/metrics"
 	"sync"
 	"time"
 )
 
+var workQueueBufferLength = metrics.NewGaugeVec("anax_agbot_work_queue_buffer_length", "The amount of agreement work buffered in the agbot work queues, by priority.", "priority")
+
+// The work queues that are running. The buffer lengths of all of them are added up when the metrics are scraped, by a
+// collector that is registered once.
+var workQueues = struct {
+	lock   sync.Mutex
+	queues map[*PrioritizedWorkQueue]bool
+}{queues: make(map[*PrioritizedWorkQueue]bool)}
+
+var registerWorkQueueCollector sync.Once
+
+func collectWorkQueueMetrics() {
+	workQueues.lock.Lock()
+	defer workQueues.lock.Unlock()
+
+	if len(workQueues.queues) == 0 {
+		workQueueBufferLength.Delete(HIGH_PRIORITY)
+		workQueueBufferLength.Delete(LOW_PRIORITY)
+		return
+	}
+
+	high, low := 0, 0
+	for n := range workQueues.queues {
+		high += n.HighPriorityBufferLen()
+		low += n.LowPriorityBufferLen()
+	}
+	workQueueBufferLength.Set(float64(high), HIGH_PRIORITY)
+	workQueueBufferLength.Set(float64(low), LOW_PRIORITY)
+}
+
 // A work queue that never blocks the sender and blocks the receiver when the internal work queue is empty.
 // The high priority inbound channel can inject work into the workers even when the low priority queue is non-empty.
 // Essentially, this allows high priority work to skip to the front of the line for the worker threads.
@@ -35,6 +66,14 @@ func NewPrioritizedWorkQueue(bufferSize uint64) *PrioritizedWorkQueue {
 		bufferSize:          bufferSize,
 	}
 
+	// The buffer lengths are read when the metrics are scraped, until the queue is closed and drained.
+	registerWorkQueueCollector.Do(func() {
+		metrics.RegisterCollector("agbot_work_queue", collectWorkQueueMetrics)
+	})
+	workQueues.lock.Lock()
+	workQueues.queues[n] = true
+	workQueues.lock.Unlock()
+
 	go n.run()
 	return n
 }
@@ -157,6 +196,9 @@ func (n *PrioritizedWorkQueue) run() {
 
 	for {
 		if n.inboundHigh == nil && n.HighPriorityBufferLen() == 0 {
+			workQueues.lock.Lock()
+			delete(workQueues.queues, n)
+			workQueues.lock.Unlock()
 			glog.V(3).Infof(pwqString("Closing receive channel"))
 			close(n.recv)
 			break
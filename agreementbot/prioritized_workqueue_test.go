@@ -3,7 +3,11 @@
 package agreementbot
 
 import (
+	"bytes"
 	"flag"
+	"github.com/open-horizon/anax/metrics"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -129,3 +133,52 @@ func workerThread(t *testing.T, nbc *PrioritizedWorkQueue, worklist *[]uint) {
 
 	}
 }
+
+// The buffered work of all the running queues is reported, and a queue is no longer reported once it is closed.
+func Test_PrioritizedWorkQueue_metrics(t *testing.T) {
+	wq1 := NewPrioritizedWorkQueue(10)
+	wq2 := NewPrioritizedWorkQueue(10)
+
+	// Other queues in the tests can still be running.
+	before := highPriorityBufferMetric(t)
+
+	work := NewCancelAgreement("1234567890", "Basic", 100, 0)
+	wq1.AddToHighPriorityBuffer(&work)
+	wq2.AddToHighPriorityBuffer(&work)
+
+	if high := highPriorityBufferMetric(t); high != before+2 {
+		t.Errorf("expected the work of both queues, got %v, was %v", high, before)
+	}
+
+	// Drain the queues so that they stop once they are closed.
+	wq1.Close()
+	<-wq1.Receive()
+	if _, ok := <-wq1.Receive(); ok {
+		t.Fatalf("expected the queue to be closed")
+	}
+
+	if high := highPriorityBufferMetric(t); high != before+1 {
+		t.Errorf("expected only the work of the running queue, got %v, was %v", high, before)
+	}
+
+	wq2.Close()
+	for range wq2.Receive() {
+	}
+}
+
+// Scrape the high priority buffer length.
+func highPriorityBufferMetric(t *testing.T) int {
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.WriteText(&buf)
+
+	prefix := "anax_agbot_work_queue_buffer_length{priority=\"high\"} "
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			if high, err := strconv.Atoi(strings.TrimPrefix(line, prefix)); err == nil {
+				return high
+			}
+		}
+	}
+	t.Fatalf("the high priority buffer length was not found in:\n%v", buf.String())
+	return 0
+}
@@ -25,7 +25,6 @@ import (
 	"net/http"
 	"os"
 	"strings"
-	"time"
 )
 
 type SecureAPI struct {
@@ -466,11 +465,8 @@ func (a *SecureAPI) authenticateWithExchange(user string, userPasswd string, msg
 	user_ec := a.createUserExchangeContext(user, userPasswd)
 
 	// Invoke the exchange API to verify the user.
-	retryCount := user_ec.GetHTTPFactory().RetryCount
-	retryInterval := user_ec.GetHTTPFactory().GetRetryInterval()
+	retry := exchange.NewRetry(user_ec.GetHTTPFactory())
 	for {
-		retryCount = retryCount - 1
-
 		var resp interface{}
 		resp = new(exchange.GetUsersResponse)
 		targetURL := fmt.Sprintf("%vorgs/%v/users/%v", user_ec.GetExchangeURL(), orgId, userId)
@@ -486,10 +482,9 @@ func (a *SecureAPI) authenticateWithExchange(user string, userPasswd string, msg
 		} else if tpErr != nil {
 			glog.Warningf(APIlogString(tpErr.Error()))
 
-			if retryCount <= 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", user_ec.GetHTTPFactory().RetryCount, tpErr)
 			}
-			time.Sleep(time.Duration(retryInterval) * time.Second)
 			continue
 		} else {
 			return user_ec, nil
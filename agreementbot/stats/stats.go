@@ -0,0 +1,364 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/policy"
+	"sort"
+)
+
+// Agreement analytics are aggregated from the agreements (active and archived) and workload usages in the agbot database.
+// Agreement creation and cancellation counts, the time it takes agreements to be accepted and finalized, and the reasons
+// for cancellation are computed for the agreements in a time window, grouped by deployment policy, pattern, org or service.
+// Rollbacks are computed per service version from the history of agreements made with each node for each policy.
+
+const GROUP_BY_POLICY = "policy"
+const GROUP_BY_PATTERN = "pattern"
+const GROUP_BY_ORG = "org"
+const GROUP_BY_SERVICE = "service"
+const GROUP_BY_NONE = "none"
+
+// The key used for agreements that have no value for the group by attribute, and for the single group when there is no grouping.
+const GROUP_NONE = "none"
+const GROUP_ALL = "all"
+
+const DEFAULT_WINDOW_S = 24 * 3600
+const DEFAULT_INTERVAL_S = 3600
+
+// The maximum number of intervals in the time window, to limit the size of the response.
+const MAX_INTERVALS = 10000
+
+// The parameters of a statistics query. Times are in seconds since the epoch.
+type Query struct {
+	Start     uint64 `json:"start"`
+	End       uint64 `json:"end"`
+	IntervalS uint64 `json:"interval"`
+	GroupBy   string `json:"group_by"`
+}
+
+func (q Query) String() string {
+	return fmt.Sprintf("Start: %v, End: %v, IntervalS: %v, GroupBy: %v", q.Start, q.End, q.IntervalS, q.GroupBy)
+}
+
+// Fill in the defaults for the parameters that were not specified. The default window is the day before now, with
+// hourly intervals, grouped by deployment policy.
+func (q *Query) SetDefaults(now uint64) {
+	if q.End == 0 {
+		q.End = now
+	}
+	if q.Start == 0 && q.End > DEFAULT_WINDOW_S {
+		q.Start = q.End - DEFAULT_WINDOW_S
+	}
+	if q.IntervalS == 0 {
+		q.IntervalS = DEFAULT_INTERVAL_S
+	}
+	if q.GroupBy == "" {
+		q.GroupBy = GROUP_BY_POLICY
+	}
+}
+
+func (q Query) Validate() error {
+	if q.End < q.Start {
+		return errors.New(fmt.Sprintf("end %v is before start %v", q.End, q.Start))
+	} else if q.IntervalS == 0 {
+		return errors.New("interval must be greater than 0")
+	} else if (q.End-q.Start)/q.IntervalS >= MAX_INTERVALS {
+		return errors.New(fmt.Sprintf("the time window has more than %v intervals, use a longer interval or a shorter window", MAX_INTERVALS))
+	}
+	switch q.GroupBy {
+	case GROUP_BY_POLICY, GROUP_BY_PATTERN, GROUP_BY_ORG, GROUP_BY_SERVICE, GROUP_BY_NONE:
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("group by %v is not supported, must be one of %v, %v, %v, %v or %v", q.GroupBy, GROUP_BY_POLICY, GROUP_BY_PATTERN, GROUP_BY_ORG, GROUP_BY_SERVICE, GROUP_BY_NONE))
+	}
+}
+
+// Returns true if the time is within the query window, inclusive.
+func (q Query) inWindow(t uint64) bool {
+	return t != 0 && t >= q.Start && t <= q.End
+}
+
+// Returns the start of the interval containing the time.
+func (q Query) intervalStart(t uint64) uint64 {
+	return q.Start + ((t-q.Start)/q.IntervalS)*q.IntervalS
+}
+
+// The number of agreements created and cancelled in an interval.
+type Interval struct {
+	Start     uint64 `json:"start"`
+	Created   int    `json:"created"`
+	Cancelled int    `json:"cancelled"`
+}
+
+// Summary statistics for a set of durations.
+type DurationStats struct {
+	Count int     `json:"count"`
+	MeanS float64 `json:"mean"`
+	MinS  uint64  `json:"min"`
+	MaxS  uint64  `json:"max"`
+}
+
+func (d *DurationStats) add(secs uint64) {
+	if d.Count == 0 || secs < d.MinS {
+		d.MinS = secs
+	}
+	if secs > d.MaxS {
+		d.MaxS = secs
+	}
+	d.MeanS = (d.MeanS*float64(d.Count) + float64(secs)) / float64(d.Count+1)
+	d.Count += 1
+}
+
+// The number of agreements cancelled for a reason.
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// The statistics for a group of agreements. Intervals with no activity are omitted.
+type GroupStats struct {
+	Created        int           `json:"created"`
+	Cancelled      int           `json:"cancelled"`
+	TimeToAccept   DurationStats `json:"time_to_accept"`   // From the proposal to the node accepting it.
+	TimeToFinalize DurationStats `json:"time_to_finalize"` // From the proposal to the agreement being finalized.
+	CancelReasons  []ReasonCount `json:"cancel_reasons"`   // Most common first.
+	Intervals      []Interval    `json:"intervals"`
+
+	intervals map[uint64]*Interval
+	reasons   map[string]int
+}
+
+func newGroupStats() *GroupStats {
+	return &GroupStats{
+		CancelReasons: []ReasonCount{},
+		Intervals:     []Interval{},
+		intervals:     make(map[uint64]*Interval),
+		reasons:       make(map[string]int),
+	}
+}
+
+func (g *GroupStats) interval(q Query, t uint64) *Interval {
+	start := q.intervalStart(t)
+	if _, ok := g.intervals[start]; !ok {
+		g.intervals[start] = &Interval{Start: start}
+	}
+	return g.intervals[start]
+}
+
+func (g *GroupStats) add(q Query, ag *persistence.Agreement) {
+	if q.inWindow(ag.AgreementInceptionTime) {
+		g.Created += 1
+		g.interval(q, ag.AgreementInceptionTime).Created += 1
+		if ag.AgreementCreationTime >= ag.AgreementInceptionTime {
+			g.TimeToAccept.add(ag.AgreementCreationTime - ag.AgreementInceptionTime)
+		}
+		if ag.AgreementFinalizedTime >= ag.AgreementInceptionTime {
+			g.TimeToFinalize.add(ag.AgreementFinalizedTime - ag.AgreementInceptionTime)
+		}
+	}
+
+	if q.inWindow(ag.AgreementTimedout) {
+		g.Cancelled += 1
+		g.interval(q, ag.AgreementTimedout).Cancelled += 1
+		g.reasons[cancelReason(ag)] += 1
+	}
+}
+
+// Convert the accumulated maps into sorted lists.
+func (g *GroupStats) complete() {
+	for _, i := range g.intervals {
+		g.Intervals = append(g.Intervals, *i)
+	}
+	sort.Slice(g.Intervals, func(i, j int) bool { return g.Intervals[i].Start < g.Intervals[j].Start })
+
+	for reason, count := range g.reasons {
+		g.CancelReasons = append(g.CancelReasons, ReasonCount{Reason: reason, Count: count})
+	}
+	sort.Slice(g.CancelReasons, func(i, j int) bool {
+		if g.CancelReasons[i].Count != g.CancelReasons[j].Count {
+			return g.CancelReasons[i].Count > g.CancelReasons[j].Count
+		}
+		return g.CancelReasons[i].Reason < g.CancelReasons[j].Reason
+	})
+}
+
+// The rollback statistics for a service version. A rollback is an agreement with a node for a policy that uses a lower
+// priority workload than the previous agreement with that node for the same policy. The rollback is counted against the
+// service version of the previous agreement, in the window containing the inception of the new agreement.
+type ServiceRollbacks struct {
+	Service        string  `json:"service"`
+	Version        string  `json:"version"`
+	Agreements     int     `json:"agreements"`      // Agreements created in the window using this service version.
+	Rollbacks      int     `json:"rollbacks"`       // Rollbacks away from this service version in the window.
+	RollbackRate   float64 `json:"rollback_rate"`   // Rollbacks per agreement.
+	WorkloadUsages int     `json:"workload_usages"` // Nodes currently using this service version, regardless of the window.
+	Retries        int     `json:"retries"`         // The current retry count of those nodes.
+}
+
+// The result of a statistics query.
+type AgreementStats struct {
+	Query
+	Totals   *GroupStats            `json:"totals"`
+	Groups   map[string]*GroupStats `json:"groups"`
+	Services []ServiceRollbacks     `json:"service_rollbacks"`
+}
+
+func (a AgreementStats) String() string {
+	return fmt.Sprintf("Query: {%v}, Totals: %v, Groups: %v, Services: %v", a.Query, *a.Totals, a.Groups, a.Services)
+}
+
+// Compute the statistics for the query from the agreements and workload usages. The query must be valid.
+func ComputeAgreementStats(q Query, agreements []persistence.Agreement, wlUsages []persistence.WorkloadUsage) *AgreementStats {
+
+	result := &AgreementStats{
+		Query:    q,
+		Totals:   newGroupStats(),
+		Groups:   make(map[string]*GroupStats),
+		Services: []ServiceRollbacks{},
+	}
+
+	services := make(map[serviceVersion]*ServiceRollbacks)
+	getService := func(sv serviceVersion) *ServiceRollbacks {
+		if _, ok := services[sv]; !ok {
+			services[sv] = &ServiceRollbacks{Service: sv.service, Version: sv.version}
+		}
+		return services[sv]
+	}
+
+	// The agreements made with each node for each policy, used to find rollbacks.
+	history := make(map[string][]*agreementWorkload)
+
+	for ix := range agreements {
+		ag := &agreements[ix]
+		aw := newAgreementWorkload(ag)
+
+		result.Totals.add(q, ag)
+
+		key := groupKey(q.GroupBy, aw)
+		if _, ok := result.Groups[key]; !ok {
+			result.Groups[key] = newGroupStats()
+		}
+		result.Groups[key].add(q, ag)
+
+		if aw.workload != nil {
+			if q.inWindow(ag.AgreementInceptionTime) {
+				getService(aw.serviceVersion()).Agreements += 1
+			}
+			hKey := ag.DeviceId + "|" + ag.PolicyName
+			history[hKey] = append(history[hKey], aw)
+		}
+	}
+
+	for _, h := range history {
+		sort.SliceStable(h, func(i, j int) bool { return h[i].agreement.AgreementInceptionTime < h[j].agreement.AgreementInceptionTime })
+		for i := 1; i < len(h); i++ {
+			prev, next := h[i-1], h[i]
+			if prev.workload.HasEmptyPriority() || next.workload.HasEmptyPriority() {
+				continue
+			} else if next.workload.Priority.PriorityValue > prev.workload.Priority.PriorityValue && q.inWindow(next.agreement.AgreementInceptionTime) {
+				getService(prev.serviceVersion()).Rollbacks += 1
+			}
+		}
+	}
+
+	// The workload usage policy is the policy of the agreement currently in use, so it contains the workload in use.
+	for _, wu := range wlUsages {
+		if wu.Policy == "" {
+			continue
+		} else if pol, err := policy.DemarshalPolicy(wu.Policy); err != nil || len(pol.Workloads) == 0 {
+			continue
+		} else {
+			s := getService(newServiceVersion(&pol.Workloads[0]))
+			s.WorkloadUsages += 1
+			s.Retries += wu.RetryCount
+		}
+	}
+
+	for _, s := range services {
+		if s.Agreements != 0 {
+			s.RollbackRate = float64(s.Rollbacks) / float64(s.Agreements)
+		}
+		result.Services = append(result.Services, *s)
+	}
+	sort.Slice(result.Services, func(i, j int) bool {
+		if result.Services[i].Service != result.Services[j].Service {
+			return result.Services[i].Service < result.Services[j].Service
+		}
+		return result.Services[i].Version < result.Services[j].Version
+	})
+
+	result.Totals.complete()
+	for _, g := range result.Groups {
+		g.complete()
+	}
+
+	return result
+}
+
+// A service and version, used as a map key.
+type serviceVersion struct {
+	service string
+	version string
+}
+
+func newServiceVersion(wl *policy.Workload) serviceVersion {
+	return serviceVersion{service: cutil.FormOrgSpecUrl(wl.WorkloadURL, wl.Org), version: wl.Version}
+}
+
+// An agreement and the workload it was made for. The workload is nil when it cannot be determined from the agreement's policy.
+type agreementWorkload struct {
+	agreement *persistence.Agreement
+	workload  *policy.Workload
+}
+
+func newAgreementWorkload(ag *persistence.Agreement) *agreementWorkload {
+	aw := &agreementWorkload{agreement: ag}
+	if ag.Policy != "" {
+		if pol, err := policy.DemarshalPolicy(ag.Policy); err == nil && len(pol.Workloads) != 0 {
+			aw.workload = &pol.Workloads[0]
+		}
+	}
+	return aw
+}
+
+func (aw *agreementWorkload) serviceVersion() serviceVersion {
+	return newServiceVersion(aw.workload)
+}
+
+// Returns the key of the group that the agreement belongs to.
+func groupKey(groupBy string, aw *agreementWorkload) string {
+	key := ""
+	switch groupBy {
+	case GROUP_BY_POLICY:
+		key = aw.agreement.PolicyName
+	case GROUP_BY_PATTERN:
+		key = aw.agreement.Pattern
+	case GROUP_BY_ORG:
+		key = aw.agreement.Org
+	case GROUP_BY_SERVICE:
+		if aw.workload != nil {
+			key = aw.serviceVersion().service
+		}
+	default:
+		return GROUP_ALL
+	}
+
+	if key == "" {
+		return GROUP_NONE
+	}
+	return key
+}
+
+// Returns a description of the reason an agreement was cancelled.
+func cancelReason(ag *persistence.Agreement) string {
+	if ag.TerminatedDescription != "" {
+		return ag.TerminatedDescription
+	} else if ag.TerminatedReason != 0 {
+		return fmt.Sprintf("reason code %v", ag.TerminatedReason)
+	} else if !ag.Archived {
+		return "terminating"
+	}
+	return "unknown"
+}
@@ -0,0 +1,179 @@
+// +build unit
+
+package stats
+
+import (
+	"encoding/json"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"reflect"
+	"testing"
+)
+
+func Test_Query_defaults_and_validation(t *testing.T) {
+	q := Query{}
+	q.SetDefaults(100000)
+	if q.End != 100000 || q.Start != 100000-DEFAULT_WINDOW_S || q.IntervalS != DEFAULT_INTERVAL_S || q.GroupBy != GROUP_BY_POLICY {
+		t.Errorf("unexpected defaults %v", q)
+	} else if err := q.Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	invalid := []Query{
+		{Start: 200, End: 100, IntervalS: 10, GroupBy: GROUP_BY_ORG},
+		{Start: 0, End: 100, IntervalS: 0, GroupBy: GROUP_BY_ORG},
+		{Start: 0, End: MAX_INTERVALS * 10, IntervalS: 10, GroupBy: GROUP_BY_ORG},
+		{Start: 0, End: 100, IntervalS: 10, GroupBy: "node"},
+	}
+	for _, q := range invalid {
+		if err := q.Validate(); err == nil {
+			t.Errorf("expected query %v to be invalid", q)
+		}
+	}
+}
+
+// The window has 3 hourly intervals starting at 3600, 7200 and 10800.
+func Test_ComputeAgreementStats_counts(t *testing.T) {
+	ags := []persistence.Agreement{
+		testAgreement("ag1", "dev1", "myorg/pol1", 3600, 3610, 3630, 0, ""),
+		testAgreement("ag2", "dev2", "myorg/pol1", 4000, 4020, 0, 8000, "node rejected the proposal"),
+		testAgreement("ag3", "dev3", "myorg/pol2", 100, 110, 120, 11000, "node rejected the proposal"),
+		testAgreement("ag4", "dev4", "myorg/pol2", 11000, 0, 0, 20000, "policy changed"),
+		testAgreement("ag5", "dev5", "myorg/pol2", 7300, 7320, 7380, 7400, "policy changed"),
+		testAgreement("ag6", "dev6", "myorg/pol2", 11500, 0, 0, 11600, "node heartbeat missing"),
+	}
+
+	q := Query{Start: 3600, End: 4*3600 - 1, IntervalS: 3600, GroupBy: GROUP_BY_POLICY}
+	s := ComputeAgreementStats(q, ags, []persistence.WorkloadUsage{})
+
+	if s.Totals.Created != 5 || s.Totals.Cancelled != 4 {
+		t.Errorf("expected 5 created and 4 cancelled, got %v and %v", s.Totals.Created, s.Totals.Cancelled)
+	} else if expected := []Interval{{3600, 2, 0}, {7200, 1, 2}, {10800, 2, 2}}; !reflect.DeepEqual(s.Totals.Intervals, expected) {
+		t.Errorf("expected intervals %v, got %v", expected, s.Totals.Intervals)
+	} else if expected := []ReasonCount{{"node rejected the proposal", 2}, {"node heartbeat missing", 1}, {"policy changed", 1}}; !reflect.DeepEqual(s.Totals.CancelReasons, expected) {
+		t.Errorf("expected cancel reasons %v, got %v", expected, s.Totals.CancelReasons)
+	}
+
+	if len(s.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %v", s.Groups)
+	}
+
+	pol1 := s.Groups["myorg/pol1"]
+	if pol1.Created != 2 || pol1.Cancelled != 1 {
+		t.Errorf("expected pol1 to have 2 created and 1 cancelled, got %v", *pol1)
+	} else if pol1.TimeToAccept != (DurationStats{Count: 2, MeanS: 15, MinS: 10, MaxS: 20}) {
+		t.Errorf("unexpected time to accept %v", pol1.TimeToAccept)
+	} else if pol1.TimeToFinalize != (DurationStats{Count: 1, MeanS: 30, MinS: 30, MaxS: 30}) {
+		t.Errorf("unexpected time to finalize %v", pol1.TimeToFinalize)
+	} else if expected := []Interval{{3600, 2, 0}, {7200, 0, 1}}; !reflect.DeepEqual(pol1.Intervals, expected) {
+		t.Errorf("expected intervals %v, got %v", expected, pol1.Intervals)
+	}
+
+	// Agreements that were not accepted or finalized are not included in the durations.
+	pol2 := s.Groups["myorg/pol2"]
+	if pol2.Created != 3 || pol2.Cancelled != 3 {
+		t.Errorf("expected pol2 to have 3 created and 3 cancelled, got %v", *pol2)
+	} else if pol2.TimeToAccept != (DurationStats{Count: 1, MeanS: 20, MinS: 20, MaxS: 20}) {
+		t.Errorf("unexpected time to accept %v", pol2.TimeToAccept)
+	} else if pol2.TimeToFinalize != (DurationStats{Count: 1, MeanS: 80, MinS: 80, MaxS: 80}) {
+		t.Errorf("unexpected time to finalize %v", pol2.TimeToFinalize)
+	} else if expected := []Interval{{7200, 1, 1}, {10800, 2, 2}}; !reflect.DeepEqual(pol2.Intervals, expected) {
+		t.Errorf("expected intervals %v, got %v", expected, pol2.Intervals)
+	}
+}
+
+func Test_ComputeAgreementStats_grouping(t *testing.T) {
+	ags := []persistence.Agreement{
+		testAgreement("ag1", "dev1", "myorg/pol1", 3600, 0, 0, 0, ""),
+		testAgreement("ag2", "dev2", "myorg/pol1", 3700, 0, 0, 0, ""),
+	}
+	ags[0].Pattern = "myorg/pat1"
+	ags[0].Policy = testPolicy(t, "svc1", "1.0", 1)
+
+	q := Query{Start: 3600, End: 7199, IntervalS: 3600}
+
+	q.GroupBy = GROUP_BY_NONE
+	if s := ComputeAgreementStats(q, ags, nil); len(s.Groups) != 1 || s.Groups[GROUP_ALL] == nil || s.Groups[GROUP_ALL].Created != 2 {
+		t.Errorf("expected a single group with all the agreements, got %v", s.Groups)
+	}
+
+	q.GroupBy = GROUP_BY_PATTERN
+	if s := ComputeAgreementStats(q, ags, nil); len(s.Groups) != 2 || s.Groups["myorg/pat1"] == nil || s.Groups[GROUP_NONE] == nil {
+		t.Errorf("expected a pattern group and a group with no pattern, got %v", s.Groups)
+	}
+
+	q.GroupBy = GROUP_BY_SERVICE
+	if s := ComputeAgreementStats(q, ags, nil); len(s.Groups) != 2 || s.Groups["myorg/svc1"] == nil || s.Groups[GROUP_NONE] == nil {
+		t.Errorf("expected a service group and a group with no service, got %v", s.Groups)
+	}
+
+	q.GroupBy = GROUP_BY_ORG
+	if s := ComputeAgreementStats(q, ags, nil); len(s.Groups) != 1 || s.Groups["myorg"] == nil {
+		t.Errorf("expected a single org group, got %v", s.Groups)
+	}
+}
+
+func Test_ComputeAgreementStats_rollbacks(t *testing.T) {
+	v1 := testPolicy(t, "svc1", "1.0", 1)
+	v09 := testPolicy(t, "svc1", "0.9", 2)
+
+	ags := []persistence.Agreement{
+		// dev1 rolls back from 1.0 to 0.9 and then forward to 1.0 again.
+		testAgreement("a", "dev1", "myorg/pol", 3700, 0, 0, 3750, ""),
+		testAgreement("b", "dev1", "myorg/pol", 3800, 0, 0, 3850, ""),
+		testAgreement("c", "dev1", "myorg/pol", 3900, 0, 0, 0, ""),
+		// dev2 rolls back in the window from an agreement made before the window.
+		testAgreement("d", "dev2", "myorg/pol", 100, 0, 0, 3990, ""),
+		testAgreement("e", "dev2", "myorg/pol", 4000, 0, 0, 0, ""),
+		// dev3 has a single agreement.
+		testAgreement("f", "dev3", "myorg/pol", 4100, 0, 0, 0, ""),
+		// dev4 agreements do not have a workload priority.
+		testAgreement("g", "dev4", "myorg/pol", 4200, 0, 0, 4250, ""),
+		testAgreement("h", "dev4", "myorg/pol", 4300, 0, 0, 0, ""),
+	}
+	for ix, pol := range []string{v1, v09, v1, v1, v09, v1, testPolicy(t, "svc2", "1.0", 0), testPolicy(t, "svc2", "1.0", 0)} {
+		ags[ix].Policy = pol
+	}
+
+	wus := []persistence.WorkloadUsage{
+		{DeviceId: "myorg/dev1", PolicyName: "myorg/pol", Policy: v1},
+		{DeviceId: "myorg/dev2", PolicyName: "myorg/pol", Policy: v09, RetryCount: 2},
+		{DeviceId: "myorg/dev5", PolicyName: "myorg/pol"},
+	}
+
+	q := Query{Start: 3600, End: 7199, IntervalS: 3600, GroupBy: GROUP_BY_POLICY}
+	s := ComputeAgreementStats(q, ags, wus)
+
+	expected := []ServiceRollbacks{
+		{Service: "myorg/svc1", Version: "0.9", Agreements: 2, Rollbacks: 0, RollbackRate: 0, WorkloadUsages: 1, Retries: 2},
+		{Service: "myorg/svc1", Version: "1.0", Agreements: 3, Rollbacks: 2, RollbackRate: 2.0 / 3.0, WorkloadUsages: 1, Retries: 0},
+		{Service: "myorg/svc2", Version: "1.0", Agreements: 2, Rollbacks: 0, RollbackRate: 0, WorkloadUsages: 0, Retries: 0},
+	}
+	if !reflect.DeepEqual(s.Services, expected) {
+		t.Errorf("expected service rollbacks %v, got %v", expected, s.Services)
+	}
+}
+
+func testAgreement(id string, device string, pol string, inception uint64, creation uint64, finalized uint64, terminated uint64, reason string) persistence.Agreement {
+	return persistence.Agreement{
+		CurrentAgreementId:     id,
+		Org:                    "myorg",
+		DeviceId:               "myorg/" + device,
+		PolicyName:             pol,
+		AgreementInceptionTime: inception,
+		AgreementCreationTime:  creation,
+		AgreementFinalizedTime: finalized,
+		AgreementTimedout:      terminated,
+		Archived:               terminated != 0,
+		TerminatedDescription:  reason,
+	}
+}
+
+func testPolicy(t *testing.T, url string, version string, priority int) string {
+	pol := policy.Policy{Workloads: []policy.Workload{{WorkloadURL: url, Org: "myorg", Version: version, Priority: policy.WorkloadPriority{PriorityValue: priority}}}}
+	b, err := json.Marshal(pol)
+	if err != nil {
+		t.Fatalf("unable to marshal policy, error: %v", err)
+	}
+	return string(b)
+}
@@ -87,6 +87,12 @@ func (a *API) router(includeStaticRedirects bool) *mux.Router {
 	router.HandleFunc("/status", a.status).Methods("GET", "OPTIONS")
 	router.HandleFunc("/status/workers", a.workerstatus).Methods("GET", "OPTIONS")
 
+	// Metrics in the Prometheus text format
+	router.HandleFunc("/metrics", a.metrics).Methods("GET", "OPTIONS")
+
+	// Reload the parts of the configuration that can be changed without a restart
+	router.HandleFunc("/config/reload", a.configreload).Methods("GET", "POST", "OPTIONS")
+
 	// Used by the Registration UI to obtain a random token string
 	router.HandleFunc("/token/random", tokenRandom).Methods("GET", "OPTIONS")
 
@@ -95,6 +101,11 @@ func (a *API) router(includeStaticRedirects bool) *mux.Router {
 	router.HandleFunc("/node/configstate", a.nodeconfigstate).Methods("GET", "HEAD", "PUT", "OPTIONS")
 	router.HandleFunc("/node/policy", a.nodepolicy).Methods("GET", "HEAD", "PUT", "POST", "PATCH", "DELETE", "OPTIONS")
 	router.HandleFunc("/node/userinput", a.nodeuserinput).Methods("GET", "HEAD", "PUT", "POST", "PATCH", "DELETE", "OPTIONS")
+	router.HandleFunc("/node/diagnostics", a.nodediagnostics).Methods("GET", "OPTIONS")
+	router.HandleFunc("/node/backup", a.nodebackup).Methods("GET", "OPTIONS")
+	router.HandleFunc("/node/restore", a.noderestore).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/node/dbcheck", a.nodedbcheck).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/node/messagekey", a.nodemessagekey).Methods("POST", "OPTIONS")
 
 	// Used to get the event logs on this node.
 	// get the eventlogs for current registration.
@@ -103,6 +114,11 @@ func (a *API) router(includeStaticRedirects bool) *mux.Router {
 	router.HandleFunc("/eventlog/all", a.eventlog).Methods("GET", "OPTIONS")
 	//get the active surface errors for this node
 	router.HandleFunc("/eventlog/surface", a.surface).Methods("GET", "OPTIONS")
+	// prune the eventlogs according to the retention policy.
+	router.HandleFunc("/eventlog/prune", a.eventlogprune).Methods("POST", "OPTIONS")
+
+	// Used to get the changes that the node made in the exchange.
+	router.HandleFunc("/audit", a.audit).Methods("GET", "OPTIONS")
 
 	// For importing workload public signing keys (RSA-PSS key pair public key)
 	router.HandleFunc("/{p:(?:publickey|trust)}", a.publickey).Methods("GET", "OPTIONS")
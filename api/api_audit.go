@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/i18n"
+	"net/http"
+)
+
+// Get the changes that the node made in the exchange.
+func (a *API) audit(w http.ResponseWriter, r *http.Request) {
+
+	resource := "audit"
+
+	errorHandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET":
+		lan := r.Header.Get("Accept-Language")
+		if lan == "" {
+			lan = i18n.DEFAULT_LANGUAGE
+		}
+		msgPrinter := i18n.GetMessagePrinterWithLocale(lan)
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v with selection %v. Language: %v", r.Method, resource, r.URL.Query(), lan)))
+
+		if errHandled, out := FindAuditRecordsForOutput(errorHandler, r.URL.Query(), msgPrinter); !errHandled {
+			writeResponse(w, out, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
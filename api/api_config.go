@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/worker"
+)
+
+func (a *API) configreload(w http.ResponseWriter, r *http.Request) {
+
+	resource := "config/reload"
+	errorhandler := GetHTTPErrorHandler(w)
+
+	reloader := worker.GetConfigReloader()
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		if reloader == nil {
+			errorhandler(NewServiceUnavailableError(fmt.Sprintf("The configuration cannot be reloaded by this agent.")))
+		} else {
+			writeResponse(w, reloader.Status(), http.StatusOK)
+		}
+
+	case "POST":
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		// Changes to fields that cannot be reloaded are reported in the result, they are not an error.
+		if reloader == nil {
+			errorhandler(NewServiceUnavailableError(fmt.Sprintf("The configuration cannot be reloaded by this agent.")))
+		} else if result := reloader.Reload(worker.RELOAD_SOURCE_API); result.Error != "" {
+			errorhandler(NewSystemError(fmt.Sprintf("Unable to reload the configuration, error %v", result.Error)))
+		} else {
+			writeResponse(w, result, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
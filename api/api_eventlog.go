@@ -1,9 +1,11 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/i18n"
+	"io/ioutil"
 	"net/http"
 	"strings"
 )
@@ -77,3 +79,39 @@ func (a *API) surface(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
+
+func (a *API) eventlogprune(w http.ResponseWriter, r *http.Request) {
+	resource := "eventlog/prune"
+	errorHandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "POST":
+		lan := r.Header.Get("Accept-Language")
+		if lan == "" {
+			lan = i18n.DEFAULT_LANGUAGE
+		}
+		msgPrinter := i18n.GetMessagePrinterWithLocale(lan)
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v. Language: %v", r.Method, resource, lan)))
+
+		// An empty body means that the configured retention policy is used.
+		var input EventLogPruneInput
+		body, _ := ioutil.ReadAll(r.Body)
+		if len(body) != 0 {
+			if err := json.Unmarshal(body, &input); err != nil {
+				errorHandler(NewAPIUserInputError(msgPrinter.Sprintf("Input body couldn't be deserialized to %v object: %v, error: %v", resource, string(body), err), "body"))
+				return
+			}
+		}
+
+		if errHandled, summary := PruneEventLogs(&input, errorHandler, a.db, a.Config, msgPrinter); !errHandled {
+			writeResponse(w, summary, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
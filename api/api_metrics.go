@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/metrics"
+)
+
+func (a *API) metrics(w http.ResponseWriter, r *http.Request) {
+
+	resource := "metrics"
+	errorhandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		// The agreement counts are read from the local database on each scrape.
+		if err := UpdateAgreementMetrics(a.db); err != nil {
+			errorhandler(NewSystemError(fmt.Sprintf("Error getting agreements for %v, error %v", resource, err)))
+		} else {
+			metrics.Handler(w, r)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -8,11 +8,13 @@ import (
 	"strconv"
 
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/apicommon"
 	"github.com/open-horizon/anax/eventlog"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/exchangesync"
 	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/version"
@@ -537,3 +539,227 @@ func (a *API) nodeuserinput(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
+
+func (a *API) nodediagnostics(w http.ResponseWriter, r *http.Request) {
+
+	resource := "node/diagnostics"
+
+	errorHandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET":
+		lan := r.Header.Get("Accept-Language")
+		if lan == "" {
+			lan = i18n.DEFAULT_LANGUAGE
+		}
+		msgPrinter := i18n.GetMessagePrinterWithLocale(lan)
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		getStatus := func() *apicommon.Info {
+			return apicommon.NewInfo(a.GetHTTPFactory(), a.GetExchangeURL(), a.GetCSSURL(), a.GetExchangeId(), a.GetExchangeToken())
+		}
+		getDevice := exchange.GetHTTPDeviceHandler(a)
+		getServicesConfigState := exchange.GetHTTPServicesConfigStateHandler(a)
+		getContainerLogs := GetContainerLogsHandler(a.Config.Edge.DockerEndpoint)
+
+		if bundle, err := CreateNodeDiagnostics(a.db, a.Config, getStatus, getDevice, getServicesConfigState, getContainerLogs, msgPrinter); err != nil {
+			errorHandler(NewSystemError(msgPrinter.Sprintf("Error creating %v, error %v", resource, err)))
+		} else {
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v\"", DIAG_BUNDLE_FILE_NAME))
+			w.Header().Set("Content-Length", strconv.Itoa(len(bundle)))
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(bundle); err != nil {
+				glog.Error(apiLogString(err))
+			}
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) nodebackup(w http.ResponseWriter, r *http.Request) {
+
+	resource := "node/backup"
+
+	errorHandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET":
+		lan := r.Header.Get("Accept-Language")
+		if lan == "" {
+			lan = i18n.DEFAULT_LANGUAGE
+		}
+		msgPrinter := i18n.GetMessagePrinterWithLocale(lan)
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		if backup, err := CreateNodeBackup(a.db, a.Config, msgPrinter); err != nil {
+			errorHandler(NewSystemError(msgPrinter.Sprintf("Error creating %v, error %v", resource, err)))
+		} else {
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v\"", BACKUP_FILE_NAME))
+			w.Header().Set("Content-Length", strconv.Itoa(len(backup)))
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write(backup); err != nil {
+				glog.Error(apiLogString(err))
+			}
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) noderestore(w http.ResponseWriter, r *http.Request) {
+
+	resource := "node/restore"
+
+	errorHandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "PUT":
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		restore_error_handler := func(err error) bool {
+			LogDeviceEvent(a.db, persistence.SEVERITY_ERROR, persistence.NewMessageMeta(EL_API_ERR_IN_NODE_RESTORE, err.Error()), persistence.EC_ERROR_NODE_RESTORE, nil)
+			return errorHandler(err)
+		}
+
+		backup, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_BACKUP_SIZE))
+		if err != nil {
+			restore_error_handler(NewAPIUserInputError(fmt.Sprintf("Unable to read the backup, it must not be larger than %v bytes, error: %v", MAX_BACKUP_SIZE, err), "backup"))
+			return
+		}
+
+		// Validate the backup and replace the local state with it.
+		errHandled, device, previous := RestoreNodeBackup(backup, restore_error_handler, exchange.GetHTTPDeviceHandler(a), a.db, a.Config)
+		if errHandled {
+			return
+		}
+
+		a.EC = worker.NewExchangeContext(fmt.Sprintf("%v/%v", device.Org, device.Id), device.Token, a.Config.Edge.ExchangeURL, a.Config.GetCSSURL(), a.Config.Collaborators.HTTPClientFactory)
+
+		// If this agent was not registered before, the workers have to pick up the restored registration the same way
+		// they would for a new registration. Otherwise the workers are still using the token that was replaced, so they
+		// are told that the node was registered again.
+		if previous == nil {
+			a.Messages() <- events.NewEdgeRegisteredExchangeMessage(events.NEW_DEVICE_REG, device.Id, device.Token, device.Org, device.Pattern, device.NodeType)
+			if device.IsState(persistence.CONFIGSTATE_CONFIGURED) {
+				a.Messages() <- events.NewEdgeConfigCompleteMessage(events.NEW_DEVICE_CONFIG_COMPLETE)
+			}
+		} else {
+			a.Messages() <- events.NewEdgeRegisteredExchangeMessage(events.DEVICE_REREGISTERED, device.Id, device.Token, device.Org, device.Pattern, device.NodeType)
+		}
+
+		// Get rid of any containers that do not belong to the restored agreements. Restored agreements whose containers
+		// are not running are handled by the governance worker's periodic container maintenance.
+		a.Messages() <- events.NewNodeStateRestoredMessage(events.NODE_STATE_RESTORED, device.Org, device.Id)
+
+		if out, err := FindHorizonDeviceForOutput(a.db); err != nil {
+			errorHandler(NewSystemError(fmt.Sprintf("Error getting %v for output, error %v", resource, err)))
+		} else {
+			writeResponse(w, out, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "PUT, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *API) nodedbcheck(w http.ResponseWriter, r *http.Request) {
+
+	resource := "node/dbcheck"
+
+	errorHandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "GET", "POST":
+		lan := r.Header.Get("Accept-Language")
+		if lan == "" {
+			lan = i18n.DEFAULT_LANGUAGE
+		}
+		msgPrinter := i18n.GetMessagePrinterWithLocale(lan)
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		// The containers of a cluster node are not managed by docker, and without docker they cannot be checked.
+		var containersMatching ContainersMatchingAgreementHandler
+		skipReason := ""
+		if pDevice, err := persistence.FindExchangeDevice(a.db); err != nil {
+			errorHandler(NewSystemError(msgPrinter.Sprintf("Unable to read node object, error %v", err)))
+			return
+		} else if pDevice != nil && pDevice.IsEdgeCluster() {
+			skipReason = msgPrinter.Sprintf("The node is an edge cluster.")
+		} else if handler, err := GetContainersMatchingAgreementHandler(a.Config, a.db); err != nil {
+			skipReason = msgPrinter.Sprintf("Unable to reach docker at %v, error %v", a.Config.Edge.DockerEndpoint, err)
+		} else {
+			containersMatching = handler
+		}
+
+		// A POST repairs what it finds, a GET only reports it.
+		errHandled, report, msgs := CheckNodeDatabase(r.Method == "POST", errorHandler, containersMatching, skipReason, a.db, msgPrinter)
+		if errHandled {
+			return
+		}
+
+		for _, msg := range msgs {
+			a.Messages() <- msg
+		}
+
+		writeResponse(w, report, http.StatusOK)
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Rotate the node's message key now, instead of waiting for the next scheduled rotation.
+func (a *API) nodemessagekey(w http.ResponseWriter, r *http.Request) {
+
+	resource := "node/messagekey"
+
+	errorHandler := GetHTTPErrorHandler(w)
+
+	switch r.Method {
+	case "POST":
+		lan := r.Header.Get("Accept-Language")
+		if lan == "" {
+			lan = i18n.DEFAULT_LANGUAGE
+		}
+		msgPrinter := i18n.GetMessagePrinterWithLocale(lan)
+
+		glog.V(5).Infof(apiLogString(fmt.Sprintf("Handling %v on resource %v", r.Method, resource)))
+
+		errHandled, msgs := RotateNodeMessageKey(errorHandler, a.db, msgPrinter)
+		if errHandled {
+			return
+		}
+
+		for _, msg := range msgs {
+			a.Messages() <- msg
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
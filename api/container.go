@@ -1,11 +1,14 @@
 package api
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	dockerclient "github.com/fsouza/go-dockerclient"
 	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/cutil"
+	"strconv"
+	"strings"
 )
 
 // Get docker container metadata from the docker API for workload containers
@@ -68,3 +71,49 @@ func GetMicroserviceContainer(dockerEndpoint string, mURL string, mOrg string, m
 		}
 	}
 }
+
+// Get the most recent log lines of all the containers started by the agent, keyed by container name.
+func GetContainerLogs(dockerEndpoint string, tailLines int) (map[string]string, error) {
+	if client, err := dockerclient.NewClient(dockerEndpoint); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to create docker client from %v, error %v", dockerEndpoint, err))
+	} else {
+		opts := dockerclient.ListContainersOptions{
+			All: true,
+		}
+
+		if containers, err := client.ListContainers(opts); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to list docker containers from %v, error %v", dockerEndpoint, err))
+		} else {
+			ret := make(map[string]string)
+
+			for _, c := range containers {
+				if _, exists := c.Labels[container.LABEL_PREFIX+".service_name"]; !exists {
+					continue
+				}
+
+				name := c.ID
+				if len(c.Names) != 0 {
+					name = strings.TrimPrefix(c.Names[0], "/")
+				}
+
+				var logBuffer bytes.Buffer
+				logOpts := dockerclient.LogsOptions{
+					Container:    c.ID,
+					OutputStream: &logBuffer,
+					ErrorStream:  &logBuffer,
+					Stdout:       true,
+					Stderr:       true,
+					Timestamps:   true,
+					Tail:         strconv.Itoa(tailLines),
+				}
+
+				if err := client.Logs(logOpts); err != nil {
+					ret[name] = fmt.Sprintf("unable to get logs for container %v, error %v", c.ID, err)
+				} else {
+					ret[name] = logBuffer.String()
+				}
+			}
+			return ret, nil
+		}
+	}
+}
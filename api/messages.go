@@ -25,6 +25,7 @@ const (
 	EL_API_ERR_IN_NODE_UI_UPDATE      = "Error in updating node user input. %v"
 	EL_API_ERR_IN_NODE_UI_PATCH       = "Error in patching node user input. %v"
 	EL_API_ERR_IN_NODE_UI_DEL         = "Error in deleting node userinput. %v"
+	EL_API_ERR_IN_NODE_RESTORE        = "Error in restoring the node from a backup. %v"
 
 	// from path_node.go
 	EL_API_START_NODE_REG       = "Start node configuration/registration for node %v."
@@ -42,6 +43,12 @@ const (
 	EL_API_ERR_READ_NODE_FROM_DB    = "Unable to read node object from database, error %v"
 	EL_API_ERR_SAVE_NODE_CONF_TO_DB = "Error saving new node config state (unconfiguring) in the database: %v"
 
+	// from path_node_backup.go
+	EL_API_NODE_STATE_RESTORED = "Node state restored for node %v from a backup taken at %v."
+
+	// from path_node_dbcheck.go
+	EL_API_NODE_DB_REPAIRED = "Repaired %v of the %v inconsistencies found in the node database."
+
 	// from path_node_configstate.go
 	EL_API_ERR_NODE_CONF_NOT_FOUND    = "Error in node configuration. The node is not found from the database."
 	EL_API_ERR_NODE_CONF_WRONG_STATE  = "Error in node configuration. The node must be in 'configured' or 'configuring' state in order to change the state to %v."
@@ -104,6 +111,7 @@ func MarkI18nMessages() {
 	msgPrinter.Sprintf(EL_API_ERR_IN_NODE_UI_UPDATE)
 	msgPrinter.Sprintf(EL_API_ERR_IN_NODE_UI_PATCH)
 	msgPrinter.Sprintf(EL_API_ERR_IN_NODE_UI_DEL)
+	msgPrinter.Sprintf(EL_API_ERR_IN_NODE_RESTORE)
 
 	// from path_node.go
 	msgPrinter.Sprintf(EL_API_START_NODE_REG)
@@ -121,6 +129,12 @@ func MarkI18nMessages() {
 	msgPrinter.Sprintf(EL_API_ERR_READ_NODE_FROM_DB)
 	msgPrinter.Sprintf(EL_API_ERR_SAVE_NODE_CONF_TO_DB)
 
+	// from path_node_backup.go
+	msgPrinter.Sprintf(EL_API_NODE_STATE_RESTORED)
+
+	// from path_node_dbcheck.go
+	msgPrinter.Sprintf(EL_API_NODE_DB_REPAIRED)
+
 	// from path_node_configstate.go
 	msgPrinter.Sprintf(EL_API_ERR_NODE_CONF_NOT_FOUND)
 	msgPrinter.Sprintf(EL_API_ERR_NODE_CONF_WRONG_STATE)
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"github.com/open-horizon/anax/auditlog"
+	"github.com/open-horizon/anax/exchange"
+	"golang.org/x/text/message"
+	"net/url"
+)
+
+// Return the records of the changes that the node made in the exchange, selected by the query parameters. The audit
+// log is only available when it is configured.
+func FindAuditRecordsForOutput(errorHandler ErrorHandler, query url.Values, msgPrinter *message.Printer) (bool, []auditlog.AuditRecord) {
+
+	auditLog := exchange.GetAuditLog()
+	if auditLog == nil {
+		return errorHandler(NewServiceUnavailableError(msgPrinter.Sprintf("The audit log is not configured."))), nil
+	}
+
+	filter, err := auditlog.ParseFilter(query)
+	if err != nil {
+		return errorHandler(NewBadRequestError(msgPrinter.Sprintf("Error parsing the selections %v, error %v", query, err))), nil
+	}
+
+	if records, err := auditLog.Query(filter); err != nil {
+		return errorHandler(NewSystemError(msgPrinter.Sprintf("Unable to read the audit log, error %v", err))), nil
+	} else {
+		return false, records
+	}
+}
@@ -0,0 +1,60 @@
+// +build unit
+
+package api
+
+import (
+	"github.com/open-horizon/anax/auditlog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"golang.org/x/text/message"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// Verify that the audit records are selected by the query parameters, and that an error is returned when the audit log
+// is not configured.
+func Test_FindAuditRecordsForOutput(t *testing.T) {
+
+	var myError error
+	errorhandler := GetPassThroughErrorHandler(&myError)
+	msgPrinter := message.NewPrinter(message.MatchLanguage("en"))
+
+	if errHandled, _ := FindAuditRecordsForOutput(errorhandler, url.Values{}, msgPrinter); !errHandled {
+		t.Errorf("expected an error when the audit log is not configured")
+	} else if _, ok := myError.(*ServiceUnavailableError); !ok {
+		t.Errorf("wrong error type %T", myError)
+	}
+
+	dir, err := ioutil.TempDir("", "apiaudit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.AuditLogConfig{Path: dir}.WithDefaults()
+	a, err := auditlog.NewAuditLog(&cfg)
+	if err != nil {
+		t.Fatalf("unable to create audit log, error: %v", err)
+	}
+	defer a.Close()
+	exchange.SetAuditLog(a)
+	defer exchange.SetAuditLog(nil)
+
+	a.Record(auditlog.AuditRecord{Method: "PUT", Path: "/v1/orgs/myorg/nodes/n1/policy", Identity: "myorg/n1", Code: 201})
+	a.Record(auditlog.AuditRecord{Method: "DELETE", Path: "/v1/orgs/myorg/nodes/n1/agreements/ag1", Identity: "myorg/n1", Code: 204})
+
+	myError = nil
+	if errHandled, out := FindAuditRecordsForOutput(errorhandler, url.Values{"method": {"DELETE"}}, msgPrinter); errHandled {
+		t.Errorf("unexpected error %v", myError)
+	} else if len(out) != 1 || out[0].Code != 204 {
+		t.Errorf("wrong records %v", out)
+	}
+
+	if errHandled, _ := FindAuditRecordsForOutput(errorhandler, url.Values{"limit": {"x"}}, msgPrinter); !errHandled {
+		t.Errorf("expected an error for a bad limit")
+	} else if _, ok := myError.(*BadRequestError); !ok {
+		t.Errorf("wrong error type %T", myError)
+	}
+}
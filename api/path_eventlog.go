@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/eventlog"
 	"github.com/open-horizon/anax/persistence"
 	"golang.org/x/text/message"
@@ -45,3 +46,71 @@ func FindSurfaceLogsForOutput(db *bolt.DB, msgPrinter *message.Printer) ([]persi
 	}
 	return outputLogs, nil
 }
+
+// The input for a manual prune of the event log. Fields that are not set are taken from the configured retention
+// policy.
+type EventLogPruneInput struct {
+	MaxAgeH         *int           `json:"max_age_hours,omitempty"`
+	SeverityMaxAgeH map[string]int `json:"severity_max_age_hours,omitempty"`
+	MaxCount        *int           `json:"max_count,omitempty"`
+}
+
+func (e EventLogPruneInput) String() string {
+	maxAge := "unset"
+	if e.MaxAgeH != nil {
+		maxAge = fmt.Sprintf("%v", *e.MaxAgeH)
+	}
+	maxCount := "unset"
+	if e.MaxCount != nil {
+		maxCount = fmt.Sprintf("%v", *e.MaxCount)
+	}
+	return fmt.Sprintf("MaxAgeH: %v, SeverityMaxAgeH: %v, MaxCount: %v", maxAge, e.SeverityMaxAgeH, maxCount)
+}
+
+// Validate the prune input, combine it with the configured retention policy and prune the event log.
+func PruneEventLogs(input *EventLogPruneInput,
+	errorhandler ErrorHandler,
+	db *bolt.DB,
+	cfg *config.HorizonConfig,
+	msgPrinter *message.Printer) (bool, *persistence.EventLogPruneSummary) {
+
+	retention := cfg.Edge.EventLogRetention
+
+	if input.MaxAgeH != nil {
+		if *input.MaxAgeH < 0 {
+			return errorhandler(NewAPIUserInputError(msgPrinter.Sprintf("The maximum age cannot be negative."), "max_age_hours")), nil
+		}
+		retention.MaxAgeH = *input.MaxAgeH
+	}
+	if input.MaxCount != nil {
+		if *input.MaxCount < 0 {
+			return errorhandler(NewAPIUserInputError(msgPrinter.Sprintf("The maximum count cannot be negative."), "max_count")), nil
+		}
+		retention.MaxCount = *input.MaxCount
+	}
+	if input.SeverityMaxAgeH != nil {
+		for severity, age := range input.SeverityMaxAgeH {
+			switch severity {
+			case persistence.SEVERITY_INFO, persistence.SEVERITY_WARN, persistence.SEVERITY_ERROR, persistence.SEVERITY_FATAL:
+			default:
+				return errorhandler(NewAPIUserInputError(msgPrinter.Sprintf("%v is not a valid severity.", severity), "severity_max_age_hours")), nil
+			}
+			if age < 0 {
+				return errorhandler(NewAPIUserInputError(msgPrinter.Sprintf("The maximum age cannot be negative."), "severity_max_age_hours")), nil
+			}
+		}
+		retention.SeverityMaxAgeH = input.SeverityMaxAgeH
+	}
+
+	if !retention.IsEnabled() {
+		return errorhandler(NewAPIUserInputError(msgPrinter.Sprintf("No retention limits are configured or specified."), "eventlog")), nil
+	}
+
+	glog.V(5).Infof(apiLogString(fmt.Sprintf("Pruning the event log with retention policy %v", retention.String())))
+
+	if summary, err := eventlog.PruneEventLogs(db, eventlog.GetPruneCriteria(&retention)); err != nil {
+		return errorhandler(NewSystemError(msgPrinter.Sprintf("Unable to prune the event log, error %v", err))), nil
+	} else {
+		return false, summary
+	}
+}
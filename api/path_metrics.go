@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/open-horizon/anax/metrics"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+var nodeAgreements = metrics.NewGaugeVec("anax_agreements", "The number of agreements on the node, by protocol and state.", "protocol", "state")
+
+// The state of an agreement as it is reported in the metrics.
+func agreementState(ag *persistence.EstablishedAgreement) string {
+	if ag.Archived {
+		return "archived"
+	} else if ag.AgreementTerminatedTime != 0 {
+		return "terminating"
+	} else if ag.AgreementExecutionStartTime != 0 {
+		return "executing"
+	} else if ag.AgreementFinalizedTime != 0 {
+		return "finalized"
+	} else if ag.AgreementAcceptedTime != 0 {
+		return "accepted"
+	}
+	return "proposed"
+}
+
+// Refresh the agreement counts in the metrics from the local database.
+func UpdateAgreementMetrics(db *bolt.DB) error {
+
+	agreements, err := persistence.FindEstablishedAgreementsAllProtocols(db, policy.AllAgreementProtocols(), []persistence.EAFilter{})
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to read agreement objects, error %v", err))
+	}
+
+	counts := make(map[string]map[string]int)
+	for _, ag := range agreements {
+		if _, ok := counts[ag.AgreementProtocol]; !ok {
+			counts[ag.AgreementProtocol] = make(map[string]int)
+		}
+		counts[ag.AgreementProtocol][agreementState(&ag)] += 1
+	}
+
+	nodeAgreements.Reset()
+	for protocol, states := range counts {
+		for state, count := range states {
+			nodeAgreements.Set(float64(count), protocol, state)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// +build unit
+
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/open-horizon/anax/persistence"
+)
+
+func Test_metrics_scrape(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	createRunningAgreement(t, db, "ag1")
+	createRunningAgreement(t, db, "ag2")
+	createRunningAgreement(t, db, "ag3")
+	if _, err := persistence.AgreementStateTerminated(db, "ag3", 1, "test", "Basic"); err != nil {
+		t.Fatalf("failed to terminate agreement, error %v", err)
+	}
+	if _, err := persistence.NewEstablishedAgreement(db, "agreementName", "ag4", "consumer1", "{}", "Basic", 1, persistence.ServiceSpecs{}, "signature", "myorg/agbot1", "", "", "", &persistence.WorkloadInfo{URL: "myservice", Org: "myorg"}); err != nil {
+		t.Fatalf("failed to create agreement, error %v", err)
+	}
+
+	a := &API{db: db}
+	server := httptest.NewServer(a.router(false))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("unable to scrape metrics, error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unable to read metrics, error: %v", err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %v: %v", resp.StatusCode, string(body))
+	}
+
+	for _, expected := range []string{
+		"# TYPE anax_agreements gauge\n",
+		"anax_agreements{protocol=\"Basic\",state=\"executing\"} 2\n",
+		"anax_agreements{protocol=\"Basic\",state=\"terminating\"} 1\n",
+		"anax_agreements{protocol=\"Basic\",state=\"proposed\"} 1\n",
+		"# TYPE anax_worker_command_duration_seconds histogram\n",
+		"# TYPE anax_exchange_requests_total counter\n",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected %v in the metrics, got:\n%v", expected, string(body))
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/version"
+	"golang.org/x/text/message"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// The files in the node backup.
+const BACKUP_MANIFEST = "manifest.json"
+const BACKUP_DATABASE = "anax.db"
+
+// The default name of the node backup file.
+const BACKUP_FILE_NAME = "node_backup.tar.gz"
+
+// The largest backup that can be restored, in bytes.
+const MAX_BACKUP_SIZE = 256 * 1024 * 1024
+
+// The manifest identifies the node and the Exchange that the backed up database belongs to. It is used to verify
+// that a backup is restored onto the right node.
+type NodeBackupManifest struct {
+	CreationTime  uint64 `json:"creation_time"`
+	NodeId        string `json:"node_id"`
+	NodeOrg       string `json:"node_org"`
+	ExchangeURL   string `json:"exchange_url"`
+	AgentVersion  string `json:"agent_version"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+func (n NodeBackupManifest) String() string {
+	return fmt.Sprintf("CreationTime: %v, NodeId: %v, NodeOrg: %v, ExchangeURL: %v, AgentVersion: %v, SchemaVersion: %v",
+		n.CreationTime, n.NodeId, n.NodeOrg, n.ExchangeURL, n.AgentVersion, n.SchemaVersion)
+}
+
+// Take a consistent snapshot of the node's database while the agent is running and return it, together with its
+// manifest, as a gzipped tar file.
+func CreateNodeBackup(db *bolt.DB, cfg *config.HorizonConfig, msgPrinter *message.Printer) ([]byte, error) {
+
+	manifest := NodeBackupManifest{
+		CreationTime: uint64(time.Now().Unix()),
+		ExchangeURL:  cfg.Edge.ExchangeURL,
+		AgentVersion: version.HORIZON_VERSION,
+	}
+
+	if pDevice, err := persistence.FindExchangeDevice(db); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to read node object, error %v", err))
+	} else if pDevice == nil {
+		return nil, errors.New(msgPrinter.Sprintf("the node is not registered"))
+	} else {
+		manifest.NodeId = pDevice.Id
+		manifest.NodeOrg = pDevice.Org
+	}
+
+	if schemaVersion, err := persistence.GetSchemaVersion(db); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to read the database schema version, error %v", err))
+	} else {
+		manifest.SchemaVersion = schemaVersion
+	}
+
+	var dbBuf bytes.Buffer
+	if _, err := persistence.BackupDatabase(db, &dbBuf); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to copy the database, error %v", err))
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to serialize %v, error %v", BACKUP_MANIFEST, err))
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{{BACKUP_MANIFEST, manifestBytes}, {BACKUP_DATABASE, dbBuf.Bytes()}} {
+		hdr := &tar.Header{
+			Name:    f.name,
+			Mode:    0600,
+			Size:    int64(len(f.content)),
+			ModTime: time.Unix(int64(manifest.CreationTime), 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, errors.New(msgPrinter.Sprintf("unable to write %v to the backup, error %v", f.name, err))
+		} else if _, err := tw.Write(f.content); err != nil {
+			return nil, errors.New(msgPrinter.Sprintf("unable to write %v to the backup, error %v", f.name, err))
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to close the backup, error %v", err))
+	} else if err := gw.Close(); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to compress the backup, error %v", err))
+	}
+
+	glog.V(3).Infof(apiLogString(fmt.Sprintf("Created node backup: %v", manifest)))
+
+	return buf.Bytes(), nil
+}
+
+// Unpack a node backup into its manifest and database content.
+func readNodeBackup(backup []byte) (*NodeBackupManifest, []byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(backup))
+	if err != nil {
+		return nil, nil, fmt.Errorf("the backup is not a gzipped file, error %v", err)
+	}
+
+	var manifest *NodeBackupManifest
+	var dbContent []byte
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("the backup is not a tar file, error %v", err)
+		}
+
+		switch hdr.Name {
+		case BACKUP_MANIFEST:
+			manifest = new(NodeBackupManifest)
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, nil, fmt.Errorf("unable to read %v from the backup, error %v", BACKUP_MANIFEST, err)
+			}
+		case BACKUP_DATABASE:
+			if dbContent, err = ioutil.ReadAll(tr); err != nil {
+				return nil, nil, fmt.Errorf("unable to read %v from the backup, error %v", BACKUP_DATABASE, err)
+			}
+		}
+	}
+
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("the backup does not contain %v", BACKUP_MANIFEST)
+	} else if dbContent == nil {
+		return nil, nil, fmt.Errorf("the backup does not contain %v", BACKUP_DATABASE)
+	}
+	return manifest, dbContent, nil
+}
+
+// Replace the node's local state with the content of a backup. The backup must have been taken from the node that
+// is registered with this agent, or from any node if this agent is not registered yet, and it must belong to the same
+// Exchange. The node in the backup is verified with the Exchange before anything is replaced. The restored node and
+// the node that was registered before the restore (if any) are returned.
+func RestoreNodeBackup(backup []byte,
+	errorhandler ErrorHandler,
+	getDevice exchange.DeviceHandler,
+	db *bolt.DB,
+	cfg *config.HorizonConfig) (bool, *persistence.ExchangeDevice, *persistence.ExchangeDevice) {
+
+	manifest, dbContent, err := readNodeBackup(backup)
+	if err != nil {
+		return errorhandler(NewAPIUserInputError(err.Error(), "backup")), nil, nil
+	}
+
+	glog.V(3).Infof(apiLogString(fmt.Sprintf("Restoring node backup: %v", manifest)))
+
+	if strings.TrimSuffix(manifest.ExchangeURL, "/") != strings.TrimSuffix(cfg.Edge.ExchangeURL, "/") {
+		return errorhandler(NewAPIUserInputError(fmt.Sprintf("the backup was taken from a node using Exchange %v, this node is using Exchange %v", manifest.ExchangeURL, cfg.Edge.ExchangeURL), "backup.exchange_url")), nil, nil
+	}
+
+	// A registered node can only be restored from one of its own backups.
+	pDevice, err := persistence.FindExchangeDevice(db)
+	if err != nil {
+		return errorhandler(NewSystemError(fmt.Sprintf("Unable to read node object, error %v", err))), nil, nil
+	} else if pDevice != nil {
+		if pDevice.Id != manifest.NodeId || pDevice.Org != manifest.NodeOrg {
+			return errorhandler(NewAPIUserInputError(fmt.Sprintf("the backup was taken from node %v/%v, this node is registered as %v/%v", manifest.NodeOrg, manifest.NodeId, pDevice.Org, pDevice.Id), "backup.node_id")), nil, nil
+		} else if pDevice.IsState(persistence.CONFIGSTATE_UNCONFIGURING) || pDevice.IsState(persistence.CONFIGSTATE_UNCONFIGURED) {
+			return errorhandler(NewBadRequestError(fmt.Sprintf("INVALID_NODE_STATE. The node cannot be restored while it is being unconfigured."))), nil, nil
+		}
+	}
+
+	// Open the backed up database next to the node's database, and bring it up to the current schema.
+	tmpDir, err := ioutil.TempDir(cfg.Edge.DBPath, "restore")
+	if err != nil {
+		return errorhandler(NewSystemError(fmt.Sprintf("Unable to create a directory for the backup, error %v", err))), nil, nil
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshotFile := fmt.Sprintf("%v/%v", tmpDir, BACKUP_DATABASE)
+	if err := ioutil.WriteFile(snapshotFile, dbContent, 0600); err != nil {
+		return errorhandler(NewSystemError(fmt.Sprintf("Unable to write the backup to %v, error %v", snapshotFile, err))), nil, nil
+	}
+
+	snapshot, err := bolt.Open(snapshotFile, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return errorhandler(NewAPIUserInputError(fmt.Sprintf("unable to open the database in the backup, error %v", err), "backup")), nil, nil
+	}
+	defer snapshot.Close()
+
+	if _, err := persistence.MigrateSchema(snapshot, tmpDir); err != nil {
+		return errorhandler(NewAPIUserInputError(fmt.Sprintf("unable to upgrade the database in the backup, error %v", err), "backup")), nil, nil
+	}
+
+	// The node in the database, not the manifest, is what gets restored, so it is the one that has to be verified.
+	rDevice, err := persistence.FindExchangeDevice(snapshot)
+	if err != nil {
+		return errorhandler(NewAPIUserInputError(fmt.Sprintf("unable to read the node object in the backup, error %v", err), "backup")), nil, nil
+	} else if rDevice == nil {
+		return errorhandler(NewAPIUserInputError("the backup does not contain a registered node", "backup")), nil, nil
+	} else if rDevice.Id != manifest.NodeId || rDevice.Org != manifest.NodeOrg {
+		return errorhandler(NewAPIUserInputError(fmt.Sprintf("the backup contains node %v/%v but its manifest is for node %v/%v", rDevice.Org, rDevice.Id, manifest.NodeOrg, manifest.NodeId), "backup.node_id")), nil, nil
+	}
+
+	if _, err := getDevice(fmt.Sprintf("%v/%v", rDevice.Org, rDevice.Id), rDevice.Token); err != nil {
+		return errorhandler(NewAPIUserInputError(fmt.Sprintf("unable to verify node %v/%v from the backup with the Exchange %v, error %v", rDevice.Org, rDevice.Id, cfg.Edge.ExchangeURL, err), "backup.node_id")), nil, nil
+	}
+
+	if err := persistence.RestoreDatabase(db, snapshot); err != nil {
+		return errorhandler(NewSystemError(fmt.Sprintf("Unable to restore the database from the backup, error %v", err))), nil, nil
+	}
+
+	LogDeviceEvent(db, persistence.SEVERITY_INFO, persistence.NewMessageMeta(EL_API_NODE_STATE_RESTORED, rDevice.Id, time.Unix(int64(manifest.CreationTime), 0).String()),
+		persistence.EC_NODE_STATE_RESTORED, rDevice)
+
+	return false, rDevice, pDevice
+}
@@ -0,0 +1,143 @@
+// +build unit
+
+package api
+
+import (
+	"errors"
+	"github.com/boltdb/bolt"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/persistence"
+	"testing"
+)
+
+// Create a registered node with an agreement and take a backup of it.
+func getNodeBackup(t *testing.T, db *bolt.DB, cfg *config.HorizonConfig) []byte {
+	if _, err := persistence.SaveNewExchangeDevice(db, "testid", "testtoken", "testname", "device", false, "myorg", "apattern", persistence.CONFIGSTATE_CONFIGURED); err != nil {
+		t.Fatalf("failed to create persisted device, error %v", err)
+	}
+	if _, err := persistence.NewEstablishedAgreement(db, "agreementName", "agreementid1", "consumer1", "{}", "Basic", 1, persistence.ServiceSpecs{}, "signature", "myorg/agbot1", "", "", "", &persistence.WorkloadInfo{}); err != nil {
+		t.Fatalf("failed to create agreement, error %v", err)
+	}
+
+	backup, err := CreateNodeBackup(db, cfg, i18n.GetMessagePrinterWithLocale("en"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return backup
+}
+
+func getBackupConfig(exchangeURL string, dbPath string) *config.HorizonConfig {
+	cfg := getBasicConfig()
+	cfg.Edge.ExchangeURL = exchangeURL
+	cfg.Edge.DBPath = dbPath
+	return cfg
+}
+
+func getVerifyingDeviceHandler() exchange.DeviceHandler {
+	return func(id string, token string) (*exchange.Device, error) {
+		if id != "myorg/testid" || token != "testtoken" {
+			return nil, errors.New("unauthorized")
+		}
+		return &exchange.Device{Name: "testname"}, nil
+	}
+}
+
+// A backup restored onto a new agent replaces its state.
+func Test_RestoreNodeBackup_new_agent(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	backup := getNodeBackup(t, db, getBackupConfig("http://exchange/v1/", dir))
+
+	newDir, newDB, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(newDir)
+
+	// The trailing slash of the exchange URL does not matter.
+	newCfg := getBackupConfig("http://exchange/v1", newDir)
+
+	var myError error
+	errHandled, device, previous := RestoreNodeBackup(backup, GetPassThroughErrorHandler(&myError), getVerifyingDeviceHandler(), newDB, newCfg)
+	if errHandled {
+		t.Fatalf("unexpected error %v", myError)
+	} else if device == nil || device.Id != "testid" || device.Token != "testtoken" {
+		t.Errorf("wrong restored device %v", device)
+	} else if previous != nil {
+		t.Errorf("there should not be a previous device, is %v", previous)
+	}
+
+	if ags, err := persistence.FindEstablishedAgreementsAllProtocols(newDB, []string{"Basic"}, []persistence.EAFilter{}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if len(ags) != 1 || ags[0].CurrentAgreementId != "agreementid1" {
+		t.Errorf("agreements were not restored: %v", ags)
+	}
+
+	if version, err := persistence.GetSchemaVersion(newDB); err != nil || version != persistence.GetLatestSchemaVersion() {
+		t.Errorf("restored database should be at schema version %v, is at %v, error %v", persistence.GetLatestSchemaVersion(), version, err)
+	}
+}
+
+// A backup is only restored onto the node it was taken from, using the same Exchange.
+func Test_RestoreNodeBackup_validation(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	backup := getNodeBackup(t, db, getBackupConfig("http://exchange/v1", dir))
+
+	newDir, newDB, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(newDir)
+
+	newCfg := getBackupConfig("http://exchange/v1", newDir)
+
+	var myError error
+	errorhandler := GetPassThroughErrorHandler(&myError)
+
+	// Not a backup.
+	if errHandled, _, _ := RestoreNodeBackup([]byte("not a backup"), errorhandler, getVerifyingDeviceHandler(), newDB, newCfg); !errHandled {
+		t.Errorf("garbage should be rejected")
+	} else if _, ok := myError.(*APIUserInputError); !ok {
+		t.Errorf("wrong error type %T", myError)
+	}
+
+	// Different exchange.
+	otherCfg := getBackupConfig("http://otherexchange/v1", newDir)
+	if errHandled, _, _ := RestoreNodeBackup(backup, errorhandler, getVerifyingDeviceHandler(), newDB, otherCfg); !errHandled {
+		t.Errorf("a backup from another exchange should be rejected")
+	}
+
+	// The node is not known to the exchange.
+	notFound := func(id string, token string) (*exchange.Device, error) {
+		return nil, errors.New("not found")
+	}
+	if errHandled, _, _ := RestoreNodeBackup(backup, errorhandler, notFound, newDB, newCfg); !errHandled {
+		t.Errorf("a node that cannot be verified should be rejected")
+	}
+
+	// This agent is registered as a different node.
+	if _, err := persistence.SaveNewExchangeDevice(newDB, "otherid", "othertoken", "othername", "device", false, "myorg", "apattern", persistence.CONFIGSTATE_CONFIGURED); err != nil {
+		t.Fatalf("failed to create persisted device, error %v", err)
+	}
+	if errHandled, _, _ := RestoreNodeBackup(backup, errorhandler, getVerifyingDeviceHandler(), newDB, newCfg); !errHandled {
+		t.Errorf("a backup of another node should be rejected")
+	}
+
+	// Nothing was replaced by the failed restores.
+	if dev, err := persistence.FindExchangeDevice(newDB); err != nil || dev == nil || dev.Id != "otherid" {
+		t.Errorf("the node should not have been replaced, node %v, error %v", dev, err)
+	}
+}
@@ -0,0 +1,399 @@
+package api
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/container"
+	"github.com/open-horizon/anax/eventlog"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"golang.org/x/text/message"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The kinds of inconsistencies found in the node's database.
+const DBCHECK_DANGLING_AGREEMENT = "service_instance_dangling_agreement"      // a service instance refers to agreements that are archived or gone
+const DBCHECK_ORPHANED_INSTANCE = "orphaned_service_instance"                 // a service instance whose agreements are all archived or gone
+const DBCHECK_MISSING_DEFINITION = "service_instance_missing_definition"      // a service instance refers to a service definition that is gone
+const DBCHECK_DEPLOYMENT_WITHOUT_CONTAINERS = "deployment_without_containers" // a running agreement or service instance has no containers
+const DBCHECK_ORPHANED_CONTAINER = "orphaned_container"                       // a container belongs to an archived agreement or service instance
+const DBCHECK_ORPHANED_ATTRIBUTE = "orphaned_attribute"                       // an attribute is scoped to services that are not registered or in an agreement
+const DBCHECK_STALE_NODE_STATUS = "stale_node_status"                         // the saved node status refers to an agreement that is not running, or a service that is not registered
+
+// Calls fn for each container that belongs to one of the agreements or service instances.
+type ContainersMatchingAgreementHandler func(agreements []string, includeShared bool, fn func(*dockerclient.APIContainers, string) error) error
+
+func GetContainersMatchingAgreementHandler(cfg *config.HorizonConfig, db *bolt.DB) (ContainersMatchingAgreementHandler, error) {
+	if cw, err := container.CreateQueryContainerWorker(cfg, db); err != nil {
+		return nil, err
+	} else {
+		return cw.ContainersMatchingAgreement, nil
+	}
+}
+
+type NodeDBCheckIssue struct {
+	Type        string `json:"type"`
+	Resource    string `json:"resource"`
+	Description string `json:"description"`
+	Repairable  bool   `json:"repairable"`
+	Repaired    bool   `json:"repaired"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+func (n NodeDBCheckIssue) String() string {
+	return fmt.Sprintf("Type: %v, Resource: %v, Description: %v, Repairable: %v, Repaired: %v, RepairError: %v",
+		n.Type, n.Resource, n.Description, n.Repairable, n.Repaired, n.RepairError)
+}
+
+type NodeDBCheckReport struct {
+	CheckTime      uint64             `json:"check_time"`
+	Repair         bool               `json:"repair"`
+	Checked        map[string]int     `json:"checked"`                           // the number of records checked, by kind
+	ContainerCheck string             `json:"container_check_skipped,omitempty"` // the reason the containers were not checked
+	Issues         []NodeDBCheckIssue `json:"issues"`
+}
+
+func (n NodeDBCheckReport) String() string {
+	return fmt.Sprintf("CheckTime: %v, Repair: %v, Checked: %v, ContainerCheck: %v, Issues: %v",
+		n.CheckTime, n.Repair, n.Checked, n.ContainerCheck, n.Issues)
+}
+
+// Returns the number of issues found and the number of issues repaired.
+func (n NodeDBCheckReport) Counts() (int, int) {
+	repaired := 0
+	for _, issue := range n.Issues {
+		if issue.Repaired {
+			repaired++
+		}
+	}
+	return len(n.Issues), repaired
+}
+
+func (n *NodeDBCheckReport) addIssue(issueType string, resource string, description string, repairable bool) *NodeDBCheckIssue {
+	n.Issues = append(n.Issues, NodeDBCheckIssue{
+		Type:        issueType,
+		Resource:    resource,
+		Description: description,
+		Repairable:  repairable,
+	})
+	return &n.Issues[len(n.Issues)-1]
+}
+
+// Record the result of a repair on an issue.
+func (n *NodeDBCheckIssue) repaired(err error) {
+	if err != nil {
+		n.RepairError = err.Error()
+	} else {
+		n.Repaired = true
+	}
+}
+
+// Cross check the agreements, service definitions, service instances, attributes, node status and containers of the
+// node and report the inconsistencies between them. If repair is true, the inconsistencies that can be fixed without
+// disrupting running workloads are fixed. Containers are removed by the container worker, so the messages that must
+// be sent to the workers to complete the repair are returned. If the containers cannot be looked up, the
+// containersMatching handler is nil and skipReason says why.
+func CheckNodeDatabase(repair bool,
+	errorhandler ErrorHandler,
+	containersMatching ContainersMatchingAgreementHandler,
+	skipReason string,
+	db *bolt.DB,
+	msgPrinter *message.Printer) (bool, *NodeDBCheckReport, []events.Message) {
+
+	report := &NodeDBCheckReport{
+		CheckTime:      uint64(time.Now().Unix()),
+		Repair:         repair,
+		Checked:        make(map[string]int),
+		ContainerCheck: skipReason,
+		Issues:         make([]NodeDBCheckIssue, 0),
+	}
+	msgs := make([]events.Message, 0)
+
+	// Read everything that is cross checked up front.
+	agreements, err := persistence.FindEstablishedAgreementsAllProtocols(db, policy.AllAgreementProtocols(), []persistence.EAFilter{})
+	if err != nil {
+		return errorhandler(NewSystemError(msgPrinter.Sprintf("Unable to read agreements, error %v", err))), nil, nil
+	}
+	msdefs, err := persistence.FindMicroserviceDefs(db, []persistence.MSFilter{persistence.AllMSFilter()})
+	if err != nil {
+		return errorhandler(NewSystemError(msgPrinter.Sprintf("Unable to read service definitions, error %v", err))), nil, nil
+	}
+	msinsts, err := persistence.FindMicroserviceInstances(db, []persistence.MIFilter{persistence.AllMIFilter()})
+	if err != nil {
+		return errorhandler(NewSystemError(msgPrinter.Sprintf("Unable to read service instances, error %v", err))), nil, nil
+	}
+	attributes, err := persistence.FindApplicableAttributes(db, "", "")
+	if err != nil {
+		return errorhandler(NewSystemError(msgPrinter.Sprintf("Unable to read attributes, error %v", err))), nil, nil
+	}
+	nodeStatus, err := persistence.FindNodeStatus(db)
+	if err != nil {
+		return errorhandler(NewSystemError(msgPrinter.Sprintf("Unable to read node status, error %v", err))), nil, nil
+	}
+
+	report.Checked["agreements"] = len(agreements)
+	report.Checked["service_definitions"] = len(msdefs)
+	report.Checked["service_instances"] = len(msinsts)
+	report.Checked["attributes"] = len(attributes)
+	report.Checked["node_status"] = len(nodeStatus)
+
+	// Agreements that are terminating are being cleaned up by the governance worker, so they are neither running nor
+	// orphaned.
+	unarchivedAgs := make(map[string]persistence.EstablishedAgreement)
+	runningAgs := make(map[string]persistence.EstablishedAgreement)
+	archivedAgs := make(map[string]persistence.EstablishedAgreement)
+	for _, ag := range agreements {
+		if ag.Archived {
+			archivedAgs[ag.CurrentAgreementId] = ag
+			continue
+		}
+		unarchivedAgs[ag.CurrentAgreementId] = ag
+		if ag.AgreementTerminatedTime == 0 {
+			runningAgs[ag.CurrentAgreementId] = ag
+		}
+	}
+
+	msdefsById := make(map[string]persistence.MicroserviceDefinition)
+	for _, msdef := range msdefs {
+		msdefsById[msdef.Id] = msdef
+	}
+
+	// Find the containers of all the agreements and service instances.
+	containers := make(map[string][]string)
+	if containersMatching != nil {
+		keys := make([]string, 0, len(agreements)+len(msinsts))
+		for _, ag := range agreements {
+			keys = append(keys, ag.CurrentAgreementId)
+		}
+		for _, msi := range msinsts {
+			keys = append(keys, msi.GetKey())
+		}
+
+		count := 0
+		if err := containersMatching(keys, false, func(c *dockerclient.APIContainers, key string) error {
+			name := c.ID
+			if len(c.Names) != 0 {
+				name = strings.TrimPrefix(c.Names[0], "/")
+			}
+			containers[key] = append(containers[key], name)
+			count++
+			return nil
+		}); err != nil {
+			return errorhandler(NewSystemError(msgPrinter.Sprintf("Unable to list the containers, error %v", err))), nil, nil
+		}
+		report.Checked["containers"] = count
+	}
+
+	// Check the service instances against the agreements and the service definitions.
+	for _, msi := range msinsts {
+		if msi.Archived || msi.CleanupStartTime != 0 {
+			continue
+		}
+		key := msi.GetKey()
+
+		msdef, msdefFound := msdefsById[msi.MicroserviceDefId]
+		if !msdefFound {
+			report.addIssue(DBCHECK_MISSING_DEFINITION, key,
+				msgPrinter.Sprintf("The service instance refers to service definition %v, which is not in the database.", msi.MicroserviceDefId), false)
+		}
+
+		if msi.AgreementLess || len(msi.AssociatedAgreements) == 0 {
+			continue
+		}
+
+		dangling := make([]string, 0)
+		for _, agId := range msi.AssociatedAgreements {
+			if _, ok := unarchivedAgs[agId]; !ok {
+				dangling = append(dangling, agId)
+			}
+		}
+
+		if len(dangling) == 0 {
+			continue
+		} else if len(dangling) < len(msi.AssociatedAgreements) {
+			issue := report.addIssue(DBCHECK_DANGLING_AGREEMENT, key,
+				msgPrinter.Sprintf("The service instance refers to agreements %v, which are archived or not in the database.", dangling), true)
+			if repair {
+				var repairErr error
+				for _, agId := range dangling {
+					if _, err := persistence.UpdateMSInstanceAssociatedAgreements(db, key, false, agId); err != nil {
+						repairErr = err
+					}
+				}
+				issue.repaired(repairErr)
+			}
+			continue
+		}
+
+		// None of the agreements are left, so the instance is cleaned up the same way the governance worker does it
+		// when the last agreement ends. If there is no way to tell whether it has containers, it is left alone.
+		hasContainers := false
+		repairable := true
+		if containersMatching != nil {
+			hasContainers = len(containers[key]) != 0
+		} else if msdefFound {
+			hasContainers = msdef.HasDeployment()
+		} else {
+			repairable = false
+		}
+
+		issue := report.addIssue(DBCHECK_ORPHANED_INSTANCE, key,
+			msgPrinter.Sprintf("All the agreements of the service instance, %v, are archived or not in the database.", dangling), repairable)
+		if repair && repairable {
+			if _, err := persistence.MicroserviceInstanceCleanupStarted(db, key); err != nil {
+				issue.repaired(err)
+			} else if hasContainers {
+				// The instance is archived by the governance worker once the containers are gone.
+				msgs = append(msgs, events.NewMicroserviceCancellationMessage(events.CANCEL_MICROSERVICE, key))
+				issue.repaired(nil)
+			} else {
+				_, err := persistence.ArchiveMicroserviceInstance(db, key)
+				issue.repaired(err)
+			}
+		}
+	}
+
+	// Check the containers against the agreements and service instances. The governance worker restarts or cancels
+	// running workloads whose containers are missing, so those are only reported.
+	if containersMatching != nil {
+		for _, agId := range sortedKeys(runningAgs) {
+			ag := runningAgs[agId]
+			if ag.AgreementExecutionStartTime == 0 || len(ag.CurrentDeployment) == 0 {
+				continue
+			} else if len(containers[agId]) == 0 {
+				report.addIssue(DBCHECK_DEPLOYMENT_WITHOUT_CONTAINERS, agId,
+					msgPrinter.Sprintf("The agreement for service %v has started but has no containers.", ag.RunningWorkload.URL), false)
+			}
+		}
+
+		for _, msi := range msinsts {
+			key := msi.GetKey()
+			if msi.Archived {
+				if names := containers[key]; len(names) != 0 {
+					issue := report.addIssue(DBCHECK_ORPHANED_CONTAINER, key,
+						msgPrinter.Sprintf("Containers %v belong to the service instance, which is archived.", names), true)
+					if repair {
+						msgs = append(msgs, events.NewMicroserviceCancellationMessage(events.CANCEL_MICROSERVICE, key))
+						issue.repaired(nil)
+					}
+				}
+			} else if msi.CleanupStartTime == 0 && msi.ExecutionStartTime != 0 && len(containers[key]) == 0 {
+				if msdef, ok := msdefsById[msi.MicroserviceDefId]; ok && msdef.HasDeployment() {
+					report.addIssue(DBCHECK_DEPLOYMENT_WITHOUT_CONTAINERS, key,
+						msgPrinter.Sprintf("The service instance has started but has no containers."), false)
+				}
+			}
+		}
+
+		for _, agId := range sortedKeys(archivedAgs) {
+			if names := containers[agId]; len(names) != 0 {
+				ag := archivedAgs[agId]
+				issue := report.addIssue(DBCHECK_ORPHANED_CONTAINER, agId,
+					msgPrinter.Sprintf("Containers %v belong to the agreement, which is archived.", names), true)
+				if repair {
+					msgs = append(msgs, events.NewGovernanceWorkloadCancelationMessage(events.AGREEMENT_ENDED, events.AG_TERMINATED, ag.AgreementProtocol, agId, ag.GetDeploymentConfig()))
+					issue.repaired(nil)
+				}
+			}
+		}
+	}
+
+	// Check that the attributes scoped to services belong to services that are registered, or to the top level
+	// services of the agreements, which have no service definition. An attribute can also be set up for a service
+	// before it is deployed, so the attributes are only reported, they are never removed.
+	for _, attr := range attributes {
+		serviceSpecs := persistence.GetAttributeServiceSpecs(&attr)
+		if serviceSpecs == nil || len(*serviceSpecs) == 0 {
+			continue
+		}
+
+		registered := false
+		for _, msdef := range msdefs {
+			if !msdef.Archived && serviceSpecs.SupportService(msdef.SpecRef, msdef.Org) {
+				registered = true
+				break
+			}
+		}
+		for _, ag := range unarchivedAgs {
+			if ag.RunningWorkload.URL != "" && serviceSpecs.SupportService(ag.RunningWorkload.URL, ag.RunningWorkload.Org) {
+				registered = true
+				break
+			}
+		}
+
+		if !registered {
+			report.addIssue(DBCHECK_ORPHANED_ATTRIBUTE, attr.GetMeta().Id,
+				msgPrinter.Sprintf("The %v attribute is scoped to services %v, none of which are registered or in an agreement.", attr.GetMeta().Type, *serviceSpecs), false)
+		}
+	}
+
+	// The node status is rewritten by the governance worker when it changes, so stale entries are simply dropped. The
+	// status of an agreement service has the agreement id, the status of a dependent service has none and is saved for
+	// each service definition that is not archived.
+	unarchivedServices := make(map[string]bool)
+	for _, msdef := range msdefs {
+		if !msdef.Archived {
+			unarchivedServices[msdef.Org+"/"+msdef.SpecRef] = true
+		}
+	}
+	staleStatus := make([]persistence.WorkloadStatus, 0)
+	staleIssues := make([]int, 0)
+	for _, wlStatus := range nodeStatus {
+		if wlStatus.AgreementId == "" {
+			if !unarchivedServices[wlStatus.Org+"/"+wlStatus.ServiceURL] {
+				report.addIssue(DBCHECK_STALE_NODE_STATUS, wlStatus.ServiceURL,
+					msgPrinter.Sprintf("The node status for service %v refers to a service that is not registered.", wlStatus.ServiceURL), true)
+				staleStatus = append(staleStatus, wlStatus)
+				staleIssues = append(staleIssues, len(report.Issues)-1)
+			}
+		} else if _, ok := runningAgs[wlStatus.AgreementId]; !ok {
+			report.addIssue(DBCHECK_STALE_NODE_STATUS, wlStatus.AgreementId,
+				msgPrinter.Sprintf("The node status for service %v refers to an agreement that is not running.", wlStatus.ServiceURL), true)
+			staleStatus = append(staleStatus, wlStatus)
+			staleIssues = append(staleIssues, len(report.Issues)-1)
+		}
+	}
+	if repair && len(staleIssues) != 0 {
+		// Only the entries that were found stale are removed, a status that the governance worker has saved since
+		// they were read is kept.
+		_, err := persistence.RemoveNodeStatus(db, func(wlStatus persistence.WorkloadStatus) bool {
+			for _, stale := range staleStatus {
+				if reflect.DeepEqual(wlStatus, stale) {
+					return true
+				}
+			}
+			return false
+		})
+		for _, i := range staleIssues {
+			report.Issues[i].repaired(err)
+		}
+	}
+
+	found, repaired := report.Counts()
+	glog.V(3).Infof(apiLogString(fmt.Sprintf("Node database check found %v issues, repaired %v", found, repaired)))
+
+	if repaired != 0 {
+		eventlog.LogDatabaseEvent(db, persistence.SEVERITY_INFO,
+			persistence.NewMessageMeta(EL_API_NODE_DB_REPAIRED, repaired, found),
+			persistence.EC_NODE_DATABASE_REPAIRED)
+	}
+
+	return false, report, msgs
+}
+
+// Returns the keys of the agreement map in order, so that the report is stable.
+func sortedKeys(ags map[string]persistence.EstablishedAgreement) []string {
+	keys := make([]string, 0, len(ags))
+	for k := range ags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,245 @@
+// +build unit
+
+package api
+
+import (
+	"github.com/boltdb/bolt"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/persistence"
+	"reflect"
+	"testing"
+)
+
+// Returns a handler that reports the given containers, keyed by agreement id or service instance key.
+func getDummyContainersMatchingAgreementHandler(containers map[string][]string) ContainersMatchingAgreementHandler {
+	return func(agreements []string, includeShared bool, fn func(*dockerclient.APIContainers, string) error) error {
+		for _, key := range agreements {
+			for _, name := range containers[key] {
+				fn(&dockerclient.APIContainers{ID: name, Names: []string{"/" + name}}, key)
+			}
+		}
+		return nil
+	}
+}
+
+// Create an agreement whose workload has started.
+func createRunningAgreement(t *testing.T, db *bolt.DB, agreementId string) {
+	if _, err := persistence.NewEstablishedAgreement(db, "agreementName", agreementId, "consumer1", "{}", "Basic", 1, persistence.ServiceSpecs{}, "signature", "myorg/agbot1", "", "", "", &persistence.WorkloadInfo{URL: "myservice", Org: "myorg"}); err != nil {
+		t.Fatalf("failed to create agreement, error %v", err)
+	}
+	deployment := &persistence.NativeDeploymentConfig{Services: map[string]persistence.ServiceConfig{"myservice": persistence.ServiceConfig{}}}
+	if _, err := persistence.AgreementDeploymentStarted(db, agreementId, "Basic", deployment); err != nil {
+		t.Fatalf("failed to start deployment, error %v", err)
+	}
+	if _, err := persistence.AgreementStateExecutionStarted(db, agreementId, "Basic"); err != nil {
+		t.Fatalf("failed to start execution, error %v", err)
+	}
+}
+
+// Create a service instance associated with the agreements.
+func createServiceInstance(t *testing.T, db *bolt.DB, msdefId string, agreementIds []string) string {
+	msi, err := persistence.NewMicroserviceInstance(db, "mydependency", "myorg", "1.0.0", msdefId, []persistence.ServiceInstancePathElement{})
+	if err != nil {
+		t.Fatalf("failed to create service instance, error %v", err)
+	}
+	for _, agId := range agreementIds {
+		if _, err := persistence.UpdateMSInstanceAssociatedAgreements(db, msi.GetKey(), true, agId); err != nil {
+			t.Fatalf("failed to associate agreement, error %v", err)
+		}
+	}
+	return msi.GetKey()
+}
+
+// Save an attribute scoped to the service, and return its id.
+func saveScopedAttribute(t *testing.T, db *bolt.DB, serviceUrl string) string {
+	publishable := false
+	hostOnly := false
+	attr, err := persistence.SaveOrUpdateAttribute(db, persistence.MeteringAttributes{
+		Meta: &persistence.AttributeMeta{
+			Label:       "metering",
+			Publishable: &publishable,
+			HostOnly:    &hostOnly,
+			Type:        reflect.TypeOf(persistence.MeteringAttributes{}).Name(),
+		},
+		ServiceSpecs: &persistence.ServiceSpecs{persistence.ServiceSpec{Url: serviceUrl, Org: "myorg"}},
+		Tokens:       1,
+		PerTimeUnit:  "min",
+	}, "", false)
+	if err != nil {
+		t.Fatalf("failed to save attribute, error %v", err)
+	}
+	return (*attr).GetMeta().Id
+}
+
+func getIssues(report *NodeDBCheckReport) map[string]NodeDBCheckIssue {
+	issues := make(map[string]NodeDBCheckIssue)
+	for _, issue := range report.Issues {
+		issues[issue.Type+":"+issue.Resource] = issue
+	}
+	return issues
+}
+
+// A node whose records are consistent has no issues.
+func Test_CheckNodeDatabase_consistent(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	createRunningAgreement(t, db, "agreement1")
+	msdef := &persistence.MicroserviceDefinition{SpecRef: "mydependency", Org: "myorg", Version: "1.0.0"}
+	if err := persistence.SaveOrUpdateMicroserviceDef(db, msdef); err != nil {
+		t.Fatal(err)
+	}
+	key := createServiceInstance(t, db, msdef.Id, []string{"agreement1"})
+	if err := persistence.SaveNodeStatus(db, []persistence.WorkloadStatus{{AgreementId: "agreement1", ServiceURL: "myservice"}, {ServiceURL: "mydependency", Org: "myorg"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The top level service of the agreement has no service definition.
+	saveScopedAttribute(t, db, "myservice")
+
+	containers := getDummyContainersMatchingAgreementHandler(map[string][]string{"agreement1": []string{"c1"}, key: []string{"c2"}})
+
+	var myError error
+	errHandled, report, msgs := CheckNodeDatabase(true, GetPassThroughErrorHandler(&myError), containers, "", db, i18n.GetMessagePrinterWithLocale("en"))
+	if errHandled {
+		t.Fatalf("unexpected error %v", myError)
+	} else if len(report.Issues) != 0 {
+		t.Errorf("there should be no issues, found %v", report.Issues)
+	} else if len(msgs) != 0 {
+		t.Errorf("there should be no repair messages, found %v", msgs)
+	} else if report.Checked["agreements"] != 1 || report.Checked["service_instances"] != 1 || report.Checked["containers"] != 2 {
+		t.Errorf("wrong checked counts %v", report.Checked)
+	}
+}
+
+// Inconsistent records are reported without a repair, and fixed with one.
+func Test_CheckNodeDatabase_repair(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	// agreement1 is running without containers, agreement2 is archived but still has a container.
+	createRunningAgreement(t, db, "agreement1")
+	createRunningAgreement(t, db, "agreement2")
+	if _, err := persistence.ArchiveEstablishedAgreement(db, "agreement2", "Basic"); err != nil {
+		t.Fatal(err)
+	}
+
+	// One instance is shared with the archived agreement, the other only belongs to it and has no containers.
+	msdef := &persistence.MicroserviceDefinition{SpecRef: "mydependency", Org: "myorg", Version: "1.0.0"}
+	if err := persistence.SaveOrUpdateMicroserviceDef(db, msdef); err != nil {
+		t.Fatal(err)
+	}
+	sharedKey := createServiceInstance(t, db, msdef.Id, []string{"agreement1", "agreement2"})
+	orphanKey := createServiceInstance(t, db, msdef.Id, []string{"agreement2"})
+	missingKey := createServiceInstance(t, db, "nosuchmsdef", []string{"agreement1"})
+
+	// The attribute is scoped to a service that is not registered.
+	attrId := saveScopedAttribute(t, db, "unregistered")
+
+	// The status of a dependent service has no agreement id, it is kept while the service is registered.
+	status := []persistence.WorkloadStatus{
+		{AgreementId: "agreement1"},
+		{AgreementId: "agreement2"},
+		{ServiceURL: "mydependency", Org: "myorg"},
+		{ServiceURL: "unregistered", Org: "myorg"},
+	}
+	if err := persistence.SaveNodeStatus(db, status); err != nil {
+		t.Fatal(err)
+	}
+
+	containers := getDummyContainersMatchingAgreementHandler(map[string][]string{"agreement2": []string{"c1"}, sharedKey: []string{"c2"}})
+	msgPrinter := i18n.GetMessagePrinterWithLocale("en")
+
+	expected := map[string]bool{
+		DBCHECK_DEPLOYMENT_WITHOUT_CONTAINERS + ":agreement1": false,
+		DBCHECK_ORPHANED_CONTAINER + ":agreement2":            true,
+		DBCHECK_DANGLING_AGREEMENT + ":" + sharedKey:          true,
+		DBCHECK_ORPHANED_INSTANCE + ":" + orphanKey:           true,
+		DBCHECK_MISSING_DEFINITION + ":" + missingKey:         false,
+		DBCHECK_ORPHANED_ATTRIBUTE + ":" + attrId:             false,
+		DBCHECK_STALE_NODE_STATUS + ":agreement2":             true,
+		DBCHECK_STALE_NODE_STATUS + ":unregistered":           true,
+	}
+
+	// Without a repair nothing is changed.
+	var myError error
+	errHandled, report, msgs := CheckNodeDatabase(false, GetPassThroughErrorHandler(&myError), containers, "", db, msgPrinter)
+	if errHandled {
+		t.Fatalf("unexpected error %v", myError)
+	}
+	issues := getIssues(report)
+	for name, repairable := range expected {
+		if issue, ok := issues[name]; !ok {
+			t.Errorf("issue %v not found in %v", name, report.Issues)
+		} else if issue.Repairable != repairable || issue.Repaired {
+			t.Errorf("wrong issue %v", issue)
+		}
+	}
+	if len(report.Issues) != len(expected) {
+		t.Errorf("expected %v issues, found %v", len(expected), report.Issues)
+	} else if len(msgs) != 0 {
+		t.Errorf("there should be no repair messages, found %v", msgs)
+	}
+
+	// With a repair, the repairable issues are fixed.
+	errHandled, report, msgs = CheckNodeDatabase(true, GetPassThroughErrorHandler(&myError), containers, "", db, msgPrinter)
+	if errHandled {
+		t.Fatalf("unexpected error %v", myError)
+	}
+	for _, issue := range report.Issues {
+		if issue.Repaired != issue.Repairable {
+			t.Errorf("repairable issue not repaired %v", issue)
+		}
+	}
+
+	if len(msgs) != 1 {
+		t.Errorf("expected one repair message, found %v", msgs)
+	} else if msg, ok := msgs[0].(*events.GovernanceWorkloadCancelationMessage); !ok || msg.AgreementId != "agreement2" {
+		t.Errorf("wrong repair message %v", msgs[0])
+	}
+
+	if msi, err := persistence.FindMicroserviceInstanceWithKey(db, sharedKey); err != nil || len(msi.AssociatedAgreements) != 1 || msi.AssociatedAgreements[0] != "agreement1" {
+		t.Errorf("dangling agreement not removed from %v, error %v", msi, err)
+	}
+	if msi, err := persistence.FindMicroserviceInstanceWithKey(db, orphanKey); err != nil || !msi.Archived {
+		t.Errorf("orphaned instance not archived %v, error %v", msi, err)
+	}
+	if a, err := persistence.FindAttributeByKey(db, attrId); err != nil || a == nil || *a == nil {
+		t.Errorf("orphaned attribute should only be reported %v, error %v", a, err)
+	}
+	if status, err := persistence.FindNodeStatus(db); err != nil || len(status) != 2 || status[0].AgreementId != "agreement1" || status[1].ServiceURL != "mydependency" {
+		t.Errorf("stale node status not removed %v, error %v", status, err)
+	}
+}
+
+// Without access to the containers, the container checks are skipped.
+func Test_CheckNodeDatabase_no_containers(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	createRunningAgreement(t, db, "agreement1")
+
+	var myError error
+	errHandled, report, _ := CheckNodeDatabase(false, GetPassThroughErrorHandler(&myError), nil, "no docker", db, i18n.GetMessagePrinterWithLocale("en"))
+	if errHandled {
+		t.Fatalf("unexpected error %v", myError)
+	} else if len(report.Issues) != 0 {
+		t.Errorf("there should be no issues, found %v", report.Issues)
+	} else if report.ContainerCheck != "no docker" {
+		t.Errorf("the reason the containers were not checked is missing: %v", report)
+	}
+}
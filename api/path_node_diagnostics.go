@@ -0,0 +1,294 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/apicommon"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/eventlog"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/resource"
+	"github.com/open-horizon/anax/version"
+	"golang.org/x/text/message"
+	"time"
+)
+
+// The files in the node diagnostics bundle.
+const DIAG_MANIFEST = "manifest.json"
+const DIAG_NODE = "node.json"
+const DIAG_STATUS = "status.json"
+const DIAG_AGREEMENTS = "agreements.json"
+const DIAG_SERVICE_CONFIGSTATE = "service_configstate.json"
+const DIAG_EVENTLOG = "eventlog.json"
+const DIAG_ANAX_CONFIG = "anax_config.json"
+const DIAG_ESS_CONFIG = "ess_config.json"
+const DIAG_EXCHANGE_NODE = "exchange_node.json"
+const DIAG_DATABASE = "database.json"
+const DIAG_CONTAINER_LOG_DIR = "container_logs"
+
+// The default name of the diagnostics bundle file.
+const DIAG_BUNDLE_FILE_NAME = "node_diagnostics.tar.gz"
+
+// The number of log lines collected from each container.
+const DIAG_CONTAINER_LOG_LINES = 1000
+
+// Returns the most recent log output of the containers running on the node, keyed by container name.
+type ContainerLogsHandler func() (map[string]string, error)
+
+func GetContainerLogsHandler(dockerEndpoint string) ContainerLogsHandler {
+	return func() (map[string]string, error) {
+		return GetContainerLogs(dockerEndpoint, DIAG_CONTAINER_LOG_LINES)
+	}
+}
+
+// The manifest describes the content of the diagnostics bundle and the environment it was collected in. Any
+// information that could not be collected is recorded in the Errors map, keyed by file name.
+type DiagnosticsManifest struct {
+	CreationTime    uint64            `json:"creation_time"`
+	NodeId          string            `json:"node_id"`
+	NodeOrg         string            `json:"node_org"`
+	AgentVersion    string            `json:"agent_version"`
+	ExchangeURL     string            `json:"exchange_url"`
+	ExchangeVersion string            `json:"exchange_version"`
+	Files           []string          `json:"files"`
+	Errors          map[string]string `json:"errors,omitempty"`
+}
+
+func (d DiagnosticsManifest) String() string {
+	return fmt.Sprintf("CreationTime: %v, NodeId: %v, NodeOrg: %v, AgentVersion: %v, ExchangeURL: %v, ExchangeVersion: %v, Files: %v, Errors: %v",
+		d.CreationTime, d.NodeId, d.NodeOrg, d.AgentVersion, d.ExchangeURL, d.ExchangeVersion, d.Files, d.Errors)
+}
+
+// The value that replaces secrets in the diagnostics bundle.
+const DIAG_CENSORED = "********"
+
+// Censors used when dumping the node's database. Tokens, passwords and user input values are removed from the records.
+func getDiagnosticsDBCensors() map[string]persistence.RecordCensor {
+	return map[string]persistence.RecordCensor{
+		persistence.DEVICES: func(key string, value []byte) (interface{}, error) {
+			var dev persistence.ExchangeDevice
+			if err := json.Unmarshal(value, &dev); err != nil {
+				return nil, err
+			}
+			if dev.Token != "" {
+				dev.Token = DIAG_CENSORED
+			}
+			return dev, nil
+		},
+		persistence.ATTRIBUTES: func(key string, value []byte) (interface{}, error) {
+			if attr, err := persistence.HydrateConcreteAttribute(value); err != nil {
+				return nil, err
+			} else if attr == nil {
+				return nil, errors.New("unknown attribute type")
+			} else {
+				// The output model only contains the obfuscated mappings of the attribute.
+				return toOutModel(attr), nil
+			}
+		},
+		persistence.NODE_USERINPUT: func(key string, value []byte) (interface{}, error) {
+			var userInput []policy.UserInput
+			if err := json.Unmarshal(value, &userInput); err != nil {
+				return nil, err
+			}
+			return censorUserInput(userInput), nil
+		},
+		persistence.OUTBOX: func(key string, value []byte) (interface{}, error) {
+			var entry persistence.OutboxEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return nil, err
+			} else if len(entry.Body) == 0 {
+				return entry, nil
+			}
+			// The queued updates include the node's user input, which is found in the inputs of each service.
+			var body interface{}
+			if err := json.Unmarshal(entry.Body, &body); err != nil {
+				return nil, err
+			} else if censored, err := json.Marshal(censorJSONUserInput(body)); err != nil {
+				return nil, err
+			} else {
+				entry.Body = censored
+			}
+			return entry, nil
+		},
+	}
+}
+
+// Returns a copy of the user input with the values of the inputs censored, as they commonly hold passwords and API keys.
+// The names of the inputs are kept.
+func censorUserInput(userInput []policy.UserInput) []policy.UserInput {
+	censored := make([]policy.UserInput, 0, len(userInput))
+	for _, ui := range userInput {
+		inputs := make([]policy.Input, 0, len(ui.Inputs))
+		for _, input := range ui.Inputs {
+			inputs = append(inputs, policy.Input{Name: input.Name, Value: DIAG_CENSORED})
+		}
+		ui.Inputs = inputs
+		censored = append(censored, ui)
+	}
+	return censored
+}
+
+// Censor the values of the user input in a parsed JSON value, at any depth, and the tokens.
+func censorJSONUserInput(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range value {
+			if k == "token" {
+				value[k] = DIAG_CENSORED
+			} else if inputs, ok := fv.([]interface{}); ok && k == "inputs" {
+				for _, input := range inputs {
+					if im, ok := input.(map[string]interface{}); ok {
+						if _, ok := im["value"]; ok {
+							im["value"] = DIAG_CENSORED
+						}
+					}
+				}
+			} else {
+				value[k] = censorJSONUserInput(fv)
+			}
+		}
+	case []interface{}:
+		for i, ev := range value {
+			value[i] = censorJSONUserInput(ev)
+		}
+	}
+	return v
+}
+
+// Collect the diagnostic information for this node and return it as a gzipped tar file. Failure to collect one
+// piece of information does not stop the collection, the error is recorded in the manifest instead.
+func CreateNodeDiagnostics(db *bolt.DB,
+	cfg *config.HorizonConfig,
+	getStatus func() *apicommon.Info,
+	getDevice exchange.DeviceHandler,
+	getServicesConfigState exchange.ServicesConfigStateHandler,
+	getContainerLogs ContainerLogsHandler,
+	msgPrinter *message.Printer) ([]byte, error) {
+
+	manifest := DiagnosticsManifest{
+		CreationTime: uint64(time.Now().Unix()),
+		AgentVersion: version.HORIZON_VERSION,
+		ExchangeURL:  cfg.Edge.ExchangeURL,
+		Files:        []string{},
+		Errors:       map[string]string{},
+	}
+
+	files := make(map[string][]byte)
+
+	addFile := func(name string, content interface{}, err error) {
+		if err != nil {
+			manifest.Errors[name] = err.Error()
+		} else if b, err := json.MarshalIndent(content, "", "  "); err != nil {
+			manifest.Errors[name] = msgPrinter.Sprintf("unable to serialize %v, error %v", name, err)
+		} else {
+			files[name] = b
+			manifest.Files = append(manifest.Files, name)
+		}
+	}
+
+	// The local node, agent status and agreements.
+	device, err := FindHorizonDeviceForOutput(db)
+	addFile(DIAG_NODE, device, err)
+
+	status := getStatus()
+	if status != nil && status.Configuration != nil {
+		manifest.ExchangeVersion = status.Configuration.ExchangeVersion
+	}
+	addFile(DIAG_STATUS, status, nil)
+
+	agreements, err := FindAgreementsForOutput(db)
+	addFile(DIAG_AGREEMENTS, agreements, err)
+
+	eventLogs, err := eventlog.GetEventLogs(db, true, nil, msgPrinter)
+	addFile(DIAG_EVENTLOG, eventLogs, err)
+
+	// The configuration of anax and the embedded ESS with the secrets removed.
+	addFile(DIAG_ANAX_CONFIG, resource.GetCensoredHorizonConfig(cfg), nil)
+	addFile(DIAG_ESS_CONFIG, resource.GetCensoredESSConfig(), nil)
+
+	// The node's database.
+	dbDump, err := persistence.DumpDatabase(db, getDiagnosticsDBCensors())
+	addFile(DIAG_DATABASE, dbDump, err)
+
+	// The exchange's view of the node is only available when the node is registered.
+	if pDevice, err := persistence.FindExchangeDevice(db); err != nil {
+		manifest.Errors[DIAG_EXCHANGE_NODE] = msgPrinter.Sprintf("unable to read node object, error %v", err)
+	} else if pDevice == nil {
+		manifest.Errors[DIAG_EXCHANGE_NODE] = msgPrinter.Sprintf("the node is not registered")
+	} else {
+		manifest.NodeId = pDevice.Id
+		manifest.NodeOrg = pDevice.Org
+
+		exDevice, err := getDevice(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), pDevice.Token)
+		if exDevice != nil {
+			censored := *exDevice
+			if censored.Token != "" {
+				censored.Token = DIAG_CENSORED
+			}
+			censored.UserInput = censorUserInput(exDevice.UserInput)
+			exDevice = &censored
+		}
+		addFile(DIAG_EXCHANGE_NODE, exDevice, err)
+
+		configStates, err := getServicesConfigState(pDevice.Id, pDevice.Token)
+		addFile(DIAG_SERVICE_CONFIGSTATE, configStates, err)
+	}
+
+	// The container logs are plain text, one file per container.
+	if logs, err := getContainerLogs(); err != nil {
+		manifest.Errors[DIAG_CONTAINER_LOG_DIR] = err.Error()
+	} else {
+		for name, log := range logs {
+			fileName := fmt.Sprintf("%v/%v.log", DIAG_CONTAINER_LOG_DIR, name)
+			files[fileName] = []byte(log)
+			manifest.Files = append(manifest.Files, fileName)
+		}
+	}
+
+	glog.V(3).Infof(apiLogString(fmt.Sprintf("Created node diagnostics: %v", manifest)))
+
+	// The manifest is the first file in the bundle.
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to serialize %v, error %v", DIAG_MANIFEST, err))
+	}
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, name := range append([]string{DIAG_MANIFEST}, manifest.Files...) {
+		content := files[name]
+		if name == DIAG_MANIFEST {
+			content = manifestBytes
+		}
+
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(content)),
+			ModTime: time.Unix(int64(manifest.CreationTime), 0),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, errors.New(msgPrinter.Sprintf("unable to write %v to the diagnostics bundle, error %v", name, err))
+		} else if _, err := tw.Write(content); err != nil {
+			return nil, errors.New(msgPrinter.Sprintf("unable to write %v to the diagnostics bundle, error %v", name, err))
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to close the diagnostics bundle, error %v", err))
+	} else if err := gw.Close(); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("unable to compress the diagnostics bundle, error %v", err))
+	}
+
+	return buf.Bytes(), nil
+}
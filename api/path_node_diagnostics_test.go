@@ -0,0 +1,191 @@
+// +build unit
+
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"github.com/open-horizon/anax/apicommon"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Unpack the diagnostics bundle into a map of file name to file content.
+func unpackDiagnostics(t *testing.T, bundle []byte) map[string][]byte {
+	gr, err := gzip.NewReader(bytes.NewReader(bundle))
+	if err != nil {
+		t.Fatalf("bundle is not gzipped, error %v", err)
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("bundle is not a tar file, error %v", err)
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			t.Fatalf("unable to read %v from bundle, error %v", hdr.Name, err)
+		}
+		files[hdr.Name] = buf.Bytes()
+	}
+	return files
+}
+
+func getDummyStatus() func() *apicommon.Info {
+	return func() *apicommon.Info {
+		info := apicommon.NewLocalInfo("http://exchange/", "http://css/", "", "")
+		info.Configuration.ExchangeVersion = "2.44.0"
+		return info
+	}
+}
+
+func getDummyServicesConfigStateHandler() exchange.ServicesConfigStateHandler {
+	return func(id string, token string) ([]exchange.ServiceConfigState, error) {
+		return []exchange.ServiceConfigState{}, nil
+	}
+}
+
+// Diagnostics for an unregistered node still contain the local information.
+func Test_CreateNodeDiagnostics_unregistered(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	getContainerLogs := func() (map[string]string, error) {
+		return nil, errors.New("docker is not available")
+	}
+
+	bundle, err := CreateNodeDiagnostics(db, getBasicConfig(), getDummyStatus(), getDummyDeviceHandler(), getDummyServicesConfigStateHandler(), getContainerLogs, i18n.GetMessagePrinterWithLocale("en"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	files := unpackDiagnostics(t, bundle)
+
+	var manifest DiagnosticsManifest
+	if err := json.Unmarshal(files[DIAG_MANIFEST], &manifest); err != nil {
+		t.Fatalf("unable to read manifest, error %v", err)
+	} else if manifest.ExchangeVersion != "2.44.0" {
+		t.Errorf("wrong exchange version in manifest: %v", manifest)
+	} else if _, ok := manifest.Errors[DIAG_EXCHANGE_NODE]; !ok {
+		t.Errorf("manifest should report the missing exchange node: %v", manifest)
+	} else if _, ok := manifest.Errors[DIAG_CONTAINER_LOG_DIR]; !ok {
+		t.Errorf("manifest should report the missing container logs: %v", manifest)
+	}
+
+	for _, name := range []string{DIAG_NODE, DIAG_STATUS, DIAG_AGREEMENTS, DIAG_EVENTLOG, DIAG_ANAX_CONFIG, DIAG_ESS_CONFIG, DIAG_DATABASE} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("file %v is missing from the bundle", name)
+		}
+	}
+}
+
+// Diagnostics for a registered node contain the exchange information and no secrets.
+func Test_CreateNodeDiagnostics_registered(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	if _, err := persistence.SaveNewExchangeDevice(db, "testid", "secrettoken", "testname", "device", false, "myorg", "apattern", persistence.CONFIGSTATE_CONFIGURED); err != nil {
+		t.Fatalf("failed to create persisted device, error %v", err)
+	}
+
+	publishable := false
+	hostOnly := true
+	attr := persistence.HTTPSBasicAuthAttributes{
+		Meta: &persistence.AttributeMeta{
+			Label:       "auth",
+			Publishable: &publishable,
+			HostOnly:    &hostOnly,
+			Type:        reflect.TypeOf(persistence.HTTPSBasicAuthAttributes{}).Name(),
+		},
+		Url:      "http://myrepo.com",
+		Username: "user",
+		Password: "secretpassword",
+	}
+	if _, err := persistence.SaveOrUpdateAttribute(db, attr, "", false); err != nil {
+		t.Fatalf("failed to save attribute, error %v", err)
+	}
+
+	// The user input of the services is in the local database, in the updates queued for the exchange, and in the
+	// exchange node.
+	userInput := []policy.UserInput{{ServiceOrgid: "myorg", ServiceUrl: "myservice", Inputs: []policy.Input{{Name: "apikey", Value: "secretinput"}}}}
+	if err := persistence.SaveNodeUserInput(db, userInput); err != nil {
+		t.Fatalf("failed to save user input, error %v", err)
+	}
+	if _, err := persistence.QueueOutboxEntry(db, exchange.OUTBOX_NODE_USERINPUT, "PATCH", exchange.NodePath("myorg/testid", ""), exchange.PatchDeviceRequest{UserInput: &userInput}); err != nil {
+		t.Fatalf("failed to queue user input, error %v", err)
+	}
+
+	cfg := getBasicConfig()
+	cfg.AgreementBot.Postgresql.Password = "secretdbpassword"
+
+	getDevice := func(id string, token string) (*exchange.Device, error) {
+		if id != "myorg/testid" {
+			t.Errorf("wrong node id %v", id)
+		}
+		return &exchange.Device{Name: "testname", UserInput: userInput}, nil
+	}
+	getContainerLogs := func() (map[string]string, error) {
+		return map[string]string{"container1": "log line"}, nil
+	}
+
+	bundle, err := CreateNodeDiagnostics(db, cfg, getDummyStatus(), getDevice, getDummyServicesConfigStateHandler(), getContainerLogs, i18n.GetMessagePrinterWithLocale("en"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	files := unpackDiagnostics(t, bundle)
+
+	var manifest DiagnosticsManifest
+	if err := json.Unmarshal(files[DIAG_MANIFEST], &manifest); err != nil {
+		t.Fatalf("unable to read manifest, error %v", err)
+	} else if manifest.NodeId != "testid" || manifest.NodeOrg != "myorg" {
+		t.Errorf("wrong node in manifest: %v", manifest)
+	} else if len(manifest.Errors) != 0 {
+		t.Errorf("manifest should not have errors: %v", manifest)
+	} else if len(manifest.Files) != len(files)-1 {
+		t.Errorf("manifest lists %v files but the bundle has %v", len(manifest.Files), len(files)-1)
+	}
+
+	if string(files[DIAG_CONTAINER_LOG_DIR+"/container1.log"]) != "log line" {
+		t.Errorf("container log is missing from the bundle")
+	}
+
+	for name, content := range files {
+		for _, secret := range []string{"secrettoken", "secretpassword", "secretdbpassword", "secretinput"} {
+			if strings.Contains(string(content), secret) {
+				t.Errorf("file %v contains secret %v", name, secret)
+			}
+		}
+	}
+
+	// The names of the user inputs are kept.
+	for _, name := range []string{DIAG_DATABASE, DIAG_EXCHANGE_NODE} {
+		if !strings.Contains(string(files[name]), "apikey") {
+			t.Errorf("file %v should contain the user input names", name)
+		}
+	}
+	if userInput[0].Inputs[0].Value != "secretinput" {
+		t.Errorf("the user input of the exchange node was changed")
+	}
+}
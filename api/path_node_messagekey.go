@@ -0,0 +1,22 @@
+package api
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/persistence"
+	"golang.org/x/text/message"
+)
+
+// Validate a request to rotate the node's message key, and return the message that asks the agreement worker to rotate
+// it. Only a configured node has published its message key in the exchange. The rotation itself is asynchronous, the
+// outcome is recorded in the event log.
+func RotateNodeMessageKey(errorHandler ErrorHandler, db *bolt.DB, msgPrinter *message.Printer) (bool, []*events.MessageKeyRotateMessage) {
+
+	if pDevice, err := persistence.FindExchangeDevice(db); err != nil {
+		return errorHandler(NewSystemError(msgPrinter.Sprintf("Unable to read node object, error %v", err))), nil
+	} else if pDevice == nil || pDevice.Config.State != persistence.CONFIGSTATE_CONFIGURED {
+		return errorHandler(NewBadRequestError(msgPrinter.Sprintf("The node is not configured, it does not have a message key in the Exchange."))), nil
+	}
+
+	return false, []*events.MessageKeyRotateMessage{events.NewMessageKeyRotateMessage(events.MESSAGE_KEY_ROTATE)}
+}
@@ -0,0 +1,49 @@
+// +build unit
+
+package api
+
+import (
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/persistence"
+	"golang.org/x/text/message"
+	"testing"
+)
+
+// Verify that the message key of a node is only rotated when the node is configured.
+func Test_RotateNodeMessageKey(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	var myError error
+	errorhandler := GetPassThroughErrorHandler(&myError)
+	msgPrinter := message.NewPrinter(message.MatchLanguage("en"))
+
+	if errHandled, msgs := RotateNodeMessageKey(errorhandler, db, msgPrinter); !errHandled || len(msgs) != 0 {
+		t.Errorf("expected an error for an unregistered node, got %v", msgs)
+	} else if _, ok := myError.(*BadRequestError); !ok {
+		t.Errorf("wrong error type %T", myError)
+	}
+
+	pDevice, err := persistence.SaveNewExchangeDevice(db, "testid", "testtoken", "testname", "device", false, "myorg", "", persistence.CONFIGSTATE_CONFIGURING)
+	if err != nil {
+		t.Fatalf("failed to create persisted device, error %v", err)
+	}
+	myError = nil
+	if errHandled, _ := RotateNodeMessageKey(errorhandler, db, msgPrinter); !errHandled {
+		t.Errorf("expected an error for a node that is not configured")
+	}
+
+	if _, err := pDevice.SetConfigstate(db, "testid", persistence.CONFIGSTATE_CONFIGURED); err != nil {
+		t.Fatalf("failed to configure the device, error %v", err)
+	}
+	myError = nil
+	if errHandled, msgs := RotateNodeMessageKey(errorhandler, db, msgPrinter); errHandled {
+		t.Errorf("unexpected error %v", myError)
+	} else if len(msgs) != 1 || msgs[0].Event().Id != events.MESSAGE_KEY_ROTATE {
+		t.Errorf("wrong messages %v", msgs)
+	}
+}
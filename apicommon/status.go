@@ -8,6 +8,7 @@ import (
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/version"
 )
 
@@ -30,6 +31,18 @@ type Info struct {
 	Configuration *Configuration    `json:"configuration"`
 	Connectivity  map[string]bool   `json:"connectivity,omitempty"`
 	LiveHealth    *HealthTimestamps `json:"liveHealth"`
+
+	// The state of the circuit breaker of each exchange URL that has been called.
+	CircuitBreakers []exchange.CircuitBreakerState `json:"circuit_breakers,omitempty"`
+
+	// The updates waiting in the node's outbox to be sent to the exchange.
+	Outbox *persistence.OutboxStatus `json:"outbox,omitempty"`
+
+	// The size and hit rate of the cache of each type of exchange resource.
+	ExchangeCache []exchange.CacheStats `json:"exchange_cache,omitempty"`
+
+	// The features that were detected in the exchange.
+	ExchangeCapabilities map[string]bool `json:"exchange_capabilities,omitempty"`
 }
 
 func NewInfo(httpClientFactory *config.HTTPClientFactory, exchangeUrl string, mmsUrl string, id string, token string) *Info {
@@ -45,6 +58,13 @@ func NewInfo(httpClientFactory *config.HTTPClientFactory, exchangeUrl string, mm
 		glog.Errorf("Failed to get exchange version: %v", err)
 	}
 
+	var exch_features map[string]bool
+	if caps, err := exchange.GetExchangeCapabilities(customHTTPClientFactory, exchangeUrl, id, token); err != nil {
+		glog.Errorf("Failed to get exchange capabilities: %v", err)
+	} else {
+		exch_features = caps.Features
+	}
+
 	return &Info{
 		Configuration: &Configuration{
 			ExchangeAPI:     exchangeUrl,
@@ -55,6 +75,11 @@ func NewInfo(httpClientFactory *config.HTTPClientFactory, exchangeUrl string, mm
 			Arch:            runtime.GOARCH,
 			HorizonVersion:  version.HORIZON_VERSION,
 		},
+		CircuitBreakers: exchange.GetCircuitBreakers(),
+		Outbox:          exchange.GetOutboxStatus(),
+		ExchangeCache:   exchange.GetCacheStats(),
+
+		ExchangeCapabilities: exch_features,
 	}
 }
 
@@ -0,0 +1,306 @@
+package auditlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The audit log records every change that this node or agbot makes in the exchange: the time, the HTTP method, the
+// resource path, the identity that made the change, the result and a digest of the request body. Secrets in the body
+// are redacted before the digest is computed. Records are appended to the current audit log file as JSON lines, and the
+// file is rotated when it gets too big. Records are never changed once they are written.
+
+// The name of the file that records are appended to. Rotated files have a timestamp added to the name.
+const AUDIT_FILE_PREFIX = "audit"
+
+const AUDIT_FILE_EXTENSION = "jsonl"
+
+// The time format added to rotated file names. It sorts in time order.
+const FILE_TIME_FORMAT = "20060102T150405.000000000Z"
+
+// A single change made in the exchange.
+type AuditRecord struct {
+	Sequence   uint64    `json:"sequence"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Identity   string    `json:"identity"`
+	Code       int       `json:"code"` // The HTTP status code, 0 when there was no response from the exchange.
+	Error      string    `json:"error,omitempty"`
+	BodyDigest string    `json:"body_digest,omitempty"`
+}
+
+func (r AuditRecord) String() string {
+	return fmt.Sprintf("Sequence: %v, Time: %v, Method: %v, Path: %v, Identity: %v, Code: %v, Error: %v, BodyDigest: %v",
+		r.Sequence, r.Time, r.Method, r.Path, r.Identity, r.Code, r.Error, r.BodyDigest)
+}
+
+// The AuditLog appends records to the current audit log file, rotating it when it exceeds the configured size and
+// deleting the oldest rotated files when there are too many. It is safe for concurrent use.
+type AuditLog struct {
+	lock     sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	sequence uint64
+}
+
+func NewAuditLog(cfg *config.AuditLogConfig) (*AuditLog, error) {
+	if !cfg.IsEnabled() {
+		return nil, errors.New("audit log path is not configured")
+	} else if err := os.MkdirAll(cfg.Path, 0700); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to create audit log directory %v, error: %v", cfg.Path, err))
+	}
+
+	a := &AuditLog{
+		dir:      cfg.Path,
+		maxSize:  cfg.MaxFileSizeKB * 1024,
+		maxFiles: cfg.MaxFiles,
+	}
+	if err := a.loadSequence(); err != nil {
+		return nil, err
+	} else if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuditLog) String() string {
+	return fmt.Sprintf("Dir: %v, MaxSize: %v, MaxFiles: %v, Sequence: %v", a.dir, a.maxSize, a.maxFiles, a.sequence)
+}
+
+// The path of the file that records are currently appended to.
+func (a *AuditLog) CurrentFile() string {
+	return path.Join(a.dir, AUDIT_FILE_PREFIX+"."+AUDIT_FILE_EXTENSION)
+}
+
+// Continue the sequence numbers from the last record written by a previous process, so that they stay unique across
+// restarts. The current file is empty right after a rotation, in which case the last record is in the newest rotated
+// file.
+func (a *AuditLog) loadSequence() error {
+	files, err := RotatedFiles(a.dir)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to list audit log directory %v, error: %v", a.dir, err))
+	}
+	files = append(files, a.CurrentFile())
+
+	for i := len(files) - 1; i >= 0; i-- {
+		recs, err := readAuditFile(files[i])
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		} else if len(recs) != 0 {
+			a.sequence = recs[len(recs)-1].Sequence
+			return nil
+		}
+	}
+	return nil
+}
+
+// Open the current audit log file for appending. The caller must hold the lock, or be the constructor.
+func (a *AuditLog) open() error {
+	fileName := a.CurrentFile()
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to open audit log file %v, error: %v", fileName, err))
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.New(fmt.Sprintf("unable to stat audit log file %v, error: %v", fileName, err))
+	}
+
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// Record a change made in the exchange. The sequence number and the time are set by the audit log. A record that
+// cannot be written is logged and skipped, the audit log never holds up the calls to the exchange.
+func (a *AuditLog) Record(rec AuditRecord) {
+	if err := a.record(rec); err != nil {
+		glog.Errorf(alLogString(fmt.Sprintf("unable to record %v, error: %v", rec, err)))
+	}
+}
+
+func (a *AuditLog) record(rec AuditRecord) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	a.sequence++
+	rec.Sequence = a.sequence
+	rec.Time = time.Now().UTC()
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to marshal audit record, error: %v", err))
+	}
+
+	n, err := a.file.Write(append(b, '\n'))
+	a.size += int64(n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to write to audit log file %v, error: %v", a.CurrentFile(), err))
+	}
+
+	// The record is written, so a failure to rotate is only logged. Rotation is attempted again on the next record.
+	if a.maxSize > 0 && a.size >= a.maxSize {
+		if err := a.rotate(); err != nil {
+			glog.Errorf(alLogString(fmt.Sprintf("unable to rotate audit log file %v, error: %v", a.CurrentFile(), err)))
+		}
+	}
+	return nil
+}
+
+// Rename the current audit log file, open a new one and delete the oldest rotated files beyond the configured limit.
+// The caller must hold the lock.
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.file = nil
+
+	rotated := path.Join(a.dir, fmt.Sprintf("%v-%v.%v", AUDIT_FILE_PREFIX, time.Now().UTC().Format(FILE_TIME_FORMAT), AUDIT_FILE_EXTENSION))
+	renameErr := os.Rename(a.CurrentFile(), rotated)
+
+	// Always reopen the current file so that recording can continue, even if the rename failed.
+	if err := a.open(); err != nil {
+		return err
+	} else if renameErr != nil {
+		return renameErr
+	}
+	glog.V(3).Infof(alLogString(fmt.Sprintf("rotated audit log file to %v", rotated)))
+
+	if a.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := RotatedFiles(a.dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > a.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		glog.V(3).Infof(alLogString(fmt.Sprintf("deleted audit log file %v", files[0])))
+		files = files[1:]
+	}
+	return nil
+}
+
+// Close the current audit log file. Records passed to the audit log after it is closed are dropped.
+func (a *AuditLog) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// Return the records that match the filter, oldest first. When the filter has a limit, the most recent records are
+// returned.
+func (a *AuditLog) Query(filter *AuditFilter) ([]AuditRecord, error) {
+	files, err := RotatedFiles(a.dir)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to list audit log directory %v, error: %v", a.dir, err))
+	}
+	files = append(files, a.CurrentFile())
+
+	records := make([]AuditRecord, 0)
+	for _, fileName := range files {
+		recs, err := readAuditFile(fileName)
+		if os.IsNotExist(err) {
+			// The file was deleted by a rotation while it was being listed.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			if filter.Matches(rec) {
+				records = append(records, rec)
+			}
+		}
+	}
+
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[len(records)-filter.Limit:]
+	}
+	return records, nil
+}
+
+// Return the rotated audit log files in the directory, oldest first.
+func RotatedFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := AUDIT_FILE_PREFIX + "-"
+	suffix := "." + AUDIT_FILE_EXTENSION
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) && strings.HasSuffix(entry.Name(), suffix) {
+			files = append(files, path.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Read the records in an audit log file. The file is read while records are appended to it, so a last line without
+// a newline is a record that is being written, and it is skipped.
+func readAuditFile(fileName string) ([]AuditRecord, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]AuditRecord, 0)
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		b, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to read audit log file %v, error: %v", fileName, err))
+		} else if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+
+		var rec AuditRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to unmarshal audit record on line %v of %v, error: %v", line, fileName, err))
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+var alLogString = func(v interface{}) string {
+	return fmt.Sprintf("Audit Log: %v", v)
+}
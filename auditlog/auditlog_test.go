@@ -0,0 +1,170 @@
+// +build unit
+
+package auditlog
+
+import (
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_record_and_query(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auditlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.AuditLogConfig{Path: dir}.WithDefaults()
+	a, err := NewAuditLog(&cfg)
+	if err != nil {
+		t.Fatalf("unable to create audit log, error: %v", err)
+	}
+
+	start := time.Now().UTC().Add(-time.Second)
+	a.Record(AuditRecord{Method: "PUT", Path: "/v1/orgs/myorg/nodes/n1", Identity: "myorg/n1", Code: 201})
+	a.Record(AuditRecord{Method: "POST", Path: "/v1/orgs/myorg/nodes/n1/heartbeat", Identity: "myorg/n1", Code: 201})
+	a.Record(AuditRecord{Method: "DELETE", Path: "/v1/orgs/myorg/nodes/n1/agreements/ag1", Identity: "myorg/n1", Error: "connection refused"})
+
+	all, err := a.Query(&AuditFilter{})
+	if err != nil {
+		t.Fatalf("unable to query audit log, error: %v", err)
+	} else if len(all) != 3 || all[0].Sequence != 1 || all[2].Sequence != 3 {
+		t.Fatalf("wrong records %v", all)
+	} else if all[0].Time.Before(start) || all[2].Error != "connection refused" {
+		t.Errorf("wrong records %v", all)
+	}
+
+	if recs, _ := a.Query(&AuditFilter{Method: "delete"}); len(recs) != 1 || recs[0].Path != "/v1/orgs/myorg/nodes/n1/agreements/ag1" {
+		t.Errorf("wrong records for the method %v", recs)
+	} else if recs, _ := a.Query(&AuditFilter{Path: "/heartbeat"}); len(recs) != 1 || recs[0].Method != "POST" {
+		t.Errorf("wrong records for the path %v", recs)
+	} else if recs, _ := a.Query(&AuditFilter{Identity: "myorg/n2"}); len(recs) != 0 {
+		t.Errorf("wrong records for the identity %v", recs)
+	} else if recs, _ := a.Query(&AuditFilter{Limit: 2}); len(recs) != 2 || recs[0].Sequence != 2 {
+		t.Errorf("wrong records for the limit %v", recs)
+	} else if recs, _ := a.Query(&AuditFilter{Since: time.Now().Add(time.Hour)}); len(recs) != 0 {
+		t.Errorf("wrong records for the time %v", recs)
+	}
+
+	// A record that is being written is not read.
+	if f, err := os.OpenFile(a.CurrentFile(), os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Write([]byte(`{"sequence":4,"method":"PU`))
+		f.Close()
+	}
+	if recs, err := a.Query(&AuditFilter{}); err != nil || len(recs) != 3 {
+		t.Errorf("expected the partial record to be skipped, got %v, error: %v", recs, err)
+	}
+
+	a.Close()
+	a.Record(AuditRecord{Method: "PUT"})
+}
+
+func Test_rotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auditlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.AuditLogConfig{Path: dir, MaxFiles: 2}.WithDefaults()
+	a, err := NewAuditLog(&cfg)
+	if err != nil {
+		t.Fatalf("unable to create audit log, error: %v", err)
+	}
+	defer a.Close()
+
+	// Rotate after every record.
+	a.maxSize = 1
+	for i := 0; i < 5; i++ {
+		a.Record(AuditRecord{Method: "PUT", Path: "/v1/orgs/myorg/nodes/n1"})
+		time.Sleep(time.Millisecond)
+	}
+
+	if files, err := RotatedFiles(dir); err != nil || len(files) != 2 {
+		t.Errorf("expected 2 rotated files, got %v, error: %v", files, err)
+	} else if recs, err := a.Query(&AuditFilter{}); err != nil || len(recs) != 2 || recs[0].Sequence != 4 {
+		t.Errorf("expected the 2 newest records, got %v, error: %v", recs, err)
+	}
+}
+
+// Verify that the sequence numbers continue after a restart, also when the current file was just rotated.
+func Test_sequence_restart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auditlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.AuditLogConfig{Path: dir}.WithDefaults()
+	a, err := NewAuditLog(&cfg)
+	if err != nil {
+		t.Fatalf("unable to create audit log, error: %v", err)
+	}
+	a.Record(AuditRecord{Method: "PUT", Path: "/v1/orgs/myorg/nodes/n1"})
+	a.Record(AuditRecord{Method: "PUT", Path: "/v1/orgs/myorg/nodes/n1"})
+	a.Close()
+
+	a, err = NewAuditLog(&cfg)
+	if err != nil {
+		t.Fatalf("unable to reopen audit log, error: %v", err)
+	}
+	a.maxSize = 1
+	a.Record(AuditRecord{Method: "DELETE", Path: "/v1/orgs/myorg/nodes/n1"})
+	a.Close()
+
+	a, err = NewAuditLog(&cfg)
+	if err != nil {
+		t.Fatalf("unable to reopen audit log, error: %v", err)
+	}
+	defer a.Close()
+	a.Record(AuditRecord{Method: "PUT", Path: "/v1/orgs/myorg/nodes/n1"})
+
+	if recs, err := a.Query(&AuditFilter{}); err != nil || len(recs) != 4 || recs[2].Sequence != 3 || recs[3].Sequence != 4 {
+		t.Errorf("expected the sequence to continue, got %v, error: %v", recs, err)
+	}
+}
+
+func Test_DigestBody(t *testing.T) {
+	if DigestBody(nil) != "" {
+		t.Errorf("expected no digest for an empty body")
+	}
+
+	d1 := DigestBody([]byte(`{"token":"abc","name":"n1","auths":[{"password":"pw1","user":"u"}]}`))
+	d2 := DigestBody([]byte(`{"name": "n1", "token": "xyz", "auths": [{"user": "u", "password": "pw2"}]}`))
+	d3 := DigestBody([]byte(`{"token":"abc","name":"n2"}`))
+	if d1 == "" || len(d1) != 64 {
+		t.Errorf("wrong digest %v", d1)
+	} else if d1 != d2 {
+		t.Errorf("expected the same digest when only the secrets and the layout differ, got %v and %v", d1, d2)
+	} else if d1 == d3 {
+		t.Errorf("expected different digests for different bodies")
+	}
+
+	if DigestBody([]byte("not json")) == DigestBody([]byte("not json either")) {
+		t.Errorf("expected different digests for different bodies that are not json")
+	}
+}
+
+func Test_ParseFilter(t *testing.T) {
+	if f, err := ParseFilter(url.Values{"method": {"PUT"}, "since": {"2020-01-02T03:04:05Z"}, "limit": {"10"}}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if f.Method != "PUT" || f.Limit != 10 || !f.Since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("wrong filter %v", f)
+	}
+
+	if f, err := ParseFilter(url.Values{"since": {"1577934245"}}); err != nil || f.Since.Unix() != 1577934245 {
+		t.Errorf("wrong filter %v, error %v", f, err)
+	}
+
+	if _, err := ParseFilter(url.Values{"since": {"yesterday"}}); err == nil {
+		t.Errorf("expected an error for a bad time")
+	} else if _, err := ParseFilter(url.Values{"limit": {"-1"}}); err == nil {
+		t.Errorf("expected an error for a bad limit")
+	}
+}
@@ -0,0 +1,65 @@
+package auditlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// The value that replaces secrets in a request body before its digest is computed.
+const REDACTED = "********"
+
+// The parts of a field name that mark it as holding a secret, compared in lower case. A field named pw is also a secret.
+var secretFieldNames = []string{"token", "password", "secret", "credential"}
+
+// Returns the SHA-256 digest, in hex, of a request body with its secrets redacted. The digest shows whether two changes
+// sent the same body, without keeping the body or anything that could be used to guess a secret in it. A JSON body is
+// digested in its canonical form, with the object keys in order. An empty body has no digest.
+func DigestBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		if canonical, err := json.Marshal(redact(parsed)); err == nil {
+			body = canonical
+		}
+	}
+
+	digest := sha256.Sum256(body)
+	return hex.EncodeToString(digest[:])
+}
+
+// Replace the values of the secret fields in a parsed JSON value, at any depth.
+func redact(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range value {
+			if isSecretField(k) {
+				value[k] = REDACTED
+			} else {
+				value[k] = redact(fv)
+			}
+		}
+	case []interface{}:
+		for i, ev := range value {
+			value[i] = redact(ev)
+		}
+	}
+	return v
+}
+
+func isSecretField(name string) bool {
+	lower := strings.ToLower(name)
+	if lower == "pw" {
+		return true
+	}
+	for _, secret := range secretFieldNames {
+		if strings.Contains(lower, secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package auditlog
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The query parameters that select audit records in the node and agbot APIs.
+const (
+	FILTER_METHOD   = "method"
+	FILTER_PATH     = "path"
+	FILTER_IDENTITY = "identity"
+	FILTER_SINCE    = "since"
+	FILTER_LIMIT    = "limit"
+)
+
+// Selects audit records. The fields that are not set match every record.
+type AuditFilter struct {
+	Method   string    // The HTTP method, in any case.
+	Path     string    // A part of the resource path, for example /nodes/mynode.
+	Identity string    // The identity that made the change, in the form org/id.
+	Since    time.Time // Records at or after this time.
+	Limit    int       // The most recent records to return, 0 means all of them.
+}
+
+func (f AuditFilter) String() string {
+	return fmt.Sprintf("Method: %v, Path: %v, Identity: %v, Since: %v, Limit: %v", f.Method, f.Path, f.Identity, f.Since, f.Limit)
+}
+
+// Returns true if the record is selected by the filter.
+func (f *AuditFilter) Matches(rec AuditRecord) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, rec.Method) {
+		return false
+	} else if f.Path != "" && !strings.Contains(rec.Path, f.Path) {
+		return false
+	} else if f.Identity != "" && f.Identity != rec.Identity {
+		return false
+	} else if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// Build a filter from the query parameters of an API request. The since parameter is an RFC3339 time or a unix time in
+// seconds.
+func ParseFilter(query url.Values) (*AuditFilter, error) {
+	filter := &AuditFilter{
+		Method:   query.Get(FILTER_METHOD),
+		Path:     query.Get(FILTER_PATH),
+		Identity: query.Get(FILTER_IDENTITY),
+	}
+
+	if since := query.Get(FILTER_SINCE); since != "" {
+		if t, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = t
+		} else if secs, err := strconv.ParseInt(since, 10, 64); err == nil {
+			filter.Since = time.Unix(secs, 0)
+		} else {
+			return nil, errors.New(fmt.Sprintf("%v %v must be an RFC3339 time or a unix time in seconds", FILTER_SINCE, since))
+		}
+	}
+
+	if limit := query.Get(FILTER_LIMIT); limit != "" {
+		if n, err := strconv.Atoi(limit); err != nil || n < 0 {
+			return nil, errors.New(fmt.Sprintf("%v %v must be a number that is not negative", FILTER_LIMIT, limit))
+		} else {
+			filter.Limit = n
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// An LRU cache is like a simple map cache, except that it holds at most maxEntries objects. When a new key is stored
+// in a full cache, the least recently used entry is evicted. A maxEntries of 0 or less means the cache is not bounded.
+// The eviction function, if set, is called with each evicted entry while the cache lock is held, so it must not call
+// back into the cache.
+type LRUCache struct {
+	Maplock    sync.Mutex
+	maxEntries int
+	onEvict    func(key string, obj interface{})
+	order      *list.List // Most recently used at the front.
+	cache      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+	obj interface{}
+}
+
+func NewLRUCache(maxEntries int, onEvict func(key string, obj interface{})) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		onEvict:    onEvict,
+		order:      list.New(),
+		cache:      make(map[string]*list.Element),
+	}
+}
+
+// Return the cached object by input key, which becomes the most recently used.
+func (c *LRUCache) Get(key string) interface{} {
+	c.Maplock.Lock()
+	defer c.Maplock.Unlock()
+
+	if elem, ok := c.cache[key]; !ok {
+		return nil
+	} else {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*lruEntry).obj
+	}
+}
+
+// GetKeys returns a slice containing all keys in the cache, most recently used first.
+func (c *LRUCache) GetKeys() []string {
+	c.Maplock.Lock()
+	defer c.Maplock.Unlock()
+
+	keys := []string{}
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*lruEntry).key)
+	}
+	return keys
+}
+
+// Store the cached object by input key, evicting the least recently used entry if the cache is full.
+func (c *LRUCache) Put(key string, obj interface{}) {
+	c.Maplock.Lock()
+	defer c.Maplock.Unlock()
+
+	if elem, ok := c.cache[key]; ok {
+		elem.Value.(*lruEntry).obj = obj
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.cache[key] = c.order.PushFront(&lruEntry{key: key, obj: obj})
+
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*lruEntry)
+		c.order.Remove(oldest)
+		delete(c.cache, entry.key)
+		if c.onEvict != nil {
+			c.onEvict(entry.key, entry.obj)
+		}
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.Maplock.Lock()
+	defer c.Maplock.Unlock()
+
+	if elem, ok := c.cache[key]; ok {
+		c.order.Remove(elem)
+		delete(c.cache, key)
+	}
+}
+
+// Len returns the number of objects in the cache.
+func (c *LRUCache) Len() int {
+	c.Maplock.Lock()
+	defer c.Maplock.Unlock()
+
+	return c.order.Len()
+}
+
+// MaxEntries returns the most objects the cache holds, 0 or less if it is not bounded.
+func (c *LRUCache) MaxEntries() int {
+	return c.maxEntries
+}
@@ -0,0 +1,53 @@
+// +build unit
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Verify that the least recently used entry is evicted when the cache is full.
+func Test_LRUCache_evict(t *testing.T) {
+
+	evicted := []string{}
+	c := NewLRUCache(2, func(key string, obj interface{}) { evicted = append(evicted, key) })
+
+	c.Put("a", 1)
+	c.Put("b", 2)
+	if c.Get("a") != 1 {
+		t.Errorf("expected a to be cached")
+	}
+
+	// b is now the least recently used.
+	c.Put("c", 3)
+	if c.Get("b") != nil {
+		t.Errorf("expected b to be evicted")
+	} else if !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Errorf("expected b to be evicted, got %v", evicted)
+	} else if keys := c.GetKeys(); !reflect.DeepEqual(keys, []string{"c", "a"}) {
+		t.Errorf("expected keys c and a, got %v", keys)
+	}
+
+	// Replacing an entry does not evict anything.
+	c.Put("a", 4)
+	if c.Len() != 2 || c.Get("a") != 4 || len(evicted) != 1 {
+		t.Errorf("expected a to be replaced, got %v and evicted %v", c.GetKeys(), evicted)
+	}
+
+	c.Delete("a")
+	if c.Get("a") != nil || c.Len() != 1 {
+		t.Errorf("expected a to be deleted, got %v", c.GetKeys())
+	}
+}
+
+func Test_LRUCache_unbounded(t *testing.T) {
+
+	c := NewLRUCache(0, nil)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Put(k, k)
+	}
+	if c.Len() != 4 {
+		t.Errorf("expected 4 entries, got %v", c.GetKeys())
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/open-horizon/anax/version"
 	"github.com/open-horizon/anax/worker"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -45,6 +46,18 @@ type ChangesWorker struct {
 	lastHeartbeat          int64  // Last time a heartbeat was successful.
 	heartBeatFailed        bool   // Remember that the heartbeat has failed.
 	noworkDispatch         int64  // The last time the NoWorkHandler was dispatched.
+
+	exchangeVersion string // The version of the exchange that returned the last changes.
+	changesRead     int64  // When the changes were last read, in seconds since 1970.
+	stateSaved      int64  // When the change state was last saved in the local DB.
+
+	// How the changes are retrieved, and whether a request for changes is being held open outside of the worker.
+	retriever ChangeRetriever
+	waiting   bool
+
+	// Closed when the worker is told to terminate, so that a request that was held open does not wait for the worker.
+	terminating   chan bool
+	terminateOnce sync.Once
 }
 
 func NewChangesWorker(name string, cfg *config.HorizonConfig, db *bolt.DB) *ChangesWorker {
@@ -69,7 +82,9 @@ func NewChangesWorker(name string, cfg *config.HorizonConfig, db *bolt.DB) *Chan
 		changeID:               0,
 		heartBeatFailed:        false,
 		noworkDispatch:         time.Now().Unix(),
+		terminating:            make(chan bool),
 	}
+	worker.retriever = NewChangeRetriever(&cfg.Edge.ExchangeChanges, worker)
 
 	// Initialize the change state tracking from the local DB.
 	chgState, err := persistence.FindExchangeChangeState(db)
@@ -79,6 +94,9 @@ func NewChangesWorker(name string, cfg *config.HorizonConfig, db *bolt.DB) *Chan
 
 	if chgState != nil && chgState.ChangeID != 0 {
 		worker.changeID = chgState.ChangeID
+		worker.exchangeVersion = chgState.ExchangeVersion
+		worker.changesRead = chgState.LastUpdated
+		worker.stateSaved = chgState.LastUpdated
 		glog.V(3).Info(chglog(fmt.Sprintf("restore exchange change state after restart: %v", chgState)))
 	}
 
@@ -170,14 +188,20 @@ func (w *ChangesWorker) NewEvent(incoming events.Message) {
 		msg, _ := incoming.(*events.ExchangeChangesShutdownMessage)
 		switch msg.Event().Id {
 		case events.MESSAGE_STOP:
-			w.Commands <- worker.NewTerminateCommand("shutdown")
+			w.terminate()
 		}
 
 	case *events.NodeShutdownCompleteMessage:
 		msg, _ := incoming.(*events.NodeShutdownCompleteMessage)
 		switch msg.Event().Id {
 		case events.UNCONFIGURE_COMPLETE:
-			w.Commands <- worker.NewTerminateCommand("shutdown")
+			w.terminate()
+		}
+
+	case *events.ConfigReloadedMessage:
+		msg, _ := incoming.(*events.ConfigReloadedMessage)
+		if msg.HasField("Edge.ExchangeMessagePollInterval") {
+			w.Commands <- NewConfigReloadedCommand(msg)
 		}
 
 	default: //nothing
@@ -211,6 +235,13 @@ func (w *ChangesWorker) CommandHandler(command worker.Command) bool {
 		cmd, _ := command.(*DeviceRegisteredCommand)
 		w.handleDeviceRegistration(cmd)
 
+	case *ConfigReloadedCommand:
+		w.handleConfigReloaded()
+
+	case *ChangesRetrievedCommand:
+		cmd, _ := command.(*ChangesRetrievedCommand)
+		w.handleChangesRetrieved(cmd)
+
 	default:
 		return false
 	}
@@ -252,19 +283,88 @@ func (w *ChangesWorker) findAndProcessChanges() {
 		}
 	}
 
+	// A request that is held open by the exchange is sent from its own goroutine, so that the worker keeps handling
+	// commands. The changes come back to the worker as a command.
+	if w.retriever.HoldsRequests() {
+		w.waitForChanges(maxRecords)
+		return
+	}
+
 	glog.V(3).Infof(chglog(fmt.Sprintf("looking for changes starting from ID %v", w.changeID)))
 
 	// Call the exchange to retrieve any changes since our last known change id.
-	changes, err := exchange.GetHTTPExchangeChangeHandler(w)(w.changeID, maxRecords, nil)
+	changes, err := w.retriever.GetChanges(w.changeID, maxRecords)
+	w.processChanges(changes, err)
+}
+
+// Start a request for changes that the exchange holds open, unless there is one already.
+func (w *ChangesWorker) waitForChanges(maxRecords int) {
+	if w.waiting {
+		return
+	}
+	w.waiting = true
+
+	glog.V(3).Infof(chglog(fmt.Sprintf("waiting for changes starting from ID %v", w.changeID)))
+
+	changeID := w.changeID
+	retriever := w.retriever
+	commands := w.Commands
+	terminating := w.terminating
+	go func() {
+		changes, err := retriever.GetChanges(changeID, maxRecords)
+		select {
+		case commands <- NewChangesRetrievedCommand(changeID, changes, err):
+		case <-terminating:
+			glog.V(3).Infof(chglog(fmt.Sprintf("dropping the changes from ID %v, the worker is terminating", changeID)))
+		}
+	}()
+}
+
+// Tell the worker to terminate. It can be told more than once.
+func (w *ChangesWorker) terminate() {
+	w.terminateOnce.Do(func() { close(w.terminating) })
+	w.Commands <- worker.NewTerminateCommand("shutdown")
+}
+
+// Process the changes from a request that was held open, and start the next one right away.
+func (w *ChangesWorker) handleChangesRetrieved(cmd *ChangesRetrievedCommand) {
+	w.waiting = false
+
+	// The change ID moves only when changes are processed, which the worker does not do while it waits, unless the
+	// node was registered again in the meantime.
+	if cmd.ChangeID != w.changeID {
+		glog.V(3).Infof(chglog(fmt.Sprintf("ignoring changes from ID %v, the current change ID is %v", cmd.ChangeID, w.changeID)))
+	} else {
+		w.processChanges(cmd.Changes, cmd.Err)
+	}
+
+	if w.GetExchangeToken() != "" && w.retriever.HoldsRequests() {
+		w.findAndProcessChanges()
+	}
+}
+
+// Process the changes retrieved from the exchange, notifying other workers that they might have work to do.
+func (w *ChangesWorker) processChanges(changes *exchange.ExchangeChanges, err error) {
 
 	// Handle heartbeat state changes and errors. Returns true if there was an error to be handled.
 	if w.handleHeartbeatStateAndError(changes, err) {
 		return
 	}
 
+	// If changes might have been missed, all the resources are synced with the exchange, in addition to the
+	// changes that were returned. After a restart, the changes were last read when the change state was saved.
+	gap := changes.GetChangesGap(w.changeID, w.exchangeVersion)
+	if gap == "" {
+		gap = exchange.GetChangesRetentionGap(w.changesRead, w.Config.Edge.ExchangeChanges.RetentionS)
+	}
+	w.changesRead = time.Now().Unix()
+	if gap != "" {
+		w.startResync(gap)
+	}
+
 	// Loop through each change to identify resources that we are interested in, and then send out event messages
 	// to notify the other workers that they have some work to do.
-	resourceTypes := w.createSupportedResourceTypes(false)
+	resourceTypes := w.createSupportedResourceTypes(gap != "")
 	for _, change := range changes.Changes {
 		exchange.DeleteCacheResourceFromChange(change, w.GetExchangeId())
 		glog.V(3).Infof(chglog(fmt.Sprintf("Change: %v", change)))
@@ -300,6 +400,24 @@ func (w *ChangesWorker) findAndProcessChanges() {
 
 }
 
+// Some changes might have been missed, so make sure that the cached exchange resources of the node's org are not used,
+// and tell the agreement worker to reconcile the node's agreements with the exchange. The caller notifies the other
+// workers that all the other resources have changed.
+func (w *ChangesWorker) startResync(gap string) {
+	glog.Warningf(chglog(fmt.Sprintf("changes might have been missed because %v, syncing all resources with the exchange", gap)))
+
+	eventlog.LogNodeEvent(w.db, persistence.SEVERITY_WARN,
+		persistence.NewMessageMeta(EL_AG_NODE_CHANGES_RESYNC, exchange.GetOrg(w.GetExchangeId()), exchange.GetId(w.GetExchangeId()), gap),
+		persistence.EC_NODE_CHANGES_RESYNC, exchange.GetId(w.GetExchangeId()), exchange.GetOrg(w.GetExchangeId()), "", "")
+
+	exchange.DeleteOrgCachedResources(exchange.GetOrg(w.GetExchangeId()))
+	w.Messages() <- events.NewExchangeChangeMessage(events.CHANGE_NODE_AGREEMENT_TYPE)
+
+	if updated := w.getHeartbeatIntervals(); updated {
+		w.updatePollingInterval(UPDATE_TYPE_NEW_CONFIG)
+	}
+}
+
 // Create a map of exchange resources that a device cares about. The resources in the map are set to boolean
 // true if initialValue is set to true. This enables the map to be passed to emitChangeMessages so that a
 // change message is sent to all workers.
@@ -328,12 +446,18 @@ func (w *ChangesWorker) emitChangeMessages(resChanges map[events.EventId]bool) b
 // Record the most recent change id and reset the polling interval based on the changes that were found.
 func (w *ChangesWorker) postProcessChanges(changes *exchange.ExchangeChanges, interestingChanges bool) {
 
+	if changes.GetExchangeVersion() != "" {
+		w.exchangeVersion = changes.GetExchangeVersion()
+	}
+
 	// If there were changes found, even uninteresting changes, we need to keep the most recent change id current.
+	// Without changes, the change state is still saved now and then, so that after a restart it shows that the
+	// changes were read within the retention period of the exchange.
 	if changes.GetMostRecentChangeID() != 0 {
 		w.changeID = changes.GetMostRecentChangeID() + 1
-		if err := persistence.SaveExchangeChangeState(w.db, w.changeID); err != nil {
-			glog.Errorf(chglog(fmt.Sprintf("error saving persistent exchange change state, error %v", err)))
-		}
+		w.saveChangeState()
+	} else if retentionS := w.Config.Edge.ExchangeChanges.RetentionS; retentionS > 0 && time.Now().Unix()-w.stateSaved >= int64(retentionS/2) {
+		w.saveChangeState()
 	}
 
 	// If we found interesting events, then make sure we keep the polling interval short. This way, a flood
@@ -347,6 +471,15 @@ func (w *ChangesWorker) postProcessChanges(changes *exchange.ExchangeChanges, in
 	}
 }
 
+// Save the change ID and the exchange version, so that the worker continues from them after a restart.
+func (w *ChangesWorker) saveChangeState() {
+	if err := persistence.SaveExchangeChangeState(w.db, w.changeID, w.exchangeVersion); err != nil {
+		glog.Errorf(chglog(fmt.Sprintf("error saving persistent exchange change state, error %v", err)))
+	} else {
+		w.stateSaved = time.Now().Unix()
+	}
+}
+
 // Process any error from the /changes API and update the heartbeat state appropriately. Return true if the
 // caller should not proceeed to process the response.
 func (w *ChangesWorker) handleHeartbeatStateAndError(changes *exchange.ExchangeChanges, err error) bool {
@@ -533,9 +666,11 @@ func (w *ChangesWorker) getChangeId() error {
 			return fmt.Errorf("Error retrieving max change ID, error: %v", err)
 		} else {
 			w.changeID = maxChangeID.MaxChangeID
-			if err := persistence.SaveExchangeChangeState(w.db, w.changeID); err != nil {
+			if err := persistence.SaveExchangeChangeState(w.db, w.changeID, w.exchangeVersion); err != nil {
 				return fmt.Errorf("Error saving persistent exchange change state, error %v", err)
 			}
+			w.changesRead = time.Now().Unix()
+			w.stateSaved = w.changesRead
 		}
 
 		// Safety measure to ensure that the agent has the latest info from the exchange.
@@ -610,6 +745,25 @@ func (w *ChangesWorker) getHeartbeatIntervals() bool {
 	return updated
 }
 
+// The minimum poll interval was changed in the configuration. The heartbeat intervals in the node and org definitions
+// override the configuration, so they are retrieved again before the poll interval is reset to the new minimum.
+func (w *ChangesWorker) handleConfigReloaded() {
+	w.pollMinInterval = w.Config.GetExchangeMessagePollInterval()
+	if w.GetExchangeToken() != "" {
+		w.getHeartbeatIntervals()
+	}
+
+	if w.pollMaxInterval < w.pollMinInterval {
+		w.pollMaxInterval = w.pollMinInterval
+	}
+
+	glog.V(3).Infof(chglog(fmt.Sprintf("Poll intervals updated from the reloaded configuration. min: %v, max: %v, increment: %v", w.pollMinInterval, w.pollMaxInterval, w.pollAdjustment)))
+
+	// Force the reset, the current interval might already be the old minimum.
+	w.pollInterval = 0
+	w.updatePollingInterval(UPDATE_TYPE_RESET)
+}
+
 // Utility logging function
 var chglog = func(v interface{}) string {
 	return fmt.Sprintf("Exchange Changes Worker: %v", v)
@@ -617,8 +771,9 @@ var chglog = func(v interface{}) string {
 
 // messages for eventlog
 const (
-	EL_AG_NODE_HB_FAILED   = "Node heartbeat failed for node %v/%v. Error: %v"
-	EL_AG_NODE_HB_RESTORED = "Node heartbeat restored for node %v/%v."
+	EL_AG_NODE_HB_FAILED      = "Node heartbeat failed for node %v/%v. Error: %v"
+	EL_AG_NODE_HB_RESTORED    = "Node heartbeat restored for node %v/%v."
+	EL_AG_NODE_CHANGES_RESYNC = "Node %v/%v might have missed exchange changes because %v, syncing with the exchange."
 )
 
 // This is does nothing useful at run time.
@@ -631,4 +786,5 @@ func MarkI18nMessages() {
 
 	msgPrinter.Sprintf(EL_AG_NODE_HB_FAILED)
 	msgPrinter.Sprintf(EL_AG_NODE_HB_RESTORED)
+	msgPrinter.Sprintf(EL_AG_NODE_CHANGES_RESYNC)
 }
@@ -0,0 +1,46 @@
+// +build unit
+
+package changes
+
+import (
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/worker"
+	"testing"
+	"time"
+)
+
+// A retriever that returns no changes right away, as if a held request had just been released.
+type releasedRetriever struct{}
+
+func (r releasedRetriever) Name() string { return "released" }
+
+func (r releasedRetriever) GetChanges(changeID uint64, maxRecords int) (*exchange.ExchangeChanges, error) {
+	return &exchange.ExchangeChanges{MostRecentChangeID: changeID}, nil
+}
+
+func (r releasedRetriever) HoldsRequests() bool { return true }
+
+// A request that was held open does not wait for a worker that is terminating to take its changes.
+func Test_waitForChanges_terminating(t *testing.T) {
+	w := &ChangesWorker{
+		BaseWorker:  worker.BaseWorker{Commands: make(chan worker.Command, 1)},
+		changeID:    10,
+		retriever:   releasedRetriever{},
+		terminating: make(chan bool),
+	}
+
+	// The command queue is full, as it can be when the worker has stopped reading it.
+	w.Commands <- worker.NewBeginShutdownCommand()
+	w.waitForChanges(100)
+	time.Sleep(100 * time.Millisecond)
+
+	w.terminateOnce.Do(func() { close(w.terminating) })
+	time.Sleep(100 * time.Millisecond)
+
+	<-w.Commands
+	select {
+	case cmd := <-w.Commands:
+		t.Errorf("the changes were queued after the worker was terminating, got %v", cmd)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -3,6 +3,7 @@ package changes
 import (
 	"fmt"
 	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/exchange"
 )
 
 // Commands used to communicate with the worker, directing it to do something, usually based on the
@@ -43,3 +44,30 @@ func (c UpdateIntervalCommand) ShortString() string {
 func NewUpdateIntervalCommand(updateType string) *UpdateIntervalCommand {
 	return &UpdateIntervalCommand{UpdateType: updateType}
 }
+
+type ConfigReloadedCommand struct {
+	Msg *events.ConfigReloadedMessage
+}
+
+func (c ConfigReloadedCommand) ShortString() string {
+	return fmt.Sprintf("ConfigReloadedCommand Msg: %v", c.Msg)
+}
+
+func NewConfigReloadedCommand(msg *events.ConfigReloadedMessage) *ConfigReloadedCommand {
+	return &ConfigReloadedCommand{Msg: msg}
+}
+
+// The result of a request for changes that was held open outside of the worker.
+type ChangesRetrievedCommand struct {
+	ChangeID uint64 // The change ID that the changes were requested from.
+	Changes  *exchange.ExchangeChanges
+	Err      error
+}
+
+func (c ChangesRetrievedCommand) ShortString() string {
+	return fmt.Sprintf("ChangesRetrievedCommand ChangeID: %v, Changes: %v, Err: %v", c.ChangeID, c.Changes, c.Err)
+}
+
+func NewChangesRetrievedCommand(changeID uint64, changes *exchange.ExchangeChanges, err error) *ChangesRetrievedCommand {
+	return &ChangesRetrievedCommand{ChangeID: changeID, Changes: changes, Err: err}
+}
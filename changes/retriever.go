@@ -0,0 +1,115 @@
+package changes
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"sync"
+	"time"
+)
+
+// The changes worker gets the changes made in the exchange through a ChangeRetriever. The poller asks the exchange for
+// the changes and returns right away, the worker calls it again when its poll interval is over. The long poll asks the
+// exchange to hold the request open until there is a change, and the worker calls it again as soon as it returns.
+type ChangeRetriever interface {
+	// A short name for the logs.
+	Name() string
+
+	// Returns the changes starting at the change ID. A retriever that holds its requests open returns when there are
+	// changes, or when the exchange has held the request for its wait time.
+	GetChanges(changeID uint64, maxRecords int) (*exchange.ExchangeChanges, error)
+
+	// Returns true while the retriever holds its requests open. It is false while a long poll has fallen back to polling.
+	HoldsRequests() bool
+}
+
+// Create the retriever that the configuration asks for.
+func NewChangeRetriever(cfg *config.ExchangeChangesConfig, ec exchange.ExchangeContext) ChangeRetriever {
+	poller := NewPollingRetriever(exchange.GetHTTPExchangeChangeHandler(ec))
+	if !cfg.IsLongPoll() {
+		return poller
+	}
+	return NewLongPollRetriever(cfg, poller, exchange.GetHTTPExchangeChangeWaitHandler(ec), exchange.GetHTTPExchangeFeatureHandler(ec))
+}
+
+type PollingRetriever struct {
+	getChanges exchange.ExchangeChangeHandler
+}
+
+func NewPollingRetriever(getChanges exchange.ExchangeChangeHandler) *PollingRetriever {
+	return &PollingRetriever{getChanges: getChanges}
+}
+
+func (p *PollingRetriever) Name() string {
+	return config.ExchangeChangesTransport_POLL
+}
+
+func (p *PollingRetriever) GetChanges(changeID uint64, maxRecords int) (*exchange.ExchangeChanges, error) {
+	return p.getChanges(changeID, maxRecords, nil)
+}
+
+func (p *PollingRetriever) HoldsRequests() bool {
+	return false
+}
+
+// The long poll falls back to the poller for a while when the exchange does not support long polls, when a long poll
+// fails, or when the exchange returns no changes well before the wait time is over, which means that it ignored the
+// wait time. While it has fallen back, the changes are retrieved by the poller. The retriever is called from the
+// worker and from the goroutine that holds the request open, so its state is locked.
+type LongPollRetriever struct {
+	lock            sync.Mutex
+	waitS           int
+	fallbackS       int
+	poller          *PollingRetriever
+	waitForChanges  exchange.ExchangeChangeWaitHandler
+	supportsFeature exchange.ExchangeFeatureHandler
+	fallbackUntil   time.Time
+}
+
+func NewLongPollRetriever(cfg *config.ExchangeChangesConfig, poller *PollingRetriever, waitForChanges exchange.ExchangeChangeWaitHandler, supportsFeature exchange.ExchangeFeatureHandler) *LongPollRetriever {
+	return &LongPollRetriever{
+		waitS:           cfg.WaitS,
+		fallbackS:       cfg.FallbackS,
+		poller:          poller,
+		waitForChanges:  waitForChanges,
+		supportsFeature: supportsFeature,
+	}
+}
+
+func (l *LongPollRetriever) Name() string {
+	return config.ExchangeChangesTransport_LONGPOLL
+}
+
+func (l *LongPollRetriever) GetChanges(changeID uint64, maxRecords int) (*exchange.ExchangeChanges, error) {
+	if !l.HoldsRequests() {
+		return l.poller.GetChanges(changeID, maxRecords)
+	} else if !l.supportsFeature(exchange.FEATURE_CHANGES_LONG_POLL) {
+		l.fallBack("the exchange does not support long polls")
+		return l.poller.GetChanges(changeID, maxRecords)
+	}
+
+	start := time.Now()
+	changes, err := l.waitForChanges(changeID, maxRecords, l.waitS)
+	if err != nil {
+		l.fallBack(fmt.Sprintf("the long poll failed, error: %v", err))
+		return l.poller.GetChanges(changeID, maxRecords)
+	} else if changes != nil && len(changes.Changes) == 0 && time.Since(start) < time.Duration(l.waitS)*time.Second/2 {
+		// The changes are returned, so that the worker still sees the exchange version and the latest change ID.
+		l.fallBack(fmt.Sprintf("the exchange returned no changes after %v, without holding the long poll", time.Since(start).Round(time.Millisecond)))
+	}
+	return changes, nil
+}
+
+func (l *LongPollRetriever) HoldsRequests() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return !time.Now().Before(l.fallbackUntil)
+}
+
+func (l *LongPollRetriever) fallBack(reason string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.fallbackUntil = time.Now().Add(time.Duration(l.fallbackS) * time.Second)
+	glog.Warningf(chglog(fmt.Sprintf("polling for changes for %v seconds because %v", l.fallbackS, reason)))
+}
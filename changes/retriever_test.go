@@ -0,0 +1,150 @@
+// +build unit
+
+package changes
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/exchange/mockexchange"
+	"testing"
+	"time"
+)
+
+type retrieved struct {
+	changes *exchange.ExchangeChanges
+	err     error
+	elapsed time.Duration
+}
+
+func getChangesAsync(r ChangeRetriever, changeID uint64) chan retrieved {
+	result := make(chan retrieved, 1)
+	go func() {
+		start := time.Now()
+		changes, err := r.GetChanges(changeID, 100)
+		result <- retrieved{changes: changes, err: err, elapsed: time.Since(start)}
+	}()
+	return result
+}
+
+// The long poll against a stand-in exchange that holds the requests open.
+func Test_LongPollRetriever(t *testing.T) {
+	s := mockexchange.NewServer()
+	defer s.Close()
+	s.SetVersion("2.61.0")
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+	nodeId := "myorg/node1"
+	s.AddNode(nodeId, "nodetoken", exchange.Device{Name: "node1"})
+	s.AddAgbot("myorg/agbot1", "agbottoken", exchange.Agbot{Name: "agbot1"})
+
+	ec := s.ExchangeContext(nodeId, "nodetoken")
+	cfg := config.ExchangeChangesConfig{Transport: config.ExchangeChangesTransport_LONGPOLL, WaitS: 2}.WithDefaults()
+	r := NewChangeRetriever(&cfg, ec)
+	if _, ok := r.(*LongPollRetriever); !ok {
+		t.Fatalf("expected a long poll retriever, got %T", r)
+	} else if !r.HoldsRequests() {
+		t.Fatalf("the long poll should hold its requests open")
+	}
+
+	maxChangeID, err := exchange.GetExchangeChangeID(ec)
+	if err != nil {
+		t.Fatalf("unable to get the max change ID, error: %v", err)
+	}
+	next := maxChangeID.MaxChangeID + 1
+
+	// The request is released by a change that the node can see, not by one that it cannot see.
+	result := getChangesAsync(r, next)
+	time.Sleep(300 * time.Millisecond)
+	if err := s.ServePattern("myorg/agbot1", "myorg", "p1", "myorg"); err != nil {
+		t.Fatalf("unable to serve the pattern, error: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := s.SetNodePolicy(nodeId, exchange.ExchangePolicy{}); err != nil {
+		t.Fatalf("unable to set the node policy, error: %v", err)
+	}
+
+	select {
+	case res := <-result:
+		if res.err != nil {
+			t.Fatalf("unable to get the changes, error: %v", res.err)
+		} else if len(res.changes.Changes) != 1 || !res.changes.Changes[0].IsNodePolicy(nodeId) {
+			t.Errorf("expected the node policy change, got %v", res.changes)
+		} else if res.elapsed < 500*time.Millisecond {
+			t.Errorf("the request was not held open, it returned after %v", res.elapsed)
+		}
+		next = res.changes.MostRecentChangeID + 1
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the change did not release the long poll")
+	}
+
+	// Without changes, the request is held for the wait time.
+	res := <-getChangesAsync(r, next)
+	if res.err != nil {
+		t.Errorf("unable to get the changes, error: %v", res.err)
+	} else if len(res.changes.Changes) != 0 {
+		t.Errorf("expected no changes, got %v", res.changes)
+	} else if res.elapsed < 1500*time.Millisecond {
+		t.Errorf("the request returned after %v, before the wait time", res.elapsed)
+	} else if !r.HoldsRequests() {
+		t.Errorf("the long poll fell back to polling after an empty wait")
+	}
+}
+
+// The long poll falls back to polling against an exchange that does not support it.
+func Test_LongPollRetrieverOldExchange(t *testing.T) {
+	s := mockexchange.NewServer()
+	defer s.Close()
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+	nodeId := "myorg/node1"
+	s.AddNode(nodeId, "nodetoken", exchange.Device{Name: "node1"})
+
+	cfg := config.ExchangeChangesConfig{Transport: config.ExchangeChangesTransport_LONGPOLL, WaitS: 5}.WithDefaults()
+	r := NewChangeRetriever(&cfg, s.ExchangeContext(nodeId, "nodetoken"))
+
+	res := <-getChangesAsync(r, 1)
+	if res.err != nil {
+		t.Errorf("unable to get the changes, error: %v", res.err)
+	} else if len(res.changes.Changes) == 0 {
+		t.Errorf("expected the changes from the poller, got %v", res.changes)
+	} else if res.elapsed > 2*time.Second {
+		t.Errorf("the request was held for %v by an exchange without long polls", res.elapsed)
+	} else if r.HoldsRequests() {
+		t.Errorf("the long poll should have fallen back to polling")
+	}
+}
+
+// The long poll falls back when it fails, or when the exchange does not hold it, and tries again after the fallback time.
+func Test_LongPollRetrieverFallback(t *testing.T) {
+	polled := 0
+	poller := NewPollingRetriever(func(changeId uint64, maxRecords int, orgList []string) (*exchange.ExchangeChanges, error) {
+		polled++
+		return &exchange.ExchangeChanges{MostRecentChangeID: 10}, nil
+	})
+
+	var waitErr error
+	waitForChanges := func(changeId uint64, maxRecords int, waitS int) (*exchange.ExchangeChanges, error) {
+		return &exchange.ExchangeChanges{MostRecentChangeID: 20}, waitErr
+	}
+	supported := func(feature string) bool { return true }
+
+	cfg := config.ExchangeChangesConfig{WaitS: 60, FallbackS: 60}
+	r := NewLongPollRetriever(&cfg, poller, waitForChanges, supported)
+
+	// An exchange that ignores the wait time.
+	if changes, err := r.GetChanges(1, 100); err != nil || changes.MostRecentChangeID != 20 {
+		t.Errorf("expected the changes of the long poll, got %v, error: %v", changes, err)
+	} else if r.HoldsRequests() {
+		t.Errorf("the long poll should fall back when the exchange returns right away")
+	} else if changes, err := r.GetChanges(1, 100); err != nil || changes.MostRecentChangeID != 10 || polled != 1 {
+		t.Errorf("expected the changes of the poller, got %v, error: %v", changes, err)
+	}
+
+	// The long poll is tried again after the fallback time, and a failed long poll is retried by the poller.
+	r.fallbackUntil = time.Now()
+	waitErr = errors.New("status: 400")
+	if changes, err := r.GetChanges(1, 100); err != nil || changes.MostRecentChangeID != 10 || polled != 2 {
+		t.Errorf("expected the changes of the poller, got %v, error: %v", changes, err)
+	} else if r.HoldsRequests() {
+		t.Errorf("the long poll should fall back when it fails")
+	}
+}
@@ -3,10 +3,14 @@ package agreementbot
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/open-horizon/anax/agreementbot"
 	agbot "github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/cli/cliutils"
 	"github.com/open-horizon/anax/i18n"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 )
 
 type ActiveAgreement struct {
@@ -154,3 +158,42 @@ func AgreementCancel(agreementId string, allAgreements bool) {
 		cliutils.HorizonDelete("agreement/"+id, []int{200, 204}, []int{}, false)
 	}
 }
+
+// Parse a time given either as seconds since the epoch or in RFC3339 format. An empty string is 0.
+func parseTime(name string, t string) uint64 {
+	if t == "" {
+		return 0
+	} else if secs, err := strconv.ParseUint(t, 10, 64); err == nil {
+		return secs
+	} else if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+		return uint64(parsed.Unix())
+	}
+	cliutils.Fatal(cliutils.CLI_INPUT_ERROR, i18n.GetMessagePrinter().Sprintf("%v must be seconds since the epoch or an RFC3339 time, for example 2020-01-31T00:00:00Z, it was %v", name, t))
+	return 0
+}
+
+// Ask the agbot to export the archived agreements that were in effect during a time range to a file in its archive
+// export directory.
+func AgreementExport(start string, end string, format string) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	exportReq := agreementbot.ExportRequest{
+		Start:  parseTime("start", start),
+		End:    parseTime("end", end),
+		Format: format,
+	}
+
+	if err := os.Setenv("HORIZON_URL", cliutils.GetAgbotUrlBase()); err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to set env var 'HORIZON_URL', error %v", err))
+	}
+
+	_, respBody, _ := cliutils.HorizonPutPost(http.MethodPost, "export/agreement", []int{201}, exportReq, true)
+
+	var resp agreementbot.ExportResponse
+	if err := json.Unmarshal([]byte(respBody), &resp); err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal agbot export response %v, error: %v", respBody, err))
+	}
+	msgPrinter.Printf("Exported %v archived agreements to %v on the agbot host.", resp.Agreements, resp.File)
+	msgPrinter.Println()
+}
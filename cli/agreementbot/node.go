@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/open-horizon/anax/agreementbot"
+	"github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/apicommon"
 	"github.com/open-horizon/anax/cli/cliutils"
 	"github.com/open-horizon/anax/i18n"
@@ -57,3 +58,20 @@ func List() {
 	}
 	fmt.Printf("%s\n", jsonBytes) //todo: is there a way to output with json syntax highlighting like jq does?
 }
+
+// Display the applied schema version of the agbot database and the migrations that are not applied yet.
+func DatabaseStatus() {
+	// set env to call agbot url
+	if err := os.Setenv("HORIZON_URL", cliutils.GetAgbotUrlBase()); err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, i18n.GetMessagePrinter().Sprintf("unable to set env var 'HORIZON_URL', error %v", err))
+	}
+
+	status := persistence.SchemaStatus{}
+	cliutils.HorizonGet("status/database", []int{200}, &status, false)
+
+	jsonBytes, err := json.MarshalIndent(status, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, i18n.GetMessagePrinter().Sprintf("failed to marshal 'hzn agbot database' output: %v", err))
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
@@ -0,0 +1,151 @@
+package agreementbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/stats"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/i18n"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The number of cancellation reasons shown for each group without the long option.
+const TOP_CANCEL_REASONS = 5
+
+type StatsInterval struct {
+	Start     string `json:"start"`
+	Created   int    `json:"created"`
+	Cancelled int    `json:"cancelled"`
+}
+
+type StatsGroup struct {
+	Created            int                 `json:"created"`
+	Cancelled          int                 `json:"cancelled"`
+	MeanTimeToAccept   string              `json:"mean_time_to_accept"`
+	MeanTimeToFinalize string              `json:"mean_time_to_finalize"`
+	CancelReasons      []stats.ReasonCount `json:"cancel_reasons"`
+	Intervals          []StatsInterval     `json:"intervals,omitempty"`
+}
+
+type StatsServiceVersion struct {
+	Service        string `json:"service"`
+	Version        string `json:"version"`
+	Agreements     int    `json:"agreements"`
+	Rollbacks      int    `json:"rollbacks"`
+	RollbackRate   string `json:"rollback_rate"`
+	WorkloadUsages int    `json:"current_nodes"`
+	Retries        int    `json:"current_retries"`
+}
+
+// The agreement statistics with readable times, durations and rates.
+type AgreementStats struct {
+	Start            string                `json:"start"`
+	End              string                `json:"end"`
+	Interval         string                `json:"interval"`
+	GroupBy          string                `json:"group_by"`
+	Totals           StatsGroup            `json:"totals"`
+	Groups           map[string]StatsGroup `json:"groups"`
+	ServiceRollbacks []StatsServiceVersion `json:"service_rollbacks"`
+}
+
+func formatMean(d stats.DurationStats) string {
+	if d.Count == 0 {
+		return ""
+	}
+	return (time.Duration(d.MeanS*float64(time.Second))).Round(time.Second).String()
+}
+
+func newStatsGroup(g *stats.GroupStats, long bool) StatsGroup {
+	sg := StatsGroup{
+		Created:            g.Created,
+		Cancelled:          g.Cancelled,
+		MeanTimeToAccept:   formatMean(g.TimeToAccept),
+		MeanTimeToFinalize: formatMean(g.TimeToFinalize),
+		CancelReasons:      g.CancelReasons,
+	}
+	if !long && len(sg.CancelReasons) > TOP_CANCEL_REASONS {
+		sg.CancelReasons = sg.CancelReasons[:TOP_CANCEL_REASONS]
+	}
+	if long {
+		sg.Intervals = make([]StatsInterval, 0, len(g.Intervals))
+		for _, i := range g.Intervals {
+			sg.Intervals = append(sg.Intervals, StatsInterval{Start: cliutils.ConvertTime(i.Start), Created: i.Created, Cancelled: i.Cancelled})
+		}
+	}
+	return sg
+}
+
+// Display the agreement statistics computed by the agbot. The interval is a duration such as 1h or 30m.
+func Stats(start string, end string, interval string, groupBy string, long bool) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	params := url.Values{}
+	if s := parseTime("start", start); s != 0 {
+		params.Set("start", strconv.FormatUint(s, 10))
+	}
+	if e := parseTime("end", end); e != 0 {
+		params.Set("end", strconv.FormatUint(e, 10))
+	}
+	if interval != "" {
+		if d, err := time.ParseDuration(interval); err != nil || d < time.Second {
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("interval must be a duration of at least 1s, for example 1h or 30m, it was %v", interval))
+		} else {
+			params.Set("interval", strconv.FormatInt(int64(d/time.Second), 10))
+		}
+	}
+	if groupBy != "" {
+		params.Set("groupby", groupBy)
+	}
+
+	if err := os.Setenv("HORIZON_URL", cliutils.GetAgbotUrlBase()); err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to set env var 'HORIZON_URL', error %v", err))
+	}
+
+	urlSuffix := "stats/agreement"
+	if len(params) != 0 {
+		urlSuffix += "?" + params.Encode()
+	}
+
+	var apiOutput stats.AgreementStats
+	cliutils.HorizonGet(urlSuffix, []int{200}, &apiOutput, false)
+
+	output := AgreementStats{
+		Start:            cliutils.ConvertTime(apiOutput.Start),
+		End:              cliutils.ConvertTime(apiOutput.End),
+		Interval:         (time.Duration(apiOutput.IntervalS) * time.Second).String(),
+		GroupBy:          apiOutput.GroupBy,
+		Groups:           make(map[string]StatsGroup),
+		ServiceRollbacks: make([]StatsServiceVersion, 0, len(apiOutput.Services)),
+	}
+	if apiOutput.Totals != nil {
+		output.Totals = newStatsGroup(apiOutput.Totals, long)
+	}
+	for key, g := range apiOutput.Groups {
+		output.Groups[key] = newStatsGroup(g, long)
+	}
+
+	// Show the service versions with the most rollbacks first.
+	sort.SliceStable(apiOutput.Services, func(i, j int) bool { return apiOutput.Services[i].Rollbacks > apiOutput.Services[j].Rollbacks })
+	for _, s := range apiOutput.Services {
+		output.ServiceRollbacks = append(output.ServiceRollbacks, StatsServiceVersion{
+			Service:        s.Service,
+			Version:        s.Version,
+			Agreements:     s.Agreements,
+			Rollbacks:      s.Rollbacks,
+			RollbackRate:   fmt.Sprintf("%.1f%%", s.RollbackRate*100),
+			WorkloadUsages: s.WorkloadUsages,
+			Retries:        s.Retries,
+		})
+	}
+
+	jsonBytes, err := json.MarshalIndent(output, "", cliutils.JSON_INDENT)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'hzn agbot stats' output: %v", err))
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
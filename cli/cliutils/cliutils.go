@@ -1094,6 +1094,7 @@ func InvokeRestApi(httpClient *http.Client, method string, urlPath string, crede
 		Fatal(CLI_GENERAL_ERROR, err.Error())
 	}
 
+	retry := exchange.NewRetryPolicy(maxRetries, retryInterval)
 	retryCount := 0
 	for {
 		retryCount++
@@ -1168,7 +1169,7 @@ func InvokeRestApi(httpClient *http.Client, method string, urlPath string, crede
 			if retryCount <= maxRetries {
 				Verbose(msgPrinter.Sprintf("Encountered HTTP error: %v calling %v REST API %v. HTTP status: %v. Will retry.", err, service, apiMsg, http_status))
 				// retry for network tranport errors
-				time.Sleep(time.Duration(retryInterval) * time.Second)
+				time.Sleep(retry.NextDelay(exchange.RetryAfter(resp)))
 				continue
 			} else {
 				Fatal(HTTP_ERROR, msgPrinter.Sprintf("Encountered HTTP error: %v calling %v REST API %v. HTTP status: %v.", err, service, apiMsg, http_status))
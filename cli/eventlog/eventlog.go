@@ -3,10 +3,13 @@ package eventlog
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/open-horizon/anax/api"
 	"github.com/open-horizon/anax/cli/cliutils"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/persistence"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -187,3 +190,40 @@ func ListSurfaced(long bool) {
 		fmt.Printf("%s\n", jsonBytes)
 	}
 }
+
+// Prune the event log. Limits that are negative are not sent, so that the agent uses its configured retention
+// policy for them.
+func Prune(maxAgeH int, severityMaxAgeH map[string]string, maxCount int) {
+	msgPrinter := i18n.GetMessagePrinter()
+
+	input := api.EventLogPruneInput{}
+	if maxAgeH >= 0 {
+		input.MaxAgeH = &maxAgeH
+	}
+	if maxCount >= 0 {
+		input.MaxCount = &maxCount
+	}
+	if len(severityMaxAgeH) != 0 {
+		input.SeverityMaxAgeH = make(map[string]int)
+		for severity, age := range severityMaxAgeH {
+			if a, err := strconv.Atoi(age); err != nil || a < 0 {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("The maximum age %v for severity %v is not a non-negative number of hours.", age, severity))
+			} else {
+				input.SeverityMaxAgeH[severity] = a
+			}
+		}
+	}
+
+	_, respBody, _ := cliutils.HorizonPutPost(http.MethodPost, "eventlog/prune", []int{200}, input, true)
+
+	var summary persistence.EventLogPruneSummary
+	if err := json.Unmarshal([]byte(respBody), &summary); err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal 'hzn eventlog prune' output: %v", err))
+	}
+
+	jsonBytes, err := cliutils.DisplayAsJson(summary)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'hzn eventlog prune' output: %v", err))
+	}
+	fmt.Printf("%s\n", jsonBytes)
+}
@@ -395,6 +395,15 @@ Environment Variables:
 
 	nodeCmd := app.Command("node", msgPrinter.Sprintf("List and manage general information about this Horizon edge node."))
 	nodeListCmd := nodeCmd.Command("list", msgPrinter.Sprintf("Display general information about this Horizon edge node."))
+	nodeDiagnosticsCmd := nodeCmd.Command("diagnostics", msgPrinter.Sprintf("Collect the event log, node, agreement, service configuration state, container logs, censored agent configuration, the Exchange view of the node and a dump of the local database into a single tar.gz file for troubleshooting."))
+	nodeDiagnosticsFile := nodeDiagnosticsCmd.Flag("output-file", msgPrinter.Sprintf("The file to save the diagnostics to. The default is node_diagnostics.tar.gz in the current directory.")).Short('f').String()
+	nodeBackupCmd := nodeCmd.Command("backup", msgPrinter.Sprintf("Save a consistent copy of the local state of this registered Horizon edge node (agreements, user input, attributes, event log) to a tar.gz file. The agent keeps running while the backup is taken."))
+	nodeBackupFile := nodeBackupCmd.Flag("output-file", msgPrinter.Sprintf("The file to save the backup to. The default is node_backup.tar.gz in the current directory.")).Short('f').String()
+	nodeRestoreCmd := nodeCmd.Command("restore", msgPrinter.Sprintf("Replace the local state of this Horizon edge node with a backup taken by 'hzn node backup'. The backup must be for the node this agent is registered as, or this agent must not be registered yet, and it must use the same Exchange. The running containers are reconciled with the restored agreements."))
+	nodeRestoreFile := nodeRestoreCmd.Arg("backup-file", msgPrinter.Sprintf("The backup file created by 'hzn node backup'.")).Required().String()
+	nodeRestoreForce := nodeRestoreCmd.Flag("force", msgPrinter.Sprintf("Skip the 'are you sure?' prompt.")).Short('f').Bool()
+	nodeDBCheckCmd := nodeCmd.Command("dbcheck", msgPrinter.Sprintf("Cross check the agreements, service definitions, service instances, attributes, node status and containers in the local state of this Horizon edge node and report the inconsistencies."))
+	nodeDBCheckRepair := nodeDBCheckCmd.Flag("repair", msgPrinter.Sprintf("Also repair the inconsistencies that can be fixed without disrupting the running services.")).Bool()
 
 	policyCmd := app.Command("policy", msgPrinter.Sprintf("List and manage policy for this Horizon edge node."))
 	policyListCmd := policyCmd.Command("list", msgPrinter.Sprintf("Display this edge node's policy."))
@@ -510,6 +519,10 @@ Environment Variables:
 	listSelectedEventlogs := eventlogListCmd.Flag("select", msgPrinter.Sprintf("Selection string. This flag can be repeated which means 'AND'. Each flag should be in the format of attribute=value, attribute~value, \"attribute>value\" or \"attribute<value\", where '~' means contains. The common attribute names are timestamp, severity, message, event_code, source_type, agreement_id, service_url etc. Use the '-l' flag to see all the attribute names.")).Short('s').Strings()
 	surfaceErrorsEventlogs := eventlogCmd.Command("surface", msgPrinter.Sprintf("List all the active errors that will be shared with the Exchange if the node is online."))
 	surfaceErrorsEventlogsLong := surfaceErrorsEventlogs.Flag("long", msgPrinter.Sprintf("List the full event logs of the surface errors.")).Short('l').Bool()
+	pruneEventlogs := eventlogCmd.Command("prune", msgPrinter.Sprintf("Remove old event logs from the node. The limits that are not specified are taken from the retention policy in the agent's configuration. The event logs of the errors that are surfaced to the Exchange are never removed."))
+	pruneEventlogsMaxAge := pruneEventlogs.Flag("max-age", msgPrinter.Sprintf("Remove the event logs that are older than this many hours. 0 means no age limit.")).Default("-1").Int()
+	pruneEventlogsSeverityMaxAge := pruneEventlogs.Flag("severity-max-age", msgPrinter.Sprintf("The maximum age in hours of the event logs of a severity, in the format severity=hours. It overrides --max-age for that severity. This flag can be repeated.")).StringMap()
+	pruneEventlogsMaxCount := pruneEventlogs.Flag("max-count", msgPrinter.Sprintf("Remove the oldest event logs until at most this many remain. 0 means no count limit.")).Default("-1").Int()
 
 	devCmd := app.Command("dev", msgPrinter.Sprintf("Development tools for creation of services."))
 	devHomeDirectory := devCmd.Flag("directory", msgPrinter.Sprintf("Directory containing Horizon project metadata. If omitted, a subdirectory called 'horizon' under current directory will be used.")).Short('d').String()
@@ -567,6 +580,7 @@ Environment Variables:
 	agbotCacheDeployPolListName := agbotCacheDeployPolList.Arg("name", msgPrinter.Sprintf("Display this policy.")).String()
 	agbotCacheDeployPolListLong := agbotCacheDeployPolList.Flag("long", msgPrinter.Sprintf("Display detailed info.")).Short('l').Bool()
 
+	agbotDatabaseCmd := agbotCmd.Command("database", msgPrinter.Sprintf("Display the schema version of the Horizon agreement bot database and the schema migrations that have not been applied."))
 	agbotListCmd := agbotCmd.Command("list", msgPrinter.Sprintf("Display general information about this Horizon agbot node."))
 	agbotAgreementCmd := agbotCmd.Command("agreement", msgPrinter.Sprintf("List or manage the active or archived agreements this Horizon agreement bot has with edge nodes."))
 	agbotAgreementListCmd := agbotAgreementCmd.Command("list", msgPrinter.Sprintf("List the active or archived agreements this Horizon agreement bot has with edge nodes."))
@@ -575,10 +589,20 @@ Environment Variables:
 	agbotAgreementCancelCmd := agbotAgreementCmd.Command("cancel", msgPrinter.Sprintf("Cancel 1 or all of the active agreements this Horizon agreement bot has with edge nodes. Usually an agbot will immediately negotiated a new agreement. "))
 	agbotCancelAllAgreements := agbotAgreementCancelCmd.Flag("all", msgPrinter.Sprintf("Cancel all of the current agreements.")).Short('a').Bool()
 	agbotCancelAgreementId := agbotAgreementCancelCmd.Arg("agreement", msgPrinter.Sprintf("The active agreement to cancel.")).String()
+	agbotAgreementExportCmd := agbotAgreementCmd.Command("export", msgPrinter.Sprintf("Export the archived agreements that were in effect during a time range to a file in the archive export directory of the Horizon agreement bot."))
+	agbotAgreementExportStart := agbotAgreementExportCmd.Flag("start", msgPrinter.Sprintf("The start of the time range, in seconds since the epoch or RFC3339 format. The default is the earliest archived agreement.")).Short('s').String()
+	agbotAgreementExportEnd := agbotAgreementExportCmd.Flag("end", msgPrinter.Sprintf("The end of the time range, in seconds since the epoch or RFC3339 format. The default is now.")).Short('e').String()
+	agbotAgreementExportFormat := agbotAgreementExportCmd.Flag("format", msgPrinter.Sprintf("The format of the export file, json or csv. The default is the format configured for the agbot.")).Short('f').Enum("json", "csv")
 	agbotPolicyCmd := agbotCmd.Command("policy", msgPrinter.Sprintf("List the policies this Horizon agreement bot hosts."))
 	agbotPolicyListCmd := agbotPolicyCmd.Command("list", msgPrinter.Sprintf("List policies this Horizon agreement bot hosts."))
 	agbotPolicyOrg := agbotPolicyListCmd.Arg("org", msgPrinter.Sprintf("The organization the policy belongs to.")).String()
 	agbotPolicyName := agbotPolicyListCmd.Arg("name", msgPrinter.Sprintf("The policy name.")).String()
+	agbotStatsCmd := agbotCmd.Command("stats", msgPrinter.Sprintf("Display statistics about the agreements this Horizon agreement bot has made with edge nodes: agreements created and cancelled, the time taken to accept and finalize agreements, the most common cancellation reasons, and service version rollbacks."))
+	agbotStatsStart := agbotStatsCmd.Flag("start", msgPrinter.Sprintf("The start of the time window, in seconds since the epoch or RFC3339 format. The default is 24 hours before the end.")).Short('s').String()
+	agbotStatsEnd := agbotStatsCmd.Flag("end", msgPrinter.Sprintf("The end of the time window, in seconds since the epoch or RFC3339 format. The default is now.")).Short('e').String()
+	agbotStatsInterval := agbotStatsCmd.Flag("interval", msgPrinter.Sprintf("The length of each interval in the time window, for example 1h or 15m. The default is 1h.")).Short('i').String()
+	agbotStatsGroupBy := agbotStatsCmd.Flag("groupby", msgPrinter.Sprintf("Group the agreements by policy, pattern, org, service or none. The default is policy.")).Short('g').Enum("policy", "pattern", "org", "service", "none")
+	agbotStatsLong := agbotStatsCmd.Flag("long", msgPrinter.Sprintf("Show the agreements created and cancelled in each interval, and all of the cancellation reasons.")).Short('l').Bool()
 	agbotStatusCmd := agbotCmd.Command("status", msgPrinter.Sprintf("Display the current horizon internal status for the Horizon agreement bot."))
 	agbotStatusLong := agbotStatusCmd.Flag("long", msgPrinter.Sprintf("Show detailed status")).Short('l').Bool()
 
@@ -988,6 +1012,14 @@ Environment Variables:
 		key.Remove(*keyDelName)
 	case nodeListCmd.FullCommand():
 		node.List()
+	case nodeDiagnosticsCmd.FullCommand():
+		node.Diagnostics(*nodeDiagnosticsFile)
+	case nodeBackupCmd.FullCommand():
+		node.Backup(*nodeBackupFile)
+	case nodeRestoreCmd.FullCommand():
+		node.Restore(*nodeRestoreFile, *nodeRestoreForce)
+	case nodeDBCheckCmd.FullCommand():
+		node.DBCheck(*nodeDBCheckRepair)
 	case policyListCmd.FullCommand():
 		policy.List()
 	case policyNewCmd.FullCommand():
@@ -1042,6 +1074,8 @@ Environment Variables:
 		eventlog.List(*listAllEventlogs, *listDetailedEventlogs, *listSelectedEventlogs, *listTail)
 	case surfaceErrorsEventlogs.FullCommand():
 		eventlog.ListSurfaced(*surfaceErrorsEventlogsLong)
+	case pruneEventlogs.FullCommand():
+		eventlog.Prune(*pruneEventlogsMaxAge, *pruneEventlogsSeverityMaxAge, *pruneEventlogsMaxCount)
 	case devServiceNewCmd.FullCommand():
 		dev.ServiceNew(*devHomeDirectory, *devServiceNewCmdOrg, *devServiceNewCmdName, *devServiceNewCmdVer, *devServiceNewCmdImage, *devServiceNewCmdNoImageGen, *devServiceNewCmdCfg, *devServiceNewCmdNoPattern, *devServiceNewCmdNoPolicy)
 	case devServiceStartTestCmd.FullCommand():
@@ -1062,6 +1096,10 @@ Environment Variables:
 		agreementbot.AgreementList(*agbotlistArchivedAgreements, *agbotAgreement)
 	case agbotAgreementCancelCmd.FullCommand():
 		agreementbot.AgreementCancel(*agbotCancelAgreementId, *agbotCancelAllAgreements)
+	case agbotAgreementExportCmd.FullCommand():
+		agreementbot.AgreementExport(*agbotAgreementExportStart, *agbotAgreementExportEnd, *agbotAgreementExportFormat)
+	case agbotDatabaseCmd.FullCommand():
+		agreementbot.DatabaseStatus()
 	case agbotListCmd.FullCommand():
 		agreementbot.List()
 	case agbotPolicyListCmd.FullCommand():
@@ -1070,6 +1108,8 @@ Environment Variables:
 		utilcmds.Sign(*utilSignPrivKeyFile)
 	case utilVerifyCmd.FullCommand():
 		utilcmds.Verify(*utilVerifyPubKeyFile, *utilVerifySig)
+	case agbotStatsCmd.FullCommand():
+		agreementbot.Stats(*agbotStatsStart, *agbotStatsEnd, *agbotStatsInterval, *agbotStatsGroupBy, *agbotStatsLong)
 	case agbotStatusCmd.FullCommand():
 		status.DisplayStatus(*agbotStatusLong, true)
 	case utilConfigConvCmd.FullCommand():
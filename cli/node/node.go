@@ -9,6 +9,8 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/version"
+	"io/ioutil"
+	"net/http"
 	"strings"
 )
 
@@ -33,6 +35,18 @@ type NodeAndStatus struct {
 	// from apicommon.Info
 	Configuration *apicommon.Configuration `json:"configuration"`
 	Connectivity  map[string]bool          `json:"connectivity,omitempty"`
+
+	// The updates waiting to be sent to the exchange.
+	Outbox *OutboxStatus `json:"outbox,omitempty"`
+
+	// The features that were detected in the exchange, true when the exchange has the feature.
+	ExchangeCapabilities map[string]bool `json:"exchange_capabilities,omitempty"`
+}
+
+type OutboxStatus struct {
+	QueueDepth      int    `json:"queue_depth"`
+	OldestEntryTime string `json:"oldest_entry_time,omitempty"`
+	OldestEntryAgeS uint64 `json:"oldest_entry_age_s,omitempty"`
 }
 
 // CopyNodeInto copies the node info into our output struct and converts times in the process
@@ -59,6 +73,13 @@ func (n *NodeAndStatus) CopyNodeInto(horDevice *api.HorizonDevice) {
 func (n *NodeAndStatus) CopyStatusInto(status *apicommon.Info) {
 	//todo: I don't like having to repeat all of these fields, hard to maintain. Maybe use reflection?
 	n.Configuration = status.Configuration
+	n.ExchangeCapabilities = status.ExchangeCapabilities
+	if status.Outbox != nil {
+		n.Outbox = &OutboxStatus{QueueDepth: status.Outbox.QueueDepth, OldestEntryAgeS: status.Outbox.OldestEntryAgeS}
+		if status.Outbox.OldestEntryTime != 0 {
+			n.Outbox.OldestEntryTime = cliutils.ConvertTime(status.Outbox.OldestEntryTime)
+		}
+	}
 }
 
 func List() {
@@ -135,3 +156,90 @@ func Env(org, userPw, exchUrl, cssUrl string) {
 	msgPrinter.Printf("HZN_FSS_CSSURL: %s", cssUrl)
 	msgPrinter.Println()
 }
+
+// Diagnostics saves the node diagnostics bundle created by the agent to the given file.
+func Diagnostics(outputFile string) {
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if outputFile == "" {
+		outputFile = api.DIAG_BUNDLE_FILE_NAME
+	}
+
+	// The bundle is a gzipped tar file, so the response body is not processed.
+	var bundle string
+	cliutils.HorizonGet("node/diagnostics", []int{200}, &bundle, false)
+
+	if err := ioutil.WriteFile(outputFile, []byte(bundle), 0600); err != nil {
+		cliutils.Fatal(cliutils.FILE_IO_ERROR, msgPrinter.Sprintf("failed to write the node diagnostics to %v: %v", outputFile, err))
+	}
+
+	msgPrinter.Printf("Node diagnostics saved to %v.", outputFile)
+	msgPrinter.Println()
+}
+
+func Backup(outputFile string) {
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if outputFile == "" {
+		outputFile = api.BACKUP_FILE_NAME
+	}
+
+	// The backup is a gzipped tar file, so the response body is not processed.
+	var backup string
+	cliutils.HorizonGet("node/backup", []int{200}, &backup, false)
+
+	if err := ioutil.WriteFile(outputFile, []byte(backup), 0600); err != nil {
+		cliutils.Fatal(cliutils.FILE_IO_ERROR, msgPrinter.Sprintf("failed to write the node backup to %v: %v", outputFile, err))
+	}
+
+	msgPrinter.Printf("Node backup saved to %v.", outputFile)
+	msgPrinter.Println()
+}
+
+func Restore(backupFile string, force bool) {
+	msgPrinter := i18n.GetMessagePrinter()
+
+	backup, err := ioutil.ReadFile(backupFile)
+	if err != nil {
+		cliutils.Fatal(cliutils.FILE_IO_ERROR, msgPrinter.Sprintf("failed to read the node backup from %v: %v", backupFile, err))
+	}
+
+	if !force {
+		cliutils.ConfirmRemove(msgPrinter.Sprintf("Are you sure you want to replace the local state of this Horizon node with the backup in %v?", backupFile))
+	}
+
+	cliutils.HorizonPutPost(http.MethodPut, "node/restore", []int{200}, backup, true)
+
+	msgPrinter.Printf("Node restored from %v.", backupFile)
+	msgPrinter.Println()
+}
+
+// Check the consistency of the node's local database, and optionally repair the inconsistencies that can be fixed
+// safely.
+func DBCheck(repair bool) {
+	msgPrinter := i18n.GetMessagePrinter()
+
+	var report api.NodeDBCheckReport
+	if repair {
+		_, respBody, _ := cliutils.HorizonPutPost(http.MethodPost, "node/dbcheck", []int{200}, nil, true)
+		if err := json.Unmarshal([]byte(respBody), &report); err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal 'hzn node dbcheck' output: %v", err))
+		}
+	} else {
+		cliutils.HorizonGet("node/dbcheck", []int{200}, &report, false)
+	}
+
+	jsonBytes, err := cliutils.DisplayAsJson(report)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'hzn node dbcheck' output: %v", err))
+	}
+	fmt.Printf("%s\n", jsonBytes)
+
+	found, repaired := report.Counts()
+	if repair {
+		msgPrinter.Printf("Found %v inconsistencies in the node database, repaired %v.", found, repaired)
+	} else {
+		msgPrinter.Printf("Found %v inconsistencies in the node database. Use 'hzn node dbcheck --repair' to repair them.", found)
+	}
+	msgPrinter.Println()
+}
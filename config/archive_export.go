@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+)
+
+const ArchiveExportFormat_JSON = "json"
+const ArchiveExportFormat_CSV = "csv"
+
+// The configuration for exporting archived agreements to files before they are purged from the agbot database. Export
+// is turned off unless a Path is configured.
+type ArchiveExportConfig struct {
+	Path          string // The directory where export files are written.
+	Format        string // The format of the export files, either json (JSON lines) or csv. The default is json.
+	MaxFileSizeKB int64  // The size at which the current export file is rotated. The default is 10240 KB.
+	MaxFiles      int    // The number of rotated export files to keep, the oldest are deleted. 0 means keep all of them.
+}
+
+func (e *ArchiveExportConfig) String() string {
+	return fmt.Sprintf("Path: %v, Format: %v, MaxFileSizeKB: %v, MaxFiles: %v", e.Path, e.Format, e.MaxFileSizeKB, e.MaxFiles)
+}
+
+// Returns true if archived agreements should be exported.
+func (e *ArchiveExportConfig) IsEnabled() bool {
+	return e.Path != ""
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The configuration of the audit log. The audit log records every change that the node or agbot makes in the exchange,
+// so that a security review can see what was changed and when. The audit log is turned off unless a Path is configured.
+type AuditLogConfig struct {
+	Path          string // The directory where audit log files are written.
+	MaxFileSizeKB int64  // The size at which the current audit log file is rotated. The default is 10240 KB.
+	MaxFiles      int    // The number of rotated audit log files to keep, the oldest are deleted. 0 means keep all of them.
+}
+
+func (a *AuditLogConfig) String() string {
+	return fmt.Sprintf("Path: %v, MaxFileSizeKB: %v, MaxFiles: %v", a.Path, a.MaxFileSizeKB, a.MaxFiles)
+}
+
+// Returns the configuration with the defaults for the fields that are not set.
+func (a AuditLogConfig) WithDefaults() AuditLogConfig {
+	if a.MaxFileSizeKB == 0 {
+		a.MaxFileSizeKB = AuditLogMaxFileSizeKB_DEFAULT
+	}
+	return a
+}
+
+// Returns true if the exchange changes should be audited.
+func (a *AuditLogConfig) IsEnabled() bool {
+	return a.Path != ""
+}
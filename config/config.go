@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/golang/glog"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -21,6 +23,18 @@ type HorizonConfig struct {
 	AgreementBot  AGConfig
 	Collaborators Collaborators
 	ArchSynonyms  ArchSynonyms
+	Watchdog      WatchdogConfig
+	EventJournal  EventJournalConfig
+	Log           LogConfig
+	ExchangeRetry ExchangeRetryConfig
+	ExchangeCache ExchangeCacheConfig
+
+	// The keys and the envelope of the agreement protocol messages, for both the node and the agbot.
+	MessageKeyRotation MessageKeyRotationConfig
+	MessageEnvelope    MessageEnvelopeConfig
+
+	// The record of the changes made in the exchange, for both the node and the agbot.
+	AuditLog AuditLogConfig
 }
 
 // This is the configuration options for Edge component flavor of Anax
@@ -67,6 +81,12 @@ type Config struct {
 	InitialPollingBuffer             int       // the number of seconds to wait before increasing the polling interval while there is no agreement on the node.
 	MaxAgreementPrelaunchTimeM       int64     // The maximum numbers of minutes to wait for workload to start in an agreement
 
+	// The retention policy for the event log. The default is to keep all the event log records.
+	EventLogRetention EventLogRetentionConfig
+
+	// How the node gets the changes in the exchange. The default is to poll.
+	ExchangeChanges ExchangeChangesConfig
+
 	// these Ids could be provided in config or discovered after startup by the system
 	BlockchainAccountId        string
 	BlockchainDirectoryAddress string
@@ -78,6 +98,7 @@ type AGConfig struct {
 	AgreementWorkers             int
 	DBPath                       string
 	Postgresql                   PostgresqlConfig // The Postgresql config if it is being used
+	InMemoryDB                   bool             // When true, the agbot keeps its database in memory. Nothing survives a restart, so this is only for tests and ephemeral agbots.
 	PartitionStale               uint64           // Number of seconds to wait before declaring a partition to be stale (i.e. the previous owner has unexpectedly terminated).
 	ProtocolTimeoutS             uint64           // Number of seconds to wait before declaring proposal response is lost
 	AgreementTimeoutS            uint64           // Number of seconds to wait before declaring agreement not finalized in blockchain
@@ -115,6 +136,10 @@ type AGConfig struct {
 	MaxExchangeChanges           int              // The maximum number of exchange changes to request on a given call the exchange /changes API.
 	RetryLookBackWindow          uint64           // The time window (in seconds) used by the agbot to look backward in time for node changes when node agreements are retried.
 	PolicySearchOrder            bool             // When true, search policies from most recently changed to least recently changed.
+	ExchangeChangesRetentionS    int              // The number of seconds the exchange keeps its changes. When the agbot has not read the changes for longer, it rescans everything. The default is 14400.
+
+	// Export archived agreements to files before they are purged. The default is no export.
+	ArchiveExport ArchiveExportConfig
 }
 
 func (c *HorizonConfig) UserPublicKeyPath() string {
@@ -133,6 +158,10 @@ func (c *HorizonConfig) IsBoltDBConfigured() bool {
 	return len(c.AgreementBot.DBPath) != 0
 }
 
+func (c *HorizonConfig) IsInMemoryDBConfigured() bool {
+	return c.AgreementBot.InMemoryDB
+}
+
 func (c *HorizonConfig) IsPostgresqlConfigured() bool {
 	return (c.AgreementBot.Postgresql != (PostgresqlConfig{})) && (c.GetPartitionStale() != 0)
 }
@@ -154,6 +183,8 @@ func (c *HorizonConfig) GetAgbotCSSCert() string {
 }
 
 func (c *HorizonConfig) GetAgbotAgreementBatchSize() uint64 {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
 	return c.AgreementBot.AgreementBatchSize
 }
 
@@ -162,9 +193,29 @@ func (c *HorizonConfig) GetAgbotAgreementQueueSize() uint64 {
 }
 
 func (c *HorizonConfig) GetAgbotFullRescan() uint64 {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
 	return c.AgreementBot.FullRescanS
 }
 
+func (c *HorizonConfig) GetExchangeMessagePollInterval() int {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return c.Edge.ExchangeMessagePollInterval
+}
+
+func (c *HorizonConfig) GetSurfaceErrorTimeoutS() int {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return c.Edge.SurfaceErrorTimeoutS
+}
+
+func (c *HorizonConfig) GetLogVerbosity() int {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return c.Log.Verbosity
+}
+
 func (c *HorizonConfig) GetAgbotRetryLookBackWindow() uint64 {
 	return c.AgreementBot.RetryLookBackWindow
 }
@@ -173,6 +224,13 @@ func (c *HorizonConfig) GetAgbotPolicyOrder() bool {
 	return c.AgreementBot.PolicySearchOrder
 }
 
+func (c *HorizonConfig) GetAgbotExchangeChangesRetentionS() int {
+	if c.AgreementBot.ExchangeChangesRetentionS == 0 {
+		return ExchangeChangesRetentionS_DEFAULT
+	}
+	return c.AgreementBot.ExchangeChangesRetentionS
+}
+
 func getDefaultBase() string {
 	basePath := os.Getenv("HZN_VAR_BASE")
 	if basePath == "" {
@@ -249,8 +307,15 @@ func Read(file string) (*HorizonConfig, error) {
 			},
 		}
 
-		err := json.NewDecoder(path).Decode(&config)
+		data, err := ioutil.ReadAll(path)
 		if err != nil {
+			return nil, fmt.Errorf("Unable to read config file: %s. Error: %v", file, err)
+		}
+
+		// Unknown keys and values of the wrong type are reported along with the other problems found by validation.
+		problems := CheckConfigFile(data)
+		err = json.Unmarshal(data, &config)
+		if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
 			return nil, fmt.Errorf("Unable to decode content of config file: %v", err)
 		}
 
@@ -260,6 +325,10 @@ func Read(file string) (*HorizonConfig, error) {
 			return nil, fmt.Errorf("Unable to enrich content of config file with envvars: %v", err)
 		}
 
+		// override any field that has a HZN_CONFIG_ environment variable, before the defaults are set
+		overrides, envProblems := config.applyEnvOverrides(os.Environ(), false)
+		problems = append(problems, envProblems...)
+
 		// set the defaults here in case the attributes are not setup by the user.
 		if config.Edge.ServiceUpgradeCheckIntervalS == 0 {
 			config.Edge.ServiceUpgradeCheckIntervalS = 300
@@ -296,6 +365,42 @@ func Read(file string) (*HorizonConfig, error) {
 			config.Edge.InitialPollingBuffer = 120
 		}
 
+		if config.Edge.EventLogRetention.PruneIntervalS == 0 {
+			config.Edge.EventLogRetention.PruneIntervalS = 3600
+		}
+
+		config.Edge.ExchangeChanges = config.Edge.ExchangeChanges.WithDefaults()
+
+		if config.AgreementBot.ArchiveExport.Format == "" {
+			config.AgreementBot.ArchiveExport.Format = ArchiveExportFormat_JSON
+		}
+
+		if config.AgreementBot.ArchiveExport.MaxFileSizeKB == 0 {
+			config.AgreementBot.ArchiveExport.MaxFileSizeKB = 10240
+		}
+
+		if config.Watchdog.StuckTimeoutS == 0 {
+			config.Watchdog.StuckTimeoutS = 600
+		}
+
+		if config.Watchdog.CheckIntervalS == 0 {
+			config.Watchdog.CheckIntervalS = 30
+		}
+
+		if config.EventJournal.MaxFileSizeKB == 0 {
+			config.EventJournal.MaxFileSizeKB = 10240
+		}
+
+		config.ExchangeRetry = config.ExchangeRetry.WithDefaults()
+		config.ExchangeCache = config.ExchangeCache.WithDefaults()
+		config.MessageKeyRotation = config.MessageKeyRotation.WithDefaults()
+		config.MessageEnvelope = config.MessageEnvelope.WithDefaults()
+		config.AuditLog = config.AuditLog.WithDefaults()
+
+		if config.AgreementBot.MMSGarbageCollectionInterval == 0 {
+			config.AgreementBot.MMSGarbageCollectionInterval = 300
+		}
+
 		// add a slash at the back of the ExchangeUrl
 		if config.Edge.ExchangeURL != "" {
 			config.Edge.ExchangeURL = strings.TrimRight(config.Edge.ExchangeURL, "/") + "/"
@@ -313,6 +418,20 @@ func Read(file string) (*HorizonConfig, error) {
 			config.AgreementBot.PolicyPath = strings.TrimRight(config.AgreementBot.PolicyPath, "/") + "/"
 		}
 
+		// validate the config before anything is built from it
+		problems = append(problems, config.Validate()...)
+		if errs := problems.Errors(); len(errs) != 0 {
+			return nil, fmt.Errorf("Invalid config file: %s. Errors:\n%v", file, errs.Error())
+		}
+		for _, warning := range problems.Warnings() {
+			glog.Warningf("Config file %s: %v: %v", file, warning.Field, warning.Message)
+		}
+
+		// the poll interval cannot grow when the max interval is less than the starting interval
+		if config.Edge.ExchangeMessagePollMaxInterval < config.Edge.ExchangeMessagePollInterval {
+			config.Edge.ExchangeMessagePollMaxInterval = config.Edge.ExchangeMessagePollInterval
+		}
+
 		// now make collaborators instance and assign it to member in this config
 		collaborators, err := NewCollaborators(config)
 		if err != nil {
@@ -321,12 +440,16 @@ func Read(file string) (*HorizonConfig, error) {
 
 		config.Collaborators = *collaborators
 
-		if config.ArchSynonyms == nil {
-			config.ArchSynonyms = NewArchSynonyms()
+		collaboratorOverrides, envProblems := config.applyEnvOverrides(os.Environ(), true)
+		if len(envProblems) != 0 {
+			return nil, fmt.Errorf("Invalid config file: %s. Errors:\n%v", file, envProblems.Error())
+		}
+		for _, override := range append(overrides, collaboratorOverrides...) {
+			glog.Infof("Config field %v overridden by environment variable %v: %v", override.Field, override.Variable, override.Value)
 		}
 
-		if config.AgreementBot.MMSGarbageCollectionInterval == 0 {
-			config.AgreementBot.MMSGarbageCollectionInterval = 300
+		if config.ArchSynonyms == nil {
+			config.ArchSynonyms = NewArchSynonyms()
 		}
 
 		// success at last!
@@ -335,7 +458,7 @@ func Read(file string) (*HorizonConfig, error) {
 }
 
 func (c *HorizonConfig) String() string {
-	return fmt.Sprintf("Edge: {%v}, AgreementBot: {%v}, Collaborators: {%v}, ArchSynonyms: {%v}", c.Edge.String(), c.AgreementBot.String(), c.Collaborators.String(), c.ArchSynonyms)
+	return fmt.Sprintf("Edge: {%v}, AgreementBot: {%v}, Collaborators: {%v}, ArchSynonyms: {%v}, Watchdog: {%v}, EventJournal: {%v}, Log: {%v}, ExchangeRetry: {%v}, ExchangeCache: {%v}, MessageKeyRotation: {%v}, MessageEnvelope: {%v}, AuditLog: {%v}", c.Edge.String(), c.AgreementBot.String(), c.Collaborators.String(), c.ArchSynonyms, c.Watchdog.String(), c.EventJournal.String(), c.Log.String(), c.ExchangeRetry.String(), c.ExchangeCache.String(), c.MessageKeyRotation.String(), c.MessageEnvelope.String(), c.AuditLog.String())
 }
 
 func (con *Config) String() string {
@@ -391,6 +514,7 @@ func (agc *AGConfig) String() string {
 		", AgreementWorkers: %v"+
 		", DBPath: %v"+
 		", Postgresql: {%v}"+
+		", InMemoryDB: %v"+
 		", PartitionStale: %v"+
 		", ProtocolTimeoutS: %v"+
 		", AgreementTimeoutS: %v"+
@@ -417,15 +541,16 @@ func (agc *AGConfig) String() string {
 		", SecureAPIServerCert: %v"+
 		", SecureAPIServerkey: %v"+
 		", PurgeArchivedAgreementHours: %v"+
+		", ArchiveExport: {%v}"+
 		", CheckUpdatedPolicyS: %v"+
 		", CSSURL: %v"+
 		", CSSSSLCert: %v"+
 		", AgreementBatchSize: %v",
-		agc.TxLostDelayTolerationSeconds, agc.AgreementWorkers, agc.DBPath, agc.Postgresql.String(),
+		agc.TxLostDelayTolerationSeconds, agc.AgreementWorkers, agc.DBPath, agc.Postgresql.String(), agc.InMemoryDB,
 		agc.PartitionStale, agc.ProtocolTimeoutS, agc.AgreementTimeoutS, agc.NoDataIntervalS, agc.ActiveAgreementsURL,
 		agc.ActiveAgreementsUser, mask, agc.PolicyPath, agc.NewContractIntervalS, agc.ProcessGovernanceIntervalS,
 		agc.IgnoreContractWithAttribs, agc.ExchangeURL, agc.ExchangeHeartbeat, agc.ExchangeId,
 		mask, agc.DVPrefix, agc.ActiveDeviceTimeoutS, agc.ExchangeMessageTTL, agc.MessageKeyPath, mask, agc.APIListen,
 		agc.SecureAPIListenHost, agc.SecureAPIListenPort, agc.SecureAPIServerCert, agc.SecureAPIServerKey,
-		agc.PurgeArchivedAgreementHours, agc.CheckUpdatedPolicyS, agc.CSSURL, agc.CSSSSLCert, agc.AgreementBatchSize)
+		agc.PurgeArchivedAgreementHours, agc.ArchiveExport.String(), agc.CheckUpdatedPolicyS, agc.CSSURL, agc.CSSSSLCert, agc.AgreementBatchSize)
 }
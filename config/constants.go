@@ -92,3 +92,45 @@ const AgbotRetryLookBackWindow_DEFAULT = 3600
 
 // Policy search order
 const AgbotPolicySearchOrder_DEFAULT = true
+
+// The longest time to wait between retries of a call to the exchange.
+const ExchangeRetryMaxIntervalS_DEFAULT = 120
+
+// The factor that the time between retries of a call to the exchange grows by after each retry.
+const ExchangeRetryMultiplier_DEFAULT = 2.0
+
+// The time between retries of a call to the exchange is randomly changed by up to this percentage, so that nodes do not retry in step.
+const ExchangeRetryJitterPercent_DEFAULT = 20
+
+// The number of consecutive failed calls to an exchange URL that opens its circuit breaker.
+const ExchangeBreakerThreshold_DEFAULT = 5
+
+// The number of seconds that a circuit breaker stays open before a call is let through to test the exchange.
+const ExchangeBreakerOpenS_DEFAULT = 30
+
+// The most nodes, and node policies, that the exchange resource cache holds.
+const ExchangeCacheNodeMaxEntries_DEFAULT = 10000
+
+// The most entries of each service resource type that the exchange resource cache holds.
+const ExchangeCacheServiceMaxEntries_DEFAULT = 2000
+
+// How often the changed stable entries of the exchange resource cache are saved, in seconds.
+const ExchangeCachePersistIntervalS_DEFAULT = 300
+
+// Saved exchange resource cache entries older than this number of seconds are not loaded.
+const ExchangeCachePersistMaxAgeS_DEFAULT = 86400
+
+// The number of seconds that messages encrypted to a rotated message key are still accepted.
+const MessageKeyRotationGraceS_DEFAULT = 86400
+
+// The size in KB at which the current audit log file is rotated.
+const AuditLogMaxFileSizeKB_DEFAULT = 10240
+
+// The most seconds that the exchange holds a long poll for changes open.
+const ExchangeChangesWaitS_DEFAULT = 60
+
+// The number of seconds that the node polls for changes after a long poll fails.
+const ExchangeChangesFallbackS_DEFAULT = 300
+
+// The number of seconds that the exchange is assumed to keep its changes before it trims them.
+const ExchangeChangesRetentionS_DEFAULT = 14400
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Returns the configuration that anax runs with, after the defaults and the environment variables have been applied.
+// It is keyed by field name, the same as the config file. The values of secret fields are masked, and the collaborators
+// are left out because they are built from the configuration.
+func (c *HorizonConfig) Effective() map[string]interface{} {
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return effectiveStruct(reflect.ValueOf(c).Elem())
+}
+
+func effectiveStruct(v reflect.Value) map[string]interface{} {
+	effective := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Type == reflect.TypeOf(Collaborators{}) {
+			continue
+		}
+
+		if f.Type.Kind() == reflect.Struct {
+			effective[f.Name] = effectiveStruct(v.Field(i))
+		} else if secretFields[f.Name] && !v.Field(i).IsZero() {
+			effective[f.Name] = SECRET_VALUE
+		} else {
+			effective[f.Name] = v.Field(i).Interface()
+		}
+	}
+	return effective
+}
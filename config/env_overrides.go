@@ -0,0 +1,186 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Any field of the configuration can be overridden by an environment variable, so that a container or a kubernetes pod
+// can change a setting without templating the whole config file. The name of the variable is HZN_CONFIG_ followed by
+// the path of the field in HorizonConfig, with each name converted from camel case to upper case words separated by
+// underscores. For example:
+//
+//   Edge.ExchangeMessagePollInterval                 HZN_CONFIG_EDGE_EXCHANGE_MESSAGE_POLL_INTERVAL
+//   AgreementBot.Postgresql.Host                     HZN_CONFIG_AGREEMENT_BOT_POSTGRESQL_HOST
+//   Collaborators.HTTPClientFactory.RetryCount       HZN_CONFIG_COLLABORATORS_HTTP_CLIENT_FACTORY_RETRY_COUNT
+//
+// The value is parsed according to the type of the field. Maps and lists, such as ArchSynonyms, are given in JSON. The
+// overrides are applied after the config file is read and before the defaults are set, so they are validated like the
+// values in the file. The older variables such as HZN_EXCHANGE_URL are applied first, an override of the same field
+// takes precedence.
+
+const ENV_OVERRIDE_PREFIX = "HZN_CONFIG_"
+
+// A field of the configuration that was set from an environment variable. The value of a secret field is masked.
+type EnvOverride struct {
+	Variable string      `json:"variable"`
+	Field    string      `json:"field"`
+	Value    interface{} `json:"value"`
+}
+
+func (e EnvOverride) String() string {
+	return fmt.Sprintf("Variable: %v, Field: %v, Value: %v", e.Variable, e.Field, e.Value)
+}
+
+// Returns the name of the environment variable that overrides the field, for example Edge.NodeCheckIntervalS.
+func EnvOverrideName(field string) string {
+	words := make([]string, 0)
+	for _, name := range strings.Split(field, ".") {
+		words = append(words, envWords(name))
+	}
+	return ENV_OVERRIDE_PREFIX + strings.Join(words, "_")
+}
+
+// Convert a camel case name to upper case words separated by underscores. An acronym is kept as one word, so APIListen
+// becomes API_LISTEN.
+func envWords(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// Returns the fields that can be overridden, keyed by the name of the environment variable.
+func EnvOverrideFields() map[string]string {
+	fields := make(map[string]string)
+	envFields("", reflect.TypeOf(HorizonConfig{}), fields)
+	return fields
+}
+
+func envFields(prefix string, t reflect.Type, fields map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		field := prefix + f.Name
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		switch ft.Kind() {
+		case reflect.Struct:
+			envFields(field+".", ft, fields)
+		case reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+			// These are built by anax, they are not configuration.
+		default:
+			fields[EnvOverrideName(field)] = field
+		}
+	}
+}
+
+// Set the fields that have an environment variable in the environment, which is a list of name=value strings like
+// os.Environ. The fields of the collaborators can only be overridden after they are built, so they are only set when
+// collaborators is true, and the other fields only when it is false. Variables with the prefix that do not name a field
+// are reported as warnings, values that cannot be parsed as errors.
+func (c *HorizonConfig) applyEnvOverrides(environ []string, collaborators bool) ([]EnvOverride, ConfigProblems) {
+	overrides := make([]EnvOverride, 0)
+	problems := make(ConfigProblems, 0)
+	fields := EnvOverrideFields()
+
+	sorted := append([]string{}, environ...)
+	sort.Strings(sorted)
+
+	for _, env := range sorted {
+		if !strings.HasPrefix(env, ENV_OVERRIDE_PREFIX) {
+			continue
+		}
+
+		name, value := env, ""
+		if ix := strings.Index(env, "="); ix != -1 {
+			name, value = env[:ix], env[ix+1:]
+		}
+
+		field, ok := fields[name]
+		if !ok {
+			if !collaborators {
+				problems = append(problems, ConfigProblem{Field: name, Message: "environment variable does not match a configuration field", Warning: true})
+			}
+			continue
+		} else if strings.HasPrefix(field, "Collaborators.") != collaborators {
+			continue
+		}
+
+		v := c.field(field)
+		if !v.IsValid() {
+			continue
+		} else if err := setFromString(v, value); err != nil {
+			problems = append(problems, ConfigProblem{Field: field, Message: fmt.Sprintf("unable to set from %v, error: %v", name, err)})
+			continue
+		}
+
+		override := EnvOverride{Variable: name, Field: field, Value: v.Interface()}
+		if secretFields[field[strings.LastIndex(field, ".")+1:]] {
+			override.Value = SECRET_VALUE
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, problems
+}
+
+// Parse the string according to the type of the value and set it.
+func setFromString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v is not a boolean", s))
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v is not a %v", s, v.Type()))
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v is not a %v", s, v.Type()))
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New(fmt.Sprintf("%v is not a %v", s, v.Type()))
+		}
+		v.SetFloat(f)
+	default:
+		// Maps and lists are given in JSON.
+		n := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(s), n.Interface()); err != nil {
+			return errors.New(fmt.Sprintf("%v is not a JSON %v, error: %v", s, v.Type(), err))
+		}
+		v.Set(n.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// +build unit
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_EnvOverrideName(t *testing.T) {
+	names := map[string]string{
+		"Edge.ExchangeMessagePollInterval":           "HZN_CONFIG_EDGE_EXCHANGE_MESSAGE_POLL_INTERVAL",
+		"Edge.APIListen":                             "HZN_CONFIG_EDGE_API_LISTEN",
+		"AgreementBot.CSSSSLCert":                    "HZN_CONFIG_AGREEMENT_BOT_CSSSSL_CERT",
+		"AgreementBot.Postgresql.Host":               "HZN_CONFIG_AGREEMENT_BOT_POSTGRESQL_HOST",
+		"Edge.EventLogRetention.SeverityMaxAgeH":     "HZN_CONFIG_EDGE_EVENT_LOG_RETENTION_SEVERITY_MAX_AGE_H",
+		"Collaborators.HTTPClientFactory.RetryCount": "HZN_CONFIG_COLLABORATORS_HTTP_CLIENT_FACTORY_RETRY_COUNT",
+	}
+	for field, name := range names {
+		if n := EnvOverrideName(field); n != name {
+			t.Errorf("expected %v for %v, got %v", name, field, n)
+		}
+	}
+
+	// Every field has its own variable, and the functions built by anax are left out.
+	fields := EnvOverrideFields()
+	paths := make(map[string]bool)
+	for name, field := range fields {
+		if paths[field] {
+			t.Errorf("expected one variable for %v", field)
+		} else if name != EnvOverrideName(field) {
+			t.Errorf("expected %v for %v, got %v", EnvOverrideName(field), field, name)
+		}
+		paths[field] = true
+	}
+	if !paths["Collaborators.HTTPClientFactory.RetryInterval"] || paths["Collaborators.HTTPClientFactory.NewHTTPClient"] {
+		t.Errorf("unexpected collaborator fields in %v", fields)
+	}
+}
+
+func Test_applyEnvOverrides(t *testing.T) {
+	cfg := HorizonConfig{
+		Edge:          Config{NodeCheckIntervalS: 15},
+		Collaborators: Collaborators{HTTPClientFactory: &HTTPClientFactory{RetryCount: 0}},
+	}
+
+	environ := []string{
+		"HZN_CONFIG_EDGE_NODE_CHECK_INTERVAL_S=30",
+		"HZN_CONFIG_EDGE_TRUST_SYSTEM_CA_CERTS=true",
+		"HZN_CONFIG_AGREEMENT_BOT_AGREEMENT_BATCH_SIZE=500",
+		"HZN_CONFIG_AGREEMENT_BOT_POSTGRESQL_PASSWORD=secret",
+		"HZN_CONFIG_ARCH_SYNONYMS={\"x86_64\": \"amd64\"}",
+		"HZN_CONFIG_COLLABORATORS_HTTP_CLIENT_FACTORY_RETRY_COUNT=3",
+		"HZN_CONFIG_EDGE_NO_SUCH_FIELD=1",
+		"HZN_EXCHANGE_URL=https://exchange/v1",
+		"PATH=/usr/bin",
+	}
+
+	overrides, problems := cfg.applyEnvOverrides(environ, false)
+	if len(overrides) != 5 {
+		t.Errorf("expected 5 overrides, got %v", overrides)
+	} else if len(problems) != 1 || !problems[0].Warning || problems[0].Field != "HZN_CONFIG_EDGE_NO_SUCH_FIELD" {
+		t.Errorf("expected a warning for the unknown variable, got %v", problems)
+	}
+
+	if cfg.Edge.NodeCheckIntervalS != 30 || !cfg.Edge.TrustSystemCACerts || cfg.AgreementBot.AgreementBatchSize != 500 || cfg.AgreementBot.Postgresql.Password != "secret" {
+		t.Errorf("expected the fields to be overridden, got %v", cfg.String())
+	} else if !reflect.DeepEqual(cfg.ArchSynonyms, ArchSynonyms{"x86_64": "amd64"}) {
+		t.Errorf("expected the arch synonyms to be overridden, got %v", cfg.ArchSynonyms)
+	} else if cfg.Collaborators.HTTPClientFactory.RetryCount != 0 {
+		t.Errorf("expected the collaborators not to be overridden yet")
+	}
+
+	for _, o := range overrides {
+		if o.Field == "AgreementBot.Postgresql.Password" && o.Value != SECRET_VALUE {
+			t.Errorf("expected the password to be masked, got %v", o)
+		}
+	}
+
+	overrides, problems = cfg.applyEnvOverrides(environ, true)
+	if len(overrides) != 1 || len(problems) != 0 || cfg.Collaborators.HTTPClientFactory.RetryCount != 3 {
+		t.Errorf("expected the collaborators to be overridden, got %v %v", overrides, problems)
+	}
+
+	// A value that does not parse is an error.
+	_, problems = cfg.applyEnvOverrides([]string{"HZN_CONFIG_EDGE_NODE_CHECK_INTERVAL_S=often"}, false)
+	if len(problems) != 1 || problems[0].Warning || problems[0].Field != "Edge.NodeCheckIntervalS" {
+		t.Errorf("expected an error for the invalid value, got %v", problems)
+	}
+}
+
+func Test_Read_env_overrides(t *testing.T) {
+	f, err := ioutil.TempFile("", "anax.config")
+	if err != nil {
+		t.Fatalf("unable to create config file, error: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"Edge": {"ExchangeURL": "https://file/v1", "NodeCheckIntervalS": 20}}`)
+	f.Close()
+
+	os.Setenv("HZN_CONFIG_EDGE_EXCHANGE_URL", "https://env/v1")
+	os.Setenv("HZN_CONFIG_COLLABORATORS_HTTP_CLIENT_FACTORY_RETRY_INTERVAL", "5")
+	defer os.Unsetenv("HZN_CONFIG_EDGE_EXCHANGE_URL")
+	defer os.Unsetenv("HZN_CONFIG_COLLABORATORS_HTTP_CLIENT_FACTORY_RETRY_INTERVAL")
+
+	cfg, err := Read(f.Name())
+	if err != nil {
+		t.Fatalf("unable to read config, error: %v", err)
+	} else if cfg.Edge.ExchangeURL != "https://env/v1/" || cfg.Edge.NodeCheckIntervalS != 20 {
+		t.Errorf("expected the exchange URL to be overridden, got %v", cfg.Edge.String())
+	} else if cfg.Collaborators.HTTPClientFactory.GetRetryInterval() != 5 {
+		t.Errorf("expected the retry interval to be overridden, got %v", cfg.Collaborators.HTTPClientFactory.RetryInterval)
+	}
+
+	// An override is validated like the config file.
+	os.Setenv("HZN_CONFIG_EDGE_NODE_CHECK_INTERVAL_S", "-1")
+	defer os.Unsetenv("HZN_CONFIG_EDGE_NODE_CHECK_INTERVAL_S")
+	if _, err := Read(f.Name()); err == nil {
+		t.Errorf("expected an error for an invalid override")
+	}
+}
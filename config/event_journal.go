@@ -0,0 +1,23 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The configuration of the event journal. The journal records every event passed between the workers so that the
+// sequence of events that led to a problem can be examined and replayed. Secrets such as exchange tokens and the bodies
+// of agreement protocol messages are not recorded. The journal is turned off unless a Path is configured.
+type EventJournalConfig struct {
+	Path          string // The directory where journal files are written.
+	MaxFileSizeKB int64  // The size at which the current journal file is rotated. The default is 10240 KB.
+	MaxFiles      int    // The number of rotated journal files to keep, the oldest are deleted. 0 means keep all of them.
+}
+
+func (e *EventJournalConfig) String() string {
+	return fmt.Sprintf("Path: %v, MaxFileSizeKB: %v, MaxFiles: %v", e.Path, e.MaxFileSizeKB, e.MaxFiles)
+}
+
+// Returns true if events should be journaled.
+func (e *EventJournalConfig) IsEnabled() bool {
+	return e.Path != ""
+}
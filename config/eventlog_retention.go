@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The retention policy for the node's event log. Records are pruned periodically when any of the limits is set. The
+// default is to keep every record.
+type EventLogRetentionConfig struct {
+	MaxAgeH         int            // Event log records older than this number of hours are pruned. 0 means no age limit.
+	SeverityMaxAgeH map[string]int // The maximum age in hours of the records with a given severity (info, warning, error, fatal). Overrides MaxAgeH for that severity.
+	MaxCount        int            // The oldest event log records are pruned until at most this many remain. 0 means no limit.
+	PruneIntervalS  int            // How often the event log is pruned. The default is 3600 seconds.
+}
+
+func (e *EventLogRetentionConfig) String() string {
+	return fmt.Sprintf("MaxAgeH: %v, SeverityMaxAgeH: %v, MaxCount: %v, PruneIntervalS: %v", e.MaxAgeH, e.SeverityMaxAgeH, e.MaxCount, e.PruneIntervalS)
+}
+
+// Returns true if any retention limit is configured.
+func (e *EventLogRetentionConfig) IsEnabled() bool {
+	if e.MaxAgeH != 0 || e.MaxCount != 0 {
+		return true
+	}
+	for _, age := range e.SeverityMaxAgeH {
+		if age != 0 {
+			return true
+		}
+	}
+	return false
+}
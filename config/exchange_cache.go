@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The bounds of the cache of exchange resources, and where its stable entries are saved. Each resource type holds at
+// most the configured number of entries, the least recently used entry is evicted when a new one is added to a full
+// cache. A negative bound means the cache of that type is not bounded. When PersistFile is set, the service definitions
+// and signing keys in the cache are saved to it, and loaded again when the agent starts, so that a restarted agbot does
+// not fetch every service definition from the exchange at once.
+type ExchangeCacheConfig struct {
+	NodeMaxEntries          int    // The default is 10000.
+	NodePolicyMaxEntries    int    // The default is 10000.
+	ServiceMaxEntries       int    // Service definitions, cached for all the versions of a service and arch. The default is 2000.
+	ServicePolicyMaxEntries int    // The default is 2000.
+	DockerAuthMaxEntries    int    // The default is 2000.
+	KeyMaxEntries           int    // Signing keys of services. The default is 2000.
+	PersistFile             string // The file that the stable entries are saved to. Not set by default, which means they are not saved.
+	PersistIntervalS        int    // How often changed entries are saved. The default is 300 seconds.
+	PersistMaxAgeS          int    // Saved entries older than this are not loaded or used. The default is 86400 seconds.
+}
+
+func (e *ExchangeCacheConfig) String() string {
+	return fmt.Sprintf("NodeMaxEntries: %v, NodePolicyMaxEntries: %v, ServiceMaxEntries: %v, ServicePolicyMaxEntries: %v, DockerAuthMaxEntries: %v, KeyMaxEntries: %v, PersistFile: %v, PersistIntervalS: %v, PersistMaxAgeS: %v",
+		e.NodeMaxEntries, e.NodePolicyMaxEntries, e.ServiceMaxEntries, e.ServicePolicyMaxEntries, e.DockerAuthMaxEntries, e.KeyMaxEntries, e.PersistFile, e.PersistIntervalS, e.PersistMaxAgeS)
+}
+
+// Returns the configuration with the defaults for the fields that are not set.
+func (e ExchangeCacheConfig) WithDefaults() ExchangeCacheConfig {
+	if e.NodeMaxEntries == 0 {
+		e.NodeMaxEntries = ExchangeCacheNodeMaxEntries_DEFAULT
+	}
+	if e.NodePolicyMaxEntries == 0 {
+		e.NodePolicyMaxEntries = ExchangeCacheNodeMaxEntries_DEFAULT
+	}
+	if e.ServiceMaxEntries == 0 {
+		e.ServiceMaxEntries = ExchangeCacheServiceMaxEntries_DEFAULT
+	}
+	if e.ServicePolicyMaxEntries == 0 {
+		e.ServicePolicyMaxEntries = ExchangeCacheServiceMaxEntries_DEFAULT
+	}
+	if e.DockerAuthMaxEntries == 0 {
+		e.DockerAuthMaxEntries = ExchangeCacheServiceMaxEntries_DEFAULT
+	}
+	if e.KeyMaxEntries == 0 {
+		e.KeyMaxEntries = ExchangeCacheServiceMaxEntries_DEFAULT
+	}
+	if e.PersistIntervalS == 0 {
+		e.PersistIntervalS = ExchangeCachePersistIntervalS_DEFAULT
+	}
+	if e.PersistMaxAgeS == 0 {
+		e.PersistMaxAgeS = ExchangeCachePersistMaxAgeS_DEFAULT
+	}
+	return e
+}
+
+// Returns true if the stable entries of the cache should be saved.
+func (e *ExchangeCacheConfig) IsPersistEnabled() bool {
+	return e.PersistFile != ""
+}
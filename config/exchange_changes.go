@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The ways that the node can get the changes in the exchange.
+const (
+	ExchangeChangesTransport_POLL     = "poll"
+	ExchangeChangesTransport_LONGPOLL = "longpoll"
+)
+
+// How the node gets the changes in the exchange. The node polls the exchange on an interval that grows while nothing
+// happens, up to ExchangeMessagePollMaxInterval. With a long poll, the exchange holds each request open until there is
+// a change for the node, so that an agreement proposal is seen right away without polling more often. The node falls
+// back to polling for a while when the exchange does not support long polls, or when a long poll fails.
+type ExchangeChangesConfig struct {
+	Transport  string // poll or longpoll. The default is poll.
+	WaitS      int    // The most seconds the exchange holds a long poll open when there are no changes. The default is 60.
+	FallbackS  int    // The number of seconds the node polls after a long poll fails, before it tries again. The default is 300.
+	RetentionS int    // The number of seconds the exchange keeps its changes. When the node has not read the changes for longer, it syncs everything with the exchange. The default is 14400.
+}
+
+func (e *ExchangeChangesConfig) String() string {
+	return fmt.Sprintf("Transport: %v, WaitS: %v, FallbackS: %v, RetentionS: %v", e.Transport, e.WaitS, e.FallbackS, e.RetentionS)
+}
+
+// Returns the configuration with the defaults for the fields that are not set.
+func (e ExchangeChangesConfig) WithDefaults() ExchangeChangesConfig {
+	if e.Transport == "" {
+		e.Transport = ExchangeChangesTransport_POLL
+	}
+	if e.WaitS == 0 {
+		e.WaitS = ExchangeChangesWaitS_DEFAULT
+	}
+	if e.FallbackS == 0 {
+		e.FallbackS = ExchangeChangesFallbackS_DEFAULT
+	}
+	if e.RetentionS == 0 {
+		e.RetentionS = ExchangeChangesRetentionS_DEFAULT
+	}
+	return e
+}
+
+// Returns true if the node should hold its requests for changes open.
+func (e *ExchangeChangesConfig) IsLongPoll() bool {
+	return e.Transport == ExchangeChangesTransport_LONGPOLL
+}
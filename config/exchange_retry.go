@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The policy for retrying calls to the exchange that fail because the exchange cannot be reached or is overloaded. The
+// time between retries starts at the retry interval of the HTTP client factory and grows exponentially, with some
+// random jitter, up to MaxIntervalS. When the exchange sends a Retry-After header, the retry waits at least that long.
+// Each exchange URL has a circuit breaker, which opens after BreakerThreshold consecutive failures. While it is open,
+// calls to that URL fail without being sent, until BreakerOpenS has passed and a single call is let through to test
+// whether the exchange has recovered.
+type ExchangeRetryConfig struct {
+	MaxIntervalS     int     // The longest time to wait between retries. The default is 120 seconds.
+	Multiplier       float64 // The factor that the time between retries grows by after each retry. The default is 2.
+	JitterPercent    int     // The time between retries is randomly changed by up to this percentage. The default is 20.
+	BreakerThreshold int     // The number of consecutive failures that opens the circuit breaker. The default is 5, a negative value disables the circuit breaker.
+	BreakerOpenS     int     // How long the circuit breaker stays open. The default is 30 seconds.
+}
+
+func (e *ExchangeRetryConfig) String() string {
+	return fmt.Sprintf("MaxIntervalS: %v, Multiplier: %v, JitterPercent: %v, BreakerThreshold: %v, BreakerOpenS: %v", e.MaxIntervalS, e.Multiplier, e.JitterPercent, e.BreakerThreshold, e.BreakerOpenS)
+}
+
+// Returns the policy with the defaults for the fields that are not set.
+func (e ExchangeRetryConfig) WithDefaults() ExchangeRetryConfig {
+	if e.MaxIntervalS == 0 {
+		e.MaxIntervalS = ExchangeRetryMaxIntervalS_DEFAULT
+	}
+	if e.Multiplier == 0 {
+		e.Multiplier = ExchangeRetryMultiplier_DEFAULT
+	}
+	if e.JitterPercent == 0 {
+		e.JitterPercent = ExchangeRetryJitterPercent_DEFAULT
+	}
+	if e.BreakerThreshold == 0 {
+		e.BreakerThreshold = ExchangeBreakerThreshold_DEFAULT
+	}
+	if e.BreakerOpenS == 0 {
+		e.BreakerOpenS = ExchangeBreakerOpenS_DEFAULT
+	}
+	return e
+}
+
+// Returns true if the circuit breaker should be used.
+func (e *ExchangeRetryConfig) IsBreakerEnabled() bool {
+	return e.BreakerThreshold > 0
+}
@@ -0,0 +1,15 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The logging configuration. Logging is normally configured with the command line flags, a setting here overrides
+// the flag and can be changed by reloading the configuration without restarting anax.
+type LogConfig struct {
+	Verbosity int // The glog verbosity level, the same as the -v flag. 0 means the -v flag is used.
+}
+
+func (l *LogConfig) String() string {
+	return fmt.Sprintf("Verbosity: %v", l.Verbosity)
+}
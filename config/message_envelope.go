@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The types of the key pair that the node or agbot uses for the agreement protocol messages.
+const (
+	MessageKeyType_RSA     = "rsa"
+	MessageKeyType_ED25519 = "ed25519"
+)
+
+// The envelope of the agreement protocol messages. The type of the public key that a node or agbot publishes in the
+// exchange tells the other party which envelopes it can open. An RSA key can be used by the parties that only know the
+// original envelope, an Ed25519 key requires the versioned envelope with X25519 key agreement. A change of the key type
+// takes effect at the next rotation of the message key.
+//
+// The parties that only know the original envelope cannot check a message signed with an Ed25519 key, so an Ed25519
+// key is only created when PeersSupportV2 says that every node and agbot this one exchanges messages with can open
+// the versioned envelope.
+type MessageEnvelopeConfig struct {
+	KeyType        string // The type of key to create, rsa or ed25519. The default is rsa.
+	PeersSupportV2 bool   // Every peer opens the versioned envelope. The default is false.
+}
+
+func (m *MessageEnvelopeConfig) String() string {
+	return fmt.Sprintf("KeyType: %v, PeersSupportV2: %v", m.KeyType, m.PeersSupportV2)
+}
+
+// Returns the type of key to create, which is rsa when an ed25519 key is configured but not every peer supports it.
+func (m MessageEnvelopeConfig) CreateKeyType() string {
+	if m.KeyType == MessageKeyType_ED25519 && !m.PeersSupportV2 {
+		return MessageKeyType_RSA
+	}
+	return m.KeyType
+}
+
+// Returns the configuration with the defaults for the fields that are not set.
+func (m MessageEnvelopeConfig) WithDefaults() MessageEnvelopeConfig {
+	if m.KeyType == "" {
+		m.KeyType = MessageKeyType_RSA
+	}
+	return m
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+)
+
+// How often the key pair that encrypts the agreement protocol messages is replaced, and how long messages encrypted to
+// the replaced key are still accepted after it. The grace period covers the proposals and replies that were already
+// sent when the key was rotated, and gives the other party time to read the new public key from the exchange.
+type MessageKeyRotationConfig struct {
+	IntervalH int // Hours between scheduled rotations. The default is 0, which means the keys are only rotated on demand.
+	GraceS    int // The default is 86400 seconds.
+}
+
+func (m *MessageKeyRotationConfig) String() string {
+	return fmt.Sprintf("IntervalH: %v, GraceS: %v", m.IntervalH, m.GraceS)
+}
+
+// Returns the configuration with the defaults for the fields that are not set.
+func (m MessageKeyRotationConfig) WithDefaults() MessageKeyRotationConfig {
+	if m.GraceS == 0 {
+		m.GraceS = MessageKeyRotationGraceS_DEFAULT
+	}
+	return m
+}
+
+// Returns true if the keys are rotated on a schedule.
+func (m *MessageKeyRotationConfig) IsScheduled() bool {
+	return m.IntervalH > 0
+}
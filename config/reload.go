@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Most of the configuration is only read when anax starts. The fields listed here are read each time they are used, or
+// are passed to the workers that use them when the configuration is reloaded, so they can be changed by editing the
+// config file and reloading it. A change to any other field is rejected and only takes effect when anax is restarted.
+// Fields are named by their path in HorizonConfig, for example Edge.SurfaceErrorTimeoutS.
+var reloadableFields = map[string]func(reflect.Value) string{
+	"Edge.ExchangeMessagePollInterval": mustBePositive,
+	"Edge.SurfaceErrorTimeoutS":        mustNotBeNegative,
+	"AgreementBot.AgreementBatchSize":  mustBePositive,
+	"AgreementBot.FullRescanS":         mustNotBeNegative,
+	"Log.Verbosity":                    mustNotBeNegative,
+}
+
+// The configuration is shared by all the workers, and a reload changes the reloadable fields while the workers run. The
+// reloadable fields are written under this lock, and the workers read them with the getters of HorizonConfig, which
+// hold it too.
+var reloadLock sync.RWMutex
+
+// The values of these fields are not shown in the changes found by a reload or in the effective configuration.
+var secretFields = map[string]bool{
+	"Password":           true,
+	"ExchangeToken":      true,
+	"ActiveAgreementsPW": true,
+	"DefaultWorkloadPW":  true,
+}
+
+const SECRET_VALUE = "******"
+
+// Reasons why a changed field was not reloaded.
+const (
+	REASON_RESTART_REQUIRED = "anax must be restarted to change this field"
+	REASON_NOT_POSITIVE     = "the value must be greater than 0"
+	REASON_NEGATIVE         = "the value must not be negative"
+)
+
+func mustBePositive(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() <= 0 {
+			return REASON_NOT_POSITIVE
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() == 0 {
+			return REASON_NOT_POSITIVE
+		}
+	}
+	return ""
+}
+
+func mustNotBeNegative(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return REASON_NEGATIVE
+		}
+	}
+	return ""
+}
+
+// Returns the names of the fields that can be changed by reloading the configuration, sorted by name.
+func ReloadableFields() []string {
+	fields := make([]string, 0, len(reloadableFields))
+	for field := range reloadableFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Returns true if the field can be changed by reloading the configuration.
+func IsReloadable(field string) bool {
+	_, ok := reloadableFields[field]
+	return ok
+}
+
+// A difference between the running configuration and the configuration that was reloaded. The reason is set when the
+// change was not applied.
+type ConfigChange struct {
+	Field  string      `json:"field"`
+	Old    interface{} `json:"old"`
+	New    interface{} `json:"new"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("Field: %v, Old: %v, New: %v, Reason: %v", c.Field, c.Old, c.New, c.Reason)
+}
+
+// The outcome of reloading the configuration. The error is set when the config file could not be read, in which case
+// nothing was changed.
+type ReloadResult struct {
+	Time     uint64         `json:"time"`
+	Source   string         `json:"source"`
+	Applied  []ConfigChange `json:"applied"`
+	Rejected []ConfigChange `json:"rejected"`
+	Error    string         `json:"error,omitempty"`
+}
+
+func (r ReloadResult) String() string {
+	return fmt.Sprintf("Time: %v, Source: %v, Applied: %v, Rejected: %v, Error: %v", r.Time, r.Source, r.Applied, r.Rejected, r.Error)
+}
+
+// Returns the names of the fields that were applied.
+func (r ReloadResult) AppliedFields() []string {
+	fields := make([]string, 0, len(r.Applied))
+	for _, c := range r.Applied {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+// The fields that can be reloaded and the outcome of the last reload, if there was one.
+type ReloadStatus struct {
+	ReloadableFields []string      `json:"reloadable_fields"`
+	LastReload       *ReloadResult `json:"last_reload"`
+}
+
+// Returns the fields that are different in the other configuration. The collaborators are built from the configuration,
+// they are not compared.
+func (c *HorizonConfig) Diff(other *HorizonConfig) []ConfigChange {
+	changes := make([]ConfigChange, 0)
+	diffStruct("", reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem(), &changes)
+	return changes
+}
+
+func diffStruct(prefix string, old reflect.Value, new reflect.Value, changes *[]ConfigChange) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Type == reflect.TypeOf(Collaborators{}) {
+			continue
+		}
+
+		field := prefix + f.Name
+		if f.Type.Kind() == reflect.Struct {
+			diffStruct(field+".", old.Field(i), new.Field(i), changes)
+		} else if !reflect.DeepEqual(old.Field(i).Interface(), new.Field(i).Interface()) {
+			change := ConfigChange{Field: field, Old: old.Field(i).Interface(), New: new.Field(i).Interface()}
+			if secretFields[f.Name] {
+				change.Old = SECRET_VALUE
+				change.New = SECRET_VALUE
+			}
+			*changes = append(*changes, change)
+		}
+	}
+}
+
+// Returns the field of the configuration with the path, for example Edge.NodeCheckIntervalS. Pointers to structs are
+// followed, the returned value is not valid if one of them is nil.
+func (c *HorizonConfig) field(path string) reflect.Value {
+	v := reflect.ValueOf(c).Elem()
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i == len(path) || path[i] == '.' {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}
+				}
+				v = v.Elem()
+			}
+			v = v.FieldByName(path[start:i])
+			start = i + 1
+		}
+	}
+	return v
+}
+
+// Copy the reloadable fields that are different in the new configuration into this configuration. The changes that were
+// applied are returned, along with the changes that were rejected because they require a restart or the new value is
+// not valid.
+func (c *HorizonConfig) ApplyReload(new *HorizonConfig) ([]ConfigChange, []ConfigChange) {
+	applied := make([]ConfigChange, 0)
+	rejected := make([]ConfigChange, 0)
+
+	for _, change := range c.Diff(new) {
+		validate, ok := reloadableFields[change.Field]
+		if !ok {
+			change.Reason = REASON_RESTART_REQUIRED
+			rejected = append(rejected, change)
+			continue
+		}
+
+		value := new.field(change.Field)
+		if reason := validate(value); reason != "" {
+			change.Reason = reason
+			rejected = append(rejected, change)
+			continue
+		}
+
+		reloadLock.Lock()
+		c.field(change.Field).Set(value)
+		reloadLock.Unlock()
+		applied = append(applied, change)
+	}
+	return applied, rejected
+}
@@ -0,0 +1,102 @@
+// +build unit
+
+package config
+
+import (
+	"testing"
+)
+
+func Test_ApplyReload(t *testing.T) {
+	running := HorizonConfig{
+		Edge:         Config{ExchangeMessagePollInterval: 20, NodeCheckIntervalS: 15, SurfaceErrorTimeoutS: 0, DBPath: "/var/horizon"},
+		AgreementBot: AGConfig{AgreementBatchSize: 300, FullRescanS: 600, Postgresql: PostgresqlConfig{Password: "old"}},
+	}
+
+	reloaded := running
+	reloaded.Edge.ExchangeMessagePollInterval = 10
+	reloaded.Edge.SurfaceErrorTimeoutS = 3600
+	reloaded.Edge.DBPath = "/tmp/horizon"
+	reloaded.Edge.NodeCheckIntervalS = 30
+	reloaded.AgreementBot.AgreementBatchSize = 0
+	reloaded.AgreementBot.Postgresql.Password = "new"
+	reloaded.Log.Verbosity = 5
+
+	applied, rejected := running.ApplyReload(&reloaded)
+
+	if len(applied) != 3 {
+		t.Errorf("expected 3 changes to be applied, got %v", applied)
+	}
+	if running.Edge.ExchangeMessagePollInterval != 10 || running.Edge.SurfaceErrorTimeoutS != 3600 || running.Log.Verbosity != 5 {
+		t.Errorf("expected the reloadable fields to change, got %v", running.String())
+	}
+
+	// Fields that need a restart and invalid values are not changed.
+	if running.Edge.DBPath != "/var/horizon" || running.Edge.NodeCheckIntervalS != 15 || running.AgreementBot.AgreementBatchSize != 300 || running.AgreementBot.Postgresql.Password != "old" {
+		t.Errorf("expected the other fields not to change, got %v", running.String())
+	}
+
+	reasons := make(map[string]ConfigChange)
+	for _, c := range rejected {
+		reasons[c.Field] = c
+	}
+	if len(rejected) != 4 {
+		t.Errorf("expected 4 changes to be rejected, got %v", rejected)
+	} else if reasons["Edge.DBPath"].Reason != REASON_RESTART_REQUIRED || reasons["Edge.DBPath"].New != "/tmp/horizon" {
+		t.Errorf("unexpected rejection %v", reasons["Edge.DBPath"])
+	} else if reasons["Edge.NodeCheckIntervalS"].Reason != REASON_RESTART_REQUIRED {
+		t.Errorf("unexpected rejection %v", reasons["Edge.NodeCheckIntervalS"])
+	} else if reasons["AgreementBot.AgreementBatchSize"].Reason != REASON_NOT_POSITIVE {
+		t.Errorf("unexpected rejection %v", reasons["AgreementBot.AgreementBatchSize"])
+	} else if c := reasons["AgreementBot.Postgresql.Password"]; c.Old != SECRET_VALUE || c.New != SECRET_VALUE {
+		t.Errorf("expected the password to be hidden, got %v", c)
+	}
+
+	// Reloading the same configuration again changes nothing, but the rejected changes are still reported.
+	applied, rejected = running.ApplyReload(&reloaded)
+	if len(applied) != 0 || len(rejected) != 4 {
+		t.Errorf("expected only the 4 rejected changes, got %v and %v", applied, rejected)
+	}
+}
+
+// The workers read the reloadable fields while the configuration is reloaded.
+func Test_ApplyReload_concurrent_reads(t *testing.T) {
+	running := &HorizonConfig{Edge: Config{ExchangeMessagePollInterval: 20}, AgreementBot: AGConfig{AgreementBatchSize: 300}}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if v := running.GetExchangeMessagePollInterval(); v <= 0 {
+				t.Errorf("unexpected poll interval %v", v)
+				return
+			}
+			running.GetAgbotAgreementBatchSize()
+			running.Effective()
+		}
+	}()
+
+	for i := 1; i <= 100; i++ {
+		reloaded := HorizonConfig{Edge: Config{ExchangeMessagePollInterval: i}, AgreementBot: AGConfig{AgreementBatchSize: uint64(i)}}
+		running.ApplyReload(&reloaded)
+	}
+	<-done
+
+	if running.GetExchangeMessagePollInterval() != 100 || running.GetAgbotAgreementBatchSize() != 100 {
+		t.Errorf("expected the last reload to be applied, got %v", running.String())
+	}
+}
+
+func Test_ReloadableFields(t *testing.T) {
+	cfg := &HorizonConfig{}
+	for _, field := range ReloadableFields() {
+		if !IsReloadable(field) {
+			t.Errorf("expected %v to be reloadable", field)
+		} else if !cfg.field(field).IsValid() {
+			t.Errorf("reloadable field %v is not in the configuration", field)
+		}
+	}
+
+	if IsReloadable("Edge.DBPath") {
+		t.Errorf("expected Edge.DBPath not to be reloadable")
+	}
+}
@@ -0,0 +1,381 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The configuration is validated when it is read, so that mistakes in the config file are reported when anax starts
+// rather than when the setting is first used. The config file is checked for keys that do not match a field, values of
+// the wrong type, values out of range and settings that only make sense together. Errors stop anax from starting,
+// warnings are logged and anax starts anyway.
+
+// A problem found in the configuration. Fields are named by their path in HorizonConfig, for example Edge.SurfaceErrorTimeoutS.
+type ConfigProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Warning bool   `json:"warning"`
+}
+
+func (p ConfigProblem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("warning: %v: %v", p.Field, p.Message)
+	}
+	return fmt.Sprintf("%v: %v", p.Field, p.Message)
+}
+
+type ConfigProblems []ConfigProblem
+
+// Returns the problems that are errors.
+func (p ConfigProblems) Errors() ConfigProblems {
+	errs := make(ConfigProblems, 0)
+	for _, problem := range p {
+		if !problem.Warning {
+			errs = append(errs, problem)
+		}
+	}
+	return errs
+}
+
+// Returns the problems that are warnings.
+func (p ConfigProblems) Warnings() ConfigProblems {
+	warnings := make(ConfigProblems, 0)
+	for _, problem := range p {
+		if problem.Warning {
+			warnings = append(warnings, problem)
+		}
+	}
+	return warnings
+}
+
+// One problem per line, so that they are easy to read when anax refuses to start.
+func (p ConfigProblems) Error() string {
+	lines := make([]string, 0, len(p))
+	for _, problem := range p {
+		lines = append(lines, "  "+problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Reasons why a field is not valid, in addition to the ones in reload.go.
+const (
+	REASON_UNKNOWN_KEY  = "unknown configuration key"
+	REASON_NOT_ONE_OF   = "the value must be one of"
+	REASON_LESS_THAN    = "the value must not be less than"
+	REASON_WRONG_TYPE   = "the value must be a"
+	REASON_REQUIRED_FOR = "must be set when"
+	REASON_NOT_PERCENT  = "the value must be between 0 and 100"
+)
+
+// The range checks for the numeric and enumerated fields. Fields that are not listed can hold any value of their type.
+// The check returns the reason the value is not valid, or an empty string.
+var fieldRules = map[string]func(reflect.Value) string{
+	"Edge.DefaultServiceRetryCount":              mustBePositive,
+	"Edge.EventLogRetention.MaxAgeH":             mustNotBeNegative,
+	"Edge.EventLogRetention.MaxCount":            mustNotBeNegative,
+	"Edge.EventLogRetention.PruneIntervalS":      mustBePositive,
+	"Edge.ExchangeChanges.Transport":             mustBeOneOf(ExchangeChangesTransport_POLL, ExchangeChangesTransport_LONGPOLL),
+	"Edge.ExchangeChanges.WaitS":                 mustBePositive,
+	"Edge.ExchangeChanges.FallbackS":             mustBePositive,
+	"Edge.ExchangeChanges.RetentionS":            mustBePositive,
+	"Edge.ExchangeHeartbeat":                     mustNotBeNegative,
+	"Edge.ExchangeMessagePollIncrement":          mustNotBeNegative,
+	"Edge.ExchangeMessagePollInterval":           mustBePositive,
+	"Edge.ExchangeMessagePollMaxInterval":        mustBePositive,
+	"Edge.ExchangeMessageTTL":                    mustNotBeNegative,
+	"Edge.InitialPollingBuffer":                  mustNotBeNegative,
+	"Edge.MaxAgreementPrelaunchTimeM":            mustNotBeNegative,
+	"Edge.NodeCheckIntervalS":                    mustBePositive,
+	"Edge.NodePolicyCheckIntervalS":              mustBePositive,
+	"Edge.ServiceUpgradeCheckIntervalS":          mustBePositive,
+	"Edge.SurfaceErrorAgreementPersistentS":      mustNotBeNegative,
+	"Edge.SurfaceErrorTimeoutS":                  mustNotBeNegative,
+	"AgreementBot.ActiveDeviceTimeoutS":          mustNotBeNegative,
+	"AgreementBot.AgreementBatchSize":            mustBePositive,
+	"AgreementBot.AgreementQueueSize":            mustBePositive,
+	"AgreementBot.AgreementWorkers":              mustNotBeNegative,
+	"AgreementBot.ArchiveExport.Format":          mustBeOneOf(ArchiveExportFormat_JSON, ArchiveExportFormat_CSV),
+	"AgreementBot.ArchiveExport.MaxFileSizeKB":   mustBePositive,
+	"AgreementBot.ArchiveExport.MaxFiles":        mustNotBeNegative,
+	"AgreementBot.CheckUpdatedPolicyS":           mustNotBeNegative,
+	"AgreementBot.ExchangeChangesRetentionS":     mustNotBeNegative,
+	"AgreementBot.ExchangeHeartbeat":             mustNotBeNegative,
+	"AgreementBot.ExchangeMessageTTL":            mustNotBeNegative,
+	"AgreementBot.MaxExchangeChanges":            mustBePositive,
+	"AgreementBot.MessageKeyCheck":               mustNotBeNegative,
+	"AgreementBot.MMSGarbageCollectionInterval":  mustBePositive,
+	"AgreementBot.Postgresql.MaxOpenConnections": mustNotBeNegative,
+	"AgreementBot.PurgeArchivedAgreementHours":   mustNotBeNegative,
+	"AgreementBot.TxLostDelayTolerationSeconds":  mustNotBeNegative,
+	"Watchdog.CheckIntervalS":                    mustBePositive,
+	"EventJournal.MaxFileSizeKB":                 mustBePositive,
+	"EventJournal.MaxFiles":                      mustNotBeNegative,
+	"Log.Verbosity":                              mustNotBeNegative,
+	"ExchangeRetry.MaxIntervalS":                 mustBePositive,
+	"ExchangeRetry.Multiplier":                   mustBeAtLeastOne,
+	"ExchangeRetry.JitterPercent":                mustBePercent,
+	"ExchangeRetry.BreakerOpenS":                 mustBePositive,
+	"ExchangeCache.PersistIntervalS":             mustBePositive,
+	"ExchangeCache.PersistMaxAgeS":               mustBePositive,
+	"MessageKeyRotation.IntervalH":               mustNotBeNegative,
+	"MessageKeyRotation.GraceS":                  mustBePositive,
+	"MessageEnvelope.KeyType":                    mustBeOneOf(MessageKeyType_RSA, MessageKeyType_ED25519),
+	"AuditLog.MaxFileSizeKB":                     mustBePositive,
+	"AuditLog.MaxFiles":                          mustNotBeNegative,
+}
+
+func mustBeAtLeastOne(v reflect.Value) string {
+	if v.Float() < 1 {
+		return fmt.Sprintf("%v 1", REASON_LESS_THAN)
+	}
+	return ""
+}
+
+func mustBePercent(v reflect.Value) string {
+	if v.Int() < 0 || v.Int() > 100 {
+		return REASON_NOT_PERCENT
+	}
+	return ""
+}
+
+func mustBeOneOf(values ...string) func(reflect.Value) string {
+	return func(v reflect.Value) string {
+		for _, value := range values {
+			if v.String() == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%v %v", REASON_NOT_ONE_OF, strings.Join(quoted(values), ", "))
+	}
+}
+
+func quoted(values []string) []string {
+	q := make([]string, 0, len(values))
+	for _, v := range values {
+		q = append(q, fmt.Sprintf("%q", v))
+	}
+	return q
+}
+
+// Check the configuration, after the defaults have been set. The unknown keys and the types of the values can only be
+// checked in the config file itself, see CheckConfigFile.
+func (c *HorizonConfig) Validate() ConfigProblems {
+	problems := make(ConfigProblems, 0)
+
+	fields := make([]string, 0, len(fieldRules))
+	for field := range fieldRules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value := c.field(field)
+		if reason := fieldRules[field](value); reason != "" {
+			problems = append(problems, ConfigProblem{Field: field, Message: fmt.Sprintf("%v, found %v", reason, value.Interface())})
+		}
+	}
+
+	return append(problems, c.validateCombinations()...)
+}
+
+// Check the settings that depend on each other.
+func (c *HorizonConfig) validateCombinations() ConfigProblems {
+	problems := make(ConfigProblems, 0)
+	edge := &c.Edge
+	agbot := &c.AgreementBot
+
+	// The poll interval never grows beyond the starting interval, see Read.
+	if edge.ExchangeMessagePollMaxInterval < edge.ExchangeMessagePollInterval {
+		problems = append(problems, ConfigProblem{
+			Field:   "Edge.ExchangeMessagePollMaxInterval",
+			Message: fmt.Sprintf("%v Edge.ExchangeMessagePollInterval (%v), found %v, using %v", REASON_LESS_THAN, edge.ExchangeMessagePollInterval, edge.ExchangeMessagePollMaxInterval, edge.ExchangeMessagePollInterval),
+			Warning: true,
+		})
+	}
+
+	// The agbot uses only one database. When more than one is configured, the others are silently ignored.
+	databases := make([]string, 0)
+	if agbot.InMemoryDB {
+		databases = append(databases, "AgreementBot.InMemoryDB")
+	}
+	if agbot.DBPath != "" {
+		databases = append(databases, "AgreementBot.DBPath")
+	}
+	if agbot.Postgresql != (PostgresqlConfig{}) {
+		databases = append(databases, "AgreementBot.Postgresql")
+	}
+	if len(databases) > 1 {
+		problems = append(problems, ConfigProblem{
+			Field:   databases[0],
+			Message: fmt.Sprintf("only one agbot database can be configured, found %v", strings.Join(databases, ", ")),
+		})
+	}
+
+	if agbot.Postgresql != (PostgresqlConfig{}) {
+		if agbot.Postgresql.Host == "" {
+			problems = append(problems, requiredFor("AgreementBot.Postgresql.Host", "AgreementBot.Postgresql is configured"))
+		}
+		if agbot.Postgresql.DBName == "" {
+			problems = append(problems, requiredFor("AgreementBot.Postgresql.DBName", "AgreementBot.Postgresql is configured"))
+		}
+		if agbot.PartitionStale == 0 {
+			problem := requiredFor("AgreementBot.PartitionStale", "AgreementBot.Postgresql is configured")
+			problem.Message += fmt.Sprintf(", using %v seconds", c.GetPartitionStale())
+			problem.Warning = true
+			problems = append(problems, problem)
+		}
+	}
+
+	if agbot.SecureAPIListenHost != "" && agbot.SecureAPIListenPort == "" {
+		problems = append(problems, requiredFor("AgreementBot.SecureAPIListenPort", "AgreementBot.SecureAPIListenHost is set"))
+	}
+	if agbot.SecureAPIServerCert != "" && agbot.SecureAPIServerKey == "" {
+		problems = append(problems, requiredFor("AgreementBot.SecureAPIServerKey", "AgreementBot.SecureAPIServerCert is set"))
+	} else if agbot.SecureAPIServerKey != "" && agbot.SecureAPIServerCert == "" {
+		problems = append(problems, requiredFor("AgreementBot.SecureAPIServerCert", "AgreementBot.SecureAPIServerKey is set"))
+	}
+
+	if c.MessageEnvelope.KeyType == MessageKeyType_ED25519 && !c.MessageEnvelope.PeersSupportV2 {
+		problems = append(problems, ConfigProblem{
+			Field:   "MessageEnvelope.KeyType",
+			Message: fmt.Sprintf("%v requires MessageEnvelope.PeersSupportV2, using %v", MessageKeyType_ED25519, MessageKeyType_RSA),
+			Warning: true,
+		})
+	}
+
+	if c.Watchdog.RestartOnStuck && !c.Watchdog.IsEnabled() {
+		problems = append(problems, ConfigProblem{
+			Field:   "Watchdog.RestartOnStuck",
+			Message: "has no effect because the watchdog is disabled by Watchdog.StuckTimeoutS",
+			Warning: true,
+		})
+	}
+
+	return problems
+}
+
+func requiredFor(field string, condition string) ConfigProblem {
+	return ConfigProblem{Field: field, Message: fmt.Sprintf("%v %v", REASON_REQUIRED_FOR, condition)}
+}
+
+// Check the content of a config file for keys that do not match a field of HorizonConfig and for values of the wrong
+// type. The JSON decoder ignores unknown keys, so a misspelled key would otherwise leave the field at its default
+// without any sign of the mistake. Unknown keys are warnings rather than errors because config files written for older
+// releases can still hold keys that are no longer used, such as Edge.GethURL.
+func CheckConfigFile(data []byte) ConfigProblems {
+	problems := make(ConfigProblems, 0)
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return problems
+	}
+	checkKeys("", raw, reflect.TypeOf(HorizonConfig{}), &problems)
+
+	var cfg HorizonConfig
+	checkTypes(data, &cfg, &problems)
+	return problems
+}
+
+func checkKeys(prefix string, raw map[string]interface{}, t reflect.Type, problems *ConfigProblems) {
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f, ok := jsonField(t, key)
+		if !ok {
+			*problems = append(*problems, ConfigProblem{Field: prefix + key, Message: REASON_UNKNOWN_KEY, Warning: true})
+			continue
+		}
+
+		// Only nested structs have keys of their own, the keys of a map are values.
+		if f.Type.Kind() == reflect.Struct {
+			if nested, ok := raw[key].(map[string]interface{}); ok {
+				checkKeys(prefix+f.Name+".", nested, f.Type, problems)
+			}
+		}
+	}
+}
+
+// Returns the field of the struct that the JSON decoder would decode the key into. Like the decoder, the match is not
+// case sensitive.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func checkTypes(data []byte, cfg *HorizonConfig, problems *ConfigProblems) {
+	for {
+		err := json.Unmarshal(data, cfg)
+		typeErr, ok := err.(*json.UnmarshalTypeError)
+		if !ok {
+			return
+		}
+
+		*problems = append(*problems, ConfigProblem{
+			Field:   fieldPath(typeErr.Field),
+			Message: fmt.Sprintf("%v %v, found a %v", REASON_WRONG_TYPE, typeErr.Type, typeErr.Value),
+		})
+
+		// Only the first type error is returned by the decoder, remove the value and decode again to find the next one.
+		var raw map[string]interface{}
+		if json.Unmarshal(data, &raw) != nil || !deleteKey(raw, strings.Split(typeErr.Field, ".")) {
+			return
+		}
+		data, _ = json.Marshal(raw)
+	}
+}
+
+// Returns the path of the field in HorizonConfig that the JSON decoder reported by the keys in the config file.
+func fieldPath(keys string) string {
+	t := reflect.TypeOf(HorizonConfig{})
+	names := make([]string, 0)
+	for _, key := range strings.Split(keys, ".") {
+		f, ok := jsonField(t, key)
+		if !ok {
+			names = append(names, key)
+			continue
+		}
+		names = append(names, f.Name)
+		t = f.Type
+		if t.Kind() != reflect.Struct {
+			t = reflect.TypeOf(struct{}{})
+		}
+	}
+	return strings.Join(names, ".")
+}
+
+// Delete the value at the path of keys, matching the keys the way the JSON decoder does. Returns false if there is no
+// such value.
+func deleteKey(raw map[string]interface{}, path []string) bool {
+	for key, value := range raw {
+		if !strings.EqualFold(key, path[0]) {
+			continue
+		} else if len(path) == 1 {
+			delete(raw, key)
+			return true
+		} else if nested, ok := value.(map[string]interface{}); ok {
+			return deleteKey(nested, path[1:])
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+// +build unit
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_CheckConfigFile(t *testing.T) {
+	data := []byte(`{
+		"Edge": {"NodeCheckIntervalS": "15", "GethURL": "", "EventLogRetention": {"MaxAgeHours": 1}},
+		"agreementbot": {"AgreementBatchSize": -1, "APIListen": "0.0.0.0:8046"},
+		"ArchSynonyms": {"x86_64": "amd64"},
+		"Unknown": true
+	}`)
+
+	problems := CheckConfigFile(data)
+
+	expected := map[string]bool{
+		"Edge.NodeCheckIntervalS":            false,
+		"AgreementBot.AgreementBatchSize":    false,
+		"Edge.GethURL":                       true,
+		"Edge.EventLogRetention.MaxAgeHours": true,
+		"Unknown":                            true,
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("expected %v problems, got %v", len(expected), problems)
+	}
+	for _, p := range problems {
+		if warning, ok := expected[p.Field]; !ok || warning != p.Warning {
+			t.Errorf("unexpected problem %v", p)
+		}
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	cfg := HorizonConfig{
+		Edge: Config{
+			ExchangeMessagePollInterval:    20,
+			ExchangeMessagePollMaxInterval: 10,
+			NodeCheckIntervalS:             -5,
+		},
+		AgreementBot: AGConfig{
+			DBPath:              "/var/agbot",
+			Postgresql:          PostgresqlConfig{Host: "db", Port: "5432"},
+			SecureAPIServerCert: "/keys/agbotapi.crt",
+			ArchiveExport:       ArchiveExportConfig{Format: "xml"},
+		},
+		MessageEnvelope: MessageEnvelopeConfig{KeyType: MessageKeyType_ED25519},
+	}
+
+	problems := cfg.Validate()
+
+	found := make(map[string]ConfigProblem)
+	for _, p := range problems {
+		found[p.Field] = p
+	}
+
+	for _, field := range []string{"Edge.NodeCheckIntervalS", "AgreementBot.DBPath", "AgreementBot.Postgresql.DBName", "AgreementBot.SecureAPIServerKey", "AgreementBot.ArchiveExport.Format"} {
+		if p, ok := found[field]; !ok || p.Warning {
+			t.Errorf("expected an error for %v, got %v", field, problems)
+		}
+	}
+	for _, field := range []string{"Edge.ExchangeMessagePollMaxInterval", "AgreementBot.PartitionStale", "MessageEnvelope.KeyType"} {
+		if p, ok := found[field]; !ok || !p.Warning {
+			t.Errorf("expected a warning for %v, got %v", field, problems)
+		}
+	}
+	if _, ok := found["AgreementBot.Postgresql.Host"]; ok {
+		t.Errorf("unexpected problem for AgreementBot.Postgresql.Host, got %v", problems)
+	}
+}
+
+func Test_Read_invalid(t *testing.T) {
+	f, err := ioutil.TempFile("", "anax.config")
+	if err != nil {
+		t.Fatalf("unable to create config file, error: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"Edge": {"NodeCheckIntervalS": -1, "ExchangeHeartbeat": "60"}, "AgreementBot": {"AgreementWorkers": 5}}`)
+	f.Close()
+
+	// All the errors are reported at once.
+	if _, err := Read(f.Name()); err == nil {
+		t.Errorf("expected an error reading an invalid config file")
+	} else if !strings.Contains(err.Error(), "Edge.NodeCheckIntervalS") || !strings.Contains(err.Error(), "Edge.ExchangeHeartbeat") {
+		t.Errorf("expected both invalid fields to be reported, got %v", err)
+	}
+}
+
+// A max poll interval less than the starting interval is raised to the starting interval.
+func Test_Read_poll_max_interval(t *testing.T) {
+	f, err := ioutil.TempFile("", "anax.config")
+	if err != nil {
+		t.Fatalf("unable to create config file, error: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"Edge": {"ExchangeMessagePollInterval": 60, "ExchangeMessagePollMaxInterval": 30}}`)
+	f.Close()
+
+	if cfg, err := Read(f.Name()); err != nil {
+		t.Errorf("unexpected error reading the config file, error: %v", err)
+	} else if cfg.Edge.ExchangeMessagePollMaxInterval != 60 {
+		t.Errorf("expected the max poll interval to be 60, got %v", cfg.Edge.ExchangeMessagePollMaxInterval)
+	}
+}
+
+func Test_Effective(t *testing.T) {
+	cfg := HorizonConfig{
+		Edge:         Config{DBPath: "/var/horizon"},
+		AgreementBot: AGConfig{ExchangeToken: "token", Postgresql: PostgresqlConfig{User: "admin", Password: "secret"}},
+	}
+
+	effective := cfg.Effective()
+
+	if _, ok := effective["Collaborators"]; ok {
+		t.Errorf("expected the collaborators to be left out")
+	}
+	edge := effective["Edge"].(map[string]interface{})
+	agbot := effective["AgreementBot"].(map[string]interface{})
+	postgresql := agbot["Postgresql"].(map[string]interface{})
+	if edge["DBPath"] != "/var/horizon" || postgresql["User"] != "admin" {
+		t.Errorf("unexpected effective config %v", effective)
+	}
+	if agbot["ExchangeToken"] != SECRET_VALUE || postgresql["Password"] != SECRET_VALUE || agbot["DefaultWorkloadPW"] != "" {
+		t.Errorf("expected the secrets that are set to be masked, got %v", effective)
+	}
+}
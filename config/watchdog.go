@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The configuration of the worker watchdog. The watchdog marks a worker as degraded when it has been handling a single
+// command or event for too long, for example because it is blocked on a hung docker or exchange call.
+type WatchdogConfig struct {
+	StuckTimeoutS  int  // A worker is degraded when it has been handling one command or event for longer than this. The default is 600 seconds, a negative value disables the watchdog.
+	CheckIntervalS int  // How often the watchdog checks the workers. The default is 30 seconds.
+	RestartOnStuck bool // Restart the agent when a worker is degraded. The agent shuts down as it does on SIGTERM and exits so that its service manager can start it again.
+}
+
+func (w *WatchdogConfig) String() string {
+	return fmt.Sprintf("StuckTimeoutS: %v, CheckIntervalS: %v, RestartOnStuck: %v", w.StuckTimeoutS, w.CheckIntervalS, w.RestartOnStuck)
+}
+
+// Returns true if the watchdog should run.
+func (w *WatchdogConfig) IsEnabled() bool {
+	return w.StuckTimeoutS > 0
+}
@@ -182,3 +182,24 @@ func NewNodeUnconfigCommand(msg *events.NodeShutdownCompleteMessage) *NodeUnconf
 		msg: msg,
 	}
 }
+
+// ==============================================================================================================
+// This worker command is used to tell the worker that the node's state was restored from a backup, so the containers
+// have to be synced up with the restored agreements.
+type NodeStateRestoredCommand struct {
+	msg *events.NodeStateRestoredMessage
+}
+
+func (n NodeStateRestoredCommand) String() string {
+	return n.ShortString()
+}
+
+func (n NodeStateRestoredCommand) ShortString() string {
+	return fmt.Sprintf("NodeStateRestored Command, Msg: %v", n.msg)
+}
+
+func NewNodeStateRestoredCommand(msg *events.NodeStateRestoredMessage) *NodeStateRestoredCommand {
+	return &NodeStateRestoredCommand{
+		msg: msg,
+	}
+}
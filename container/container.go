@@ -18,6 +18,7 @@ import (
 	"github.com/open-horizon/anax/eventlog"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/metrics"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/resource"
@@ -33,6 +34,7 @@ import (
 )
 
 const LABEL_PREFIX = "openhorizon.anax"
+
 const IPT_COLONUS_ISOLATED_CHAIN = "OPENHORIZON-ANAX-ISOLATION"
 
 // messages for event logs
@@ -54,6 +56,8 @@ const (
 	EL_CONT_TERM_UNABLE_INIT_DOCKER_CLIENT    = "anax terminating. Failed to instantiate docker client. %v"
 )
 
+var containerRestarts = metrics.NewCounterVec("anax_container_restarts_total", "The number of times the containers of a failed dependent service were restarted.", "service", "result")
+
 // This is does nothing useful at run time.
 // This code is only used in compileing time to make the eventlog messages gets into the catalog so that
 // they can be translated.
@@ -500,6 +504,24 @@ func CreateCLIContainerWorker(config *config.HorizonConfig) (*ContainerWorker, e
 	}, nil
 }
 
+// Create a container worker that is only used to look up the containers started by the agent, it is never started.
+// An error is returned if docker cannot be reached, so that callers do not mistake an unreachable docker for the
+// absence of containers.
+func CreateQueryContainerWorker(config *config.HorizonConfig, db *bolt.DB) (*ContainerWorker, error) {
+	client, derr := docker.NewClient(config.Edge.DockerEndpoint)
+	if derr != nil {
+		return nil, derr
+	} else if derr := client.Ping(); derr != nil {
+		return nil, derr
+	}
+
+	return &ContainerWorker{
+		BaseWorker: worker.NewBaseWorker("query", config, nil),
+		db:         db,
+		client:     client,
+	}, nil
+}
+
 func NewContainerWorker(name string, config *config.HorizonConfig, db *bolt.DB, am *resource.AuthenticationManager) *ContainerWorker {
 
 	// do not start this container if the the node is registered and the type is cluster
@@ -579,7 +601,7 @@ func (w *ContainerWorker) NewEvent(incoming events.Message) {
 		w.pattern = msg.Pattern()
 
 		// stop the container worker for the cluster device type
-		if msg.DeviceType() == persistence.DEVICE_TYPE_CLUSTER {
+		if msg.DeviceType() == persistence.DEVICE_TYPE_CLUSTER && msg.Event().Id == events.NEW_DEVICE_REG {
 			w.Commands <- worker.NewTerminateCommand("cluster node")
 		}
 
@@ -653,6 +675,13 @@ func (w *ContainerWorker) NewEvent(incoming events.Message) {
 			w.Commands <- NewNodeUnconfigCommand(msg)
 		}
 
+	case *events.NodeStateRestoredMessage:
+		msg, _ := incoming.(*events.NodeStateRestoredMessage)
+		switch msg.Event().Id {
+		case events.NODE_STATE_RESTORED:
+			w.Commands <- NewNodeStateRestoredCommand(msg)
+		}
+
 	default: // nothing
 
 	}
@@ -1621,6 +1650,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 			log_str := EL_CONT_START_CONTAINER_ERROR_FOR_AG
 			if lc.IsRetry {
 				log_str = EL_CONT_RESTART_CONTAINER_ERROR_FOR_AG
+				containerRestarts.Inc(serviceIdentity, "failure")
 			}
 			eventlog.LogServiceEvent2(b.db, persistence.SEVERITY_ERROR,
 				persistence.NewMessageMeta(log_str, fmt.Sprintf("%v", lc.AgreementIds), err.Error()),
@@ -1633,6 +1663,7 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 
 			// for retrying, restore the network connection with the parents
 			if lc.IsRetry {
+				containerRestarts.Inc(serviceIdentity, "success")
 				glog.V(5).Infof("Retrying process restoring the network connection with the parents for service %v.", lc.Name)
 				if ms_parents_containers, err := b.findParentContainersForService(lc.Name); err != nil {
 					eventlog.LogServiceEvent2(b.db, persistence.SEVERITY_ERROR,
@@ -1794,6 +1825,11 @@ func (b *ContainerWorker) CommandHandler(command worker.Command) bool {
 		}
 		b.Commands <- worker.NewTerminateCommand("shutdown")
 
+	case *NodeStateRestoredCommand:
+		cmd, _ := command.(*NodeStateRestoredCommand)
+		glog.V(3).Infof("ContainerWorker received node state restored command: %v", cmd.ShortString())
+		b.syncupResources()
+
 	default:
 		return false
 	}
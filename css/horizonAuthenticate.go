@@ -463,9 +463,11 @@ func (auth *HorizonAuthenticate) invokeExchange(url string, user string, pw stri
 	req.Header.Add("Accept", "application/json")
 	req.Close = true
 
-	// Send the request to verify the user.
-	resp, err := auth.httpClient.Do(req)
-	if err != nil {
+	// Send the request to verify the user. It is not sent while the circuit breaker for the exchange is open.
+	resp, err := exchange.DoWithBreaker(auth.httpClient, req)
+	if te, ok := err.(*exchange.TransportError); ok {
+		return nil, te
+	} else if err != nil {
 		return nil, errors.New(fmt.Sprintf("unable to send HTTP request for %v, error %v", apiMsg, err))
 	} else {
 		return resp, nil
@@ -474,11 +476,9 @@ func (auth *HorizonAuthenticate) invokeExchange(url string, user string, pw stri
 
 // Common function to invoke the Exchange API with retry
 func (auth *HorizonAuthenticate) invokeExchangeWithRetry(url string, user string, pw string) (*http.Response, error) {
-	var currRetry int
-	var resp *http.Response
-	var err error
-	for currRetry = EX_MAX_RETRY; currRetry > 0; {
-		resp, err = auth.invokeExchange(url, user, pw)
+	retry := exchange.NewRetryPolicy(EX_MAX_RETRY, EX_RETRY_INTERVAL)
+	for {
+		resp, err := auth.invokeExchange(url, user, pw)
 
 		// Log the HTTP response code.
 		if trace.IsLogging(logger.TRACE) {
@@ -489,27 +489,26 @@ func (auth *HorizonAuthenticate) invokeExchangeWithRetry(url string, user string
 			}
 		}
 
-		if err == nil {
-			break
+		if !exchange.IsTransportError(resp, err) {
+			return resp, err
 		}
-		if exchange.IsTransportError(resp, err) {
-			// Log the transport error and retry
-			if trace.IsLogging(logger.TRACE) {
-				trace.Debug(cssALS(fmt.Sprintf("received transport error, retry...")))
-			}
 
-			currRetry--
-			time.Sleep(time.Duration(EX_RETRY_INTERVAL) * time.Second)
-		} else {
-			return resp, err
+		// Log the transport error and retry
+		if trace.IsLogging(logger.TRACE) {
+			trace.Debug(cssALS(fmt.Sprintf("received transport error, retry...")))
 		}
-	}
 
-	if currRetry == 0 {
-		return resp, errors.New(fmt.Sprintf("unable to verify %v in the exchange, exceeded %v retries", user, EX_MAX_RETRY))
+		tpErr := err
+		if tpErr == nil {
+			tpErr = exchange.NewTransportError(fmt.Sprintf("HTTP status %v", resp.Status), resp)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if !retry.Backoff(tpErr) {
+			return nil, errors.New(fmt.Sprintf("unable to verify %v in the exchange, exceeded %v retries, error: %v", user, EX_MAX_RETRY, tpErr))
+		}
 	}
-
-	return resp, err
 }
 
 // Create an https connection, using a supplied SSL CA certificate.
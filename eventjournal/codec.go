@@ -0,0 +1,477 @@
+package eventjournal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/events"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// The codec turns an events.Message into JSON and back again. Messages keep their state in unexported fields, which
+// the codec does not read, so only messages that implement events.JournalMessage are encoded. The codec encodes the
+// journal form of the message, walking it with reflection so that values held in interface fields are written with
+// the name of their dynamic type. Those types have to be registered with RegisterType before the message can be
+// decoded. Types that are encoded are registered automatically, so a journal can always be decoded by the process
+// that wrote it. Unexported fields are never encoded.
+
+// The deepest nesting of values that the codec will follow, in case a message holds a reference cycle.
+const MAX_DEPTH = 100
+
+// The keys used to encode interface values.
+const (
+	KEY_TYPE  = "$type"
+	KEY_VALUE = "$value"
+	KEY_ERROR = "$error"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+var typesLock sync.Mutex
+var types = make(map[string]reflect.Type)
+
+// Register the types of the given values so that they can be decoded from a journal. Message types and the types
+// held in interface fields of messages need to be registered.
+func RegisterType(values ...interface{}) {
+	for _, v := range values {
+		registerType(reflect.TypeOf(v))
+	}
+}
+
+func registerType(t reflect.Type) {
+	typesLock.Lock()
+	defer typesLock.Unlock()
+	types[typeKey(t)] = t
+}
+
+func lookupType(key string) (reflect.Type, bool) {
+	typesLock.Lock()
+	defer typesLock.Unlock()
+	t, ok := types[key]
+	return t, ok
+}
+
+// The name of a type including the full package path, so that types with the same name in packages with the same
+// name (for example the node and agbot persistence packages) are not confused.
+func typeKey(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + typeKey(t.Elem())
+	} else if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		return "[]" + typeKey(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%v]%v", t.Len(), typeKey(t.Elem()))
+	case reflect.Map:
+		return "map[" + typeKey(t.Key()) + "]" + typeKey(t.Elem())
+	}
+	return t.String()
+}
+
+// Returns true if the type has its own JSON form, for example time.Time.
+func hasJSONForm(t reflect.Type) bool {
+	return t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && t.Implements(marshalerType) && reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// Returns true if the field of the struct is exported.
+func isExported(f reflect.StructField) bool {
+	return f.PkgPath == ""
+}
+
+// Encode the journal form of the message as JSON. The key of the message type is also returned. The encoded message
+// is nil when the message does not implement events.JournalMessage.
+func EncodeMessage(msg events.Message) (string, json.RawMessage, error) {
+	if msg == nil {
+		return "", nil, errors.New(fmt.Sprintf("unable to encode a nil message"))
+	}
+
+	t := reflect.TypeOf(msg)
+	jm, ok := msg.(events.JournalMessage)
+	if !ok {
+		return typeKey(t), nil, nil
+	}
+
+	// The form is held in an interface, so that it is written with the name of its type.
+	form := jm.JournalForm()
+	enc, err := encodeValue(reflect.ValueOf(&form).Elem(), 0)
+	if err != nil {
+		return "", nil, errors.New(fmt.Sprintf("unable to encode message %T, error: %v", msg, err))
+	}
+
+	b, err := json.Marshal(enc)
+	if err != nil {
+		return "", nil, errors.New(fmt.Sprintf("unable to marshal message %T, error: %v", msg, err))
+	}
+	return typeKey(t), b, nil
+}
+
+func encodeValue(v reflect.Value, depth int) (interface{}, error) {
+	if depth > MAX_DEPTH {
+		return nil, errors.New(fmt.Sprintf("values are nested more than %v deep", MAX_DEPTH))
+	}
+
+	t := v.Type()
+	if hasJSONForm(t) {
+		b, err := v.Interface().(json.Marshaler).MarshalJSON()
+		return json.RawMessage(b), err
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		} else if t == errorType {
+			return map[string]interface{}{KEY_ERROR: v.Interface().(error).Error()}, nil
+		}
+		elem := v.Elem()
+		registerType(elem.Type())
+		enc, err := encodeValue(elem, depth+1)
+		return map[string]interface{}{KEY_TYPE: typeKey(elem.Type()), KEY_VALUE: enc}, err
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encodeValue(v.Elem(), depth+1)
+
+	case reflect.Struct:
+		// Locks are not part of the state of a message.
+		if t.PkgPath() == "sync" {
+			return nil, nil
+		}
+		out := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			if !isExported(t.Field(i)) {
+				continue
+			}
+			enc, err := encodeValue(v.Field(i), depth+1)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("field %v: %v", t.Field(i).Name, err))
+			}
+			out[t.Field(i).Name] = enc
+		}
+		return out, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if t.Key().Kind() == reflect.String {
+			out := make(map[string]interface{})
+			for _, k := range v.MapKeys() {
+				enc, err := encodeValue(v.MapIndex(k), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				out[k.String()] = enc
+			}
+			return out, nil
+		}
+		// Maps with other key types are written as a list of key and value pairs, sorted so that the output is stable.
+		pairs := make([][]interface{}, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			encK, err := encodeValue(k, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			encV, err := encodeValue(v.MapIndex(k), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, []interface{}{encK, encV})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return fmt.Sprintf("%v", pairs[i][0]) < fmt.Sprintf("%v", pairs[j][0]) })
+		return pairs, nil
+
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		} else if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			enc, err := encodeValue(v.Index(i), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = enc
+		}
+		return out, nil
+
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		// JSON has no form for these values, so they are written as strings.
+		if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64), nil
+		}
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	}
+
+	// Channels, functions and the like are not part of the state of a message.
+	return nil, nil
+}
+
+// Returns true if EncodeMessage encoded the message.
+func IsEncoded(raw json.RawMessage) bool {
+	return len(raw) != 0 && string(raw) != "null"
+}
+
+// Decode a message that was encoded by EncodeMessage. The type of its journal form must be registered.
+func DecodeMessage(key string, raw json.RawMessage) (events.Message, error) {
+	if !IsEncoded(raw) {
+		return nil, errors.New(fmt.Sprintf("message type %v is not recorded in the journal", key))
+	}
+
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to unmarshal message %v, error: %v", key, err))
+	}
+
+	var form events.JournalForm
+	if err := decodeValue(data, reflect.ValueOf(&form).Elem(), 0); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to decode message %v, error: %v", key, err))
+	} else if form == nil {
+		return nil, errors.New(fmt.Sprintf("message %v has no journal form", key))
+	}
+
+	// Forms build a pointer to the message, the message might have been sent as a value.
+	msg := form.JournalMessage()
+	if mk := typeKey(reflect.TypeOf(msg)); mk == key {
+		return msg, nil
+	} else if v := reflect.ValueOf(msg); v.Kind() == reflect.Ptr && typeKey(v.Elem().Type()) == key {
+		if m, ok := v.Elem().Interface().(events.Message); ok {
+			return m, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("journal form of message %v builds a %T", key, msg))
+}
+
+func typeError(data interface{}, t reflect.Type) error {
+	return errors.New(fmt.Sprintf("unable to decode %T into %v", data, t))
+}
+
+// Decode the data into v, which must be settable.
+func decodeValue(data interface{}, v reflect.Value, depth int) error {
+	if depth > MAX_DEPTH {
+		return errors.New(fmt.Sprintf("values are nested more than %v deep", MAX_DEPTH))
+	}
+
+	t := v.Type()
+	if data == nil {
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+
+	if hasJSONForm(t) {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		p := reflect.New(t)
+		if err := p.Interface().(json.Unmarshaler).UnmarshalJSON(b); err != nil {
+			return err
+		}
+		v.Set(p.Elem())
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return typeError(data, t)
+		}
+		if msg, ok := m[KEY_ERROR].(string); ok && t == errorType {
+			v.Set(reflect.ValueOf(errors.New(msg)))
+			return nil
+		}
+		key, ok := m[KEY_TYPE].(string)
+		if !ok {
+			return typeError(data, t)
+		}
+		dt, ok := lookupType(key)
+		if !ok {
+			return errors.New(fmt.Sprintf("type %v is not registered", key))
+		}
+		nv := reflect.New(dt).Elem()
+		if err := decodeValue(m[KEY_VALUE], nv, depth+1); err != nil {
+			return err
+		}
+		v.Set(nv)
+
+	case reflect.Ptr:
+		nv := reflect.New(t.Elem())
+		if err := decodeValue(data, nv.Elem(), depth+1); err != nil {
+			return err
+		}
+		v.Set(nv)
+
+	case reflect.Struct:
+		if t.PkgPath() == "sync" {
+			return nil
+		}
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return typeError(data, t)
+		}
+		for i := 0; i < t.NumField(); i++ {
+			if !isExported(t.Field(i)) {
+				continue
+			}
+			if fd, ok := m[t.Field(i).Name]; ok {
+				if err := decodeValue(fd, v.Field(i), depth+1); err != nil {
+					return errors.New(fmt.Sprintf("field %v: %v", t.Field(i).Name, err))
+				}
+			}
+		}
+
+	case reflect.Map:
+		nm := reflect.MakeMap(t)
+		if t.Key().Kind() == reflect.String {
+			m, ok := data.(map[string]interface{})
+			if !ok {
+				return typeError(data, t)
+			}
+			for k, d := range m {
+				kv := reflect.New(t.Key()).Elem()
+				kv.SetString(k)
+				vv := reflect.New(t.Elem()).Elem()
+				if err := decodeValue(d, vv, depth+1); err != nil {
+					return err
+				}
+				nm.SetMapIndex(kv, vv)
+			}
+		} else {
+			pairs, ok := data.([]interface{})
+			if !ok {
+				return typeError(data, t)
+			}
+			for _, p := range pairs {
+				pair, ok := p.([]interface{})
+				if !ok || len(pair) != 2 {
+					return typeError(p, t)
+				}
+				kv := reflect.New(t.Key()).Elem()
+				vv := reflect.New(t.Elem()).Elem()
+				if err := decodeValue(pair[0], kv, depth+1); err != nil {
+					return err
+				} else if err := decodeValue(pair[1], vv, depth+1); err != nil {
+					return err
+				}
+				nm.SetMapIndex(kv, vv)
+			}
+		}
+		v.Set(nm)
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s, ok := data.(string)
+			if !ok {
+				return typeError(data, t)
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		l, ok := data.([]interface{})
+		if !ok {
+			return typeError(data, t)
+		}
+		nv := reflect.MakeSlice(t, len(l), len(l))
+		for i, d := range l {
+			if err := decodeValue(d, nv.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+		v.Set(nv)
+
+	case reflect.Array:
+		l, ok := data.([]interface{})
+		if !ok || len(l) != t.Len() {
+			return typeError(data, t)
+		}
+		for i, d := range l {
+			if err := decodeValue(d, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return typeError(data, t)
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return typeError(data, t)
+		}
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := data.(json.Number)
+		if !ok {
+			return typeError(data, t)
+		}
+		u, err := strconv.ParseUint(string(n), 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		var s string
+		switch d := data.(type) {
+		case json.Number:
+			s = string(d)
+		case string:
+			s = d
+		default:
+			return typeError(data, t)
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return typeError(data, t)
+		}
+		v.SetString(s)
+	}
+
+	return nil
+}
@@ -0,0 +1,367 @@
+package eventjournal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/events"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The event journal records every event that is passed between the workers, along with the time it was dispatched, the
+// worker that sent it and the workers it was delivered to. Records are appended to the current journal file as JSON lines,
+// and the file is rotated when it gets too big. A journal can be read back and replayed into workers, so that the sequence
+// of events that led to a bad state can be reproduced. The state of a message is only recorded when the message
+// implements events.JournalMessage, other messages are recorded with their type and event id only and cannot be replayed.
+//
+// Records are written to the file on a go routine of the journal, so that the file I/O does not hold up the dispatch of
+// events.
+
+// The name of the file that records are appended to. Rotated files have a timestamp added to the name.
+const JOURNAL_FILE_PREFIX = "events"
+
+const JOURNAL_FILE_EXTENSION = "jsonl"
+
+// The time format added to rotated file names. It sorts in time order.
+const FILE_TIME_FORMAT = "20060102T150405.000000000Z"
+
+// The largest record that can be read from a journal file.
+const MAX_RECORD_SIZE = 16 * 1024 * 1024
+
+// The most records that can wait to be written. Records are dropped when the file I/O falls this far behind.
+const MAX_QUEUED_RECORDS = 1000
+
+// A single event in the journal. The message is encoded by EncodeMessage, the type is the key of the message type.
+type JournalRecord struct {
+	Sequence     uint64          `json:"sequence"`
+	Time         time.Time       `json:"time"`
+	Source       string          `json:"source"`
+	Destinations []string        `json:"destinations"`
+	Type         string          `json:"type"`
+	EventId      events.EventId  `json:"event_id"`
+	Summary      string          `json:"summary,omitempty"`
+	Message      json.RawMessage `json:"message,omitempty"`
+}
+
+func (r JournalRecord) String() string {
+	return fmt.Sprintf("Sequence: %v, Time: %v, Source: %v, Destinations: %v, Type: %v, EventId: %v, Summary: %v",
+		r.Sequence, r.Time, r.Source, r.Destinations, r.Type, r.EventId, r.Summary)
+}
+
+// Returns true if the state of the message was recorded, so that the message can be replayed.
+func (r JournalRecord) IsReplayable() bool {
+	return IsEncoded(r.Message)
+}
+
+// Returns the message that was recorded.
+func (r JournalRecord) Decode() (events.Message, error) {
+	return DecodeMessage(r.Type, r.Message)
+}
+
+// The Journal appends records to the current journal file, rotating it when it exceeds the configured size and deleting
+// the oldest rotated files when there are too many. It is safe for concurrent use. The file is only used by the writer
+// go routine once the journal is created.
+type Journal struct {
+	lock     sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	sequence uint64
+	queue    chan JournalRecord
+	closed   bool
+	written  chan bool
+}
+
+func NewJournal(cfg *config.EventJournalConfig) (*Journal, error) {
+	if !cfg.IsEnabled() {
+		return nil, errors.New("event journal path is not configured")
+	} else if err := os.MkdirAll(cfg.Path, 0700); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to create event journal directory %v, error: %v", cfg.Path, err))
+	}
+
+	j := &Journal{
+		dir:      cfg.Path,
+		maxSize:  cfg.MaxFileSizeKB * 1024,
+		maxFiles: cfg.MaxFiles,
+		queue:    make(chan JournalRecord, MAX_QUEUED_RECORDS),
+		written:  make(chan bool),
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+
+	go j.writer()
+	return j, nil
+}
+
+func (j *Journal) String() string {
+	return fmt.Sprintf("Dir: %v, MaxSize: %v, MaxFiles: %v, Sequence: %v", j.dir, j.maxSize, j.maxFiles, j.sequence)
+}
+
+// The path of the file that records are currently appended to.
+func (j *Journal) CurrentFile() string {
+	return path.Join(j.dir, JOURNAL_FILE_PREFIX+"."+JOURNAL_FILE_EXTENSION)
+}
+
+// Open the current journal file for appending. The caller must be the writer, or the constructor.
+func (j *Journal) open() error {
+	fileName := j.CurrentFile()
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to open event journal file %v, error: %v", fileName, err))
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.New(fmt.Sprintf("unable to stat event journal file %v, error: %v", fileName, err))
+	}
+
+	j.file = f
+	j.size = info.Size()
+	return nil
+}
+
+// Record a message sent by the source worker to the destination workers. The record is queued to be written. A message
+// that cannot be recorded is logged and skipped, the journal never holds up the dispatch of events.
+func (j *Journal) Record(source string, destinations []string, msg events.Message) {
+	if err := j.record(source, destinations, msg); err != nil {
+		glog.Errorf(ejLogString(fmt.Sprintf("unable to record message %v, error: %v", msg, err)))
+	}
+}
+
+func (j *Journal) record(source string, destinations []string, msg events.Message) error {
+	msgType, encoded, err := EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.closed {
+		return errors.New("event journal is closed")
+	}
+
+	j.sequence++
+	rec := JournalRecord{
+		Sequence:     j.sequence,
+		Time:         time.Now().UTC(),
+		Source:       source,
+		Destinations: destinations,
+		Type:         msgType,
+		EventId:      msg.Event().Id,
+		Summary:      summary(msg),
+		Message:      encoded,
+	}
+
+	select {
+	case j.queue <- rec:
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("%v records are waiting to be written, dropped record %v", MAX_QUEUED_RECORDS, rec.Sequence))
+	}
+}
+
+// The summary of the message without its secrets, which is the summary of the message built from its journal form.
+// Messages without a journal form might hold secrets, so there is no summary for them.
+func summary(msg events.Message) string {
+	if jm, ok := msg.(events.JournalMessage); ok {
+		return jm.JournalForm().JournalMessage().ShortString()
+	}
+	return ""
+}
+
+// Write the queued records to the journal file until the journal is closed.
+func (j *Journal) writer() {
+	for rec := range j.queue {
+		if err := j.write(rec); err != nil {
+			glog.Errorf(ejLogString(fmt.Sprintf("unable to write record %v, error: %v", rec, err)))
+		}
+	}
+	close(j.written)
+}
+
+func (j *Journal) write(rec JournalRecord) error {
+	if j.file == nil {
+		// The file could not be reopened after it was rotated, try again.
+		if err := j.open(); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to marshal journal record, error: %v", err))
+	}
+
+	n, err := j.file.Write(append(b, '\n'))
+	j.size += int64(n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to write to event journal file %v, error: %v", j.CurrentFile(), err))
+	}
+
+	// The record is written, so a failure to rotate is only logged. Rotation is attempted again on the next record.
+	if j.maxSize > 0 && j.size >= j.maxSize {
+		if err := j.rotate(); err != nil {
+			glog.Errorf(ejLogString(fmt.Sprintf("unable to rotate event journal file %v, error: %v", j.CurrentFile(), err)))
+		}
+	}
+	return nil
+}
+
+// Rename the current journal file, open a new one and delete the oldest rotated files beyond the configured limit. The
+// caller must be the writer.
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return err
+	}
+	j.file = nil
+
+	rotated := path.Join(j.dir, fmt.Sprintf("%v-%v.%v", JOURNAL_FILE_PREFIX, time.Now().UTC().Format(FILE_TIME_FORMAT), JOURNAL_FILE_EXTENSION))
+	renameErr := os.Rename(j.CurrentFile(), rotated)
+
+	// Always reopen the current file so that recording can continue, even if the rename failed.
+	if err := j.open(); err != nil {
+		return err
+	} else if renameErr != nil {
+		return renameErr
+	}
+	glog.V(3).Infof(ejLogString(fmt.Sprintf("rotated event journal file to %v", rotated)))
+
+	if j.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := RotatedFiles(j.dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > j.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		glog.V(3).Infof(ejLogString(fmt.Sprintf("deleted event journal file %v", files[0])))
+		files = files[1:]
+	}
+	return nil
+}
+
+// Write the queued records and close the current journal file. Records passed to the journal after it is closed are
+// dropped.
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	if j.closed {
+		j.lock.Unlock()
+		return nil
+	}
+	j.closed = true
+	close(j.queue)
+	j.lock.Unlock()
+
+	<-j.written
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Return the rotated journal files in the directory, oldest first.
+func RotatedFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := JOURNAL_FILE_PREFIX + "-"
+	suffix := "." + JOURNAL_FILE_EXTENSION
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) && strings.HasSuffix(entry.Name(), suffix) {
+			files = append(files, path.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Read the journal records from a reader, in the order they were written.
+func ReadJournal(r io.Reader) ([]JournalRecord, error) {
+	records := make([]JournalRecord, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MAX_RECORD_SIZE)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to unmarshal journal record on line %v, error: %v", line, err))
+		}
+		records = append(records, rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read journal, error: %v", err))
+	}
+	return records, nil
+}
+
+// Read the journal records from a file.
+func ReadJournalFile(fileName string) ([]JournalRecord, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to open event journal file %v, error: %v", fileName, err))
+	}
+	defer f.Close()
+
+	records, err := ReadJournal(f)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to read event journal file %v, error: %v", fileName, err))
+	}
+	return records, nil
+}
+
+// Read all the journal records in a journal directory, from the oldest rotated file to the current file.
+func ReadJournalDir(dir string) ([]JournalRecord, error) {
+	files, err := RotatedFiles(dir)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to list event journal directory %v, error: %v", dir, err))
+	}
+
+	current := path.Join(dir, JOURNAL_FILE_PREFIX+"."+JOURNAL_FILE_EXTENSION)
+	if _, err := os.Stat(current); err == nil {
+		files = append(files, current)
+	}
+
+	records := make([]JournalRecord, 0)
+	for _, fileName := range files {
+		recs, err := ReadJournalFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recs...)
+	}
+	return records, nil
+}
+
+var ejLogString = func(v interface{}) string {
+	return fmt.Sprintf("Event Journal: %v", v)
+}
@@ -0,0 +1,212 @@
+// +build unit
+
+package eventjournal
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/events"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A type held in the interface field of a message, like the exchange changes passed between the agbot workers.
+type testChange struct {
+	Id       uint64
+	Resource string
+	When     time.Time
+	Counts   map[int]float64
+}
+
+func Test_codec_round_trip(t *testing.T) {
+	RegisterType(testChange{})
+
+	env := map[string]string{"HZN_VAR": "value"}
+	lc := &events.AgreementLaunchContext{
+		AgreementProtocol:    "Basic",
+		AgreementId:          "ag1",
+		Configure:            events.ContainerConfig{Deployment: "{}", ImageDockerAuths: []events.ImageDockerAuth{{Registry: "reg", UserName: "user"}}},
+		EnvironmentAdditions: &env,
+	}
+
+	change := events.NewExchangeChangeMessage(events.CHANGE_AGBOT_POLICY)
+	change.SetChange(testChange{Id: 7, Resource: "policy", When: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), Counts: map[int]float64{1: 0.5, 2: math.Inf(1)}})
+
+	msgs := []events.Message{
+		events.NewImageFetchMessage(events.IMAGE_FETCHED, &containermessage.DeploymentDescription{Services: map[string]*containermessage.Service{"svc": {Image: "img"}}}, lc, nil),
+		events.NewImageFetchMessage(events.IMAGE_FETCH_ERROR, nil, nil, errors.New("no such image")),
+		events.NewContainerMessage(events.EXECUTION_BEGUN, events.ContainerLaunchContext{Name: "ms1", AgreementIds: []string{"ag1"}}, "svc", "8080"),
+		*events.NewContainerMessage(events.EXECUTION_FAILED, events.ContainerLaunchContext{Name: "ms2"}, "svc", ""),
+		events.NewNodeShutdownMessage(events.START_UNCONFIGURE, true, false),
+		events.NewEdgeRegisteredExchangeMessage(events.NEW_DEVICE_REG, "node1", "", "myorg", "mypattern", "device"),
+		change,
+	}
+
+	for _, msg := range msgs {
+		key, raw, err := EncodeMessage(msg)
+		if err != nil {
+			t.Fatalf("unable to encode %v, error: %v", msg, err)
+		}
+
+		decoded, err := DecodeMessage(key, raw)
+		if err != nil {
+			t.Fatalf("unable to decode %v from %v, error: %v", key, string(raw), err)
+		}
+
+		// The unexported event id must survive the round trip.
+		if decoded.Event().Id != msg.Event().Id {
+			t.Errorf("expected event id %v, got %v", msg.Event().Id, decoded.Event().Id)
+		}
+
+		// Errors are decoded as new errors with the same text, so they are compared separately.
+		if ifm, ok := msg.(*events.ImageFetchMessage); ok && ifm.Error != nil {
+			dfm := decoded.(*events.ImageFetchMessage)
+			if dfm.Error == nil || dfm.Error.Error() != ifm.Error.Error() {
+				t.Errorf("expected error %v, got %v", ifm.Error, dfm.Error)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(msg, decoded) {
+			t.Errorf("expected %v, got %v", msg, decoded)
+		}
+	}
+}
+
+// Secrets and unexported fields are not recorded, and messages without a journal form are not recorded at all.
+func Test_codec_redaction(t *testing.T) {
+	secrets := []string{"nodetoken", "registrypassword", "rawconfig", "protocolbody", "exchangebody"}
+
+	type hidden struct {
+		Visible string
+		hidden  string
+	}
+	RegisterType(hidden{})
+	change := events.NewExchangeChangeMessage(events.CHANGE_AGBOT_POLICY)
+	change.SetChange(hidden{Visible: "visible", hidden: "unexported"})
+
+	lc := &events.AgreementLaunchContext{
+		AgreementId:  "ag1",
+		Configure:    events.ContainerConfig{ImageDockerAuths: []events.ImageDockerAuth{{Registry: "reg", UserName: "user", Password: "registrypassword"}}},
+		ConfigureRaw: []byte("rawconfig"),
+	}
+
+	msgs := []events.Message{
+		events.NewEdgeRegisteredExchangeMessage(events.NEW_DEVICE_REG, "node1", "nodetoken", "myorg", "", "device"),
+		events.NewAgreementMessage(events.AGREEMENT_REACHED, lc),
+		events.NewImageFetchMessage(events.IMAGE_FETCHED, nil, lc, nil),
+		events.NewExchangeDeviceMessage(events.RECEIVED_EXCHANGE_DEV_MSG, "agbot1", []byte("exchangebody"), "protocolbody"),
+		change,
+	}
+	for _, msg := range msgs {
+		key, raw, err := EncodeMessage(msg)
+		if err != nil {
+			t.Fatalf("unable to encode %v, error: %v", msg, err)
+		}
+		for _, secret := range append(secrets, "unexported") {
+			if strings.Contains(string(raw), secret) || strings.Contains(string(raw), base64.StdEncoding.EncodeToString([]byte(secret))) {
+				t.Errorf("expected %v not to be recorded for %v, got %v", secret, key, string(raw))
+			}
+		}
+		if _, err := DecodeMessage(key, raw); err != nil {
+			t.Errorf("unable to decode %v from %v, error: %v", key, string(raw), err)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(summary(msg), secret) {
+				t.Errorf("expected %v not to be in the summary of %v, got %v", secret, key, summary(msg))
+			}
+		}
+	}
+
+	// The secrets in the message are still there.
+	if lc.Configure.ImageDockerAuths[0].Password != "registrypassword" || string(lc.ConfigureRaw) != "rawconfig" {
+		t.Errorf("expected the launch context not to be changed, got %v", lc)
+	}
+
+	if key, raw, err := EncodeMessage(events.NewAllBlockchainShutdownMessage(events.ALL_STOP)); err != nil || IsEncoded(raw) || key == "" {
+		t.Errorf("expected a message without a journal form not to be encoded, got %v %v %v", key, string(raw), err)
+	} else if _, err := DecodeMessage(key, raw); err == nil {
+		t.Errorf("expected an error decoding a message that was not recorded")
+	}
+}
+
+func Test_codec_unregistered_type(t *testing.T) {
+	if _, err := DecodeMessage("example.com/none.Message", []byte(`{"$type":"example.com/none.Form","$value":{}}`)); err == nil {
+		t.Errorf("expected an error decoding an unregistered journal form")
+	}
+
+	// A message holding a value of a type that is not registered cannot be decoded.
+	raw := []byte(`{"$type":"github.com/open-horizon/anax/events.exchangeChangeForm","$value":{"Id":"x","Change":{"$type":"example.com/none.Change","$value":{}}}}`)
+	if _, err := DecodeMessage("*github.com/open-horizon/anax/events.ExchangeChangeMessage", raw); err == nil {
+		t.Errorf("expected an error decoding an unregistered interface value")
+	}
+}
+
+func Test_journal_record_and_rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventjournal")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each record is a few hundred bytes, so the journal is rotated after every few records.
+	j, err := NewJournal(&config.EventJournalConfig{Path: dir, MaxFileSizeKB: 1, MaxFiles: 2})
+	if err != nil {
+		t.Fatalf("unable to create journal, error: %v", err)
+	}
+
+	for i := 0; i < 40; i++ {
+		j.Record("Agreement", []string{"Container", "Governance"}, events.NewWorkerStopMessage(events.WORKER_STOP, "worker"))
+		// Rotated file names include the time, make sure they are unique.
+		time.Sleep(time.Millisecond)
+	}
+	if err := j.Close(); err != nil {
+		t.Errorf("unable to close journal, error: %v", err)
+	}
+
+	// Records after the journal is closed are dropped.
+	j.Record("Agreement", []string{}, events.NewWorkerStopMessage(events.WORKER_STOP, "worker"))
+
+	files, err := RotatedFiles(dir)
+	if err != nil {
+		t.Fatalf("unable to list rotated files, error: %v", err)
+	} else if len(files) != 2 {
+		t.Errorf("expected 2 rotated files, got %v", files)
+	}
+
+	records, err := ReadJournalDir(dir)
+	if err != nil {
+		t.Fatalf("unable to read journal, error: %v", err)
+	} else if len(records) == 0 || len(records) >= 40 {
+		t.Fatalf("expected the oldest records to be deleted, got %v records", len(records))
+	}
+
+	for ix, rec := range records {
+		if rec.Sequence != records[0].Sequence+uint64(ix) {
+			t.Errorf("expected records in sequence, got %v at %v", rec.Sequence, ix)
+		} else if rec.Source != "Agreement" || !reflect.DeepEqual(rec.Destinations, []string{"Container", "Governance"}) || rec.EventId != events.WORKER_STOP {
+			t.Errorf("unexpected record %v", rec)
+		}
+	}
+
+	if last := records[len(records)-1]; last.Sequence != 40 {
+		t.Errorf("expected the last record to be 40, got %v", last.Sequence)
+	} else if msg, err := last.Decode(); err != nil {
+		t.Errorf("unable to decode record, error: %v", err)
+	} else if wsm, ok := msg.(*events.WorkerStopMessage); !ok || wsm.Name() != "worker" {
+		t.Errorf("unexpected message %v", msg)
+	}
+}
+
+func Test_ReadJournal_invalid(t *testing.T) {
+	if _, err := ReadJournal(strings.NewReader("{\"sequence\":1}\n\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+}
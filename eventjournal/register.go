@@ -0,0 +1,18 @@
+package eventjournal
+
+import (
+	"github.com/open-horizon/anax/events"
+)
+
+// Register the journal forms of the messages defined in the events package, and the types held in the interface fields
+// of those forms, so that a journal can be decoded by a process that did not write it. Types defined in packages that
+// depend on the worker package, such as the exchange package, are registered by those packages.
+func init() {
+	for _, form := range events.JournalForms() {
+		RegisterType(form)
+	}
+	RegisterType(
+		&events.AgreementLaunchContext{},
+		&events.ContainerLaunchContext{},
+	)
+}
@@ -0,0 +1,46 @@
+package eventlog
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/persistence"
+	"time"
+)
+
+// Convert the configured event log retention policy into prune criteria.
+func GetPruneCriteria(retention *config.EventLogRetentionConfig) persistence.EventLogPruneCriteria {
+	criteria := persistence.EventLogPruneCriteria{
+		MaxAgeS:  uint64(retention.MaxAgeH) * 3600,
+		MaxCount: retention.MaxCount,
+	}
+	if len(retention.SeverityMaxAgeH) != 0 {
+		criteria.SeverityMaxAgeS = make(map[string]uint64)
+		for severity, age := range retention.SeverityMaxAgeH {
+			criteria.SeverityMaxAgeS[severity] = uint64(age) * 3600
+		}
+	}
+	return criteria
+}
+
+// Prune the event log records that match the criteria. If any records were pruned, a summary record describing
+// them is added to the event log.
+func PruneEventLogs(db *bolt.DB, criteria persistence.EventLogPruneCriteria) (*persistence.EventLogPruneSummary, error) {
+
+	summary, err := persistence.PruneEventLogs(db, criteria, uint64(time.Now().Unix()))
+	if err != nil {
+		return nil, err
+	}
+
+	glog.V(3).Infof("Pruned event logs with criteria %v: %v", criteria, summary)
+
+	if summary.Pruned != 0 {
+		LogDatabaseEvent(db, persistence.SEVERITY_INFO,
+			persistence.NewMessageMeta(EL_EVENTLOG_PRUNED, summary.Pruned,
+				time.Unix(int64(summary.OldestTimestamp), 0).String(), time.Unix(int64(summary.NewestTimestamp), 0).String(),
+				summary.BySeverity, summary.BySourceType, summary.Remaining),
+			persistence.EC_EVENTLOG_PRUNED)
+	}
+
+	return summary, nil
+}
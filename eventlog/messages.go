@@ -0,0 +1,21 @@
+package eventlog
+
+import (
+	"github.com/open-horizon/anax/i18n"
+)
+
+// messages for event logs
+const (
+	EL_EVENTLOG_PRUNED = "Pruned %v event log records created between %v and %v. Pruned by severity: %v. Pruned by source type: %v. %v records remain."
+)
+
+// This is does nothing useful at run time.
+// This code is only used in compileing time to make the eventlog messages gets into the catalog so that
+// they can be translated.
+// The event log messages will be saved in English. But the CLI can request them in different languages.
+func MarkI18nMessages() {
+	// get message printer. anax default language is English
+	msgPrinter := i18n.GetMessagePrinter()
+
+	msgPrinter.Sprintf(EL_EVENTLOG_PRUNED)
+}
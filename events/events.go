@@ -67,8 +67,10 @@ const (
 
 	// exchange-related
 	NEW_DEVICE_REG             EventId = "NEW_DEVICE_REG"
+	DEVICE_REREGISTERED        EventId = "DEVICE_REREGISTERED"
 	NEW_DEVICE_CONFIG_COMPLETE EventId = "NEW_DEVICE_CONFIG_COMPLETE"
 	NEW_AGBOT_REG              EventId = "NEW_AGBOT_REG"
+	MESSAGE_KEY_ROTATE         EventId = "MESSAGE_KEY_ROTATE"
 
 	// agreement-related
 	AGREEMENT_REACHED        EventId = "AGREEMENT_REACHED"
@@ -89,6 +91,7 @@ const (
 	NODE_PATTERN_CHANGE_SHUTDOWN EventId = "NODE_PATTERN_CHANGE_SHUTDOWN"
 	NODE_PATTERN_CHANGE_REREG    EventId = "NODE_PATTERN_CHANGE_REREG"
 	MESSAGE_STOP                 EventId = "MESSAGE_STOP"
+	NODE_STATE_RESTORED          EventId = "NODE_STATE_RESTORED"
 
 	// Service related
 	SERVICE_SUSPENDED EventId = "SERVICE_SUSPENDED"
@@ -114,6 +117,9 @@ const (
 	CHANGE_AGBOT_PATTERN          EventId = "EXCHANGE_CHANGE_AGBOT_PATTERN"
 	CHANGE_AGBOT_POLICY           EventId = "EXCHANGE_CHANGE_AGBOT_POLICY"
 	CHANGE_AGBOT_AGREEMENT_TYPE   EventId = "EXCHANGE_CHANGE_AGBOT_AGREEMENT"
+
+	// Configuration related
+	CONFIG_RELOADED EventId = "CONFIG_RELOADED"
 )
 
 type EndContractCause string
@@ -1835,6 +1841,36 @@ func NewNodeHeartbeatStateChangeMessage(id EventId, node_org string, node_id str
 	}
 }
 
+// This event is sent when the node's local state has been replaced by a backup, so that the workers can reconcile
+// the running containers with the restored agreements.
+type NodeStateRestoredMessage struct {
+	event   Event
+	NodeOrg string
+	NodeId  string
+}
+
+func (w *NodeStateRestoredMessage) Event() Event {
+	return w.event
+}
+
+func (w *NodeStateRestoredMessage) String() string {
+	return w.ShortString()
+}
+
+func (w *NodeStateRestoredMessage) ShortString() string {
+	return fmt.Sprintf("Event: %v, NodeOrg: %v, NodeId: %v", w.event, w.NodeOrg, w.NodeId)
+}
+
+func NewNodeStateRestoredMessage(id EventId, node_org string, node_id string) *NodeStateRestoredMessage {
+	return &NodeStateRestoredMessage{
+		event: Event{
+			Id: id,
+		},
+		NodeOrg: node_org,
+		NodeId:  node_id,
+	}
+}
+
 type ServiceConfigState struct {
 	Url         string `json:"url"`
 	Org         string `json:"org"`
@@ -1990,6 +2026,70 @@ func NewProposalAcceptedMessage(id EventId) *ProposalAcceptedMessage {
 	}
 }
 
+// Sent to ask the worker that publishes the agreement protocol message key to rotate it now, instead of waiting for the
+// next scheduled rotation.
+type MessageKeyRotateMessage struct {
+	event Event
+}
+
+func (w *MessageKeyRotateMessage) Event() Event {
+	return w.event
+}
+
+func (w *MessageKeyRotateMessage) String() string {
+	return w.ShortString()
+}
+
+func (w *MessageKeyRotateMessage) ShortString() string {
+	return fmt.Sprintf("Event: %v", w.event)
+}
+
+func NewMessageKeyRotateMessage(id EventId) *MessageKeyRotateMessage {
+	return &MessageKeyRotateMessage{
+		event: Event{
+			Id: id,
+		},
+	}
+}
+
+// Sent when the configuration is reloaded and some of the reloadable fields have changed. The new values are already in
+// the configuration, workers that keep their own copy of a changed field should read it again.
+type ConfigReloadedMessage struct {
+	event  Event
+	Fields []string // The paths of the changed fields, for example Edge.SurfaceErrorTimeoutS.
+}
+
+func (w *ConfigReloadedMessage) Event() Event {
+	return w.event
+}
+
+func (w *ConfigReloadedMessage) String() string {
+	return w.ShortString()
+}
+
+func (w *ConfigReloadedMessage) ShortString() string {
+	return fmt.Sprintf("Event: %v, Fields: %v", w.event, w.Fields)
+}
+
+// Returns true if the field was changed.
+func (w *ConfigReloadedMessage) HasField(field string) bool {
+	for _, f := range w.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func NewConfigReloadedMessage(id EventId, fields []string) *ConfigReloadedMessage {
+	return &ConfigReloadedMessage{
+		event: Event{
+			Id: id,
+		},
+		Fields: fields,
+	}
+}
+
 func GetLaunchContext(launchContext interface{}) LaunchContext {
 	switch launchContext.(type) {
 	case *ContainerLaunchContext:
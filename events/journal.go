@@ -0,0 +1,236 @@
+package events
+
+import (
+	"github.com/open-horizon/anax/containermessage"
+	"github.com/open-horizon/anax/persistence"
+)
+
+// The event journal records the messages passed between the workers. The state of a message is only recorded when its
+// type implements JournalMessage. The journal form of a message has exported fields only, and leaves out the secrets
+// held by the message, such as the exchange token of the node, the passwords of image registries and the bodies of
+// agreement protocol messages. A replayed message does not have those secrets.
+type JournalMessage interface {
+	Message
+	JournalForm() JournalForm
+}
+
+// The recorded form of a message, which builds the message again when a journal is replayed.
+type JournalForm interface {
+	JournalMessage() Message
+}
+
+// Returns an empty value of each journal form, so that a journal can be decoded by a process that did not record it.
+func JournalForms() []JournalForm {
+	return []JournalForm{
+		edgeRegisteredForm{},
+		agreementReachedForm{},
+		imageFetchForm{},
+		governanceCancelationForm{},
+		containerForm{},
+		exchangeDeviceForm{},
+		nodeShutdownForm{},
+		nodeShutdownCompleteForm{},
+		workerStopForm{},
+		exchangeChangeForm{},
+		proposalAcceptedForm{},
+	}
+}
+
+// Returns a copy of the config without the passwords of the image registries.
+func (c ContainerConfig) redacted() ContainerConfig {
+	if c.ImageDockerAuths != nil {
+		auths := make([]ImageDockerAuth, len(c.ImageDockerAuths))
+		for ix, auth := range c.ImageDockerAuths {
+			auths[ix] = ImageDockerAuth{Registry: auth.Registry, UserName: auth.UserName}
+		}
+		c.ImageDockerAuths = auths
+	}
+	return c
+}
+
+// Returns a copy of the launch context without secrets. The raw configuration holds the registry passwords too.
+func (c *AgreementLaunchContext) redacted() *AgreementLaunchContext {
+	if c == nil {
+		return nil
+	}
+	r := *c
+	r.Configure = c.Configure.redacted()
+	r.ConfigureRaw = nil
+	return &r
+}
+
+// Returns a copy of the launch context without secrets.
+func (c ContainerLaunchContext) redacted() ContainerLaunchContext {
+	c.Configure = c.Configure.redacted()
+	return c
+}
+
+// The token is left out.
+type edgeRegisteredForm struct {
+	Id         EventId
+	DeviceId   string
+	Org        string
+	Pattern    string
+	DeviceType string
+}
+
+func (f edgeRegisteredForm) JournalMessage() Message {
+	return NewEdgeRegisteredExchangeMessage(f.Id, f.DeviceId, "", f.Org, f.Pattern, f.DeviceType)
+}
+
+func (e *EdgeRegisteredExchangeMessage) JournalForm() JournalForm {
+	return edgeRegisteredForm{Id: e.event.Id, DeviceId: e.device_id, Org: e.org, Pattern: e.pattern, DeviceType: e.deviceType}
+}
+
+type agreementReachedForm struct {
+	Id            EventId
+	LaunchContext *AgreementLaunchContext
+}
+
+func (f agreementReachedForm) JournalMessage() Message {
+	return NewAgreementMessage(f.Id, f.LaunchContext)
+}
+
+func (e *AgreementReachedMessage) JournalForm() JournalForm {
+	return agreementReachedForm{Id: e.event.Id, LaunchContext: e.launchContext.redacted()}
+}
+
+type imageFetchForm struct {
+	Id                    EventId
+	DeploymentDescription *containermessage.DeploymentDescription
+	LaunchContext         interface{}
+	Error                 error
+}
+
+func (f imageFetchForm) JournalMessage() Message {
+	return NewImageFetchMessage(f.Id, f.DeploymentDescription, f.LaunchContext, f.Error)
+}
+
+func (e *ImageFetchMessage) JournalForm() JournalForm {
+	lc := e.LaunchContext
+	switch c := lc.(type) {
+	case *AgreementLaunchContext:
+		lc = c.redacted()
+	case *ContainerLaunchContext:
+		if c != nil {
+			r := c.redacted()
+			lc = &r
+		}
+	}
+	return imageFetchForm{Id: e.event.Id, DeploymentDescription: e.DeploymentDescription, LaunchContext: lc, Error: e.Error}
+}
+
+type governanceCancelationForm struct {
+	Id                EventId
+	Cause             EndContractCause
+	AgreementProtocol string
+	AgreementId       string
+	Deployment        persistence.DeploymentConfig
+}
+
+func (f governanceCancelationForm) JournalMessage() Message {
+	return NewGovernanceWorkloadCancelationMessage(f.Id, f.Cause, f.AgreementProtocol, f.AgreementId, f.Deployment)
+}
+
+func (m *GovernanceWorkloadCancelationMessage) JournalForm() JournalForm {
+	return governanceCancelationForm{Id: m.event.Id, Cause: m.Cause, AgreementProtocol: m.AgreementProtocol, AgreementId: m.AgreementId, Deployment: m.Deployment}
+}
+
+type containerForm struct {
+	Id            EventId
+	LaunchContext ContainerLaunchContext
+	ServiceName   string
+	ServicePort   string
+}
+
+func (f containerForm) JournalMessage() Message {
+	return NewContainerMessage(f.Id, f.LaunchContext, f.ServiceName, f.ServicePort)
+}
+
+func (m ContainerMessage) JournalForm() JournalForm {
+	return containerForm{Id: m.event.Id, LaunchContext: m.LaunchContext.redacted(), ServiceName: m.ServiceName, ServicePort: m.ServicePort}
+}
+
+// The exchange message and the protocol message it carries are left out.
+type exchangeDeviceForm struct {
+	Id      EventId
+	AgbotId string
+	Time    uint64
+}
+
+func (f exchangeDeviceForm) JournalMessage() Message {
+	m := NewExchangeDeviceMessage(f.Id, f.AgbotId, nil, "")
+	m.Time = f.Time
+	return m
+}
+
+func (m *ExchangeDeviceMessage) JournalForm() JournalForm {
+	return exchangeDeviceForm{Id: m.event.Id, AgbotId: m.agbotId, Time: m.Time}
+}
+
+type nodeShutdownForm struct {
+	Id         EventId
+	Blocking   bool
+	RemoveNode bool
+}
+
+func (f nodeShutdownForm) JournalMessage() Message {
+	return NewNodeShutdownMessage(f.Id, f.Blocking, f.RemoveNode)
+}
+
+func (e *NodeShutdownMessage) JournalForm() JournalForm {
+	return nodeShutdownForm{Id: e.event.Id, Blocking: e.block, RemoveNode: e.removeNode}
+}
+
+type nodeShutdownCompleteForm struct {
+	Id  EventId
+	Err string
+}
+
+func (f nodeShutdownCompleteForm) JournalMessage() Message {
+	return NewNodeShutdownCompleteMessage(f.Id, f.Err)
+}
+
+func (e *NodeShutdownCompleteMessage) JournalForm() JournalForm {
+	return nodeShutdownCompleteForm{Id: e.event.Id, Err: e.err}
+}
+
+type workerStopForm struct {
+	Id   EventId
+	Name string
+}
+
+func (f workerStopForm) JournalMessage() Message {
+	return NewWorkerStopMessage(f.Id, f.Name)
+}
+
+func (w *WorkerStopMessage) JournalForm() JournalForm {
+	return workerStopForm{Id: w.event.Id, Name: w.name}
+}
+
+type exchangeChangeForm struct {
+	Id     EventId
+	Change interface{}
+}
+
+func (f exchangeChangeForm) JournalMessage() Message {
+	m := NewExchangeChangeMessage(f.Id)
+	m.SetChange(f.Change)
+	return m
+}
+
+func (w *ExchangeChangeMessage) JournalForm() JournalForm {
+	return exchangeChangeForm{Id: w.event.Id, Change: w.change}
+}
+
+type proposalAcceptedForm struct {
+	Id EventId
+}
+
+func (f proposalAcceptedForm) JournalMessage() Message {
+	return NewProposalAcceptedMessage(f.Id)
+}
+
+func (w *ProposalAcceptedMessage) JournalForm() JournalForm {
+	return proposalAcceptedForm{Id: w.event.Id}
+}
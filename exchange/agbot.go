@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
-	"time"
 )
 
 type Agbot struct {
@@ -140,13 +139,14 @@ func GetAgbotDeploymentPols(ec ExchangeContext) (map[string]ServedBusinessPolicy
 	var resp interface{}
 	resp = new(GetAgbotsBusinessPolsResponse)
 	targetURL := ec.GetExchangeURL() + "orgs/" + GetOrg(ec.GetExchangeId()) + "/agbots/" + GetId(ec.GetExchangeId()) + "/businesspols"
+	retry := NewRetryPolicy(0, 10)
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(rpclogString(err.Error()))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(tpErr.Error()))
-			time.Sleep(10 * time.Second)
+			retry.Backoff(tpErr)
 			continue
 		} else {
 			pols := resp.(*GetAgbotsBusinessPolsResponse).BusinessPols
@@ -161,13 +161,14 @@ func GetAgbotPatterns(ec ExchangeContext) (map[string]ServedPattern, error) {
 	var resp interface{}
 	resp = new(GetAgbotsPatternsResponse)
 	targetURL := ec.GetExchangeURL() + "orgs/" + GetOrg(ec.GetExchangeId()) + "/agbots/" + GetId(ec.GetExchangeId()) + "/patterns"
+	retry := NewRetryPolicy(0, 10)
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(rpclogString(err.Error()))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(tpErr.Error()))
-			time.Sleep(10 * time.Second)
+			retry.Backoff(tpErr)
 			continue
 		} else {
 			pats := resp.(*GetAgbotsPatternsResponse).Patterns
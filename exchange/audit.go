@@ -0,0 +1,69 @@
+package exchange
+
+import (
+	"github.com/open-horizon/anax/auditlog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The audit log that records the changes made in the exchange, or nil if the changes are not audited.
+var auditLog *auditlog.AuditLog
+var auditLock sync.Mutex
+
+// The exchange APIs that are called with POST but do not change anything, by the last segment of their path.
+var readOnlyPosts = []string{"changes", "search", "nodehealth"}
+
+// Record the changes made in the exchange from now on. Pass nil to stop recording them.
+func SetAuditLog(a *auditlog.AuditLog) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	auditLog = a
+}
+
+// Returns the audit log, or nil if the changes made in the exchange are not audited.
+func GetAuditLog() *auditlog.AuditLog {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	return auditLog
+}
+
+// Returns true if a request with the method changes the resource at the path.
+func isMutatingRequest(method string, urlPath string) bool {
+	switch method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		last := path.Base(strings.TrimSuffix(urlPath, "/"))
+		for _, segment := range readOnlyPosts {
+			if last == segment {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Record a request sent to the exchange in the audit log, if it changes something.
+func auditExchangeRequest(method string, urlPath string, identity string, body []byte, httpResp *http.Response, err error) {
+	a := GetAuditLog()
+	if a == nil || !isMutatingRequest(method, urlPath) {
+		return
+	}
+
+	rec := auditlog.AuditRecord{
+		Method:     method,
+		Path:       urlPath,
+		Identity:   identity,
+		BodyDigest: auditlog.DigestBody(body),
+	}
+	if httpResp != nil {
+		rec.Code = httpResp.StatusCode
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	a.Record(rec)
+}
@@ -0,0 +1,91 @@
+// +build unit
+
+package exchange
+
+import (
+	"encoding/json"
+	"github.com/open-horizon/anax/auditlog"
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// Verify that the changes made in the exchange are audited, and that the reads are not.
+func Test_AuditExchangeRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exchangeaudit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.AuditLogConfig{Path: dir}.WithDefaults()
+	a, err := auditlog.NewAuditLog(&cfg)
+	if err != nil {
+		t.Fatalf("unable to create audit log, error: %v", err)
+	}
+	defer a.Close()
+	SetAuditLog(a)
+	defer SetAuditLog(nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+		} else if r.Method == http.MethodGet {
+			w.Write([]byte(`{}`))
+		} else {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"code":"ok","msg":""}`))
+		}
+	}))
+	defer server.Close()
+
+	var resp interface{}
+	resp = new(PutDeviceResponse)
+	pdr := PutDeviceRequest{Token: "secret", Name: "n1"}
+	InvokeExchange(server.Client(), "PUT", server.URL+"/v1/orgs/myorg/nodes/n1", "myorg/n1", "secret", &pdr, &resp)
+	InvokeExchange(server.Client(), "GET", server.URL+"/v1/orgs/myorg/nodes/n1", "myorg/n1", "secret", nil, &resp)
+	InvokeExchange(server.Client(), "POST", server.URL+"/v1/orgs/myorg/changes", "myorg/n1", "secret", &GetExchangeChangesRequest{}, &resp)
+	InvokeExchange(server.Client(), "DELETE", server.URL+"/v1/orgs/myorg/nodes/n1/agreements/ag1", "myorg/n1", "secret", nil, &resp)
+
+	recs, err := a.Query(&auditlog.AuditFilter{})
+	if err != nil {
+		t.Fatalf("unable to query audit log, error: %v", err)
+	} else if len(recs) != 2 {
+		t.Fatalf("expected the PUT and the DELETE to be audited, got %v", recs)
+	}
+
+	other := PutDeviceRequest{Token: "other", Name: "n1"}
+	if put := recs[0]; put.Method != "PUT" || put.Path != "/v1/orgs/myorg/nodes/n1" || put.Identity != "myorg/n1" || put.Code != http.StatusCreated {
+		t.Errorf("wrong record %v", put)
+	} else if b, _ := json.Marshal(other); put.BodyDigest != auditlog.DigestBody(b) {
+		t.Errorf("the digest of the body %v does not ignore the token", put.BodyDigest)
+	} else if del := recs[1]; del.Method != "DELETE" || del.Code != http.StatusNotFound || del.BodyDigest != "" {
+		t.Errorf("wrong record %v", del)
+	}
+}
+
+func Test_isMutatingRequest(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		mutating bool
+	}{
+		{"PUT", "/v1/orgs/myorg/nodes/n1", true},
+		{"GET", "/v1/orgs/myorg/nodes/n1", false},
+		{"POST", "/v1/orgs/myorg/nodes/n1/heartbeat", true},
+		{"POST", "/v1/orgs/myorg/changes", false},
+		{"POST", "/v1/orgs/myorg/business/policies/p1/search", false},
+		{"POST", "/v1/orgs/myorg/search/nodehealth", false},
+		{"POST", "/v1/orgs/myorg/patterns/p1/nodehealth", false},
+		{"POST", "/v1/orgs/myorg/patterns/p1/search/", false},
+		{"POST", "/v1/orgs/myorg/nodes/n1/researchers", true},
+	}
+	for _, test := range tests {
+		if m := isMutatingRequest(test.method, test.path); m != test.mutating {
+			t.Errorf("%v %v should be mutating %v, got %v", test.method, test.path, test.mutating, m)
+		}
+	}
+}
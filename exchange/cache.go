@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cache"
+	"github.com/open-horizon/anax/config"
 	"golang.org/x/crypto/sha3"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +19,10 @@ import (
 type ResourceCache struct {
 	allResources map[string]cache.Cache
 	Lock         sync.Mutex
+
+	// The statistics of each resource type, kept when the cache of the type is deleted.
+	stats map[string]*CacheStats
+	dirty bool // A resource type that is saved to disk has changed since it was last saved.
 }
 
 // The top-level cache
@@ -30,8 +36,9 @@ const SVC_DOCKAUTH_TYPE_CACHE = "SVC_DOCKAUTH_CACHE"
 const NODE_DEF_TYPE_CACHE = "NODE_DEF_CACHE"
 const NODE_POL_TYPE_CACHE = "NODE_POLICY_CACHE"
 const EXCH_VERS_TYPE_CACHE = "EXCH_VERS_CACHE"
+const EXCH_CAPS_TYPE_CACHE = "EXCH_CAPS_CACHE"
 
-// This only applies to the exchange version.
+// This only applies to the exchange version and capabilities.
 // All others are monitored for changes theough the changes api
 const CACHE_TIMEOUT_S = 900
 
@@ -39,6 +46,58 @@ type CacheEntry struct {
 	Resource    interface{} `json:"resource"`
 	LastUpdated uint64      `json:"lastupdated"`
 	Hash        []byte      `json:"hash"`
+
+	// Set on an entry loaded from disk. A change made while the agent was down is not seen through the changes API,
+	// so a loaded entry is not used once it is older than this, until it is updated from the exchange.
+	loadedMaxAgeS uint64
+}
+
+// The statistics of the cache of one resource type, as shown in the status API.
+type CacheStats struct {
+	Type       string `json:"type"`
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries,omitempty"` // Not set when the cache is not bounded.
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Evictions  uint64 `json:"evictions"`
+}
+
+func (c CacheStats) String() string {
+	return fmt.Sprintf("Type: %v, Entries: %v, MaxEntries: %v, Hits: %v, Misses: %v, Evictions: %v", c.Type, c.Entries, c.MaxEntries, c.Hits, c.Misses, c.Evictions)
+}
+
+// The configuration of the cache, which sets the most entries of each resource type.
+var cacheConfigLock sync.Mutex
+var cacheConfig config.ExchangeCacheConfig
+
+// Set the bounds of the cache of each resource type. The bounds apply to the caches of the resource types that are
+// created after this call, so it is called at startup.
+func SetCacheConfig(cfg config.ExchangeCacheConfig) {
+	cacheConfigLock.Lock()
+	defer cacheConfigLock.Unlock()
+	cacheConfig = cfg
+}
+
+// Returns the most entries that the cache of a resource type holds, 0 or less if it is not bounded.
+func cacheMaxEntries(resourceType string) int {
+	cacheConfigLock.Lock()
+	defer cacheConfigLock.Unlock()
+
+	switch resourceType {
+	case NODE_DEF_TYPE_CACHE:
+		return cacheConfig.NodeMaxEntries
+	case NODE_POL_TYPE_CACHE:
+		return cacheConfig.NodePolicyMaxEntries
+	case SVC_DEF_TYPE_CACHE:
+		return cacheConfig.ServiceMaxEntries
+	case SVC_POL_TYPE_CACHE:
+		return cacheConfig.ServicePolicyMaxEntries
+	case SVC_DOCKAUTH_TYPE_CACHE:
+		return cacheConfig.DockerAuthMaxEntries
+	case SVC_KEY_TYPE_CACHE:
+		return cacheConfig.KeyMaxEntries
+	}
+	return 0
 }
 
 // GetNodeFromCache returns the node definition from the exchange cache if it is present, or nil if it is not
@@ -112,6 +171,16 @@ func GetExchangeVersionFromCache(exchangeURL string) string {
 	return ""
 }
 
+// GetExchangeCapabilitiesFromCache returns the capabilities of the exchange from the exchange cache if they are present or nil otherwise
+func GetExchangeCapabilitiesFromCache(exchangeURL string) *ExchangeCapabilities {
+	caps := GetResourceFromCache(exchangeURL, EXCH_CAPS_TYPE_CACHE, CACHE_TIMEOUT_S)
+
+	if typedCaps, ok := caps.(*ExchangeCapabilities); ok {
+		return typedCaps
+	}
+	return nil
+}
+
 // GetResourceFromCache will return the requested resource from the specified type exchange cache or nil if it is not present
 func GetResourceFromCache(resourceKey string, resourceType string, expirationS uint64) interface{} {
 	glog.V(5).Infof("Get from exchange cache %s/%s", resourceType, resourceKey)
@@ -123,23 +192,36 @@ func GetResourceFromCache(resourceKey string, resourceType string, expirationS u
 	ExchangeResourceCache.Lock.Lock()
 	defer ExchangeResourceCache.Lock.Unlock()
 
+	stats := ExchangeResourceCache.getStats(resourceType)
+
 	resourceCache, ok := ExchangeResourceCache.allResources[resourceType]
 	if !ok {
+		stats.Misses++
 		return nil
 	}
 	entry := resourceCache.Get(resourceKey)
 	if entry == nil {
+		stats.Misses++
 		return nil
 	}
 	typedEntry, ok := entry.(CacheEntry)
 	if !ok {
 		glog.Errorf("Error: object returned from cache not of expected type.")
+		stats.Misses++
 		return nil
 	}
-	expired := uint64(time.Now().Unix())-typedEntry.LastUpdated > expirationS
-	if expirationS > 0 && expired {
+	age := uint64(time.Now().Unix()) - typedEntry.LastUpdated
+	if typedEntry.loadedMaxAgeS > 0 && age > typedEntry.loadedMaxAgeS {
+		glog.V(5).Infof("Expired loaded entry in exchange cache %s/%s", resourceType, resourceKey)
+		resourceCache.Delete(resourceKey)
+		stats.Misses++
 		return nil
 	}
+	if expirationS > 0 && age > expirationS {
+		stats.Misses++
+		return nil
+	}
+	stats.Hits++
 	return typedEntry.Resource
 }
 
@@ -155,11 +237,7 @@ func UpdateCache(resourceKey string, resourceType string, updatedResource interf
 	ExchangeResourceCache.Lock.Lock()
 	defer ExchangeResourceCache.Lock.Unlock()
 
-	resourceCache, ok := ExchangeResourceCache.allResources[resourceType]
-	if !ok {
-		ExchangeResourceCache.allResources[resourceType] = cache.NewSimpleMapCache()
-		resourceCache = ExchangeResourceCache.allResources[resourceType]
-	}
+	resourceCache := ExchangeResourceCache.getTypeCache(resourceType)
 	recordHash, err := hashResource(updatedResource)
 	if err != nil {
 		glog.Errorf("Failed to hash resource for cache. Error was : %v", err)
@@ -177,9 +255,11 @@ func UpdateCache(resourceKey string, resourceType string, updatedResource interf
 	if existingRecord == nil || !bytes.Equal(existingRecordTyped.Hash, recordHash) {
 		newRecord := CacheEntry{Resource: updatedResource, LastUpdated: uint64(time.Now().Unix()), Hash: recordHash}
 		resourceCache.Put(resourceKey, newRecord)
+		ExchangeResourceCache.changed(resourceType)
 		return
 	}
 	existingRecordTyped.LastUpdated = uint64(time.Now().Unix())
+	existingRecordTyped.loadedMaxAgeS = 0
 	resourceCache.Put(resourceKey, existingRecordTyped)
 }
 
@@ -196,6 +276,7 @@ func DeleteCache(resourceType string) {
 
 	if _, ok := ExchangeResourceCache.allResources[resourceType]; ok {
 		delete(ExchangeResourceCache.allResources, resourceType)
+		ExchangeResourceCache.changed(resourceType)
 	}
 }
 
@@ -217,6 +298,7 @@ func DeleteCacheResource(resourceType string, resourceKey string) interface{} {
 		retResource = resourceCache.Get(resourceKey)
 
 		resourceCache.Delete(resourceKey)
+		ExchangeResourceCache.changed(resourceType)
 	}
 	return retResource
 }
@@ -231,11 +313,12 @@ func DeleteOrgCachedResources(org string) {
 	ExchangeResourceCache.Lock.Lock()
 	defer ExchangeResourceCache.Lock.Unlock()
 
-	for _, cache := range ExchangeResourceCache.allResources {
+	for resourceType, cache := range ExchangeResourceCache.allResources {
 		orgResourceKeys := cache.GetKeys()
 		for _, orgResourceKey := range orgResourceKeys {
 			if strings.Index(orgResourceKey, fmt.Sprintf("%s/", org)) == 0 {
 				cache.Delete(orgResourceKey)
+				ExchangeResourceCache.changed(resourceType)
 			}
 		}
 	}
@@ -364,7 +447,67 @@ func NodeCacheMapKey(nodeOrg string, nodeId string) string {
 
 // NewResourceCache will create the top-level cache
 func NewResourceCache() ResourceCache {
-	return ResourceCache{allResources: map[string]cache.Cache{}, Lock: *new(sync.Mutex)}
+	return ResourceCache{allResources: map[string]cache.Cache{}, Lock: *new(sync.Mutex), stats: map[string]*CacheStats{}}
+}
+
+// Returns the cache of a resource type, creating it if there is none yet. The caller holds the lock.
+func (rc *ResourceCache) getTypeCache(resourceType string) cache.Cache {
+	resourceCache, ok := rc.allResources[resourceType]
+	if !ok {
+		// Entries are only evicted by UpdateCache, which holds the lock.
+		stats := rc.getStats(resourceType)
+		resourceCache = cache.NewLRUCache(cacheMaxEntries(resourceType), func(key string, obj interface{}) {
+			glog.V(5).Infof("Evicted %s/%s from exchange cache", resourceType, key)
+			stats.Evictions++
+		})
+		rc.allResources[resourceType] = resourceCache
+	}
+	return resourceCache
+}
+
+// Returns the statistics of a resource type. The caller holds the lock.
+func (rc *ResourceCache) getStats(resourceType string) *CacheStats {
+	if rc.stats == nil {
+		rc.stats = map[string]*CacheStats{}
+	}
+	stats, ok := rc.stats[resourceType]
+	if !ok {
+		stats = &CacheStats{Type: resourceType}
+		rc.stats[resourceType] = stats
+	}
+	return stats
+}
+
+// Records that a resource type changed, so that it is saved to disk if it is one of the stable types. The caller holds the lock.
+func (rc *ResourceCache) changed(resourceType string) {
+	if _, ok := persistentCacheTypes[resourceType]; ok {
+		rc.dirty = true
+	}
+}
+
+// GetCacheStats returns the statistics of each resource type that has been cached or looked up, sorted by type.
+func GetCacheStats() []CacheStats {
+	if ExchangeResourceCache == nil {
+		return nil
+	}
+
+	ExchangeResourceCache.Lock.Lock()
+	defer ExchangeResourceCache.Lock.Unlock()
+
+	allStats := make([]CacheStats, 0, len(ExchangeResourceCache.stats))
+	for resourceType, stats := range ExchangeResourceCache.stats {
+		s := *stats
+		s.Entries = 0
+		if resourceCache, ok := ExchangeResourceCache.allResources[resourceType]; ok {
+			s.Entries = len(resourceCache.GetKeys())
+		}
+		if max := cacheMaxEntries(resourceType); max > 0 {
+			s.MaxEntries = max
+		}
+		allStats = append(allStats, s)
+	}
+	sort.Slice(allStats, func(i, j int) bool { return allStats[i].Type < allStats[j].Type })
+	return allStats
 }
 
 // Hash the given resource for comparing
@@ -384,5 +527,6 @@ func ClearAllResourceCache() {
 		defer ExchangeResourceCache.Lock.Unlock()
 
 		ExchangeResourceCache.allResources = map[string]cache.Cache{}
+		ExchangeResourceCache.dirty = true
 	}
 }
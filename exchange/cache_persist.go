@@ -0,0 +1,216 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The stable resource types of the exchange cache are saved to disk, so that a restarted agent does not fetch all of
+// them from the exchange at once. A service definition or signing key rarely changes once it is published, and a
+// change is seen through the changes API like for any cached resource. The function returns a pointer to a new value
+// of the type that the resource is cached as, to decode a saved entry into.
+var persistentCacheTypes = map[string]func() interface{}{
+	SVC_DEF_TYPE_CACHE: func() interface{} { return new(map[string]ServiceDefinition) },
+	SVC_KEY_TYPE_CACHE: func() interface{} { return new(map[string]string) },
+}
+
+// A cache entry as it is read from disk, the resource is decoded once its type is known.
+type savedCacheEntry struct {
+	Resource    json.RawMessage `json:"resource"`
+	LastUpdated uint64          `json:"lastupdated"`
+}
+
+// The cache persister loads the stable resource types of the exchange cache when the agent starts, and saves them
+// periodically when they have changed, and when it is stopped.
+type CachePersister struct {
+	cfg      *config.ExchangeCacheConfig
+	stop     chan bool
+	done     chan bool
+	stopOnce sync.Once
+}
+
+// Load the saved cache entries and start saving them periodically. Returns nil if the entries are not saved.
+func StartCachePersistence(cfg *config.ExchangeCacheConfig) *CachePersister {
+	if !cfg.IsPersistEnabled() {
+		return nil
+	}
+
+	if loaded, err := LoadCache(cfg.PersistFile, uint64(cfg.PersistMaxAgeS)); err != nil {
+		glog.Errorf(cacheLogString(fmt.Sprintf("unable to load the saved exchange cache, error: %v", err)))
+	} else {
+		glog.V(3).Infof(cacheLogString(fmt.Sprintf("loaded %v entries from %v", loaded, cfg.PersistFile)))
+	}
+
+	cp := &CachePersister{
+		cfg:  cfg,
+		stop: make(chan bool),
+		done: make(chan bool),
+	}
+
+	go func() {
+		defer close(cp.done)
+		ticker := time.NewTicker(time.Duration(cfg.PersistIntervalS) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cp.stop:
+				return
+			case <-ticker.C:
+				cp.save()
+			}
+		}
+	}()
+
+	return cp
+}
+
+// Stop saving the cache periodically, and save it one last time. It can be called more than once.
+func (cp *CachePersister) Stop() {
+	cp.stopOnce.Do(func() {
+		close(cp.stop)
+		<-cp.done
+		cp.save()
+	})
+}
+
+func (cp *CachePersister) save() {
+	if saved, err := SaveCache(cp.cfg.PersistFile, false); err != nil {
+		glog.Errorf(cacheLogString(fmt.Sprintf("unable to save the exchange cache, error: %v", err)))
+	} else if saved != 0 {
+		glog.V(5).Infof(cacheLogString(fmt.Sprintf("saved %v entries to %v", saved, cp.cfg.PersistFile)))
+	}
+}
+
+// SaveCache writes the entries of the stable resource types to the file, if they have changed since they were last
+// saved or if force is set. Returns the number of entries saved.
+func SaveCache(file string, force bool) (int, error) {
+	if ExchangeResourceCache == nil {
+		return 0, nil
+	}
+
+	ExchangeResourceCache.Lock.Lock()
+	if !ExchangeResourceCache.dirty && !force {
+		ExchangeResourceCache.Lock.Unlock()
+		return 0, nil
+	}
+
+	saved := 0
+	allEntries := map[string]map[string]CacheEntry{}
+	for resourceType := range persistentCacheTypes {
+		resourceCache, ok := ExchangeResourceCache.allResources[resourceType]
+		if !ok {
+			continue
+		}
+		entries := map[string]CacheEntry{}
+		// Get the least recently used entry first, so that reading the entries keeps their order in the cache.
+		keys := resourceCache.GetKeys()
+		for ix := len(keys) - 1; ix >= 0; ix-- {
+			if entry, ok := resourceCache.Get(keys[ix]).(CacheEntry); ok {
+				entries[keys[ix]] = entry
+				saved++
+			}
+		}
+		allEntries[resourceType] = entries
+	}
+	ExchangeResourceCache.dirty = false
+	ExchangeResourceCache.Lock.Unlock()
+
+	serial, err := json.Marshal(allEntries)
+	if err == nil {
+		err = writeFileAtomic(file, serial)
+	}
+	if err != nil {
+		// Try again next time.
+		ExchangeResourceCache.Lock.Lock()
+		ExchangeResourceCache.dirty = true
+		ExchangeResourceCache.Lock.Unlock()
+		return 0, err
+	}
+	return saved, nil
+}
+
+// Write the file through a temporary file, so that a crash does not leave a partly written file behind.
+func writeFileAtomic(file string, content []byte) error {
+	if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmpFile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// LoadCache adds the entries saved in the file to the cache, skipping the entries that were last updated more than
+// maxAgeS seconds ago. A loaded entry expires once it is more than maxAgeS seconds old, unless it has been updated
+// from the exchange since. A file that does not exist is not an error. Returns the number of entries loaded.
+func LoadCache(file string, maxAgeS uint64) (int, error) {
+	serial, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	allEntries := map[string]map[string]savedCacheEntry{}
+	if err := json.Unmarshal(serial, &allEntries); err != nil {
+		return 0, errors.New(fmt.Sprintf("unable to demarshal %v, error: %v", file, err))
+	}
+
+	if ExchangeResourceCache == nil {
+		newExchangeResourceCache := NewResourceCache()
+		ExchangeResourceCache = &newExchangeResourceCache
+	}
+
+	ExchangeResourceCache.Lock.Lock()
+	defer ExchangeResourceCache.Lock.Unlock()
+
+	now := uint64(time.Now().Unix())
+	loaded := 0
+	for resourceType, entries := range allEntries {
+		newResource, ok := persistentCacheTypes[resourceType]
+		if !ok {
+			continue
+		}
+
+		// Add the most recently updated entries last, so that they are evicted last.
+		keys := make([]string, 0, len(entries))
+		for key, entry := range entries {
+			if maxAgeS == 0 || now < entry.LastUpdated+maxAgeS {
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool { return entries[keys[i]].LastUpdated < entries[keys[j]].LastUpdated })
+
+		resourceCache := ExchangeResourceCache.getTypeCache(resourceType)
+		for _, key := range keys {
+			resource := newResource()
+			if err := json.Unmarshal(entries[key].Resource, resource); err != nil {
+				glog.Warningf(cacheLogString(fmt.Sprintf("skipping saved entry %s/%s, error: %v", resourceType, key, err)))
+				continue
+			}
+			value := reflect.ValueOf(resource).Elem().Interface()
+			hash, err := hashResource(value)
+			if err != nil {
+				hash = []byte{}
+			}
+			resourceCache.Put(key, CacheEntry{Resource: value, LastUpdated: entries[key].LastUpdated, Hash: hash, loadedMaxAgeS: maxAgeS})
+			loaded++
+		}
+	}
+	return loaded, nil
+}
+
+var cacheLogString = func(v interface{}) string {
+	return fmt.Sprintf("Exchange cache: %v", v)
+}
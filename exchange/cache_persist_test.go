@@ -0,0 +1,133 @@
+// +build unit
+
+package exchange
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// Verify that the cache of a resource type is bounded and that its statistics are counted.
+func Test_CacheStats(t *testing.T) {
+	SetCacheConfig(config.ExchangeCacheConfig{ServicePolicyMaxEntries: 2})
+	defer SetCacheConfig(config.ExchangeCacheConfig{})
+	DeleteCache(SVC_POL_TYPE_CACHE)
+	defer DeleteCache(SVC_POL_TYPE_CACHE)
+
+	before := getCacheStats(SVC_POL_TYPE_CACHE)
+
+	for _, sId := range []string{"org/svc1", "org/svc2", "org/svc3"} {
+		UpdateCache(sId, SVC_POL_TYPE_CACHE, ExchangePolicy{})
+	}
+	GetServicePolicyFromCache("org/svc1")
+	GetServicePolicyFromCache("org/svc3")
+
+	stats := getCacheStats(SVC_POL_TYPE_CACHE)
+	if stats.Entries != 2 || stats.MaxEntries != 2 {
+		t.Errorf("expected 2 entries, got %v", stats)
+	} else if stats.Evictions-before.Evictions != 1 || stats.Hits-before.Hits != 1 || stats.Misses-before.Misses != 1 {
+		t.Errorf("expected 1 eviction, hit and miss, got %v, was %v", stats, before)
+	}
+}
+
+// Verify that the service definitions and keys are saved and loaded, and the other resource types are not.
+func Test_SaveCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utcache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "cache", "exchange_cache.json")
+
+	ClearAllResourceCache()
+	defer ClearAllResourceCache()
+
+	UpdateCache(ServiceCacheMapKey("org", "svc1", "amd64"), SVC_DEF_TYPE_CACHE, map[string]ServiceDefinition{"org/svc1_1.0.0_amd64": {URL: "svc1", Version: "1.0.0", Arch: "amd64"}})
+	UpdateCache(ServicePolicyCacheMapKey("org", "svc1", "amd64", "1.0.0"), SVC_KEY_TYPE_CACHE, map[string]string{"key.pem": "keycontent"})
+	UpdateCache(NodeCacheMapKey("org", "node1"), NODE_DEF_TYPE_CACHE, Device{Name: "node1"})
+
+	if saved, err := SaveCache(file, false); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if saved != 2 {
+		t.Errorf("expected 2 entries saved, got %v", saved)
+	}
+
+	// Nothing has changed since.
+	if saved, err := SaveCache(file, false); err != nil || saved != 0 {
+		t.Errorf("expected nothing saved, got %v, error %v", saved, err)
+	}
+
+	ClearAllResourceCache()
+	if loaded, err := LoadCache(file, 3600); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if loaded != 2 {
+		t.Errorf("expected 2 entries loaded, got %v", loaded)
+	}
+
+	if svcs := GetServiceFromCache("org", "svc1", "amd64"); svcs == nil || svcs["org/svc1_1.0.0_amd64"].Version != "1.0.0" {
+		t.Errorf("expected the service definition to be loaded, got %v", svcs)
+	} else if keys := GetServiceKeysFromCache("org", "svc1", "amd64", "1.0.0"); keys == nil || (*keys)["key.pem"] != "keycontent" {
+		t.Errorf("expected the keys to be loaded, got %v", keys)
+	} else if node := GetNodeFromCache("org", "node1"); node != nil {
+		t.Errorf("expected the node not to be saved, got %v", node)
+	}
+
+	// A missing file is not an error.
+	if loaded, err := LoadCache(path.Join(dir, "missing.json"), 3600); err != nil || loaded != 0 {
+		t.Errorf("expected nothing loaded, got %v, error %v", loaded, err)
+	}
+}
+
+// Verify that a loaded entry is not used once it is older than the max age, unless it was updated from the exchange.
+func Test_LoadCache_expires(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utcache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "exchange_cache.json")
+
+	ClearAllResourceCache()
+	defer ClearAllResourceCache()
+
+	// Saved 100 seconds ago, they expire in 1 second when the max age is 101 seconds.
+	lastUpdated := time.Now().Unix() - 100
+	saved := fmt.Sprintf(`{"%v": {"%v": {"resource": {"key.pem": "key1"}, "lastupdated": %v}, "%v": {"resource": {"key.pem": "key2"}, "lastupdated": %v}}}`,
+		SVC_KEY_TYPE_CACHE, ServicePolicyCacheMapKey("org", "svc1", "amd64", "1.0.0"), lastUpdated, ServicePolicyCacheMapKey("org", "svc2", "amd64", "1.0.0"), lastUpdated)
+	if err := ioutil.WriteFile(file, []byte(saved), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded, err := LoadCache(file, 101); err != nil || loaded != 2 {
+		t.Fatalf("expected 2 entries loaded, got %v, error %v", loaded, err)
+	} else if keys := GetServiceKeysFromCache("org", "svc1", "amd64", "1.0.0"); keys == nil {
+		t.Errorf("expected the loaded keys to be used")
+	}
+
+	// The second entry is seen in the exchange again.
+	UpdateCache(ServicePolicyCacheMapKey("org", "svc2", "amd64", "1.0.0"), SVC_KEY_TYPE_CACHE, map[string]string{"key.pem": "key2"})
+
+	time.Sleep(2 * time.Second)
+
+	if keys := GetServiceKeysFromCache("org", "svc1", "amd64", "1.0.0"); keys != nil {
+		t.Errorf("expected the loaded keys to expire, got %v", keys)
+	} else if keys := GetServiceKeysFromCache("org", "svc2", "amd64", "1.0.0"); keys == nil || (*keys)["key.pem"] != "key2" {
+		t.Errorf("expected the updated keys to be used, got %v", keys)
+	} else if stats := getCacheStats(SVC_KEY_TYPE_CACHE); stats.Entries != 1 {
+		t.Errorf("expected the expired entry to be removed, got %v", stats)
+	}
+}
+
+func getCacheStats(resourceType string) CacheStats {
+	for _, s := range GetCacheStats() {
+		if s.Type == resourceType {
+			return s
+		}
+	}
+	return CacheStats{Type: resourceType}
+}
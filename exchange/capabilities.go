@@ -0,0 +1,140 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/semanticversion"
+	"strings"
+)
+
+// The hub and the nodes are not upgraded at the same time, so anax can be talking to an exchange that is older than the
+// features it knows how to use. Each feature that is newer than the minimum exchange version is listed here, with the
+// first exchange version that has it. A feature that the minimum exchange version has, see
+// version.MINIMUM_EXCHANGE_VERSION, is used without a check and must not be listed, or anax would stop using it with
+// the exchanges that it supports. A feature can also name an exchange path that is only found when the exchange has
+// the feature. The path is probed when the version of the exchange is too old or not a release version, which covers
+// exchanges with the feature backported. Callers check a feature before they use it, and skip it when it is missing.
+
+const FEATURE_MAX_CHANGE_ID = "max_change_id"         // GET /changes/maxchangeid
+const FEATURE_CHANGES_LONG_POLL = "changes_long_poll" // POST /orgs/{org}/changes with waitS
+
+type ExchangeFeature struct {
+	Name       string
+	MinVersion string // The first exchange version that has the feature.
+	ProbePath  string // Relative to the exchange URL, empty when the feature can only be detected from the version.
+}
+
+// The long poll for changes assumes this contract of an exchange with FEATURE_CHANGES_LONG_POLL. The exchange accepts
+// waitS in the body of POST /orgs/{org}/changes. When there are no changes since the change ID that the caller can
+// see, it holds the request open until there is one, or until waitS seconds have passed, and then answers as it does
+// without waitS, with the changes that there are, which can be none. Reading the changes is a heartbeat of the caller
+// whether or not the request was held. The feature has no path of its own to probe, an exchange without it ignores
+// waitS and answers right away. So the retriever treats each long poll as the probe, and falls back to polling when a
+// long poll that found no changes returns well before waitS, see changes.LongPollRetriever.
+var ExchangeFeatures = []ExchangeFeature{
+	{Name: FEATURE_MAX_CHANGE_ID, MinVersion: "2.45.0", ProbePath: "changes/maxchangeid"},
+	{Name: FEATURE_CHANGES_LONG_POLL, MinVersion: "2.61.0"},
+}
+
+// The features that were detected in an exchange. A feature is not in the map when it could not be detected, because
+// the probe failed or the version is not a release version.
+type ExchangeCapabilities struct {
+	ExchangeVersion string          `json:"exchange_version"`
+	Features        map[string]bool `json:"features"`
+}
+
+func (c ExchangeCapabilities) String() string {
+	return fmt.Sprintf("ExchangeVersion: %v, Features: %v", c.ExchangeVersion, c.Features)
+}
+
+// Returns false only when the feature is known to be missing. A feature that could not be detected, or capabilities
+// that could not be detected at all, are assumed to be there, which is what anax did before it checked.
+func (c *ExchangeCapabilities) Supports(feature string) bool {
+	if c == nil {
+		return true
+	} else if supported, ok := c.Features[feature]; ok {
+		return supported
+	}
+	return true
+}
+
+// Returns the features of the exchange, detected from its version and probes. The result is cached as long as the
+// exchange version is.
+func GetExchangeCapabilities(httpClientFactory *config.HTTPClientFactory, exchangeUrl string, id string, token string) (*ExchangeCapabilities, error) {
+
+	// remove trailing slash from the url for a consistent cache key
+	cacheKey := strings.TrimSuffix(exchangeUrl, "/")
+	if caps := GetExchangeCapabilitiesFromCache(cacheKey); caps != nil {
+		return caps, nil
+	}
+
+	exchVers, err := GetExchangeVersion(httpClientFactory, exchangeUrl, id, token)
+	if err != nil {
+		return nil, err
+	} else if exchVers == "" {
+		return nil, errors.New(fmt.Sprintf("the exchange at %v did not return its version", exchangeUrl))
+	}
+
+	caps := &ExchangeCapabilities{ExchangeVersion: exchVers, Features: make(map[string]bool)}
+	for _, feature := range ExchangeFeatures {
+		hasFeature, known := versionHasFeature(exchVers, feature)
+		if hasFeature {
+			caps.Features[feature.Name] = true
+		} else if feature.ProbePath == "" {
+			// A version that cannot be compared says nothing about the feature.
+			if known {
+				caps.Features[feature.Name] = false
+			}
+		} else if found, err := probeExchangePath(httpClientFactory, exchangeUrl+feature.ProbePath, id, token); err != nil {
+			glog.Warningf(rpclogString(fmt.Sprintf("unable to probe the exchange for %v, error: %v", feature.Name, err)))
+		} else {
+			caps.Features[feature.Name] = found
+		}
+	}
+
+	glog.V(3).Infof(rpclogString(fmt.Sprintf("detected exchange capabilities %v", caps)))
+	UpdateCache(cacheKey, EXCH_CAPS_TYPE_CACHE, caps)
+	return caps, nil
+}
+
+// Returns true unless the exchange is known to be missing the feature. An error detecting the capabilities is logged,
+// and the feature is assumed to be there so that the caller behaves as it did before features were checked.
+func ExchangeSupports(ec ExchangeContext, feature string) bool {
+	caps, err := GetExchangeCapabilities(ec.GetHTTPFactory(), ec.GetExchangeURL(), ec.GetExchangeId(), ec.GetExchangeToken())
+	if err != nil {
+		glog.Warningf(rpclogString(fmt.Sprintf("unable to detect the exchange capabilities, assuming %v is supported, error: %v", feature, err)))
+	} else if !caps.Supports(feature) {
+		glog.V(3).Infof(rpclogString(fmt.Sprintf("exchange version %v does not support %v", caps.ExchangeVersion, feature)))
+		return false
+	}
+	return true
+}
+
+// Returns whether the exchange version has the feature, and whether the version could be compared at all.
+func versionHasFeature(exchVers string, feature ExchangeFeature) (bool, bool) {
+	if !semanticversion.IsVersionString(exchVers) {
+		return false, false
+	} else if comp, err := semanticversion.CompareVersions(exchVers, feature.MinVersion); err != nil {
+		return false, false
+	} else {
+		return comp >= 0, true
+	}
+}
+
+// Returns true when the exchange answers a GET of the path, false when the path is not found. The probed paths
+// return a JSON body when they are found.
+func probeExchangePath(httpClientFactory *config.HTTPClientFactory, targetURL string, id string, token string) (bool, error) {
+	var resp interface{}
+	resp = ""
+
+	if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "GET", targetURL, id, token, nil, &resp); err != nil {
+		return false, err
+	} else if tpErr != nil {
+		return false, tpErr
+	}
+
+	// The response is left untouched when the path is not found.
+	return resp.(string) != "", nil
+}
@@ -0,0 +1,100 @@
+// +build unit
+
+package exchange
+
+import (
+	"github.com/open-horizon/anax/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Start an exchange of the given version. The max change ID is served when maxChangeID is set, even when the version
+// is too old to have it.
+func newCapabilitiesExchange(t *testing.T, version string, maxChangeID bool) (*httptest.Server, ExchangeContext) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/admin/version" && version != "":
+			w.Write([]byte(version + "\n"))
+		case r.URL.Path == "/v1/changes/maxchangeid" && maxChangeID:
+			w.Write([]byte(`{"maxChangeId":42}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	factory := &config.HTTPClientFactory{
+		NewHTTPClient: func(overrideTimeoutS *uint) *http.Client { return server.Client() },
+		RetryCount:    1,
+		RetryInterval: 1,
+	}
+	return server, NewCustomExchangeContext("myorg/n1", "token", server.URL+"/v1/", "", factory)
+}
+
+func Test_ExchangeCapabilities(t *testing.T) {
+	ClearAllResourceCache()
+	defer ClearAllResourceCache()
+
+	// An exchange with every feature.
+	server, ec := newCapabilitiesExchange(t, "2.61.0", true)
+	defer server.Close()
+	caps, err := GetExchangeCapabilities(ec.GetHTTPFactory(), ec.GetExchangeURL(), ec.GetExchangeId(), ec.GetExchangeToken())
+	if err != nil {
+		t.Fatalf("unable to get capabilities, error: %v", err)
+	} else if caps.ExchangeVersion != "2.61.0" {
+		t.Errorf("wrong exchange version %v", caps.ExchangeVersion)
+	}
+	for _, feature := range ExchangeFeatures {
+		if !caps.Features[feature.Name] {
+			t.Errorf("feature %v not detected in %v", feature.Name, caps)
+		}
+	}
+	if GetExchangeCapabilitiesFromCache(server.URL+"/v1") == nil {
+		t.Errorf("capabilities were not cached")
+	}
+
+	// An exchange older than the minimum version, with the max change ID backported.
+	oldServer, oldEC := newCapabilitiesExchange(t, "2.43.0", true)
+	defer oldServer.Close()
+	if !ExchangeSupports(oldEC, FEATURE_MAX_CHANGE_ID) {
+		t.Errorf("the probe did not find the max change ID")
+	} else if ExchangeSupports(oldEC, FEATURE_CHANGES_LONG_POLL) {
+		t.Errorf("long polling detected in an old exchange")
+	} else if resp, err := GetExchangeChangeID(oldEC); err != nil || resp.MaxChangeID != 42 {
+		t.Errorf("expected the max change ID, got %v, error: %v", resp, err)
+	}
+
+	// An exchange older than the minimum version without the max change ID.
+	noProbeServer, noProbeEC := newCapabilitiesExchange(t, "2.43.0", false)
+	defer noProbeServer.Close()
+	if ExchangeSupports(noProbeEC, FEATURE_MAX_CHANGE_ID) {
+		t.Errorf("the probe found a max change ID that is not there")
+	} else if resp, err := GetExchangeChangeID(noProbeEC); err != nil || resp.MaxChangeID != FIRST_CHANGE_ID {
+		t.Errorf("expected the first change ID, got %v, error: %v", resp, err)
+	}
+
+	// A development build says nothing about the features that cannot be probed.
+	devServer, devEC := newCapabilitiesExchange(t, "2.62.0-SNAPSHOT", false)
+	defer devServer.Close()
+	if caps, err := GetExchangeCapabilities(devEC.GetHTTPFactory(), devEC.GetExchangeURL(), "", ""); err != nil {
+		t.Errorf("unable to get capabilities, error: %v", err)
+	} else if _, ok := caps.Features[FEATURE_CHANGES_LONG_POLL]; ok || !caps.Supports(FEATURE_CHANGES_LONG_POLL) {
+		t.Errorf("long polling should be unknown and assumed, got %v", caps)
+	} else if caps.Supports(FEATURE_MAX_CHANGE_ID) {
+		t.Errorf("the probe found a max change ID that is not there")
+	}
+
+	// Every feature is assumed when the version cannot be read.
+	unknownServer, unknownEC := newCapabilitiesExchange(t, "", false)
+	defer unknownServer.Close()
+	if _, err := GetExchangeCapabilities(unknownEC.GetHTTPFactory(), unknownEC.GetExchangeURL(), "", ""); err == nil {
+		t.Errorf("expected an error without an exchange version")
+	} else if !ExchangeSupports(unknownEC, FEATURE_CHANGES_LONG_POLL) {
+		t.Errorf("a feature should be assumed when the capabilities are unknown")
+	}
+
+	var nilCaps *ExchangeCapabilities
+	if !nilCaps.Supports(FEATURE_CHANGES_LONG_POLL) {
+		t.Errorf("a feature should be assumed without capabilities")
+	}
+}
@@ -186,48 +186,85 @@ func (e *ExchangeChanges) GetExchangeVersion() string {
 	return e.ExchangeVersion
 }
 
+// Returns the reason why these changes might not follow on from the requested change ID, or the empty string if they
+// do. The exchange starts the change IDs again when its database is replaced, so the changes do not follow on when the
+// most recent change ID is older than the requested ID, or when the exchange version is not the one that returned the
+// previous changes. The change IDs returned to a client are not consecutive, so changes that the exchange trimmed from
+// its change table cannot be detected from the IDs, see GetChangesRetentionGap.
+func (e *ExchangeChanges) GetChangesGap(changeId uint64, exchangeVersion string) string {
+	if e.MostRecentChangeID != 0 && e.MostRecentChangeID+1 < changeId {
+		return fmt.Sprintf("the most recent change ID %v is older than the requested change ID %v", e.MostRecentChangeID, changeId)
+	} else if exchangeVersion != "" && e.ExchangeVersion != "" && exchangeVersion != e.ExchangeVersion {
+		return fmt.Sprintf("the exchange version changed from %v to %v", exchangeVersion, e.ExchangeVersion)
+	}
+	return ""
+}
+
+// Returns the reason why changes might have been missed, or the empty string if they could not have been. The exchange
+// trims the changes older than its retention period from its change table, so a client that has not read the changes
+// for longer, because it was offline or because it restored an old database, might have missed some. lastRead is when
+// the client last read the changes, in seconds since 1970, zero when it is not known.
+func GetChangesRetentionGap(lastRead int64, retentionS int) string {
+	if lastRead == 0 || retentionS <= 0 {
+		return ""
+	} else if age := time.Now().Unix() - lastRead; age > int64(retentionS) {
+		return fmt.Sprintf("the changes were last read %v seconds ago, longer than the exchange keeps them", age)
+	}
+	return ""
+}
+
 // This is the request body for the changes API call.
 type GetExchangeChangesRequest struct {
 	ChangeId   uint64   `json:"changeId"`
 	MaxRecords int      `json:"maxRecords,omitempty"`
 	Orgs       []string `json:"orgList,omitempty"`
+
+	// When there are no changes, the exchange holds the request open for up to this many seconds, until there is one.
+	WaitS int `json:"waitS,omitempty"`
 }
 
 type ExchangeChangeIDResponse struct {
 	MaxChangeID uint64 `json:"maxChangeId,omitempty"`
 }
 
-// Retrieve the latest change ID from the exchange.
+// The ID of the first change recorded by the exchange.
+const FIRST_CHANGE_ID = 1
+
+// Retrieve the latest change ID from the exchange, or the first change ID when the exchange cannot tell or has no
+// changes yet.
 func GetExchangeChangeID(ec ExchangeContext) (*ExchangeChangeIDResponse, error) {
 
 	glog.V(3).Infof(rpclogString(fmt.Sprintf("getting current max change ID")))
 
+	// Without a max change ID the changes are read from the first one. The change IDs start at 1, and the callers
+	// take 0 to mean that they do not have a change ID yet.
+	if !ExchangeSupports(ec, FEATURE_MAX_CHANGE_ID) {
+		return &ExchangeChangeIDResponse{MaxChangeID: FIRST_CHANGE_ID}, nil
+	}
+
 	var resp interface{}
 	resp = new(ExchangeChangeIDResponse)
 
 	// Get resource changes in the exchange
 	targetURL := fmt.Sprintf("%vchanges/maxchangeid", ec.GetExchangeURL())
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			changeResp := resp.(*ExchangeChangeIDResponse)
+			if changeResp.MaxChangeID == 0 {
+				// There are no changes yet.
+				changeResp.MaxChangeID = FIRST_CHANGE_ID
+			}
 
 			glog.V(3).Infof(rpclogString(fmt.Sprintf("found max changes ID %v", changeResp)))
 			return changeResp, nil
@@ -259,24 +296,17 @@ func GetExchangeChanges(ec ExchangeContext, changeId uint64, maxRecords int, org
 	// Get resource changes in the exchange
 	targetURL := fmt.Sprintf("%vorgs/%v/changes", ec.GetExchangeURL(), GetOrg(ec.GetExchangeId()))
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "POST", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), &req, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			changes := resp.(*ExchangeChanges)
 
@@ -290,3 +320,36 @@ func GetExchangeChanges(ec ExchangeContext, changeId uint64, maxRecords int, org
 		}
 	}
 }
+
+// The number of seconds that a long poll for changes is given on top of the time the exchange holds it open, before
+// the request is abandoned.
+const LONG_POLL_TIMEOUT_MARGIN_S = 30
+
+// Retrieve the changes from the exchange, asking the exchange to hold the request open for up to waitS seconds when
+// there are none, see FEATURE_CHANGES_LONG_POLL. The request is not retried, so that the caller can fall back to
+// polling when it fails.
+func WaitForExchangeChanges(ec ExchangeContext, changeId uint64, maxRecords int, waitS int) (*ExchangeChanges, error) {
+
+	glog.V(3).Infof(rpclogString(fmt.Sprintf("waiting up to %v seconds for %v changes since change ID %v", waitS, maxRecords, changeId)))
+
+	var resp interface{}
+	resp = new(ExchangeChanges)
+	req := GetExchangeChangesRequest{
+		ChangeId:   changeId,
+		MaxRecords: maxRecords,
+		WaitS:      waitS,
+	}
+
+	targetURL := fmt.Sprintf("%vorgs/%v/changes", ec.GetExchangeURL(), GetOrg(ec.GetExchangeId()))
+	timeoutS := uint(waitS + LONG_POLL_TIMEOUT_MARGIN_S)
+
+	if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(&timeoutS), "POST", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), &req, &resp); err != nil {
+		return nil, err
+	} else if tpErr != nil {
+		return nil, tpErr
+	}
+
+	changes := resp.(*ExchangeChanges)
+	glog.V(3).Infof(rpclogString(fmt.Sprintf("found %v changes since ID %v with latest change ID %v", len(changes.Changes), changeId, changes.MostRecentChangeID)))
+	return changes, nil
+}
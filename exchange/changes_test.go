@@ -0,0 +1,49 @@
+// +build unit
+
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+// Verify that a gap in the changes is detected from the most recent change ID and the exchange version.
+func Test_GetChangesGap(t *testing.T) {
+	changes := ExchangeChanges{MostRecentChangeID: 100, ExchangeVersion: "2.60.0"}
+
+	if gap := changes.GetChangesGap(50, "2.60.0"); gap != "" {
+		t.Errorf("unexpected gap %v for changes after the requested ID", gap)
+	} else if gap := changes.GetChangesGap(101, "2.60.0"); gap != "" {
+		t.Errorf("unexpected gap %v when there are no new changes", gap)
+	} else if gap := changes.GetChangesGap(50, ""); gap != "" {
+		t.Errorf("unexpected gap %v when the previous exchange version is not known", gap)
+	}
+
+	if gap := changes.GetChangesGap(500, "2.60.0"); gap == "" {
+		t.Errorf("no gap detected when the change IDs went backwards")
+	} else if gap := changes.GetChangesGap(50, "2.59.0"); gap == "" {
+		t.Errorf("no gap detected when the exchange version changed")
+	}
+
+	changes.MostRecentChangeID = 0
+	if gap := changes.GetChangesGap(500, "2.60.0"); gap != "" {
+		t.Errorf("unexpected gap %v without a most recent change ID", gap)
+	}
+}
+
+// Verify that a gap in the changes is detected when they were last read before the retention period of the exchange.
+func Test_GetChangesRetentionGap(t *testing.T) {
+	now := time.Now().Unix()
+
+	if gap := GetChangesRetentionGap(now-100, 3600); gap != "" {
+		t.Errorf("unexpected gap %v for changes read within the retention period", gap)
+	} else if gap := GetChangesRetentionGap(0, 3600); gap != "" {
+		t.Errorf("unexpected gap %v when the changes were never read", gap)
+	} else if gap := GetChangesRetentionGap(now-7200, 0); gap != "" {
+		t.Errorf("unexpected gap %v without a retention period", gap)
+	}
+
+	if gap := GetChangesRetentionGap(now-7200, 3600); gap == "" {
+		t.Errorf("no gap detected when the changes were last read before the retention period")
+	}
+}
@@ -0,0 +1,330 @@
+package exchange
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/sha3"
+	"io"
+	"math/big"
+)
+
+// The versions of the envelope of an exchange message. The original envelope, the ExchangeMessage, has no version
+// field, so it is version 1 when the version is missing.
+//
+// Version 2 is used when the sender or the receiver has an Ed25519 messaging key. The key used to encrypt the
+// WrappedMessage is agreed with X25519, between an ephemeral key and the receiver's Ed25519 key converted to its
+// X25519 form, or it is a random key encrypted with the receiver's RSA key. The WrappedMessage is encrypted with
+// ChaCha20-Poly1305, and signed with the sender's key, RSA-PSS as in version 1 or Ed25519.
+//
+// A party only publishes an Ed25519 key when it can open version 2 envelopes, so the type of the published key is the
+// negotiation. Two parties with RSA keys keep using version 1, which is what the parties without version 2 support
+// expect. A party without version 2 support cannot check a message signed with an Ed25519 key either, so a party only
+// creates an Ed25519 key when it is configured that all its peers support version 2, see MessageEnvelopeConfig.
+const (
+	EXCHANGE_MESSAGE_V1 = 1
+	EXCHANGE_MESSAGE_V2 = 2
+)
+
+// The ways the key of a version 2 envelope is sent to the receiver.
+const (
+	KEY_EXCHANGE_X25519   = "x25519"
+	KEY_EXCHANGE_RSA_OAEP = "rsa-oaep"
+)
+
+const envelopeKeyInfo = "horizon exchange message v2"
+
+// Used to find the version of an envelope before it is unmarshalled.
+type envelopeVersion struct {
+	Version int `json:"version"`
+}
+
+type ExchangeMessageV2 struct {
+	Version        int                     `json:"version"`
+	KeyExchange    string                  `json:"keyExchange"`
+	EncryptedKey   []byte                  `json:"encryptedKey"` // The ephemeral X25519 public key, or the encrypted key.
+	Nonce          []byte                  `json:"nonce"`
+	WrappedMessage EncryptedWrappedMessage `json:"wrappedMessage"`
+}
+
+func (self ExchangeMessageV2) String() string {
+	return fmt.Sprintf("Version: %v, KeyExchange: %v, EncryptedKey: %x, Nonce: %x, Wrapped Message: %v", self.Version, self.KeyExchange, self.EncryptedKey, self.Nonce, self.WrappedMessage)
+}
+
+// The parts of the envelope that are authenticated with the WrappedMessage, so that they cannot be swapped.
+func (self ExchangeMessageV2) additionalData() []byte {
+	return append([]byte(fmt.Sprintf("%v/%v/", self.Version, self.KeyExchange)), self.EncryptedKey...)
+}
+
+// Construct a message for the receiver in the envelope that the sender's and the receiver's keys support. The keys are
+// RSA or Ed25519 keys, as returned by GetKeys and DemarshalPublicKey. The message is returned in its wire form. A
+// message from an Ed25519 key to an RSA key is refused unless every peer is configured to support version 2, because
+// the receiver might not be able to open it.
+func ConstructVersionedExchangeMessage(message []byte, senderPrivateKey crypto.PrivateKey, receiverPublicKey crypto.PublicKey) ([]byte, error) {
+
+	senderRSAKey, senderIsRSA := senderPrivateKey.(*rsa.PrivateKey)
+	receiverRSAKey, receiverIsRSA := receiverPublicKey.(*rsa.PublicKey)
+
+	if _, senderIsEd25519 := senderPrivateKey.(ed25519.PrivateKey); senderIsEd25519 && receiverIsRSA && !peersSupportV2() {
+		return nil, errors.New(fmt.Sprintf("Error an Ed25519 messaging key cannot send to an RSA key unless MessageEnvelope.PeersSupportV2 is set, the key is replaced by an RSA key at the next rotation"))
+	}
+
+	if senderIsRSA && receiverIsRSA && senderRSAKey != nil {
+		if em, err := ConstructExchangeMessage(message, &senderRSAKey.PublicKey, senderRSAKey, receiverRSAKey); err != nil {
+			return nil, err
+		} else {
+			return json.Marshal(em)
+		}
+	}
+
+	if em, err := constructExchangeMessageV2(message, senderPrivateKey, receiverPublicKey); err != nil {
+		return nil, err
+	} else {
+		return json.Marshal(em)
+	}
+}
+
+// Here is an overview of what happens in order to construct a version 2 ExchangeMessage
+// 1. sign the message with the sender's private key
+// 2. construct a WrappedMessage object including the original message, the signature, and the signer's public key
+// 3. agree on a key with the receiver, or encrypt a random key with the receiver's public key
+// 4. encrypt the WrappedMessage with the key, authenticating the way the key was sent
+
+func constructExchangeMessageV2(message []byte, senderPrivateKey crypto.PrivateKey, receiverPublicKey crypto.PublicKey) (*ExchangeMessageV2, error) {
+
+	if len(message) == 0 {
+		return nil, errors.New(fmt.Sprintf("Error message has length zero"))
+	}
+
+	// 1. sign the message with the sender's private key.
+	var signature []byte
+	var senderPublicKey crypto.PublicKey
+	switch k := senderPrivateKey.(type) {
+	case *rsa.PrivateKey:
+		if k == nil {
+			return nil, errors.New(fmt.Sprintf("Error sender private key is nil"))
+		} else if err := k.Validate(); err != nil {
+			return nil, errors.New(fmt.Sprintf("Private key is not valid"))
+		}
+		digest := sha3.Sum256(message)
+		if sig, err := rsa.SignPSS(rand.Reader, k, crypto.SHA3_256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error signing the message, error: %v", err))
+		} else {
+			signature = sig
+		}
+		senderPublicKey = &k.PublicKey
+	case ed25519.PrivateKey:
+		if len(k) != ed25519.PrivateKeySize {
+			return nil, errors.New(fmt.Sprintf("Private key is not valid"))
+		}
+		signature = ed25519.Sign(k, message)
+		senderPublicKey = k.Public()
+	default:
+		return nil, errors.New(fmt.Sprintf("Error sender private key type %T is not supported", senderPrivateKey))
+	}
+
+	// 2. construct a WrappedMessage object including the original message, the signature, and the signer's public key.
+	var wmBytes []byte
+	if pubKey, err := MarshalPublicKey(senderPublicKey); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error marshalling sender public key, error %v", err))
+	} else if wmBytes, err = json.Marshal(&WrappedMessage{Msg: message, Signature: signature, SignerPubKey: pubKey}); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error marshalling wrapped message, error %v", err))
+	} else {
+		glog.V(6).Infof("Created Wrapped Message %s", wmBytes)
+	}
+
+	// 3. agree on a key with the receiver, or encrypt a random key with the receiver's public key.
+	em := &ExchangeMessageV2{Version: EXCHANGE_MESSAGE_V2}
+	var key []byte
+	switch k := receiverPublicKey.(type) {
+	case *rsa.PublicKey:
+		if k == nil {
+			return nil, errors.New(fmt.Sprintf("Error receiver public key is nil"))
+		}
+		key = make([]byte, chacha20poly1305.KeySize)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error generating the message key, error %v", err))
+		} else if em.EncryptedKey, err = rsa.EncryptOAEP(sha3.New256(), rand.Reader, k, key, []byte("")); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error encrypting the message key, error %v", err))
+		}
+		em.KeyExchange = KEY_EXCHANGE_RSA_OAEP
+	case ed25519.PublicKey:
+		receiverX25519Key, err := x25519PublicKey(k)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error converting the receiver public key, error %v", err))
+		}
+		ephemeralKey := make([]byte, curve25519.ScalarSize)
+		if _, err := io.ReadFull(rand.Reader, ephemeralKey); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error generating the ephemeral key, error %v", err))
+		} else if em.EncryptedKey, err = curve25519.X25519(ephemeralKey, curve25519.Basepoint); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error generating the ephemeral key, error %v", err))
+		} else if key, err = agreeMessageKey(ephemeralKey, receiverX25519Key, em.EncryptedKey); err != nil {
+			return nil, err
+		}
+		em.KeyExchange = KEY_EXCHANGE_X25519
+	default:
+		return nil, errors.New(fmt.Sprintf("Error receiver public key type %T is not supported", receiverPublicKey))
+	}
+
+	// 4. encrypt the WrappedMessage with the key, authenticating the way the key was sent.
+	if aead, err := chacha20poly1305.New(key); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error creating the cipher, error %v", err))
+	} else {
+		em.Nonce = make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, em.Nonce); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error generating the nonce, error %v", err))
+		}
+		em.WrappedMessage = aead.Seal(nil, em.Nonce, wmBytes, em.additionalData())
+	}
+
+	glog.V(6).Infof("Created ExchangeMessage %v", em)
+	return em, nil
+}
+
+// Deconstruct a version 2 ExchangeMessage with the first of the receiver's private keys that can open it.
+func deconstructExchangeMessageV2(encryptedMessage []byte, receiverPrivateKeys []crypto.PrivateKey) ([]byte, crypto.PublicKey, error) {
+
+	em := new(ExchangeMessageV2)
+	if err := json.Unmarshal(encryptedMessage, &em); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Error unmarshalling exchange message %s, error %v", encryptedMessage, err))
+	} else if len(em.EncryptedKey) == 0 || len(em.Nonce) == 0 || len(em.WrappedMessage) == 0 {
+		return nil, nil, errors.New(fmt.Sprintf("Error unmarshalling exchange message, one of encrypted key %v, nonce %v or wrapped message %v has length zero.", em.EncryptedKey, em.Nonce, em.WrappedMessage))
+	}
+
+	var wmBytes []byte
+	err := errors.New(fmt.Sprintf("Error exchange message key exchange %v does not match the private key", em.KeyExchange))
+	for _, receiverPrivateKey := range receiverPrivateKeys {
+		if wmBytes, err = openExchangeMessageV2(em, receiverPrivateKey); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wm := new(WrappedMessage)
+	if err := json.Unmarshal(wmBytes, &wm); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Error unmarshalling wrapped message, error %v", err))
+	} else if len(wm.Signature) == 0 || len(wm.SignerPubKey) == 0 {
+		return nil, nil, errors.New(fmt.Sprintf("Error unmarshalling wrapped message, one of signature %v or signer public key %v has length zero.", wm.Signature, wm.SignerPubKey))
+	}
+
+	senderPublicKey, err := DemarshalPublicKey(wm.SignerPubKey)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Error demarshalling sender public key, %v", err))
+	}
+
+	switch k := senderPublicKey.(type) {
+	case *rsa.PublicKey:
+		digest := sha3.Sum256(wm.Msg)
+		if err := rsa.VerifyPSS(k, crypto.SHA3_256, digest[:], wm.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Error verifying signature, error %v", err))
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, wm.Msg, wm.Signature) {
+			return nil, nil, errors.New(fmt.Sprintf("Error verifying signature"))
+		}
+	}
+
+	glog.V(6).Infof("Signature verification successful")
+	return wm.Msg, senderPublicKey, nil
+}
+
+// Decrypt the WrappedMessage of a version 2 ExchangeMessage with the receiver's private key.
+func openExchangeMessageV2(em *ExchangeMessageV2, receiverPrivateKey crypto.PrivateKey) ([]byte, error) {
+
+	var key []byte
+	switch k := receiverPrivateKey.(type) {
+	case *rsa.PrivateKey:
+		if em.KeyExchange != KEY_EXCHANGE_RSA_OAEP {
+			return nil, errors.New(fmt.Sprintf("Error exchange message key exchange %v does not match the RSA private key", em.KeyExchange))
+		} else if decryptedKey, err := rsa.DecryptOAEP(sha3.New256(), rand.Reader, k, em.EncryptedKey, []byte("")); err != nil {
+			return nil, errors.New(fmt.Sprintf("Error decrypting the message key, error %v", err))
+		} else {
+			key = decryptedKey
+		}
+	case ed25519.PrivateKey:
+		if em.KeyExchange != KEY_EXCHANGE_X25519 {
+			return nil, errors.New(fmt.Sprintf("Error exchange message key exchange %v does not match the Ed25519 private key", em.KeyExchange))
+		} else if agreedKey, err := agreeMessageKey(x25519PrivateKey(k), em.EncryptedKey, em.EncryptedKey); err != nil {
+			return nil, err
+		} else {
+			key = agreedKey
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("Error private key type %T is not supported", receiverPrivateKey))
+	}
+
+	if aead, err := chacha20poly1305.New(key); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error creating the cipher, error %v", err))
+	} else if len(em.Nonce) != aead.NonceSize() {
+		return nil, errors.New(fmt.Sprintf("Error nonce has length %v, must be %v", len(em.Nonce), aead.NonceSize()))
+	} else if wmBytes, err := aead.Open(nil, em.Nonce, em.WrappedMessage, em.additionalData()); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error decrypting message: %v", err))
+	} else {
+		return wmBytes, nil
+	}
+}
+
+// Derive the key of a version 2 envelope from the X25519 shared secret of the private key and the peer's public key.
+// The ephemeral public key is mixed in, so that each message has its own key.
+func agreeMessageKey(privateKey []byte, peerPublicKey []byte, ephemeralPublicKey []byte) ([]byte, error) {
+	shared, err := curve25519.X25519(privateKey, peerPublicKey)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error agreeing on the message key, error %v", err))
+	}
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, ephemeralPublicKey, []byte(envelopeKeyInfo)), key); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error deriving the message key, error %v", err))
+	}
+	return key, nil
+}
+
+// The X25519 private key of an Ed25519 private key, the scalar that Ed25519 derives from the seed.
+func x25519PrivateKey(privateKey ed25519.PrivateKey) []byte {
+	h := sha512.Sum512(privateKey.Seed())
+	return h[:curve25519.ScalarSize]
+}
+
+// The X25519 public key of an Ed25519 public key, the Montgomery u = (1 + y) / (1 - y) of the Edwards point.
+func x25519PublicKey(publicKey ed25519.PublicKey) ([]byte, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New(fmt.Sprintf("key has length %v, must be %v", len(publicKey), ed25519.PublicKeySize))
+	}
+
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+	// The key is y in little endian, with the sign of x in the top bit.
+	yBytes := make([]byte, len(publicKey))
+	for i := range publicKey {
+		yBytes[len(publicKey)-1-i] = publicKey[i]
+	}
+	yBytes[0] &= 0x7f
+	y := new(big.Int).SetBytes(yBytes)
+
+	one := big.NewInt(1)
+	den := new(big.Int).Mod(new(big.Int).Sub(one, y), p)
+	if den.Sign() == 0 {
+		return nil, errors.New(fmt.Sprintf("key %x has no X25519 form", []byte(publicKey)))
+	}
+	u := new(big.Int).Add(one, y)
+	u.Mul(u, den.ModInverse(den, p))
+	u.Mod(u, p)
+
+	uBytes := u.Bytes()
+	res := make([]byte, curve25519.PointSize)
+	for i := range uBytes {
+		res[i] = uBytes[len(uBytes)-1-i]
+	}
+	return res, nil
+}
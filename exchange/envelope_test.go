@@ -0,0 +1,290 @@
+// +build unit
+
+package exchange
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/open-horizon/anax/config"
+	"golang.org/x/crypto/curve25519"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// The X25519 form of an Ed25519 key pair must be a matching X25519 key pair.
+func Test_X25519KeyConversion(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+		if xPub, err := x25519PublicKey(pub); err != nil {
+			t.Fatalf("unable to convert public key, error %v", err)
+		} else if derived, err := curve25519.X25519(x25519PrivateKey(priv), curve25519.Basepoint); err != nil {
+			t.Fatalf("unable to derive public key, error %v", err)
+		} else if !bytes.Equal(xPub, derived) {
+			t.Errorf("converted public key %x does not match the converted private key %x", xPub, derived)
+		}
+	}
+
+	if _, err := x25519PublicKey(ed25519.PublicKey([]byte{1, 2, 3})); err == nil {
+		t.Errorf("expected an error for a short key")
+	}
+}
+
+// Every combination of sender and receiver key types must get a message across, in the original envelope when both
+// keys are RSA keys and in the versioned envelope otherwise.
+func Test_EnvelopeCrossVersion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	keys := map[string]crypto.PrivateKey{"rsa": rsaKey, "ed25519": edKey}
+	pubKeys := map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ed25519": edPub}
+	message := []byte(`{"type":"proposal","protocol":"Basic"}`)
+
+	SetMessageEnvelopeConfig(config.MessageEnvelopeConfig{PeersSupportV2: true})
+	defer SetMessageEnvelopeConfig(config.MessageEnvelopeConfig{})
+
+	for sender, senderKey := range keys {
+		for receiver, receiverKey := range keys {
+			wire, err := ConstructVersionedExchangeMessage(message, senderKey, pubKeys[receiver])
+			if err != nil {
+				t.Fatalf("%v to %v: unable to construct message, error %v", sender, receiver, err)
+			}
+
+			env := new(envelopeVersion)
+			if err := json.Unmarshal(wire, env); err != nil {
+				t.Fatalf("%v to %v: unable to unmarshal message, error %v", sender, receiver, err)
+			} else if sender == "rsa" && receiver == "rsa" && env.Version != 0 {
+				t.Errorf("%v to %v: expected the original envelope, got version %v", sender, receiver, env.Version)
+			} else if (sender != "rsa" || receiver != "rsa") && env.Version != EXCHANGE_MESSAGE_V2 {
+				t.Errorf("%v to %v: expected version %v, got %v", sender, receiver, EXCHANGE_MESSAGE_V2, env.Version)
+			}
+
+			if msg, signer, err := DeconstructExchangeMessage(wire, receiverKey); err != nil {
+				t.Errorf("%v to %v: unable to deconstruct message, error %v", sender, receiver, err)
+			} else if !bytes.Equal(msg, message) {
+				t.Errorf("%v to %v: wrong message %s", sender, receiver, msg)
+			} else if signerBytes, _ := MarshalPublicKey(signer); !bytes.Equal(signerBytes, marshalOrFail(t, pubKeys[sender])) {
+				t.Errorf("%v to %v: wrong signer %v", sender, receiver, signer)
+			}
+
+			// The message cannot be opened with the other key.
+			other := "rsa"
+			if receiver == "rsa" {
+				other = "ed25519"
+			}
+			if _, _, err := DeconstructExchangeMessage(wire, keys[other]); err == nil {
+				t.Errorf("%v to %v: message was opened with the %v key", sender, receiver, other)
+			}
+		}
+	}
+}
+
+// A party that only knows the original envelope exchanges messages with a party that knows both, as long as both
+// publish RSA keys.
+func Test_EnvelopeWithOriginalPeer(t *testing.T) {
+	oldPeer, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newPeer, _ := rsa.GenerateKey(rand.Reader, 2048)
+	message := []byte(`{"type":"reply","protocol":"Basic"}`)
+
+	// From the original code path to the versioned one.
+	if em, err := ConstructExchangeMessage(message, &oldPeer.PublicKey, oldPeer, &newPeer.PublicKey); err != nil {
+		t.Fatalf("unable to construct message, error %v", err)
+	} else if wire, err := json.Marshal(em); err != nil {
+		t.Fatalf("unable to marshal message, error %v", err)
+	} else if msg, _, err := DeconstructExchangeMessage(wire, newPeer); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("unable to deconstruct message from the original envelope, error %v", err)
+	}
+
+	// From the versioned code path to the original one.
+	if wire, err := ConstructVersionedExchangeMessage(message, newPeer, &oldPeer.PublicKey); err != nil {
+		t.Fatalf("unable to construct message, error %v", err)
+	} else if msg, _, err := deconstructExchangeMessageV1(wire, []*rsa.PrivateKey{oldPeer}); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("original code path unable to deconstruct message, error %v", err)
+	}
+
+	// A versioned envelope fails cleanly in the original code path.
+	edKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if em, err := constructExchangeMessageV2(message, edKey, &oldPeer.PublicKey); err != nil {
+		t.Fatalf("unable to construct message, error %v", err)
+	} else if wire, err := json.Marshal(em); err != nil {
+		t.Fatalf("unable to marshal message, error %v", err)
+	} else if _, _, err := deconstructExchangeMessageV1(wire, []*rsa.PrivateKey{oldPeer}); err == nil {
+		t.Errorf("original code path accepted a versioned envelope")
+	}
+
+	// So a versioned envelope is not sent from an Ed25519 key to an RSA key, unless every peer supports it.
+	if _, err := ConstructVersionedExchangeMessage(message, edKey, &oldPeer.PublicKey); err == nil {
+		t.Errorf("constructed a versioned envelope for a peer that might only know the original one")
+	}
+}
+
+// A party configured for Ed25519 keys keeps exchanging messages with a party that only knows the original envelope,
+// until every peer is configured to support the versioned envelope.
+func Test_Ed25519SenderWithOriginalPeer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keytype")
+	if err != nil {
+		t.Fatalf("Could not create temp dir, error %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setKeyBase(dir)()
+
+	SetKeyRotationConfig(config.MessageKeyRotationConfig{IntervalH: 1, GraceS: 60})
+	defer SetKeyRotationConfig(config.MessageKeyRotationConfig{})
+	SetMessageEnvelopeConfig(config.MessageEnvelopeConfig{KeyType: config.MessageKeyType_ED25519})
+	defer SetMessageEnvelopeConfig(config.MessageEnvelopeConfig{})
+
+	oldPeer, _ := rsa.GenerateKey(rand.Reader, 2048)
+	message := []byte(`{"type":"proposal","protocol":"Basic"}`)
+
+	// The new party creates an RSA key, and the old party opens its messages and checks the signer against the
+	// published key.
+	pub, priv, err := GetKeys("")
+	if err != nil {
+		t.Fatalf("Could not generate key, error %v\n", err)
+	} else if _, ok := pub.(*rsa.PublicKey); !ok {
+		t.Fatalf("Expected an RSA key until every peer supports the versioned envelope, got %T", pub)
+	}
+	if wire, err := ConstructVersionedExchangeMessage(message, priv, &oldPeer.PublicKey); err != nil {
+		t.Fatalf("unable to construct message, error %v", err)
+	} else if msg, signer, err := deconstructExchangeMessageV1(wire, []*rsa.PrivateKey{oldPeer}); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("original code path unable to deconstruct message, error %v", err)
+	} else if signerBytes, _ := MarshalPublicKey(signer); !bytes.Equal(signerBytes, marshalOrFail(t, pub)) {
+		t.Errorf("signer %v is not the published key", signer)
+	}
+
+	// And the new party opens the replies of the old party.
+	if em, err := ConstructExchangeMessage(message, &oldPeer.PublicKey, oldPeer, pub.(*rsa.PublicKey)); err != nil {
+		t.Fatalf("unable to construct message, error %v", err)
+	} else if wire, err := json.Marshal(em); err != nil {
+		t.Fatalf("unable to marshal message, error %v", err)
+	} else if msg, _, err := DeconstructExchangeMessage(wire, priv); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("unable to deconstruct the reply of the original code path, error %v", err)
+	}
+
+	// A rotation keeps creating RSA keys.
+	if pub, err := RotateKeys(""); err != nil {
+		t.Fatalf("Could not rotate keys, error %v\n", err)
+	} else if _, ok := pub.(*rsa.PublicKey); !ok {
+		t.Errorf("Expected an RSA key after the rotation, got %T", pub)
+	}
+
+	if err := DeleteKeys(""); err != nil {
+		t.Errorf("Could not delete keys, error %v\n", err)
+	}
+}
+
+// A versioned envelope that was changed in transit must be rejected.
+func Test_EnvelopeTampered(t *testing.T) {
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	senderKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	message := []byte(`{"type":"proposal"}`)
+
+	em, err := constructExchangeMessageV2(message, senderKey, edPub)
+	if err != nil {
+		t.Fatalf("unable to construct message, error %v", err)
+	}
+
+	tampered := []func(m ExchangeMessageV2) ExchangeMessageV2{
+		func(m ExchangeMessageV2) ExchangeMessageV2 {
+			m.WrappedMessage = append([]byte{}, m.WrappedMessage...)
+			m.WrappedMessage[0] ^= 1
+			return m
+		},
+		func(m ExchangeMessageV2) ExchangeMessageV2 {
+			m.EncryptedKey = append([]byte{}, m.EncryptedKey...)
+			m.EncryptedKey[0] ^= 1
+			return m
+		},
+		func(m ExchangeMessageV2) ExchangeMessageV2 {
+			m.KeyExchange = KEY_EXCHANGE_RSA_OAEP
+			return m
+		},
+		func(m ExchangeMessageV2) ExchangeMessageV2 {
+			m.Version = 3
+			return m
+		},
+	}
+	for i, tamper := range tampered {
+		wire, _ := json.Marshal(tamper(*em))
+		if _, _, err := DeconstructExchangeMessage(wire, edKey); err == nil {
+			t.Errorf("tampered message %v was accepted", i)
+		}
+	}
+
+	wire, _ := json.Marshal(em)
+	if _, _, err := DeconstructExchangeMessage(wire, edKey); err != nil {
+		t.Errorf("unable to deconstruct message, error %v", err)
+	}
+}
+
+// A change of the key type takes effect at the next rotation, and the messages to the replaced RSA key are accepted
+// during the grace period.
+func Test_RotateKeyType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keytype")
+	if err != nil {
+		t.Fatalf("Could not create temp dir, error %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setKeyBase(dir)()
+
+	SetKeyRotationConfig(config.MessageKeyRotationConfig{IntervalH: 1, GraceS: 60})
+	defer SetKeyRotationConfig(config.MessageKeyRotationConfig{})
+	defer SetMessageEnvelopeConfig(config.MessageEnvelopeConfig{})
+
+	senderKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	message := []byte("proposal")
+
+	rsaPub, _, err := GetKeys("")
+	if err != nil {
+		t.Fatalf("Could not generate key, error %v\n", err)
+	} else if _, ok := rsaPub.(*rsa.PublicKey); !ok {
+		t.Fatalf("Expected an RSA key by default, got %T", rsaPub)
+	}
+	toRSAKey, _ := ConstructVersionedExchangeMessage(message, senderKey, rsaPub)
+
+	SetMessageEnvelopeConfig(config.MessageEnvelopeConfig{KeyType: config.MessageKeyType_ED25519, PeersSupportV2: true})
+	if pub, _, _ := GetKeys(""); pub != rsaPub {
+		t.Errorf("Key type changed before the rotation")
+	}
+
+	edPub, err := RotateKeys("")
+	if err != nil {
+		t.Fatalf("Could not rotate keys, error %v\n", err)
+	} else if _, ok := edPub.(ed25519.PublicKey); !ok {
+		t.Fatalf("Expected an Ed25519 key after the rotation, got %T", edPub)
+	}
+	toEdKey, _ := ConstructVersionedExchangeMessage(message, senderKey, edPub)
+
+	// The Ed25519 key is read back when anax restarts.
+	gPublicKey = nil
+	gPrivateKey = nil
+	gPreviousPrivateKey = nil
+	_, edKey, err := GetKeys("")
+	if err != nil {
+		t.Fatalf("Could not read keys, error %v\n", err)
+	} else if _, ok := edKey.(ed25519.PrivateKey); !ok {
+		t.Fatalf("Expected an Ed25519 key, got %T", edKey)
+	}
+
+	if msg, _, err := DeconstructExchangeMessage(toEdKey, edKey); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("Message to the Ed25519 key was not accepted, error %v\n", err)
+	} else if msg, _, err := DeconstructExchangeMessage(toRSAKey, edKey); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("Message to the replaced RSA key should be accepted during the grace period, error %v\n", err)
+	}
+
+	if err := DeleteKeys(""); err != nil {
+		t.Errorf("Could not delete keys, error %v\n", err)
+	}
+}
+
+func marshalOrFail(t *testing.T, key crypto.PublicKey) []byte {
+	b, err := MarshalPublicKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key, error %v", err)
+	}
+	return b
+}
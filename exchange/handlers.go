@@ -77,6 +77,15 @@ func GetHTTPExchangeVersionHandler(cfg *config.HorizonConfig) ExchangeVersionHan
 	}
 }
 
+// A handler for checking whether the exchange has a feature.
+type ExchangeFeatureHandler func(feature string) bool
+
+func GetHTTPExchangeFeatureHandler(ec ExchangeContext) ExchangeFeatureHandler {
+	return func(feature string) bool {
+		return ExchangeSupports(ec, feature)
+	}
+}
+
 // A handler for querying the exchange for an org when the caller doesnt have exchange identity at the time of creating the handler, but
 // can supply the exchange context when it's time to make the call. Only used by the API package when trying to register an edge device.
 type OrgHandlerWithContext func(org string, id string, token string) (*Organization, error)
@@ -418,6 +427,16 @@ func GetHTTPExchangeChangeHandler(ec ExchangeContext) ExchangeChangeHandler {
 	}
 }
 
+// A handler for retrieving changes from the exchange, which holds the request open for up to waitS seconds when there
+// are none.
+type ExchangeChangeWaitHandler func(changeId uint64, maxRecords int, waitS int) (*ExchangeChanges, error)
+
+func GetHTTPExchangeChangeWaitHandler(ec ExchangeContext) ExchangeChangeWaitHandler {
+	return func(changeId uint64, maxRecords int, waitS int) (*ExchangeChanges, error) {
+		return WaitForExchangeChanges(ec, changeId, maxRecords, waitS)
+	}
+}
+
 // A handler for retrieving current max change ID from the exchange.
 type ExchangeMaxChangeIDHandler func() (*ExchangeChangeIDResponse, error)
 
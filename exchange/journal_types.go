@@ -0,0 +1,15 @@
+package exchange
+
+import (
+	"github.com/open-horizon/anax/eventjournal"
+)
+
+// Register the exchange types that are passed between workers in the interface fields of events, so that the event
+// journal can decode them.
+func init() {
+	eventjournal.RegisterType(
+		ExchangeChange{},
+		ObjectDestinationPolicy{},
+		ObjectDestinationPolicies{},
+	)
+}
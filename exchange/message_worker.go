@@ -11,7 +11,6 @@ import (
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/worker"
 	"strconv"
-	"time"
 )
 
 type ExchangeMessageWorker struct {
@@ -167,8 +166,7 @@ func (w *ExchangeMessageWorker) getMessages() ([]DeviceMessage, error) {
 	var resp interface{}
 	resp = new(GetDeviceMessageResponse)
 
-	retryCount := w.GetHTTPFactory().RetryCount
-	retryInterval := w.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(w.GetHTTPFactory())
 
 	targetURL := w.GetExchangeURL() + "orgs/" + GetOrg(w.GetExchangeId()) + "/nodes/" + GetId(w.GetExchangeId()) + "/msgs"
 	for {
@@ -177,16 +175,10 @@ func (w *ExchangeMessageWorker) getMessages() ([]DeviceMessage, error) {
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(logString(tpErr.Error()))
-			if w.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", w.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(3).Infof(logString(fmt.Sprintf("retrieved %v messages", len(resp.(*GetDeviceMessageResponse).Messages))))
 			msgs := resp.(*GetDeviceMessageResponse).Messages
@@ -199,8 +191,7 @@ func (w *ExchangeMessageWorker) deleteMessage(msg *DeviceMessage) error {
 	var resp interface{}
 	resp = new(PostDeviceResponse)
 
-	retryCount := w.GetHTTPFactory().RetryCount
-	retryInterval := w.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(w.GetHTTPFactory())
 
 	targetURL := w.GetExchangeURL() + "orgs/" + GetOrg(w.GetExchangeId()) + "/nodes/" + GetId(w.GetExchangeId()) + "/msgs/" + strconv.Itoa(msg.MsgId)
 	for {
@@ -209,16 +200,10 @@ func (w *ExchangeMessageWorker) deleteMessage(msg *DeviceMessage) error {
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(logString(tpErr.Error()))
-			if w.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return fmt.Errorf("Exceeded %v retries for error: %v", w.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(3).Infof(logString(fmt.Sprintf("deleted message %v because it was not usable.", msg.MsgId)))
 			return nil
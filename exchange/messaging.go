@@ -1,9 +1,11 @@
 package exchange
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -18,6 +20,7 @@ import (
 	"os"
 	"path"
 	"sync"
+	"time"
 )
 
 // This module is used to construct a message that can be sent over an insecure transport
@@ -191,16 +194,65 @@ func ConstructExchangeMessage(message []byte, senderPublicKey *rsa.PublicKey, se
 // 3. use the symmetric key and nonce to decrypt the WrappedMessage
 // 4. verify the signature of the hash of the message
 // 5. extract the plain text message
+//
+// Messages in the versioned envelope, see ConstructVersionedExchangeMessage, are deconstructed by
+// deconstructExchangeMessageV2. The message is tried with the receiver's private key and with the
+// other key of a key rotation.
 
-func DeconstructExchangeMessage(encryptedMessage []byte, receiverPrivateKey *rsa.PrivateKey) ([]byte, *rsa.PublicKey, error) {
+func DeconstructExchangeMessage(encryptedMessage []byte, receiverPrivateKey crypto.PrivateKey) ([]byte, crypto.PublicKey, error) {
 
 	// Up front sanity checks
 	if len(encryptedMessage) == 0 {
 		return nil, nil, errors.New(fmt.Sprintf("Error message has length zero"))
-	} else if receiverPrivateKey == nil {
+	}
+	switch k := receiverPrivateKey.(type) {
+	case *rsa.PrivateKey:
+		if k == nil {
+			return nil, nil, errors.New(fmt.Sprintf("Error Private key is nil"))
+		} else if err := k.Validate(); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Error Private key is not valid"))
+		}
+	case ed25519.PrivateKey:
+		if len(k) != ed25519.PrivateKeySize {
+			return nil, nil, errors.New(fmt.Sprintf("Error Private key is not valid"))
+		}
+	case nil:
 		return nil, nil, errors.New(fmt.Sprintf("Error Private key is nil"))
-	} else if err := receiverPrivateKey.Validate(); err != nil {
-		return nil, nil, errors.New(fmt.Sprintf("Error Private key is not valid"))
+	default:
+		return nil, nil, errors.New(fmt.Sprintf("Error Private key type %T is not supported", receiverPrivateKey))
+	}
+
+	env := new(envelopeVersion)
+	if err := json.Unmarshal(encryptedMessage, &env); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Error unmarshalling exchange message %s, error %v", encryptedMessage, err))
+	}
+
+	receiverKeys := append([]crypto.PrivateKey{receiverPrivateKey}, alternateMessagingKeys(receiverPrivateKey)...)
+
+	switch env.Version {
+	case 0, EXCHANGE_MESSAGE_V1:
+		var rsaKeys []*rsa.PrivateKey
+		for _, key := range receiverKeys {
+			if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+				rsaKeys = append(rsaKeys, rsaKey)
+			}
+		}
+		if msg, pubKey, err := deconstructExchangeMessageV1(encryptedMessage, rsaKeys); err != nil {
+			return nil, nil, err
+		} else {
+			return msg, pubKey, nil
+		}
+	case EXCHANGE_MESSAGE_V2:
+		return deconstructExchangeMessageV2(encryptedMessage, receiverKeys)
+	default:
+		return nil, nil, errors.New(fmt.Sprintf("Error exchange message version %v is not supported", env.Version))
+	}
+}
+
+func deconstructExchangeMessageV1(encryptedMessage []byte, receiverPrivateKeys []*rsa.PrivateKey) ([]byte, *rsa.PublicKey, error) {
+
+	if len(receiverPrivateKeys) == 0 {
+		return nil, nil, errors.New(fmt.Sprintf("Error exchange message requires an RSA private key"))
 	}
 
 	err := error(nil)
@@ -227,8 +279,19 @@ func DeconstructExchangeMessage(encryptedMessage []byte, receiverPrivateKey *rsa
 	// What's the purpose of the label?
 	label := []byte("")
 	var receivedSymValues []byte
-	if receivedSymValues, err = rsa.DecryptOAEP(sha3.New256(), rand.Reader, receiverPrivateKey, em.SymmetricValues, label); err != nil {
-		return nil, nil, errors.New(fmt.Sprintf("Error decrypting Symmetric values from message, error %v", err))
+	if receivedSymValues, err = rsa.DecryptOAEP(sha3.New256(), rand.Reader, receiverPrivateKeys[0], em.SymmetricValues, label); err != nil {
+
+		// The message might have been encrypted to the key that was replaced by a rotation, or to the new key.
+		for _, otherKey := range receiverPrivateKeys[1:] {
+			if otherSymValues, otherErr := rsa.DecryptOAEP(sha3.New256(), rand.Reader, otherKey, em.SymmetricValues, label); otherErr == nil {
+				glog.V(3).Infof("Decrypted Symmetric values with the other messaging key of a key rotation")
+				receivedSymValues, err = otherSymValues, nil
+				break
+			}
+		}
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Error decrypting Symmetric values from message, error %v", err))
+		}
 	}
 
 	sv := new(SymmetricValues)
@@ -261,10 +324,12 @@ func DeconstructExchangeMessage(encryptedMessage []byte, receiverPrivateKey *rsa
 	// 4. verify the signature of the hash of the message
 
 	var receivedPubKey *rsa.PublicKey
-	if receivedPubKey, err = DemarshalPublicKey(wm.SignerPubKey); err != nil {
+	if pubKey, err := DemarshalPublicKey(wm.SignerPubKey); err != nil {
 		return nil, nil, errors.New(fmt.Sprintf("Error demarshalling sender public key, %v", err))
-	} else if receivedPubKey == nil {
-		return nil, nil, errors.New(fmt.Sprintf("Error demarshalling sender public key, returned public key is nil"))
+	} else if rsaKey, ok := pubKey.(*rsa.PublicKey); !ok {
+		return nil, nil, errors.New(fmt.Sprintf("Error demarshalling sender public key, returned public key is a %T, not an RSA key", pubKey))
+	} else {
+		receivedPubKey = rsaKey
 	}
 
 	//Verify Signature
@@ -281,33 +346,45 @@ func DeconstructExchangeMessage(encryptedMessage []byte, receiverPrivateKey *rsa
 	return wm.Msg, receivedPubKey, nil
 }
 
-// Helper function that uses the PKI X.509 library to serialize an RSA key.
-func MarshalPublicKey(key *rsa.PublicKey) ([]byte, error) {
+// Helper function that uses the PKI X.509 library to serialize an RSA or Ed25519 key.
+func MarshalPublicKey(key crypto.PublicKey) ([]byte, error) {
 
-	if key == nil {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k == nil {
+			return nil, errors.New(fmt.Sprintf("key must not be nil"))
+		}
+	case ed25519.PublicKey:
+		if len(k) != ed25519.PublicKeySize {
+			return nil, errors.New(fmt.Sprintf("key has length %v, must be %v", len(k), ed25519.PublicKeySize))
+		}
+	case nil:
 		return nil, errors.New(fmt.Sprintf("key must not be nil"))
-	} else if pubKey, err := x509.MarshalPKIXPublicKey(key); err != nil {
+	default:
+		return nil, errors.New(fmt.Sprintf("key type %T is not *rsa.PublicKey or ed25519.PublicKey", key))
+	}
+
+	if pubKey, err := x509.MarshalPKIXPublicKey(key); err != nil {
 		return nil, err
 	} else {
 		return pubKey, nil
 	}
 }
 
-// Helper function that uses the PKI X.509 library to deserialize an RSA key.
-func DemarshalPublicKey(serializedKey []byte) (*rsa.PublicKey, error) {
+// Helper function that uses the PKI X.509 library to deserialize an RSA or Ed25519 key. The type of the key that a
+// party publishes in the exchange decides which message envelope is used to send messages to it.
+func DemarshalPublicKey(serializedKey []byte) (crypto.PublicKey, error) {
 
-	var receivedPubKey *rsa.PublicKey
 	if receivedKey, err := x509.ParsePKIXPublicKey(serializedKey); err != nil {
 		return nil, err
 	} else {
 		switch receivedKey.(type) {
-		case *rsa.PublicKey:
-			receivedPubKey = receivedKey.(*rsa.PublicKey)
+		case *rsa.PublicKey, ed25519.PublicKey:
+			return receivedKey, nil
 		default:
-			return nil, errors.New(fmt.Sprintf("returned type %T is not *rsa.PublicKey", receivedKey))
+			return nil, errors.New(fmt.Sprintf("returned type %T is not *rsa.PublicKey or ed25519.PublicKey", receivedKey))
 		}
 	}
-	return receivedPubKey, nil
 }
 
 // Helper function to symmetrically encrypt a hunk of data using a given key and nonce with the
@@ -369,12 +446,18 @@ func symmetricallyDecrypt(data []byte, key []byte, nonce []byte) ([]byte, error)
 
 }
 
-// Get the public and private RSA keys being used by this runtime. If the keys dont exist in the
+// Get the public and private keys being used by this runtime. If the keys dont exist in the
 // filesystem, they will be created and written to the filesystem. If they already exist in the
-// filesystem then they will be demarshalled and returned to the caller.
+// filesystem then they will be demarshalled and returned to the caller. The keys are RSA or Ed25519
+// keys, see the MessageEnvelope config.
+
+var gPublicKey crypto.PublicKey
+var gPrivateKey crypto.PrivateKey
 
-var gPublicKey *rsa.PublicKey
-var gPrivateKey *rsa.PrivateKey
+// The private key that was replaced by the last rotation, and when it was replaced. Messages encrypted to it are
+// accepted until the grace period of the rotation config has passed.
+var gPreviousPrivateKey crypto.PrivateKey
+var gPreviousKeyRotated time.Time
 
 func HasKeys() bool {
 	if gPublicKey != nil {
@@ -385,118 +468,349 @@ func HasKeys() bool {
 
 var privFileName = "privateMessagingKey.pem"
 var pubFileName = "publicMessagingKey.pem"
+var prevPrivFileName = "previousPrivateMessagingKey.pem"
 
 var KeyLock sync.Mutex
 
-func GetKeys(keyPath string) (*rsa.PublicKey, *rsa.PrivateKey, error) {
+var keyRotationConfig = config.MessageKeyRotationConfig{}.WithDefaults()
+var envelopeConfig = config.MessageEnvelopeConfig{}.WithDefaults()
+
+// Set how often the keys are rotated and how long the replaced key is still accepted. Anax sets it from the
+// configuration when it starts, the defaults are used until then.
+func SetKeyRotationConfig(cfg config.MessageKeyRotationConfig) {
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+	keyRotationConfig = cfg.WithDefaults()
+}
+
+// Set the type of the keys that are created. Existing keys are used until they are rotated.
+func SetMessageEnvelopeConfig(cfg config.MessageEnvelopeConfig) {
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+	envelopeConfig = cfg.WithDefaults()
+}
+
+// Returns true if every peer is configured to open the versioned envelope.
+func peersSupportV2() bool {
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+	return envelopeConfig.PeersSupportV2
+}
+
+func GetKeys(keyPath string) (crypto.PublicKey, crypto.PrivateKey, error) {
 	KeyLock.Lock()
 	defer KeyLock.Unlock()
+	return getKeys(keyPath)
+}
+
+// The caller must hold the KeyLock.
+func getKeys(keyPath string) (crypto.PublicKey, crypto.PrivateKey, error) {
 
 	if gPublicKey != nil {
 		return gPublicKey, gPrivateKey, nil
 	}
 
-	snap_common := os.Getenv("HZN_VAR_BASE")
-	if len(snap_common) == 0 {
-		snap_common = config.HZN_VAR_BASE_DEFAULT
-	}
-
-	privFilepath := path.Join(snap_common, keyPath, privFileName)
-	pubFilepath := path.Join(snap_common, keyPath, pubFileName)
+	privFilepath := keyFilePath(keyPath, privFileName)
+	pubFilepath := keyFilePath(keyPath, pubFileName)
 	if _, ferr := os.Stat(privFilepath); os.IsNotExist(ferr) {
 
-		if privateKey, err := rsa.GenerateKey(rand.Reader, 2048); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Could not generate private key, error %v", err))
-		} else if privFile, err := os.Create(privFilepath); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Could not create private key file %v, error %v", privFilepath, err))
-		} else if err := privFile.Chmod(0600); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Could not chmod private key file %v, error %v", privFilepath, err))
-		} else if pubFile, err := os.Create(pubFilepath); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Could not create public key file %v, error %v", pubFilepath, err))
-		} else if err := pubFile.Chmod(0600); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Could not chmod public key file %v, error %v", pubFilepath, err))
+		if publicKey, privateKey, err := createKeys(privFilepath, pubFilepath, envelopeConfig.CreateKeyType()); err != nil {
+			return nil, nil, err
 		} else {
-			publicKey := &privateKey.PublicKey
-
-			if pubKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey); err != nil {
-				return nil, nil, errors.New(fmt.Sprintf("Could not marshal public key, error %v", err))
-			} else {
-				pubEnc := &pem.Block{
-					Type:    "PUBLIC KEY",
-					Headers: nil,
-					Bytes:   pubKeyBytes}
-				if err := pem.Encode(pubFile, pubEnc); err != nil {
-					return nil, nil, errors.New(fmt.Sprintf("Could not encode public key to file, error %v", err))
-				} else if err := pubFile.Close(); err != nil {
-					return nil, nil, errors.New(fmt.Sprintf("Could not close public key file %v, error %v", pubFilepath, err))
-				}
-			}
-
-			privEnc := &pem.Block{
-				Type:    "RSA PRIVATE KEY",
-				Headers: nil,
-				Bytes:   x509.MarshalPKCS1PrivateKey(privateKey)}
-			if err := pem.Encode(privFile, privEnc); err != nil {
-				return nil, nil, errors.New(fmt.Sprintf("Could not encode private key to file, error %v", err))
-			} else if err := privFile.Close(); err != nil {
-				return nil, nil, errors.New(fmt.Sprintf("Could not close private key file %v, error %v", privFilepath, err))
-			}
-
 			gPublicKey = publicKey
 			gPrivateKey = privateKey
 		}
 	} else {
 		if _, ferr := os.Stat(pubFilepath); os.IsNotExist(ferr) {
 			return nil, nil, errors.New(fmt.Sprintf("Could not find public key file %v, error %v", privFilepath, ferr))
-		} else if privFile, err := os.Open(privFilepath); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Unable to open private key file %v, error: %v", privFilepath, err))
-		} else if privBytes, err := ioutil.ReadAll(privFile); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Unable to read private key file %v, error: %v", privFilepath, err))
-		} else if privBlock, _ := pem.Decode(privBytes); privBlock == nil {
-			return nil, nil, errors.New(fmt.Sprintf("Unable to extract pem block from private key file %v, error: %v", privFilepath, err))
-		} else if privateKey, err := x509.ParsePKCS1PrivateKey(privBlock.Bytes); err != nil {
-			return nil, nil, errors.New(fmt.Sprintf("Unable to parse private key %x, error: %v", privBytes, err))
+		} else if privateKey, err := readPrivateKey(privFilepath); err != nil {
+			return nil, nil, err
 		} else if pubFile, err := os.Open(pubFilepath); err != nil {
 			return nil, nil, errors.New(fmt.Sprintf("Unable to open public key file %v, error: %v", pubFilepath, err))
 		} else if pubBytes, err := ioutil.ReadAll(pubFile); err != nil {
 			return nil, nil, errors.New(fmt.Sprintf("Unable to read public key file %v, error: %v", pubFilepath, err))
 		} else if pubBlock, _ := pem.Decode(pubBytes); pubBlock == nil {
 			return nil, nil, errors.New(fmt.Sprintf("Unable to extract pem block from public key file %v, error: %v", pubFilepath, err))
-		} else if publicKey, err := x509.ParsePKIXPublicKey(pubBlock.Bytes); err != nil {
+		} else if publicKey, err := DemarshalPublicKey(pubBlock.Bytes); err != nil {
 			return nil, nil, errors.New(fmt.Sprintf("Unable to parse public key %x, error: %v", pubBytes, err))
 		} else {
-			gPublicKey = publicKey.(*rsa.PublicKey)
+			gPublicKey = publicKey
 			gPrivateKey = privateKey
 		}
+
+		if keyType := messagingKeyType(gPrivateKey); keyType != envelopeConfig.CreateKeyType() {
+			glog.Infof(fmt.Sprintf("Using the existing %v messaging key, a %v key will be created when the key is rotated", keyType, envelopeConfig.CreateKeyType()))
+		}
+
+		// The key replaced by a rotation before anax restarted is still accepted for the rest of its grace period.
+		prevFilepath := keyFilePath(keyPath, prevPrivFileName)
+		if info, ferr := os.Stat(prevFilepath); ferr == nil {
+			if prevKey, err := readPrivateKey(prevFilepath); err != nil {
+				glog.Warningf(fmt.Sprintf("Ignoring the previous private key file %v, error: %v", prevFilepath, err))
+			} else {
+				gPreviousPrivateKey = prevKey
+				gPreviousKeyRotated = info.ModTime()
+			}
+		}
 	}
 
 	return gPublicKey, gPrivateKey, nil
 }
 
-func DeleteKeys(keyPath string) error {
-	// Construct the full file path name
+// Replace the keys with a new key pair, of the type in the MessageEnvelope config. The replaced private key is kept, so
+// that messages encrypted to it are still accepted during the grace period. Only the key replaced by the last rotation
+// is kept. The caller is responsible for publishing the new public key in the exchange.
+func RotateKeys(keyPath string) (crypto.PublicKey, error) {
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+
+	if _, _, err := getKeys(keyPath); err != nil {
+		return nil, err
+	}
+
+	privFilepath := keyFilePath(keyPath, privFileName)
+	pubFilepath := keyFilePath(keyPath, pubFileName)
+	prevFilepath := keyFilePath(keyPath, prevPrivFileName)
+
+	if err := os.Rename(privFilepath, prevFilepath); err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not move private key file %v to %v, error %v", privFilepath, prevFilepath, err))
+	}
+
+	// The modification time of the previous key file records when the rotation happened.
+	now := time.Now()
+	if err := os.Chtimes(prevFilepath, now, now); err != nil {
+		glog.Warningf(fmt.Sprintf("Could not set the time of the previous private key file %v, error: %v", prevFilepath, err))
+	}
+
+	publicKey, privateKey, err := createKeys(privFilepath, pubFilepath, envelopeConfig.CreateKeyType())
+	if err != nil {
+		// Put the old key back so that the keys on disk still match the public key in the exchange.
+		if rerr := os.Rename(prevFilepath, privFilepath); rerr != nil {
+			glog.Errorf(fmt.Sprintf("Could not restore private key file %v, error: %v", privFilepath, rerr))
+		}
+		return nil, err
+	}
+
+	gPreviousPrivateKey = gPrivateKey
+	gPreviousKeyRotated = now
+	gPublicKey = publicKey
+	gPrivateKey = privateKey
+
+	return gPublicKey, nil
+}
+
+// Returns true if the keys are rotated on a schedule and the current keys are older than the rotation interval. The
+// age of the keys is the age of the private key file, so that it is not reset when anax restarts.
+func KeysRotationDue(keyPath string) bool {
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+
+	if !keyRotationConfig.IsScheduled() {
+		return false
+	} else if info, err := os.Stat(keyFilePath(keyPath, privFileName)); err != nil {
+		return false
+	} else {
+		return time.Since(info.ModTime()) >= time.Duration(keyRotationConfig.IntervalH)*time.Hour
+	}
+}
+
+// Returns the public key that was replaced by the last rotation, or nil if the keys have not been rotated since anax
+// started or the replaced key is past its grace period.
+func GetPreviousPublicKey() crypto.PublicKey {
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+
+	if gPreviousPrivateKey == nil || time.Since(gPreviousKeyRotated) >= time.Duration(keyRotationConfig.GraceS)*time.Second {
+		return nil
+	}
+	return publicKeyOf(gPreviousPrivateKey)
+}
+
+// Returns true if the key, as it is registered in the exchange, is the public key that was replaced by the last
+// rotation, whether or not it is past its grace period.
+func IsReplacedPublicKey(key []byte) bool {
+	KeyLock.Lock()
+	prevKey := publicKeyOf(gPreviousPrivateKey)
+	KeyLock.Unlock()
+
+	if prevKey == nil {
+		return false
+	} else if b, err := MarshalPublicKey(prevKey); err != nil {
+		return false
+	} else {
+		return bytes.Equal(b, key)
+	}
+}
+
+// Returns the other private keys that a message to the receiver's key might have been encrypted to. When the receiver's
+// key is one of this runtime's keys, that is the current key and the key replaced by the last rotation, if it is still
+// in its grace period. Messages can be encrypted to the new key before the receiver sees the rotation, so both
+// directions are tried.
+func alternateMessagingKeys(receiverPrivateKey crypto.PrivateKey) []crypto.PrivateKey {
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+
+	if gPreviousPrivateKey == nil || time.Since(gPreviousKeyRotated) >= time.Duration(keyRotationConfig.GraceS)*time.Second {
+		return nil
+	} else if sameKey(receiverPrivateKey, gPrivateKey) {
+		return []crypto.PrivateKey{gPreviousPrivateKey}
+	} else if sameKey(receiverPrivateKey, gPreviousPrivateKey) {
+		return []crypto.PrivateKey{gPrivateKey}
+	}
+	return nil
+}
+
+// Returns true if both are the same private key. Ed25519 keys are byte slices, which cannot be compared as interfaces.
+func sameKey(a crypto.PrivateKey, b crypto.PrivateKey) bool {
+	switch ak := a.(type) {
+	case *rsa.PrivateKey:
+		bk, ok := b.(*rsa.PrivateKey)
+		return ok && ak == bk
+	case ed25519.PrivateKey:
+		bk, ok := b.(ed25519.PrivateKey)
+		return ok && bytes.Equal(ak, bk)
+	}
+	return false
+}
+
+func publicKeyOf(privateKey crypto.PrivateKey) crypto.PublicKey {
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case ed25519.PrivateKey:
+		return k.Public()
+	}
+	return nil
+}
+
+// Returns the config name of the type of the key.
+func messagingKeyType(key interface{}) string {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return config.MessageKeyType_RSA
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return config.MessageKeyType_ED25519
+	}
+	return fmt.Sprintf("%T", key)
+}
+
+func keyFilePath(keyPath string, fileName string) string {
 	snap_common := os.Getenv("HZN_VAR_BASE")
 	if len(snap_common) == 0 {
 		snap_common = config.HZN_VAR_BASE_DEFAULT
 	}
+	return path.Join(snap_common, keyPath, fileName)
+}
 
-	privFilepath := path.Join(snap_common, keyPath, privFileName)
-	pubFilepath := path.Join(snap_common, keyPath, pubFileName)
+// Generate a new key pair of the type and write it to the files.
+func createKeys(privFilepath string, pubFilepath string, keyType string) (crypto.PublicKey, crypto.PrivateKey, error) {
 
-	glog.V(5).Infof("Removing private key path %v, and public key path %v", privFilepath, pubFilepath)
+	var publicKey crypto.PublicKey
+	var privateKey crypto.PrivateKey
+	var privEnc *pem.Block
 
-	// Delete both the private and public key files
-	if _, ferr := os.Stat(privFilepath); !os.IsNotExist(ferr) {
-		if err := os.Remove(privFilepath); err != nil {
-			return err
+	switch keyType {
+	case config.MessageKeyType_ED25519:
+		if pub, priv, err := ed25519.GenerateKey(rand.Reader); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Could not generate private key, error %v", err))
+		} else if privBytes, err := x509.MarshalPKCS8PrivateKey(priv); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Could not marshal private key, error %v", err))
+		} else {
+			publicKey, privateKey = pub, priv
+			privEnc = &pem.Block{
+				Type:    "PRIVATE KEY",
+				Headers: nil,
+				Bytes:   privBytes}
+		}
+	default:
+		if priv, err := rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Could not generate private key, error %v", err))
+		} else {
+			publicKey, privateKey = &priv.PublicKey, priv
+			privEnc = &pem.Block{
+				Type:    "RSA PRIVATE KEY",
+				Headers: nil,
+				Bytes:   x509.MarshalPKCS1PrivateKey(priv)}
 		}
 	}
 
-	if _, ferr := os.Stat(pubFilepath); !os.IsNotExist(ferr) {
-		if err := os.Remove(pubFilepath); err != nil {
-			return err
+	if privFile, err := os.Create(privFilepath); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Could not create private key file %v, error %v", privFilepath, err))
+	} else if err := privFile.Chmod(0600); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Could not chmod private key file %v, error %v", privFilepath, err))
+	} else if pubFile, err := os.Create(pubFilepath); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Could not create public key file %v, error %v", pubFilepath, err))
+	} else if err := pubFile.Chmod(0600); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Could not chmod public key file %v, error %v", pubFilepath, err))
+	} else {
+
+		if pubKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Could not marshal public key, error %v", err))
+		} else {
+			pubEnc := &pem.Block{
+				Type:    "PUBLIC KEY",
+				Headers: nil,
+				Bytes:   pubKeyBytes}
+			if err := pem.Encode(pubFile, pubEnc); err != nil {
+				return nil, nil, errors.New(fmt.Sprintf("Could not encode public key to file, error %v", err))
+			} else if err := pubFile.Close(); err != nil {
+				return nil, nil, errors.New(fmt.Sprintf("Could not close public key file %v, error %v", pubFilepath, err))
+			}
+		}
+
+		if err := pem.Encode(privFile, privEnc); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Could not encode private key to file, error %v", err))
+		} else if err := privFile.Close(); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Could not close private key file %v, error %v", privFilepath, err))
 		}
+
+		return publicKey, privateKey, nil
+	}
+}
+
+// Read an RSA private key in PKCS1 form or an Ed25519 private key in PKCS8 form.
+func readPrivateKey(privFilepath string) (crypto.PrivateKey, error) {
+	if privFile, err := os.Open(privFilepath); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to open private key file %v, error: %v", privFilepath, err))
+	} else if privBytes, err := ioutil.ReadAll(privFile); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to read private key file %v, error: %v", privFilepath, err))
+	} else if privBlock, _ := pem.Decode(privBytes); privBlock == nil {
+		return nil, errors.New(fmt.Sprintf("Unable to extract pem block from private key file %v, error: %v", privFilepath, err))
+	} else if privBlock.Type == "RSA PRIVATE KEY" {
+		if privateKey, err := x509.ParsePKCS1PrivateKey(privBlock.Bytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("Unable to parse private key %x, error: %v", privBytes, err))
+		} else {
+			return privateKey, nil
+		}
+	} else if privateKey, err := x509.ParsePKCS8PrivateKey(privBlock.Bytes); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to parse private key %x, error: %v", privBytes, err))
+	} else if edKey, ok := privateKey.(ed25519.PrivateKey); !ok {
+		return nil, errors.New(fmt.Sprintf("Private key in %v is a %T, not an RSA or Ed25519 key", privFilepath, privateKey))
+	} else {
+		return edKey, nil
 	}
+}
+
+func DeleteKeys(keyPath string) error {
+	// Construct the full file path name
+	privFilepath := keyFilePath(keyPath, privFileName)
+	pubFilepath := keyFilePath(keyPath, pubFileName)
+	prevFilepath := keyFilePath(keyPath, prevPrivFileName)
+
+	glog.V(5).Infof("Removing private key path %v, public key path %v and previous private key path %v", privFilepath, pubFilepath, prevFilepath)
+
+	// Delete the private and public key files, and the key replaced by the last rotation
+	for _, filepath := range []string{privFilepath, pubFilepath, prevFilepath} {
+		if _, ferr := os.Stat(filepath); !os.IsNotExist(ferr) {
+			if err := os.Remove(filepath); err != nil {
+				return err
+			}
+		}
+	}
+
+	KeyLock.Lock()
+	defer KeyLock.Unlock()
+	gPreviousPrivateKey = nil
 
 	return nil
 }
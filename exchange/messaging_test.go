@@ -14,9 +14,12 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"github.com/open-horizon/anax/config"
 	"golang.org/x/crypto/sha3"
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestEncryptedMessagingExample(t *testing.T) {
@@ -1004,3 +1007,98 @@ func TestKeySaving_success1(t *testing.T) {
 	}
 
 }
+
+func TestKeyRotation(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "keyrotation")
+	if err != nil {
+		t.Fatalf("Could not create temp dir, error %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setKeyBase(dir)()
+
+	SetKeyRotationConfig(config.MessageKeyRotationConfig{IntervalH: 1, GraceS: 60})
+	defer SetKeyRotationConfig(config.MessageKeyRotationConfig{})
+
+	senderPrivateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	message := []byte("proposal")
+
+	oldPub, oldPriv, err := GetKeys("")
+	if err != nil {
+		t.Fatalf("Could not generate key, error %v\n", err)
+	} else if KeysRotationDue("") {
+		t.Errorf("New keys should not be due for rotation")
+	}
+	toOldKeyBytes, _ := ConstructVersionedExchangeMessage(message, senderPrivateKey, oldPub)
+
+	newPub, err := RotateKeys("")
+	if err != nil {
+		t.Fatalf("Could not rotate keys, error %v\n", err)
+	} else if _, newPriv, _ := GetKeys(""); newPriv == oldPriv || newPub == oldPub {
+		t.Errorf("Keys were not replaced by the rotation")
+	} else if msg, _, err := DeconstructExchangeMessage(toOldKeyBytes, newPriv); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("Message to the previous key should be accepted during the grace period, error %v\n", err)
+	}
+
+	// A receiver that read the key before the rotation can decrypt a message to the new key.
+	toNewKeyBytes, _ := ConstructVersionedExchangeMessage(message, senderPrivateKey, newPub)
+	if msg, _, err := DeconstructExchangeMessage(toNewKeyBytes, oldPriv); err != nil || !bytes.Equal(msg, message) {
+		t.Errorf("Message to the new key should be accepted with the previous key, error %v\n", err)
+	}
+
+	// The previous key is loaded again when anax restarts.
+	gPublicKey = nil
+	gPrivateKey = nil
+	gPreviousPrivateKey = nil
+	if _, newPriv, err := GetKeys(""); err != nil {
+		t.Errorf("Could not read keys, error %v\n", err)
+	} else if prevPub, ok := GetPreviousPublicKey().(*rsa.PublicKey); !ok || prevPub.N.Cmp(oldPub.(*rsa.PublicKey).N) != 0 {
+		t.Errorf("Previous key was not loaded, got %v\n", GetPreviousPublicKey())
+	} else if _, _, err := DeconstructExchangeMessage(toOldKeyBytes, newPriv); err != nil {
+		t.Errorf("Message to the previous key should be accepted after a restart, error %v\n", err)
+	}
+
+	// After the grace period, the previous key is no longer used.
+	gPreviousKeyRotated = time.Now().Add(-2 * time.Minute)
+	if _, newPriv, _ := GetKeys(""); GetPreviousPublicKey() != nil {
+		t.Errorf("Previous key should have expired")
+	} else if _, _, err := DeconstructExchangeMessage(toOldKeyBytes, newPriv); err == nil {
+		t.Errorf("Message to the previous key should not be accepted after the grace period")
+	}
+
+	// The agbot registers its new key for as long as the exchange holds the previous one.
+	if oldKeyBytes, err := MarshalPublicKey(oldPub); err != nil {
+		t.Errorf("Could not marshal the previous key, error %v\n", err)
+	} else if !IsReplacedPublicKey(oldKeyBytes) {
+		t.Errorf("Previous key should still be known as replaced after the grace period")
+	} else if newKeyBytes, _ := MarshalPublicKey(newPub); IsReplacedPublicKey(newKeyBytes) {
+		t.Errorf("Current key should not be known as replaced")
+	}
+
+	if err := DeleteKeys(""); err != nil {
+		t.Errorf("Could not delete keys, error %v\n", err)
+	} else if _, err := os.Stat(keyFilePath("", prevPrivFileName)); !os.IsNotExist(err) {
+		t.Errorf("Previous key file was not deleted")
+	}
+}
+
+// Uses the directory for the message keys of a test, with no keys loaded. Returns a function that restores
+// HZN_VAR_BASE and unloads the keys of the test.
+func setKeyBase(dir string) func() {
+	prev, set := os.LookupEnv("HZN_VAR_BASE")
+	_ = os.Setenv("HZN_VAR_BASE", dir)
+	gPublicKey = nil
+	gPrivateKey = nil
+	gPreviousPrivateKey = nil
+
+	return func() {
+		if set {
+			_ = os.Setenv("HZN_VAR_BASE", prev)
+		} else {
+			_ = os.Unsetenv("HZN_VAR_BASE")
+		}
+		gPublicKey = nil
+		gPrivateKey = nil
+		gPreviousPrivateKey = nil
+	}
+}
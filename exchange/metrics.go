@@ -0,0 +1,54 @@
+package exchange
+
+import (
+	"github.com/open-horizon/anax/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var exchangeRequests = metrics.NewCounterVec("anax_exchange_requests_total", "The number of requests sent to the exchange, by HTTP status code. The code is error when the request could not be sent.", "method", "resource", "code")
+var exchangeRequestDuration = metrics.NewHistogramVec("anax_exchange_request_duration_seconds", "The time taken by requests sent to the exchange.", nil, "method", "resource")
+
+// Returns the kind of exchange resource in the URL path, so that the metrics do not have a series for every
+// org and resource id. For example /v1/orgs/myorg/nodes/mynode/agreements is nodes and /v1/admin/version is admin.
+func metricsResource(urlPath string) string {
+	parts := make([]string, 0, 10)
+	for _, p := range strings.Split(urlPath, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	for ix, p := range parts {
+		if p == "orgs" {
+			if ix+2 < len(parts) {
+				return parts[ix+2]
+			}
+			return p
+		}
+	}
+
+	for ix, p := range parts {
+		if p == "v1" && ix+1 < len(parts) {
+			return parts[ix+1]
+		}
+	}
+
+	if len(parts) != 0 {
+		return parts[0]
+	}
+	return "unknown"
+}
+
+// Record the outcome of a request sent to the exchange.
+func recordExchangeRequest(method string, urlPath string, httpResp *http.Response, err error, start time.Time) {
+	resource := metricsResource(urlPath)
+	code := "error"
+	if err == nil && httpResp != nil {
+		code = strconv.Itoa(httpResp.StatusCode)
+	}
+	exchangeRequests.Inc(method, resource, code)
+	exchangeRequestDuration.Observe(time.Since(start).Seconds(), method, resource)
+}
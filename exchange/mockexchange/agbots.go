@@ -0,0 +1,177 @@
+package mockexchange
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"net/http"
+)
+
+// An agbot and the resources that belong to it.
+type agbot struct {
+	exchange.Agbot
+	token      string
+	patterns   map[string]exchange.ServedPattern
+	policies   map[string]exchange.ServedBusinessPolicy
+	agreements map[string]exchange.AgbotAgreement
+	messages   []message
+}
+
+func newAgbot(token string) *agbot {
+	return &agbot{
+		token:      token,
+		patterns:   map[string]exchange.ServedPattern{},
+		policies:   map[string]exchange.ServedBusinessPolicy{},
+		agreements: map[string]exchange.AgbotAgreement{},
+	}
+}
+
+// Route the requests for orgs/<org>/agbots.
+func (s *Server) serveAgbots(w http.ResponseWriter, req *request, org string) {
+	if len(req.parts) < 4 {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	id := org + "/" + req.parts[3]
+	a, ok := s.agbots[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("agbot %v not found", id))
+		return
+	}
+
+	if len(req.parts) == 4 {
+		switch req.Method {
+		case http.MethodGet:
+			ag := a.Agbot
+			ag.Token = ""
+			writeJSON(w, http.StatusOK, exchange.GetAgbotsResponse{Agbots: map[string]exchange.Agbot{id: ag}})
+		case http.MethodPatch:
+			var patch exchange.PatchAgbotPublicKey
+			if !decodeBody(w, req, &patch) {
+				return
+			}
+			a.PublicKey = patch.PublicKey
+			s.recordChange(org, exchange.RESOURCE_AGBOT, req.parts[3], exchange.CHANGE_OPERATION_MODIFIED)
+			writeOk(w, fmt.Sprintf("agbot %v updated", id))
+		default:
+			writeMethodNotAllowed(w, req)
+		}
+		return
+	}
+
+	switch req.parts[4] {
+	case "heartbeat":
+		if req.Method != http.MethodPost {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		a.LastHeartbeat = cutil.FormattedUTCTime()
+		writeOk(w, "heartbeat successful")
+	case "patterns":
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, exchange.GetAgbotsPatternsResponse{Patterns: a.patterns})
+	case "businesspols":
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, exchange.GetAgbotsBusinessPolsResponse{BusinessPols: a.policies})
+	case "agreements":
+		s.serveAgbotAgreements(w, req, id, a)
+	case "msgs":
+		s.serveAgbotMessages(w, req, id, a)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown agbot resource %v", req.parts[4]))
+	}
+}
+
+func (s *Server) serveAgbotAgreements(w http.ResponseWriter, req *request, id string, a *agbot) {
+	if len(req.parts) == 5 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, exchange.AllAgbotAgreementsResponse{Agreements: a.agreements})
+		return
+	}
+
+	agId := req.parts[5]
+	ag, exists := a.agreements[agId]
+
+	switch req.Method {
+	case http.MethodGet:
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("agreement %v not found on agbot %v", agId, id))
+		} else {
+			writeJSON(w, http.StatusOK, exchange.AllAgbotAgreementsResponse{Agreements: map[string]exchange.AgbotAgreement{agId: ag}})
+		}
+
+	case http.MethodPut:
+		var state exchange.PutAgbotAgreementState
+		if !decodeBody(w, req, &state) {
+			return
+		}
+		a.agreements[agId] = exchange.AgbotAgreement{Service: state.Service, State: state.State, LastUpdated: cutil.FormattedUTCTime()}
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_AGREEMENTS, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+		writeOk(w, fmt.Sprintf("agreement %v of agbot %v added or updated", agId, id))
+
+	case http.MethodDelete:
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("agreement %v not found on agbot %v", agId, id))
+			return
+		}
+		delete(a.agreements, agId)
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_AGREEMENTS, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+// Nodes send messages to an agbot, and the agbot reads and deletes them.
+func (s *Server) serveAgbotMessages(w http.ResponseWriter, req *request, id string, a *agbot) {
+	if len(req.parts) == 5 {
+		switch req.Method {
+		case http.MethodGet:
+			a.messages = unexpired(a.messages)
+			msgs := make([]exchange.AgbotMessage, 0, len(a.messages))
+			for _, m := range a.messages {
+				msgs = append(msgs, exchange.AgbotMessage{MsgId: m.id, DeviceId: m.from, DevicePubKey: m.pubKey, Message: m.body, TimeSent: m.sent, TimeExpires: m.expires.UTC().Format(cutil.ExchangeTimeFormat)})
+			}
+			writeJSON(w, http.StatusOK, exchange.GetAgbotMessageResponse{Messages: msgs})
+
+		case http.MethodPost:
+			n, ok := s.nodes[req.caller]
+			if !ok {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("only a node can send a message to agbot %v", id))
+				return
+			}
+			if m, ok := s.newMessage(w, req, n.publicKey()); ok {
+				a.messages = append(a.messages, m)
+				s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_MSG, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED)
+				writeOk(w, fmt.Sprintf("message %v sent to agbot %v", m.id, id))
+			}
+
+		default:
+			writeMethodNotAllowed(w, req)
+		}
+		return
+	}
+
+	if req.Method != http.MethodDelete {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	var deleted bool
+	a.messages, deleted = deleteMessage(a.messages, req.parts[5])
+	if !deleted {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("message %v not found for agbot %v", req.parts[5], id))
+		return
+	}
+	writeDeleted(w)
+}
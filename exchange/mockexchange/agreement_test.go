@@ -0,0 +1,161 @@
+// +build unit
+
+package mockexchange
+
+import (
+	"github.com/open-horizon/anax/agreement"
+	"github.com/open-horizon/anax/agreementbot"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/changes"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	_ "github.com/open-horizon/anax/externalpolicy/text_language"
+	"github.com/open-horizon/anax/governance"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/rsapss-tool/generatekeys"
+	"github.com/open-horizon/rsapss-tool/sign"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Run the agreement workers of a node and an agbot against the server, and verify that they make an agreement for the
+// deployment policy that the agbot serves, and record it in the exchange.
+func Test_Agreement(t *testing.T) {
+	keyDir, err := ioutil.TempDir("", "mockexchange-keys-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(keyDir)
+	defer setKeyBase(keyDir)()
+
+	exchange.ClearAllResourceCache()
+	defer exchange.ClearAllResourceCache()
+
+	// The node verifies the signature of the deployment of the service with the public key.
+	keyFiles, err := generatekeys.Write(keyDir, 2048, "mockexchange", "myorg", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var privateKey, publicKey string
+	for _, f := range keyFiles {
+		if strings.HasSuffix(f, ".pem") {
+			publicKey = f
+		} else {
+			privateKey = f
+		}
+	}
+	deployment := `{"services":{"myservice":{"image":"myimage:1.0.0"}}}`
+	signature, err := sign.Input(privateKey, []byte(deployment))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer()
+	defer s.Close()
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+	s.AddService("myorg", exchange.ServiceDefinition{URL: "myservice", Version: "1.0.0", Arch: "amd64", Sharable: exchange.MS_SHARING_MODE_MULTIPLE, Deployment: deployment, DeploymentSignature: signature})
+	s.AddBusinessPolicy("myorg/mypolicy", exchange.ExchangeBusinessPolicy{BusinessPolicy: businesspolicy.BusinessPolicy{
+		Service: businesspolicy.ServiceRef{
+			Name:            "myservice",
+			Org:             "myorg",
+			Arch:            "amd64",
+			ServiceVersions: []businesspolicy.WorkloadChoice{{Version: "1.0.0"}},
+		},
+		Constraints: externalpolicy.ConstraintExpression{"purpose == test"},
+	}})
+
+	nodeId := "myorg/node1"
+	n, err := s.NewNode(nodeId, "nodetoken", exchange.Device{Name: "node1", Arch: "amd64", NodeType: persistence.DEVICE_TYPE_DEVICE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	n.Config.Collaborators.KeyFileNamesFetcher = &config.KeyFileNamesFetcher{
+		GetKeyFileNames: func(publicKeyPath, userKeyPath string) ([]string, error) { return []string{publicKey}, nil },
+	}
+	nodePol := exchange.ExchangePolicy{ExternalPolicy: externalpolicy.ExternalPolicy{
+		Properties: externalpolicy.PropertyList{{Name: "purpose", Value: "test"}},
+	}}
+	if err := s.SetNodePolicy(nodeId, nodePol); err != nil {
+		t.Fatal(err)
+	}
+
+	agbotId := "myorg/agbot1"
+	a, err := s.NewAgbot(agbotId, "agbottoken", exchange.Agbot{Name: "agbot1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if err := s.ServeBusinessPolicy(agbotId, "myorg", "mypolicy", "myorg"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The node reads the proposal when its changes worker sees a message for it, and replies from the agreement worker.
+	// The governance worker records the agreement in the exchange. The node publishes its message key when the
+	// registration is complete, as the API tells it.
+	if err := os.MkdirAll(n.Config.Edge.PolicyPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	pm, err := policy.Initialize(n.Config.Edge.PolicyPath, n.Config.ArchSynonyms, nil, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw := agreement.NewAgreementWorker("Agreement", n.Config, n.DB, pm)
+	n.Watch(&aw.BaseWorker)
+	n.Connect(aw)
+	gw := governance.NewGovernanceWorker("Governance", n.Config, n.DB, pm)
+	n.Watch(&gw.BaseWorker)
+	n.Connect(gw)
+	mw := exchange.NewExchangeMessageWorker("ExchangeMessages", n.Config, n.DB)
+	n.Watch(&mw.BaseWorker)
+	n.Connect(mw)
+	ncw := changes.NewChangesWorker("ExchangeChanges", n.Config, n.DB)
+	n.Watch(&ncw.BaseWorker)
+	n.Connect(ncw)
+	aw.NewEvent(events.NewEdgeConfigCompleteMessage(events.NEW_DEVICE_CONFIG_COMPLETE))
+
+	// The agbot searches for the node again when its changes worker sees that the node has changed.
+	abw := agreementbot.NewAgreementBotWorker("AgBot", a.Config, a.DB)
+	a.Watch(&abw.BaseWorker)
+	a.Connect(abw)
+	cw := agreementbot.NewChangesWorker("AgBot ExchangeChanges", a.Config)
+	a.Watch(&cw.BaseWorker)
+	a.Connect(cw)
+
+	deadline := time.Now().Add(60 * time.Second)
+	for len(s.NodeAgreements(nodeId)) == 0 || len(s.AgbotAgreements(agbotId)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no agreement, the node has %v and the agbot has %v", s.NodeAgreements(nodeId), s.AgbotAgreements(agbotId))
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	for agId, nodeAg := range s.NodeAgreements(nodeId) {
+		if agbotAg, ok := s.AgbotAgreements(agbotId)[agId]; !ok {
+			t.Errorf("the agbot does not have the agreement %v of the node", agId)
+		} else if agbotAg.Service.URL != "myservice" || nodeAg.AgreementService.URL != "myorg/myservice" {
+			t.Errorf("wrong agreement %v, node %v, agbot %v", agId, nodeAg, agbotAg)
+		}
+	}
+}
+
+// Keep the message keys in the directory, and return a function that restores the key location.
+func setKeyBase(dir string) func() {
+	prev, set := os.LookupEnv("HZN_VAR_BASE")
+	_ = os.Setenv("HZN_VAR_BASE", dir)
+
+	return func() {
+		_ = exchange.DeleteKeys("")
+		if set {
+			_ = os.Setenv("HZN_VAR_BASE", prev)
+		} else {
+			_ = os.Unsetenv("HZN_VAR_BASE")
+		}
+	}
+}
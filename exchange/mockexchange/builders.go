@@ -0,0 +1,302 @@
+package mockexchange
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
+)
+
+// The functions in this file set up the state of the server before, or while, a test runs. The ids of the resources
+// are in the form org/id, as in anax. Each change is recorded, as if it had been made through the exchange API, so
+// that the nodes and agbots under test see it in the changes API.
+
+// AddOrg adds an org, or replaces it if it exists. Like the real exchange, the org has heartbeat intervals, which are
+// zero unless they are set.
+func (s *Server) AddOrg(org string, o exchange.Organization) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if o.HeartbeatIntv == nil {
+		o.HeartbeatIntv = &exchange.HeartbeatIntervals{}
+	}
+
+	operation := exchange.CHANGE_OPERATION_CREATED
+	if _, ok := s.orgs[org]; ok {
+		operation = exchange.CHANGE_OPERATION_MODIFIED
+	}
+	o.LastUpdated = cutil.FormattedUTCTime()
+	s.orgs[org] = &o
+	s.recordChange(org, exchange.RESOURCE_ORG, org, operation)
+}
+
+// AddUser adds a user that can call the server with the password.
+func (s *Server) AddUser(id string, password string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.users[id] = password
+}
+
+// AddNode adds a node with the token as its credentials. The node is as it would be after it was registered, its
+// public key is in base64 as the exchange keeps it.
+func (s *Server) AddNode(id string, token string, dev exchange.Device) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n := newNode(token)
+	n.Device = dev
+	n.Token = ""
+	n.LastUpdated = cutil.FormattedUTCTime()
+	s.nodes[id] = n
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED)
+}
+
+// SetNodePolicy sets the policy of a node that has been added.
+func (s *Server) SetNodePolicy(id string, pol exchange.ExchangePolicy) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n, ok := s.nodes[id]
+	if !ok {
+		return fmt.Errorf("node %v not found", id)
+	}
+	pol.LastUpdated = cutil.FormattedUTCTime()
+	n.policy = &pol
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_POLICY, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+	return nil
+}
+
+// AddAgbot adds an agbot with the token as its credentials.
+func (s *Server) AddAgbot(id string, token string, ag exchange.Agbot) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	a := newAgbot(token)
+	a.Agbot = ag
+	a.Token = ""
+	s.agbots[id] = a
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED)
+}
+
+// ServePattern makes an agbot serve the pattern, or all the patterns of the pattern org if it is "*", to the nodes of
+// the node org.
+func (s *Server) ServePattern(agbotId string, patternOrg string, pattern string, nodeOrg string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	a, ok := s.agbots[agbotId]
+	if !ok {
+		return fmt.Errorf("agbot %v not found", agbotId)
+	}
+	key := fmt.Sprintf("%v_%v_%v", patternOrg, pattern, nodeOrg)
+	a.patterns[key] = exchange.ServedPattern{PatternOrg: patternOrg, Pattern: pattern, NodeOrg: nodeOrg, LastUpdated: cutil.FormattedUTCTime()}
+	s.recordChange(exchange.GetOrg(agbotId), exchange.RESOURCE_AGBOT_SERVED_PATTERN, exchange.GetId(agbotId), exchange.CHANGE_OPERATION_CREATED)
+	return nil
+}
+
+// ServeBusinessPolicy makes an agbot serve the deployment policy, or all the deployment policies of the policy org if
+// it is "*", to the nodes of the node org.
+func (s *Server) ServeBusinessPolicy(agbotId string, policyOrg string, policy string, nodeOrg string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	a, ok := s.agbots[agbotId]
+	if !ok {
+		return fmt.Errorf("agbot %v not found", agbotId)
+	}
+	key := fmt.Sprintf("%v_%v_%v", policyOrg, policy, nodeOrg)
+	a.policies[key] = exchange.ServedBusinessPolicy{BusinessPolOrg: policyOrg, BusinessPol: policy, NodeOrg: nodeOrg, LastUpdated: cutil.FormattedUTCTime()}
+	s.recordChange(exchange.GetOrg(agbotId), exchange.RESOURCE_AGBOT_SERVED_POLICY, exchange.GetId(agbotId), exchange.CHANGE_OPERATION_CREATED)
+	return nil
+}
+
+// AddService adds a service definition to the org, and returns its id in the form org/id.
+func (s *Server) AddService(org string, svc exchange.ServiceDefinition) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sid := cutil.FormExchangeIdForService(svc.URL, svc.Version, svc.Arch)
+	id := org + "/" + sid
+	operation := exchange.CHANGE_OPERATION_CREATED
+	if old, ok := s.services[id]; ok {
+		operation = exchange.CHANGE_OPERATION_MODIFIED
+		old.ServiceDefinition = svc
+	} else {
+		s.services[id] = &service{ServiceDefinition: svc, keys: map[string]string{}}
+	}
+	s.services[id].LastUpdated = cutil.FormattedUTCTime()
+	s.recordChange(org, exchange.RESOURCE_SERVICE, sid, operation)
+	return id
+}
+
+// SetServicePolicy sets the policy of a service that has been added.
+func (s *Server) SetServicePolicy(id string, pol exchange.ExchangePolicy) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	svc, ok := s.services[id]
+	if !ok {
+		return fmt.Errorf("service %v not found", id)
+	}
+	pol.LastUpdated = cutil.FormattedUTCTime()
+	svc.policy = &pol
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_SERVICE_POLICY, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+	return nil
+}
+
+// AddServiceKey adds a signing key, the content of a PEM file, to a service that has been added.
+func (s *Server) AddServiceKey(id string, name string, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	svc, ok := s.services[id]
+	if !ok {
+		return fmt.Errorf("service %v not found", id)
+	}
+	svc.keys[name] = key
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_SERVICE, exchange.GetId(id), exchange.CHANGE_OPERATION_MODIFIED)
+	return nil
+}
+
+// AddDockerAuth adds the credentials of a docker registry to a service that has been added.
+func (s *Server) AddDockerAuth(id string, auth exchange.ImageDockerAuth) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	svc, ok := s.services[id]
+	if !ok {
+		return fmt.Errorf("service %v not found", id)
+	}
+	auth.DockAuthId = len(svc.dockAuths) + 1
+	auth.LastUpdated = cutil.FormattedUTCTime()
+	svc.dockAuths = append(svc.dockAuths, auth)
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_SERVICE, exchange.GetId(id), exchange.CHANGE_OPERATION_MODIFIED)
+	return nil
+}
+
+// AddPattern adds a pattern, or replaces it if it exists.
+func (s *Server) AddPattern(id string, pat exchange.Pattern) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	operation := exchange.CHANGE_OPERATION_CREATED
+	if old, ok := s.patterns[id]; ok {
+		operation = exchange.CHANGE_OPERATION_MODIFIED
+		old.Pattern = pat
+	} else {
+		s.patterns[id] = &pattern{Pattern: pat, keys: map[string]string{}}
+	}
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_PATTERN, exchange.GetId(id), operation)
+}
+
+// AddPatternKey adds a signing key, the content of a PEM file, to a pattern that has been added.
+func (s *Server) AddPatternKey(id string, name string, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	pat, ok := s.patterns[id]
+	if !ok {
+		return fmt.Errorf("pattern %v not found", id)
+	}
+	pat.keys[name] = key
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_PATTERN, exchange.GetId(id), exchange.CHANGE_OPERATION_MODIFIED)
+	return nil
+}
+
+// AddBusinessPolicy adds a deployment policy, or replaces it if it exists.
+func (s *Server) AddBusinessPolicy(id string, pol exchange.ExchangeBusinessPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	operation := exchange.CHANGE_OPERATION_CREATED
+	pol.Created = cutil.FormattedUTCTime()
+	if old, ok := s.policies[id]; ok {
+		operation = exchange.CHANGE_OPERATION_MODIFIED
+		pol.Created = old.Created
+	}
+	pol.LastUpdated = cutil.FormattedUTCTime()
+	s.policies[id] = &pol
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_POLICY, exchange.GetId(id), operation)
+}
+
+// DeleteBusinessPolicy deletes a deployment policy, as a user would while the agbot is running.
+func (s *Server) DeleteBusinessPolicy(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.policies[id]; !ok {
+		return fmt.Errorf("deployment policy %v not found", id)
+	}
+	delete(s.policies, id)
+	delete(s.sessions, id)
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_POLICY, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+	return nil
+}
+
+// Node returns a node as the exchange would return it, and false if it does not exist.
+func (s *Server) Node(id string) (exchange.Device, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if n, ok := s.nodes[id]; ok {
+		return n.get(), true
+	}
+	return exchange.Device{}, false
+}
+
+// NodeAgreements returns the agreements that a node has recorded in the exchange.
+func (s *Server) NodeAgreements(id string) map[string]exchange.DeviceAgreement {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ags := map[string]exchange.DeviceAgreement{}
+	if n, ok := s.nodes[id]; ok {
+		for agId, ag := range n.agreements {
+			ags[agId] = ag
+		}
+	}
+	return ags
+}
+
+// AgbotAgreements returns the agreements that an agbot has recorded in the exchange.
+func (s *Server) AgbotAgreements(id string) map[string]exchange.AgbotAgreement {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ags := map[string]exchange.AgbotAgreement{}
+	if a, ok := s.agbots[id]; ok {
+		for agId, ag := range a.agreements {
+			ags[agId] = ag
+		}
+	}
+	return ags
+}
+
+// NodeStatus returns the status that a node has put in the exchange, or nil if there is none.
+func (s *Server) NodeStatus(id string) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if n, ok := s.nodes[id]; ok && n.status != nil {
+		return append([]byte{}, n.status...)
+	}
+	return nil
+}
+
+// SurfaceErrors returns the errors that a node has surfaced in the exchange, or nil if there are none.
+func (s *Server) SurfaceErrors(id string) []persistence.SurfaceError {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if n, ok := s.nodes[id]; ok && n.errors != nil {
+		return append([]persistence.SurfaceError{}, n.errors.ErrorList...)
+	}
+	return nil
+}
+
+// Changes returns all the changes that have been recorded, in order.
+func (s *Server) Changes() []exchange.ExchangeChange {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]exchange.ExchangeChange{}, s.changes...)
+}
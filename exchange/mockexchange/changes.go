@@ -0,0 +1,105 @@
+package mockexchange
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// An exchange older than the max change ID feature does not have its path.
+func (s *Server) serveMaxChangeId(w http.ResponseWriter, req *request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	} else if !s.hasFeature(exchange.FEATURE_MAX_CHANGE_ID) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown path %v", strings.Join(req.parts, "/")))
+		return
+	}
+	writeJSON(w, http.StatusOK, exchange.ExchangeChangeIDResponse{MaxChangeID: s.changeId})
+}
+
+// Return the changes since the change id in the request, that the caller is allowed to see. Like the real exchange,
+// reading the changes counts as a heartbeat of the node or agbot that reads them. When there are no changes and the
+// request has a wait time, the request is held open until there is a change the caller can see, or the time is up.
+func (s *Server) serveChanges(w http.ResponseWriter, req *request) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	var get exchange.GetExchangeChangesRequest
+	if !decodeBody(w, req, &get) {
+		return
+	}
+
+	if n, ok := s.nodes[req.caller]; ok {
+		n.LastHeartbeat = cutil.FormattedUTCTime()
+	} else if a, ok := s.agbots[req.caller]; ok {
+		a.LastHeartbeat = cutil.FormattedUTCTime()
+	}
+
+	deadline := time.Now().Add(time.Duration(get.WaitS) * time.Second)
+	resp := s.changesSince(get, req.caller)
+	for len(resp.Changes) == 0 && time.Now().Before(deadline) {
+		s.waitForChange(deadline)
+		resp = s.changesSince(get, req.caller)
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// Returns the changes that the request asks for. The caller holds the lock.
+func (s *Server) changesSince(get exchange.GetExchangeChangesRequest, caller string) exchange.ExchangeChanges {
+	resp := exchange.ExchangeChanges{Changes: []exchange.ExchangeChange{}, ExchangeVersion: s.version}
+	for _, change := range s.changes {
+		if change.ResourceChanges[0].ChangeID < get.ChangeId {
+			continue
+		} else if len(get.Orgs) != 0 && !cutil.SliceContains(get.Orgs, change.OrgID) {
+			continue
+		} else if !s.visibleTo(change, caller) {
+			continue
+		}
+		resp.Changes = append(resp.Changes, change)
+		if get.MaxRecords > 0 && len(resp.Changes) == get.MaxRecords {
+			break
+		}
+	}
+
+	if len(resp.Changes) == 0 {
+		resp.MostRecentChangeID = s.changeId
+	} else {
+		resp.MostRecentChangeID = resp.Changes[len(resp.Changes)-1].ResourceChanges[0].ChangeID
+	}
+	return resp
+}
+
+// Wait until a change is recorded or the deadline passes. The caller holds the lock, which is released while waiting
+// so that other requests are served.
+func (s *Server) waitForChange(deadline time.Time) {
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.changed.Broadcast()
+	})
+	defer timer.Stop()
+	s.changed.Wait()
+}
+
+// Returns true if the caller can see the change. The changes to a node can be seen by the node and by the agbots,
+// except for the node's messages. The changes to an agbot can only be seen by that agbot. The changes to the other
+// resources can be seen by everyone.
+func (s *Server) visibleTo(change exchange.ExchangeChange, caller string) bool {
+	changed := change.OrgID + "/" + change.ID
+	switch change.Resource {
+	case exchange.RESOURCE_NODE_MSG, exchange.RESOURCE_NODE_ERROR:
+		return changed == caller
+	case exchange.RESOURCE_NODE, exchange.RESOURCE_NODE_POLICY, exchange.RESOURCE_NODE_AGREEMENTS, exchange.RESOURCE_NODE_STATUS, exchange.RESOURCE_NODE_SERVICES_CONFIGSTATE:
+		_, isAgbot := s.agbots[caller]
+		return changed == caller || isAgbot
+	case exchange.RESOURCE_AGBOT, exchange.RESOURCE_AGBOT_MSG, exchange.RESOURCE_AGBOT_AGREEMENTS, exchange.RESOURCE_AGBOT_SERVED_PATTERN, exchange.RESOURCE_AGBOT_SERVED_POLICY:
+		return changed == caller
+	default:
+		return true
+	}
+}
@@ -0,0 +1,477 @@
+package mockexchange
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A node and the resources that belong to it.
+type node struct {
+	exchange.Device
+	token      string
+	policy     *exchange.ExchangePolicy
+	status     json.RawMessage
+	errors     *exchange.ExchangeSurfaceError
+	agreements map[string]exchange.DeviceAgreement
+	messages   []message
+}
+
+// A message waiting to be read by a node or agbot.
+type message struct {
+	id      int
+	from    string
+	pubKey  []byte
+	body    []byte
+	sent    string
+	expires time.Time
+}
+
+func newNode(token string) *node {
+	return &node{token: token, agreements: map[string]exchange.DeviceAgreement{}}
+}
+
+// The public key of the node. The exchange keeps the key of a node in base64, as it is sent.
+func (n *node) publicKey() []byte {
+	key, _ := base64.StdEncoding.DecodeString(n.PublicKey)
+	return key
+}
+
+// The node as returned by the exchange, which does not return the token.
+func (n *node) get() exchange.Device {
+	dev := n.Device
+	dev.Token = ""
+	return dev
+}
+
+// Route the requests for orgs/<org>/nodes.
+func (s *Server) serveNodes(w http.ResponseWriter, req *request, org string) {
+	if len(req.parts) == 3 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		devs := map[string]exchange.Device{}
+		for id, n := range s.nodes {
+			if exchange.GetOrg(id) == org {
+				devs[id] = n.get()
+			}
+		}
+		writeJSON(w, http.StatusOK, exchange.GetDevicesResponse{Devices: devs})
+		return
+	}
+
+	id := org + "/" + req.parts[3]
+	if len(req.parts) == 4 {
+		s.serveNode(w, req, id)
+		return
+	}
+
+	n, ok := s.nodes[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("node %v not found", id))
+		return
+	}
+
+	switch req.parts[4] {
+	case "heartbeat":
+		if req.Method != http.MethodPost {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		n.LastHeartbeat = cutil.FormattedUTCTime()
+		writeOk(w, "heartbeat successful")
+	case "policy":
+		s.serveNodePolicy(w, req, id, n)
+	case "status":
+		s.serveNodeStatus(w, req, id, n)
+	case "errors":
+		s.serveNodeErrors(w, req, id, n)
+	case "agreements":
+		s.serveNodeAgreements(w, req, id, n)
+	case "msgs":
+		s.serveNodeMessages(w, req, id, n)
+	case "services_configstate":
+		s.serveNodeConfigState(w, req, id, n)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown node resource %v", req.parts[4]))
+	}
+}
+
+func (s *Server) serveNode(w http.ResponseWriter, req *request, id string) {
+	n, exists := s.nodes[id]
+
+	switch req.Method {
+	case http.MethodGet:
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v not found", id))
+		} else {
+			writeJSON(w, http.StatusOK, exchange.GetDevicesResponse{Devices: map[string]exchange.Device{id: n.get()}})
+		}
+
+	case http.MethodPut:
+		var pdr exchange.PutDeviceRequest
+		if !decodeBody(w, req, &pdr) {
+			return
+		} else if !exists && pdr.Token == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("a token is required to create node %v", id))
+			return
+		}
+
+		operation := exchange.CHANGE_OPERATION_MODIFIED
+		if !exists {
+			n = newNode(pdr.Token)
+			n.Owner = req.caller
+			s.nodes[id] = n
+			operation = exchange.CHANGE_OPERATION_CREATED
+		} else if pdr.Token != "" {
+			n.token = pdr.Token
+		}
+		n.Name = pdr.Name
+		n.NodeType = pdr.NodeType
+		n.Pattern = pdr.Pattern
+		n.RegisteredServices = pdr.RegisteredServices
+		n.MsgEndPoint = pdr.MsgEndPoint
+		n.SoftwareVersions = pdr.SoftwareVersions
+		n.PublicKey = base64.StdEncoding.EncodeToString(pdr.PublicKey)
+		n.Arch = pdr.Arch
+		n.UserInput = pdr.UserInput
+		n.LastUpdated = cutil.FormattedUTCTime()
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE, exchange.GetId(id), operation)
+		writeOk(w, fmt.Sprintf("node %v added or updated", id))
+
+	case http.MethodPatch:
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v not found", id))
+			return
+		}
+
+		// The exchange accepts one field at a time, the public key is patched like the key of an agbot.
+		var patch struct {
+			exchange.PatchDeviceRequest
+			PublicKey *[]byte `json:"publicKey,omitempty"`
+		}
+		if !decodeBody(w, req, &patch) {
+			return
+		}
+		if patch.UserInput != nil {
+			n.UserInput = *patch.UserInput
+		}
+		if patch.Pattern != nil {
+			n.Pattern = *patch.Pattern
+		}
+		if patch.Arch != nil {
+			n.Arch = *patch.Arch
+		}
+		if patch.RegisteredServices != nil {
+			n.RegisteredServices = *patch.RegisteredServices
+		}
+		if patch.PublicKey != nil {
+			n.PublicKey = base64.StdEncoding.EncodeToString(*patch.PublicKey)
+		}
+		n.LastUpdated = cutil.FormattedUTCTime()
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE, exchange.GetId(id), exchange.CHANGE_OPERATION_MODIFIED)
+		writeOk(w, fmt.Sprintf("node %v updated", id))
+
+	case http.MethodDelete:
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v not found", id))
+			return
+		}
+		delete(s.nodes, id)
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+func (s *Server) serveNodePolicy(w http.ResponseWriter, req *request, id string, n *node) {
+	switch req.Method {
+	case http.MethodGet:
+		if n.policy == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v has no policy", id))
+		} else {
+			writeJSON(w, http.StatusOK, n.policy)
+		}
+
+	case http.MethodPut:
+		var pol exchange.ExchangePolicy
+		if !decodeBody(w, req, &pol) {
+			return
+		}
+		pol.LastUpdated = cutil.FormattedUTCTime()
+		n.policy = &pol
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_POLICY, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+		writeOk(w, fmt.Sprintf("policy of node %v added or updated", id))
+
+	case http.MethodDelete:
+		if n.policy == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v has no policy", id))
+			return
+		}
+		n.policy = nil
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_POLICY, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+func (s *Server) serveNodeStatus(w http.ResponseWriter, req *request, id string, n *node) {
+	switch req.Method {
+	case http.MethodGet:
+		if n.status == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v has no status", id))
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(n.status)
+		}
+
+	case http.MethodPut:
+		var status map[string]interface{}
+		if !decodeBody(w, req, &status) {
+			return
+		}
+		n.status = json.RawMessage(req.body)
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_STATUS, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+		writeOk(w, fmt.Sprintf("status of node %v added or updated", id))
+
+	case http.MethodDelete:
+		if n.status == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v has no status", id))
+			return
+		}
+		n.status = nil
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_STATUS, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+func (s *Server) serveNodeErrors(w http.ResponseWriter, req *request, id string, n *node) {
+	switch req.Method {
+	case http.MethodGet:
+		if n.errors == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v has no errors", id))
+		} else {
+			writeJSON(w, http.StatusOK, n.errors)
+		}
+
+	case http.MethodPut:
+		var errs exchange.ExchangeSurfaceError
+		if !decodeBody(w, req, &errs) {
+			return
+		}
+		n.errors = &errs
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_ERROR, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+		writeOk(w, fmt.Sprintf("errors of node %v added or updated", id))
+
+	case http.MethodDelete:
+		if n.errors == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("node %v has no errors", id))
+			return
+		}
+		n.errors = nil
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_ERROR, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+func (s *Server) serveNodeAgreements(w http.ResponseWriter, req *request, id string, n *node) {
+	if len(req.parts) == 5 {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, exchange.AllDeviceAgreementsResponse{Agreements: n.agreements})
+		case http.MethodDelete:
+			if len(n.agreements) == 0 {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("node %v has no agreements", id))
+				return
+			}
+			n.agreements = map[string]exchange.DeviceAgreement{}
+			s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_AGREEMENTS, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+			writeDeleted(w)
+		default:
+			writeMethodNotAllowed(w, req)
+		}
+		return
+	}
+
+	agId := req.parts[5]
+	ag, exists := n.agreements[agId]
+
+	switch req.Method {
+	case http.MethodGet:
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("agreement %v not found on node %v", agId, id))
+		} else {
+			writeJSON(w, http.StatusOK, exchange.AllDeviceAgreementsResponse{Agreements: map[string]exchange.DeviceAgreement{agId: ag}})
+		}
+
+	case http.MethodPut:
+		var state exchange.PutAgreementState
+		if !decodeBody(w, req, &state) {
+			return
+		}
+		n.agreements[agId] = exchange.DeviceAgreement{
+			Service:          state.Services,
+			State:            state.State,
+			AgreementService: state.AgreementService,
+			LastUpdated:      cutil.FormattedUTCTime(),
+		}
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_AGREEMENTS, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+		writeOk(w, fmt.Sprintf("agreement %v of node %v added or updated", agId, id))
+
+	case http.MethodDelete:
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("agreement %v not found on node %v", agId, id))
+			return
+		}
+		delete(n.agreements, agId)
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_AGREEMENTS, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+// Agbots send messages to a node, and the node reads and deletes them.
+func (s *Server) serveNodeMessages(w http.ResponseWriter, req *request, id string, n *node) {
+	if len(req.parts) == 5 {
+		switch req.Method {
+		case http.MethodGet:
+			n.messages = unexpired(n.messages)
+			msgs := make([]exchange.DeviceMessage, 0, len(n.messages))
+			for _, m := range n.messages {
+				msgs = append(msgs, exchange.DeviceMessage{MsgId: m.id, AgbotId: m.from, AgbotPubKey: m.pubKey, Message: m.body, TimeSent: m.sent})
+			}
+			writeJSON(w, http.StatusOK, exchange.GetDeviceMessageResponse{Messages: msgs})
+
+		case http.MethodPost:
+			a, ok := s.agbots[req.caller]
+			if !ok {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("only an agbot can send a message to node %v", id))
+				return
+			}
+			if m, ok := s.newMessage(w, req, a.PublicKey); ok {
+				n.messages = append(n.messages, m)
+				s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_MSG, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED)
+				writeOk(w, fmt.Sprintf("message %v sent to node %v", m.id, id))
+			}
+
+		default:
+			writeMethodNotAllowed(w, req)
+		}
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		// The node checks that a message is still there before it handles it. The message list is empty when it is not.
+		n.messages = unexpired(n.messages)
+		msgs := make([]exchange.DeviceMessage, 0, 1)
+		for _, m := range n.messages {
+			if strconv.Itoa(m.id) == req.parts[5] {
+				msgs = append(msgs, exchange.DeviceMessage{MsgId: m.id, AgbotId: m.from, AgbotPubKey: m.pubKey, Message: m.body, TimeSent: m.sent})
+			}
+		}
+		writeJSON(w, http.StatusOK, exchange.GetDeviceMessageResponse{Messages: msgs})
+
+	case http.MethodDelete:
+		var deleted bool
+		n.messages, deleted = deleteMessage(n.messages, req.parts[5])
+		if !deleted {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("message %v not found for node %v", req.parts[5], id))
+			return
+		}
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+// The node suspends and resumes its services, by url and org. An empty url or org matches all the services.
+func (s *Server) serveNodeConfigState(w http.ResponseWriter, req *request, id string, n *node) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	var state exchange.ServiceConfigState
+	if !decodeBody(w, req, &state) {
+		return
+	}
+
+	changed := false
+	for ix, svc := range n.RegisteredServices {
+		svcOrg, svcURL := cutil.SplitOrgSpecUrl(svc.Url)
+		if (state.Org == "" || state.Org == svcOrg) && (state.Url == "" || state.Url == svcURL) {
+			n.RegisteredServices[ix].ConfigState = state.ConfigState
+			changed = true
+		}
+	}
+	if !changed {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no registered service of node %v matches %v", id, state))
+		return
+	}
+	s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_NODE_SERVICES_CONFIGSTATE, exchange.GetId(id), exchange.CHANGE_OPERATION_MODIFIED)
+	writeOk(w, fmt.Sprintf("configuration state of node %v updated", id))
+}
+
+// Create a message from the body of the request. The caller holds the lock.
+func (s *Server) newMessage(w http.ResponseWriter, req *request, senderPubKey []byte) (message, bool) {
+	var pm exchange.PostMessage
+	if !decodeBody(w, req, &pm) {
+		return message{}, false
+	}
+	s.messageId++
+	ttl := pm.TTL
+	if ttl <= 0 {
+		ttl = 180
+	}
+	return message{
+		id:      s.messageId,
+		from:    req.caller,
+		pubKey:  senderPubKey,
+		body:    pm.Message,
+		sent:    cutil.FormattedUTCTime(),
+		expires: time.Now().Add(time.Duration(ttl) * time.Second),
+	}, true
+}
+
+func unexpired(msgs []message) []message {
+	current := make([]message, 0, len(msgs))
+	for _, m := range msgs {
+		if time.Now().Before(m.expires) {
+			current = append(current, m)
+		}
+	}
+	return current
+}
+
+func deleteMessage(msgs []message, msgId string) ([]message, bool) {
+	id, err := strconv.Atoi(msgId)
+	if err != nil {
+		return msgs, false
+	}
+	for ix, m := range msgs {
+		if m.id == id {
+			return append(msgs[:ix], msgs[ix+1:]...), true
+		}
+	}
+	return msgs, false
+}
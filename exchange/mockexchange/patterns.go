@@ -0,0 +1,255 @@
+package mockexchange
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"net/http"
+	"sort"
+)
+
+// A pattern and its signing keys.
+type pattern struct {
+	exchange.Pattern
+	keys map[string]string
+}
+
+// The state of a search for the nodes that are compatible with a deployment policy. The agbot reads the result of a
+// search one page at a time, the session identifies the search.
+type searchSession struct {
+	session string
+	nodes   []string
+}
+
+// Route the requests for orgs/<org>/patterns.
+func (s *Server) servePatterns(w http.ResponseWriter, req *request, org string) {
+	if len(req.parts) == 3 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		pats := map[string]exchange.Pattern{}
+		for id, pat := range s.patterns {
+			if exchange.GetOrg(id) == org {
+				pats[id] = pat.Pattern
+			}
+		}
+		if len(pats) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no patterns found in org %v", org))
+		} else {
+			writeJSON(w, http.StatusOK, exchange.GetPatternResponse{Patterns: pats})
+		}
+		return
+	}
+
+	id := org + "/" + req.parts[3]
+	pat, ok := s.patterns[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("pattern %v not found", id))
+		return
+	}
+
+	if len(req.parts) == 4 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, exchange.GetPatternResponse{Patterns: map[string]exchange.Pattern{id: pat.Pattern}})
+		return
+	}
+
+	switch req.parts[4] {
+	case "keys":
+		serveKeys(w, req, pat.keys)
+	case "search":
+		s.servePatternSearch(w, req, id)
+	case "nodehealth":
+		s.serveNodeHealth(w, req, id)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown pattern resource %v", req.parts[4]))
+	}
+}
+
+// Route the requests for orgs/<org>/business/policies.
+func (s *Server) serveBusinessPolicies(w http.ResponseWriter, req *request, org string) {
+	if len(req.parts) < 4 || req.parts[3] != "policies" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown resource %v", req.parts[2:]))
+		return
+	}
+
+	if len(req.parts) == 4 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		pols := map[string]exchange.ExchangeBusinessPolicy{}
+		for id, pol := range s.policies {
+			if exchange.GetOrg(id) == org {
+				pols[id] = *pol
+			}
+		}
+		if len(pols) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no deployment policies found in org %v", org))
+		} else {
+			writeJSON(w, http.StatusOK, exchange.GetBusinessPolicyResponse{BusinessPolicy: pols})
+		}
+		return
+	}
+
+	id := org + "/" + req.parts[4]
+	pol, ok := s.policies[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("deployment policy %v not found", id))
+		return
+	}
+
+	if len(req.parts) == 5 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, exchange.GetBusinessPolicyResponse{BusinessPolicy: map[string]exchange.ExchangeBusinessPolicy{id: *pol}})
+	} else if req.parts[5] == "search" {
+		s.servePolicySearch(w, req, id, pol)
+	} else {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown deployment policy resource %v", req.parts[5]))
+	}
+}
+
+// Search for the nodes that use a pattern, and have registered the service in the request, if there is one.
+func (s *Server) servePatternSearch(w http.ResponseWriter, req *request, patternId string) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	var search exchange.SearchExchangePatternRequest
+	if !decodeBody(w, req, &search) {
+		return
+	}
+
+	devs := make([]exchange.SearchResultDevice, 0)
+	for _, id := range s.sortedNodeIds(search.NodeOrgIds) {
+		n := s.nodes[id]
+		if n.Pattern != patternId || n.PublicKey == "" || (search.ServiceURL != "" && !hasService(n, search.ServiceURL)) {
+			continue
+		}
+		devs = append(devs, exchange.SearchResultDevice{Id: id, NodeType: n.NodeType, PublicKey: n.PublicKey})
+		if search.NumEntries > 0 && len(devs) == search.NumEntries {
+			break
+		}
+	}
+	writeJSON(w, http.StatusCreated, exchange.SearchExchangePatternResponse{Devices: devs})
+}
+
+// Search for the nodes that might be compatible with a deployment policy, which are the policy based nodes that have
+// changed since the time in the request. The nodes are returned one page at a time, a search session ends when a page
+// has fewer nodes than the request asked for. If the agbot asks for a page of a session other than the one in progress,
+// the session in progress is returned with no nodes, so that the agbot can continue it.
+func (s *Server) servePolicySearch(w http.ResponseWriter, req *request, policyId string, pol *exchange.ExchangeBusinessPolicy) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	var search exchange.SearchExchBusinessPolRequest
+	if !decodeBody(w, req, &search) {
+		return
+	}
+
+	current, inProgress := s.sessions[policyId]
+	if inProgress && current.session != search.Session {
+		writeJSON(w, http.StatusCreated, exchange.SearchExchBusinessPolResponse{Devices: []exchange.SearchResultDevice{}, Session: current.session})
+		return
+	} else if !inProgress {
+		current = &searchSession{session: search.Session}
+		arch := pol.Service.Arch
+		for _, id := range s.sortedNodeIds(search.NodeOrgIds) {
+			n := s.nodes[id]
+			if n.Pattern != "" || n.PublicKey == "" || n.policy == nil {
+				continue
+			} else if arch != "" && arch != "*" && arch != n.Arch {
+				continue
+			} else if search.ChangedSince != 0 && changedBefore(n.LastUpdated, search.ChangedSince) && changedBefore(n.policy.LastUpdated, search.ChangedSince) {
+				continue
+			}
+			current.nodes = append(current.nodes, id)
+		}
+		s.sessions[policyId] = current
+	}
+
+	devs := make([]exchange.SearchResultDevice, 0)
+	for len(current.nodes) != 0 && (search.NumEntries == 0 || uint64(len(devs)) < search.NumEntries) {
+		n := s.nodes[current.nodes[0]]
+		if n != nil {
+			devs = append(devs, exchange.SearchResultDevice{Id: current.nodes[0], NodeType: n.NodeType, PublicKey: n.PublicKey})
+		}
+		current.nodes = current.nodes[1:]
+	}
+	if search.NumEntries == 0 || uint64(len(devs)) < search.NumEntries {
+		delete(s.sessions, policyId)
+	}
+
+	writeJSON(w, http.StatusCreated, exchange.SearchExchBusinessPolResponse{Devices: devs, Offset: cutil.FormattedUTCTime()})
+}
+
+// Route the requests for orgs/<org>/search.
+func (s *Server) serveSearch(w http.ResponseWriter, req *request, org string) {
+	if len(req.parts) == 4 && req.parts[3] == "nodehealth" {
+		s.serveNodeHealth(w, req, "")
+	} else {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown search %v", req.parts[3:]))
+	}
+}
+
+// Return the heartbeat and agreements of the nodes in the orgs of the request, and that use the pattern if it is set.
+func (s *Server) serveNodeHealth(w http.ResponseWriter, req *request, patternId string) {
+	if req.Method != http.MethodPost {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	var search exchange.NodeHealthStatusRequest
+	if !decodeBody(w, req, &search) {
+		return
+	}
+
+	health := exchange.NodeHealthStatus{Nodes: map[string]exchange.NodeInfo{}}
+	for _, id := range s.sortedNodeIds(search.NodeOrgIds) {
+		n := s.nodes[id]
+		if patternId != "" && n.Pattern != patternId {
+			continue
+		}
+		info := exchange.NodeInfo{LastHeartbeat: n.LastHeartbeat, Agreements: map[string]exchange.AgreementObject{}}
+		for agId := range n.agreements {
+			info.Agreements[agId] = exchange.AgreementObject{}
+		}
+		health.Nodes[id] = info
+	}
+	writeJSON(w, http.StatusCreated, health)
+}
+
+// Returns the ids of the nodes in the orgs, or all the nodes if no orgs are given, sorted so that searches return the
+// nodes in the same order.
+func (s *Server) sortedNodeIds(orgs []string) []string {
+	ids := make([]string, 0, len(s.nodes))
+	for id := range s.nodes {
+		if len(orgs) == 0 || cutil.SliceContains(orgs, exchange.GetOrg(id)) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Returns true if the node has registered the service, which is in the form org/url.
+func hasService(n *node, serviceURL string) bool {
+	for _, svc := range n.RegisteredServices {
+		if svc.Url == serviceURL {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the exchange time is before the time in seconds since 1970.
+func changedBefore(lastUpdated string, since uint64) bool {
+	return uint64(cutil.TimeInSeconds(lastUpdated, cutil.ExchangeTimeFormat)) < since
+}
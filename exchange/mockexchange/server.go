@@ -0,0 +1,347 @@
+// Package mockexchange is an in-process implementation of the subset of the exchange REST API that anax uses. It keeps
+// its state in memory and serves it from an httptest.Server, so that tests can run the real exchange client code, and
+// real node and agbot workers, without a live exchange.
+//
+// The server checks that each request has the credentials of a node, agbot or user that it knows, but it does not check
+// what the caller is allowed to do. The responses have the same shape and HTTP status codes as the real exchange, as far
+// as anax depends on them. Every change to a resource is recorded, and returned by the changes API.
+package mockexchange
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/semanticversion"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// The exchange version returned by the admin/version API, unless it is changed with SetVersion.
+const DEFAULT_VERSION = "2.60.0"
+
+// The root of the exchange API, as in a real exchange URL.
+const API_ROOT = "/v1/"
+
+type Server struct {
+	server *httptest.Server
+	lock   sync.Mutex
+
+	version     string
+	unavailable bool
+	requests    []string
+
+	users     map[string]string // Passwords by org/user.
+	orgs      map[string]*exchange.Organization
+	nodes     map[string]*node
+	agbots    map[string]*agbot
+	services  map[string]*service
+	patterns  map[string]*pattern
+	policies  map[string]*exchange.ExchangeBusinessPolicy
+	sessions  map[string]*searchSession // The node search session of each deployment policy.
+	changes   []exchange.ExchangeChange
+	changeId  uint64
+	messageId int
+
+	// Signalled when a change is recorded, to release the requests for changes that are held open.
+	changed *sync.Cond
+}
+
+// NewServer starts a mock exchange with no resources in it. The caller closes it when done.
+func NewServer() *Server {
+	s := &Server{
+		version:  DEFAULT_VERSION,
+		users:    map[string]string{},
+		orgs:     map[string]*exchange.Organization{},
+		nodes:    map[string]*node{},
+		agbots:   map[string]*agbot{},
+		services: map[string]*service{},
+		patterns: map[string]*pattern{},
+		policies: map[string]*exchange.ExchangeBusinessPolicy{},
+		sessions: map[string]*searchSession{},
+	}
+	s.changed = sync.NewCond(&s.lock)
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL returns the exchange URL, as configured in anax, with a trailing slash.
+func (s *Server) URL() string {
+	return s.server.URL + API_ROOT
+}
+
+// HTTPClientFactory returns a factory of clients of the server. Calls that cannot reach the server are retried once.
+func (s *Server) HTTPClientFactory() *config.HTTPClientFactory {
+	return &config.HTTPClientFactory{
+		NewHTTPClient: func(overrideTimeoutS *uint) *http.Client { return s.server.Client() },
+		RetryCount:    1,
+		RetryInterval: 1,
+	}
+}
+
+// ExchangeContext returns a context for calling the server with the given credentials.
+func (s *Server) ExchangeContext(id string, token string) exchange.ExchangeContext {
+	return exchange.NewCustomExchangeContext(id, token, s.URL(), "", s.HTTPClientFactory())
+}
+
+// Config returns a configuration for a node and an agbot that use the server as their exchange. The caller adds the
+// rest of the configuration that the workers under test need, such as database paths.
+func (s *Server) Config() *config.HorizonConfig {
+	return &config.HorizonConfig{
+		Edge: config.Config{
+			ExchangeURL:       s.URL(),
+			ExchangeHeartbeat: 1,
+		},
+		AgreementBot: config.AGConfig{
+			ExchangeURL:       s.URL(),
+			ExchangeHeartbeat: 1,
+		},
+		Collaborators: config.Collaborators{
+			HTTPClientFactory: s.HTTPClientFactory(),
+			// There are no signing keys, the services on the server have no deployment to sign.
+			KeyFileNamesFetcher: &config.KeyFileNamesFetcher{
+				GetKeyFileNames: func(publicKeyPath, userKeyPath string) ([]string, error) { return []string{}, nil },
+			},
+		},
+	}
+}
+
+// SetVersion changes the exchange version returned by the server.
+func (s *Server) SetVersion(version string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.version = version
+}
+
+// Returns true if the version of the server has the feature. A version that is not a release version has every
+// feature. The caller holds the lock.
+func (s *Server) hasFeature(name string) bool {
+	for _, feature := range exchange.ExchangeFeatures {
+		if feature.Name != name {
+			continue
+		} else if !semanticversion.IsVersionString(s.version) {
+			return true
+		} else if comp, err := semanticversion.CompareVersions(s.version, feature.MinVersion); err == nil && comp < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SetUnavailable makes the server answer every request with 503 Service Unavailable, as if the exchange were down,
+// until it is called again with false.
+func (s *Server) SetUnavailable(unavailable bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.unavailable = unavailable
+}
+
+// Requests returns the requests that the server has received, as "<method> <path>" with the path relative to the
+// exchange URL.
+func (s *Server) Requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// A request being served. The path is split into its parts, relative to the exchange URL.
+type request struct {
+	*http.Request
+	parts  []string
+	caller string // The org/id of the node, agbot or user that sent the request.
+	body   []byte
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, API_ROOT) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown path %v", r.URL.Path))
+		return
+	}
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, API_ROOT), "/")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unable to read the request body, error: %v", err))
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+path)
+	glog.V(5).Infof(mxlogString(fmt.Sprintf("%v %v %v", r.Method, path, string(body))))
+
+	if s.unavailable {
+		writeError(w, http.StatusServiceUnavailable, "the exchange is not available")
+		return
+	}
+
+	req := &request{Request: r, parts: strings.Split(path, "/"), body: body}
+
+	// The version of the exchange can be read without credentials.
+	if path == "admin/version" && r.Method == http.MethodGet {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(s.version + "\n"))
+		return
+	}
+
+	if caller, ok := s.authenticate(r); !ok {
+		writeError(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	} else {
+		req.caller = caller
+	}
+
+	switch {
+	case path == "admin/status":
+		s.serveAdminStatus(w, req)
+	case path == "changes/maxchangeid":
+		s.serveMaxChangeId(w, req)
+	case len(req.parts) >= 2 && req.parts[0] == "orgs":
+		s.serveOrg(w, req)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown path %v", path))
+	}
+}
+
+// Returns the org/id of the caller, if the credentials are those of a known node, agbot or user.
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Basic ") {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+	if err != nil {
+		return "", false
+	}
+	creds := strings.SplitN(string(decoded), ":", 2)
+	if len(creds) != 2 {
+		return "", false
+	}
+
+	id, token := creds[0], creds[1]
+	if n, ok := s.nodes[id]; ok {
+		return id, n.token == token
+	} else if a, ok := s.agbots[id]; ok {
+		return id, a.token == token
+	} else if password, ok := s.users[id]; ok {
+		return id, password == token
+	}
+	return "", false
+}
+
+func (s *Server) serveAdminStatus(w http.ResponseWriter, req *request) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"msg":            "Exchange server operating normally",
+		"numberOfNodes":  len(s.nodes),
+		"numberOfAgbots": len(s.agbots),
+		"numberOfUsers":  len(s.users),
+		"numberOfOrgs":   len(s.orgs),
+	})
+}
+
+// Route the requests for the resources of an org.
+func (s *Server) serveOrg(w http.ResponseWriter, req *request) {
+	org := req.parts[1]
+	if len(req.parts) == 2 {
+		s.serveOrgResource(w, req, org)
+		return
+	}
+
+	switch req.parts[2] {
+	case "changes":
+		s.serveChanges(w, req)
+	case "nodes":
+		s.serveNodes(w, req, org)
+	case "agbots":
+		s.serveAgbots(w, req, org)
+	case "services":
+		s.serveServices(w, req, org)
+	case "patterns":
+		s.servePatterns(w, req, org)
+	case "business":
+		s.serveBusinessPolicies(w, req, org)
+	case "search":
+		s.serveSearch(w, req, org)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown resource %v", req.parts[2]))
+	}
+}
+
+func (s *Server) serveOrgResource(w http.ResponseWriter, req *request, org string) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+	} else if o, ok := s.orgs[org]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("org %v not found", org))
+	} else {
+		writeJSON(w, http.StatusOK, exchange.GetOrganizationResponse{Orgs: map[string]exchange.Organization{org: *o}})
+	}
+}
+
+// Record a change to a resource, so that it is returned by the changes API. The caller holds the lock.
+func (s *Server) recordChange(org string, resource string, id string, operation string) {
+	s.changeId++
+	s.changes = append(s.changes, exchange.ExchangeChange{
+		OrgID:           org,
+		Resource:        resource,
+		ID:              id,
+		Operation:       operation,
+		ResourceChanges: []exchange.ResourceChange{{ChangeID: s.changeId}},
+	})
+	s.changed.Broadcast()
+}
+
+// Decode the JSON body of a request, or write a 400 response and return false.
+func decodeBody(w http.ResponseWriter, req *request, v interface{}) bool {
+	if err := json.Unmarshal(req.body, v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unable to demarshal the request body %v, error: %v", string(req.body), err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	serial, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("unable to marshal the response, error: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(serial)
+}
+
+// The response of a successful PUT, POST or PATCH.
+func writeOk(w http.ResponseWriter, msg string) {
+	writeJSON(w, http.StatusCreated, exchange.PostDeviceResponse{Code: "ok", Msg: msg})
+}
+
+// The response of a successful DELETE, which has no body.
+func writeDeleted(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, exchange.PostDeviceResponse{Code: http.StatusText(status), Msg: msg})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, req *request) {
+	writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %v is not supported on %v", req.Method, strings.Join(req.parts, "/")))
+}
+
+var mxlogString = func(v interface{}) string {
+	return fmt.Sprintf("Mock exchange: %v", v)
+}
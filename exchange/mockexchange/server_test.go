@@ -0,0 +1,143 @@
+// +build unit
+
+package mockexchange
+
+import (
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"testing"
+)
+
+// Register a node with the exchange client, and verify that it can read itself, its policy and its changes.
+func Test_NodeRegistration(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+	s.AddUser("myorg/admin", "adminpw")
+
+	nodeId := "myorg/node1"
+	pdr := exchange.PutDeviceRequest{Token: "nodetoken", Name: "node1", PublicKey: []byte("nodekey"), Arch: "amd64"}
+	if _, err := exchange.PutExchangeDevice(s.HTTPClientFactory(), nodeId, "adminpw", s.URL(), &pdr); err == nil {
+		t.Errorf("registered the node with the wrong credentials")
+	}
+	if _, err := exchange.PutExchangeDevice(s.HTTPClientFactory(), nodeId, "nodetoken", s.URL(), &pdr); err == nil {
+		t.Errorf("registered the node with its own credentials before it existed")
+	}
+
+	s.AddNode(nodeId, "nodetoken", exchange.Device{Name: "node1"})
+	if _, err := exchange.PutExchangeDevice(s.HTTPClientFactory(), nodeId, "nodetoken", s.URL(), &pdr); err != nil {
+		t.Errorf("unable to register the node, error: %v", err)
+	} else if dev, err := exchange.GetExchangeDevice(s.HTTPClientFactory(), nodeId, nodeId, "nodetoken", s.URL()); err != nil {
+		t.Errorf("unable to get the node, error: %v", err)
+	} else if dev.Arch != "amd64" || string(s.nodes[nodeId].publicKey()) != "nodekey" {
+		t.Errorf("wrong node %v", dev)
+	}
+
+	ec := s.ExchangeContext(nodeId, "nodetoken")
+	pol := exchange.ExchangePolicy{ExternalPolicy: externalpolicy.ExternalPolicy{Constraints: []string{"a == b"}}}
+	if _, err := exchange.PutNodePolicy(ec, nodeId, &pol); err != nil {
+		t.Errorf("unable to put the node policy, error: %v", err)
+	} else if got, err := exchange.GetNodePolicy(ec, nodeId); err != nil {
+		t.Errorf("unable to get the node policy, error: %v", err)
+	} else if got == nil || len(got.Constraints) != 1 || got.LastUpdated == "" {
+		t.Errorf("wrong node policy %v", got)
+	}
+
+	changes, err := exchange.GetExchangeChanges(ec, 1, 100, []string{"myorg"})
+	if err != nil {
+		t.Fatalf("unable to get the changes, error: %v", err)
+	}
+	var sawNode, sawPolicy bool
+	for _, change := range changes.Changes {
+		sawNode = sawNode || change.IsNode(nodeId)
+		sawPolicy = sawPolicy || change.IsNodePolicy(nodeId)
+	}
+	if !sawNode || !sawPolicy {
+		t.Errorf("missing node changes in %v", changes)
+	} else if changes.MostRecentChangeID != s.changeId || changes.ExchangeVersion != DEFAULT_VERSION {
+		t.Errorf("wrong changes response %v", changes)
+	}
+}
+
+// Verify that a node can read a service and its signing keys.
+func Test_ServiceKeys(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddNode("myorg/node1", "nodetoken", exchange.Device{})
+
+	svcId := s.AddService("myorg", exchange.ServiceDefinition{URL: "mock.keys.service", Version: "1.0.0", Arch: "amd64"})
+	if err := s.AddServiceKey(svcId, "key1.pem", "-----BEGIN PUBLIC KEY-----"); err != nil {
+		t.Fatalf("unable to add the key, error: %v", err)
+	}
+
+	ec := s.ExchangeContext("myorg/node1", "nodetoken")
+	if svc, id, err := exchange.GetService(ec, "mock.keys.service", "myorg", "1.0.0", "amd64"); err != nil {
+		t.Errorf("unable to get the service, error: %v", err)
+	} else if svc == nil || id != svcId {
+		t.Errorf("wrong service %v %v", id, svc)
+	}
+
+	if keys, err := exchange.GetObjectSigningKeys(ec, exchange.SERVICE, "mock.keys.service", "myorg", "1.0.0", "amd64"); err != nil {
+		t.Errorf("unable to get the keys, error: %v", err)
+	} else if keys["key1.pem"] != "-----BEGIN PUBLIC KEY-----" {
+		t.Errorf("wrong keys %v", keys)
+	}
+}
+
+// Verify that the nodes of a deployment policy search are returned one page at a time.
+func Test_PolicySearch(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddAgbot("myorg/ag1", "agtoken", exchange.Agbot{})
+	for _, id := range []string{"myorg/n1", "myorg/n2", "myorg/n3", "myorg/n4"} {
+		s.AddNode(id, "nodetoken", exchange.Device{PublicKey: "a2V5", Arch: "amd64"})
+		if id != "myorg/n4" {
+			s.SetNodePolicy(id, exchange.ExchangePolicy{})
+		}
+	}
+	pol := exchange.ExchangeBusinessPolicy{}
+	pol.Service.Arch = "amd64"
+	s.AddBusinessPolicy("myorg/bp1", pol)
+
+	ec := s.ExchangeContext("myorg/ag1", "agtoken")
+	req := exchange.SearchExchBusinessPolRequest{NodeOrgIds: []string{"myorg"}, Session: "s1", NumEntries: 2}
+	if resp, err := exchange.GetPolicyNodes(ec, "myorg", "bp1", &req); err != nil {
+		t.Fatalf("unable to search, error: %v", err)
+	} else if len(resp.Devices) != 2 || resp.Devices[0].Id != "myorg/n1" {
+		t.Errorf("wrong first page %v", resp)
+	}
+
+	other := req
+	other.Session = "s2"
+	if resp, err := exchange.GetPolicyNodes(ec, "myorg", "bp1", &other); err != nil {
+		t.Fatalf("unable to search, error: %v", err)
+	} else if len(resp.Devices) != 0 || resp.Session != "s1" {
+		t.Errorf("expected the session in progress, got %v", resp)
+	}
+
+	if resp, err := exchange.GetPolicyNodes(ec, "myorg", "bp1", &req); err != nil {
+		t.Fatalf("unable to search, error: %v", err)
+	} else if len(resp.Devices) != 1 || resp.Devices[0].Id != "myorg/n3" {
+		t.Errorf("wrong last page %v", resp)
+	} else if _, ok := s.sessions["myorg/bp1"]; ok {
+		t.Errorf("the session did not end after the last page")
+	}
+}
+
+// Verify that the client gives up when the exchange is unavailable. The node must not be in the exchange cache.
+func Test_Unavailable(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	exchange.ClearAllResourceCache()
+	s.AddNode("myorg/unavailable", "nodetoken", exchange.Device{})
+
+	s.SetUnavailable(true)
+	if _, err := exchange.GetExchangeDevice(s.HTTPClientFactory(), "myorg/unavailable", "myorg/unavailable", "nodetoken", s.URL()); err == nil {
+		t.Errorf("expected an error from an unavailable exchange")
+	}
+
+	s.SetUnavailable(false)
+	if _, err := exchange.GetExchangeDevice(s.HTTPClientFactory(), "myorg/unavailable", "myorg/unavailable", "nodetoken", s.URL()); err != nil {
+		t.Errorf("unable to get the node, error: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package mockexchange
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"net/http"
+)
+
+// A service definition and the resources that belong to it.
+type service struct {
+	exchange.ServiceDefinition
+	policy    *exchange.ExchangePolicy
+	keys      map[string]string
+	dockAuths []exchange.ImageDockerAuth
+}
+
+// Route the requests for orgs/<org>/services.
+func (s *Server) serveServices(w http.ResponseWriter, req *request, org string) {
+	if len(req.parts) == 3 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+
+		// The services can be filtered by url, version and arch.
+		query := req.URL.Query()
+		svcs := map[string]exchange.ServiceDefinition{}
+		for id, svc := range s.services {
+			if exchange.GetOrg(id) == org && matchesQuery(query.Get("url"), svc.URL) && matchesQuery(query.Get("version"), svc.Version) && matchesQuery(query.Get("arch"), svc.Arch) {
+				svcs[id] = svc.ServiceDefinition
+			}
+		}
+		if len(svcs) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no services found in org %v", org))
+		} else {
+			writeJSON(w, http.StatusOK, exchange.GetServicesResponse{Services: svcs})
+		}
+		return
+	}
+
+	id := org + "/" + req.parts[3]
+	svc, ok := s.services[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("service %v not found", id))
+		return
+	}
+
+	if len(req.parts) == 4 {
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, exchange.GetServicesResponse{Services: map[string]exchange.ServiceDefinition{id: svc.ServiceDefinition}})
+		return
+	}
+
+	switch req.parts[4] {
+	case "policy":
+		s.serveServicePolicy(w, req, id, svc)
+	case "keys":
+		serveKeys(w, req, svc.keys)
+	case "dockauths":
+		if req.Method != http.MethodGet {
+			writeMethodNotAllowed(w, req)
+		} else if len(svc.dockAuths) == 0 {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("service %v has no docker auths", id))
+		} else {
+			writeJSON(w, http.StatusOK, svc.dockAuths)
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown service resource %v", req.parts[4]))
+	}
+}
+
+func (s *Server) serveServicePolicy(w http.ResponseWriter, req *request, id string, svc *service) {
+	switch req.Method {
+	case http.MethodGet:
+		if svc.policy == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("service %v has no policy", id))
+		} else {
+			writeJSON(w, http.StatusOK, svc.policy)
+		}
+
+	case http.MethodPut:
+		var pol exchange.ExchangePolicy
+		if !decodeBody(w, req, &pol) {
+			return
+		}
+		pol.LastUpdated = cutil.FormattedUTCTime()
+		svc.policy = &pol
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_SERVICE_POLICY, exchange.GetId(id), exchange.CHANGE_OPERATION_CREATED_MODIFIED)
+		writeOk(w, fmt.Sprintf("policy of service %v added or updated", id))
+
+	case http.MethodDelete:
+		if svc.policy == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("service %v has no policy", id))
+			return
+		}
+		svc.policy = nil
+		s.recordChange(exchange.GetOrg(id), exchange.RESOURCE_AGBOT_SERVICE_POLICY, exchange.GetId(id), exchange.CHANGE_OPERATION_DELETED)
+		writeDeleted(w)
+
+	default:
+		writeMethodNotAllowed(w, req)
+	}
+}
+
+// Serve the signing keys of a service or pattern. The list of keys is a JSON array of their names, a key is returned as
+// plain text.
+func serveKeys(w http.ResponseWriter, req *request, keys map[string]string) {
+	if req.Method != http.MethodGet {
+		writeMethodNotAllowed(w, req)
+		return
+	}
+
+	if len(req.parts) == 5 {
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			writeError(w, http.StatusNotFound, "no signing keys found")
+		} else {
+			writeJSON(w, http.StatusOK, names)
+		}
+	} else if key, ok := keys[req.parts[5]]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("signing key %v not found", req.parts[5]))
+	} else {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(key))
+	}
+}
+
+// An empty query parameter matches any value.
+func matchesQuery(param string, value string) bool {
+	return param == "" || param == value
+}
@@ -0,0 +1,263 @@
+package mockexchange
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	agbotpersistence "github.com/open-horizon/anax/agreementbot/persistence"
+	_ "github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/persistence"
+	"github.com/open-horizon/anax/worker"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// The most messages from the workers of a node or an agbot that are kept until the test reads them.
+const NODE_MESSAGE_BUFFER = 100
+
+// The workers of a node or an agbot that a test has started, and the messages that they send to the other workers of
+// anax.
+type agent struct {
+	Messages chan events.Message
+
+	lock     sync.Mutex
+	workers  []*agentWorker
+	handlers []worker.MessageHandler
+}
+
+// A worker that a test has started, and which is stopped when the node or agbot is closed.
+type agentWorker struct {
+	commands chan worker.Command
+	stopped  chan bool
+}
+
+func newAgent() agent {
+	return agent{Messages: make(chan events.Message, NODE_MESSAGE_BUFFER)}
+}
+
+// A node as the agent runs it against the server. It has a database of its own, in which the node is registered, and
+// runs the real workers that a test starts. The messages that the workers send to the other workers of the agent are
+// passed on to Messages, so that a test can wait for them.
+type Node struct {
+	Id     string // The node id in the form org/id.
+	Config *config.HorizonConfig
+	DB     *bolt.DB
+	agent
+
+	dir string
+}
+
+// NewNode adds a registered node to the server, and creates the local state of the agent for it, as it is once the
+// node has been registered. The node polls the server for changes every second. The caller closes the node when done.
+func (s *Server) NewNode(id string, token string, dev exchange.Device) (*Node, error) {
+	s.AddNode(id, token, dev)
+
+	dir, err := ioutil.TempDir("", "mockexchange-")
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path.Join(dir, "anax.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	if _, err := persistence.SaveNewExchangeDevice(db, exchange.GetId(id), token, dev.Name, persistence.DEVICE_TYPE_DEVICE, false, exchange.GetOrg(id), dev.Pattern, persistence.CONFIGSTATE_CONFIGURED); err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("unable to save node %v, error: %v", id, err)
+	}
+
+	cfg := s.Config()
+	cfg.Edge.DBPath = dir
+	cfg.Edge.PolicyPath = path.Join(dir, "policy.d")
+	cfg.Edge.ExchangeMessagePollInterval = 1
+	cfg.Edge.ExchangeMessagePollMaxInterval = 1
+	cfg.Edge.ExchangeMessagePollIncrement = 1
+	cfg.Edge.ExchangeChanges = cfg.Edge.ExchangeChanges.WithDefaults()
+	cfg.Edge.NodeCheckIntervalS = 15
+	cfg.Edge.NodePolicyCheckIntervalS = 15
+	cfg.Edge.ServiceUpgradeCheckIntervalS = 300
+	cfg.Edge.SurfaceErrorCheckIntervalS = 15
+	cfg.Edge.SurfaceErrorAgreementPersistentS = 90
+	cfg.Edge.DefaultServiceRetryCount = 2
+	cfg.Edge.DefaultServiceRetryDuration = 600
+	cfg.Edge.InitialPollingBuffer = 120
+
+	return &Node{
+		Id:     id,
+		Config: cfg,
+		DB:     db,
+		agent:  newAgent(),
+		dir:    dir,
+	}, nil
+}
+
+// Close stops the workers that were started, and removes the local state of the node.
+func (n *Node) Close() {
+	n.stopWorkers()
+	n.DB.Close()
+	os.RemoveAll(n.dir)
+}
+
+// An agbot as anax runs it against the server, with an in-memory database. It runs the real workers that a test
+// starts, and passes on their messages to Messages like a node does.
+type Agbot struct {
+	Id     string // The agbot id in the form org/id.
+	Config *config.HorizonConfig
+	DB     agbotpersistence.AgbotDatabase
+	agent
+
+	dir string
+}
+
+// NewAgbot adds an agbot to the server, and creates the configuration and the database of anax for it. The agbot
+// looks for nodes to make agreements with, and checks its agreements and policies, every second. The database is the
+// in-memory database of the agbot, of which there is one in a process, so a test runs one agbot at a time. Like the
+// node, the agbot uses the message keys of the process, under HZN_VAR_BASE. The caller closes the agbot when done.
+func (s *Server) NewAgbot(id string, token string, ag exchange.Agbot) (*Agbot, error) {
+	s.AddAgbot(id, token, ag)
+
+	dir, err := ioutil.TempDir("", "mockexchange-")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := s.Config()
+	cfg.AgreementBot.ExchangeId = id
+	cfg.AgreementBot.ExchangeToken = token
+	cfg.AgreementBot.InMemoryDB = true
+	cfg.AgreementBot.PolicyPath = path.Join(dir, "policy.d") + "/"
+	cfg.AgreementBot.AgreementWorkers = 2
+	cfg.AgreementBot.NewContractIntervalS = 1
+	cfg.AgreementBot.ProcessGovernanceIntervalS = 1
+	cfg.AgreementBot.CheckUpdatedPolicyS = 1
+	cfg.AgreementBot.ProtocolTimeoutS = 120
+	cfg.AgreementBot.AgreementTimeoutS = 300
+	cfg.AgreementBot.NoDataIntervalS = 300
+	cfg.AgreementBot.ActiveDeviceTimeoutS = 180
+	cfg.AgreementBot.PurgeArchivedAgreementHours = 1
+	cfg.AgreementBot.MessageKeyCheck = config.AgbotMessageKeyCheck_DEFAULT
+	cfg.AgreementBot.AgreementBatchSize = config.AgbotAgreementBatchSize_DEFAULT
+	cfg.AgreementBot.AgreementQueueSize = config.AgbotAgreementQueueSize_DEFAULT
+	cfg.AgreementBot.FullRescanS = config.AgbotFullRescan_DEFAULT
+	cfg.AgreementBot.MaxExchangeChanges = config.AgbotMaxChanges_DEFAULT
+	cfg.AgreementBot.RetryLookBackWindow = config.AgbotRetryLookBackWindow_DEFAULT
+	cfg.AgreementBot.MMSGarbageCollectionInterval = 300
+
+	db, err := agbotpersistence.InitDatabase(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("unable to initialize the database of agbot %v, error: %v", id, err)
+	}
+
+	return &Agbot{
+		Id:     id,
+		Config: cfg,
+		DB:     db,
+		agent:  newAgent(),
+		dir:    dir,
+	}, nil
+}
+
+// Close stops the workers that were started, and removes the state of the agbot.
+func (a *Agbot) Close() {
+	a.stopWorkers()
+	a.DB.Close()
+	os.RemoveAll(a.dir)
+}
+
+// Watch passes on the messages of a worker that the test has started with the Config and DB of the node or agbot, such
+// as the changes worker, and stops the worker when the node or agbot is closed. Every worker of anax embeds a
+// BaseWorker. A message is dropped when the test has not read the earlier ones.
+func (a *agent) Watch(w *worker.BaseWorker) {
+	aw := &agentWorker{commands: w.Commands, stopped: make(chan bool)}
+	a.lock.Lock()
+	a.workers = append(a.workers, aw)
+	a.lock.Unlock()
+
+	go func() {
+		defer close(aw.stopped)
+		for msg := range w.Messages {
+			select {
+			case a.Messages <- msg:
+			default:
+			}
+			stop, ok := msg.(*events.WorkerStopMessage)
+			stopped := ok && stop.Name() == w.GetName()
+			for _, h := range a.connected(w.GetName(), stopped) {
+				h.NewEvent(msg)
+			}
+			if stopped {
+				return
+			}
+		}
+	}()
+}
+
+// Connect delivers the messages of the watched workers to a worker, as anax delivers the messages of each worker to all
+// the workers, so that a test can run workers that depend on each other. The worker is also watched, to pass on its
+// own messages and to stop it.
+func (a *agent) Connect(h worker.MessageHandler) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.handlers = append(a.handlers, h)
+}
+
+// Returns the connected workers. When the named worker has stopped, it is disconnected first, so that nothing is
+// queued for it anymore.
+func (a *agent) connected(name string, stopped bool) []worker.MessageHandler {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if stopped {
+		handlers := make([]worker.MessageHandler, 0, len(a.handlers))
+		for _, h := range a.handlers {
+			if h.GetName() != name {
+				handlers = append(handlers, h)
+			}
+		}
+		a.handlers = handlers
+	}
+	return append([]worker.MessageHandler{}, a.handlers...)
+}
+
+// WaitForMessage waits for a message from the workers of the node or agbot for which the match function returns true,
+// and returns it. Returns nil if there is no such message before the timeout.
+func (a *agent) WaitForMessage(timeout time.Duration, match func(events.Message) bool) events.Message {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-a.Messages:
+			if match(msg) {
+				return msg
+			}
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// Stop the workers that were started, and wait for them to stop.
+func (a *agent) stopWorkers() {
+	a.lock.Lock()
+	workers := a.workers
+	a.lock.Unlock()
+
+	for _, w := range workers {
+		w.commands <- worker.NewBeginShutdownCommand()
+		w.commands <- worker.NewTerminateCommand("shutdown")
+	}
+	for _, w := range workers {
+		select {
+		case <-w.stopped:
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// +build unit
+
+package mockexchange
+
+import (
+	"github.com/open-horizon/anax/changes"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/persistence"
+	"testing"
+	"time"
+)
+
+// Run the changes worker of a node against the server, and verify that it heartbeats and sees a change to the node.
+func Test_NodeChangesWorker(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+
+	nodeId := "myorg/node1"
+	n, err := s.NewNode(nodeId, "nodetoken", exchange.Device{Name: "node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	n.Watch(&changes.NewChangesWorker("ExchangeChanges", n.Config, n.DB).BaseWorker)
+
+	// The worker tells the other workers to check every resource when it starts.
+	if msg := n.WaitForMessage(10*time.Second, isChange(events.CHANGE_NODE_POLICY_TYPE)); msg == nil {
+		t.Fatalf("no change message when the worker started")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for dev, _ := s.Node(nodeId); dev.LastHeartbeat == ""; dev, _ = s.Node(nodeId) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the node did not heartbeat")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	pol := exchange.ExchangePolicy{ExternalPolicy: externalpolicy.ExternalPolicy{Constraints: []string{"a == b"}}}
+	if err := s.SetNodePolicy(nodeId, pol); err != nil {
+		t.Fatal(err)
+	} else if msg := n.WaitForMessage(10*time.Second, isChange(events.CHANGE_NODE_POLICY_TYPE)); msg == nil {
+		t.Errorf("no change message for the node policy")
+	}
+}
+
+// Run the changes worker of a node against an exchange that is older than the minimum exchange version and does not
+// have the max change ID, and verify that it reads the changes from the first one, and tells the other workers about
+// each change once.
+func Test_NodeChangesWorker_old_exchange(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetVersion("2.43.0")
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+
+	nodeId := "myorg/node1"
+	n, err := s.NewNode(nodeId, "nodetoken", exchange.Device{Name: "node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	n.Watch(&changes.NewChangesWorker("ExchangeChanges", n.Config, n.DB).BaseWorker)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for dev, _ := s.Node(nodeId); dev.LastHeartbeat == ""; dev, _ = s.Node(nodeId) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the node did not heartbeat")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The worker polls every second. It settles once it has seen the changes made before it started.
+	deadline = time.Now().Add(15 * time.Second)
+	for n.WaitForMessage(3*time.Second, isChange(events.CHANGE_NODE_POLICY_TYPE)) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("the worker keeps sending change messages without changes")
+		}
+	}
+
+	pol := exchange.ExchangePolicy{ExternalPolicy: externalpolicy.ExternalPolicy{Constraints: []string{"a == b"}}}
+	if err := s.SetNodePolicy(nodeId, pol); err != nil {
+		t.Fatal(err)
+	} else if msg := n.WaitForMessage(10*time.Second, isChange(events.CHANGE_NODE_POLICY_TYPE)); msg == nil {
+		t.Errorf("no change message for the node policy")
+	}
+}
+
+// Restart the changes worker of a node with a change state that was saved longer ago than the exchange keeps the
+// changes, and verify that it syncs every resource and tells the agreement worker to reconcile the agreements. A node
+// whose change state is recent does not.
+func Test_NodeChangesWorker_retention_gap(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddOrg("myorg", exchange.Organization{Label: "myorg"})
+
+	oldNode, err := s.NewNode("myorg/node1", "nodetoken", exchange.Device{Name: "node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldNode.Close()
+
+	recentNode, err := s.NewNode("myorg/node2", "nodetoken", exchange.Device{Name: "node2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recentNode.Close()
+
+	// Both nodes last read the changes when their change state was saved.
+	oldNode.Config.Edge.ExchangeChanges.RetentionS = 1
+	for _, n := range []*Node{oldNode, recentNode} {
+		if err := persistence.SaveExchangeChangeState(n.DB, 1, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(2 * time.Second)
+
+	for _, n := range []*Node{oldNode, recentNode} {
+		n.Watch(&changes.NewChangesWorker("ExchangeChanges", n.Config, n.DB).BaseWorker)
+	}
+
+	if msg := oldNode.WaitForMessage(10*time.Second, isChange(events.CHANGE_NODE_AGREEMENT_TYPE)); msg == nil {
+		t.Errorf("no agreement change message after the retention period")
+	} else if !hasResyncLog(t, oldNode) {
+		t.Errorf("the resync is not in the event log")
+	}
+
+	if msg := recentNode.WaitForMessage(3*time.Second, isChange(events.CHANGE_NODE_AGREEMENT_TYPE)); msg != nil {
+		t.Errorf("unexpected agreement change message within the retention period")
+	} else if hasResyncLog(t, recentNode) {
+		t.Errorf("unexpected resync in the event log")
+	}
+}
+
+func hasResyncLog(t *testing.T, n *Node) bool {
+	logs, err := persistence.FindAllEventLogs(n.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range logs {
+		if l.EventCode == persistence.EC_NODE_CHANGES_RESYNC {
+			return true
+		}
+	}
+	return false
+}
+
+func isChange(changeType events.EventId) func(events.Message) bool {
+	return func(msg events.Message) bool {
+		change, ok := msg.(*events.ExchangeChangeMessage)
+		return ok && change.Event().Id == changeType
+	}
+}
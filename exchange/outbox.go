@@ -0,0 +1,189 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/persistence"
+	"strings"
+	"sync"
+)
+
+// The node keeps the updates it could not send to the exchange in an outbox in its local database, rather than
+// dropping them or retrying forever. See persistence.OutboxEntry. Once something is queued, later updates are queued
+// behind it so that the exchange receives them in order, and the outbox is replayed when the exchange can be reached
+// again. The outbox is only enabled on a node, an agbot sends its updates directly.
+
+// The resources that the node updates through the outbox.
+const (
+	OUTBOX_NODE_STATUS    = "nodestatus"
+	OUTBOX_SURFACE_ERRORS = "surfaceerrors"
+	OUTBOX_NODE_POLICY    = "nodepolicy"
+	OUTBOX_NODE_USERINPUT = "nodeuserinput"
+	OUTBOX_AGREEMENT      = "agreement/"
+)
+
+var outboxLock sync.Mutex
+var outboxDB *bolt.DB
+
+// Only one replay at a time, so that an update is not sent twice.
+var replayLock sync.Mutex
+
+// Enable the outbox in the node's local database.
+func SetOutbox(db *bolt.DB) {
+	outboxLock.Lock()
+	defer outboxLock.Unlock()
+	outboxDB = db
+}
+
+func getOutbox() *bolt.DB {
+	outboxLock.Lock()
+	defer outboxLock.Unlock()
+	return outboxDB
+}
+
+// Returns the state of the outbox, or nil if the outbox is not enabled.
+func GetOutboxStatus() *persistence.OutboxStatus {
+	db := getOutbox()
+	if db == nil {
+		return nil
+	}
+	status, err := persistence.GetOutboxStatus(db)
+	if err != nil {
+		glog.Errorf(rpclogString(fmt.Sprintf("unable to read the outbox, error: %v", err)))
+		return nil
+	}
+	return status
+}
+
+// The error returned when an update could not be sent to the exchange and was queued in the outbox instead. It will
+// be sent when the exchange can be reached again, so callers normally treat it as success.
+type OutboxQueuedError struct {
+	Resource string
+	cause    error
+}
+
+func (e *OutboxQueuedError) Error() string {
+	return fmt.Sprintf("update of %v queued in the outbox, the exchange could not be reached: %v", e.Resource, e.cause)
+}
+
+// Returns true if the error means that the update was queued in the outbox.
+func IsOutboxQueued(err error) bool {
+	_, ok := err.(*OutboxQueuedError)
+	return ok
+}
+
+// Send an update of a resource in the exchange, or queue it in the outbox. The path is relative to the exchange URL.
+// If the outbox is not empty, the update is queued behind the others after trying to replay them. Otherwise it is
+// sent, and queued if the retries allowed by the HTTP client factory are used up. An *OutboxQueuedError is returned
+// when the update is queued. When the outbox is not enabled, the update is sent like any other call to the exchange.
+// The response is only set when the update is sent, it can be nil if the caller does not need it.
+func SendToExchange(httpClientFactory *config.HTTPClientFactory, exchangeURL string, deviceId string, token string, resource string, method string, path string, body interface{}, resp *interface{}) error {
+
+	db := getOutbox()
+	if db != nil {
+		if pending, err := ReplayOutbox(httpClientFactory, exchangeURL, deviceId, token); err != nil {
+			return err
+		} else if pending != 0 {
+			return queueInOutbox(db, resource, method, path, body, errors.New(fmt.Sprintf("%v earlier updates are waiting to be sent", pending)))
+		}
+	}
+
+	if resp == nil {
+		var ignored interface{}
+		ignored = new(PostDeviceResponse)
+		resp = &ignored
+	}
+
+	retry := NewRetry(httpClientFactory)
+	for {
+		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), method, exchangeURL+path, deviceId, token, body, resp); err != nil {
+			if method == "DELETE" && strings.Contains(err.Error(), "status: 404") {
+				return nil
+			}
+			return err
+		} else if tpErr != nil {
+			glog.Warningf(rpclogString(tpErr.Error()))
+			if retry.Backoff(tpErr) {
+				continue
+			} else if db != nil {
+				return queueInOutbox(db, resource, method, path, body, tpErr)
+			}
+			return errors.New(fmt.Sprintf("exceeded %v retries for %v of %v, error: %v", httpClientFactory.RetryCount, method, resource, tpErr))
+		} else {
+			return nil
+		}
+	}
+}
+
+func queueInOutbox(db *bolt.DB, resource string, method string, path string, body interface{}, cause error) error {
+	if entry, err := persistence.QueueOutboxEntry(db, resource, method, path, body); err != nil {
+		return errors.New(fmt.Sprintf("unable to queue the update of %v in the outbox, error: %v", resource, err))
+	} else {
+		glog.V(3).Infof(rpclogString(fmt.Sprintf("queued in the outbox: %v", entry)))
+	}
+	return &OutboxQueuedError{Resource: resource, cause: cause}
+}
+
+// Send the updates in the outbox to the exchange, in order. Each update is sent once, the replay stops at the first
+// update that cannot be sent because the exchange cannot be reached. An update that the exchange rejects is dropped,
+// since sending it again would not help. Returns the number of updates left in the outbox.
+func ReplayOutbox(httpClientFactory *config.HTTPClientFactory, exchangeURL string, deviceId string, token string) (int, error) {
+	db := getOutbox()
+	if db == nil {
+		return 0, nil
+	}
+
+	replayLock.Lock()
+	defer replayLock.Unlock()
+
+	entries, err := persistence.FindOutboxEntries(db)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("unable to read the outbox, error: %v", err))
+	} else if len(entries) == 0 {
+		return 0, nil
+	}
+
+	glog.V(3).Infof(rpclogString(fmt.Sprintf("replaying %v updates from the outbox", len(entries))))
+
+	for ix, entry := range entries {
+		var body interface{}
+		if len(entry.Body) != 0 {
+			body = entry.Body
+		}
+
+		var resp interface{}
+		resp = new(PostDeviceResponse)
+		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), entry.Method, exchangeURL+entry.Path, deviceId, token, body, &resp); err != nil {
+			if !(entry.Method == "DELETE" && strings.Contains(err.Error(), "status: 404")) {
+				glog.Errorf(rpclogString(fmt.Sprintf("dropping %v from the outbox, the exchange rejected it: %v", entry.Resource, err)))
+			}
+		} else if tpErr != nil {
+			glog.Warningf(rpclogString(fmt.Sprintf("unable to replay the outbox, %v updates are waiting: %v", len(entries)-ix, tpErr)))
+			if err := persistence.FailedOutboxEntry(db, &entry, tpErr); err != nil {
+				glog.Errorf(rpclogString(err.Error()))
+			}
+			return len(entries) - ix, nil
+		} else {
+			glog.V(3).Infof(rpclogString(fmt.Sprintf("sent %v from the outbox, queued at %v", entry.Resource, entry.QueuedTime)))
+		}
+
+		if err := persistence.DeleteOutboxEntry(db, &entry); err != nil {
+			return len(entries) - ix, errors.New(fmt.Sprintf("unable to remove %v from the outbox, error: %v", entry.Resource, err))
+		}
+	}
+
+	// More updates might have been queued during the replay.
+	if status, err := persistence.GetOutboxStatus(db); err != nil {
+		return 0, errors.New(fmt.Sprintf("unable to read the outbox, error: %v", err))
+	} else {
+		return status.QueueDepth, nil
+	}
+}
+
+// Returns the path, relative to the exchange URL, of a node resource. The suffix is appended to the node's path.
+func NodePath(deviceId string, suffix string) string {
+	return "orgs/" + GetOrg(deviceId) + "/nodes/" + GetId(deviceId) + suffix
+}
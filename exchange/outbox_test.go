@@ -0,0 +1,108 @@
+// +build unit
+
+package exchange
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/persistence"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func Test_SendToExchange_outbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "utdb-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := bolt.Open(path.Join(dir, "anax-ut.db"), 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	SetOutbox(db)
+	defer SetOutbox(nil)
+
+	SetRetryPolicy(config.ExchangeRetryConfig{BreakerThreshold: -1})
+	defer SetRetryPolicy(config.ExchangeRetryConfig{})
+	retrySleep = func(d time.Duration) {}
+	defer func() { retrySleep = time.Sleep }()
+
+	// The exchange is down until status is changed.
+	status := http.StatusServiceUnavailable
+	received := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusOK {
+			received = append(received, r.Method+" "+r.URL.Path)
+		}
+		if status == http.StatusOK && r.URL.Path == "/orgs/myorg/nodes/node1/errors" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+		} else if r.Method == "DELETE" {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"code": "ok", "msg": "done"}`))
+		}
+	}))
+	defer server.Close()
+
+	factory := &config.HTTPClientFactory{
+		NewHTTPClient: func(overrideTimeoutS *uint) *http.Client { return server.Client() },
+		RetryCount:    1,
+		RetryInterval: 1,
+	}
+	send := func(resource string, method string, suffix string) error {
+		return SendToExchange(factory, server.URL+"/", "myorg/node1", "token", resource, method, NodePath("myorg/node1", suffix), map[string]string{"resource": resource}, nil)
+	}
+
+	// The updates are queued while the exchange is down, the second agreement update replaces the first.
+	for _, u := range [][]string{
+		{OUTBOX_AGREEMENT + "ag1", "PUT", "/agreements/ag1"},
+		{OUTBOX_NODE_STATUS, "PUT", "/status"},
+		{OUTBOX_SURFACE_ERRORS, "PUT", "/errors"},
+		{OUTBOX_AGREEMENT + "ag1", "DELETE", "/agreements/ag1"},
+	} {
+		if err := send(u[0], u[1], u[2]); !IsOutboxQueued(err) {
+			t.Errorf("expected %v to be queued, got %v", u[0], err)
+		}
+	}
+	if s := GetOutboxStatus(); s == nil || s.QueueDepth != 3 {
+		t.Fatalf("expected 3 queued updates, got %v", s)
+	}
+
+	// The next update is sent after the queued ones, and the update rejected by the exchange is dropped.
+	status = http.StatusOK
+	if err := send(OUTBOX_NODE_POLICY, "PUT", "/policy"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	expected := []string{
+		"PUT /orgs/myorg/nodes/node1/status",
+		"PUT /orgs/myorg/nodes/node1/errors",
+		"DELETE /orgs/myorg/nodes/node1/agreements/ag1",
+		"PUT /orgs/myorg/nodes/node1/policy",
+	}
+	if len(received) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, received)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, received)
+			break
+		}
+	}
+	if entries, _ := persistence.FindOutboxEntries(db); len(entries) != 0 {
+		t.Errorf("expected an empty outbox, got %v", entries)
+	}
+}
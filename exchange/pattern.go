@@ -7,7 +7,6 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/policy"
 	"strings"
-	"time"
 )
 
 type Pattern struct {
@@ -205,24 +204,17 @@ func GetPatterns(httpClientFactory *config.HTTPClientFactory, org string, patter
 		targetURL = fmt.Sprintf("%vorgs/%v/patterns/%v", exURL, org, pattern)
 	}
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := NewRetry(httpClientFactory)
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "GET", targetURL, id, token, nil, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", httpClientFactory.RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			var pats map[string]Pattern
 			if resp != nil {
@@ -415,6 +407,7 @@ func GetPatternNodes(ec ExchangeContext, policyOrg string, patternId string, req
 	var resp interface{}
 	resp = new(SearchExchangePatternResponse)
 	targetURL := ec.GetExchangeURL() + "orgs/" + policyOrg + "/patterns/" + GetId(patternId) + "/search"
+	retry := NewRetryPolicy(0, 10)
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "POST", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), *req, &resp); err != nil {
 			if !strings.Contains(err.Error(), "status: 404") {
@@ -425,7 +418,7 @@ func GetPatternNodes(ec ExchangeContext, policyOrg string, patternId string, req
 			}
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			retry.Backoff(tpErr)
 			continue
 		} else {
 			dev := resp.(*SearchExchangePatternResponse).Devices
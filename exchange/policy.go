@@ -109,24 +109,17 @@ func GetNodePolicy(ec ExchangeContext, deviceId string) (*ExchangePolicy, error)
 
 	targetURL := fmt.Sprintf("%vorgs/%v/nodes/%v/policy", ec.GetExchangeURL(), GetOrg(deviceId), GetId(deviceId))
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(5).Infof(rpclogString(fmt.Sprintf("returning node policy %v for %v.", resp, deviceId)))
 			nodePolicy := resp.(*ExchangePolicy)
@@ -146,63 +139,25 @@ func PutNodePolicy(ec ExchangeContext, deviceId string, ep *ExchangePolicy) (*Pu
 	// create PUT body
 	var resp interface{}
 	resp = new(PutDeviceResponse)
-	targetURL := fmt.Sprintf("%vorgs/%v/nodes/%v/policy", ec.GetExchangeURL(), GetOrg(deviceId), GetId(deviceId))
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
-	for {
-		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "PUT", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), ep, &resp); err != nil {
-			return nil, err
-		} else if tpErr != nil {
-			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
-				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			}
-		} else {
-			glog.V(3).Infof(rpclogString(fmt.Sprintf("put device policy for %v to exchange %v", deviceId, ep)))
-			UpdateCache(NodeCacheMapKey(GetOrg(deviceId), GetId(deviceId)), NODE_POL_TYPE_CACHE, ep)
-			return resp.(*PutDeviceResponse), nil
-		}
+	if err := SendToExchange(ec.GetHTTPFactory(), ec.GetExchangeURL(), ec.GetExchangeId(), ec.GetExchangeToken(), OUTBOX_NODE_POLICY, "PUT", NodePath(deviceId, "/policy"), ep, &resp); err != nil {
+		return nil, err
+	} else {
+		glog.V(3).Infof(rpclogString(fmt.Sprintf("put device policy for %v to exchange %v", deviceId, ep)))
+		UpdateCache(NodeCacheMapKey(GetOrg(deviceId), GetId(deviceId)), NODE_POL_TYPE_CACHE, ep)
+		return resp.(*PutDeviceResponse), nil
 	}
 }
 
 // Delete node policy from the exchange.
 // Return nil if the policy is deleted or does not exist.
 func DeleteNodePolicy(ec ExchangeContext, deviceId string) error {
-	// create PUT body
-	var resp interface{}
-	resp = new(PostDeviceResponse)
-	targetURL := fmt.Sprintf("%vorgs/%v/nodes/%v/policy", ec.GetExchangeURL(), GetOrg(deviceId), GetId(deviceId))
-
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
-	for {
-		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "DELETE", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil && !strings.Contains(err.Error(), "status: 404") {
-			return err
-		} else if tpErr != nil {
-			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
-				return fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			}
-		} else {
-			glog.V(3).Infof(rpclogString(fmt.Sprintf("deleted device policy for %v from the exchange.", deviceId)))
-			DeleteCacheResource(NODE_POL_TYPE_CACHE, NodeCacheMapKey(GetOrg(deviceId), GetId(deviceId)))
-			return nil
-		}
+	if err := SendToExchange(ec.GetHTTPFactory(), ec.GetExchangeURL(), ec.GetExchangeId(), ec.GetExchangeToken(), OUTBOX_NODE_POLICY, "DELETE", NodePath(deviceId, "/policy"), nil, nil); err != nil {
+		return err
+	} else {
+		glog.V(3).Infof(rpclogString(fmt.Sprintf("deleted device policy for %v from the exchange.", deviceId)))
+		DeleteCacheResource(NODE_POL_TYPE_CACHE, NodeCacheMapKey(GetOrg(deviceId), GetId(deviceId)))
+		return nil
 	}
 }
 
@@ -226,24 +181,17 @@ func GetBusinessPolicies(ec ExchangeContext, org string, policy_id string) (map[
 		targetURL = fmt.Sprintf("%vorgs/%v/business/policies/%v", ec.GetExchangeURL(), org, policy_id)
 	}
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			var pols map[string]ExchangeBusinessPolicy
 			if resp != nil {
@@ -265,6 +213,7 @@ func GetPolicyNodes(ec ExchangeContext, policyOrg string, policyName string, req
 	var resp interface{}
 	resp = new(SearchExchBusinessPolResponse)
 	targetURL := ec.GetExchangeURL() + "orgs/" + policyOrg + "/business/policies/" + policyName + "/search"
+	retry := NewRetryPolicy(0, 10)
 	for {
 		// TODO: Need special handling for a 409 because the session is invalid (or old).
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "POST", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), *req, &resp); err != nil {
@@ -275,7 +224,7 @@ func GetPolicyNodes(ec ExchangeContext, policyOrg string, policyName string, req
 			}
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			retry.Backoff(tpErr)
 			continue
 		} else {
 			return resp.(*SearchExchBusinessPolResponse), nil
@@ -0,0 +1,334 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// All calls to the exchange are retried the same way when they fail because the exchange cannot be reached or is
+// overloaded. The time between retries grows exponentially with random jitter, so that a large number of nodes do not
+// retry in step when the exchange comes back after an outage, and a Retry-After header sent by the exchange is honored.
+// Each exchange URL has a circuit breaker. After several consecutive failures the breaker opens and calls to that URL
+// fail immediately without being sent, which takes the load off an exchange that is struggling. After a while, one call
+// is let through to test whether the exchange has recovered, and the breaker closes when it succeeds.
+
+// The states of a circuit breaker.
+const (
+	BREAKER_CLOSED    = "closed"
+	BREAKER_OPEN      = "open"
+	BREAKER_HALF_OPEN = "half-open"
+)
+
+var retryPolicyLock sync.Mutex
+var retryPolicy = config.ExchangeRetryConfig{}.WithDefaults()
+
+// Set the policy used to retry calls to the exchange. Anax sets it from the configuration when it starts, the defaults
+// are used until then.
+func SetRetryPolicy(policy config.ExchangeRetryConfig) {
+	retryPolicyLock.Lock()
+	defer retryPolicyLock.Unlock()
+	retryPolicy = policy.WithDefaults()
+}
+
+func getRetryPolicy() config.ExchangeRetryConfig {
+	retryPolicyLock.Lock()
+	defer retryPolicyLock.Unlock()
+	return retryPolicy
+}
+
+// These are replaced in tests.
+var retrySleep = time.Sleep
+var breakerNow = time.Now
+
+// The error returned for a call to the exchange that failed because the exchange could not be reached or is
+// overloaded. The call can be retried.
+type TransportError struct {
+	msg         string
+	RetryAfter  time.Duration // The time the exchange asked the caller to wait, or the time until the circuit breaker lets a call through.
+	breakerOpen bool
+}
+
+func (e *TransportError) Error() string {
+	return e.msg
+}
+
+// Returns a transport error for a response from the exchange, which can be nil if no response was received.
+func NewTransportError(msg string, httpResp *http.Response) *TransportError {
+	return &TransportError{msg: msg, RetryAfter: RetryAfter(httpResp)}
+}
+
+// Returns true if the call was not sent because the circuit breaker for the exchange URL is open.
+func (e *TransportError) IsBreakerOpen() bool {
+	return e.breakerOpen
+}
+
+// Returns how long the response asks the caller to wait before trying again, from the Retry-After header, which holds
+// either a number of seconds or a date. Returns 0 if there is no such header.
+func RetryAfter(httpResp *http.Response) time.Duration {
+	if httpResp == nil {
+		return 0
+	}
+	header := httpResp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	} else if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil && date.After(time.Now()) {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// Retry keeps track of the retries of one call to the exchange. Create one before the first attempt and call Backoff
+// after each transport error.
+type Retry struct {
+	retryCount int           // The number of retries allowed, 0 means retry forever.
+	remaining  int           // The number of retries left.
+	interval   time.Duration // The time to wait before the first retry.
+	attempt    int           // The number of retries so far.
+}
+
+// Create a retry for a call that uses the retry count and retry interval of the HTTP client factory.
+func NewRetry(httpClientFactory *config.HTTPClientFactory) *Retry {
+	return NewRetryPolicy(httpClientFactory.RetryCount, httpClientFactory.GetRetryInterval())
+}
+
+// Create a retry that allows the number of retries, 0 means retry forever, starting with the interval in seconds.
+func NewRetryPolicy(retryCount int, retryIntervalS int) *Retry {
+	return &Retry{
+		retryCount: retryCount,
+		remaining:  retryCount,
+		interval:   time.Duration(retryIntervalS) * time.Second,
+	}
+}
+
+func (r *Retry) String() string {
+	return fmt.Sprintf("RetryCount: %v, Remaining: %v, Interval: %v, Attempt: %v", r.retryCount, r.remaining, r.interval, r.attempt)
+}
+
+// Wait before retrying the call that failed with the transport error. Returns false, without waiting, when the call
+// should not be retried because there are no retries left. A call with a limited number of retries is not retried when
+// the circuit breaker is open, so that it fails quickly rather than waiting for the exchange to recover.
+func (r *Retry) Backoff(tpErr error) bool {
+	var retryAfter time.Duration
+	if te, ok := tpErr.(*TransportError); ok {
+		if te.breakerOpen && r.retryCount != 0 {
+			return false
+		}
+		retryAfter = te.RetryAfter
+	}
+
+	if r.retryCount != 0 {
+		if r.remaining == 0 {
+			return false
+		}
+		r.remaining--
+	}
+
+	delay := r.NextDelay(retryAfter)
+	glog.V(5).Infof(rpclogString(fmt.Sprintf("retrying in %v, %v", delay, r)))
+	retrySleep(delay)
+	return true
+}
+
+// Returns the time to wait before the next retry and counts the retry. The time is at least the time the exchange
+// asked for.
+func (r *Retry) NextDelay(retryAfter time.Duration) time.Duration {
+	policy := getRetryPolicy()
+
+	delay := float64(r.interval) * math.Pow(policy.Multiplier, float64(r.attempt))
+	if max := float64(time.Duration(policy.MaxIntervalS) * time.Second); delay > max {
+		delay = max
+	}
+	if policy.JitterPercent > 0 {
+		jitter := delay * float64(policy.JitterPercent) / 100
+		delay += jitter * (2*rand.Float64() - 1)
+	}
+	r.attempt++
+
+	if d := time.Duration(delay); d > retryAfter {
+		return d
+	}
+	return retryAfter
+}
+
+// The circuit breaker for one exchange URL.
+type CircuitBreaker struct {
+	lock      sync.Mutex
+	url       string
+	state     string
+	failures  int       // The number of consecutive failures.
+	openUntil time.Time // When an open breaker lets a call through.
+	probing   bool      // A call is testing the exchange while the breaker is half open.
+	lastError string
+	changed   time.Time
+}
+
+// The state of a circuit breaker, as shown in the node and agbot status.
+type CircuitBreakerState struct {
+	URL       string `json:"url"`
+	State     string `json:"state"`
+	Failures  int    `json:"consecutive_failures"`
+	LastError string `json:"last_error,omitempty"`
+	Changed   uint64 `json:"state_changed"`
+	OpenUntil uint64 `json:"open_until,omitempty"`
+}
+
+func (s CircuitBreakerState) String() string {
+	return fmt.Sprintf("URL: %v, State: %v, Failures: %v, LastError: %v, Changed: %v, OpenUntil: %v", s.URL, s.State, s.Failures, s.LastError, s.Changed, s.OpenUntil)
+}
+
+var breakersLock sync.Mutex
+var breakers = make(map[string]*CircuitBreaker)
+
+// Returns the circuit breaker for the scheme and host of the URL, creating it if needed.
+func getCircuitBreaker(req *http.Request) *CircuitBreaker {
+	key := req.URL.Scheme + "://" + req.URL.Host
+
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+	b, ok := breakers[key]
+	if !ok {
+		b = &CircuitBreaker{url: key, state: BREAKER_CLOSED, changed: breakerNow()}
+		breakers[key] = b
+	}
+	return b
+}
+
+// Returns the state of the circuit breaker of each exchange URL that has been called, sorted by URL.
+func GetCircuitBreakers() []CircuitBreakerState {
+	breakersLock.Lock()
+	all := make([]*CircuitBreaker, 0, len(breakers))
+	for _, b := range breakers {
+		all = append(all, b)
+	}
+	breakersLock.Unlock()
+
+	states := make([]CircuitBreakerState, 0, len(all))
+	for _, b := range all {
+		states = append(states, b.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].URL < states[j].URL })
+	return states
+}
+
+func (b *CircuitBreaker) State() CircuitBreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state := CircuitBreakerState{
+		URL:       b.url,
+		State:     b.state,
+		Failures:  b.failures,
+		LastError: b.lastError,
+		Changed:   uint64(b.changed.Unix()),
+	}
+	if b.state == BREAKER_OPEN {
+		state.OpenUntil = uint64(b.openUntil.Unix())
+	}
+	return state
+}
+
+// Returns true if a call can be sent. Otherwise the time until the breaker lets a call through is returned.
+func (b *CircuitBreaker) allow(policy config.ExchangeRetryConfig) (bool, time.Duration) {
+	if !policy.IsBreakerEnabled() {
+		return true, 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := breakerNow()
+	switch b.state {
+	case BREAKER_OPEN:
+		if now.Before(b.openUntil) {
+			return false, b.openUntil.Sub(now)
+		}
+		b.setState(BREAKER_HALF_OPEN, now)
+		b.probing = true
+		return true, 0
+	case BREAKER_HALF_OPEN:
+		// Only one call tests the exchange, the others wait for it.
+		if b.probing {
+			return false, time.Duration(policy.BreakerOpenS) * time.Second
+		}
+		b.probing = true
+		return true, 0
+	}
+	return true, 0
+}
+
+// Record the outcome of a call that was sent.
+func (b *CircuitBreaker) record(policy config.ExchangeRetryConfig, failure error) {
+	if !policy.IsBreakerEnabled() {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := breakerNow()
+	b.probing = false
+	if failure == nil {
+		b.failures = 0
+		if b.state != BREAKER_CLOSED {
+			glog.Infof(rpclogString(fmt.Sprintf("circuit breaker for %v closed, the exchange has recovered", b.url)))
+			b.setState(BREAKER_CLOSED, now)
+		}
+		return
+	}
+
+	b.failures++
+	b.lastError = failure.Error()
+	if b.state == BREAKER_HALF_OPEN || b.failures >= policy.BreakerThreshold {
+		if b.state != BREAKER_OPEN {
+			glog.Warningf(rpclogString(fmt.Sprintf("circuit breaker for %v opened after %v consecutive failures, last error: %v", b.url, b.failures, failure)))
+		}
+		b.openUntil = now.Add(time.Duration(policy.BreakerOpenS) * time.Second)
+		b.setState(BREAKER_OPEN, now)
+	}
+}
+
+func (b *CircuitBreaker) setState(state string, now time.Time) {
+	if b.state != state {
+		b.state = state
+		b.changed = now
+	}
+}
+
+// Send the request through the circuit breaker of its URL. If the breaker is open the request is not sent, and a
+// *TransportError is returned. Otherwise the response and error are the ones returned by the client, and a transport
+// error, as decided by IsTransportError, is counted by the breaker.
+func DoWithBreaker(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	policy := getRetryPolicy()
+	b := getCircuitBreaker(req)
+
+	if ok, wait := b.allow(policy); !ok {
+		return nil, &TransportError{
+			msg:         fmt.Sprintf("circuit breaker for %v is %v, the request was not sent", b.url, b.State().State),
+			RetryAfter:  wait,
+			breakerOpen: true,
+		}
+	}
+
+	httpResp, err := httpClient.Do(req)
+	if IsTransportError(httpResp, err) {
+		failure := err
+		if failure == nil {
+			failure = errors.New(fmt.Sprintf("HTTP status %v", httpResp.Status))
+		}
+		b.record(policy, failure)
+	} else {
+		b.record(policy, nil)
+	}
+	return httpResp, err
+}
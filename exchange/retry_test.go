@@ -0,0 +1,147 @@
+// +build unit
+
+package exchange
+
+import (
+	"github.com/open-horizon/anax/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_Retry_Backoff(t *testing.T) {
+	SetRetryPolicy(config.ExchangeRetryConfig{MaxIntervalS: 8, Multiplier: 2, JitterPercent: -1})
+	defer SetRetryPolicy(config.ExchangeRetryConfig{})
+
+	slept := make([]time.Duration, 0)
+	retrySleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { retrySleep = time.Sleep }()
+
+	// The interval doubles up to the maximum, and a longer Retry-After is honored.
+	retry := NewRetryPolicy(5, 2)
+	for i := 0; i < 4; i++ {
+		if !retry.Backoff(&TransportError{msg: "unavailable"}) {
+			t.Fatalf("expected retry %v to be allowed", i)
+		}
+	}
+	retry.Backoff(&TransportError{msg: "too many requests", RetryAfter: 20 * time.Second})
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second, 20 * time.Second}
+	if len(slept) != len(expected) {
+		t.Fatalf("expected delays %v, got %v", expected, slept)
+	}
+	for i := range expected {
+		if slept[i] != expected[i] {
+			t.Errorf("expected delays %v, got %v", expected, slept)
+			break
+		}
+	}
+
+	// The retries are used up.
+	if retry.Backoff(&TransportError{msg: "unavailable"}) {
+		t.Errorf("expected no retries left")
+	}
+
+	// A limited retry fails fast when the breaker is open, an unlimited one waits.
+	if NewRetryPolicy(3, 1).Backoff(&TransportError{msg: "open", breakerOpen: true}) {
+		t.Errorf("expected no retry when the breaker is open")
+	} else if !NewRetryPolicy(0, 1).Backoff(&TransportError{msg: "open", breakerOpen: true}) {
+		t.Errorf("expected an unlimited retry when the breaker is open")
+	}
+}
+
+func Test_Retry_jitter(t *testing.T) {
+	SetRetryPolicy(config.ExchangeRetryConfig{MaxIntervalS: 100, Multiplier: 1, JitterPercent: 20})
+	defer SetRetryPolicy(config.ExchangeRetryConfig{})
+
+	retry := NewRetryPolicy(0, 10)
+	for i := 0; i < 50; i++ {
+		if d := retry.NextDelay(0); d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("expected the delay to be within 20 percent of 10s, got %v", d)
+		}
+	}
+}
+
+func Test_RetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	if RetryAfter(nil) != 0 || RetryAfter(resp) != 0 {
+		t.Errorf("expected no wait without a Retry-After header")
+	}
+
+	resp.Header.Set("Retry-After", "30")
+	if d := RetryAfter(resp); d != 30*time.Second {
+		t.Errorf("expected 30s, got %v", d)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if d := RetryAfter(resp); d < 50*time.Second || d > time.Minute {
+		t.Errorf("expected about a minute, got %v", d)
+	}
+}
+
+func Test_DoWithBreaker(t *testing.T) {
+	SetRetryPolicy(config.ExchangeRetryConfig{BreakerThreshold: 2, BreakerOpenS: 30})
+	defer SetRetryPolicy(config.ExchangeRetryConfig{})
+
+	now := time.Now()
+	breakerNow = func() time.Time { return now }
+	defer func() { breakerNow = time.Now }()
+
+	status := http.StatusServiceUnavailable
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	send := func() error {
+		req, _ := http.NewRequest("GET", server.URL+"/v1/orgs", nil)
+		resp, err := DoWithBreaker(server.Client(), req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// The breaker opens after the threshold of consecutive failures.
+	send()
+	send()
+	if state := getBreakerState(server.URL); state.State != BREAKER_OPEN || state.Failures != 2 {
+		t.Fatalf("expected the breaker to be open, got %v", state)
+	}
+
+	// Calls are not sent while the breaker is open.
+	if err := send(); err == nil {
+		t.Errorf("expected an error when the breaker is open")
+	} else if te, ok := err.(*TransportError); !ok || !te.IsBreakerOpen() || te.RetryAfter != 30*time.Second {
+		t.Errorf("expected a breaker open error, got %v", err)
+	} else if calls != 2 {
+		t.Errorf("expected the call not to be sent, got %v calls", calls)
+	}
+
+	// After the open time one call tests the exchange, and the breaker opens again when it fails.
+	now = now.Add(31 * time.Second)
+	send()
+	if state := getBreakerState(server.URL); state.State != BREAKER_OPEN || calls != 3 {
+		t.Fatalf("expected the breaker to open again, got %v after %v calls", state, calls)
+	}
+
+	// The breaker closes when the test call succeeds.
+	now = now.Add(31 * time.Second)
+	status = http.StatusOK
+	if err := send(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if state := getBreakerState(server.URL); state.State != BREAKER_CLOSED || state.Failures != 0 {
+		t.Errorf("expected the breaker to be closed, got %v", state)
+	}
+}
+
+func getBreakerState(url string) CircuitBreakerState {
+	for _, state := range GetCircuitBreakers() {
+		if state.URL == url {
+			return state
+		}
+	}
+	return CircuitBreakerState{}
+}
@@ -2,7 +2,7 @@ package exchange
 
 import (
 	"bytes"
-	"crypto/rsa"
+	"crypto"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -178,24 +178,17 @@ func GetExchangeDevice(httpClientFactory *config.HTTPClientFactory, deviceId str
 		return cachedResource, nil
 	}
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := NewRetry(httpClientFactory)
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "GET", targetURL, credId, credPasswd, nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", httpClientFactory.RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			devs := resp.(*GetDevicesResponse).Devices
 			if dev, there := devs[deviceId]; !there {
@@ -219,23 +212,16 @@ func PutExchangeDevice(httpClientFactory *config.HTTPClientFactory, deviceId str
 
 	cachedNode := DeleteCacheNodeWriteThru(GetOrg(deviceId), GetId(deviceId))
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := NewRetry(httpClientFactory)
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "PUT", targetURL, deviceId, deviceToken, pdr, &resp); err != nil {
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", httpClientFactory.RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(3).Infof(rpclogString(fmt.Sprintf("put device %v to exchange %v", deviceId, pdr)))
 			if cachedNode != nil {
@@ -255,23 +241,28 @@ func PatchExchangeDevice(httpClientFactory *config.HTTPClientFactory, deviceId s
 
 	cachedNode := DeleteCacheNodeWriteThru(GetOrg(deviceId), GetId(deviceId))
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	// The user input is queued in the outbox if the exchange cannot be reached, the other fields are always sent directly.
+	if pdr.UserInput != nil && pdr.Pattern == nil && pdr.Arch == nil && pdr.RegisteredServices == nil {
+		if err := SendToExchange(httpClientFactory, exchangeUrl, deviceId, deviceToken, OUTBOX_NODE_USERINPUT, "PATCH", NodePath(deviceId, ""), pdr, &resp); err != nil {
+			return err
+		}
+		glog.V(3).Infof(rpclogString(fmt.Sprintf("patch device %v to exchange %v", deviceId, pdr.ShortString())))
+		if cachedNode != nil {
+			UpdateCacheNodePatchWriteThru(GetOrg(deviceId), GetId(deviceId), cachedNode, pdr)
+		}
+		return nil
+	}
+
+	retry := NewRetry(httpClientFactory)
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "PATCH", targetURL, deviceId, deviceToken, pdr, &resp); err != nil {
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return fmt.Errorf("Exceeded %v retries for error: %v", httpClientFactory.RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(3).Infof(rpclogString(fmt.Sprintf("patch device %v to exchange %v", deviceId, pdr.ShortString())))
 			if cachedNode != nil {
@@ -302,24 +293,17 @@ func GetNodeStatus(ec ExchangeContext, deviceId string) (*NodeStatus, error) {
 
 	targetURL := fmt.Sprintf("%vorgs/%v/nodes/%v/status", ec.GetExchangeURL(), GetOrg(deviceId), GetId(deviceId))
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(5).Infof(rpclogString(fmt.Sprintf("returning node status %v for %v.", resp, deviceId)))
 			nodeStatus := resp.(*NodeStatus)
@@ -478,12 +462,12 @@ func CreatePostMessage(msg []byte, ttl int) *PostMessage {
 
 type ExchangeMessageTarget struct {
 	ReceiverExchangeId     string // in the form org/id
-	ReceiverPublicKeyObj   *rsa.PublicKey
+	ReceiverPublicKeyObj   crypto.PublicKey
 	ReceiverPublicKeyBytes []byte
 	ReceiverMsgEndPoint    string
 }
 
-func CreateMessageTarget(receiverId string, receiverPubKey *rsa.PublicKey, receiverPubKeySerialized []byte, receiverMessageEndpoint string) (*ExchangeMessageTarget, error) {
+func CreateMessageTarget(receiverId string, receiverPubKey crypto.PublicKey, receiverPubKeySerialized []byte, receiverMessageEndpoint string) (*ExchangeMessageTarget, error) {
 	if len(receiverMessageEndpoint) == 0 && receiverPubKey == nil && len(receiverPubKeySerialized) == 0 {
 		return nil, errors.New(fmt.Sprintf("Must specify either one of the public key inputs OR the message endpoint input for the message receiver %v", receiverId))
 	} else if len(receiverMessageEndpoint) != 0 && (receiverPubKey != nil || len(receiverPubKeySerialized) != 0) {
@@ -578,8 +562,7 @@ func Heartbeat(httpClientFactory *config.HTTPClientFactory, url string, id strin
 	var resp interface{}
 	resp = new(PostDeviceResponse)
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := NewRetry(httpClientFactory)
 
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "POST", url, id, token, nil, &resp); err != nil {
@@ -587,16 +570,10 @@ func Heartbeat(httpClientFactory *config.HTTPClientFactory, url string, id strin
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return tpErr
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(5).Infof(rpclogString(fmt.Sprintf("Sent heartbeat %v: %v", url, resp)))
 			break
@@ -692,24 +669,17 @@ func GetOrganization(httpClientFactory *config.HTTPClientFactory, org string, ex
 	// Search the exchange for the organization definition
 	targetURL := fmt.Sprintf("%vorgs/%v", exURL, org)
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := NewRetry(httpClientFactory)
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "GET", targetURL, id, token, nil, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", httpClientFactory.RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			orgs := resp.(*GetOrganizationResponse).Orgs
 			if theOrg, ok := orgs[org]; !ok {
@@ -785,24 +755,17 @@ func GetNodeHealthStatus(httpClientFactory *config.HTTPClientFactory, pattern st
 		targetURL = fmt.Sprintf("%vorgs/%v/patterns/%v/nodehealth", exURL, GetOrg(pattern), GetId(pattern))
 	}
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := NewRetry(httpClientFactory)
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "POST", targetURL, id, token, &params, &resp); err != nil && !strings.Contains(err.Error(), "status: 404") {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", httpClientFactory.RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			status := resp.(*NodeHealthStatus)
 			glog.V(3).Infof(rpclogString(fmt.Sprintf("found nodehealth status for %v, status %v", pattern, status)))
@@ -822,24 +785,17 @@ func GetSurfaceErrors(ec ExchangeContext, deviceId string) (*ExchangeSurfaceErro
 
 	targetURL := fmt.Sprintf("%vorgs/%v/nodes/%v/errors", ec.GetExchangeURL(), GetOrg(deviceId), GetId(deviceId))
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(5).Infof(rpclogString(fmt.Sprintf("returning node surface errors %v for %v.", resp, deviceId)))
 			surfaceErrors := resp.(*ExchangeSurfaceError)
@@ -853,29 +809,11 @@ func PutSurfaceErrors(ec ExchangeContext, deviceId string, errorList *ExchangeSu
 	var resp interface{}
 	resp = new(PutDeviceResponse)
 
-	targetURL := fmt.Sprintf("%vorgs/%v/nodes/%v/errors", ec.GetExchangeURL(), GetOrg(deviceId), GetId(deviceId))
-
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
-	for {
-		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "PUT", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), errorList, &resp); err != nil {
-			return nil, err
-		} else if tpErr != nil {
-			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
-				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			}
-		} else {
-			glog.V(3).Infof(rpclogString(fmt.Sprintf("put node surface errors for %v to exchange %v", deviceId, errorList)))
-			return resp.(*PutDeviceResponse), nil
-		}
+	if err := SendToExchange(ec.GetHTTPFactory(), ec.GetExchangeURL(), ec.GetExchangeId(), ec.GetExchangeToken(), OUTBOX_SURFACE_ERRORS, "PUT", NodePath(deviceId, "/errors"), errorList, &resp); err != nil {
+		return nil, err
+	} else {
+		glog.V(3).Infof(rpclogString(fmt.Sprintf("put node surface errors for %v to exchange %v", deviceId, errorList)))
+		return resp.(*PutDeviceResponse), nil
 	}
 }
 
@@ -885,24 +823,17 @@ func DeleteSurfaceErrors(ec ExchangeContext, deviceId string) error {
 
 	targetURL := fmt.Sprintf("%vorgs/%v/nodes/%v/errors", ec.GetExchangeURL(), GetOrg(deviceId), GetId(deviceId))
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "DELETE", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil && !strings.Contains(err.Error(), "status: 404") {
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(3).Infof(rpclogString(fmt.Sprintf("deleted node surface errors for %v to exchange", deviceId)))
 			return nil
@@ -938,8 +869,9 @@ func InvokeExchange(httpClient *http.Client, method string, urlPath string, user
 	}
 
 	requestBody := bytes.NewBuffer(nil)
+	var jsonBytes []byte
 	if params != nil {
-		if jsonBytes, err := json.Marshal(params); err != nil {
+		if jsonBytes, err = json.Marshal(params); err != nil {
 			return errors.New(fmt.Sprintf("Invocation of %v at %v with %v failed marshalling to json, error: %v", method, urlPath, params, err)), nil
 		} else {
 			requestBody = bytes.NewBuffer(jsonBytes)
@@ -958,14 +890,22 @@ func InvokeExchange(httpClient *http.Client, method string, urlPath string, user
 			req.Header.Add("Authorization", fmt.Sprintf("Basic %v", base64.StdEncoding.EncodeToString([]byte(user+":"+pw))))
 		}
 
-		// If the exchange is down, this call will return an error.
-		httpResp, err := httpClient.Do(req)
+		// If the exchange is down, this call will return an error. It is not sent at all while the circuit breaker
+		// for the exchange is open.
+		start := time.Now()
+		httpResp, err := DoWithBreaker(httpClient, req)
+		recordExchangeRequest(method, urlObj.Path, httpResp, err, start)
+		auditExchangeRequest(method, urlObj.Path, user, jsonBytes, httpResp, err)
 		if IsTransportError(httpResp, err) {
+			if te, ok := err.(*TransportError); ok {
+				return nil, te
+			}
 			status := ""
 			if httpResp != nil {
 				status = httpResp.Status
+				httpResp.Body.Close()
 			}
-			return nil, errors.New(fmt.Sprintf("Invocation of %v at %v with %v failed invoking HTTP request, error: %v, HTTP Status: %v", method, urlPath, requestBody, err, status))
+			return nil, NewTransportError(fmt.Sprintf("Invocation of %v at %v with %v failed invoking HTTP request, error: %v, HTTP Status: %v", method, urlPath, requestBody, err, status), httpResp)
 		} else if err != nil {
 			return errors.New(fmt.Sprintf("Invocation of %v at %v with %v failed invoking HTTP request, error: %v", method, urlPath, requestBody, err)), nil
 		} else {
@@ -981,7 +921,7 @@ func InvokeExchange(httpClient *http.Client, method string, urlPath string, user
 
 			// Handle special case of server error
 			if httpResp.StatusCode == http.StatusInternalServerError && strings.Contains(string(outBytes), "timed out") {
-				return nil, errors.New(fmt.Sprintf("Invocation of %v at %v with %v failed invoking HTTP request, error: %v", method, urlPath, requestBody, err))
+				return nil, NewTransportError(fmt.Sprintf("Invocation of %v at %v with %v failed invoking HTTP request, error: %v", method, urlPath, requestBody, err), httpResp)
 			}
 
 			if method == "GET" && httpResp.StatusCode != http.StatusOK {
@@ -1108,7 +1048,9 @@ func InvokeExchange(httpClient *http.Client, method string, urlPath string, user
 }
 
 func IsTransportError(pResp *http.Response, err error) bool {
-	if err != nil {
+	if _, ok := err.(*TransportError); ok {
+		return true
+	} else if err != nil {
 		if strings.Contains(err.Error(), ": EOF") {
 			return true
 		}
@@ -1131,6 +1073,9 @@ func IsTransportError(pResp *http.Response, err error) bool {
 		} else if pResp.StatusCode == http.StatusServiceUnavailable {
 			//503: service unavailable
 			return true
+		} else if pResp.StatusCode == http.StatusTooManyRequests {
+			// 429: too many requests, the exchange is overloaded
+			return true
 		}
 	}
 	return false
@@ -1154,24 +1099,17 @@ func GetExchangeVersion(httpClientFactory *config.HTTPClientFactory, exchangeUrl
 		return exchVers, nil
 	}
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := NewRetry(httpClientFactory)
 	for {
 		if err, tpErr := InvokeExchange(httpClientFactory.NewHTTPClient(nil), "GET", targetURL, id, token, nil, &resp); err != nil {
 			glog.Errorf(err.Error())
 			return "", err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return "", fmt.Errorf("Exceeded %v retries for error: %v", httpClientFactory.RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			// remove last return charactor if any
 			v := resp.(string)
@@ -1242,24 +1180,17 @@ func GetObjectSigningKeys(ec ExchangeContext, oType string, oURL string, oOrg st
 
 	key_names := make([]string, 0)
 
-	retryCount := ec.GetHTTPFactory().RetryCount
-	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	retry := NewRetry(ec.GetHTTPFactory())
 	for {
 		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp_KeyNames); err != nil {
 			glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-			if ec.GetHTTPFactory().RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			if resp_KeyNames.(string) != "" {
 				glog.V(5).Infof(rpclogString(fmt.Sprintf("found object signing keys %v.", resp_KeyNames)))
@@ -1278,24 +1209,17 @@ func GetObjectSigningKeys(ec ExchangeContext, oType string, oURL string, oOrg st
 		var resp_KeyContent interface{}
 		resp_KeyContent = ""
 
-		retryCount := ec.GetHTTPFactory().RetryCount
-		retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+		retry := NewRetry(ec.GetHTTPFactory())
 		for {
 			if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", fmt.Sprintf("%v/%v", targetURL, key), ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp_KeyContent); err != nil {
 				glog.Errorf(rpclogString(fmt.Sprintf(err.Error())))
 				return nil, err
 			} else if tpErr != nil {
 				glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
-				if ec.GetHTTPFactory().RetryCount == 0 {
-					time.Sleep(time.Duration(retryInterval) * time.Second)
-					continue
-				} else if retryCount == 0 {
+				if !retry.Backoff(tpErr) {
 					return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
-				} else {
-					retryCount--
-					time.Sleep(time.Duration(retryInterval) * time.Second)
-					continue
 				}
+				continue
 			} else {
 				if resp_KeyContent.(string) != "" {
 					glog.V(5).Infof(rpclogString(fmt.Sprintf("found signing key content for key %v: %v.", key, resp_KeyContent)))
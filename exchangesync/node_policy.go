@@ -227,7 +227,9 @@ func SetDefaultNodePolicy(config *config.HorizonConfig, pDevice *persistence.Exc
 
 	// upload the node policy on the exchange
 	_, err = putExchangeNodePolicy(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), &exchange.ExchangePolicy{ExternalPolicy: *nodePolicy})
-	if err != nil {
+	if exchange.IsOutboxQueued(err) {
+		return nodePolicy, saveQueuedNodePolicy(db, nodePolicy, err)
+	} else if err != nil {
 		return nil, fmt.Errorf("Unable to save node policy in exchange. %v", err)
 	}
 
@@ -336,7 +338,7 @@ func DeleteNodePolicy(pDevice *persistence.ExchangeDevice, db *bolt.DB,
 
 	// delete the node policy from the exchange if it exists
 	if nodePolicy != nil {
-		if err := deleteExchangeNodePolicy(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id)); err != nil {
+		if err := deleteExchangeNodePolicy(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id)); err != nil && !exchange.IsOutboxQueued(err) {
 			return fmt.Errorf("Node policy could not be deleted from the exchange. %v", err)
 		}
 	}
@@ -382,7 +384,9 @@ func UpdateNodePolicy(pDevice *persistence.ExchangeDevice, db *bolt.DB, nodePoli
 	}
 
 	// save it into the exchange and sync the local db with it.
-	if _, err := nodePutPolicyHandler(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), &exchange.ExchangePolicy{ExternalPolicy: *nodePolicy}); err != nil {
+	if _, err := nodePutPolicyHandler(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), &exchange.ExchangePolicy{ExternalPolicy: *nodePolicy}); exchange.IsOutboxQueued(err) {
+		return saveQueuedNodePolicy(db, nodePolicy, err)
+	} else if err != nil {
 		return fmt.Errorf("Unable to save node policy in exchange, error %v", err)
 	} else if _, _, err := SyncNodePolicyWithExchange(db, pDevice, nodeGetPolicyHandler, nodePutPolicyHandler); err != nil {
 		return fmt.Errorf("Unable to sync the local db with the exchange node policy. %v", err)
@@ -423,7 +427,9 @@ func PatchNodePolicy(pDevice *persistence.ExchangeDevice, db *bolt.DB, patchObje
 	}
 
 	// save it into the exchange and sync the local db with it.
-	if _, err := nodePutPolicyHandler(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), &exchange.ExchangePolicy{ExternalPolicy: *localNodePolicy}); err != nil {
+	if _, err := nodePutPolicyHandler(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), &exchange.ExchangePolicy{ExternalPolicy: *localNodePolicy}); exchange.IsOutboxQueued(err) {
+		return localNodePolicy, saveQueuedNodePolicy(db, localNodePolicy, err)
+	} else if err != nil {
 		return nil, fmt.Errorf("Unable to save node policy in exchange, error %v", err)
 	} else if _, _, err := SyncNodePolicyWithExchange(db, pDevice, nodeGetPolicyHandler, nodePutPolicyHandler); err != nil {
 		return nil, fmt.Errorf("Unable to sync the local db with the exchange node policy. %v", err)
@@ -431,3 +437,13 @@ func PatchNodePolicy(pDevice *persistence.ExchangeDevice, db *bolt.DB, patchObje
 
 	return localNodePolicy, nil
 }
+
+// The node policy could not be saved in the exchange and was queued in the outbox. The local copy is updated now, it
+// will match the exchange copy once the outbox is replayed and the node policy is synced with the exchange again.
+func saveQueuedNodePolicy(db *bolt.DB, nodePolicy *externalpolicy.ExternalPolicy, queuedErr error) error {
+	glog.Warningf("%v", queuedErr)
+	if err := persistence.SaveNodePolicy(db, nodePolicy); err != nil {
+		return fmt.Errorf("unable to save node policy %v to local database. %v", nodePolicy, err)
+	}
+	return nil
+}
@@ -147,7 +147,9 @@ func getAllServicesFromAgreements(db *bolt.DB, serviceResolverHandler exchange.S
 func PutExchangeSurfaceErrors(pDevice *persistence.ExchangeDevice, putErrors exchange.PutSurfaceErrorsHandler, errors []persistence.SurfaceError) error {
 	errorList := exchange.ExchangeSurfaceError{ErrorList: errors}
 	_, err := putErrors(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), &errorList)
-	if err != nil {
+	if exchange.IsOutboxQueued(err) {
+		glog.Warningf("%v", err)
+	} else if err != nil {
 		return err
 	}
 
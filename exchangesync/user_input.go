@@ -376,7 +376,11 @@ func SaveNodeUserInput(pDevice *persistence.ExchangeDevice, db *bolt.DB,
 	pdr.UserInput = &userInputs
 
 	glog.V(3).Infof("Updating exchange with new user input: %v.", pdr.ShortString())
-	if err := patchDevice(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), pDevice.Token, &pdr); err != nil {
+	queued := false
+	if err := patchDevice(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), pDevice.Token, &pdr); exchange.IsOutboxQueued(err) {
+		glog.Warningf("%v", err)
+		queued = true
+	} else if err != nil {
 		return err
 	}
 
@@ -386,6 +390,11 @@ func SaveNodeUserInput(pDevice *persistence.ExchangeDevice, db *bolt.DB,
 		return fmt.Errorf("Failed save user input %v to local db. %v", userInputs, err)
 	}
 
+	// The hash is saved when the node syncs with the exchange after the outbox is replayed.
+	if queued {
+		return nil
+	}
+
 	// get the node user input from the exchange do that we can get an accurate hash
 	newExchDevice, err := getDevice(fmt.Sprintf("%v/%v", pDevice.Org, pDevice.Id), pDevice.Token)
 	if err != nil {
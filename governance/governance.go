@@ -19,7 +19,6 @@ import (
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/producer"
 	"github.com/open-horizon/anax/worker"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -37,6 +36,8 @@ const MICROSERVICE_GOVERNOR = "MicroserviceGovernor"
 const BC_GOVERNOR = "BlockchainGovernor"
 const SURFACEERRORS = "SurfaceExchErrors"
 const NODESTATUS = "NodeStatus"
+const EVENTLOG_PRUNER = "EventLogPruner"
+const OUTBOX_REPLAY = "OutboxReplay"
 
 // Keys for the exchange errors cache in the worker
 const EXCHANGE_ERRORS = "ExchangeErrors"
@@ -564,6 +565,17 @@ func (w *GovernanceWorker) governContainers() int {
 	return 0
 }
 
+func (w *GovernanceWorker) pruneEventLogs() int {
+
+	criteria := eventlog.GetPruneCriteria(&w.BaseWorker.Manager.Config.Edge.EventLogRetention)
+	if summary, err := eventlog.PruneEventLogs(w.db, criteria); err != nil {
+		glog.Errorf(logString(fmt.Sprintf("Unable to prune the event log, error: %v", err)))
+	} else if summary.Pruned != 0 {
+		glog.V(3).Infof(logString(fmt.Sprintf("pruned the event log: %v", summary)))
+	}
+	return 0
+}
+
 func (w *GovernanceWorker) reportBlockchains() int {
 
 	// go govern
@@ -749,6 +761,15 @@ func (w *GovernanceWorker) Initialize() bool {
 	// Fire up the microservice governor
 	w.DispatchSubworker(MICROSERVICE_GOVERNOR, w.governMicroservices, 60, false)
 
+	// Send the updates queued in the outbox while the exchange could not be reached. They are also sent before the
+	// next update to the exchange, such as the device status that is reported when the heartbeat is restored.
+	w.DispatchSubworker(OUTBOX_REPLAY, w.replayOutbox, 30, false)
+
+	// Keep the event log within the configured retention limits
+	if retention := w.BaseWorker.Manager.Config.Edge.EventLogRetention; retention.IsEnabled() {
+		w.DispatchSubworker(EVENTLOG_PRUNER, w.pruneEventLogs, retention.PruneIntervalS, false)
+	}
+
 	// for the policy case update the exchange with the latest registeredServices
 	if w.devicePattern == "" {
 		w.UpdateRegisteredServicesWithAgreement()
@@ -1433,7 +1454,7 @@ func (w *GovernanceWorker) finalizeAgreement(agreement persistence.EstablishedAg
 		return errors.New(logString(fmt.Sprintf("could not hydrate proposal, error: %v", err)))
 	} else if tcPolicy, err := policy.DemarshalPolicy(proposal.TsAndCs()); err != nil {
 		return errors.New(logString(fmt.Sprintf("error demarshalling TsAndCs policy for agreement %v, error %v", agreement.CurrentAgreementId, err)))
-	} else if err := recordProducerAgreementState(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), w.devicePattern, agreement.CurrentAgreementId, tcPolicy, "Finalized Agreement"); err != nil {
+	} else if err := recordProducerAgreementState(w.limitedRetryEC.GetHTTPFactory(), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), w.devicePattern, agreement.CurrentAgreementId, tcPolicy, "Finalized Agreement"); err != nil {
 		return errors.New(logString(fmt.Sprintf("error setting agreement %v finalized state in exchange: %v", agreement.CurrentAgreementId, err)))
 	}
 
@@ -1447,7 +1468,7 @@ func (w *GovernanceWorker) RecordReply(proposal abstractprotocol.Proposal, proto
 		return errors.New(logString(fmt.Sprintf("received error updating database state, %v", err)))
 	} else if tcPolicy, err := policy.DemarshalPolicy(proposal.TsAndCs()); err != nil {
 		return errors.New(logString(fmt.Sprintf("received error demarshalling TsAndCs, %v", err)))
-	} else if err := recordProducerAgreementState(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), w.devicePattern, proposal.AgreementId(), tcPolicy, "Agree to proposal"); err != nil {
+	} else if err := recordProducerAgreementState(w.limitedRetryEC.GetHTTPFactory(), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), w.devicePattern, proposal.AgreementId(), tcPolicy, "Agree to proposal"); err != nil {
 		return errors.New(logString(fmt.Sprintf("received error setting state for agreement %v", err)))
 	} else {
 
@@ -1748,7 +1769,7 @@ func (w *GovernanceWorker) GetServicePreference(url string, org string, tcPolicy
 	return envAdds, nil
 }
 
-func recordProducerAgreementState(httpClient *http.Client, url string, deviceId string, token string, pattern string, agreementId string, pol *policy.Policy, state string) error {
+func recordProducerAgreementState(httpClientFactory *config.HTTPClientFactory, url string, deviceId string, token string, pattern string, agreementId string, pol *policy.Policy, state string) error {
 
 	glog.V(5).Infof(logString(fmt.Sprintf("setting agreement %v state to %v", agreementId, state)))
 
@@ -1773,22 +1794,16 @@ func recordProducerAgreementState(httpClient *http.Client, url string, deviceId
 	as.Services = services
 	as.AgreementService = workload
 
-	// Call the exchange API to set the agreement state.
-	var resp interface{}
-	resp = new(exchange.PostDeviceResponse)
-	targetURL := url + "orgs/" + exchange.GetOrg(deviceId) + "/nodes/" + exchange.GetId(deviceId) + "/agreements/" + agreementId
-	for {
-		if err, tpErr := exchange.InvokeExchange(httpClient, "PUT", targetURL, deviceId, token, &as, &resp); err != nil {
-			glog.Errorf(logString(fmt.Sprintf(err.Error())))
-			return err
-		} else if tpErr != nil {
-			glog.Warningf(logString(tpErr.Error()))
-			time.Sleep(10 * time.Second)
-			continue
-		} else {
-			glog.V(5).Infof(logString(fmt.Sprintf("set agreement %v to state %v", agreementId, state)))
-			return nil
-		}
+	// Call the exchange API to set the agreement state. The state is queued in the outbox if the exchange cannot be reached.
+	if err := exchange.SendToExchange(httpClientFactory, url, deviceId, token, exchange.OUTBOX_AGREEMENT+agreementId, "PUT", exchange.NodePath(deviceId, "/agreements/"+agreementId), &as, nil); exchange.IsOutboxQueued(err) {
+		glog.Warningf(logString(err.Error()))
+		return nil
+	} else if err != nil {
+		glog.Errorf(logString(fmt.Sprintf(err.Error())))
+		return err
+	} else {
+		glog.V(5).Infof(logString(fmt.Sprintf("set agreement %v to state %v", agreementId, state)))
+		return nil
 	}
 
 }
@@ -1797,33 +1812,16 @@ func (w *GovernanceWorker) deleteProducerAgreement(url string, deviceId string,
 
 	glog.V(5).Infof(logString(fmt.Sprintf("deleting agreement %v in exchange", agreementId)))
 
-	httpClientFactory := w.GetHTTPFactory()
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
-
-	var resp interface{}
-	resp = new(exchange.PostDeviceResponse)
-	targetURL := url + "orgs/" + exchange.GetOrg(deviceId) + "/nodes/" + exchange.GetId(deviceId) + "/agreements/" + agreementId
-	for {
-		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "DELETE", targetURL, deviceId, token, nil, &resp); err != nil && !strings.Contains(err.Error(), "status: 404") {
-			glog.Errorf(logString(fmt.Sprintf(err.Error())))
-			return err
-		} else if tpErr != nil {
-			glog.Warningf(logString(tpErr.Error()))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
-				return errors.New(fmt.Sprintf("exceeded %v retries trying to delete node for %v", httpClientFactory.RetryCount, tpErr))
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			}
-		} else {
-			glog.V(5).Infof(logString(fmt.Sprintf("deleted agreement %v from exchange", agreementId)))
-			return nil
-		}
+	// The delete replaces any state of the agreement that is still queued in the outbox.
+	if err := exchange.SendToExchange(w.limitedRetryEC.GetHTTPFactory(), url, deviceId, token, exchange.OUTBOX_AGREEMENT+agreementId, "DELETE", exchange.NodePath(deviceId, "/agreements/"+agreementId), nil, nil); exchange.IsOutboxQueued(err) {
+		glog.Warningf(logString(err.Error()))
+		return nil
+	} else if err != nil {
+		glog.Errorf(logString(fmt.Sprintf(err.Error())))
+		return err
+	} else {
+		glog.V(5).Infof(logString(fmt.Sprintf("deleted agreement %v from exchange", agreementId)))
+		return nil
 	}
 }
 
@@ -1831,13 +1829,17 @@ func (w *GovernanceWorker) deleteMessage(msg *exchange.DeviceMessage) error {
 	var resp interface{}
 	resp = new(exchange.PostDeviceResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/nodes/" + exchange.GetId(w.GetExchangeId()) + "/msgs/" + strconv.Itoa(msg.MsgId)
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), "DELETE", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(logString(err.Error()))
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(logString(tpErr.Error()))
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries deleting message %v for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, msg.MsgId, tpErr))
+			}
 			continue
 		} else {
 			glog.V(3).Infof(logString(fmt.Sprintf("deleted message %v", msg.MsgId)))
@@ -1850,13 +1852,17 @@ func (w *GovernanceWorker) messageInExchange(msgId int) (bool, error) {
 	var resp interface{}
 	resp = new(exchange.GetDeviceMessageResponse)
 	targetURL := w.GetExchangeURL() + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/nodes/" + exchange.GetId(w.GetExchangeId()) + "/msgs/" + strconv.Itoa(msgId)
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), "GET", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			glog.Errorf(logString(err.Error()))
 			return false, err
 		} else if tpErr != nil {
 			glog.Warningf(logString(tpErr.Error()))
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return false, errors.New(fmt.Sprintf("exceeded %v retries retrieving message %v for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, msgId, tpErr))
+			}
 			continue
 		} else {
 			msgs := resp.(*exchange.GetDeviceMessageResponse).Messages
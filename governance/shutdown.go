@@ -120,6 +120,12 @@ func (w *GovernanceWorker) nodeShutdown(cmd *NodeShutdownCommand) {
 		return
 	}
 
+	// Discard the updates that are still waiting to be sent to the exchange.
+	if err := persistence.DeleteOutbox(w.db); err != nil {
+		w.completedWithError(logString(err.Error()))
+		return
+	}
+
 	// Delete node policy from local db
 	if err := persistence.DeleteNodePolicy(w.db); err != nil {
 		w.completedWithError(logString(err.Error()))
@@ -394,8 +400,7 @@ func (w *GovernanceWorker) patchNodeKey(httpClientFactory *config.HTTPClientFact
 
 	glog.V(3).Infof(logString(fmt.Sprintf("clearing messaging key in node entry: %v at %v", pdr, targetURL)))
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := exchange.NewRetry(httpClientFactory)
 
 	for {
 		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "PATCH", targetURL, w.GetExchangeId(), w.GetExchangeToken(), pdr, &resp); err != nil {
@@ -406,18 +411,12 @@ func (w *GovernanceWorker) patchNodeKey(httpClientFactory *config.HTTPClientFact
 			}
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				// Break so that the rest of the function can do its cleanup.
 				glog.Errorf(logString(fmt.Sprintf("exceeded %v retries trying to clear node messaging key for %v", httpClientFactory.RetryCount, tpErr)))
 				break
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(3).Infof(logString(fmt.Sprintf("cleared messaging key for device %v in exchange: %v", w.GetExchangeId(), resp)))
 			break
@@ -448,6 +447,8 @@ func (w *GovernanceWorker) patchNodePattern(pattern string) error {
 
 	glog.V(3).Infof(logString(fmt.Sprintf("patch pattern in node entry: %v at %v", pdr, targetURL)))
 
+	retry := exchange.NewRetry(w.Config.Collaborators.HTTPClientFactory)
+
 	for {
 		if err, tpErr := exchange.InvokeExchange(w.Config.Collaborators.HTTPClientFactory.NewHTTPClient(nil), "PATCH", targetURL, w.GetExchangeId(), w.GetExchangeToken(), pdr, &resp); err != nil {
 			if strings.Contains(err.Error(), "status: 401") {
@@ -457,7 +458,9 @@ func (w *GovernanceWorker) patchNodePattern(pattern string) error {
 			}
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			time.Sleep(10 * time.Second)
+			if !retry.Backoff(tpErr) {
+				return errors.New(fmt.Sprintf("exceeded %v retries patching the node pattern for %v", w.Config.Collaborators.HTTPClientFactory.RetryCount, tpErr))
+			}
 			continue
 		} else {
 			glog.V(3).Infof(logString(fmt.Sprintf("parched pattern for device %v in exchange: %v", w.GetExchangeId(), resp)))
@@ -535,24 +538,17 @@ func (w *GovernanceWorker) deleteNode(httpClientFactory *config.HTTPClientFactor
 
 	glog.V(3).Infof(logString(fmt.Sprintf("deleting node %v from exchange", w.GetExchangeId())))
 
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := exchange.NewRetry(httpClientFactory)
 
 	for {
 		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "DELETE", targetURL, w.GetExchangeId(), w.GetExchangeToken(), nil, &resp); err != nil {
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return errors.New(fmt.Sprintf("exceeded %v retries trying to delete node for %v", httpClientFactory.RetryCount, tpErr))
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			break
 		}
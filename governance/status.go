@@ -14,7 +14,6 @@ import (
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"reflect"
-	"time"
 )
 
 type ContainerStatus struct {
@@ -123,7 +122,9 @@ func (w *GovernanceWorker) ReportDeviceStatus() int {
 	if statusChanged {
 		glog.V(5).Infof(logString(fmt.Sprintf("device status to report to the exchange: %v", device_status)))
 
-		if err := w.writeStatusToExchange(&device_status); err != nil {
+		if err := exchange.SendToExchange(w.limitedRetryEC.GetHTTPFactory(), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken(), exchange.OUTBOX_NODE_STATUS, "PUT", exchange.NodePath(w.GetExchangeId(), "/status"), &device_status, nil); exchange.IsOutboxQueued(err) {
+			glog.Warningf(logString(err))
+		} else if err != nil {
 			glog.Errorf(logString(err))
 		}
 		if err := persistence.SaveNodeStatus(w.db, convertToPersistenceType(device_status.Services)); err != nil {
@@ -380,8 +381,7 @@ func (w *GovernanceWorker) writeStatusToExchange(device_status *DeviceStatus) er
 	targetURL := w.Config.Edge.ExchangeURL + "orgs/" + exchange.GetOrg(w.GetExchangeId()) + "/nodes/" + exchange.GetId(w.GetExchangeId()) + "/status"
 
 	httpClientFactory := w.limitedRetryEC.GetHTTPFactory()
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := exchange.NewRetry(httpClientFactory)
 
 	for {
 		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "PUT", targetURL, w.GetExchangeId(), w.GetExchangeToken(), device_status, &resp); err != nil {
@@ -389,16 +389,10 @@ func (w *GovernanceWorker) writeStatusToExchange(device_status *DeviceStatus) er
 			return err
 		} else if tpErr != nil {
 			glog.Warningf(tpErr.Error())
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return fmt.Errorf(logString(fmt.Sprintf("exceeded %v retries trying to write node status for %v", httpClientFactory.RetryCount, tpErr)))
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			glog.V(5).Infof(logString(fmt.Sprintf("saved device status to the exchange")))
 			return nil
@@ -406,6 +400,16 @@ func (w *GovernanceWorker) writeStatusToExchange(device_status *DeviceStatus) er
 	}
 }
 
+// Send the updates that are queued in the outbox, if the exchange can be reached.
+func (w *GovernanceWorker) replayOutbox() int {
+	if pending, err := exchange.ReplayOutbox(w.limitedRetryEC.GetHTTPFactory(), w.GetExchangeURL(), w.GetExchangeId(), w.GetExchangeToken()); err != nil {
+		glog.Errorf(logString(err.Error()))
+	} else if pending != 0 {
+		glog.V(3).Infof(logString(fmt.Sprintf("%v updates are waiting in the outbox", pending)))
+	}
+	return 0
+}
+
 func (w *GovernanceWorker) surfaceErrors() int {
 	pDevice, err := persistence.FindExchangeDevice(w.db)
 	if err != nil {
@@ -421,7 +425,7 @@ func (w *GovernanceWorker) surfaceErrors() int {
 
 	putErrorsHandler := exchange.GetHTTPPutSurfaceErrorsHandler(w.limitedRetryEC)
 	serviceResolverHandler := exchange.GetHTTPServiceResolverHandler(w.limitedRetryEC)
-	return exchangesync.UpdateSurfaceErrors(w.db, *pDevice, currentExchangeErrors.ErrorList, putErrorsHandler, serviceResolverHandler, w.BaseWorker.Manager.Config.Edge.SurfaceErrorTimeoutS, w.BaseWorker.Manager.Config.Edge.SurfaceErrorAgreementPersistentS)
+	return exchangesync.UpdateSurfaceErrors(w.db, *pDevice, currentExchangeErrors.ErrorList, putErrorsHandler, serviceResolverHandler, w.BaseWorker.Manager.Config.GetSurfaceErrorTimeoutS(), w.BaseWorker.Manager.Config.Edge.SurfaceErrorAgreementPersistentS)
 }
 
 func changeInWorkloadStatuses(newStatuses []WorkloadStatus, oldStatuses []persistence.WorkloadStatus) bool {
@@ -59,7 +59,7 @@ func (w *ImageFetchWorker) NewEvent(incoming events.Message) {
 		msg, _ := incoming.(*events.EdgeRegisteredExchangeMessage)
 
 		// stop the container worker for the cluster device type
-		if msg.DeviceType() == persistence.DEVICE_TYPE_CLUSTER {
+		if msg.DeviceType() == persistence.DEVICE_TYPE_CLUSTER && msg.Event().Id == events.NEW_DEVICE_REG {
 			w.Commands <- worker.NewTerminateCommand("cluster node")
 		}
 	case *events.AgreementReachedMessage:
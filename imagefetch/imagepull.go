@@ -9,6 +9,7 @@ import (
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/containermessage"
 	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/metrics"
 	"os"
 	"time"
 )
@@ -19,6 +20,9 @@ const (
 	maxPullAttempts = 3
 )
 
+var imagePullDuration = metrics.NewHistogramVec("anax_image_pull_duration_seconds", "The time taken to pull a container image, including retries.",
+	[]float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}, "result")
+
 // read the given docker file and get the auths
 func dockerCredsFromConfigFile(configFilePath string) (*docker.AuthConfigurations, error) {
 
@@ -117,6 +121,7 @@ func pullImageFromRepos(config config.Config, authConfigs map[string][]docker.Au
 		}
 
 		var err error
+		pullStart := time.Now()
 		if domain == "" {
 			err = pullSingleImageFromRepo(client, opts, docker.AuthConfiguration{})
 		} else if auth_array, ok := authConfigs[domain]; !ok {
@@ -132,9 +137,11 @@ func pullImageFromRepos(config config.Config, authConfigs map[string][]docker.Au
 			}
 		}
 		if err != nil {
+			imagePullDuration.Observe(time.Since(pullStart).Seconds(), "failure")
 			glog.Errorf("Docker image pull(s) failed for docker image %v. Error: %v.", service.Image, err)
 			return err
 		} else {
+			imagePullDuration.Observe(time.Since(pullStart).Seconds(), "success")
 			glog.V(3).Infof("Succeeded fetching image %v for service %v", service.Image, name)
 		}
 	}
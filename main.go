@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/boltdb/bolt"
@@ -9,11 +10,14 @@ import (
 	"github.com/open-horizon/anax/agreementbot"
 	agbotPersistence "github.com/open-horizon/anax/agreementbot/persistence"
 	_ "github.com/open-horizon/anax/agreementbot/persistence/bolt"
+	_ "github.com/open-horizon/anax/agreementbot/persistence/memory"
 	_ "github.com/open-horizon/anax/agreementbot/persistence/postgresql"
 	"github.com/open-horizon/anax/api"
+	"github.com/open-horizon/anax/auditlog"
 	"github.com/open-horizon/anax/changes"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/container"
+	"github.com/open-horizon/anax/eventjournal"
 	"github.com/open-horizon/anax/exchange"
 	_ "github.com/open-horizon/anax/externalpolicy/text_language"
 	"github.com/open-horizon/anax/governance"
@@ -42,6 +46,11 @@ import (
 func main() {
 	configFile := flag.String("config", "/etc/colonus/anax.config", "Config file location")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
+	dbSchema := flag.Bool("dbschema", false, "display the schema version and pending schema migrations of the node database, then exit")
+	migrateOnly := flag.Bool("migrate-only", false, "apply the schema migrations of the agreement bot database, display the schema status, then exit")
+	migrateTarget := flag.Int("migrate-target", -1, "the agreement bot database schema version to migrate to with -migrate-only, -1 is the latest version")
+	migrateDropAll := flag.Bool("migrate-drop-all", false, "confirm that -migrate-target 0 should drop every table in the agreement bot database")
+	printConfig := flag.Bool("print-config", false, "validate the config file and display the effective configuration, with the defaults and environment variables applied and secrets masked, then exit")
 
 	flag.Parse()
 
@@ -56,11 +65,46 @@ func main() {
 		glog.V(2).Infof("Started CPU profiling. Writing to: %v", f.Name())
 	}
 
+	// The config file is validated when it is read, report all the problems with it rather than a stack trace.
 	cfg, err := config.Read(*configFile)
 	if err != nil {
-		panic(err)
+		glog.Errorf("%v", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		glog.Flush()
+		os.Exit(1)
 	}
 	glog.V(2).Infof("Using config: %v", cfg.String())
+
+	if *printConfig {
+		cfgBytes, _ := json.MarshalIndent(cfg.Effective(), "", "  ")
+		fmt.Printf("%s\n", cfgBytes)
+		os.Exit(0)
+	}
+
+	// All calls to the exchange are retried according to the same policy.
+	exchange.SetRetryPolicy(cfg.ExchangeRetry)
+
+	// Bound the exchange resource cache, and load the stable entries saved by the last run.
+	exchange.SetCacheConfig(cfg.ExchangeCache)
+	cachePersister := exchange.StartCachePersistence(&cfg.ExchangeCache)
+
+	// How often the agreement protocol message keys are rotated, how long a replaced key is accepted, and the type of new keys.
+	exchange.SetKeyRotationConfig(cfg.MessageKeyRotation)
+	exchange.SetMessageEnvelopeConfig(cfg.MessageEnvelope)
+
+	// Record the changes made in the exchange, when configured.
+	var auditLog *auditlog.AuditLog
+	if cfg.AuditLog.IsEnabled() {
+		if a, err := auditlog.NewAuditLog(&cfg.AuditLog); err != nil {
+			glog.Errorf("Unable to start the audit log, exchange changes will not be recorded, error: %v", err)
+		} else {
+			auditLog = a
+			exchange.SetAuditLog(auditLog)
+		}
+	}
+
+	// The configuration can be reloaded on SIGHUP or through the API. This also applies the log verbosity from the configuration.
+	reloader := worker.NewConfigReloader(*configFile, cfg)
 	glog.V(2).Infof("GOMAXPROCS: %v", runtime.GOMAXPROCS(-1))
 
 	// initialize the message printer for globalization, the anax will produce English messages.
@@ -80,10 +124,39 @@ func main() {
 			panic(err)
 		}
 		db = edgeDB
+
+		if *dbSchema {
+			status, err := persistence.GetSchemaStatus(db)
+			if err != nil {
+				panic(err)
+			}
+			statusBytes, _ := json.MarshalIndent(status, "", "  ")
+			fmt.Printf("%s\n", statusBytes)
+			db.Close()
+			os.Exit(0)
+		}
+
+		// The anax runtime might have been upgraded and restarted with an existing database. Bring the database
+		// schema up to date before any of the workers use it.
+		if _, err := persistence.MigrateSchema(db, cfg.Edge.DBPath); err != nil {
+			panic(err)
+		}
 	}
 
 	// open Agreement Bot DB if necessary
 
+	// Agbots sharing a database can be stopped while the database is migrated ahead of an upgrade, so the migrations
+	// can be applied without starting the agbot.
+	if *migrateOnly {
+		status, err := agbotPersistence.MigrateDatabase(cfg, *migrateTarget, *migrateDropAll)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to migrate Agreement Bot database: %v", err))
+		}
+		statusBytes, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Printf("%s\n", statusBytes)
+		os.Exit(0)
+	}
+
 	var agbotDB agbotPersistence.AgbotDatabase
 	agbotDB, dberr := agbotPersistence.InitDatabase(cfg)
 	if db == nil && dberr != nil {
@@ -97,13 +170,33 @@ func main() {
 	signal.Notify(control, os.Interrupt)
 	signal.Notify(control, syscall.SIGTERM)
 
+	// The watchdog restarts the agent by shutting it down the same way as a signal does, and exiting with its own exit code.
+	restart := make(chan int, 1)
+
+	// The event journal is started after the workers are created, it is closed here when it was started.
+	var journal *eventjournal.Journal
+
 	// This routine does not need to be a subworker because it has no parent worker and it will terminate on its own
 	// when the main anax process terminates.
 	go func() {
-		<-control
+		exitCode := 0
+		select {
+		case <-control:
+		case exitCode = <-restart:
+		}
 		glog.Infof("Closing up shop.")
 
 		pprof.StopCPUProfile()
+		if journal != nil {
+			journal.Close()
+		}
+		if cachePersister != nil {
+			cachePersister.Stop()
+		}
+		if auditLog != nil {
+			exchange.SetAuditLog(nil)
+			auditLog.Close()
+		}
 		if db != nil {
 			db.Close()
 			// remove the local db
@@ -119,7 +212,8 @@ func main() {
 			agbotDB.Close()
 		}
 
-		os.Exit(0)
+		glog.Flush()
+		os.Exit(exitCode)
 	}()
 
 	// The anax runtime might have been upgraded an restarted with an existing database. If so, the
@@ -149,6 +243,7 @@ func main() {
 
 	// start workers
 	workers := worker.NewMessageHandlerRegistry()
+	workers.AddSource(worker.CONFIG_RELOADER, reloader.Messages())
 
 	workers.Add(agreementbot.NewAgreementBotWorker("AgBot", cfg, agbotDB))
 	if cfg.AgreementBot.APIListen != "" {
@@ -162,6 +257,9 @@ func main() {
 	}
 
 	if db != nil {
+		// The node queues the updates it cannot send to the exchange in its local database.
+		exchange.SetOutbox(db)
+
 		workers.Add(api.NewAPIListener("API", cfg, db, pm))
 		workers.Add(agreement.NewAgreementWorker("Agreement", cfg, db, pm))
 		workers.Add(governance.NewGovernanceWorker("Governance", cfg, db, pm))
@@ -177,9 +275,50 @@ func main() {
 		workers.Add(changes.NewChangesWorker("ExchangeChanges", cfg, db))
 	}
 
+	// Record the events passed between the workers, when configured.
+	if cfg.EventJournal.IsEnabled() {
+		if j, err := eventjournal.NewJournal(&cfg.EventJournal); err != nil {
+			glog.Errorf("Unable to start the event journal, events will not be recorded, error: %v", err)
+		} else {
+			journal = j
+			workers.SetJournal(journal)
+		}
+	}
+
+	// Watch for workers that stop making progress.
+	watchdog := worker.StartWatchdog(&cfg.Watchdog, func() {
+		// A stuck worker can keep the databases from closing, so exit anyway when the shutdown takes too long.
+		time.AfterFunc(worker.WATCHDOG_SHUTDOWN_TIMEOUT_S*time.Second, func() {
+			glog.Errorf("Shutdown did not finish within %v seconds, exiting.", worker.WATCHDOG_SHUTDOWN_TIMEOUT_S)
+			glog.Flush()
+			os.Exit(worker.WATCHDOG_EXIT_CODE)
+		})
+		restart <- worker.WATCHDOG_EXIT_CODE
+	})
+
+	// Reload the reloadable parts of the configuration on SIGHUP.
+	reloader.HandleSignals()
+
 	// Get into the event processing loop until anax shuts itself down.
 	workers.ProcessEventMessages()
 
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+
+	if journal != nil {
+		journal.Close()
+	}
+
+	if cachePersister != nil {
+		cachePersister.Stop()
+	}
+
+	if auditLog != nil {
+		exchange.SetAuditLog(nil)
+		auditLog.Close()
+	}
+
 	if db != nil {
 		db.Close()
 
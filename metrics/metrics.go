@@ -0,0 +1,363 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// This package holds the metrics exposed by anax on the /metrics path of the node and agbot APIs. The metrics
+// are written in the Prometheus text exposition format so that they can be scraped by a Prometheus server.
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	TYPE_COUNTER   = "counter"
+	TYPE_GAUGE     = "gauge"
+	TYPE_HISTOGRAM = "histogram"
+)
+
+// The default histogram buckets, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// The value of a single metric for a specific set of label values.
+type series struct {
+	labelValues []string
+	value       float64  // The counter or gauge value.
+	counts      []uint64 // The non-cumulative count of observations in each histogram bucket.
+	count       uint64
+	sum         float64
+}
+
+// A metric with a name and a set of label names. Each distinct set of label values is a different series.
+type metricVec struct {
+	lock       sync.Mutex
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64
+	series     map[string]*series
+}
+
+func (m *metricVec) String() string {
+	return fmt.Sprintf("Name: %v, Type: %v, Labels: %v", m.name, m.metricType, m.labelNames)
+}
+
+// Returns the series for the label values, creating it when necessary. The caller must hold the lock.
+func (m *metricVec) getSeries(labelValues []string) *series {
+	if len(labelValues) != len(m.labelNames) {
+		glog.Errorf(metricsLogString(fmt.Sprintf("metric %v expects label values for %v, was given %v", m.name, m.labelNames, labelValues)))
+		return nil
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		if m.metricType == TYPE_HISTOGRAM {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (m *metricVec) add(v float64, labelValues []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if s := m.getSeries(labelValues); s != nil {
+		s.value += v
+	}
+}
+
+// Remove all the series of the metric.
+func (m *metricVec) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.series = make(map[string]*series)
+}
+
+// Remove the series for the label values, for example when the thing it measures is gone.
+func (m *metricVec) Delete(labelValues ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.series, strings.Join(labelValues, "\xff"))
+}
+
+// A counter only goes up, for example the number of requests sent to the exchange.
+type CounterVec struct {
+	*metricVec
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		glog.Errorf(metricsLogString(fmt.Sprintf("counter %v cannot be decreased by %v", c.name, v)))
+		return
+	}
+	c.add(v, labelValues)
+}
+
+// A gauge can go up and down, for example the number of commands queued to a worker.
+type GaugeVec struct {
+	*metricVec
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if s := g.getSeries(labelValues); s != nil {
+		s.value = v
+	}
+}
+
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	g.add(v, labelValues)
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+// A histogram counts observations in buckets, for example the time taken to pull an image.
+type HistogramVec struct {
+	*metricVec
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if s := h.getSeries(labelValues); s != nil {
+		if ix := sort.SearchFloat64s(h.buckets, v); ix < len(h.buckets) {
+			s.counts[ix]++
+		}
+		s.count++
+		s.sum += v
+	}
+}
+
+// The registry holds all the metrics that are written when the metrics are scraped. Collectors are functions that
+// refresh metrics whose value is only known at scrape time, they are called before the metrics are written.
+type Registry struct {
+	lock       sync.Mutex
+	metrics    map[string]*metricVec
+	collectors map[string]func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics:    make(map[string]*metricVec),
+		collectors: make(map[string]func()),
+	}
+}
+
+// The registry used by all of anax.
+var DefaultRegistry = NewRegistry()
+
+// Returns the metric with the name, creating it when it is not already registered. Registering the same
+// name twice with a different type or labels is a programming error.
+func (r *Registry) register(name string, help string, metricType string, buckets []float64, labelNames []string) *metricVec {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if m, ok := r.metrics[name]; ok {
+		if m.metricType != metricType || strings.Join(m.labelNames, ",") != strings.Join(labelNames, ",") {
+			panic(fmt.Sprintf("metric %v is already registered as %v", name, m))
+		}
+		return m
+	}
+
+	m := &metricVec{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	r.metrics[name] = m
+	return m
+}
+
+func (r *Registry) NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, TYPE_COUNTER, nil, labelNames)}
+}
+
+func (r *Registry) NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, TYPE_GAUGE, nil, labelNames)}
+}
+
+// The buckets are the upper bounds of each bucket, in increasing order. Nil means the default buckets.
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &HistogramVec{r.register(name, help, TYPE_HISTOGRAM, buckets, labelNames)}
+}
+
+// Add a collector. A collector registered with the same name as an existing one replaces it.
+func (r *Registry) RegisterCollector(name string, collector func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors[name] = collector
+}
+
+func (r *Registry) UnregisterCollector(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.collectors, name)
+}
+
+// Call the collectors and write all the metrics in the text exposition format, sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.lock.Lock()
+	collectorNames := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		collectorNames = append(collectorNames, name)
+	}
+	sort.Strings(collectorNames)
+	collectors := make([]func(), 0, len(collectorNames))
+	for _, name := range collectorNames {
+		collectors = append(collectors, r.collectors[name])
+	}
+	metrics := make([]*metricVec, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.lock.Unlock()
+
+	// The collectors update metrics, so they are called without holding the registry lock.
+	for _, collector := range collectors {
+		collector()
+	}
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		m.writeText(&buf)
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return errors.New(fmt.Sprintf("unable to write metrics, error: %v", err))
+	}
+	return nil
+}
+
+func (m *metricVec) writeText(buf *bytes.Buffer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %v %v\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(buf, "# TYPE %v %v\n", m.name, m.metricType)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		if m.metricType != TYPE_HISTOGRAM {
+			fmt.Fprintf(buf, "%v%v %v\n", m.name, formatLabels(m.labelNames, s.labelValues, "", 0), formatValue(s.value))
+			continue
+		}
+
+		cumulative := uint64(0)
+		for ix, upper := range m.buckets {
+			cumulative += s.counts[ix]
+			fmt.Fprintf(buf, "%v_bucket%v %v\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", upper), cumulative)
+		}
+		fmt.Fprintf(buf, "%v_bucket%v %v\n", m.name, formatLabels(m.labelNames, s.labelValues, "le", math.Inf(1)), s.count)
+		fmt.Fprintf(buf, "%v_sum%v %v\n", m.name, formatLabels(m.labelNames, s.labelValues, "", 0), formatValue(s.sum))
+		fmt.Fprintf(buf, "%v_count%v %v\n", m.name, formatLabels(m.labelNames, s.labelValues, "", 0), s.count)
+	}
+}
+
+// Write the labels in the {name="value",...} form. The extra label is the histogram bucket bound, when there is one.
+func formatLabels(names []string, values []string, extraName string, extraValue float64) string {
+	pairs := make([]string, 0, len(names)+1)
+	for ix, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%v=\"%v\"", name, escapeLabelValue(values[ix])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%v=\"%v\"", extraName, formatValue(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`, "\"", `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+// Convenience functions for the default registry.
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labelNames...)
+}
+
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labelNames...)
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+func RegisterCollector(name string, collector func()) {
+	DefaultRegistry.RegisterCollector(name, collector)
+}
+
+func UnregisterCollector(name string) {
+	DefaultRegistry.UnregisterCollector(name)
+}
+
+// Write the metrics in the default registry as the response to an HTTP request.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	if err := DefaultRegistry.WriteText(w); err != nil {
+		glog.Errorf(metricsLogString(err.Error()))
+	}
+}
+
+var metricsLogString = func(v interface{}) string {
+	return fmt.Sprintf("Metrics: %v", v)
+}
@@ -0,0 +1,135 @@
+// +build unit
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_WriteText(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.NewCounterVec("test_requests_total", "The number of requests.", "method", "code")
+	c.Inc("GET", "200")
+	c.Add(2, "GET", "200")
+	c.Inc("PUT", "error")
+	c.Add(-1, "PUT", "error")
+
+	g := r.NewGaugeVec("test_queue_length", "The queue length.\nIn commands.", "worker")
+	g.Set(5, "w\"1\"")
+	g.Inc("w2")
+	g.Dec("w2")
+	g.Dec("w2")
+
+	h := r.NewHistogramVec("test_duration_seconds", "The duration.", []float64{0.1, 1}, "worker")
+	h.Observe(0.05, "w1")
+	h.Observe(0.1, "w1")
+	h.Observe(0.5, "w1")
+	h.Observe(3, "w1")
+
+	// Label values that do not match the label names are ignored.
+	c.Inc("GET")
+
+	r.NewGaugeVec("test_no_labels", "A gauge without labels.").Set(1.5)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `# HELP test_duration_seconds The duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{worker="w1",le="0.1"} 2
+test_duration_seconds_bucket{worker="w1",le="1"} 3
+test_duration_seconds_bucket{worker="w1",le="+Inf"} 4
+test_duration_seconds_sum{worker="w1"} 3.65
+test_duration_seconds_count{worker="w1"} 4
+# HELP test_no_labels A gauge without labels.
+# TYPE test_no_labels gauge
+test_no_labels 1.5
+# HELP test_queue_length The queue length.\nIn commands.
+# TYPE test_queue_length gauge
+test_queue_length{worker="w\"1\""} 5
+test_queue_length{worker="w2"} -1
+# HELP test_requests_total The number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 3
+test_requests_total{method="PUT",code="error"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, buf.String())
+	}
+
+	g.Delete("w2")
+	buf.Reset()
+	r.WriteText(&buf)
+	if strings.Contains(buf.String(), "test_queue_length{worker=\"w2\"}") || !strings.Contains(buf.String(), "test_queue_length{worker=\"w\\\"1\\\"\"} 5") {
+		t.Errorf("expected only the w2 series to be deleted, got:\n%v", buf.String())
+	}
+
+	g.Reset()
+	buf.Reset()
+	r.WriteText(&buf)
+	if strings.Contains(buf.String(), "test_queue_length{") {
+		t.Errorf("expected no queue length series after reset, got:\n%v", buf.String())
+	}
+}
+
+func Test_register_twice(t *testing.T) {
+	r := NewRegistry()
+
+	c1 := r.NewCounterVec("test_total", "A counter.", "a")
+	c2 := r.NewCounterVec("test_total", "A counter.", "a")
+	c1.Inc("x")
+	c2.Inc("x")
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	if !strings.Contains(buf.String(), "test_total{a=\"x\"} 2\n") {
+		t.Errorf("expected both counters to update the same metric, got:\n%v", buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic when the labels are different")
+		}
+	}()
+	r.NewCounterVec("test_total", "A counter.", "b")
+}
+
+func Test_Handler_scrape(t *testing.T) {
+	g := NewGaugeVec("test_scrape_collected", "A gauge set by a collector.", "name")
+
+	calls := 0
+	RegisterCollector("test", func() {
+		calls += 1
+		g.Set(float64(calls), "test")
+	})
+	defer UnregisterCollector("test")
+
+	server := httptest.NewServer(http.HandlerFunc(Handler))
+	defer server.Close()
+
+	for i := 1; i <= 2; i++ {
+		resp, err := http.Get(server.URL + "/metrics")
+		if err != nil {
+			t.Fatalf("unable to scrape metrics, error: %v", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if err != nil {
+			t.Fatalf("unable to read metrics, error: %v", err)
+		} else if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != CONTENT_TYPE {
+			t.Errorf("unexpected response status %v, content type %v", resp.StatusCode, resp.Header.Get("Content-Type"))
+		} else if expected := fmt.Sprintf("test_scrape_collected{name=\"test\"} %v\n", i); !strings.Contains(string(body), expected) {
+			t.Errorf("expected %v in scrape %v, got:\n%v", expected, i, string(body))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package persistence
+
+import (
+	"fmt"
+	"github.com/boltdb/bolt"
+	"io"
+)
+
+// Write a consistent copy of the node's database to the writer. The copy is taken inside a read transaction, so the
+// agent can continue to update the database while the backup is being written. The number of bytes written is returned.
+func BackupDatabase(db *bolt.DB, w io.Writer) (int64, error) {
+	var size int64
+	readErr := db.View(func(tx *bolt.Tx) error {
+		var err error
+		size, err = tx.WriteTo(w)
+		return err
+	})
+	return size, readErr
+}
+
+// Replace the entire content of the node's database with the content of the snapshot database. All the buckets are
+// replaced in a single write transaction, so either the whole snapshot is restored or the database is left unchanged.
+// The read transaction on the snapshot stays open until the write transaction commits because the copied values
+// refer to the snapshot's memory.
+func RestoreDatabase(db *bolt.DB, snapshot *bolt.DB) error {
+	return snapshot.View(func(stx *bolt.Tx) error {
+		return db.Update(func(tx *bolt.Tx) error {
+
+			// Remove the current state.
+			names := make([][]byte, 0)
+			if err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				names = append(names, append([]byte{}, name...))
+				return nil
+			}); err != nil {
+				return err
+			}
+			for _, name := range names {
+				if err := tx.DeleteBucket(name); err != nil {
+					return fmt.Errorf("unable to delete bucket %v, error: %v", string(name), err)
+				}
+			}
+
+			// Copy in the state from the snapshot.
+			return stx.ForEach(func(name []byte, sb *bolt.Bucket) error {
+				if b, err := tx.CreateBucket(name); err != nil {
+					return fmt.Errorf("unable to create bucket %v, error: %v", string(name), err)
+				} else if err := copyBucket(sb, b); err != nil {
+					return fmt.Errorf("unable to restore bucket %v, error: %v", string(name), err)
+				}
+				return nil
+			})
+		})
+	})
+}
+
+func copyBucket(from *bolt.Bucket, to *bolt.Bucket) error {
+	if err := to.SetSequence(from.Sequence()); err != nil {
+		return err
+	}
+	return from.ForEach(func(k, v []byte) error {
+		// A nil value means that the key refers to a nested bucket.
+		if v == nil {
+			if nested, err := to.CreateBucket(k); err != nil {
+				return err
+			} else {
+				return copyBucket(from.Bucket(k), nested)
+			}
+		}
+		return to.Put(k, v)
+	})
+}
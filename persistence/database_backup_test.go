@@ -0,0 +1,80 @@
+// +build unit
+
+package persistence
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func Test_BackupDatabase_RestoreDatabase(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	// The source has a nested bucket and a bucket sequence, the target has a bucket that is not in the source.
+	if err := db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte("b1"))
+		b.SetSequence(42)
+		b.Put([]byte("k1"), []byte("v1"))
+		nested, _ := b.CreateBucketIfNotExists([]byte("nested"))
+		return nested.Put([]byte("k2"), []byte("v2"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if size, err := BackupDatabase(db, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if size != int64(buf.Len()) {
+		t.Errorf("backup size %v does not match written size %v", size, buf.Len())
+	}
+
+	snapshotFile := path.Join(dir, "snapshot.db")
+	if err := ioutil.WriteFile(snapshotFile, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := bolt.Open(snapshotFile, 0600, nil)
+	if err != nil {
+		t.Fatalf("backup is not a database, error %v", err)
+	}
+	defer snapshot.Close()
+
+	target, err := bolt.Open(path.Join(dir, "target.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	if err := target.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("old"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RestoreDatabase(target, snapshot); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	target.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("old")) != nil {
+			t.Errorf("bucket old should have been removed")
+		}
+		b := tx.Bucket([]byte("b1"))
+		if b == nil {
+			t.Fatalf("bucket b1 was not restored")
+		} else if b.Sequence() != 42 {
+			t.Errorf("bucket sequence was not restored, is %v", b.Sequence())
+		} else if string(b.Get([]byte("k1"))) != "v1" {
+			t.Errorf("record k1 was not restored")
+		} else if nested := b.Bucket([]byte("nested")); nested == nil || string(nested.Get([]byte("k2"))) != "v2" {
+			t.Errorf("nested bucket was not restored")
+		}
+		return nil
+	})
+}
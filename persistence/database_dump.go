@@ -0,0 +1,64 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+)
+
+// A function that removes secrets from a record before it is dumped. The returned object is serialized as JSON.
+type RecordCensor func(key string, value []byte) (interface{}, error)
+
+// Returns the content of every bucket in the node's database, keyed by bucket name and then by record key. Nested
+// buckets are returned as nested maps. Records are returned as raw JSON unless a censor function is provided for the
+// bucket, in which case the output of the censor function is returned instead. Records that are not JSON are
+// returned as strings.
+func DumpDatabase(db *bolt.DB, censors map[string]RecordCensor) (map[string]interface{}, error) {
+
+	dump := make(map[string]interface{})
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if bucketDump, err := dumpBucket(b, censors[string(name)]); err != nil {
+				return fmt.Errorf("unable to dump bucket %v, error: %v", string(name), err)
+			} else {
+				dump[string(name)] = bucketDump
+			}
+			return nil
+		})
+	})
+
+	return dump, readErr
+}
+
+func dumpBucket(b *bolt.Bucket, censor RecordCensor) (map[string]interface{}, error) {
+
+	bucketDump := make(map[string]interface{})
+
+	err := b.ForEach(func(k, v []byte) error {
+		key := string(k)
+
+		// A nil value means that the key refers to a nested bucket.
+		if v == nil {
+			if nested, err := dumpBucket(b.Bucket(k), censor); err != nil {
+				return err
+			} else {
+				bucketDump[key] = nested
+			}
+		} else if censor != nil {
+			if record, err := censor(key, v); err != nil {
+				return fmt.Errorf("unable to censor record %v, error: %v", key, err)
+			} else {
+				bucketDump[key] = record
+			}
+		} else if json.Valid(v) {
+			// The value is only valid for the life of the transaction, so it has to be copied.
+			bucketDump[key] = json.RawMessage(append([]byte{}, v...))
+		} else {
+			bucketDump[key] = string(v)
+		}
+		return nil
+	})
+
+	return bucketDump, err
+}
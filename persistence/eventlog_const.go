@@ -26,6 +26,9 @@ const (
 	EC_API_USER_INPUT_ERROR = "api_user_input_error"
 	EC_EXCHANGE_ERROR       = "exchange_error"
 
+	// event log maintenance
+	EC_EVENTLOG_PRUNED = "eventlog_pruned"
+
 	// initialization
 	EC_ERROR_CONTAINER_SYNC_ON_INIT = "error_container_sync_on_init"
 	EC_ERROR_AGREEMENT_SYNC_ON_INIT = "error_agreement_sync_on_init"
@@ -58,10 +61,24 @@ const (
 	EC_NODE_UNREG_COMPLETE = "node_unregistration_complete"
 	EC_ERROR_NODE_UNREG    = "error_node_unregistration"
 
+	// node backup and restore
+	EC_NODE_STATE_RESTORED = "node_state_restored"
+	EC_ERROR_NODE_RESTORE  = "error_node_restore"
+
+	// node database check
+	EC_NODE_DATABASE_REPAIRED = "node_database_repaired"
+
 	// node heartbeat
 	EC_NODE_HEARTBEAT_FAILED   = "node_heartbeat_failed"
 	EC_NODE_HEARTBEAT_RESTORED = "node_heartbeat_restored"
 
+	// node exchange changes
+	EC_NODE_CHANGES_RESYNC = "node_changes_resync"
+
+	// node message key
+	EC_NODE_MESSAGE_KEY_ROTATED        = "node_message_key_rotated"
+	EC_ERROR_NODE_MESSAGE_KEY_ROTATION = "error_node_message_key_rotation"
+
 	// service configuration
 	EC_START_SERVICE_CONFIG                = "start_service_configuration"
 	EC_SERVICE_CONFIG_COMPLETE             = "service_configuration_complete"
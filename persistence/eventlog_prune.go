@@ -0,0 +1,182 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"sort"
+	"strconv"
+)
+
+// The criteria used to decide which event log records are pruned. A zero value means that there is no limit.
+type EventLogPruneCriteria struct {
+	MaxAgeS         uint64            `json:"max_age_seconds,omitempty"`          // Records older than this are pruned.
+	SeverityMaxAgeS map[string]uint64 `json:"severity_max_age_seconds,omitempty"` // Overrides MaxAgeS for records of the given severity.
+	MaxCount        int               `json:"max_count,omitempty"`                // The oldest records are pruned until at most this many remain.
+}
+
+func (c EventLogPruneCriteria) String() string {
+	return fmt.Sprintf("MaxAgeS: %v, SeverityMaxAgeS: %v, MaxCount: %v", c.MaxAgeS, c.SeverityMaxAgeS, c.MaxCount)
+}
+
+// Returns true if the criteria would never prune anything.
+func (c EventLogPruneCriteria) IsEmpty() bool {
+	if c.MaxAgeS != 0 || c.MaxCount != 0 {
+		return false
+	}
+	for _, age := range c.SeverityMaxAgeS {
+		if age != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the maximum age of a record with the given severity, 0 if there is no age limit.
+func (c EventLogPruneCriteria) maxAge(severity string) uint64 {
+	if age, ok := c.SeverityMaxAgeS[severity]; ok && age != 0 {
+		return age
+	}
+	return c.MaxAgeS
+}
+
+// A summary of the event log records removed by a prune.
+type EventLogPruneSummary struct {
+	Pruned          int            `json:"pruned"`
+	Remaining       int            `json:"remaining"`
+	Kept            int            `json:"kept_for_surfaced_errors"` // Records that matched the criteria but are referenced by a surfaced error.
+	BySeverity      map[string]int `json:"pruned_by_severity,omitempty"`
+	BySourceType    map[string]int `json:"pruned_by_source_type,omitempty"`
+	OldestTimestamp uint64         `json:"oldest_pruned_timestamp,omitempty"`
+	NewestTimestamp uint64         `json:"newest_pruned_timestamp,omitempty"`
+}
+
+func (s EventLogPruneSummary) String() string {
+	return fmt.Sprintf("Pruned: %v, Remaining: %v, Kept: %v, BySeverity: %v, BySourceType: %v, OldestTimestamp: %v, NewestTimestamp: %v",
+		s.Pruned, s.Remaining, s.Kept, s.BySeverity, s.BySourceType, s.OldestTimestamp, s.NewestTimestamp)
+}
+
+// The parts of an event log record needed to decide whether to prune it.
+type eventLogPruneEntry struct {
+	key        []byte
+	id         uint64
+	timestamp  uint64
+	severity   string
+	sourceType string
+}
+
+// Remove the event log records that match the criteria, relative to the given time. Records referenced by the
+// surfaced errors are never removed, so that the errors surfaced to the Exchange can still be resolved to their
+// event log records. The records are removed in a single transaction.
+func PruneEventLogs(db *bolt.DB, criteria EventLogPruneCriteria, now uint64) (*EventLogPruneSummary, error) {
+
+	summary := &EventLogPruneSummary{
+		BySeverity:   make(map[string]int),
+		BySourceType: make(map[string]int),
+	}
+
+	if criteria.IsEmpty() {
+		return summary, nil
+	}
+
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+
+		b := tx.Bucket([]byte(EVENT_LOGS))
+		if b == nil {
+			return nil
+		}
+
+		// The records referenced by surfaced errors are kept.
+		protected := make(map[string]bool)
+		if sb := tx.Bucket([]byte(NODE_SURFACEERR)); sb != nil {
+			if v := sb.Get([]byte(NODE_SURFACEERR)); v != nil {
+				var surfaceErrors []SurfaceError
+				if err := json.Unmarshal(v, &surfaceErrors); err != nil {
+					return fmt.Errorf("Unable to deserialize node surface error record: %v", err)
+				}
+				for _, se := range surfaceErrors {
+					protected[se.Record_id] = true
+				}
+			}
+		}
+
+		entries := make([]eventLogPruneEntry, 0)
+		if err := b.ForEach(func(k, v []byte) error {
+			var el EventLogBase
+			if err := json.Unmarshal(v, &el); err != nil {
+				// A record that cannot be read is of no use to anyone, so it is treated as the oldest record.
+				glog.Errorf("Unable to deserialize event log db record: %v. Error: %v", string(v), err)
+			}
+			id, _ := strconv.ParseUint(string(k), 10, 64)
+			entries = append(entries, eventLogPruneEntry{key: append([]byte{}, k...), id: id, timestamp: el.Timestamp, severity: el.Severity, sourceType: el.SourceType})
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// The keys are sorted as strings by bolt, so sort the records into the order they were created.
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].timestamp != entries[j].timestamp {
+				return entries[i].timestamp < entries[j].timestamp
+			}
+			return entries[i].id < entries[j].id
+		})
+
+		prune := make([]bool, len(entries))
+		kept := make(map[int]bool)
+		remaining := len(entries)
+
+		pruneEntry := func(i int) {
+			if prune[i] {
+				return
+			} else if protected[string(entries[i].key)] {
+				kept[i] = true
+				return
+			}
+			prune[i] = true
+			remaining--
+		}
+
+		// Prune by age first.
+		for i, e := range entries {
+			if maxAge := criteria.maxAge(e.severity); maxAge != 0 && e.timestamp+maxAge < now {
+				pruneEntry(i)
+			}
+		}
+
+		// Then prune the oldest records until the count is within the limit.
+		if criteria.MaxCount != 0 {
+			for i := 0; i < len(entries) && remaining > criteria.MaxCount; i++ {
+				pruneEntry(i)
+			}
+		}
+		summary.Kept = len(kept)
+
+		for i, e := range entries {
+			if !prune[i] {
+				continue
+			}
+			if err := b.Delete(e.key); err != nil {
+				return fmt.Errorf("Unable to delete event log record %v, error: %v", string(e.key), err)
+			}
+			summary.Pruned++
+			summary.BySeverity[e.severity]++
+			summary.BySourceType[e.sourceType]++
+			if summary.OldestTimestamp == 0 || e.timestamp < summary.OldestTimestamp {
+				summary.OldestTimestamp = e.timestamp
+			}
+			if e.timestamp > summary.NewestTimestamp {
+				summary.NewestTimestamp = e.timestamp
+			}
+		}
+		summary.Remaining = remaining
+
+		return nil
+	})
+
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	return summary, nil
+}
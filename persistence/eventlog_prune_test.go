@@ -0,0 +1,126 @@
+// +build unit
+
+package persistence
+
+import (
+	"github.com/boltdb/bolt"
+	"testing"
+)
+
+// Save an event log record with the given age in seconds, relative to now.
+func saveAgedEventLog(t *testing.T, db *bolt.DB, severity string, sourceType string, now uint64, age uint64) string {
+	el := NewEventLog(severity, NewMessageMeta("test message"), EC_DATABASE_ERROR, sourceType, NewDatabaseEventSource())
+	el.Timestamp = now - age
+	if err := SaveEventLog(db, el); err != nil {
+		t.Fatalf("failed to save event log, error %v", err)
+	}
+	return el.Id
+}
+
+func getEventLogIds(t *testing.T, db *bolt.DB) map[string]bool {
+	els, err := FindAllEventLogs(db)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, el := range els {
+		ids[el.Id] = true
+	}
+	return ids
+}
+
+func Test_PruneEventLogs_age(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	now := uint64(1000000)
+	oldInfo := saveAgedEventLog(t, db, SEVERITY_INFO, SRC_TYPE_DB, now, 5000)
+	oldWarn := saveAgedEventLog(t, db, SEVERITY_WARN, SRC_TYPE_NODE, now, 5000)
+	newInfo := saveAgedEventLog(t, db, SEVERITY_INFO, SRC_TYPE_DB, now, 100)
+	newWarn := saveAgedEventLog(t, db, SEVERITY_WARN, SRC_TYPE_NODE, now, 100)
+
+	// Warnings are kept longer than the other records.
+	criteria := EventLogPruneCriteria{MaxAgeS: 1000, SeverityMaxAgeS: map[string]uint64{SEVERITY_WARN: 10000}}
+	summary, err := PruneEventLogs(db, criteria, now)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if summary.Pruned != 1 || summary.Remaining != 3 {
+		t.Errorf("wrong summary %v", summary)
+	} else if summary.BySeverity[SEVERITY_INFO] != 1 || summary.BySourceType[SRC_TYPE_DB] != 1 {
+		t.Errorf("wrong summary breakdown %v", summary)
+	} else if summary.OldestTimestamp != now-5000 || summary.NewestTimestamp != now-5000 {
+		t.Errorf("wrong summary time range %v", summary)
+	}
+
+	ids := getEventLogIds(t, db)
+	if ids[oldInfo] || !ids[oldWarn] || !ids[newInfo] || !ids[newWarn] {
+		t.Errorf("wrong event logs remain: %v", ids)
+	}
+}
+
+func Test_PruneEventLogs_count(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	// More than 9 records, so that the record ids do not sort in the order they were created.
+	now := uint64(1000000)
+	ids := make([]string, 0)
+	for i := 0; i < 12; i++ {
+		ids = append(ids, saveAgedEventLog(t, db, SEVERITY_INFO, SRC_TYPE_DB, now, 10))
+	}
+
+	summary, err := PruneEventLogs(db, EventLogPruneCriteria{MaxCount: 5}, now)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if summary.Pruned != 7 || summary.Remaining != 5 {
+		t.Errorf("wrong summary %v", summary)
+	}
+
+	remaining := getEventLogIds(t, db)
+	for i, id := range ids {
+		if (i < 7) == remaining[id] {
+			t.Errorf("record %v should have been pruned: %v, remaining %v", id, i < 7, remaining)
+		}
+	}
+}
+
+func Test_PruneEventLogs_surfaced_errors(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	now := uint64(1000000)
+	surfaced := saveAgedEventLog(t, db, SEVERITY_ERROR, SRC_TYPE_DB, now, 5000)
+	pruned := saveAgedEventLog(t, db, SEVERITY_ERROR, SRC_TYPE_DB, now, 5000)
+
+	if err := SaveSurfaceErrors(db, []SurfaceError{{Record_id: surfaced, Event_code: EC_DATABASE_ERROR}}); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := PruneEventLogs(db, EventLogPruneCriteria{MaxAgeS: 1000, MaxCount: 1}, now)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if summary.Pruned != 1 || summary.Kept != 1 || summary.Remaining != 1 {
+		t.Errorf("wrong summary %v", summary)
+	}
+
+	ids := getEventLogIds(t, db)
+	if !ids[surfaced] || ids[pruned] {
+		t.Errorf("wrong event logs remain: %v", ids)
+	}
+
+	// Nothing is pruned without criteria.
+	if summary, err := PruneEventLogs(db, EventLogPruneCriteria{}, now); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if summary.Pruned != 0 {
+		t.Errorf("nothing should be pruned, summary %v", summary)
+	}
+}
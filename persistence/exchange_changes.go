@@ -15,11 +15,14 @@ const EXCHANGE_CHANGES = "exchange-change-state" // The bucket name in the bolt
 type ChangeState struct {
 	ChangeID    uint64 `json:"changeId"`
 	LastUpdated int64  `json:"lastUpdated"`
+
+	// The version of the exchange that returned the change ID, empty if it is not known.
+	ExchangeVersion string `json:"exchangeVersion,omitempty"`
 }
 
 func (c ChangeState) String() string {
 	lu := time.Unix(c.LastUpdated, 0).Format(cutil.ExchangeTimeFormat)
-	return fmt.Sprintf("Change State ID: %v, last updated: %v", c.ChangeID, lu)
+	return fmt.Sprintf("Change State ID: %v, last updated: %v, exchange version: %v", c.ChangeID, lu, c.ExchangeVersion)
 }
 
 // Retrieve the change state object from the database. The bolt APIs assume there is more than 1 object in a bucket,
@@ -61,7 +64,7 @@ func FindExchangeChangeState(db *bolt.DB) (*ChangeState, error) {
 }
 
 // There is only 1 object in the bucket so we can use the bucket name as the object key.
-func SaveExchangeChangeState(db *bolt.DB, changeID uint64) error {
+func SaveExchangeChangeState(db *bolt.DB, changeID uint64, exchangeVersion string) error {
 
 	writeErr := db.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(EXCHANGE_CHANGES))
@@ -70,8 +73,9 @@ func SaveExchangeChangeState(db *bolt.DB, changeID uint64) error {
 		}
 
 		chg := ChangeState{
-			ChangeID:    changeID,
-			LastUpdated: time.Now().Unix(),
+			ChangeID:        changeID,
+			LastUpdated:     time.Now().Unix(),
+			ExchangeVersion: exchangeVersion,
 		}
 
 		if serial, err := json.Marshal(chg); err != nil {
@@ -87,3 +87,45 @@ func DeleteNodeStatus(db *bolt.DB) error {
 		})
 	}
 }
+
+// RemoveNodeStatus removes the node status entries for which stale returns true, and returns how many were removed.
+// The entries are read and written back in the same transaction, so that a status saved in the meantime is not lost.
+func RemoveNodeStatus(db *bolt.DB, stale func(WorkloadStatus) bool) (int, error) {
+	removed := 0
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(NODE_STATUS))
+		if err != nil {
+			return err
+		}
+
+		var nodeStatus []WorkloadStatus
+		if v := b.Get([]byte(NODE_STATUS)); v == nil {
+			return nil
+		} else if err := json.Unmarshal(v, &nodeStatus); err != nil {
+			return fmt.Errorf("Unable to deserialize node status record: %v", v)
+		}
+
+		current := make([]WorkloadStatus, 0, len(nodeStatus))
+		for _, wlStatus := range nodeStatus {
+			if stale(wlStatus) {
+				removed++
+			} else {
+				current = append(current, wlStatus)
+			}
+		}
+		if removed == 0 {
+			return nil
+		}
+
+		if serial, err := json.Marshal(current); err != nil {
+			return fmt.Errorf("Failed to serialize node status: %v. Error: %v", current, err)
+		} else {
+			return b.Put([]byte(NODE_STATUS), serial)
+		}
+	})
+
+	if writeErr != nil {
+		return 0, writeErr
+	}
+	return removed, nil
+}
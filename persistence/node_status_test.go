@@ -0,0 +1,34 @@
+// +build unit
+
+package persistence
+
+import (
+	"testing"
+)
+
+// Only the stale entries are removed, and the entries are read in the same transaction that saves them.
+func Test_RemoveNodeStatus(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	if removed, err := RemoveNodeStatus(db, func(WorkloadStatus) bool { return true }); err != nil || removed != 0 {
+		t.Errorf("nothing should be removed without a node status, removed %v, error %v", removed, err)
+	}
+
+	status := []WorkloadStatus{{AgreementId: "agreement1"}, {AgreementId: "agreement2"}, {ServiceURL: "mydependency", Org: "myorg"}}
+	if err := SaveNodeStatus(db, status); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := RemoveNodeStatus(db, func(wlStatus WorkloadStatus) bool { return wlStatus.AgreementId == "agreement2" })
+	if err != nil || removed != 1 {
+		t.Errorf("expected one entry removed, removed %v, error %v", removed, err)
+	}
+	if current, err := FindNodeStatus(db); err != nil || len(current) != 2 || current[0].AgreementId != "agreement1" || current[1].ServiceURL != "mydependency" {
+		t.Errorf("wrong node status %v, error %v", current, err)
+	}
+}
@@ -0,0 +1,192 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"sort"
+	"time"
+)
+
+// The outbox holds the updates that the node could not send to the exchange because the exchange could not be reached.
+// There is at most one entry for each resource in the exchange, a newer update of the same resource replaces the older
+// one, so that only the latest state is sent when the exchange can be reached again. The entries are sent in the order
+// they were last updated.
+const OUTBOX = "outbox"
+
+type OutboxEntry struct {
+	Resource    string          `json:"resource"`     // The resource being updated, for example nodestatus or agreement/<agreement id>.
+	Method      string          `json:"method"`       // The HTTP method, PUT, PATCH or DELETE.
+	Path        string          `json:"path"`         // The URL path relative to the exchange URL.
+	Body        json.RawMessage `json:"body"`         // The JSON body of the request, if any.
+	Sequence    uint64          `json:"sequence"`     // The order in which the entries are sent.
+	QueuedTime  uint64          `json:"queued_time"`  // When the first update of the resource that has not been sent was queued.
+	UpdatedTime uint64          `json:"updated_time"` // When the latest update of the resource was queued.
+	Attempts    int             `json:"attempts"`     // The number of times the entry could not be sent.
+	LastError   string          `json:"last_error"`
+}
+
+func (e OutboxEntry) String() string {
+	return fmt.Sprintf("Resource: %v, Method: %v, Path: %v, Sequence: %v, QueuedTime: %v, UpdatedTime: %v, Attempts: %v, LastError: %v",
+		e.Resource, e.Method, e.Path, e.Sequence, e.QueuedTime, e.UpdatedTime, e.Attempts, e.LastError)
+}
+
+// The state of the outbox, as shown in the node status.
+type OutboxStatus struct {
+	QueueDepth      int    `json:"queue_depth"`
+	OldestEntryTime uint64 `json:"oldest_entry_time,omitempty"`
+	OldestEntryAgeS uint64 `json:"oldest_entry_age_s,omitempty"`
+}
+
+func (s OutboxStatus) String() string {
+	return fmt.Sprintf("QueueDepth: %v, OldestEntryTime: %v, OldestEntryAgeS: %v", s.QueueDepth, s.OldestEntryTime, s.OldestEntryAgeS)
+}
+
+// Queue an update of a resource in the exchange, replacing the update of the same resource that is already queued.
+func QueueOutboxEntry(db *bolt.DB, resource string, method string, path string, body interface{}) (*OutboxEntry, error) {
+
+	var serialBody json.RawMessage
+	if body != nil {
+		if serial, err := json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("Failed to serialize outbox body for %v: %v. Error: %v", resource, body, err)
+		} else {
+			serialBody = serial
+		}
+	}
+
+	var entry *OutboxEntry
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(OUTBOX))
+		if err != nil {
+			return err
+		}
+
+		now := uint64(time.Now().Unix())
+		entry = &OutboxEntry{Resource: resource, QueuedTime: now}
+		if current := b.Get([]byte(resource)); current != nil {
+			if err := json.Unmarshal(current, entry); err != nil {
+				return fmt.Errorf("Unable to deserialize outbox entry %v: %v", resource, err)
+			}
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("Unable to get the next outbox sequence: %v", err)
+		}
+
+		entry.Method = method
+		entry.Path = path
+		entry.Body = serialBody
+		entry.Sequence = seq
+		entry.UpdatedTime = now
+
+		if serial, err := json.Marshal(entry); err != nil {
+			return fmt.Errorf("Failed to serialize outbox entry: %v. Error: %v", entry, err)
+		} else {
+			return b.Put([]byte(resource), serial)
+		}
+	})
+
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	return entry, nil
+}
+
+// FindOutboxEntries returns the entries in the outbox, in the order they should be sent.
+func FindOutboxEntries(db *bolt.DB) ([]OutboxEntry, error) {
+	entries := make([]OutboxEntry, 0)
+
+	readErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(OUTBOX)); b != nil {
+			return b.ForEach(func(k, v []byte) error {
+				var e OutboxEntry
+				if err := json.Unmarshal(v, &e); err != nil {
+					return fmt.Errorf("Unable to deserialize outbox entry %v: %v", string(k), err)
+				}
+				entries = append(entries, e)
+				return nil
+			})
+		}
+		return nil // end transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Sequence < entries[j].Sequence })
+	return entries, nil
+}
+
+// DeleteOutboxEntry removes the entry after it has been sent. The entry is kept if a newer update of the resource was
+// queued while it was being sent.
+func DeleteOutboxEntry(db *bolt.DB, entry *OutboxEntry) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(OUTBOX)); b != nil {
+			var current OutboxEntry
+			if v := b.Get([]byte(entry.Resource)); v == nil {
+				return nil
+			} else if err := json.Unmarshal(v, &current); err != nil {
+				return fmt.Errorf("Unable to deserialize outbox entry %v: %v", entry.Resource, err)
+			} else if current.Sequence == entry.Sequence {
+				return b.Delete([]byte(entry.Resource))
+			}
+		}
+		return nil
+	})
+}
+
+// FailedOutboxEntry records that the entry could not be sent.
+func FailedOutboxEntry(db *bolt.DB, entry *OutboxEntry, sendErr error) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(OUTBOX)); b != nil {
+			var current OutboxEntry
+			if v := b.Get([]byte(entry.Resource)); v == nil {
+				return nil
+			} else if err := json.Unmarshal(v, &current); err != nil {
+				return fmt.Errorf("Unable to deserialize outbox entry %v: %v", entry.Resource, err)
+			} else {
+				current.Attempts++
+				current.LastError = sendErr.Error()
+				if serial, err := json.Marshal(current); err != nil {
+					return fmt.Errorf("Failed to serialize outbox entry: %v. Error: %v", current, err)
+				} else {
+					return b.Put([]byte(entry.Resource), serial)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// GetOutboxStatus returns the number of entries in the outbox and the age of the oldest one.
+func GetOutboxStatus(db *bolt.DB) (*OutboxStatus, error) {
+	entries, err := FindOutboxEntries(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &OutboxStatus{QueueDepth: len(entries)}
+	for _, e := range entries {
+		if status.OldestEntryTime == 0 || e.QueuedTime < status.OldestEntryTime {
+			status.OldestEntryTime = e.QueuedTime
+		}
+	}
+	if status.OldestEntryTime != 0 {
+		if now := uint64(time.Now().Unix()); now > status.OldestEntryTime {
+			status.OldestEntryAgeS = now - status.OldestEntryTime
+		}
+	}
+	return status, nil
+}
+
+// DeleteOutbox removes all the entries from the outbox.
+func DeleteOutbox(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(OUTBOX)); b == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(OUTBOX))
+	})
+}
@@ -0,0 +1,67 @@
+// +build unit
+
+package persistence
+
+import (
+	"errors"
+	"testing"
+)
+
+// Verify that an update replaces the queued update of the same resource and moves it behind the others.
+func Test_QueueOutboxEntry(t *testing.T) {
+
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Error(err)
+	}
+	defer cleanTestDir(dir)
+
+	if status, err := GetOutboxStatus(db); err != nil {
+		t.Errorf("failed to get outbox status, error %v", err)
+	} else if status.QueueDepth != 0 || status.OldestEntryTime != 0 {
+		t.Errorf("expected an empty outbox, got %v", status)
+	}
+
+	QueueOutboxEntry(db, "nodestatus", "PUT", "orgs/myorg/nodes/node1/status", map[string]string{"version": "1"})
+	QueueOutboxEntry(db, "agreement/ag1", "PUT", "orgs/myorg/nodes/node1/agreements/ag1", map[string]string{"state": "Agree to proposal"})
+	first, _ := FindOutboxEntries(db)
+	QueueOutboxEntry(db, "nodestatus", "PUT", "orgs/myorg/nodes/node1/status", map[string]string{"version": "2"})
+
+	entries, err := FindOutboxEntries(db)
+	if err != nil {
+		t.Errorf("failed to find outbox entries, error %v", err)
+	} else if len(entries) != 2 {
+		t.Errorf("expected 2 entries, got %v", entries)
+	} else if entries[0].Resource != "agreement/ag1" || entries[1].Resource != "nodestatus" {
+		t.Errorf("expected the node status to be sent last, got %v", entries)
+	} else if string(entries[1].Body) != `{"version":"2"}` {
+		t.Errorf("expected only the latest node status, got %v", string(entries[1].Body))
+	} else if entries[1].QueuedTime != first[0].QueuedTime {
+		t.Errorf("expected the queued time of the first update to be kept, got %v", entries[1])
+	}
+
+	// An entry that was replaced while it was being sent is kept.
+	if err := DeleteOutboxEntry(db, &first[0]); err != nil {
+		t.Errorf("failed to delete outbox entry, error %v", err)
+	} else if status, _ := GetOutboxStatus(db); status.QueueDepth != 2 {
+		t.Errorf("expected the replaced entry to be kept, got %v", status)
+	}
+
+	if err := FailedOutboxEntry(db, &entries[0], errors.New("connection refused")); err != nil {
+		t.Errorf("failed to record the failure, error %v", err)
+	} else if entries, _ := FindOutboxEntries(db); entries[0].Attempts != 1 || entries[0].LastError != "connection refused" {
+		t.Errorf("expected the failure to be recorded, got %v", entries[0])
+	}
+
+	if err := DeleteOutboxEntry(db, &entries[1]); err != nil {
+		t.Errorf("failed to delete outbox entry, error %v", err)
+	} else if status, _ := GetOutboxStatus(db); status.QueueDepth != 1 || status.OldestEntryTime == 0 {
+		t.Errorf("expected one entry left, got %v", status)
+	}
+
+	if err := DeleteOutbox(db); err != nil {
+		t.Errorf("failed to delete the outbox, error %v", err)
+	} else if status, _ := GetOutboxStatus(db); status.QueueDepth != 0 {
+		t.Errorf("expected an empty outbox, got %v", status)
+	}
+}
@@ -0,0 +1,211 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+	"path"
+	"strconv"
+	"time"
+)
+
+// The schema version of the node's database is kept in its own bucket.
+const SCHEMA_VERSION = "schema_version" // The bucket name in the bolt DB.
+const SCHEMA_VERSION_KEY = "version"
+
+// A schema migration converts the database from the previous schema version to its Version. The migration function
+// runs inside the same write transaction that records the new schema version, so a failed migration leaves the
+// database unchanged.
+type SchemaMigration struct {
+	Version     int                     `json:"version"`
+	Description string                  `json:"description"`
+	Migrate     func(tx *bolt.Tx) error `json:"-"`
+}
+
+func (s SchemaMigration) String() string {
+	return fmt.Sprintf("Version: %v, Description: %v", s.Version, s.Description)
+}
+
+// The status of the database schema, used to show which migrations have not been applied yet.
+type SchemaStatus struct {
+	CurrentVersion int               `json:"current_version"`
+	LatestVersion  int               `json:"latest_version"`
+	Pending        []SchemaMigration `json:"pending_migrations"`
+}
+
+func (s SchemaStatus) String() string {
+	return fmt.Sprintf("CurrentVersion: %v, LatestVersion: %v, Pending: %v", s.CurrentVersion, s.LatestVersion, s.Pending)
+}
+
+// The ordered list of schema migrations. A migration must never be removed or reordered once it is released,
+// new migrations are added to the end of the list with the next version number.
+var schemaMigrations []SchemaMigration
+
+// Add a migration to the end of the registry. The version of the migration must immediately follow the version of
+// the last registered migration.
+func registerSchemaMigration(m SchemaMigration) {
+	if m.Version != len(schemaMigrations)+1 {
+		panic(fmt.Sprintf("schema migration %v is out of order, expected version %v", m, len(schemaMigrations)+1))
+	}
+	schemaMigrations = append(schemaMigrations, m)
+}
+
+func init() {
+	registerSchemaMigration(SchemaMigration{
+		Version:     1,
+		Description: "Record the schema version of the database.",
+		Migrate:     func(tx *bolt.Tx) error { return nil },
+	})
+	registerSchemaMigration(SchemaMigration{
+		Version:     2,
+		Description: "Remove the obsolete location, architecture, compute and property attributes.",
+		Migrate:     removeObsoleteAttributes,
+	})
+}
+
+// Returns the most recent schema version known to this agent.
+func GetLatestSchemaVersion() int {
+	return len(schemaMigrations)
+}
+
+// Returns the schema version recorded in the database. A database without a recorded version is at version 0.
+func GetSchemaVersion(db *bolt.DB) (int, error) {
+	version := 0
+	readErr := db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = getSchemaVersion(tx)
+		return err
+	})
+	return version, readErr
+}
+
+func getSchemaVersion(tx *bolt.Tx) (int, error) {
+	if b := tx.Bucket([]byte(SCHEMA_VERSION)); b == nil {
+		return 0, nil
+	} else if v := b.Get([]byte(SCHEMA_VERSION_KEY)); v == nil {
+		return 0, nil
+	} else if version, err := strconv.Atoi(string(v)); err != nil {
+		return 0, fmt.Errorf("Unable to deserialize schema version %v, error: %v", string(v), err)
+	} else {
+		return version, nil
+	}
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	if b, err := tx.CreateBucketIfNotExists([]byte(SCHEMA_VERSION)); err != nil {
+		return err
+	} else {
+		return b.Put([]byte(SCHEMA_VERSION_KEY), []byte(strconv.Itoa(version)))
+	}
+}
+
+// Returns the current schema version and the migrations that have not been applied to the database yet.
+func GetSchemaStatus(db *bolt.DB) (*SchemaStatus, error) {
+	version, err := GetSchemaVersion(db)
+	if err != nil {
+		return nil, err
+	} else if version > GetLatestSchemaVersion() {
+		return nil, errors.New(fmt.Sprintf("database schema version %v is newer than the latest version %v supported by this agent", version, GetLatestSchemaVersion()))
+	}
+
+	return &SchemaStatus{
+		CurrentVersion: version,
+		LatestVersion:  GetLatestSchemaVersion(),
+		Pending:        append([]SchemaMigration{}, schemaMigrations[version:]...),
+	}, nil
+}
+
+// Bring the database schema up to the latest version. A new database is stamped with the latest version without
+// running any migrations. Otherwise, a copy of the database is written to the backup directory before the first
+// migration runs, and each migration is applied in its own transaction. The name of the backup file is returned,
+// it is empty if there was nothing to migrate.
+func MigrateSchema(db *bolt.DB, backupDir string) (string, error) {
+
+	status, err := GetSchemaStatus(db)
+	if err != nil {
+		return "", err
+	} else if len(status.Pending) == 0 {
+		glog.V(3).Infof("Database schema is at the latest version %v", status.CurrentVersion)
+		return "", nil
+	}
+
+	if isNew, err := isNewDatabase(db); err != nil {
+		return "", err
+	} else if isNew {
+		glog.V(3).Infof("Setting schema version of new database to %v", status.LatestVersion)
+		return "", db.Update(func(tx *bolt.Tx) error {
+			return setSchemaVersion(tx, status.LatestVersion)
+		})
+	}
+
+	// Take a consistent copy of the database before changing anything.
+	backupFile := path.Join(backupDir, fmt.Sprintf("%v.schema-v%v.%v.bak", path.Base(db.Path()), status.CurrentVersion, time.Now().Unix()))
+	if err := db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(backupFile, 0600)
+	}); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to back up the database to %v before migrating the schema, error: %v", backupFile, err))
+	}
+	glog.Infof("Backed up the database to %v before migrating the schema from version %v to %v", backupFile, status.CurrentVersion, status.LatestVersion)
+
+	for _, m := range status.Pending {
+		if err := db.Update(func(tx *bolt.Tx) error {
+			if err := m.Migrate(tx); err != nil {
+				return err
+			}
+			return setSchemaVersion(tx, m.Version)
+		}); err != nil {
+			return backupFile, errors.New(fmt.Sprintf("unable to migrate the database schema to version %v (%v), error: %v. The database before the migration is in %v", m.Version, m.Description, err, backupFile))
+		}
+		glog.Infof("Migrated the database schema to version %v: %v", m.Version, m.Description)
+	}
+
+	return backupFile, nil
+}
+
+// A database is new if it has no buckets at all.
+func isNewDatabase(db *bolt.DB) (bool, error) {
+	isNew := true
+	readErr := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			isNew = false
+			return nil
+		})
+	})
+	return isNew, readErr
+}
+
+// Version 2: The location, architecture, compute and property attributes were replaced by the node policy. They
+// used to be skipped every time the attributes were read.
+func removeObsoleteAttributes(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(ATTRIBUTES))
+	if b == nil {
+		return nil
+	}
+
+	obsolete := make([][]byte, 0)
+	if err := b.ForEach(func(k, v []byte) error {
+		var meta MetaAttributesOnly
+		if err := json.Unmarshal(v, &meta); err != nil {
+			return fmt.Errorf("Unable to deserialize attribute %v, error: %v", string(k), err)
+		} else if meta.Meta == nil {
+			return nil
+		}
+
+		switch meta.Meta.Type {
+		case "LocationAttributes", "ArchitectureAttributes", "ComputeAttributes", "PropertyAttributes":
+			obsolete = append(obsolete, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range obsolete {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
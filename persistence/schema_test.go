@@ -0,0 +1,202 @@
+// +build unit
+
+package persistence
+
+import (
+	"github.com/boltdb/bolt"
+	"os"
+	"testing"
+)
+
+// Raw records written by agents that predate the schema version, used to build fixture databases.
+var fixtureV0Attributes = map[string]string{
+	"loc1": `{"meta":{"id":"loc1","type":"LocationAttributes","label":"Registered Location Facts","host_only":false,"publishable":false},"lat":"41.921766","lon":"-73.894224","user_provided_coords":true,"use_gps":false}`,
+	"arch1": `{"meta":{"id":"arch1","type":"ArchitectureAttributes","label":"Architecture","host_only":false,"publishable":true},"architecture":"amd64"}`,
+	"ui1": `{"meta":{"id":"ui1","type":"UserInputAttributes","label":"app","host_only":false,"publishable":true},"service_specs":[{"url":"myservice","organization":"myorg"}],"mappings":{"var1":"a"}}`,
+}
+
+var fixtureV0Device = `{"id":"testid","organization":"myorg","pattern":"myorg/mypattern","name":"testname","nodeType":"device","token":"abc","token_last_valid_time":1600000000,"token_valid":true,"ha":false,"configstate":{"state":"configured","last_update_time":1600000000}}`
+
+// Create a database in the format written by agents that predate the schema version.
+func createFixtureV0(t *testing.T, db *bolt.DB) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(ATTRIBUTES)); err != nil {
+			return err
+		} else {
+			for k, v := range fixtureV0Attributes {
+				if err := b.Put([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+		if b, err := tx.CreateBucketIfNotExists([]byte(DEVICES)); err != nil {
+			return err
+		} else {
+			return b.Put([]byte(DEVICES), []byte(fixtureV0Device))
+		}
+	}); err != nil {
+		t.Fatalf("unable to create fixture database, error %v", err)
+	}
+}
+
+func Test_MigrateSchema_new_database(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	if backup, err := MigrateSchema(db, dir); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if backup != "" {
+		t.Errorf("a new database should not be backed up, backup %v", backup)
+	}
+
+	if version, err := GetSchemaVersion(db); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if version != GetLatestSchemaVersion() {
+		t.Errorf("new database should be at version %v, is at %v", GetLatestSchemaVersion(), version)
+	}
+}
+
+func Test_MigrateSchema_from_v0(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	createFixtureV0(t, db)
+
+	if status, err := GetSchemaStatus(db); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if status.CurrentVersion != 0 || len(status.Pending) != GetLatestSchemaVersion() {
+		t.Errorf("wrong schema status for fixture database: %v", status)
+	}
+
+	backup, err := MigrateSchema(db, dir)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if _, err := os.Stat(backup); err != nil {
+		t.Errorf("backup file %v was not created, error %v", backup, err)
+	}
+
+	if status, err := GetSchemaStatus(db); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if status.CurrentVersion != GetLatestSchemaVersion() || len(status.Pending) != 0 {
+		t.Errorf("wrong schema status after migration: %v", status)
+	}
+
+	// The obsolete attributes are gone, the others are untouched.
+	if attrs, err := FindApplicableAttributes(db, "", ""); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if len(attrs) != 1 || attrs[0].GetMeta().Id != "ui1" {
+		t.Errorf("wrong attributes after migration: %v", attrs)
+	}
+
+	if dev, err := FindExchangeDevice(db); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if dev == nil || dev.Id != "testid" {
+		t.Errorf("device was not preserved by the migration: %v", dev)
+	}
+
+	// The backup still has the original content.
+	backupDB, err := bolt.Open(backup, 0600, nil)
+	if err != nil {
+		t.Fatalf("unable to open backup, error %v", err)
+	}
+	defer backupDB.Close()
+	if version, err := GetSchemaVersion(backupDB); err != nil || version != 0 {
+		t.Errorf("backup should be at version 0, is at %v, error %v", version, err)
+	}
+	backupDB.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket([]byte(ATTRIBUTES)).Stats().KeyN; n != len(fixtureV0Attributes) {
+			t.Errorf("backup should have %v attributes, has %v", len(fixtureV0Attributes), n)
+		}
+		return nil
+	})
+
+	// Migrating again is a no-op.
+	if backup, err := MigrateSchema(db, dir); err != nil || backup != "" {
+		t.Errorf("second migration should do nothing, backup %v, error %v", backup, err)
+	}
+}
+
+func Test_MigrateSchema_from_v1(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	createFixtureV0(t, db)
+	if err := db.Update(func(tx *bolt.Tx) error { return setSchemaVersion(tx, 1) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, err := GetSchemaStatus(db); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if status.CurrentVersion != 1 || len(status.Pending) != GetLatestSchemaVersion()-1 || status.Pending[0].Version != 2 {
+		t.Errorf("wrong schema status for fixture database: %v", status)
+	}
+
+	if _, err := MigrateSchema(db, dir); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	} else if attrs, err := FindApplicableAttributes(db, "", ""); err != nil {
+		t.Errorf("unexpected error %v", err)
+	} else if len(attrs) != 1 {
+		t.Errorf("wrong attributes after migration: %v", attrs)
+	}
+}
+
+func Test_MigrateSchema_failure(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	createFixtureV0(t, db)
+
+	// An attribute that cannot be read makes the attribute migration fail.
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ATTRIBUTES)).Put([]byte("bad"), []byte("not json"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if backup, err := MigrateSchema(db, dir); err == nil {
+		t.Errorf("migration should have failed")
+	} else if backup == "" {
+		t.Errorf("the backup file should be returned on failure")
+	}
+
+	// The failed migration was rolled back, the successful ones were not.
+	if version, err := GetSchemaVersion(db); err != nil || version != 1 {
+		t.Errorf("database should be at version 1, is at %v, error %v", version, err)
+	}
+	db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket([]byte(ATTRIBUTES)).Stats().KeyN; n != len(fixtureV0Attributes)+1 {
+			t.Errorf("failed migration should not remove attributes, %v left", n)
+		}
+		return nil
+	})
+}
+
+func Test_GetSchemaStatus_newer_database(t *testing.T) {
+	dir, db, err := utsetup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanTestDir(dir)
+
+	if err := db.Update(func(tx *bolt.Tx) error { return setSchemaVersion(tx, GetLatestSchemaVersion()+1) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetSchemaStatus(db); err == nil {
+		t.Errorf("a database from a newer agent should be rejected")
+	} else if _, err := MigrateSchema(db, dir); err == nil {
+		t.Errorf("a database from a newer agent should not be migrated")
+	}
+}
@@ -1,7 +1,6 @@
 package producer
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/boltdb/bolt"
@@ -17,7 +16,6 @@ import (
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"strings"
-	"time"
 )
 
 const (
@@ -108,7 +106,7 @@ func (w *BaseProducerProtocolHandler) sendMessage(mt interface{}, pay []byte) er
 	glog.V(3).Infof(BPPHlogString(w.Name(), fmt.Sprintf("Sending exchange message to: %v, message %v", messageTarget.ReceiverExchangeId, string(pay))))
 
 	// Get my own keys
-	myPubKey, myPrivKey, _ := exchange.GetKeys("")
+	_, myPrivKey, _ := exchange.GetKeys("")
 
 	// Demarshal the receiver's public key if we need to
 	if messageTarget.ReceiverPublicKeyObj == nil {
@@ -119,13 +117,10 @@ func (w *BaseProducerProtocolHandler) sendMessage(mt interface{}, pay []byte) er
 		}
 	}
 
-	// Create an encrypted message
-	if encryptedMsg, err := exchange.ConstructExchangeMessage(pay, myPubKey, myPrivKey, messageTarget.ReceiverPublicKeyObj); err != nil {
+	// Create an encrypted message, in the envelope that both keys support
+	if msgBody, err := exchange.ConstructVersionedExchangeMessage(pay, myPrivKey, messageTarget.ReceiverPublicKeyObj); err != nil {
 		return errors.New(fmt.Sprintf("Unable to construct encrypted message from %v, error %v", pay, err))
-		// Marshal it into a byte array
-	} else if msgBody, err := json.Marshal(encryptedMsg); err != nil {
-		return errors.New(fmt.Sprintf("Unable to marshal exchange message %v, error %v", encryptedMsg, err))
-		// Send it to the device's message queue
+		// Send it to the agbot's message queue
 	} else {
 		pm := exchange.CreatePostMessage(msgBody, w.config.Edge.ExchangeMessageTTL)
 		var resp interface{}
@@ -133,24 +128,17 @@ func (w *BaseProducerProtocolHandler) sendMessage(mt interface{}, pay []byte) er
 		targetURL := w.config.Edge.ExchangeURL + "orgs/" + exchange.GetOrg(messageTarget.ReceiverExchangeId) + "/agbots/" + exchange.GetId(messageTarget.ReceiverExchangeId) + "/msgs"
 
 		httpClientFactory := w.ec.GetHTTPFactory()
-		retryCount := httpClientFactory.RetryCount
-		retryInterval := httpClientFactory.GetRetryInterval()
+		retry := exchange.NewRetry(httpClientFactory)
 
 		for {
 			if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "POST", targetURL, w.ec.GetExchangeId(), w.ec.GetExchangeToken(), pm, &resp); err != nil {
 				return err
 			} else if tpErr != nil {
 				glog.Warningf(tpErr.Error())
-				if httpClientFactory.RetryCount == 0 {
-					time.Sleep(time.Duration(retryInterval) * time.Second)
-					continue
-				} else if retryCount == 0 {
+				if !retry.Backoff(tpErr) {
 					return errors.New(fmt.Sprintf("exceeded %v retries trying to retrieve agbot for %v", httpClientFactory.RetryCount, tpErr))
-				} else {
-					retryCount--
-					time.Sleep(time.Duration(retryInterval) * time.Second)
-					continue
 				}
+				continue
 			} else {
 				glog.V(5).Infof(BPPHlogString(w.Name(), fmt.Sprintf("Sent message for %v to exchange.", messageTarget.ReceiverExchangeId)))
 				return nil
@@ -506,8 +494,7 @@ func (w *BaseProducerProtocolHandler) getAgbot(agbotId string, url string, devic
 	targetURL := url + "orgs/" + exchange.GetOrg(agbotId) + "/agbots/" + exchange.GetId(agbotId)
 
 	httpClientFactory := w.ec.GetHTTPFactory()
-	retryCount := httpClientFactory.RetryCount
-	retryInterval := httpClientFactory.GetRetryInterval()
+	retry := exchange.NewRetry(httpClientFactory)
 
 	for {
 		if err, tpErr := exchange.InvokeExchange(httpClientFactory.NewHTTPClient(nil), "GET", targetURL, deviceId, token, nil, &resp); err != nil {
@@ -515,16 +502,10 @@ func (w *BaseProducerProtocolHandler) getAgbot(agbotId string, url string, devic
 			return nil, err
 		} else if tpErr != nil {
 			glog.Warningf(BPPHlogString(w.Name(), tpErr.Error()))
-			if httpClientFactory.RetryCount == 0 {
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
-			} else if retryCount == 0 {
+			if !retry.Backoff(tpErr) {
 				return nil, errors.New(fmt.Sprintf("exceeded %v retries trying to retrieve agbot for %v", httpClientFactory.RetryCount, tpErr))
-			} else {
-				retryCount--
-				time.Sleep(time.Duration(retryInterval) * time.Second)
-				continue
 			}
+			continue
 		} else {
 			ags := resp.(*exchange.GetAgbotsResponse).Agbots
 			if ag, there := ags[agbotId]; !there {
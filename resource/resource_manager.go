@@ -164,25 +164,54 @@ func (r ResourceManager) StartFileSyncService(am *AuthenticationManager) error {
 }
 
 func censorAndDumpConfig() {
-	toBeCensored := []*string{&common.Configuration.ServerCertificate, &common.Configuration.ServerKey,
-		&common.Configuration.HTTPCSSCACertificate,
-		&common.Configuration.MQTTUserName, &common.Configuration.MQTTPassword,
-		&common.Configuration.MQTTCACertificate, &common.Configuration.MQTTSSLCert, &common.Configuration.MQTTSSLKey,
-		&common.Configuration.MongoUsername, &common.Configuration.MongoPassword, &common.Configuration.MongoCACertificate}
-	backups := make([]string, len(toBeCensored))
-
-	for index, fieldPointer := range toBeCensored {
-		backups[index] = *fieldPointer
+	backups := censorFields(essSecretFields(&common.Configuration))
+
+	trace.Dump("Loaded configuration:", common.Configuration)
+
+	for fieldPointer, backup := range backups {
+		*fieldPointer = backup
+	}
+}
+
+// Return pointers to all the fields in the ESS config that contain secrets.
+func essSecretFields(cfg *common.Config) []*string {
+	return []*string{&cfg.ServerCertificate, &cfg.ServerKey,
+		&cfg.HTTPCSSCACertificate,
+		&cfg.MQTTUserName, &cfg.MQTTPassword,
+		&cfg.MQTTCACertificate, &cfg.MQTTSSLCert, &cfg.MQTTSSLKey,
+		&cfg.MongoUsername, &cfg.MongoPassword, &cfg.MongoCACertificate}
+}
+
+// Replace the non-empty values of the input fields with a placeholder. The original values are returned so that
+// the caller can restore them if necessary.
+func censorFields(toBeCensored []*string) map[*string]string {
+	backups := make(map[*string]string, len(toBeCensored))
+
+	for _, fieldPointer := range toBeCensored {
+		backups[fieldPointer] = *fieldPointer
 		if len(*fieldPointer) != 0 {
 			*fieldPointer = "<...>"
 		}
 	}
 
-	trace.Dump("Loaded configuration:", common.Configuration)
+	return backups
+}
 
-	for index, fieldPointer := range toBeCensored {
-		*fieldPointer = backups[index]
-	}
+// Returns a copy of the embedded ESS configuration with the secrets removed.
+func GetCensoredESSConfig() common.Config {
+	cfg := common.Configuration
+	censorFields(essSecretFields(&cfg))
+	return cfg
+}
+
+// Returns a copy of the anax configuration with the secrets removed. The collaborators are not part of the
+// copy because they are not configurable.
+func GetCensoredHorizonConfig(hc *config.HorizonConfig) config.HorizonConfig {
+	cfg := *hc
+	cfg.Collaborators = config.Collaborators{}
+	censorFields([]*string{&cfg.AgreementBot.Postgresql.Password, &cfg.AgreementBot.ActiveAgreementsPW,
+		&cfg.AgreementBot.ExchangeToken, &cfg.AgreementBot.DefaultWorkloadPW})
+	return cfg
 }
 
 func (r ResourceManager) StopFileSyncService() {
@@ -75,7 +75,11 @@ func (w *ResourceWorker) NewEvent(incoming events.Message) {
 	case *events.EdgeRegisteredExchangeMessage:
 		msg, _ := incoming.(*events.EdgeRegisteredExchangeMessage)
 		w.EC = worker.NewExchangeContext(fmt.Sprintf("%v/%v", msg.Org(), msg.DeviceId()), msg.Token(), w.Config.Edge.ExchangeURL, w.Config.GetCSSURL(), w.Config.Collaborators.HTTPClientFactory)
-		w.Commands <- NewNodeConfigCommand(msg)
+
+		// The ESS is already running when the node is registered again.
+		if msg.Event().Id == events.NEW_DEVICE_REG {
+			w.Commands <- NewNodeConfigCommand(msg)
+		}
 
 	case *events.NodeShutdownCompleteMessage:
 		msg, _ := incoming.(*events.NodeShutdownCompleteMessage)
@@ -0,0 +1,20 @@
+// +build unit
+
+package version
+
+import (
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/semanticversion"
+	"testing"
+)
+
+// A feature that the minimum exchange version has is used without a check, so it must not be detected.
+func Test_ExchangeFeatures_newer_than_minimum(t *testing.T) {
+	for _, feature := range exchange.ExchangeFeatures {
+		if comp, err := semanticversion.CompareVersions(feature.MinVersion, MINIMUM_EXCHANGE_VERSION); err != nil {
+			t.Errorf("unable to compare the version %v of feature %v, error: %v", feature.MinVersion, feature.Name, err)
+		} else if comp <= 0 {
+			t.Errorf("feature %v is in exchange version %v, which is not newer than the minimum exchange version %v", feature.Name, feature.MinVersion, MINIMUM_EXCHANGE_VERSION)
+		}
+	}
+}
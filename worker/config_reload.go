@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"flag"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/events"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The config reloader reads the config file again when anax receives SIGHUP or when a reload is requested through the
+// API. The fields that can be reloaded are changed in the running configuration, which is shared by all the workers and
+// read through its synchronized getters, and a ConfigReloadedMessage is sent to tell the workers which fields changed. Changes to other fields are rejected and
+// reported in the result of the reload, they take effect when anax is restarted.
+
+// The sources of a reload.
+const (
+	RELOAD_SOURCE_SIGNAL = "signal"
+	RELOAD_SOURCE_API    = "api"
+)
+
+// The name used for the reloader as the source of the messages it sends.
+const CONFIG_RELOADER = "ConfigReloader"
+
+type ConfigReloader struct {
+	lock       sync.Mutex
+	configFile string
+	cfg        *config.HorizonConfig
+	messages   chan events.Message
+	verbosity  string // The -v flag when anax started, used when the configuration does not set a verbosity.
+	last       *config.ReloadResult
+}
+
+var configReloader *ConfigReloader
+
+// Returns the reloader used by anax, or nil if there isn't one.
+func GetConfigReloader() *ConfigReloader {
+	return configReloader
+}
+
+// Create the reloader for the running configuration, read from the config file, and make it the reloader used by anax.
+// The logging verbosity in the configuration takes effect immediately.
+func NewConfigReloader(configFile string, cfg *config.HorizonConfig) *ConfigReloader {
+	r := &ConfigReloader{
+		configFile: configFile,
+		cfg:        cfg,
+		messages:   make(chan events.Message, 10),
+	}
+	if f := flag.Lookup("v"); f != nil {
+		r.verbosity = f.Value.String()
+	}
+	r.setVerbosity(cfg.Log.Verbosity)
+
+	configReloader = r
+	return r
+}
+
+func (r *ConfigReloader) String() string {
+	return fmt.Sprintf("ConfigFile: %v, Verbosity: %v, Last: %v", r.configFile, r.verbosity, r.last)
+}
+
+// The messages sent by the reloader. The reloader must be added to the message handler registry as a source.
+func (r *ConfigReloader) Messages() chan events.Message {
+	return r.messages
+}
+
+// Reload the config file whenever anax receives SIGHUP.
+func (r *ConfigReloader) HandleSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	// This routine does not need to be a subworker because it will terminate on its own when the main anax process terminates.
+	go func() {
+		for range hup {
+			glog.Infof(crLogString("received SIGHUP, reloading the configuration"))
+			r.Reload(RELOAD_SOURCE_SIGNAL)
+		}
+	}()
+}
+
+// Read the config file and apply the changes to the reloadable fields. The result is also remembered as the last reload.
+func (r *ConfigReloader) Reload(source string) config.ReloadResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	result := config.ReloadResult{
+		Time:     uint64(time.Now().Unix()),
+		Source:   source,
+		Applied:  []config.ConfigChange{},
+		Rejected: []config.ConfigChange{},
+	}
+
+	if newCfg, err := config.Read(r.configFile); err != nil {
+		result.Error = err.Error()
+		glog.Errorf(crLogString(fmt.Sprintf("unable to reload the configuration, error: %v", err)))
+	} else {
+		result.Applied, result.Rejected = r.cfg.ApplyReload(newCfg)
+	}
+
+	for _, change := range result.Applied {
+		glog.Infof(crLogString(fmt.Sprintf("changed %v from %v to %v", change.Field, change.Old, change.New)))
+		if change.Field == "Log.Verbosity" {
+			r.setVerbosity(r.cfg.GetLogVerbosity())
+		}
+	}
+	for _, change := range result.Rejected {
+		glog.Warningf(crLogString(fmt.Sprintf("not changing %v, %v", change.Field, change.Reason)))
+	}
+
+	if len(result.Applied) != 0 {
+		select {
+		case r.messages <- events.NewConfigReloadedMessage(events.CONFIG_RELOADED, result.AppliedFields()):
+		default:
+			glog.Errorf(crLogString(fmt.Sprintf("unable to tell the workers that %v changed, too many reloads are in progress", result.AppliedFields())))
+		}
+	}
+
+	r.last = &result
+	return result
+}
+
+// Returns the result of the last reload, or nil if the configuration has not been reloaded.
+func (r *ConfigReloader) LastReload() *config.ReloadResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.last
+}
+
+// Returns the fields that can be reloaded and the result of the last reload.
+func (r *ConfigReloader) Status() config.ReloadStatus {
+	return config.ReloadStatus{
+		ReloadableFields: config.ReloadableFields(),
+		LastReload:       r.LastReload(),
+	}
+}
+
+// Set the glog verbosity. 0 means the verbosity from the command line.
+func (r *ConfigReloader) setVerbosity(verbosity int) {
+	v := r.verbosity
+	if verbosity > 0 {
+		v = strconv.Itoa(verbosity)
+	}
+	if v == "" {
+		return
+	} else if err := flag.Set("v", v); err != nil {
+		glog.Errorf(crLogString(fmt.Sprintf("unable to set the log verbosity to %v, error: %v", v, err)))
+	}
+}
+
+var crLogString = func(v interface{}) string {
+	return fmt.Sprintf("ConfigReloader: %v", v)
+}
@@ -0,0 +1,82 @@
+// +build unit
+
+package worker
+
+import (
+	"flag"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/events"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func Test_ConfigReloader_reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := path.Join(dir, "anax.json")
+	writeConfig := func(content string) {
+		if err := ioutil.WriteFile(configFile, []byte(content), 0600); err != nil {
+			t.Fatalf("unable to write config file, error: %v", err)
+		}
+	}
+
+	writeConfig(`{"Edge": {"DBPath": "/var/horizon", "ExchangeMessagePollInterval": 20}, "AgreementBot": {"FullRescanS": 600}}`)
+	cfg, err := config.Read(configFile)
+	if err != nil {
+		t.Fatalf("unable to read config file, error: %v", err)
+	}
+
+	// Restore the log verbosity set by the tests in this package.
+	defer flag.Set("v", flag.Lookup("v").Value.String())
+
+	r := NewConfigReloader(configFile, cfg)
+	if GetConfigReloader() != r {
+		t.Errorf("expected the reloader to be the reloader used by anax")
+	} else if r.LastReload() != nil {
+		t.Errorf("expected no reload, got %v", r.LastReload())
+	}
+
+	writeConfig(`{"Edge": {"DBPath": "/tmp/horizon", "ExchangeMessagePollInterval": 5}, "AgreementBot": {"FullRescanS": 60}, "Log": {"Verbosity": 2}}`)
+	result := r.Reload(RELOAD_SOURCE_API)
+
+	if result.Error != "" || result.Source != RELOAD_SOURCE_API {
+		t.Errorf("unexpected result %v", result)
+	} else if expected := []string{"Edge.ExchangeMessagePollInterval", "AgreementBot.FullRescanS", "Log.Verbosity"}; !reflect.DeepEqual(result.AppliedFields(), expected) {
+		t.Errorf("expected %v to be applied, got %v", expected, result.Applied)
+	} else if len(result.Rejected) != 1 || result.Rejected[0].Field != "Edge.DBPath" {
+		t.Errorf("expected Edge.DBPath to be rejected, got %v", result.Rejected)
+	}
+
+	if cfg.Edge.ExchangeMessagePollInterval != 5 || cfg.AgreementBot.FullRescanS != 60 || cfg.Edge.DBPath != "/var/horizon" {
+		t.Errorf("unexpected running configuration %v", cfg.String())
+	} else if v := flag.Lookup("v").Value.String(); v != "2" {
+		t.Errorf("expected the log verbosity to be 2, was %v", v)
+	}
+
+	// The workers are told which fields changed.
+	select {
+	case msg := <-r.Messages():
+		if crm, ok := msg.(*events.ConfigReloadedMessage); !ok || !crm.HasField("AgreementBot.FullRescanS") || crm.HasField("Edge.DBPath") {
+			t.Errorf("unexpected message %v", msg)
+		}
+	default:
+		t.Errorf("expected a config reloaded message")
+	}
+
+	// A config file that cannot be read changes nothing.
+	writeConfig(`{"Edge": `)
+	if result := r.Reload(RELOAD_SOURCE_SIGNAL); result.Error == "" || len(result.Applied) != 0 {
+		t.Errorf("expected an error, got %v", result)
+	} else if status := r.Status(); status.LastReload == nil || status.LastReload.Source != RELOAD_SOURCE_SIGNAL || len(status.ReloadableFields) == 0 {
+		t.Errorf("unexpected status %v", status)
+	} else if len(r.Messages()) != 0 {
+		t.Errorf("expected no config reloaded message")
+	}
+}
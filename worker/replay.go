@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/eventjournal"
+	"github.com/open-horizon/anax/events"
+	"sync"
+)
+
+// The JournalReplayer feeds the events recorded in an event journal into a chosen set of workers, in the order they were
+// originally dispatched, so that a sequence of events that caused a problem can be reproduced in a test. Each recorded
+// event is delivered only to the chosen workers that it was delivered to originally. The messages sent by the workers
+// while the journal is replayed are collected rather than dispatched, because the events they caused in the original
+// run are already in the journal. Only messages that implement events.JournalMessage can be replayed, the records of
+// other messages are skipped.
+type JournalReplayer struct {
+	lock     sync.Mutex
+	workers  map[string]MessageHandler
+	emitted  []ReplayedMessage
+	stop     chan bool
+	stopped  sync.WaitGroup
+	replayed uint64
+}
+
+// A message sent by a worker while a journal was being replayed.
+type ReplayedMessage struct {
+	Source  string
+	Message events.Message
+}
+
+func (r ReplayedMessage) String() string {
+	return fmt.Sprintf("Source: %v, Message: %v", r.Source, r.Message.ShortString())
+}
+
+// Create a replayer for the workers. The workers should already be started. The messages they send are collected until
+// the replayer is stopped.
+func NewJournalReplayer(workers ...MessageHandler) *JournalReplayer {
+	r := &JournalReplayer{
+		workers: make(map[string]MessageHandler),
+		emitted: make([]ReplayedMessage, 0),
+		stop:    make(chan bool),
+	}
+
+	for _, w := range workers {
+		r.workers[w.GetName()] = w
+		r.stopped.Add(1)
+		go r.collect(w)
+	}
+	return r
+}
+
+func (r *JournalReplayer) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return fmt.Sprintf("Workers: %v, Replayed: %v, Emitted: %v", len(r.workers), r.replayed, len(r.emitted))
+}
+
+// Collect the messages sent by a worker until the replayer is stopped.
+func (r *JournalReplayer) collect(w MessageHandler) {
+	defer r.stopped.Done()
+	for {
+		select {
+		case msg := <-w.Messages():
+			glog.V(5).Infof(rpLogString(fmt.Sprintf("collected message from %v: %v", w.GetName(), msg.ShortString())))
+			r.lock.Lock()
+			r.emitted = append(r.emitted, ReplayedMessage{Source: w.GetName(), Message: msg})
+			r.lock.Unlock()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Deliver the recorded events to the workers. The number of records that were delivered to at least one worker is
+// returned. Replay stops at the first recorded message that cannot be decoded.
+func (r *JournalReplayer) Replay(records []eventjournal.JournalRecord) (int, error) {
+	delivered := 0
+	for _, rec := range records {
+		destinations := make([]MessageHandler, 0, len(rec.Destinations))
+		for _, name := range rec.Destinations {
+			if w, ok := r.workers[name]; ok {
+				destinations = append(destinations, w)
+			}
+		}
+		if len(destinations) == 0 {
+			continue
+		} else if !rec.IsReplayable() {
+			glog.V(3).Infof(rpLogString(fmt.Sprintf("skipping record %v, the message was not recorded", rec.Sequence)))
+			continue
+		}
+
+		msg, err := rec.Decode()
+		if err != nil {
+			return delivered, errors.New(fmt.Sprintf("unable to decode journal record %v, error: %v", rec, err))
+		}
+
+		for _, w := range destinations {
+			glog.V(5).Infof(rpLogString(fmt.Sprintf("delivering record %v to %v", rec.Sequence, w.GetName())))
+			w.NewEvent(msg)
+		}
+
+		delivered++
+		r.lock.Lock()
+		r.replayed++
+		r.lock.Unlock()
+	}
+	return delivered, nil
+}
+
+// Returns the messages sent by the workers so far, in the order they were sent.
+func (r *JournalReplayer) Emitted() []ReplayedMessage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]ReplayedMessage{}, r.emitted...)
+}
+
+// Stop collecting the messages sent by the workers.
+func (r *JournalReplayer) Stop() {
+	close(r.stop)
+	r.stopped.Wait()
+}
+
+var rpLogString = func(v interface{}) string {
+	return fmt.Sprintf("JournalReplayer: %v", v)
+}
@@ -0,0 +1,149 @@
+// +build unit
+
+package worker
+
+import (
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/eventjournal"
+	"github.com/open-horizon/anax/events"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A message handler that remembers the events it receives and sends a container message for each agreement reached.
+type RecordingHandler struct {
+	name     string
+	lock     sync.Mutex
+	received []events.Message
+	messages chan events.Message
+}
+
+func NewRecordingHandler(name string) *RecordingHandler {
+	return &RecordingHandler{name: name, received: make([]events.Message, 0), messages: make(chan events.Message)}
+}
+
+func (r *RecordingHandler) GetName() string {
+	return r.name
+}
+
+func (r *RecordingHandler) NewEvent(msg events.Message) {
+	r.lock.Lock()
+	r.received = append(r.received, msg)
+	r.lock.Unlock()
+
+	if _, ok := msg.(*events.AgreementReachedMessage); ok {
+		r.messages <- events.NewContainerMessage(events.EXECUTION_BEGUN, events.ContainerLaunchContext{Name: r.name}, "svc", "")
+	}
+}
+
+func (r *RecordingHandler) Messages() chan events.Message {
+	return r.messages
+}
+
+func (r *RecordingHandler) Received() []events.Message {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]events.Message{}, r.received...)
+}
+
+func Test_journal_replay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := eventjournal.NewJournal(&config.EventJournalConfig{Path: dir})
+	if err != nil {
+		t.Fatalf("unable to create journal, error: %v", err)
+	}
+
+	// Record the events dispatched to two workers.
+	mhr := NewMessageHandlerRegistry()
+	mhr.SetJournal(j)
+	mhr.Add(NewRecordingHandler("Governance"))
+	mhr.Add(NewRecordingHandler("Container"))
+
+	msgs := []events.Message{
+		events.NewAgreementMessage(events.AGREEMENT_REACHED, &events.AgreementLaunchContext{AgreementProtocol: "Basic", AgreementId: "ag1"}),
+		events.NewGovernanceWorkloadCancelationMessage(events.AGREEMENT_ENDED, events.AG_TERMINATED, "Basic", "ag1", nil),
+		events.NewNodeShutdownMessage(events.START_UNCONFIGURE, false, false),
+	}
+	for _, msg := range msgs {
+		// The recording handlers send a message for each agreement, which is not dispatched in this test.
+		stop := drain(mhr)
+		if _, err := eventHandler(msg, "Agreement", mhr); err != nil {
+			t.Errorf("unable to handle %v, error: %v", msg, err)
+		}
+		close(stop)
+	}
+
+	// A message without a journal form is recorded without its state, and is not replayed.
+	stop := drain(mhr)
+	if _, err := eventHandler(events.NewAllBlockchainShutdownMessage(events.ALL_STOP), "Agreement", mhr); err != nil {
+		t.Errorf("unable to handle blockchain shutdown, error: %v", err)
+	}
+	close(stop)
+
+	if _, err := eventHandler(events.NewWorkerStopMessage(events.WORKER_STOP, "Container"), "Container", mhr); err != nil {
+		t.Errorf("unable to handle worker stop, error: %v", err)
+	}
+	j.Close()
+
+	records, err := eventjournal.ReadJournalDir(dir)
+	if err != nil {
+		t.Fatalf("unable to read journal, error: %v", err)
+	} else if len(records) != 5 {
+		t.Fatalf("expected 5 records, got %v", records)
+	} else if records[0].Source != "Agreement" || !reflect.DeepEqual(records[0].Destinations, []string{"Container", "Governance"}) {
+		t.Errorf("unexpected record %v", records[0])
+	} else if records[3].IsReplayable() || records[3].EventId != events.ALL_STOP {
+		t.Errorf("unexpected blockchain shutdown record %v", records[3])
+	} else if records[4].Source != "Container" || len(records[4].Destinations) != 0 {
+		t.Errorf("unexpected worker stop record %v", records[4])
+	}
+
+	// Replay the journal into a new governance worker only.
+	gov := NewRecordingHandler("Governance")
+	replayer := NewJournalReplayer(gov)
+	delivered, err := replayer.Replay(records)
+	if err != nil {
+		t.Fatalf("unable to replay journal, error: %v", err)
+	} else if delivered != 3 {
+		t.Errorf("expected 3 records to be delivered, got %v", delivered)
+	}
+
+	if received := gov.Received(); !reflect.DeepEqual(received, msgs) {
+		t.Errorf("expected %v to be replayed, got %v", msgs, received)
+	}
+
+	// The message sent by the worker during the replay is collected.
+	for i := 0; i < 50 && len(replayer.Emitted()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	replayer.Stop()
+	if emitted := replayer.Emitted(); len(emitted) != 1 || emitted[0].Source != "Governance" || emitted[0].Message.Event().Id != events.EXECUTION_BEGUN {
+		t.Errorf("expected a container message from Governance, got %v", emitted)
+	}
+}
+
+// Read and discard the messages sent by the workers in the registry until the returned channel is closed.
+func drain(mhr *MessageHandlerRegistry) chan bool {
+	stop := make(chan bool)
+	for _, w := range mhr.Handlers {
+		go func(w MessageHandler) {
+			for {
+				select {
+				case <-w.Messages():
+				case <-stop:
+					return
+				}
+			}
+		}(*w)
+	}
+	return stop
+}
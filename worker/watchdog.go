@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"runtime"
+	"time"
+)
+
+// The exit code used when the watchdog restarts the agent.
+const WATCHDOG_EXIT_CODE = 3
+
+// The largest goroutine dump that the watchdog will log.
+const MAX_GOROUTINE_DUMP_SIZE = 16 * 1024 * 1024
+
+// The most seconds that the agent waits for its databases to close when the watchdog restarts it. A stuck worker can
+// hold a database transaction open, so the agent exits anyway when they are not closed in time.
+const WATCHDOG_SHUTDOWN_TIMEOUT_S = 30
+
+// The watchdog periodically checks the progress of every worker. A worker that has been handling the same command,
+// event or subworker run for longer than the configured timeout is marked as degraded in the worker status manager,
+// and a goroutine dump is logged so that the blocked call can be found. A degraded worker that makes progress again
+// goes back to the initialized status.
+type Watchdog struct {
+	cfg     *config.WatchdogConfig
+	stop    chan bool
+	restart func() // Shuts the agent down and exits with WATCHDOG_EXIT_CODE, so that its service manager starts it again.
+}
+
+// Start the watchdog on its own go routine. The restart function is called when a worker is stuck and the watchdog is
+// configured to restart the agent. Returns nil when the watchdog is disabled.
+func StartWatchdog(cfg *config.WatchdogConfig, restart func()) *Watchdog {
+	if !cfg.IsEnabled() {
+		glog.Infof(wdLogString(fmt.Sprintf("disabled")))
+		return nil
+	}
+
+	wd := &Watchdog{
+		cfg:     cfg,
+		stop:    make(chan bool),
+		restart: restart,
+	}
+
+	glog.Infof(wdLogString(fmt.Sprintf("starting with config %v", cfg)))
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CheckIntervalS) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-wd.stop:
+				glog.V(3).Infof(wdLogString(fmt.Sprintf("terminated")))
+				return
+			case now := <-ticker.C:
+				wd.check(now)
+			}
+		}
+	}()
+
+	return wd
+}
+
+func (wd *Watchdog) Stop() {
+	close(wd.stop)
+}
+
+// Check the progress of every worker and return the names of the workers that are stuck.
+func (wd *Watchdog) check(now time.Time) []string {
+	deadline := uint64(now.Unix()) - uint64(wd.cfg.StuckTimeoutS)
+
+	wsm := GetWorkerStatusManager()
+	wsm.ManagerLock.Lock()
+	statuses := make([]*WorkerStatus, 0, len(wsm.Workers))
+	for _, ws := range wsm.Workers {
+		statuses = append(statuses, ws)
+	}
+	wsm.ManagerLock.Unlock()
+
+	stuck := make([]string, 0)
+	newlyStuck := false
+	for _, ws := range statuses {
+		status := ws.GetStatus()
+		if inFlight := ws.StuckSince(deadline); inFlight != "" {
+			stuck = append(stuck, ws.Name)
+			if status != STATUS_DEGRADED && status != STATUS_TERMINATED {
+				glog.Errorf(wdLogString(fmt.Sprintf("worker %v has been handling %v for more than %v seconds, marking it %v", ws.Name, inFlight, wd.cfg.StuckTimeoutS, STATUS_DEGRADED)))
+				wsm.SetWorkerStatus(ws.Name, STATUS_DEGRADED)
+				newlyStuck = true
+			}
+		} else if status == STATUS_DEGRADED {
+			glog.Infof(wdLogString(fmt.Sprintf("worker %v is making progress again", ws.Name)))
+			wsm.SetWorkerStatus(ws.Name, STATUS_INITIALIZED)
+		}
+	}
+
+	if newlyStuck {
+		glog.Errorf(wdLogString(fmt.Sprintf("goroutine dump:\n%s", goroutineDump())))
+		if wd.cfg.RestartOnStuck {
+			glog.Errorf(wdLogString(fmt.Sprintf("restarting the agent, stuck workers: %v", stuck)))
+			wd.restart()
+		}
+	}
+
+	return stuck
+}
+
+// Returns the stacks of all the goroutines.
+func goroutineDump() []byte {
+	buf := make([]byte, 1024*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= MAX_GOROUTINE_DUMP_SIZE {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+var wdLogString = func(v interface{}) string {
+	return fmt.Sprintf("Watchdog: %v", v)
+}
@@ -0,0 +1,165 @@
+// +build unit
+
+package worker
+
+import (
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/events"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Watchdog_stuck_command(t *testing.T) {
+
+	// reset the workerStatusManager for testing
+	resetWorkerStatusManager()
+
+	restarts := 0
+
+	w := NewStuckWorker("stuckworker", getBasicConfig(), 0)
+	w.Commands <- NewTestCommand1(NewTestMessage())
+
+	// Wait for the worker to start handling the command.
+	waitForProgress(t, "stuckworker", func(p WorkerProgress) bool { return p.CommandInFlight == "*worker.TestCommand1" })
+
+	wd := &Watchdog{cfg: &config.WatchdogConfig{StuckTimeoutS: 60, CheckIntervalS: 30, RestartOnStuck: true}, restart: func() { restarts += 1 }}
+
+	// The command has not been running for long enough.
+	assert.Equal(t, []string{}, wd.check(time.Now()), "No workers should be stuck.")
+	assert.Equal(t, STATUS_INITIALIZED, workerStatusManager.GetWorkerStatus("stuckworker"))
+
+	// The worker is degraded once the timeout has passed, and the agent is restarted only once.
+	later := time.Now().Add(2 * time.Minute)
+	assert.Equal(t, []string{"stuckworker"}, wd.check(later), "The worker should be stuck.")
+	assert.Equal(t, STATUS_DEGRADED, workerStatusManager.GetWorkerStatus("stuckworker"))
+	assert.Equal(t, []string{"stuckworker"}, wd.check(later), "The worker should still be stuck.")
+	assert.Equal(t, 1, restarts, "The agent should be restarted once.")
+
+	// The worker goes back to initialized when it makes progress.
+	w.release <- true
+	waitForProgress(t, "stuckworker", func(p WorkerProgress) bool { return p.CommandInFlight == "" && p.LastCommandFinishTime != 0 })
+	assert.Equal(t, []string{}, wd.check(later), "No workers should be stuck.")
+	assert.Equal(t, STATUS_INITIALIZED, workerStatusManager.GetWorkerStatus("stuckworker"))
+
+	w.Commands <- NewTerminateCommand("shutdown")
+}
+
+func Test_Watchdog_stuck_event(t *testing.T) {
+
+	// reset the workerStatusManager for testing
+	resetWorkerStatusManager()
+
+	restarts := 0
+
+	workerStatusManager.SetWorkerStatus("eventworker", STATUS_INITIALIZED)
+	workerStatusManager.EventStarted("eventworker", "*worker.TestMessage")
+
+	wd := &Watchdog{cfg: &config.WatchdogConfig{StuckTimeoutS: 60, CheckIntervalS: 30}, restart: func() { restarts += 1 }}
+	assert.Equal(t, []string{"eventworker"}, wd.check(time.Now().Add(2*time.Minute)), "The worker should be stuck.")
+	assert.Equal(t, STATUS_DEGRADED, workerStatusManager.GetWorkerStatus("eventworker"))
+	assert.Equal(t, 0, restarts, "The agent should not be restarted.")
+
+	workerStatusManager.EventFinished("eventworker")
+	assert.Equal(t, []string{}, wd.check(time.Now().Add(2*time.Minute)), "No workers should be stuck.")
+	assert.Equal(t, STATUS_INITIALIZED, workerStatusManager.GetWorkerStatus("eventworker"))
+}
+
+func Test_Watchdog_stuck_nowork_handler(t *testing.T) {
+
+	// reset the workerStatusManager for testing
+	resetWorkerStatusManager()
+
+	w := NewStuckWorker("noworkworker", getBasicConfig(), 1)
+	waitForProgress(t, "noworkworker", func(p WorkerProgress) bool { return p.CommandInFlight == "NoWorkHandler" })
+
+	wd := &Watchdog{cfg: &config.WatchdogConfig{StuckTimeoutS: 60, CheckIntervalS: 30}}
+	assert.Equal(t, []string{"noworkworker"}, wd.check(time.Now().Add(2*time.Minute)), "The worker should be stuck.")
+
+	w.SetNoWorkInterval(0)
+	w.release <- true
+	waitForProgress(t, "noworkworker", func(p WorkerProgress) bool { return p.CommandInFlight == "" })
+	assert.Equal(t, []string{}, wd.check(time.Now().Add(2*time.Minute)), "No workers should be stuck.")
+
+	w.Commands <- NewTerminateCommand("shutdown")
+}
+
+func Test_Watchdog_stuck_subworker(t *testing.T) {
+
+	// reset the workerStatusManager for testing
+	resetWorkerStatusManager()
+
+	w := NewStuckWorker("subworkerowner", getBasicConfig(), 0)
+	release := make(chan bool)
+	w.DispatchSubworker("poller", func() int { <-release; return 1 }, 0, false)
+	waitForProgress(t, "subworkerowner", func(p WorkerProgress) bool { return p.SubworkersInFlight["poller"] != 0 })
+
+	wd := &Watchdog{cfg: &config.WatchdogConfig{StuckTimeoutS: 60, CheckIntervalS: 30}}
+	assert.Equal(t, []string{"subworkerowner"}, wd.check(time.Now().Add(2*time.Minute)), "The worker should be stuck.")
+	assert.Equal(t, STATUS_DEGRADED, workerStatusManager.GetWorkerStatus("subworkerowner"))
+
+	// The subworker does not block once it is released.
+	close(release)
+	waitForProgress(t, "subworkerowner", func(p WorkerProgress) bool { return len(p.SubworkersInFlight) == 0 })
+	assert.Equal(t, []string{}, wd.check(time.Now().Add(2*time.Minute)), "No workers should be stuck.")
+
+	w.Commands <- NewBeginShutdownCommand()
+	w.Commands <- NewTerminateCommand("shutdown")
+}
+
+func Test_StartWatchdog_disabled(t *testing.T) {
+	assert.Nil(t, StartWatchdog(&config.WatchdogConfig{StuckTimeoutS: -1, CheckIntervalS: 30}, nil), "The watchdog should be disabled.")
+
+	wd := StartWatchdog(&config.WatchdogConfig{StuckTimeoutS: 60, CheckIntervalS: 30}, func() {})
+	assert.NotNil(t, wd, "The watchdog should be enabled.")
+	wd.Stop()
+}
+
+func waitForProgress(t *testing.T, name string, done func(WorkerProgress) bool) {
+	for i := 0; i < 50; i++ {
+		ws := workerStatusManager.getWorker(name)
+		ws.StatusLock.Lock()
+		p := ws.Progress
+		subworkers := make(map[string]uint64)
+		for name, started := range ws.Progress.SubworkersInFlight {
+			subworkers[name] = started
+		}
+		p.SubworkersInFlight = subworkers
+		ws.StatusLock.Unlock()
+		if done(p) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("the worker did not make the expected progress")
+}
+
+// A worker whose command handler blocks until it is released.
+type StuckWorker struct {
+	BaseWorker // embedded field
+	release    chan bool
+}
+
+func (t *StuckWorker) Messages() chan events.Message {
+	return t.BaseWorker.Manager.Messages
+}
+
+func (t *StuckWorker) NewEvent(incoming events.Message) {}
+
+func (t *StuckWorker) CommandHandler(command Command) bool {
+	<-t.release
+	return true
+}
+
+func (t *StuckWorker) NoWorkHandler() {
+	<-t.release
+}
+
+func NewStuckWorker(name string, cfg *config.HorizonConfig, noWorkInterval int) *StuckWorker {
+	worker := &StuckWorker{
+		BaseWorker: NewBaseWorker(name, cfg, nil),
+		release:    make(chan bool),
+	}
+	worker.Start(worker, noWorkInterval)
+	return worker
+}
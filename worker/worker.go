@@ -4,14 +4,20 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/eventjournal"
 	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/metrics"
 	"runtime"
+	"sort"
 	"time"
 )
 
 // The core of anax is an event handling system that distributes events to workers, where the workers
 // process events that they are about.
 
+var commandQueueLength = metrics.NewGaugeVec("anax_worker_command_queue_length", "The number of commands queued to a worker.", "worker")
+var commandDuration = metrics.NewHistogramVec("anax_worker_command_duration_seconds", "The time taken by a worker to handle a command.", nil, "worker", "command")
+
 type Command interface {
 	ShortString() string
 }
@@ -304,7 +310,13 @@ func (w *BaseWorker) internalCommandhandler(worker Worker, command Command) bool
 	}
 
 	// Handle domain specific commands
-	if handled := worker.CommandHandler(command); !handled {
+	start := time.Now()
+	workerStatusManager.CommandStarted(w.GetName(), fmt.Sprintf("%T", command))
+	handled := worker.CommandHandler(command)
+	workerStatusManager.CommandFinished(w.GetName())
+	commandDuration.Observe(time.Since(start).Seconds(), w.GetName(), fmt.Sprintf("%T", command))
+
+	if !handled {
 		glog.Errorf(cdLogString(fmt.Sprintf("%v received unknown command (%T): %v", w.GetName(), command, command)))
 	} else {
 		glog.V(2).Infof(cdLogString(fmt.Sprintf("%v handled command (%T)", w.GetName(), command)))
@@ -317,8 +329,20 @@ func (w *BaseWorker) Start(worker Worker, noWorkInterval int) {
 
 	w.SetNoWorkInterval(noWorkInterval)
 
+	// The queue length is read when the metrics are scraped.
+	commands := w.Commands
+	metrics.RegisterCollector("worker_queue_"+w.GetName(), func() {
+		commandQueueLength.Set(float64(len(commands)), w.GetName())
+	})
+
 	go func() {
 
+		// The queue length is not reported once the worker is gone.
+		defer func() {
+			metrics.UnregisterCollector("worker_queue_" + w.GetName())
+			commandQueueLength.Delete(w.GetName())
+		}()
+
 		// log worker status
 		workerStatusManager.SetWorkerStatus(w.GetName(), STATUS_STARTED)
 
@@ -364,7 +388,9 @@ func (w *BaseWorker) Start(worker Worker, noWorkInterval int) {
 				case <-time.After(time.Duration(waitTime) * time.Second):
 					// Call the no work to do handler if it was requested.
 					if w.GetNoWorkInterval() != 0 {
+						workerStatusManager.CommandStarted(w.GetName(), "NoWorkHandler")
 						worker.NoWorkHandler()
+						workerStatusManager.CommandFinished(w.GetName())
 					}
 
 					// Requeue any deferred commands that have been accumulating.
@@ -464,7 +490,9 @@ func (w *BaseWorker) DispatchSubworker(name string, runSubWorker func() int, int
 				if !logOptOut {
 					glog.V(3).Infof(cdLogString(fmt.Sprintf("Running subworker %v", name)))
 				}
+				workerStatusManager.SubworkerStarted(w.GetName(), name)
 				returnedWait := runSubWorker()
+				workerStatusManager.SubworkerFinished(w.GetName(), name)
 				if !logOptOut {
 					glog.V(3).Infof(cdLogString(fmt.Sprintf("Finished run of subworker %v", name)))
 				}
@@ -486,14 +514,23 @@ type MessageHandler interface {
 
 type MessageHandlerRegistry struct {
 	Handlers map[string]*MessageHandler
+	journal  *eventjournal.Journal
+	sources  map[string]chan events.Message
 }
 
 func NewMessageHandlerRegistry() *MessageHandlerRegistry {
 	mhr := new(MessageHandlerRegistry)
 	mhr.Handlers = make(map[string]*MessageHandler)
+	mhr.sources = make(map[string]chan events.Message)
 	return mhr
 }
 
+// Add a source of messages that does not handle any messages itself, for example the config reloader. Sources do not
+// keep the event processing loop running, it ends when all the workers have stopped.
+func (m *MessageHandlerRegistry) AddSource(name string, messages chan events.Message) {
+	m.sources[name] = messages
+}
+
 func (m *MessageHandlerRegistry) Add(mh interface {
 	MessageHandler
 }) {
@@ -508,6 +545,21 @@ func (m *MessageHandlerRegistry) Remove(name string) {
 	}
 }
 
+// Record every message dispatched to the workers in the journal. A nil journal turns recording off.
+func (m *MessageHandlerRegistry) SetJournal(j *eventjournal.Journal) {
+	m.journal = j
+}
+
+// Returns the names of the workers that messages are dispatched to, sorted by name.
+func (m *MessageHandlerRegistry) Names() []string {
+	names := make([]string, 0, len(m.Handlers))
+	for name := range m.Handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (m *MessageHandlerRegistry) IsEmpty() bool {
 	return len(m.Handlers) == 0
 }
@@ -521,37 +573,60 @@ func (m *MessageHandlerRegistry) Contains(name string) bool {
 // out to each worker. Workers then receive messages and, for messages they care about, the worker pushes them out as commands
 // onto their own channels to operate on them.
 //
-func eventHandler(incoming events.Message, workers *MessageHandlerRegistry) (string, error) {
+func eventHandler(incoming events.Message, source string, workers *MessageHandlerRegistry) (string, error) {
 	successMsg := "propagated event to all workers"
 
 	// If the message is the special worker stop message, then remove that worker from the dispatch pool.
 	switch incoming.(type) {
 	case *events.WorkerStopMessage:
 		msg, _ := incoming.(*events.WorkerStopMessage)
+		if workers.journal != nil {
+			workers.journal.Record(source, []string{}, incoming)
+		}
 		workers.Remove(msg.Name())
 		workerStatusManager.SetWorkerStatus(msg.Name(), STATUS_TERMINATED)
 		return successMsg, nil
 	}
 
+	if workers.journal != nil {
+		workers.journal.Record(source, workers.Names(), incoming)
+	}
+
 	// Dispatch the message to all workers
 	for name, worker := range workers.Handlers {
 		glog.V(5).Infof(mdLogString(fmt.Sprintf("Delivering message to %v", name)))
+		workerStatusManager.EventStarted(name, fmt.Sprintf("%T", incoming))
 		(*worker).NewEvent(incoming)
+		workerStatusManager.EventFinished(name)
 		glog.V(5).Infof(mdLogString(fmt.Sprintf("Delivered message to %v", name)))
 	}
 
 	return successMsg, nil
 }
 
+// A message on the global message queue, along with the name of the worker that sent it.
+type sourcedMessage struct {
+	source string
+	msg    events.Message
+}
+
 // This function combines all messages (events) from workers into a single global message queue. From this
 // global queue, each message will get delivered to each worker by the event handler function.
 //
-func mux(workers *MessageHandlerRegistry, muxed chan events.Message) chan events.Message {
+func mux(workers *MessageHandlerRegistry, muxed chan sourcedMessage) chan sourcedMessage {
 
-	for _, w := range workers.Handlers {
+	for name, w := range workers.Handlers {
 		select {
 		case ev := <-(*w).Messages():
-			muxed <- ev
+			muxed <- sourcedMessage{source: name, msg: ev}
+		default: // nothing
+		}
+	}
+
+	for name, messages := range workers.sources {
+		select {
+		case ev := <-messages:
+			muxed <- sourcedMessage{source: name, msg: ev}
 		default: // nothing
 		}
 	}
@@ -563,7 +638,7 @@ func (workers *MessageHandlerRegistry) ProcessEventMessages() {
 
 	// 200 messages should be plenty. We will never get more than 1 message from every worker each time
 	// we write into this stream.
-	messageStream := make(chan events.Message, 200)
+	messageStream := make(chan sourcedMessage, 200)
 
 	last := int64(0)
 
@@ -581,12 +656,13 @@ func (workers *MessageHandlerRegistry) ProcessEventMessages() {
 		done := false
 		for !done {
 			select {
-			case msg := <-messageStream:
+			case sm := <-messageStream:
+				msg := sm.msg
 				glog.V(3).Infof(mdLogString(fmt.Sprintf("Handling Message (%T): %v\n", msg, msg.ShortString())))
 				glog.V(5).Infof(mdLogString(fmt.Sprintf("Handling Message (%T): %v\n", msg, msg)))
 
 				// Push outbound messages into each worker.
-				if successMsg, err := eventHandler(msg, workers); err != nil {
+				if successMsg, err := eventHandler(msg, sm.source, workers); err != nil {
 					// error! do some barfing and then continue
 					glog.Errorf(mdLogString(fmt.Sprintf("Error occurred handling message: %s, Error: %v\n", msg, err)))
 				} else {
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -14,6 +15,7 @@ const (
 	STATUS_INIT_FAILED = "initialization failed"
 	STATUS_TERMINATING = "terminating"
 	STATUS_TERMINATED  = "terminated"
+	STATUS_DEGRADED    = "degraded"
 )
 
 var workerStatusManager = NewWorkerStatusManager()
@@ -32,9 +34,58 @@ type WorkerStatus struct {
 	Name            string            `json:"name"`
 	Status          string            `json:"status"`
 	SubworkerStatus map[string]string `json:"subworker_status"`
+	Progress        WorkerProgress    `json:"progress"`
 	StatusLock      sync.Mutex        `json:"-"` // The lock that protects modification from different threads at the same time
 }
 
+// The progress of a worker. A worker handles commands on its own go routine, and events are delivered to it on the
+// event dispatcher go routine, so the command and the event in flight are tracked separately. The times are in seconds
+// since the epoch.
+type WorkerProgress struct {
+	CommandInFlight       string `json:"command_in_flight"`        // the type of the command being handled, or NoWorkHandler, empty when there is none
+	LastCommandStartTime  uint64 `json:"last_command_start_time"`  // when the worker started handling the most recent command
+	LastCommandFinishTime uint64 `json:"last_command_finish_time"` // when the worker finished handling the most recent command
+	EventInFlight         string `json:"event_in_flight"`          // the type of the event being delivered, empty when there is none
+	LastEventStartTime    uint64 `json:"last_event_start_time"`    // when the most recent event started being delivered to the worker
+	LastEventFinishTime   uint64 `json:"last_event_finish_time"`   // when the most recent event was delivered to the worker
+
+	// The subworkers run on their own go routines. Each subworker that is running is in the map, with the time that
+	// it started running.
+	SubworkersInFlight map[string]uint64 `json:"subworkers_in_flight,omitempty"`
+}
+
+// Returns the type of the command or event, or the name of the subworker, that the worker has been handling since
+// before the given time, or an empty string if the worker is not stuck.
+func (w *WorkerStatus) StuckSince(t uint64) string {
+	w.StatusLock.Lock()
+	defer w.StatusLock.Unlock()
+
+	if w.Progress.CommandInFlight != "" && w.Progress.LastCommandStartTime < t {
+		return w.Progress.CommandInFlight
+	} else if w.Progress.EventInFlight != "" && w.Progress.LastEventStartTime < t {
+		return w.Progress.EventInFlight
+	}
+	for name, started := range w.Progress.SubworkersInFlight {
+		if started < t {
+			return fmt.Sprintf("subworker %v", name)
+		}
+	}
+	return ""
+}
+
+// The status is written to the status API while the worker changes it, so it is copied under the lock.
+func (w *WorkerStatus) MarshalJSON() ([]byte, error) {
+	w.StatusLock.Lock()
+	defer w.StatusLock.Unlock()
+
+	return json.Marshal(struct {
+		Name            string            `json:"name"`
+		Status          string            `json:"status"`
+		SubworkerStatus map[string]string `json:"subworker_status"`
+		Progress        WorkerProgress    `json:"progress"`
+	}{w.Name, w.Status, w.SubworkerStatus, w.Progress})
+}
+
 func (w *WorkerStatus) SetWorkerStatus(status string) {
 	w.StatusLock.Lock()
 	defer w.StatusLock.Unlock()
@@ -42,6 +93,13 @@ func (w *WorkerStatus) SetWorkerStatus(status string) {
 	w.Status = status
 }
 
+func (w *WorkerStatus) GetStatus() string {
+	w.StatusLock.Lock()
+	defer w.StatusLock.Unlock()
+
+	return w.Status
+}
+
 func (w *WorkerStatus) SetSubworkerStatus(name string, status string) {
 	w.StatusLock.Lock()
 	defer w.StatusLock.Unlock()
@@ -97,6 +155,82 @@ func (w *WorkerStatusManager) SetSubworkerStatus(name string, subname string, st
 	w.StatusLog = append(w.StatusLog, fmt.Sprintf("%v Worker %v: subworker %v %v.", time_s, name, subname, status))
 }
 
+// Get the status of the given worker, creating it when it does not exist yet.
+func (w *WorkerStatusManager) getWorker(name string) *WorkerStatus {
+	w.ManagerLock.Lock()
+	defer w.ManagerLock.Unlock()
+
+	if _, ok := w.Workers[name]; !ok {
+		w.Workers[name] = &WorkerStatus{
+			Name:            name,
+			Status:          STATUS_NONE,
+			SubworkerStatus: make(map[string]string),
+		}
+	}
+	return w.Workers[name]
+}
+
+// Record that the given worker started handling a command.
+func (w *WorkerStatusManager) CommandStarted(name string, command string) {
+	ws := w.getWorker(name)
+	ws.StatusLock.Lock()
+	defer ws.StatusLock.Unlock()
+
+	ws.Progress.CommandInFlight = command
+	ws.Progress.LastCommandStartTime = uint64(time.Now().Unix())
+}
+
+// Record that the given worker finished handling its command.
+func (w *WorkerStatusManager) CommandFinished(name string) {
+	ws := w.getWorker(name)
+	ws.StatusLock.Lock()
+	defer ws.StatusLock.Unlock()
+
+	ws.Progress.CommandInFlight = ""
+	ws.Progress.LastCommandFinishTime = uint64(time.Now().Unix())
+}
+
+// Record that an event is being delivered to the given worker.
+func (w *WorkerStatusManager) EventStarted(name string, event string) {
+	ws := w.getWorker(name)
+	ws.StatusLock.Lock()
+	defer ws.StatusLock.Unlock()
+
+	ws.Progress.EventInFlight = event
+	ws.Progress.LastEventStartTime = uint64(time.Now().Unix())
+}
+
+// Record that an event was delivered to the given worker.
+func (w *WorkerStatusManager) EventFinished(name string) {
+	ws := w.getWorker(name)
+	ws.StatusLock.Lock()
+	defer ws.StatusLock.Unlock()
+
+	ws.Progress.EventInFlight = ""
+	ws.Progress.LastEventFinishTime = uint64(time.Now().Unix())
+}
+
+// Record that a subworker of the given worker started running.
+func (w *WorkerStatusManager) SubworkerStarted(name string, subname string) {
+	ws := w.getWorker(name)
+	ws.StatusLock.Lock()
+	defer ws.StatusLock.Unlock()
+
+	if ws.Progress.SubworkersInFlight == nil {
+		ws.Progress.SubworkersInFlight = make(map[string]uint64)
+	}
+	ws.Progress.SubworkersInFlight[subname] = uint64(time.Now().Unix())
+}
+
+// Record that a subworker of the given worker finished running.
+func (w *WorkerStatusManager) SubworkerFinished(name string, subname string) {
+	ws := w.getWorker(name)
+	ws.StatusLock.Lock()
+	defer ws.StatusLock.Unlock()
+
+	delete(ws.Progress.SubworkersInFlight, subname)
+}
+
 // Get the status string for the given worker. It returns an empty string if the worker does not exist.
 func (w *WorkerStatusManager) GetWorkerStatus(name string) string {
 	if ws, ok := w.Workers[name]; ok {